@@ -0,0 +1,452 @@
+package pod
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/p9c/parallelcoin/pkg/block"
+	"github.com/p9c/parallelcoin/pkg/blockchain"
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/database/bboltdb"
+	"github.com/p9c/parallelcoin/pkg/database/ffldb"
+	_ "github.com/p9c/parallelcoin/pkg/database/memdb"
+	"github.com/p9c/parallelcoin/pkg/interrupt"
+	"github.com/p9c/parallelcoin/pkg/migration"
+)
+
+// dbCommands is the list of subcommands of the db command, which work on a block database.
+var dbCommands = map[string]func(args []string) int{
+	"backup":  dbBackup,
+	"buckets": dbBuckets,
+	"check":   dbCheck,
+	"convert": dbConvert,
+	"dump":    dbDump,
+	"export":  dbExport,
+	"import":  dbImport,
+	"migrate": dbMigrate,
+}
+
+// dbCmd runs the db subcommand given as the first argument with the arguments that follow it.
+func dbCmd(args []string) int {
+	if len(args) > 0 {
+		if run, ok := dbCommands[args[0]]; ok {
+			return run(args[1:])
+		}
+	}
+	names := make([]string, 0, len(dbCommands))
+	for name := range dbCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	_, _ = fmt.Fprintln(os.Stderr, "usage: pod db", strings.Join(names, "|"), "[flags]")
+	return 1
+}
+
+// dbConvert copies the blocks and metadata of a database into a new database of another type, such as to migrate an
+// ffldb database to bboltdb.
+func dbConvert(args []string) int {
+	fs := flag.NewFlagSet("db convert", flag.ContinueOnError)
+	network := fs.String("net", chaincfg.MainNetParams.Name, "network of the databases, or a network file")
+	from := fs.String("from", "ffldb", "type of the database to convert")
+	src := fs.String("src", "", "path of the database to convert")
+	to := fs.String("to", "bboltdb", "type of the database to create")
+	dst := fs.String("dst", "", "path of the database to create, which must not exist yet")
+	batch := fs.Int("batch", 1000, "number of blocks or metadata entries copied in each transaction")
+	if e := fs.Parse(args); e != nil {
+		return 1
+	}
+	if *src == "" || *dst == "" || *batch < 1 {
+		_, _ = fmt.Fprintln(os.Stderr, "db convert: -src and -dst are required and -batch must be positive")
+		return 1
+	}
+	params, e := loadNetwork(*network)
+	if e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db convert:", e)
+		return 1
+	}
+	var srcDB, dstDB database.DB
+	if srcDB, e = database.Open(*from, *src, params.Net); e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db convert:", e)
+		return 1
+	}
+	defer func() {
+		if e := srcDB.Close(); E.Chk(e) {
+		}
+	}()
+	if dstDB, e = database.Create(*to, *dst, params.Net); e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db convert:", e)
+		return 1
+	}
+	defer func() {
+		if e := dstDB.Close(); E.Chk(e) {
+		}
+	}()
+	var blocks, entries int
+	if blocks, e = copyBlocks(srcDB, dstDB, *batch); e == nil {
+		// Entries the source driver keeps in the metadata for itself are named after it and are not copied.
+		prefix := []byte(*from + "-")
+		entries, e = copyMetadata(
+			srcDB, dstDB, *batch, func(k []byte) bool {
+				return bytes.HasPrefix(k, prefix)
+			},
+		)
+	}
+	if e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db convert:", e)
+		_, _ = fmt.Fprintln(os.Stderr, "db convert: the incomplete database at", *dst, "should be removed")
+		return 1
+	}
+	_, _ = fmt.Fprintf(os.Stdout, "copied %d blocks and %d metadata entries to %s\n", blocks, entries, *dst)
+	return 0
+}
+
+// dbBackup writes a copy of a database that is not in use by a node to a new directory. A running node is backed up
+// with the backupdb RPC command instead, as its database can not be opened by another process.
+func dbBackup(args []string) int {
+	fs := flag.NewFlagSet("db backup", flag.ContinueOnError)
+	network := fs.String("net", chaincfg.MainNetParams.Name, "network of the database, or a network file")
+	dbType := fs.String("type", "ffldb", "type of the database to back up")
+	path := fs.String("path", "", "path of the database to back up")
+	dest := fs.String("dest", "", "path of the backup to write, which must not exist yet")
+	if e := fs.Parse(args); e != nil {
+		return 1
+	}
+	if *path == "" || *dest == "" {
+		_, _ = fmt.Fprintln(os.Stderr, "db backup: -path and -dest are required")
+		return 1
+	}
+	params, e := loadNetwork(*network)
+	if e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db backup:", e)
+		return 1
+	}
+	var db database.DB
+	if db, e = database.Open(*dbType, *path, params.Net); e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db backup:", e)
+		return 1
+	}
+	defer func() {
+		if e := db.Close(); E.Chk(e) {
+		}
+	}()
+	if e = db.Backup(*dest); e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db backup:", e)
+		return 1
+	}
+	_, _ = fmt.Fprintln(os.Stdout, "backed up", *path, "to", *dest)
+	return 0
+}
+
+// dbCheck checks the blocks and chain metadata of a database, prints the problems it finds and repairs them as asked.
+// It returns 1 when problems are left unrepaired.
+func dbCheck(args []string) int {
+	fs := flag.NewFlagSet("db check", flag.ContinueOnError)
+	network := fs.String("net", chaincfg.MainNetParams.Name, "network of the database, or a network file")
+	dbType := fs.String("type", "ffldb", "type of the database to check")
+	path := fs.String("path", "", "path of the database to check")
+	prune := fs.Bool("prune", false, "the node runs with a prune target, so old spend journal entries are not expected")
+	truncate := fs.Bool("truncate", false, "remove damaged blocks, truncating the block files where they end in them")
+	rebuild := fs.Bool("rebuild", false, "rebuild missing and damaged spend journal entries from the block data")
+	if e := fs.Parse(args); e != nil {
+		return 1
+	}
+	if *path == "" {
+		_, _ = fmt.Fprintln(os.Stderr, "db check: -path is required")
+		return 1
+	}
+	params, e := loadNetwork(*network)
+	if e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db check:", e)
+		return 1
+	}
+	// Block files that are shorter than the metadata expects stop a database that keeps its blocks in flat files from
+	// opening, which is one of the things checked for.
+	openArgs := []interface{}{*path, params.Net}
+	switch *dbType {
+	case "ffldb":
+		openArgs = append(openArgs, ffldb.AllowTruncated)
+	case "bboltdb":
+		openArgs = append(openArgs, bboltdb.AllowTruncated)
+	}
+	var db database.DB
+	if db, e = database.Open(*dbType, openArgs...); e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db check:", e)
+		return 1
+	}
+	defer func() {
+		if e := db.Close(); E.Chk(e) {
+		}
+	}()
+	var problems []blockchain.DbProblem
+	problems, e = blockchain.CheckDatabase(
+		db, &blockchain.CheckConfig{
+			Pruned:    *prune,
+			Truncate:  *truncate,
+			Rebuild:   *rebuild,
+			Interrupt: interrupt.ShutdownRequestChan.Wait(),
+		},
+	)
+	for i := range problems {
+		_, _ = fmt.Fprintln(os.Stdout, problems[i].String())
+	}
+	if e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db check:", e)
+		return 1
+	}
+	var repaired int
+	for i := range problems {
+		if problems[i].Repaired {
+			repaired++
+		}
+	}
+	_, _ = fmt.Fprintf(os.Stdout, "found %d problems, repaired %d\n", len(problems), repaired)
+	if repaired < len(problems) {
+		return 1
+	}
+	return 0
+}
+
+// dbMigrate brings the chain in a database to the versions of its buckets used by this version of pod, which a node
+// otherwise does when it starts, and prints the migrations run. With -dry-run it only prints the migrations that would
+// be run.
+func dbMigrate(args []string) int {
+	fs := flag.NewFlagSet("db migrate", flag.ContinueOnError)
+	network := fs.String("net", chaincfg.MainNetParams.Name, "network of the database, or a network file")
+	dbType := fs.String("type", "ffldb", "type of the database to migrate")
+	path := fs.String("path", "", "path of the database to migrate")
+	dryRun := fs.Bool("dry-run", false, "only print the migrations that would be run")
+	if e := fs.Parse(args); e != nil {
+		return 1
+	}
+	if *path == "" {
+		_, _ = fmt.Fprintln(os.Stderr, "db migrate: -path is required")
+		return 1
+	}
+	params, e := loadNetwork(*network)
+	if e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db migrate:", e)
+		return 1
+	}
+	var db database.DB
+	if db, e = database.Open(*dbType, *path, params.Net); e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db migrate:", e)
+		return 1
+	}
+	defer func() {
+		if e := db.Close(); E.Chk(e) {
+		}
+	}()
+	steps, e := blockchain.MigrateDatabase(
+		db, params, &migration.Config{DryRun: *dryRun, Interrupt: interrupt.ShutdownRequestChan.Wait()},
+	)
+	verb := "migrated"
+	if *dryRun {
+		verb = "would migrate"
+	}
+	for i := range steps {
+		_, _ = fmt.Fprintln(os.Stdout, verb, "the", steps[i].String())
+	}
+	if e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db migrate:", e)
+		return 1
+	}
+	if len(steps) == 0 {
+		_, _ = fmt.Fprintln(os.Stdout, "the database is up to date")
+	}
+	return 0
+}
+
+// copyBlocks stores the blocks that are stored in the source database in the destination database in order of height,
+// committing after every batch of blocks, and returns how many were copied.
+func copyBlocks(src, dst database.DB, batch int) (n int, e error) {
+	var hashes []chainhash.Hash
+	if e = src.View(
+		func(tx database.Tx) error {
+			return blockchain.ForEachStoredBlock(
+				tx, func(hash *chainhash.Hash, height int32) error {
+					hashes = append(hashes, *hash)
+					return nil
+				},
+			)
+		},
+	); E.Chk(e) {
+		return 0, e
+	}
+	for start := 0; start < len(hashes); start += batch {
+		if interrupt.Requested() {
+			return n, errInterrupted
+		}
+		end := start + batch
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+		var blocks []*block.Block
+		if e = src.View(
+			func(tx database.Tx) (e error) {
+				for i := start; i < end; i++ {
+					var blockBytes []byte
+					if blockBytes, e = tx.FetchBlock(&hashes[i]); E.Chk(e) {
+						return e
+					}
+					var blk *block.Block
+					if blk, e = block.NewFromBytes(blockBytes); E.Chk(e) {
+						return e
+					}
+					blocks = append(blocks, blk)
+				}
+				return nil
+			},
+		); E.Chk(e) {
+			return n, e
+		}
+		if e = dst.Update(
+			func(tx database.Tx) (e error) {
+				for _, blk := range blocks {
+					if e = tx.StoreBlock(blk); E.Chk(e) {
+						return e
+					}
+				}
+				return nil
+			},
+		); E.Chk(e) {
+			return n, e
+		}
+		n += len(blocks)
+		I.F("copied %d of %d blocks", n, len(hashes))
+	}
+	return n, nil
+}
+
+// metadataCopier writes the metadata entries it is given to a database in transactions of a fixed number of entries.
+type metadataCopier struct {
+	db      database.DB
+	batch   int
+	tx      database.Tx
+	pending int
+	// path and bucket are the bucket that was last written to, which is looked up again after every commit.
+	path   [][]byte
+	bucket database.Bucket
+}
+
+// bucketAt returns the bucket at the given path from the metadata bucket in the current transaction, starting a new
+// transaction when there is none.
+func (c *metadataCopier) bucketAt(path [][]byte) (b database.Bucket, e error) {
+	if c.tx == nil {
+		if c.tx, e = c.db.Begin(true); E.Chk(e) {
+			return nil, e
+		}
+		c.bucket = nil
+	}
+	if c.bucket != nil && samePath(path, c.path) {
+		return c.bucket, nil
+	}
+	b = c.tx.Metadata()
+	for _, name := range path {
+		if b = b.Bucket(name); b == nil {
+			return nil, fmt.Errorf("bucket %q is missing from the destination", name)
+		}
+	}
+	c.path, c.bucket = path, b
+	return b, nil
+}
+
+// samePath returns whether two bucket paths name the same bucket.
+func samePath(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// written counts an entry as written and commits the transaction once a batch of entries has been written.
+func (c *metadataCopier) written() (e error) {
+	if c.pending++; c.pending < c.batch {
+		return nil
+	}
+	return c.commit()
+}
+
+// commit commits the current transaction, if there is one.
+func (c *metadataCopier) commit() (e error) {
+	if c.tx == nil {
+		return nil
+	}
+	tx := c.tx
+	c.tx, c.bucket, c.pending = nil, nil, 0
+	return tx.Commit()
+}
+
+// copyBucket copies the values and nested buckets of the source bucket into the bucket at the given path, skipping the
+// keys skip returns true for, and returns the number of entries copied.
+func (c *metadataCopier) copyBucket(src database.Bucket, path [][]byte, skip func(k []byte) bool) (n int, e error) {
+	cursor := src.Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		if interrupt.Requested() {
+			return n, errInterrupted
+		}
+		key := cursor.Key()
+		if skip != nil && skip(key) {
+			continue
+		}
+		var dst database.Bucket
+		if dst, e = c.bucketAt(path); E.Chk(e) {
+			return n, e
+		}
+		// Nested buckets have no value.
+		if value := cursor.Value(); value != nil {
+			if e = dst.Put(key, value); E.Chk(e) {
+				return n, e
+			}
+			n++
+			if e = c.written(); E.Chk(e) {
+				return n, e
+			}
+			continue
+		}
+		if _, e = dst.CreateBucket(key); E.Chk(e) {
+			return n, e
+		}
+		n++
+		if e = c.written(); E.Chk(e) {
+			return n, e
+		}
+		childPath := append(append([][]byte{}, path...), key)
+		var copied int
+		copied, e = c.copyBucket(src.Bucket(key), childPath, nil)
+		n += copied
+		if e != nil {
+			return n, e
+		}
+	}
+	return n, nil
+}
+
+// copyMetadata copies the metadata of the source database into the destination database, other than the top level
+// entries skip returns true for, committing after every batch of entries, and returns the number of entries copied.
+func copyMetadata(src, dst database.DB, batch int, skip func(k []byte) bool) (n int, e error) {
+	c := &metadataCopier{db: dst, batch: batch}
+	e = src.View(
+		func(tx database.Tx) (e error) {
+			n, e = c.copyBucket(tx.Metadata(), nil, skip)
+			return e
+		},
+	)
+	if e != nil {
+		if c.tx != nil {
+			_ = c.tx.Rollback()
+		}
+		return n, e
+	}
+	return n, c.commit()
+}
@@ -0,0 +1,492 @@
+package pod
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/p9c/parallelcoin/pkg/blockchain"
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/interrupt"
+)
+
+// dbRecord is an entry of a bucket as it is exported and imported, one to a line. The path is that of the bucket
+// holding the entry below the exported bucket, and it and the key are in hex, as is the value unless the entry is a
+// nested bucket.
+type dbRecord struct {
+	Path   []string `json:"path,omitempty"`
+	Key    string   `json:"key"`
+	Value  string   `json:"value,omitempty"`
+	Bucket bool     `json:"bucket,omitempty"`
+}
+
+// dbInspectFlags adds the flags that name the database to the flag set of one of the commands that inspect the
+// metadata of a database, along with the -bucket flag.
+func dbInspectFlags(fs *flag.FlagSet) (network, dbType, path, bucket *string) {
+	network = fs.String("net", chaincfg.MainNetParams.Name, "network of the database, or a network file")
+	dbType = fs.String("type", "ffldb", "type of the database, which may be any registered driver")
+	path = fs.String("path", "", "path of the database")
+	bucket = fs.String(
+		"bucket", "", "path of the bucket from the top of the metadata, with the names separated by / and names that "+
+			"are not text given in hex after 0x",
+	)
+	return
+}
+
+// openInspectDB opens the database for one of the commands that inspect the metadata, printing the reason it could not
+// be opened under the name of the command.
+func openInspectDB(cmd, network, dbType, path string) (db database.DB, ok bool) {
+	if path == "" {
+		_, _ = fmt.Fprintln(os.Stderr, cmd+": -path is required")
+		return nil, false
+	}
+	params, e := loadNetwork(network)
+	if e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, cmd+":", e)
+		return nil, false
+	}
+	if db, e = database.Open(dbType, path, params.Net); e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, cmd+":", e)
+		return nil, false
+	}
+	return db, true
+}
+
+// parseBucketPath parses a bucket path given as names separated by /, where names starting with 0x are in hex.
+func parseBucketPath(s string) (path [][]byte, e error) {
+	if s == "" {
+		return nil, nil
+	}
+	for _, name := range strings.Split(s, "/") {
+		if !strings.HasPrefix(name, "0x") {
+			path = append(path, []byte(name))
+			continue
+		}
+		var b []byte
+		if b, e = hex.DecodeString(name[2:]); e != nil {
+			return nil, fmt.Errorf("bucket name %q is not valid hex: %v", name, e)
+		}
+		path = append(path, b)
+	}
+	return path, nil
+}
+
+// bucketName returns a bucket name the way parseBucketPath reads it, which is in hex unless it is printable text.
+func bucketName(name []byte) string {
+	if len(name) == 0 || bytes.HasPrefix(name, []byte("0x")) || bytes.IndexByte(name, '/') >= 0 {
+		return "0x" + hex.EncodeToString(name)
+	}
+	for _, c := range name {
+		if c < 0x21 || c > 0x7e {
+			return "0x" + hex.EncodeToString(name)
+		}
+	}
+	return string(name)
+}
+
+// bucketAt returns the bucket at the path from the top of the metadata.
+func bucketAt(tx database.Tx, path [][]byte) (b database.Bucket, e error) {
+	b = tx.Metadata()
+	for i, name := range path {
+		if b = b.Bucket(name); b == nil {
+			return nil, fmt.Errorf("there is no bucket %s", bucketPathString(path[:i+1]))
+		}
+	}
+	return b, nil
+}
+
+// bucketPathString returns a bucket path the way parseBucketPath reads it.
+func bucketPathString(path [][]byte) string {
+	names := make([]string, len(path))
+	for i := range path {
+		names[i] = bucketName(path[i])
+	}
+	return strings.Join(names, "/")
+}
+
+// dbBuckets lists the buckets in the metadata of a database, or below the bucket given with -bucket, along with the
+// number of values and nested buckets each holds.
+func dbBuckets(args []string) int {
+	fs := flag.NewFlagSet("db buckets", flag.ContinueOnError)
+	network, dbType, path, bucket := dbInspectFlags(fs)
+	if e := fs.Parse(args); e != nil {
+		return 1
+	}
+	top, e := parseBucketPath(*bucket)
+	if e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db buckets:", e)
+		return 1
+	}
+	db, ok := openInspectDB("db buckets", *network, *dbType, *path)
+	if !ok {
+		return 1
+	}
+	defer func() {
+		if e := db.Close(); E.Chk(e) {
+		}
+	}()
+	out := bufio.NewWriter(os.Stdout)
+	e = db.View(
+		func(tx database.Tx) (e error) {
+			var b database.Bucket
+			if b, e = bucketAt(tx, top); E.Chk(e) {
+				return e
+			}
+			return listBuckets(out, b, top, 0)
+		},
+	)
+	if fe := out.Flush(); e == nil {
+		e = fe
+	}
+	if e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db buckets:", e)
+		return 1
+	}
+	return 0
+}
+
+// listBuckets writes a line for the bucket at the path with the number of values and buckets in it, followed by the
+// lines of the buckets nested in it indented below it.
+func listBuckets(w io.Writer, b database.Bucket, path [][]byte, depth int) (e error) {
+	var values int
+	var nested [][]byte
+	cursor := b.Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		if interrupt.Requested() {
+			return errInterrupted
+		}
+		if cursor.Value() == nil {
+			nested = append(nested, append([]byte{}, cursor.Key()...))
+			continue
+		}
+		values++
+	}
+	name := "/"
+	if len(path) > 0 {
+		name = bucketName(path[len(path)-1])
+	}
+	if _, e = fmt.Fprintf(
+		w, "%s%s (%d values, %d buckets)\n", strings.Repeat("  ", depth), name, values, len(nested),
+	); E.Chk(e) {
+		return e
+	}
+	for _, key := range nested {
+		childPath := append(append([][]byte{}, path...), key)
+		if e = listBuckets(w, b.Bucket(key), childPath, depth+1); E.Chk(e) {
+			return e
+		}
+	}
+	return nil
+}
+
+// dbDump prints the entries of a bucket, starting from the first key with the prefix given with -prefix and stopping
+// after the last one. The entries the chain writes are decoded unless -hex is given, and the others are printed in
+// hex.
+func dbDump(args []string) int {
+	fs := flag.NewFlagSet("db dump", flag.ContinueOnError)
+	network, dbType, path, bucket := dbInspectFlags(fs)
+	prefix := fs.String("prefix", "", "hex of the prefix of the keys to print")
+	limit := fs.Int("limit", 0, "maximum number of entries to print, or 0 for all of them")
+	raw := fs.Bool("hex", false, "print the keys and values in hex without decoding them")
+	if e := fs.Parse(args); e != nil {
+		return 1
+	}
+	top, e := parseBucketPath(*bucket)
+	if e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db dump:", e)
+		return 1
+	}
+	var seek []byte
+	if seek, e = hex.DecodeString(*prefix); e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db dump: -prefix is not valid hex:", e)
+		return 1
+	}
+	db, ok := openInspectDB("db dump", *network, *dbType, *path)
+	if !ok {
+		return 1
+	}
+	defer func() {
+		if e := db.Close(); E.Chk(e) {
+		}
+	}()
+	out := bufio.NewWriter(os.Stdout)
+	var n int
+	e = db.View(
+		func(tx database.Tx) (e error) {
+			var b database.Bucket
+			if b, e = bucketAt(tx, top); E.Chk(e) {
+				return e
+			}
+			cursor := b.Cursor()
+			for ok := cursor.Seek(seek); ok && bytes.HasPrefix(cursor.Key(), seek); ok = cursor.Next() {
+				if interrupt.Requested() {
+					return errInterrupted
+				}
+				if *limit > 0 && n == *limit {
+					break
+				}
+				n++
+				key, value := cursor.Key(), cursor.Value()
+				if value == nil {
+					_, e = fmt.Fprintln(out, bucketName(key), "(bucket)")
+				} else {
+					_, e = fmt.Fprintln(out, dumpEntry(top, key, value, *raw))
+				}
+				if E.Chk(e) {
+					return e
+				}
+			}
+			return nil
+		},
+	)
+	if fe := out.Flush(); e == nil {
+		e = fe
+	}
+	if e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db dump:", e)
+		return 1
+	}
+	return 0
+}
+
+// dumpEntry returns the line printed for an entry, which is decoded when it is one the chain writes and raw is not
+// set. Entries that fail to decode are printed in hex along with the reason.
+func dumpEntry(path [][]byte, key, value []byte, raw bool) string {
+	if !raw {
+		k, v, ok, e := blockchain.DecodeDbEntry(path, key, value)
+		switch {
+		case ok && e == nil:
+			return k + " " + v
+		case ok:
+			return fmt.Sprintf("%x %x (%v)", key, value, e)
+		}
+	}
+	return fmt.Sprintf("%x %x", key, value)
+}
+
+// dbExport writes the entries of a bucket and the buckets nested in it as lines of JSON, to a file given with -out or
+// to standard output. Exporting the whole metadata leaves out the entries the driver keeps for itself.
+func dbExport(args []string) int {
+	fs := flag.NewFlagSet("db export", flag.ContinueOnError)
+	network, dbType, path, bucket := dbInspectFlags(fs)
+	outPath := fs.String("out", "", "path of the file to write, which is standard output when it is not given")
+	if e := fs.Parse(args); e != nil {
+		return 1
+	}
+	top, e := parseBucketPath(*bucket)
+	if e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db export:", e)
+		return 1
+	}
+	db, ok := openInspectDB("db export", *network, *dbType, *path)
+	if !ok {
+		return 1
+	}
+	defer func() {
+		if e := db.Close(); E.Chk(e) {
+		}
+	}()
+	w := os.Stdout
+	if *outPath != "" {
+		if w, e = os.Create(*outPath); e != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "db export:", e)
+			return 1
+		}
+		defer func() {
+			if e := w.Close(); E.Chk(e) {
+			}
+		}()
+	}
+	out := bufio.NewWriter(w)
+	enc := json.NewEncoder(out)
+	var n int
+	e = db.View(
+		func(tx database.Tx) (e error) {
+			var b database.Bucket
+			if b, e = bucketAt(tx, top); E.Chk(e) {
+				return e
+			}
+			var skip func(k []byte) bool
+			if len(top) == 0 {
+				prefix := []byte(*dbType + "-")
+				skip = func(k []byte) bool {
+					return bytes.HasPrefix(k, prefix)
+				}
+			}
+			n, e = exportBucket(enc, b, nil, skip)
+			return e
+		},
+	)
+	if fe := out.Flush(); e == nil {
+		e = fe
+	}
+	if e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db export:", e)
+		return 1
+	}
+	if *outPath != "" {
+		_, _ = fmt.Fprintf(os.Stdout, "exported %d entries to %s\n", n, *outPath)
+	}
+	return 0
+}
+
+// exportBucket encodes the entries of a bucket, other than those skip returns true for, followed after each nested
+// bucket by its own entries, and returns the number of entries encoded.
+func exportBucket(enc *json.Encoder, b database.Bucket, path []string, skip func(k []byte) bool) (n int, e error) {
+	cursor := b.Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		if interrupt.Requested() {
+			return n, errInterrupted
+		}
+		key := cursor.Key()
+		if skip != nil && skip(key) {
+			continue
+		}
+		record := dbRecord{Path: path, Key: hex.EncodeToString(key)}
+		value := cursor.Value()
+		if value == nil {
+			record.Bucket = true
+		} else {
+			record.Value = hex.EncodeToString(value)
+		}
+		if e = enc.Encode(&record); E.Chk(e) {
+			return n, e
+		}
+		n++
+		if value != nil {
+			continue
+		}
+		childPath := append(append([]string{}, path...), record.Key)
+		var exported int
+		exported, e = exportBucket(enc, b.Bucket(key), childPath, nil)
+		n += exported
+		if e != nil {
+			return n, e
+		}
+	}
+	return n, nil
+}
+
+// dbImport writes the entries read as lines of JSON, as written by dbExport, from a file given with -in or from
+// standard input into a bucket, which is created along with the buckets above it when it does not exist. Entries with
+// the keys of existing entries replace them.
+func dbImport(args []string) int {
+	fs := flag.NewFlagSet("db import", flag.ContinueOnError)
+	network, dbType, path, bucket := dbInspectFlags(fs)
+	inPath := fs.String("in", "", "path of the file to read, which is standard input when it is not given")
+	batch := fs.Int("batch", 1000, "number of entries written in each transaction")
+	if e := fs.Parse(args); e != nil {
+		return 1
+	}
+	if *batch < 1 {
+		_, _ = fmt.Fprintln(os.Stderr, "db import: -batch must be positive")
+		return 1
+	}
+	top, e := parseBucketPath(*bucket)
+	if e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db import:", e)
+		return 1
+	}
+	r := os.Stdin
+	if *inPath != "" {
+		if r, e = os.Open(*inPath); e != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "db import:", e)
+			return 1
+		}
+		defer func() {
+			if e := r.Close(); E.Chk(e) {
+			}
+		}()
+	}
+	db, ok := openInspectDB("db import", *network, *dbType, *path)
+	if !ok {
+		return 1
+	}
+	defer func() {
+		if e := db.Close(); E.Chk(e) {
+		}
+	}()
+	e = db.Update(
+		func(tx database.Tx) (e error) {
+			b := tx.Metadata()
+			for _, name := range top {
+				if b, e = b.CreateBucketIfNotExists(name); E.Chk(e) {
+					return e
+				}
+			}
+			return nil
+		},
+	)
+	var n int
+	if e == nil {
+		n, e = importRecords(db, bufio.NewReader(r), top, *batch)
+	}
+	if e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "db import:", e)
+		_, _ = fmt.Fprintln(os.Stderr, "db import: imported", n, "entries before stopping")
+		return 1
+	}
+	_, _ = fmt.Fprintf(os.Stdout, "imported %d entries into %s\n", n, bucketPathString(top))
+	return 0
+}
+
+// importRecords writes the records read from r into the bucket at the path, committing after every batch of entries,
+// and returns the number of entries written.
+func importRecords(db database.DB, r io.Reader, top [][]byte, batch int) (n int, e error) {
+	c := &metadataCopier{db: db, batch: batch}
+	defer func() {
+		if c.tx != nil {
+			_ = c.tx.Rollback()
+		}
+	}()
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		if interrupt.Requested() {
+			return n, errInterrupted
+		}
+		var record dbRecord
+		if e = dec.Decode(&record); e == io.EOF {
+			break
+		} else if e != nil {
+			return n, fmt.Errorf("record %d: %v", line, e)
+		}
+		path := append([][]byte{}, top...)
+		var name, key, value []byte
+		for _, s := range record.Path {
+			if name, e = hex.DecodeString(s); e != nil {
+				return n, fmt.Errorf("record %d: path: %v", line, e)
+			}
+			path = append(path, name)
+		}
+		if key, e = hex.DecodeString(record.Key); e != nil {
+			return n, fmt.Errorf("record %d: key: %v", line, e)
+		}
+		if value, e = hex.DecodeString(record.Value); e != nil {
+			return n, fmt.Errorf("record %d: value: %v", line, e)
+		}
+		var b database.Bucket
+		if b, e = c.bucketAt(path); E.Chk(e) {
+			return n, fmt.Errorf("record %d: %v", line, e)
+		}
+		if record.Bucket {
+			_, e = b.CreateBucketIfNotExists(key)
+		} else {
+			e = b.Put(key, value)
+		}
+		if E.Chk(e) {
+			return n, fmt.Errorf("record %d: %v", line, e)
+		}
+		n++
+		if e = c.written(); E.Chk(e) {
+			return n, e
+		}
+	}
+	return n, c.commit()
+}
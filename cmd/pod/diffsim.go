@@ -0,0 +1,190 @@
+package pod
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/p9c/log"
+
+	"github.com/p9c/parallelcoin/pkg/blockchain"
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
+	"github.com/p9c/parallelcoin/pkg/database"
+	_ "github.com/p9c/parallelcoin/pkg/database/ffldb"
+	"github.com/p9c/parallelcoin/pkg/fork"
+	"github.com/p9c/parallelcoin/pkg/interrupt"
+)
+
+// errInterrupted is returned from the block callbacks to stop a replay or simulation when an interrupt is requested.
+var errInterrupted = errors.New("interrupted")
+
+// diffSim runs the difficulty adjustment over the blocks of an existing database or over a synthetic chain generated
+// from per-algorithm hashrates, writing a CSV line for every block and summary statistics at the end.
+func diffSim(args []string) int {
+	fs := flag.NewFlagSet("diffsim", flag.ContinueOnError)
+	network := fs.String("net", chaincfg.MainNetParams.Name, "network whose parameters are used, or a network file")
+	dbPath := fs.String("db", "", "path of an ffldb block database to replay; a synthetic chain is simulated when empty")
+	start := fs.Int("start", 1, "first height to replay")
+	end := fs.Int("end", 0, "last height to replay, or 0 for the tip of the chain")
+	forksPath := fs.String("forks", "", "JSON or TOML file with a hard fork schedule replacing that of the network")
+	forkNum := fs.Int("fork", -1, "hard fork whose difficulty adjustment is simulated, or -1 for the last one")
+	blocks := fs.Int("blocks", 2000, "number of blocks to simulate")
+	hashrates := fs.String("hashrate", "", "comma separated algo=hashes per second pairs for the simulation")
+	scale := fs.Float64(
+		"scale", 1, "hashrate of algos without -hashrate as a multiple of the one meeting the target at the initial difficulty",
+	)
+	seed := fs.Int64("seed", 1, "seed of the simulated block arrivals")
+	out := fs.String("out", "-", "file to write the per block CSV to, - for standard output")
+	logLevel := fs.String("loglevel", "warn", "log level while running the difficulty adjustment")
+	if e := fs.Parse(args); e != nil {
+		return 1
+	}
+	params, e := loadNetwork(*network)
+	if e != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "diffsim:", e)
+		return 1
+	}
+	if *forksPath != "" {
+		p := *params
+		if p.Forks, e = fork.ReadSchedule(*forksPath); e != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "diffsim:", e)
+			return 1
+		}
+		params = &p
+	}
+	if *forkNum < 0 {
+		*forkNum = len(params.Forks.Forks) - 1
+	}
+	w := os.Stdout
+	if *out != "-" {
+		if w, e = os.Create(*out); E.Chk(e) {
+			return 1
+		}
+		defer func() {
+			if e := w.Close(); E.Chk(e) {
+			}
+		}()
+	}
+	// The Plan 9 difficulty adjustment logs every calculation, which drowns out everything else.
+	log.SetLogLevel(*logLevel)
+	cw := csv.NewWriter(w)
+	if e = cw.Write([]string{"height", "algo", "timestamp", "interval", "bits", "chainbits", "adjustment"}); E.Chk(e) {
+		return 1
+	}
+	stats := blockchain.NewDiffSimStats(params.Forks, *forkNum)
+	record := func(blk blockchain.DiffSimBlock) error {
+		if interrupt.Requested() {
+			return errInterrupted
+		}
+		stats.Add(blk)
+		return cw.Write(
+			[]string{
+				strconv.Itoa(int(blk.Height)),
+				blk.Algo,
+				strconv.FormatInt(blk.Timestamp, 10),
+				strconv.FormatInt(blk.Interval, 10),
+				fmt.Sprintf("%08x", blk.Bits),
+				fmt.Sprintf("%08x", blk.ChainBits),
+				strconv.FormatFloat(blk.Adjustment, 'g', 6, 64),
+			},
+		)
+	}
+	if *dbPath != "" {
+		e = replayDifficulty(params, *dbPath, int32(*start), int32(*end), stats, record)
+	} else {
+		cfg := blockchain.DiffSimConfig{
+			Fork:   *forkNum,
+			Blocks: int32(*blocks),
+			Scale:  *scale,
+			Seed:   *seed,
+		}
+		if cfg.Hashrates, e = parseHashrates(*hashrates); e == nil {
+			e = blockchain.SimulateDifficulty(params, cfg, record)
+		}
+	}
+	cw.Flush()
+	if e == nil {
+		e = cw.Error()
+	}
+	writeDiffSimStats(os.Stderr, stats)
+	if e != nil && e != errInterrupted {
+		_, _ = fmt.Fprintln(os.Stderr, "diffsim:", e)
+		return 1
+	}
+	return 0
+}
+
+// replayDifficulty opens the block database at the given path and replays the difficulty adjustment over its main
+// chain. The statistics use the hard fork in effect at the start height.
+func replayDifficulty(
+	params *chaincfg.Params, dbPath string, start, end int32, stats *blockchain.DiffSimStats,
+	record func(blk blockchain.DiffSimBlock) error,
+) (e error) {
+	var db database.DB
+	if db, e = database.Open("ffldb", dbPath, params.Net); E.Chk(e) {
+		return e
+	}
+	defer func() {
+		if e := db.Close(); E.Chk(e) {
+		}
+	}()
+	var chain *blockchain.BlockChain
+	if chain, e = blockchain.New(
+		&blockchain.Config{
+			DB:          db,
+			ChainParams: params,
+			TimeSource:  blockchain.NewMedianTime(),
+		},
+	); E.Chk(e) {
+		return e
+	}
+	stats.Fork = params.Forks.GetCurrent(start)
+	return chain.ReplayDifficulty(start, end, record)
+}
+
+// parseHashrates parses a comma separated list of algo=hashrate pairs.
+func parseHashrates(s string) (rates map[string]float64, e error) {
+	rates = make(map[string]float64)
+	if s == "" {
+		return rates, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("hashrate %q is not of the form algo=rate", pair)
+		}
+		var rate float64
+		if rate, e = strconv.ParseFloat(kv[1], 64); e != nil {
+			return nil, fmt.Errorf("hashrate %q: %v", pair, e)
+		}
+		rates[strings.TrimSpace(kv[0])] = rate
+	}
+	return rates, nil
+}
+
+// writeDiffSimStats writes the summary of a replay or simulation as a table with a line for each algorithm.
+func writeDiffSimStats(w io.Writer, stats *blockchain.DiffSimStats) {
+	_, _ = fmt.Fprintf(w, "%d blocks, mean block time %.2fs\n", stats.Blocks, stats.MeanSpacing())
+	names := make([]string, 0, len(stats.Algos))
+	for name := range stats.Algos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	_, _ = fmt.Fprintf(
+		w, "%-10s %8s %12s %12s %12s %12s %10s\n",
+		"algo", "blocks", "mean time", "target time", "oscillation", "adj log2 sd", "mismatch",
+	)
+	for _, name := range names {
+		a := stats.Algos[name]
+		_, _ = fmt.Fprintf(
+			w, "%-10s %8d %12.2f %12.2f %12.4f %12.4f %10d\n",
+			name, a.Blocks, a.MeanSpacing(), a.TargetSpacing, a.Oscillation(), a.AdjustmentDeviation(), a.Mismatches,
+		)
+	}
+}
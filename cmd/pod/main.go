@@ -1,13 +1,34 @@
 package pod
 
 import (
+	"os"
+
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
 	"github.com/p9c/parallelcoin/version"
 )
 
+// commands is the list of subcommands that can be given as the first argument, each run with the arguments that follow
+// it and returning the exit code.
+var commands = map[string]func(args []string) int{
+	"diffsim": diffSim,
+	"newnet":  newNet,
+	"db":      dbCmd,
+}
+
+// networks is the chain parameters of the networks that can be selected by name on the command line.
+var networks = map[string]*chaincfg.Params{
+	chaincfg.MainNetParams.Name:        &chaincfg.MainNetParams,
+	chaincfg.TestNet3Params.Name:       &chaincfg.TestNet3Params,
+	chaincfg.RegressionTestParams.Name: &chaincfg.RegressionTestParams,
+	chaincfg.SimNetParams.Name:         &chaincfg.SimNetParams,
+}
+
 func Init() int {
 	I.Ln(version.Get())
-	
-	
-	
+	if len(os.Args) > 1 {
+		if run, ok := commands[os.Args[1]]; ok {
+			return run(os.Args[2:])
+		}
+	}
 	return 0
 }
@@ -0,0 +1,199 @@
+package pod
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/p9c/parallelcoin/pkg/bits"
+	"github.com/p9c/parallelcoin/pkg/blockchain"
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
+	"github.com/p9c/parallelcoin/pkg/fork"
+	"github.com/p9c/parallelcoin/pkg/interrupt"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// newNet creates the parameters of a new network, mining its genesis block, and writes them to a file that can be
+// loaded with chaincfg.ReadNetFile and registered at runtime.
+func newNet(args []string) int {
+	fs := flag.NewFlagSet("newnet", flag.ContinueOnError)
+	name := fs.String("name", "", "name of the network")
+	magic := fs.String("magic", "", "network magic bytes as a 32 bit hex number")
+	base := fs.String("base", chaincfg.TestNet3Params.Name, "standard network the remaining parameters are taken from")
+	port := fs.String("port", "", "default peer to peer port, the port of the base network when empty")
+	rpcPort := fs.String("rpcport", "", "RPC client port, the port of the base network when empty")
+	walletPort := fs.String("walletport", "", "wallet RPC server port, the port of the base network when empty")
+	seeds := fs.String("seeds", "", "comma separated DNS seeds")
+	pubKeyHash := fs.Int("pubkeyhash", -1, "first byte of pay to pubkey hash addresses, that of the base network if -1")
+	scriptHash := fs.Int("scripthash", -1, "first byte of pay to script hash addresses, that of the base network if -1")
+	privateKey := fs.Int("privatekey", -1, "first byte of WIF private keys, that of the base network if -1")
+	hdPrivate := fs.String("hdprivate", "", "hex of the 4 byte hd private key id, that of the base network when empty")
+	hdPublic := fs.String("hdpublic", "", "hex of the 4 byte hd public key id, that of the base network when empty")
+	forksPath := fs.String("forks", "", "JSON or TOML hard fork schedule, that of the base network when empty")
+	message := fs.String("message", "", "message in the coinbase of the genesis block")
+	algo := fs.String("algo", "", "algorithm the genesis block is mined with, the lowest version one when empty")
+	genesisBits := fs.String("bits", "", "hex compact target of the genesis block, the algorithm minimum when empty")
+	timestamp := fs.Int64("time", 0, "unix time of the genesis block, the current time when 0")
+	out := fs.String("out", "", "JSON or TOML file to write the parameters to, <name>.json when empty")
+	if e := fs.Parse(args); e != nil {
+		return 1
+	}
+	fail := func(e error) int {
+		_, _ = fmt.Fprintln(os.Stderr, "newnet:", e)
+		return 1
+	}
+	if *name == "" || *magic == "" {
+		return fail(errors.New("-name and -magic are required"))
+	}
+	baseParams, ok := networks[*base]
+	if !ok {
+		return fail(fmt.Errorf("unknown base network %s", *base))
+	}
+	params := *baseParams
+	params.Name = *name
+	net, e := strconv.ParseUint(strings.TrimPrefix(*magic, "0x"), 16, 32)
+	if e != nil {
+		return fail(fmt.Errorf("magic: %v", e))
+	}
+	params.Net = wire.BitcoinNet(net)
+	for _, p := range []struct {
+		flag  string
+		param *string
+	}{{*port, &params.DefaultPort}, {*rpcPort, &params.RPCClientPort}, {*walletPort, &params.WalletRPCServerPort}} {
+		if p.flag != "" {
+			*p.param = p.flag
+		}
+	}
+	params.DNSSeeds = nil
+	if *seeds != "" {
+		for _, host := range strings.Split(*seeds, ",") {
+			params.DNSSeeds = append(params.DNSSeeds, chaincfg.DNSSeed{Host: host, HasFiltering: true})
+		}
+	}
+	for _, p := range []struct {
+		flag  int
+		param *byte
+	}{{*pubKeyHash, &params.PubKeyHashAddrID}, {*scriptHash, &params.ScriptHashAddrID}, {*privateKey, &params.PrivateKeyID}} {
+		if p.flag > 0xff {
+			return fail(fmt.Errorf("address prefix %d is more than one byte", p.flag))
+		}
+		if p.flag >= 0 {
+			*p.param = byte(p.flag)
+		}
+	}
+	for _, p := range []struct {
+		flag  string
+		param *[4]byte
+	}{{*hdPrivate, &params.HDPrivateKeyID}, {*hdPublic, &params.HDPublicKeyID}} {
+		if p.flag == "" {
+			continue
+		}
+		b, e := hex.DecodeString(p.flag)
+		if e != nil || len(b) != 4 {
+			return fail(fmt.Errorf("hd key id %s is not 4 bytes of hex", p.flag))
+		}
+		copy(p.param[:], b)
+	}
+	if *forksPath != "" {
+		if params.Forks, e = fork.ReadSchedule(*forksPath); e != nil {
+			return fail(e)
+		}
+	}
+	params.Checkpoints = nil
+	params.Blacklist = nil
+	// The network must not collide with a registered one.
+	if e = chaincfg.Register(&params); e != nil {
+		return fail(fmt.Errorf("network magic %08x: %v", net, e))
+	}
+	genesisForks := params.Forks.Forks[params.Forks.GetCurrent(0)]
+	if *algo == "" {
+		*algo = genesisForks.AlgoSlice[len(genesisForks.AlgoSlice)-1].Name
+	}
+	algoParams, ok := genesisForks.Algos[*algo]
+	if !ok {
+		return fail(fmt.Errorf("algorithm %s does not exist in hard fork %s", *algo, genesisForks.Name))
+	}
+	target := algoParams.MinBits
+	if *genesisBits != "" {
+		var b uint64
+		if b, e = strconv.ParseUint(strings.TrimPrefix(*genesisBits, "0x"), 16, 32); e != nil {
+			return fail(fmt.Errorf("bits: %v", e))
+		}
+		target = uint32(b)
+	}
+	stamp := time.Now()
+	if *timestamp != 0 {
+		stamp = time.Unix(*timestamp, 0)
+	}
+	if params.GenesisBlock, e = chaincfg.NewGenesisBlock(*message, stamp, algoParams.Version, target); e != nil {
+		return fail(e)
+	}
+	if e = mineGenesis(&params.GenesisBlock.Header, params.Forks); e != nil {
+		return fail(e)
+	}
+	hash := params.GenesisBlock.Header.BlockHash()
+	params.GenesisHash = &hash
+	var f *chaincfg.NetFile
+	if f, e = chaincfg.NewNetFile(&params, *base); e != nil {
+		return fail(e)
+	}
+	if *out == "" {
+		*out = *name + ".json"
+	}
+	if e = f.Write(*out); e != nil {
+		return fail(e)
+	}
+	_, _ = fmt.Fprintf(
+		os.Stderr, "genesis block %v mined with %s, nonce %d, written to %s\n", hash, *algo,
+		params.GenesisBlock.Header.Nonce, *out,
+	)
+	return 0
+}
+
+// mineGenesis searches for a nonce with which the hash of the header with the algorithm of its version meets its
+// target, moving the timestamp on by a second each time the nonces run out.
+func mineGenesis(header *wire.BlockHeader, forks *fork.Schedule) error {
+	target := bits.CompactToBig(header.Bits)
+	if target.Sign() <= 0 {
+		return fmt.Errorf("genesis target %08x is not above zero", header.Bits)
+	}
+	for {
+		for nonce := uint32(0); ; nonce++ {
+			if nonce&0xfff == 0 && interrupt.Requested() {
+				return errInterrupted
+			}
+			header.Nonce = nonce
+			hash := header.BlockHashWithAlgos(0, forks)
+			if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+				return nil
+			}
+			if nonce == ^uint32(0) {
+				break
+			}
+		}
+		header.Timestamp = header.Timestamp.Add(time.Second)
+	}
+}
+
+// loadNetwork returns the parameters of the network with the given name, or of the network in the given JSON or TOML
+// file, which is registered so its addresses can be decoded.
+func loadNetwork(name string) (params *chaincfg.Params, e error) {
+	if params, ok := networks[name]; ok {
+		return params, nil
+	}
+	if _, e = os.Stat(name); e != nil {
+		return nil, fmt.Errorf("unknown network %s", name)
+	}
+	if params, e = chaincfg.ReadNetFile(name); e != nil {
+		return
+	}
+	if e = chaincfg.Register(params); e != nil {
+		return nil, fmt.Errorf("network %s: %v", params.Name, e)
+	}
+	return
+}
@@ -3,11 +3,13 @@ module github.com/p9c/parallelcoin
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/VividCortex/ewma v1.1.1
 	github.com/bitbandi/go-x11 v0.0.0-20171024232457-5fddbc9b2b09
 	github.com/btcsuite/go-socks v0.0.0-20170105172521-4720035b7bfd
 	github.com/btcsuite/golangcrypto v0.0.0-20150304025918-53f62d9b43e8
 	github.com/btcsuite/goleveldb v1.0.0
+	github.com/btcsuite/snappy-go v1.0.0
 	github.com/coreos/bbolt v1.3.3
 	github.com/davecgh/go-spew v1.1.1
 	github.com/enceve/crypto v0.0.0-20160707101852-34d48bb93815
@@ -5,7 +5,6 @@ import (
 	"github.com/p9c/parallelcoin/pkg/block"
 	
 	"github.com/p9c/parallelcoin/pkg/database"
-	"github.com/p9c/parallelcoin/pkg/hardfork"
 )
 
 // maybeAcceptBlock potentially accepts a block into the block chain
@@ -54,20 +53,12 @@ func (b *BlockChain) maybeAcceptBlock(workerNumber uint32, block *block.Block, f
 		var i int64
 		pn = prevNode
 		for ; i < b.params.AveragingInterval-1; i++ {
-			pn = pn.GetLastWithAlgo(a)
+			pn = pn.GetLastWithAlgo(a, b.params.Forks)
 			if pn == nil {
 				break
 			}
 		}
 	}
-	T.Ln("check for blacklisted addresses")
-	txs := block.Transactions()
-	for i := range txs {
-		if ContainsBlacklisted(b, txs[i], hardfork.Blacklist) {
-			return false, ruleError(ErrBlacklisted, "block contains a blacklisted address ")
-		}
-	}
-	T.Ln("found no blacklisted addresses")
 	var e error
 	if pn != nil {
 		// The block must pass all of the validation rules which depend on the position
@@ -95,6 +86,11 @@ func (b *BlockChain) maybeAcceptBlock(workerNumber uint32, block *block.Block, f
 	blockHeader := &block.WireBlock().Header
 	newNode := NewBlockNode(blockHeader, prevNode)
 	newNode.status = statusDataStored
+	// The proof of work hash was kept when the header was verified, unless the check was skipped, in which case it is
+	// computed once here to be stored in the block index.
+	if newNode.powHash = b.powHashes.take(&newNode.hash, newNode.height); newNode.powHash == nil {
+		newNode.PowHash(b.params.Forks)
+	}
 	b.Index.AddNode(newNode)
 	T.Ln("flushing db")
 	if e = b.Index.flushToDB(); E.Chk(e) {
@@ -112,8 +108,6 @@ func (b *BlockChain) maybeAcceptBlock(workerNumber uint32, block *block.Block, f
 	// Notify the caller that the new block was accepted into the block chain. The caller would typically want to react
 	// by relaying the inventory to other peers.
 	T.Ln("sending out block notifications for block accepted")
-	b.ChainLock.Unlock()
-	b.sendNotification(NTBlockAccepted, block)
-	b.ChainLock.Lock()
+	b.sendNotification(&Notification{Type: NTBlockAccepted, Block: block})
 	return isMainChain, nil
 }
@@ -0,0 +1,117 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// AlgoStats is the activity of one mining algorithm over a window of blocks of the main chain.
+type AlgoStats struct {
+	// Algo is the name of the algorithm.
+	Algo string
+	// Version is the block version that identifies the algorithm.
+	Version int32
+	// Blocks is the number of blocks in the window found with the algorithm.
+	Blocks int32
+	// AvgSpacing is the average number of seconds between consecutive blocks of the algorithm in the window, or zero
+	// when there are fewer than two of them.
+	AvgSpacing float64
+	// Bits is the target of the most recent block of the algorithm, or the minimum target when there is none.
+	Bits uint32
+	// Difficulty is the minimum target of the algorithm divided by Bits, so it is 1 at the minimum difficulty.
+	Difficulty float64
+	// HashesPerSec is the estimated hashrate of the algorithm, being the work of its blocks in the window divided by
+	// the time the window spans.
+	HashesPerSec float64
+}
+
+// AlgoStats returns the statistics of each algorithm of the hard fork in effect at the given height over the window of
+// blocks ending at that height, ordered by block version. A height of less than zero means the tip of the main chain.
+// The window is shortened when it would reach past the genesis block or, after a hard fork, to before its activation.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) AlgoStats(window, height int32) (stats []AlgoStats, e error) {
+	if window < 1 {
+		return nil, fmt.Errorf("the window of %d blocks must be at least one block", window)
+	}
+	b.ChainLock.RLock()
+	defer b.ChainLock.RUnlock()
+	end := b.BestChain.Tip()
+	if height >= 0 {
+		if end = b.BestChain.NodeByHeight(height); end == nil {
+			return nil, fmt.Errorf("there is no block at height %d on the main chain", height)
+		}
+	}
+	forks := b.params.Forks
+	hf := forks.Forks[forks.GetCurrent(end.height)]
+	activation := hf.ActivationHeight
+	startHeight := end.height - window
+	if startHeight < activation {
+		startHeight = activation
+	}
+	if startHeight < 0 {
+		startHeight = 0
+	}
+	// The window is the blocks after the start node, the start node only providing the time the window begins.
+	start := end.Ancestor(startHeight)
+	stats = make([]AlgoStats, 0, len(hf.Algos))
+	index := make(map[string]int, len(hf.Algos))
+	for name, p := range hf.Algos {
+		stats = append(stats, AlgoStats{Algo: name, Version: p.Version, Bits: p.MinBits})
+	}
+	sort.Slice(
+		stats, func(i, j int) bool {
+			return stats[i].Version < stats[j].Version
+		},
+	)
+	for i := range stats {
+		index[stats[i].Algo] = i
+	}
+	works := make([]*big.Int, len(stats))
+	lastStamps := make([]int64, len(stats))
+	for n := end; n != nil && n != start; n = n.parent {
+		i, ok := index[forks.GetAlgoName(n.version, n.height)]
+		if !ok {
+			continue
+		}
+		s := &stats[i]
+		if s.Blocks == 0 {
+			s.Bits = n.bits
+			lastStamps[i] = n.timestamp
+			works[i] = new(big.Int)
+		}
+		s.Blocks++
+		s.AvgSpacing = float64(lastStamps[i] - n.timestamp)
+		works[i].Add(works[i], CalcWork(n.bits, n.height, n.version))
+	}
+	// The most recent block of an algorithm that has none in the window still sets its current target.
+	missing := 0
+	for i := range stats {
+		if stats[i].Blocks == 0 {
+			missing++
+		}
+	}
+	for n := start; n != nil && n.height >= activation && missing > 0; n = n.parent {
+		if i, ok := index[forks.GetAlgoName(n.version, n.height)]; ok && stats[i].Blocks == 0 && works[i] == nil {
+			stats[i].Bits = n.bits
+			works[i] = new(big.Int)
+			missing--
+		}
+	}
+	timespan := float64(end.timestamp - start.timestamp)
+	for i := range stats {
+		s := &stats[i]
+		if s.Blocks > 1 {
+			s.AvgSpacing /= float64(s.Blocks - 1)
+		} else {
+			s.AvgSpacing = 0
+		}
+		s.Difficulty = targetRatio(hf.Algos[s.Algo].MinBits, s.Bits)
+		if s.Blocks > 0 && timespan > 0 {
+			work, _ := new(big.Float).SetInt(works[i]).Float64()
+			s.HashesPerSec = work / timespan
+		}
+	}
+	return stats, nil
+}
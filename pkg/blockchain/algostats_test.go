@@ -0,0 +1,73 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
+	"github.com/p9c/parallelcoin/pkg/fork"
+)
+
+// TestAlgoStats ensures the per algorithm statistics are calculated over the requested window of the main chain.
+func TestAlgoStats(t *testing.T) {
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	sha256d := chaincfg.MainNetParams.Forks.Forks[0].Algos[fork.SHA256d]
+	scrypt := chaincfg.MainNetParams.Forks.Forks[0].Algos[fork.Scrypt]
+	// Ten blocks a minute apart, alternating sha256d at twice the minimum difficulty and scrypt at the minimum, with an
+	// irregular version that counts as sha256d at the end.
+	const sha256dBits = 0x1e07ffff
+	node := chain.BestChain.Genesis()
+	ts := time.Unix(node.timestamp, 0)
+	for i := 0; i < 10; i++ {
+		ts = ts.Add(time.Minute)
+		version, bits := sha256d.Version, uint32(sha256dBits)
+		switch {
+		case i == 9:
+			version = 1
+		case i%2 == 1:
+			version, bits = scrypt.Version, scrypt.MinBits
+		}
+		node = newFakeNode(node, version, bits, ts)
+		chain.Index.AddNode(node)
+	}
+	chain.BestChain.SetTip(node)
+	if _, e := chain.AlgoStats(0, -1); e == nil {
+		t.Fatal("AlgoStats: accepted an empty window")
+	}
+	if _, e := chain.AlgoStats(5, 11); e == nil {
+		t.Fatal("AlgoStats: accepted a height above the tip")
+	}
+	stats, e := chain.AlgoStats(6, -1)
+	if e != nil {
+		t.Fatalf("AlgoStats: %v", e)
+	}
+	if len(stats) != 2 || stats[0].Algo != fork.SHA256d || stats[1].Algo != fork.Scrypt {
+		t.Fatalf("AlgoStats: got %+v, want sha256d then scrypt", stats)
+	}
+	// The window covers heights 5 to 10, of which 5, 7, 9 and 10 are sha256d and 6 and 8 are scrypt.
+	sha, scr := stats[0], stats[1]
+	if sha.Blocks != 4 || sha.AvgSpacing != 100 || sha.Bits != sha256dBits {
+		t.Fatalf("AlgoStats: sha256d got %d blocks %v spacing bits %08x", sha.Blocks, sha.AvgSpacing, sha.Bits)
+	}
+	if scr.Blocks != 2 || scr.AvgSpacing != 120 || scr.Bits != scrypt.MinBits || scr.Difficulty != 1 {
+		t.Fatalf(
+			"AlgoStats: scrypt got %d blocks %v spacing bits %08x difficulty %v", scr.Blocks, scr.AvgSpacing,
+			scr.Bits, scr.Difficulty,
+		)
+	}
+	if sha.Difficulty < 1.99 || sha.Difficulty > 2.01 {
+		t.Fatalf("AlgoStats: sha256d difficulty %v, want 2", sha.Difficulty)
+	}
+	work, _ := new(big.Float).SetInt(new(big.Int).Mul(CalcWork(sha256dBits, 0, 0), big.NewInt(4))).Float64()
+	if want := work / 360; sha.HashesPerSec != want {
+		t.Fatalf("AlgoStats: sha256d hashrate %v, want %v", sha.HashesPerSec, want)
+	}
+	// A window without any scrypt blocks still reports the target of the last one.
+	if stats, e = chain.AlgoStats(1, 9); e != nil {
+		t.Fatalf("AlgoStats: %v", e)
+	}
+	if stats[1].Blocks != 0 || stats[1].Bits != scrypt.MinBits || stats[1].HashesPerSec != 0 {
+		t.Fatalf("AlgoStats: scrypt got %+v outside the window", stats[1])
+	}
+}
@@ -1,59 +1,70 @@
 package blockchain
 
 import (
-	"github.com/p9c/parallelcoin/pkg/fork"
-	"github.com/p9c/parallelcoin/pkg/btcaddr"
+	"fmt"
+
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
 	"github.com/p9c/parallelcoin/pkg/txscript"
 	"github.com/p9c/parallelcoin/pkg/util"
 )
 
-// ContainsBlacklisted returns true if one of the given addresses is found in the transaction
-func ContainsBlacklisted(b *BlockChain, tx *util.Tx, blacklist []btcaddr.Address) (hasBlacklisted bool) {
-	// in tests this function is not relevant
-	if b == nil {
-		return false
+// CheckTransactionBlacklist returns a rule error when the transaction pays to, or spends an output that pays to, an
+// address on the blacklist of the network. The blacklist is enforced from the Plan 9 hard fork on, so txHeight is the
+// height of the block the transaction is in, or the height of the next block for a transaction that is not yet in a
+// block, as in mempool acceptance.
+//
+// The outputs spent by the transaction must be in the provided view, which is the case after the inputs of a block are
+// fetched for connecting it, and for the view used to accept a transaction into the mempool.
+func CheckTransactionBlacklist(
+	tx *util.Tx, txHeight int32, utxoView *UtxoViewpoint, chainParams *chaincfg.Params,
+) (e error) {
+	if len(chainParams.Blacklist) == 0 || chainParams.Forks.GetCurrent(txHeight) < 1 {
+		return nil
 	}
-	// blacklist only applies from hard fork
-	if fork.GetCurrent(b.BestSnapshot().Height) < 1 {
-		return false
+	for txOutIndex, txOut := range tx.MsgTx().TxOut {
+		if addr := blacklistedAddress(txOut.PkScript, chainParams); addr != "" {
+			str := fmt.Sprintf("output %d of transaction %v pays to blacklisted address %s", txOutIndex, tx.Hash(), addr)
+			return ruleError(ErrBlacklisted, str)
+		}
 	}
-	var addrs []btcaddr.Address
-	// first decode transaction and collect all addresses in the transaction outputs
-	txo := tx.MsgTx().TxOut
-	for i := range txo {
-		script := txo[i].PkScript
-		_, a, _, _ := txscript.ExtractPkScriptAddrs(script, b.params)
-		addrs = append(addrs, a...)
+	if IsCoinBase(tx) {
+		return nil
 	}
-	// next get the addresses from the input transactions outpoints
-	txi := tx.MsgTx().TxIn
-	for i := range txi {
-		bb, e := b.BlockByHash(&txi[i].PreviousOutPoint.Hash)
-		if e ==  nil {
-			txs := bb.WireBlock().Transactions
-			for j := range txs {
-				txitxo := txs[j].TxOut
-				for k := range txitxo {
-					script := txitxo[k].PkScript
-					_, a, _, _ := txscript.ExtractPkScriptAddrs(script, b.params)
-					addrs = append(addrs, a...)
-				}
-			}
+	for txInIndex, txIn := range tx.MsgTx().TxIn {
+		utxo := utxoView.LookupEntry(txIn.PreviousOutPoint)
+		if utxo == nil || utxo.IsSpent() {
+			str := fmt.Sprintf(
+				"output %v referenced from transaction %s:%d either does not exist or has already been spent",
+				txIn.PreviousOutPoint, tx.Hash(), txInIndex,
+			)
+			return ruleError(ErrMissingTxOut, str)
+		}
+		if addr := blacklistedAddress(utxo.PkScript(), chainParams); addr != "" {
+			str := fmt.Sprintf(
+				"input %d of transaction %v spends output %v of blacklisted address %s", txInIndex, tx.Hash(),
+				txIn.PreviousOutPoint, addr,
+			)
+			return ruleError(ErrBlacklisted, str)
 		}
 	}
-	// check if the set of addresses intersects with the blacklist
-	return Intersects(addrs, blacklist)
+	return nil
 }
 
-// Intersects returns whether one slice of byte slices contains a match in another
-func Intersects(a, b []btcaddr.Address) bool {
-	for x := range a {
-		for y := range b {
-			if a[x].EncodeAddress() == b[y].EncodeAddress() {
-				// If we find one match the two arrays intersect
-				return true
+// blacklistedAddress returns the encoded address on the blacklist of the network that the public key script pays to,
+// or an empty string when there is none. Pay to public key scripts match the pay to public key hash address of the key.
+func blacklistedAddress(pkScript []byte, chainParams *chaincfg.Params) string {
+	_, addrs, _, e := txscript.ExtractPkScriptAddrs(pkScript, chainParams)
+	if e != nil {
+		// Scripts that can not be parsed do not pay to any address.
+		return ""
+	}
+	for i := range addrs {
+		encoded := addrs[i].EncodeAddress()
+		for j := range chainParams.Blacklist {
+			if encoded == chainParams.Blacklist[j] {
+				return encoded
 			}
 		}
 	}
-	return false
+	return ""
 }
@@ -0,0 +1,151 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/p9c/parallelcoin/pkg/block"
+	"github.com/p9c/parallelcoin/pkg/btcaddr"
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/txscript"
+	"github.com/p9c/parallelcoin/pkg/util"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// blacklistTestScripts returns a pay to public key hash script for a listed address and for an address that is not
+// listed, along with a copy of the main network parameters with the first one on the blacklist.
+func blacklistTestScripts(t *testing.T) (listed, clean []byte, params *chaincfg.Params) {
+	p := chaincfg.MainNetParams
+	params = &p
+	listedAddr, e := btcaddr.NewPubKeyHash(bytes.Repeat([]byte{0x01}, 20), params)
+	if e != nil {
+		t.Fatal(e)
+	}
+	cleanAddr, e := btcaddr.NewPubKeyHash(bytes.Repeat([]byte{0x02}, 20), params)
+	if e != nil {
+		t.Fatal(e)
+	}
+	params.Blacklist = []string{listedAddr.EncodeAddress()}
+	if listed, e = txscript.PayToAddrScript(listedAddr); e != nil {
+		t.Fatal(e)
+	}
+	if clean, e = txscript.PayToAddrScript(cleanAddr); e != nil {
+		t.Fatal(e)
+	}
+	return listed, clean, params
+}
+
+// blacklistTestTx returns a transaction spending the given outpoint to an output with the given script.
+func blacklistTestTx(prevOut wire.OutPoint, pkScript []byte) *util.Tx {
+	msgTx := wire.NewMsgTx(1)
+	msgTx.AddTxIn(&wire.TxIn{PreviousOutPoint: prevOut, Sequence: wire.MaxTxInSequenceNum})
+	msgTx.AddTxOut(wire.NewTxOut(1000, pkScript))
+	return util.NewTx(msgTx)
+}
+
+// TestCheckTransactionBlacklist ensures transactions paying to and spending from blacklisted addresses are rejected
+// once the Plan 9 hard fork is active, with the spent outputs resolved through the utxo view.
+func TestCheckTransactionBlacklist(t *testing.T) {
+	listed, clean, params := blacklistTestScripts(t)
+	height := params.Forks.Forks[1].ActivationHeight + 1
+	listedOut := wire.OutPoint{Hash: chainhash.Hash{0x01}, Index: 0}
+	cleanOut := wire.OutPoint{Hash: chainhash.Hash{0x02}, Index: 1}
+	view := NewUtxoViewpoint()
+	view.addTxOut(listedOut, wire.NewTxOut(2000, listed), false, height-10)
+	view.addTxOut(cleanOut, wire.NewTxOut(2000, clean), false, height-10)
+	tests := []struct {
+		name   string
+		tx     *util.Tx
+		height int32
+		code   ErrorCode
+		fails  bool
+	}{
+		{"clean", blacklistTestTx(cleanOut, clean), height, 0, false},
+		{"spend from listed", blacklistTestTx(listedOut, clean), height, ErrBlacklisted, true},
+		{"pay to listed", blacklistTestTx(cleanOut, listed), height, ErrBlacklisted, true},
+		{
+			"missing input", blacklistTestTx(wire.OutPoint{Hash: chainhash.Hash{0x03}}, clean), height,
+			ErrMissingTxOut, true,
+		},
+		{"before hard fork", blacklistTestTx(listedOut, listed), params.Forks.Forks[1].ActivationHeight - 1, 0, false},
+	}
+	for _, test := range tests {
+		e := CheckTransactionBlacklist(test.tx, test.height, view, params)
+		if !test.fails {
+			if e != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, e)
+			}
+			continue
+		}
+		if re, ok := e.(RuleError); !ok || re.ErrorCode != test.code {
+			t.Errorf("%s: got error %v, want %v", test.name, e, test.code)
+		}
+	}
+	// Networks without a blacklist accept everything.
+	if e := CheckTransactionBlacklist(
+		blacklistTestTx(listedOut, listed), height, view, &chaincfg.MainNetParams,
+	); e != nil {
+		t.Errorf("empty blacklist: unexpected error: %v", e)
+	}
+}
+
+// TestCheckConnectBlockBlacklist ensures blocks are not connected when their coinbase pays to a blacklisted address or
+// one of their transactions pays to or spends from a blacklisted address.
+func TestCheckConnectBlockBlacklist(t *testing.T) {
+	listed, clean, params := blacklistTestScripts(t)
+	chain := newFakeChain(params)
+	parent := chain.BestChain.Genesis()
+	parent.height = params.Forks.Forks[1].ActivationHeight
+	coinbase := func(pkScript []byte) *wire.MsgTx {
+		msgTx := wire.NewMsgTx(1)
+		msgTx.AddTxIn(
+			&wire.TxIn{
+				PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex),
+				SignatureScript:  []byte{0x51, 0x51},
+				Sequence:         wire.MaxTxInSequenceNum,
+			},
+		)
+		msgTx.AddTxOut(wire.NewTxOut(1000, pkScript))
+		return msgTx
+	}
+	connect := func(view *UtxoViewpoint, txs ...*wire.MsgTx) error {
+		msgBlock := &wire.Block{
+			Header: wire.BlockHeader{
+				Version:   5,
+				PrevBlock: parent.hash,
+				Timestamp: time.Unix(parent.timestamp+60, 0),
+			},
+			Transactions: txs,
+		}
+		node := NewBlockNode(&msgBlock.Header, parent)
+		view.SetBestHash(&parent.hash)
+		blk := block.NewBlock(msgBlock)
+		blk.SetHeight(node.height)
+		var stxos []SpentTxOut
+		return chain.checkConnectBlock(node, blk, view, &stxos)
+	}
+	isBlacklisted := func(e error) bool {
+		re, ok := e.(RuleError)
+		return ok && re.ErrorCode == ErrBlacklisted
+	}
+	if e := connect(NewUtxoViewpoint(), coinbase(clean)); isBlacklisted(e) {
+		t.Fatalf("clean coinbase: unexpected error %v", e)
+	}
+	if e := connect(NewUtxoViewpoint(), coinbase(listed)); !isBlacklisted(e) {
+		t.Fatalf("coinbase paying to a listed address: got %v, want ErrBlacklisted", e)
+	}
+	cb := coinbase(clean)
+	payTx := blacklistTestTx(wire.OutPoint{Hash: cb.TxHash()}, listed).MsgTx()
+	if e := connect(NewUtxoViewpoint(), cb, payTx); !isBlacklisted(e) {
+		t.Fatalf("transaction paying to a listed address: got %v, want ErrBlacklisted", e)
+	}
+	listedOut := wire.OutPoint{Hash: chainhash.Hash{0x01}}
+	view := NewUtxoViewpoint()
+	view.addTxOut(listedOut, wire.NewTxOut(2000, listed), false, parent.height-200)
+	spendTx := blacklistTestTx(listedOut, clean).MsgTx()
+	if e := connect(view, coinbase(clean), spendTx); !isBlacklisted(e) {
+		t.Fatalf("transaction spending from a listed address: got %v, want ErrBlacklisted", e)
+	}
+}
@@ -27,6 +27,11 @@ const (
 	// statusInvalidAncestor indicates that one of the block's ancestors has has failed validation, thus the block is
 	// also invalid.
 	statusInvalidAncestor
+	// statusDataPruned indicates that the block's payload was stored on disk but has since been removed by pruning.
+	statusDataPruned
+	// statusReorgRefused indicates that the block is on a side chain the main chain was not reorganized to because it
+	// would have detached more blocks than the maximum reorganization depth.
+	statusReorgRefused
 	// statusNone indicates that the block has no validation state flags set.
 	//
 	// NOTE: This must be defined last in order to avoid influencing iota.
@@ -39,6 +44,16 @@ func (status blockStatus) HaveData() bool {
 	return status&statusDataStored != 0
 }
 
+// Pruned returns whether the block data was stored in the database and has since been removed by pruning.
+func (status blockStatus) Pruned() bool {
+	return status&statusDataPruned != 0
+}
+
+// ReorgRefused returns whether the block is on a side chain that was refused for being too deep a reorganization.
+func (status blockStatus) ReorgRefused() bool {
+	return status&statusReorgRefused != 0
+}
+
 // KnownValid returns whether the block is known to be valid. This will return false for a valid block that has not been
 // fully validated yet.
 func (status blockStatus) KnownValid() bool {
@@ -78,6 +93,13 @@ type BlockNode struct {
 	status blockStatus
 	// Diffs is the computed difficulty targets for a block to be connected to this one
 	Diffs atomic.Value
+	// powHash is the proof of work hash of the block. It is set when the node is created, from the hash verified before
+	// the block was processed or from the block index, and is only replaced, with the block index lock held, when the
+	// block index is upgraded or the hashes are verified again by ReverifyPowHashes.
+	powHash *chainhash.Hash
+	// precious is the sequence number of the most recent PreciousBlock call for the block, or zero if there was none.
+	// Like the status, it should only be accessed using the concurrent-safe methods on blockIndex.
+	precious int32
 }
 
 // initBlockNode initializes a block node from the given header and parent node, calculating the height and workSum from
@@ -109,6 +131,18 @@ func NewBlockNode(blockHeader *wire.BlockHeader, parent *BlockNode) *BlockNode {
 	return &node
 }
 
+// PowHash returns the proof of work hash of the block. A node created without one has the hash computed with the
+// algorithm of its version on the first call, which is kept so the slow hash is not computed again. This function is
+// NOT safe for concurrent access, and the block index lock must be held for nodes that are in the index.
+func (node *BlockNode) PowHash(forks *fork.Schedule) chainhash.Hash {
+	if node.powHash == nil {
+		header := node.Header()
+		powHash := header.BlockHashWithAlgos(node.height, forks)
+		node.powHash = &powHash
+	}
+	return *node.powHash
+}
+
 // Header constructs a block header from the node and returns it. This function is safe for concurrent access.
 func (node *BlockNode) Header() wire.BlockHeader {
 	// No lock is needed because all accessed fields are immutable.
@@ -186,6 +220,8 @@ type blockIndex struct {
 	sync.RWMutex
 	index map[chainhash.Hash]*BlockNode
 	dirty map[*BlockNode]struct{}
+	// tips holds the nodes that no other node in the index builds on. It is kept up to date as nodes are added.
+	tips map[*BlockNode]struct{}
 }
 
 // newBlockIndex returns a new empty instance of a block index. The index will be dynamically populated as block nodes
@@ -196,6 +232,7 @@ func newBlockIndex(db database.DB, chainParams *chaincfg.Params) *blockIndex {
 		chainParams: chainParams,
 		index:       make(map[chainhash.Hash]*BlockNode),
 		dirty:       make(map[*BlockNode]struct{}),
+		tips:        make(map[*BlockNode]struct{}),
 	}
 }
 
@@ -230,6 +267,23 @@ func (bi *blockIndex) AddNode(node *BlockNode) {
 // the block index. This function is NOT safe for concurrent access.
 func (bi *blockIndex) addNode(node *BlockNode) {
 	bi.index[node.hash] = node
+	// The parent is no longer a tip now that this node builds on it.
+	if node.parent != nil {
+		delete(bi.tips, node.parent)
+	}
+	bi.tips[node] = struct{}{}
+}
+
+// Tips returns the nodes in the block index which no other node builds on. This function is safe for concurrent
+// access.
+func (bi *blockIndex) Tips() []*BlockNode {
+	bi.RLock()
+	tips := make([]*BlockNode, 0, len(bi.tips))
+	for node := range bi.tips {
+		tips = append(tips, node)
+	}
+	bi.RUnlock()
+	return tips
 }
 
 // NodeStatus provides concurrent-safe access to the status field of a node. This function is safe for concurrent
@@ -259,6 +313,23 @@ func (bi *blockIndex) UnsetStatusFlags(node *BlockNode, flags blockStatus) {
 	bi.Unlock()
 }
 
+// NodePrecious provides concurrent-safe access to the precious field of a node.
+func (bi *blockIndex) NodePrecious(node *BlockNode) int32 {
+	bi.RLock()
+	precious := node.precious
+	bi.RUnlock()
+	return precious
+}
+
+// SetPrecious sets the PreciousBlock sequence number of the block node and marks it to be written to the database. This
+// function is safe for concurrent access.
+func (bi *blockIndex) SetPrecious(node *BlockNode, precious int32) {
+	bi.Lock()
+	node.precious = precious
+	bi.dirty[node] = struct{}{}
+	bi.Unlock()
+}
+
 // flushToDB writes all dirty block nodes to the database. If all writes succeed, this clears the dirty set.
 func (bi *blockIndex) flushToDB() (e error) {
 	bi.Lock()
@@ -269,7 +340,7 @@ func (bi *blockIndex) flushToDB() (e error) {
 	e = bi.db.Update(
 		func(dbTx database.Tx) (e error) {
 			for node := range bi.dirty {
-				e := dbStoreBlockNode(dbTx, node)
+				e := dbStoreBlockNode(dbTx, node, bi.chainParams.Forks)
 				if e != nil {
 					E.Ln(e)
 					return e
@@ -291,12 +362,12 @@ func (node *BlockNode) GetAlgo() int32 {
 	return node.version
 }
 
-// GetLastWithAlgo returns the newest block from node with specified algo
-func (node *BlockNode) GetLastWithAlgo(algo int32) (prev *BlockNode) {
+// GetLastWithAlgo returns the newest block from node with specified algo under the given hard fork schedule
+func (node *BlockNode) GetLastWithAlgo(algo int32, forks *fork.Schedule) (prev *BlockNode) {
 	if node == nil {
 		return
 	}
-	if fork.GetCurrent(node.height+1) == 0 {
+	if forks.GetCurrent(node.height+1) == 0 {
 		// F.Ln("checking pre-hardfork algo versions")
 		if algo != 514 &&
 			algo != 2 {
@@ -311,7 +382,7 @@ func (node *BlockNode) GetLastWithAlgo(algo int32) (prev *BlockNode) {
 		}
 		// Tracef("node %d %d %8x", prev.height, prev.version, prev.bits)
 		prevversion := prev.version
-		if fork.GetCurrent(prev.height) == 0 {
+		if forks.GetCurrent(prev.height) == 0 {
 			// F.Ln("checking pre-hardfork algo versions")
 			if prev.version != 514 &&
 				prev.version != 2 {
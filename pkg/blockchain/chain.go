@@ -4,7 +4,6 @@ import (
 	"container/list"
 	"fmt"
 	block2 "github.com/p9c/parallelcoin/pkg/block"
-	"github.com/p9c/parallelcoin/pkg/fork"
 	"sync"
 	"time"
 	
@@ -50,29 +49,51 @@ type BestState struct {
 	Hash        chainhash.Hash // The hash of the block.
 	Height      int32          // The height of the block.
 	Version     int32
-	Bits        uint32    // The difficulty bits of the block.
-	BlockSize   uint64    // The size of the block.
-	BlockWeight uint64    // The weight of the block.
-	NumTxns     uint64    // The number of txns in the block.
-	TotalTxns   uint64    // The total number of txns in the chain.
-	MedianTime  time.Time // Median time as per CalcPastMedianTime.
+	Bits        uint32 // The difficulty bits of the block.
+	BlockSize   uint64 // The size of the block.
+	BlockWeight uint64 // The weight of the block.
+	NumTxns     uint64 // The number of txns in the block.
+	TotalTxns   uint64 // The total number of txns in the chain.
+	Supply      int64  // The total value of the unspent outputs of the chain.
+	Mined       int64  // The total value of the block subsidies claimed by the coinbases of the chain.
+	// The amounts paid to the hard fork payees and the developer multisig by the Plan 9 hard fork activation block.
+	HardForkPayees int64
+	DevFund        int64
+	Burned         int64     // The total value sent to unspendable outputs or left unclaimed as fees.
+	MedianTime     time.Time // Median time as per CalcPastMedianTime.
 }
 
 // newBestState returns a new best stats instance for the given parameters.
 func newBestState(
 	node *BlockNode, blockSize, blockWeight, numTxns,
-	totalTxns uint64, medianTime time.Time,
+	totalTxns uint64, supply supplyState, medianTime time.Time,
 ) *BestState {
 	return &BestState{
-		Hash:        node.hash,
-		Height:      node.height,
-		Version:     node.version,
-		Bits:        node.bits,
-		BlockSize:   blockSize,
-		BlockWeight: blockWeight,
-		NumTxns:     numTxns,
-		TotalTxns:   totalTxns,
-		MedianTime:  medianTime,
+		Hash:           node.hash,
+		Height:         node.height,
+		Version:        node.version,
+		Bits:           node.bits,
+		BlockSize:      blockSize,
+		BlockWeight:    blockWeight,
+		NumTxns:        numTxns,
+		TotalTxns:      totalTxns,
+		Supply:         supply.utxo,
+		Mined:          supply.mined,
+		HardForkPayees: supply.payees,
+		DevFund:        supply.devFund,
+		Burned:         supply.burned,
+		MedianTime:     medianTime,
+	}
+}
+
+// supply returns the supply of coins kept in the best state.
+func (s *BestState) supply() supplyState {
+	return supplyState{
+		utxo:    s.Supply,
+		mined:   s.Mined,
+		payees:  s.HardForkPayees,
+		devFund: s.DevFund,
+		burned:  s.Burned,
 	}
 }
 
@@ -116,6 +137,16 @@ type BlockChain struct {
 	// These fields are related to checkpoint handling. They are protected by the chain lock.
 	nextCheckpoint *chaincfg.Checkpoint
 	checkpointNode *BlockNode
+	// preciousSeq is the sequence number of the most recent PreciousBlock call, which is stored with the block it was
+	// called for. It is protected by the chain lock.
+	preciousSeq int32
+	// maxReorgDepth is the largest number of blocks a reorganization may detach when processing blocks, or zero for no
+	// limit.
+	maxReorgDepth int32
+	// powHashes holds the proof of work hashes of headers verified by VerifyHeaders until their blocks are processed.
+	powHashes *powHashCache
+	// rejects holds the reports of the most recently rejected blocks. It has its own lock.
+	rejects *rejectLog
 	// The state is used as a fairly efficient way to cache information about the
 	// current best chain state that is returned to callers when requested. It
 	// operates on the principle of MVCC such that any time a new block becomes the
@@ -141,14 +172,31 @@ type BlockChain struct {
 	// // versions being mined.
 	// unknownRulesWarned bool
 	// unknownVersionsWarned bool
-	// The notifications field stores a slice of callbacks to be executed on certain
+	// The notifications field stores the subscribers to notifications of certain
 	// blockchain events.
-	notifications     []NotificationCallback
+	notifications     []*Subscription
 	notificationsLock sync.RWMutex
+	// pendingNotifications are the notifications sent while the chain lock is held, which unlockChain passes on to be
+	// delivered once it is released. It is protected by the chain lock.
+	pendingNotifications []*Notification
+	// undelivered are the notifications waiting to be delivered to the subscribers in order, and delivering is whether
+	// a goroutine is delivering them. They are protected by the notifications lock.
+	undelivered []*Notification
+	delivering  bool
 	// DifficultyAdjustments keeps track of the latest difficulty adjustment for each algorithm
 	DifficultyAdjustments map[string]float64
 	DifficultyBits        atomic.Value
 	DifficultyHeight      atomic.Int32
+	// pruneTarget is the target size in bytes for the stored block data, or zero when pruning is disabled. pruned is
+	// set once block data has been removed from the database, which can also be the case when pruning has since been
+	// disabled.
+	pruneTarget uint64
+	pruned      atomic.Bool
+	// pruneHeight is the height of the newest block stored along with the oldest block data that pruning could not
+	// remove, or zero when nothing held pruning back. That data can not be removed before the cutoff has passed it.
+	// Blocks are only ever stored after the newest block data, including those moved by recompressing the block files,
+	// so the blocks held back can only become fewer until that data is removed. It is protected by the chain lock.
+	pruneHeight int32
 }
 
 // HaveBlock returns whether or not the chain instance has the block represented
@@ -504,13 +552,15 @@ func (b *BlockChain) connectBlock(
 	// updates are successful.
 	b.stateLock.RLock()
 	curTotalTxns := b.stateSnapshot.TotalTxns
+	curSupply := b.stateSnapshot.supply()
 	b.stateLock.RUnlock()
 	numTxns := uint64(len(block.WireBlock().Transactions))
 	blockSize := uint64(block.WireBlock().SerializeSize())
 	blockWeight := uint64(GetBlockWeight(block))
 	state := newBestState(
 		node, blockSize, blockWeight, numTxns,
-		curTotalTxns+numTxns, node.CalcPastMedianTime(),
+		curTotalTxns+numTxns, curSupply.add(supplyChange(block, node.height, stxos, b.params)),
+		node.CalcPastMedianTime(),
 	)
 	// Atomically insert info into the database.
 	T.Ln("inserting block into database")
@@ -542,6 +592,12 @@ func (b *BlockChain) connectBlock(
 				T.Ln("dbPutSpendJournalEntry", e)
 				return e
 			}
+			// In prune mode drop the data that is now buried too deep to be needed for a reorganization.
+			if b.pruneTarget != 0 {
+				if e = b.pruneBlocks(dbTx, node); E.Chk(e) {
+					return e
+				}
+			}
 			// Allow the index manager to call each of the currently active optional indexes with the block being connected
 			// so they can update themselves accordingly
 			if b.indexManager != nil {
@@ -584,9 +640,13 @@ func (b *BlockChain) connectBlock(
 	// Notify the caller that the block was connected to the main chain. The caller would typically want to react with
 	// actions such as updating wallets.
 	T.Ln("sending notifications for new block")
-	b.ChainLock.Unlock()
-	b.sendNotification(NTBlockConnected, block)
-	b.ChainLock.Lock()
+	b.sendNotification(&Notification{Type: NTBlockConnected, Block: block})
+	b.sendNotification(
+		&Notification{Type: NTTipChanged, TipChange: &TipChange{Hash: node.hash, Height: node.height, Connected: true}},
+	)
+	if cp, ok := b.checkpointsByHeight[node.height]; ok && cp.Hash.IsEqual(&node.hash) {
+		b.sendNotification(&Notification{Type: NTCheckpointReached, Checkpoint: cp})
+	}
 	return nil
 }
 
@@ -606,9 +666,14 @@ func (b *BlockChain) disconnectBlock(
 	// Load the previous block since some details for it are needed below.
 	prevNode := node.parent
 	var prevBlock *block2.Block
+	// The spend journal entry of the block is needed to update the supply, and for the indexers below.
+	var stxos []SpentTxOut
 	e = b.db.View(
 		func(dbTx database.Tx) (e error) {
-			prevBlock, e = dbFetchBlockByNode(dbTx, prevNode)
+			if prevBlock, e = dbFetchBlockByNode(dbTx, prevNode); e != nil {
+				return e
+			}
+			stxos, e = dbFetchSpendJournalEntry(dbTx, block)
 			return e
 		},
 	)
@@ -624,6 +689,7 @@ func (b *BlockChain) disconnectBlock(
 	// updates are successful.
 	b.stateLock.RLock()
 	curTotalTxns := b.stateSnapshot.TotalTxns
+	curSupply := b.stateSnapshot.supply()
 	b.stateLock.RUnlock()
 	numTxns := uint64(len(prevBlock.WireBlock().Transactions))
 	blockSize := uint64(prevBlock.WireBlock().SerializeSize())
@@ -631,7 +697,8 @@ func (b *BlockChain) disconnectBlock(
 	newTotalTxns := curTotalTxns - uint64(len(block.WireBlock().Transactions))
 	state := newBestState(
 		prevNode, blockSize, blockWeight, numTxns,
-		newTotalTxns, prevNode.CalcPastMedianTime(),
+		newTotalTxns, curSupply.sub(supplyChange(block, node.height, stxos, b.params)),
+		prevNode.CalcPastMedianTime(),
 	)
 	e = b.db.Update(
 		func(dbTx database.Tx) (e error) {
@@ -651,12 +718,6 @@ func (b *BlockChain) disconnectBlock(
 			if e != nil {
 				return e
 			}
-			// Before we delete the spend journal entry for this back, we'll fetch it as is so the indexers can utilize if
-			// needed.
-			stxos, e := dbFetchSpendJournalEntry(dbTx, block)
-			if e != nil {
-				return e
-			}
 			// Update the transaction spend journal by removing the record that contains all txos spent by the block.
 			e = dbRemoveSpendJournalEntry(dbTx, block.Hash())
 			if e != nil {
@@ -689,9 +750,10 @@ func (b *BlockChain) disconnectBlock(
 	b.stateLock.Unlock()
 	// Notify the caller that the block was disconnected from the main chain. The caller would typically want to react
 	// with actions such as updating wallets.
-	b.ChainLock.Unlock()
-	b.sendNotification(NTBlockDisconnected, block)
-	b.ChainLock.Lock()
+	b.sendNotification(&Notification{Type: NTBlockDisconnected, Block: block})
+	b.sendNotification(
+		&Notification{Type: NTTipChanged, TipChange: &TipChange{Hash: node.parent.hash, Height: node.parent.height}},
+	)
 	return nil
 }
 
@@ -856,7 +918,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) (e err
 		er = b.checkConnectBlock(n, block, view, nil)
 		if er != nil {
 			if _, ok := er.(RuleError); ok {
-				b.Index.SetStatusFlags(n, statusValidateFailed)
+				b.setValidateFailed(n, er)
 				for de := e.Next(); de != nil; de = de.Next() {
 					dn := de.Value.(*BlockNode)
 					b.Index.SetStatusFlags(dn, statusInvalidAncestor)
@@ -867,6 +929,19 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) (e err
 		b.Index.SetStatusFlags(n, statusValid)
 		newBest = n
 	}
+	// All of the blocks to attach are valid, so the chain is about to be reorganized.
+	fork := forkNode
+	if fork == nil {
+		fork = detachNodes.Back().Value.(*BlockNode).parent
+	}
+	reorg := &Reorganization{ForkHash: fork.hash, ForkHeight: fork.height}
+	for e := detachNodes.Front(); e != nil; e = e.Next() {
+		reorg.Detached = append(reorg.Detached, e.Value.(*BlockNode).hash)
+	}
+	for e := attachNodes.Front(); e != nil; e = e.Next() {
+		reorg.Attached = append(reorg.Attached, e.Value.(*BlockNode).hash)
+	}
+	b.sendNotification(&Notification{Type: NTReorgStarted, Reorganization: reorg})
 	// Reset the view for the actual connection code below. This is required because the view was previously modified
 	// when checking if the reorg would be successful and the connection code requires the view to be valid from the
 	// viewpoint of each block being connected or disconnected.
@@ -933,6 +1008,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) (e err
 		"REORGANIZE: New best chain head is %v (height %v)",
 		newBest.hash, newBest.height,
 	)
+	b.sendNotification(&Notification{Type: NTReorgFinished, Reorganization: reorg})
 	return nil
 }
 
@@ -976,7 +1052,7 @@ func (b *BlockChain) connectBestChain(node *BlockNode, block *block2.Block, flag
 			if e == nil {
 				b.Index.SetStatusFlags(node, statusValid)
 			} else if _, ok := e.(RuleError); ok {
-				b.Index.SetStatusFlags(node, statusValidateFailed)
+				b.setValidateFailed(node, e)
 			} else {
 				return false, e
 			}
@@ -1005,7 +1081,7 @@ func (b *BlockChain) connectBestChain(node *BlockNode, block *block2.Block, flag
 			// If we got hit with a rule error, then we'll mark that status of the block as invalid and flush the index
 			// state to disk before returning with the error.
 			if _, ok := e.(RuleError); ok {
-				b.Index.SetStatusFlags(node, statusValidateFailed)
+				b.setValidateFailed(node, e)
 			}
 			flushIndexState()
 			return false, e
@@ -1050,6 +1126,12 @@ func (b *BlockChain) connectBestChain(node *BlockNode, block *block2.Block, flag
 	// attach the blocks that form the new chain to the main chain starting at the common ancestor (the point where the
 	// chain forked).
 	detachNodes, attachNodes := b.getReorganizeNodes(node)
+	// A side chain that would detach too many blocks is kept as a side chain, as the block itself is valid and the
+	// peer that sent it is not at fault.
+	if b.reorgTooDeep(block, detachNodes, attachNodes) {
+		flushIndexState()
+		return false, nil
+	}
 	// Reorganize the chain.
 	W.F("REORGANIZE: block %v is causing a reorganize", node.hash)
 	e := b.reorganizeChain(detachNodes, attachNodes)
@@ -1062,6 +1144,51 @@ func (b *BlockChain) connectBestChain(node *BlockNode, block *block2.Block, flag
 	return e == nil, e
 }
 
+// setValidateFailed marks the node as having failed validation for the given reason and sends a NTBlockInvalid
+// notification.
+func (b *BlockChain) setValidateFailed(node *BlockNode, reason error) {
+	b.Index.SetStatusFlags(node, statusValidateFailed)
+	b.sendNotification(
+		&Notification{
+			Type:         NTBlockInvalid,
+			InvalidBlock: &InvalidBlock{Hash: node.hash, Height: node.height, Err: reason},
+		},
+	)
+}
+
+// reorgTooDeep returns whether a reorganization would detach more blocks from the main chain than the maximum
+// reorganization depth. If so the blocks to be attached are marked as refused, so the side chain is not reorganized to
+// until an operator reconsiders it, and a NTReorgRefused notification is sent.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) reorgTooDeep(block *block2.Block, detachNodes, attachNodes *list.List) bool {
+	depth := int32(detachNodes.Len())
+	if b.maxReorgDepth <= 0 || depth <= b.maxReorgDepth || attachNodes.Len() == 0 {
+		return false
+	}
+	for e := attachNodes.Front(); e != nil; e = e.Next() {
+		b.Index.SetStatusFlags(e.Value.(*BlockNode), statusReorgRefused)
+	}
+	fork := attachNodes.Front().Value.(*BlockNode).parent
+	str := fmt.Sprintf(
+		"block %v would reorganize the chain from height %d, detaching %d blocks, more than the maximum of %d",
+		block.Hash(), fork.height, depth, b.maxReorgDepth,
+	)
+	W.Ln("REORGANIZE REFUSED:", str, "- keeping it as a side chain")
+	b.sendNotification(
+		&Notification{
+			Type: NTReorgRefused,
+			RefusedReorg: &RefusedReorg{
+				Block:      block,
+				ForkHash:   fork.hash,
+				ForkHeight: fork.height,
+				Depth:      depth,
+			},
+		},
+	)
+	return true
+}
+
 // isCurrent returns whether or not the chain believes it is current. Several factors are used to guess, but the key
 // factors that allow the chain to believe it is current are:
 //
@@ -1485,6 +1612,19 @@ type Config struct {
 	// O(N^2) validation complexity due to the SigHashAll flag. This field can be nil if the caller is not interested in
 	// using a signature cache.
 	HashCache *txscript.HashCache
+	// Prune is the target size in megabytes for the stored block data. When it is not zero, the oldest block files are
+	// removed once all of their blocks are buried deeper than PruneDepth, and it must be at least MinPruneTarget.
+	Prune uint64
+	// ReverifyPow causes the proof of work hash of every block in the block index to be recomputed and checked when the
+	// chain is loaded, instead of trusting the hashes stored in the block index.
+	ReverifyPow bool
+	// MaxReorgDepth is the largest number of blocks a side chain with more work may detach from the main chain when
+	// the chain is reorganized to it as blocks are processed, or zero for no limit. A deeper side chain is accepted as a
+	// side chain without an error, marked as refused and a NTReorgRefused notification is sent, leaving it to an operator to reorganize to it by
+	// reconsidering its blocks. Checkpoints still reject any side chain forking before the latest of them.
+	MaxReorgDepth int32
+	// MaxRejectReports is the number of rejected blocks RejectedBlocks reports, DefaultMaxRejectReports when zero.
+	MaxRejectReports int
 }
 
 // New returns a BlockChain instance using the provided configuration details.
@@ -1499,6 +1639,14 @@ func New(config *Config) (*BlockChain, error) {
 	if config.TimeSource == nil {
 		return nil, AssertError("blockchain.New timesource is nil")
 	}
+	if config.Prune != 0 && config.Prune < MinPruneTarget {
+		return nil, AssertError(
+			fmt.Sprintf(
+				"blockchain.New prune target of %d MB is less than the minimum of %d MB",
+				config.Prune, MinPruneTarget,
+			),
+		)
+	}
 	// Generate a checkpoint by height map from the provided checkpoints and assert the provided checkpoints are sorted
 	// by height as required.
 	var checkpointsByHeight map[int32]*chaincfg.Checkpoint
@@ -1536,19 +1684,39 @@ func New(config *Config) (*BlockChain, error) {
 		BestChain:           newChainView(nil),
 		orphans:             make(map[chainhash.Hash]*orphanBlock),
 		prevOrphans:         make(map[chainhash.Hash][]*orphanBlock),
+		powHashes:           newPowHashCache(),
+		maxReorgDepth:       config.MaxReorgDepth,
+		rejects:             newRejectLog(config.MaxRejectReports),
 		// warningCaches:         newThresholdCaches(vbNumBits),
 		// deploymentCaches:      newThresholdCaches(chaincfg.DefinedDeployments),
 		DifficultyAdjustments: make(map[string]float64),
+		pruneTarget:           config.Prune * 1024 * 1024,
 	}
 	b.DifficultyBits.Store(make(Diffs))
+	// Find out whether block data has been pruned in a previous run so it is still advertised when pruning is off.
+	if e := b.db.View(
+		func(dbTx database.Tx) (e error) {
+			var pruned bool
+			if pruned, e = dbTx.BeenPruned(); E.Chk(e) {
+				return e
+			}
+			b.pruned.Store(pruned)
+			return nil
+		},
+	); E.Chk(e) {
+		return nil, e
+	}
 	// Initialize the chain state from the passed database. When the db does not yet contain any chain state, both it
 	// and the chain state will be initialized to contain only the genesis block.
-	if e := b.initChainState(); E.Chk(e) {
+	//
+	// Any upgrades to the various chain-specific buckets are performed before the chain state is loaded.
+	if e := b.initChainState(config.Interrupt); E.Chk(e) {
 		return nil, e
 	}
-	// Perform any upgrades to the various chain-specific buckets as needed.
-	if e := b.maybeUpgradeDbBuckets(config.Interrupt); E.Chk(e) {
-		return nil, e
+	if config.ReverifyPow {
+		if e := b.reverifyPowHashes(0, config.Interrupt); E.Chk(e) {
+			return nil, e
+		}
 	}
 	// Initialize and catch up all of the currently active optional indexes as needed.
 	if config.IndexManager != nil {
@@ -1564,7 +1732,7 @@ func New(config *Config) (*BlockChain, error) {
 	bestNode := b.BestChain.Tip()
 	df, ok := bestNode.Diffs.Load().(Diffs)
 	if df == nil || !ok ||
-		len(df) != len(fork.List[1].AlgoVers) {
+		len(df) != len(b.params.Forks.Forks[b.params.Forks.GetCurrent(bestNode.height+1)].AlgoVers) {
 		bitsMap, e := b.CalcNextRequiredDifficultyPlan9Controller(bestNode)
 		if e != nil {
 		}
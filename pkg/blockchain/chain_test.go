@@ -1,11 +1,13 @@
 package blockchain
 
 import (
+	"github.com/p9c/parallelcoin/pkg/block"
 	"github.com/p9c/parallelcoin/pkg/chaincfg"
 	chainhash "github.com/p9c/parallelcoin/pkg/chainhash"
 	"github.com/p9c/parallelcoin/pkg/wire"
 	"reflect"
 	"testing"
+	"time"
 )
 
 // // TestHaveBlock tests the HaveBlock API to ensure proper functionality.
@@ -857,3 +859,118 @@ func TestIntervalBlockHashes(t *testing.T) {
 		}
 	}
 }
+
+// TestPrunedBlocks ensures blocks marked as pruned in the block index are reported with the pruned error and that a
+// pruned chain stops advertising itself as a full node.
+func TestPrunedBlocks(t *testing.T) {
+	tip := tstTip
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	nodes := chainedNodes(chain.BestChain.Genesis(), 5)
+	for _, node := range nodes {
+		chain.Index.SetStatusFlags(node, statusValid)
+		chain.Index.AddNode(node)
+	}
+	chain.BestChain.SetTip(tip(nodes))
+	services := wire.SFNodeNetwork | wire.SFNodeBloom
+	if got := chain.AdvertisedServices(services); got != services {
+		t.Fatalf("AdvertisedServices: got %v, want %v", got, services)
+	}
+	chain.Index.UnsetStatusFlags(nodes[1], statusDataStored)
+	chain.Index.SetStatusFlags(nodes[1], statusDataPruned)
+	chain.pruned.Store(true)
+	if _, e := chain.BlockByHash(&nodes[1].hash); !IsBlockPrunedErr(e) {
+		t.Fatalf("BlockByHash: expected pruned error, got %v", e)
+	}
+	if _, e := chain.BlockByHeight(nodes[1].height); !IsBlockPrunedErr(e) {
+		t.Fatalf("BlockByHeight: expected pruned error, got %v", e)
+	}
+	if !chain.IsPruned() {
+		t.Fatalf("IsPruned: expected chain to be pruned")
+	}
+	if got := chain.AdvertisedServices(services); got != wire.SFNodeBloom {
+		t.Fatalf("AdvertisedServices: got %v, want %v", got, wire.SFNodeBloom)
+	}
+}
+
+// TestReorgTooDeep ensures a reorganization detaching more blocks than the maximum depth is refused, that the side chain
+// is marked as refused and reported as such in the chain tips, and that a notification is sent.
+func TestReorgTooDeep(t *testing.T) {
+	// 	genesis -> 1 -> 2  -> 3  -> 4  -> 5
+	// 	           |    \-> 3b -> 4b -> 5b -> 6b
+	// 	           \-> 2a -> 3a -> 4a -> 5a -> 6a
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	chain.maxReorgDepth = 3
+	mainNodes := chainedNodes(chain.BestChain.Genesis(), 5)
+	deepNodes := chainedNodes(mainNodes[0], 5)
+	shallowNodes := chainedNodes(mainNodes[1], 4)
+	for _, nodes := range [][]*BlockNode{mainNodes, deepNodes, shallowNodes} {
+		for _, node := range nodes {
+			chain.Index.SetStatusFlags(node, statusDataStored)
+			chain.Index.AddNode(node)
+		}
+	}
+	chain.BestChain.SetTip(tstTip(mainNodes))
+	refused := make(chan *RefusedReorg, 1)
+	sub := chain.SubscribeWithOptions(
+		func(n *Notification) {
+			refused <- n.RefusedReorg
+		}, SubscribeOptions{Types: []NotificationType{NTReorgRefused}},
+	)
+	defer sub.Cancel()
+	chain.ChainLock.Lock()
+	detachNodes, attachNodes := chain.getReorganizeNodes(tstTip(deepNodes))
+	if !chain.reorgTooDeep(block.NewBlock(&wire.Block{}), detachNodes, attachNodes) {
+		t.Fatalf("reorgTooDeep: a reorganization detaching %d blocks was not refused", detachNodes.Len())
+	}
+	for _, node := range deepNodes {
+		if !chain.Index.NodeStatus(node).ReorgRefused() {
+			t.Fatalf("reorgTooDeep: node %v of the refused side chain is not marked", node)
+		}
+	}
+	detachNodes, attachNodes = chain.getReorganizeNodes(tstTip(shallowNodes))
+	if chain.reorgTooDeep(block.NewBlock(&wire.Block{}), detachNodes, attachNodes) {
+		t.Fatalf("reorgTooDeep: a reorganization detaching %d blocks was refused", detachNodes.Len())
+	}
+	if chain.canBecomeTip(tstTip(deepNodes)) || !chain.canBecomeTip(tstTip(shallowNodes)) {
+		t.Fatal("canBecomeTip: a refused side chain can become the tip or one that is not refused can not")
+	}
+	// The notification is delivered once the chain lock is released.
+	chain.unlockChain()
+	select {
+	case r := <-refused:
+		if r.Depth != 4 || r.ForkHash != mainNodes[0].hash {
+			t.Fatalf("reorgTooDeep: got notification %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reorgTooDeep: no notification was sent")
+	}
+	for _, tip := range chain.ChainTips() {
+		if tip.Hash == tstTip(deepNodes).hash && tip.Status != ChainTipReorgRefused {
+			t.Fatalf("ChainTips: refused side chain has status %v", tip.Status)
+		}
+	}
+}
+
+// TestOneForkSchedule ensures a chain whose schedule holds only the first hard fork can be created, loaded again and
+// have blocks connected to it.
+func TestOneForkSchedule(t *testing.T) {
+	params := tstEasyParams(t)
+	params.Forks.Forks = params.Forks.Forks[:1]
+	if e := params.Forks.Init(); e != nil {
+		t.Fatal(e)
+	}
+	chain, teardown, e := chainSetup("oneforkschedule", params)
+	if e != nil {
+		t.Fatalf("failed to setup chain instance: %v", e)
+	}
+	defer teardown()
+	for i := 0; i < 3; i++ {
+		tstMineBlock(t, chain)
+	}
+	if got := chain.BestSnapshot().Height; got != 3 {
+		t.Fatalf("BestSnapshot: height %d, want 3", got)
+	}
+	if _, e = New(&Config{DB: chain.db, ChainParams: params, TimeSource: NewMedianTime()}); e != nil {
+		t.Fatalf("New: loading the chain again: %v", e)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	
 	"github.com/p9c/parallelcoin/pkg/chainhash"
 	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/fork"
 	"github.com/p9c/parallelcoin/pkg/wire"
 )
 
@@ -24,11 +25,17 @@ const (
 	// latestSpendJournalBucketVersion is the current version of the spend journal bucket that is used to track all
 	// spent transactions for use in reorgs.
 	latestSpendJournalBucketVersion = 1
+	// latestBlockIndexBucketVersion is the current version of the block index bucket. Version 2 added the proof of work
+	// hash of each block, computed with the algorithm of its version, after the header and status.
+	latestBlockIndexBucketVersion = 2
 )
 
 var (
 	// blockIndexBucketName is the name of the db bucket used to house to the block headers and contextual information.
 	blockIndexBucketName = []byte("blockheaderidx")
+	// blockIndexVersionKeyName is the name of the db key used to store the version of the block index currently in the
+	// database.
+	blockIndexVersionKeyName = []byte("blockindexversion")
 	// hashIndexBucketName is the name of the db bucket used to house to the block hash -> block height index.
 	hashIndexBucketName = []byte("hashidx")
 	// heightIndexBucketName is the name of the db bucket used to house to the block height -> block hash index.
@@ -64,6 +71,21 @@ func isNotInMainChainErr(e error) bool {
 	return ok
 }
 
+// errBlockPruned signifies that a block which is known to the block index was requested but its data has been removed
+// from the database by pruning.
+type errBlockPruned string
+
+// Error implements the error interface.
+func (e errBlockPruned) Error() string {
+	return string(e)
+}
+
+// IsBlockPrunedErr returns whether or not the passed error indicates the requested block data has been pruned.
+func IsBlockPrunedErr(e error) bool {
+	_, ok := e.(errBlockPruned)
+	return ok
+}
+
 // errDeserialize signifies that a problem was encountered when
 // deserializing data.
 type errDeserialize string
@@ -104,23 +126,6 @@ func dbPutVersion(dbTx database.Tx, key []byte, version uint32) (e error) {
 	return dbTx.Metadata().Put(key, serialized[:])
 }
 
-// dbFetchOrCreateVersion uses an existing database transaction to attempt to fetch the provided key from the metadata
-// bucket as a version and in the case it doesn't exist it adds the entry with the provided default version and returns
-// that.
-//
-// This is useful during upgrades to automatically handle loading and adding version keys as necessary.
-func dbFetchOrCreateVersion(dbTx database.Tx, key []byte, defaultVersion uint32) (uint32, error) {
-	version := dbFetchVersion(dbTx, key)
-	if version == 0 {
-		version = defaultVersion
-		e := dbPutVersion(dbTx, key, version)
-		if e != nil {
-			return 0, e
-		}
-	}
-	return version, nil
-}
-
 // The transaction spend journal consists of an entry for each block
 // connected to the main chain which contains the transaction outputs the block spends serialized such that the order is the reverse of the order they were spent. This is required because reorganizing the chain necessarily entails disconnecting blocks to get back to the point of the fork which implies unspending all of the transaction outputs that each block previously spent.
 // Since the utxo set, by definition,
@@ -663,6 +668,7 @@ func dbFetchUtxoEntry(dbTx database.Tx, outpoint wire.OutPoint) (*UtxoEntry, err
 //
 // In particular, only the entries that have been marked as modified are written to the database.
 func dbPutUtxoView(dbTx database.Tx, view *UtxoViewpoint) (e error) {
+	defer utxoStats.storeTime.ObserveSince(time.Now())
 	utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
 	for outpoint, entry := range view.entries {
 		// No need to update the database if the entry was not modified.
@@ -677,6 +683,7 @@ func dbPutUtxoView(dbTx database.Tx, view *UtxoViewpoint) (e error) {
 			if e != nil {
 				return e
 			}
+			utxoStats.removed.Inc()
 			continue
 		}
 		// Serialize and store the utxo entry.
@@ -691,6 +698,7 @@ func dbPutUtxoView(dbTx database.Tx, view *UtxoViewpoint) (e error) {
 		if e != nil {
 			return e
 		}
+		utxoStats.stored.Inc()
 	}
 	return nil
 }
@@ -786,6 +794,14 @@ func dbFetchHashByHeight(dbTx database.Tx, height int32) (*chainhash.Hash, error
 //   total txns        uint64           8 bytes
 //   work sum length   uint32           4 bytes
 //   work sum          big.Int          work sum length
+//   supply            int64            8 bytes
+//   mined             int64            8 bytes
+//   hard fork payees  int64            8 bytes
+//   dev fund          int64            8 bytes
+//   burned            int64            8 bytes
+//
+// The supply, and later the mined, disbursed and burned coins after it, were added to the format over time, so they are
+// missing from the state of databases that have not had a block connected or disconnected since.
 // -----------------------------------------------------------------------------
 
 // bestChainState represents the data to be stored the database for the current best chain state.
@@ -794,6 +810,11 @@ type bestChainState struct {
 	height    uint32
 	totalTxns uint64
 	workSum   *big.Int
+	supply    supplyState
+	// hasSupply is whether the value of the utxo set was stored, and hasIssuance whether the mined, disbursed and
+	// burned coins were.
+	hasSupply   bool
+	hasIssuance bool
 }
 
 // serializeBestChainState returns the serialization of the passed block best chain state. This is data to be stored in
@@ -802,7 +823,7 @@ func serializeBestChainState(state bestChainState) []byte {
 	// Calculate the full size needed to serialize the chain state.
 	workSumBytes := state.workSum.Bytes()
 	workSumBytesLen := uint32(len(workSumBytes))
-	serializedLen := chainhash.HashSize + 4 + 8 + 4 + workSumBytesLen
+	serializedLen := chainhash.HashSize + 4 + 8 + 4 + workSumBytesLen + 40
 	// Serialize the chain state.
 	serializedData := make([]byte, serializedLen)
 	copy(serializedData[0:chainhash.HashSize], state.hash[:])
@@ -814,6 +835,13 @@ func serializeBestChainState(state bestChainState) []byte {
 	byteOrder.PutUint32(serializedData[offset:], workSumBytesLen)
 	offset += 4
 	copy(serializedData[offset:], workSumBytes)
+	offset += workSumBytesLen
+	for _, v := range []int64{
+		state.supply.utxo, state.supply.mined, state.supply.payees, state.supply.devFund, state.supply.burned,
+	} {
+		byteOrder.PutUint64(serializedData[offset:], uint64(v))
+		offset += 8
+	}
 	return serializedData[:]
 }
 
@@ -846,6 +874,26 @@ func deserializeBestChainState(serializedData []byte) (bestChainState, error) {
 	}
 	workSumBytes := serializedData[offset : offset+workSumBytesLen]
 	state.workSum = new(big.Int).SetBytes(workSumBytes)
+	offset += workSumBytesLen
+	switch uint32(len(serializedData)) - offset {
+	case 0:
+	case 8:
+		state.supply.utxo = int64(byteOrder.Uint64(serializedData[offset:]))
+		state.hasSupply = true
+	case 40:
+		for _, v := range []*int64{
+			&state.supply.utxo, &state.supply.mined, &state.supply.payees, &state.supply.devFund, &state.supply.burned,
+		} {
+			*v = int64(byteOrder.Uint64(serializedData[offset:]))
+			offset += 8
+		}
+		state.hasSupply, state.hasIssuance = true, true
+	default:
+		return bestChainState{}, database.DBError{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt best chain state",
+		}
+	}
 	return state, nil
 }
 
@@ -858,6 +906,7 @@ func dbPutBestState(dbTx database.Tx, snapshot *BestState, workSum *big.Int) (e
 			height:    uint32(snapshot.Height),
 			totalTxns: snapshot.TotalTxns,
 			workSum:   workSum,
+			supply:    snapshot.supply(),
 		},
 	)
 	// Store the current best chain state into the database.
@@ -877,6 +926,7 @@ func (b *BlockChain) createChainState() (e error) {
 	header := &genesisBlock.WireBlock().Header
 	node := NewBlockNode(header, nil)
 	node.status = statusDataStored | statusValid
+	node.PowHash(b.params.Forks)
 	var df Diffs
 	df, e = b.CalcNextRequiredDifficultyPlan9Controller(node)
 	node.Diffs.Store(df)
@@ -892,7 +942,7 @@ func (b *BlockChain) createChainState() (e error) {
 	blockWeight := uint64(GetBlockWeight(genesisBlock))
 	b.stateSnapshot = newBestState(
 		node, blockSize, blockWeight, numTxns,
-		numTxns, time.Unix(node.timestamp, 0),
+		numTxns, supplyState{}, time.Unix(node.timestamp, 0),
 	)
 	// Create the initial the database chain state including creating the necessary index buckets and inserting the
 	// genesis block.
@@ -904,6 +954,13 @@ func (b *BlockChain) createChainState() (e error) {
 			if e != nil {
 				return e
 			}
+			e = dbPutVersion(
+				dbTx, blockIndexVersionKeyName,
+				latestBlockIndexBucketVersion,
+			)
+			if e != nil {
+				return e
+			}
 			// Create the bucket that houses the chain block hash to height index.
 			_, e = meta.CreateBucket(hashIndexBucketName)
 			if e != nil {
@@ -941,7 +998,7 @@ func (b *BlockChain) createChainState() (e error) {
 				return e
 			}
 			// Save the genesis block to the block index database.
-			e = dbStoreBlockNode(dbTx, node)
+			e = dbStoreBlockNode(dbTx, node, b.params.Forks)
 			if e != nil {
 				return e
 			}
@@ -965,14 +1022,13 @@ func (b *BlockChain) createChainState() (e error) {
 
 // initChainState attempts to load and initialize the chain state from the database. When the db does not yet contain
 // any chain state, both it and the chain state are initialized to the genesis block.
-func (b *BlockChain) initChainState() (e error) {
+func (b *BlockChain) initChainState(interrupt <-chan struct{}) (e error) {
 	// Determine the state of the chain database. We may need to initialize everything from scratch or upgrade certain
 	// buckets.
-	var initialized, hasBlockIndex bool
+	var initialized bool
 	e = b.db.View(
 		func(dbTx database.Tx) (e error) {
 			initialized = dbTx.Metadata().Get(chainStateKeyName) != nil
-			hasBlockIndex = dbTx.Metadata().Bucket(blockIndexBucketName) != nil
 			return nil
 		},
 	)
@@ -984,13 +1040,14 @@ func (b *BlockChain) initChainState() (e error) {
 		// genesis block.
 		return b.createChainState()
 	}
-	if !hasBlockIndex {
-		e = migrateBlockIndex(b.db)
-		if e != nil {
-			return nil
-		}
+	// Bring the buckets to their latest versions before loading them, refusing a database written by newer software.
+	if e = b.maybeUpgradeDbBuckets(interrupt); E.Chk(e) {
+		return e
 	}
 	// Attempt to load the chain state from the database.
+	//
+	// storeSupply is set when the supply was missing from the stored state and was added up, so it is stored.
+	var storeSupply bool
 	e = b.db.View(
 		func(dbTx database.Tx) (e error) {
 			// Fetch the stored chain state from the database metadata. When it doesn't exist, it means the database hasn't
@@ -1020,7 +1077,9 @@ func (b *BlockChain) initChainState() (e error) {
 			for ok := cursor.First(); ok; ok = cursor.Next() {
 				var header *wire.BlockHeader
 				var status blockStatus
-				header, status, e = deserializeBlockRow(cursor.Value())
+				var powHash *chainhash.Hash
+				var precious int32
+				header, status, powHash, precious, e = deserializeBlockRow(cursor.Value())
 				if e != nil {
 					return e
 				}
@@ -1057,6 +1116,11 @@ func (b *BlockChain) initChainState() (e error) {
 				node := &blockNodes[i]
 				initBlockNode(node, header, parent)
 				node.status = status
+				node.powHash = powHash
+				node.precious = precious
+				if precious > b.preciousSeq {
+					b.preciousSeq = precious
+				}
 				b.Index.addNode(node)
 				lastNode = node
 				i++
@@ -1101,9 +1165,17 @@ func (b *BlockChain) initChainState() (e error) {
 			blockSize := uint64(len(blockBytes))
 			blockWeight := uint64(GetBlockWeight(block.NewBlock(&blk)))
 			numTxns := uint64(len(blk.Transactions))
+			supply := state.supply
+			if !state.hasIssuance {
+				I.Ln("adding up the coins issued by the blocks of the chain")
+				if supply, e = b.dbSumIssuance(dbTx, tip, interrupt); E.Chk(e) {
+					return e
+				}
+				storeSupply = true
+			}
 			b.stateSnapshot = newBestState(
 				tip, blockSize, blockWeight,
-				numTxns, state.totalTxns, tip.CalcPastMedianTime(),
+				numTxns, state.totalTxns, supply, tip.CalcPastMedianTime(),
 			)
 			return nil
 		},
@@ -1111,24 +1183,54 @@ func (b *BlockChain) initChainState() (e error) {
 	if e != nil {
 		return e
 	}
+	if storeSupply {
+		e = b.db.Update(
+			func(dbTx database.Tx) (e error) {
+				return dbPutBestState(dbTx, b.stateSnapshot, b.BestChain.Tip().workSum)
+			},
+		)
+		if E.Chk(e) {
+			return e
+		}
+	}
 	// As we might have updated the index after it was loaded, we'll attempt to flush the index to the DB. This will
 	// only result in a write if the elements are dirty, so it'll usually be a noop.
 	return b.Index.flushToDB()
 }
 
-// deserializeBlockRow parses a value in the block index bucket into a block header and block status bitfield.
-func deserializeBlockRow(blockRow []byte) (*wire.BlockHeader, blockStatus, error) {
+// deserializeBlockRow parses a value in the block index bucket into a block header, block status bitfield, proof of
+// work hash and PreciousBlock sequence number. The hash is nil for rows written before version 2 of the block index,
+// and the sequence number is only stored for blocks that were made precious.
+func deserializeBlockRow(blockRow []byte) (
+	header *wire.BlockHeader, status blockStatus, powHash *chainhash.Hash, precious int32, e error,
+) {
 	buffer := bytes.NewReader(blockRow)
-	var header wire.BlockHeader
-	e := header.Deserialize(buffer)
-	if e != nil {
-		return nil, statusNone, e
+	header = &wire.BlockHeader{}
+	if e = header.Deserialize(buffer); e != nil {
+		return nil, statusNone, nil, 0, e
 	}
 	statusByte, e := buffer.ReadByte()
 	if e != nil {
-		return nil, statusNone, e
+		return nil, statusNone, nil, 0, e
 	}
-	return &header, blockStatus(statusByte), nil
+	if buffer.Len() == 0 {
+		return header, blockStatus(statusByte), nil, 0, nil
+	}
+	if buffer.Len() != chainhash.HashSize && buffer.Len() != chainhash.HashSize+4 {
+		return nil, statusNone, nil, 0, errDeserialize("unexpected length of proof of work hash in block index row")
+	}
+	powHash = &chainhash.Hash{}
+	if _, e = buffer.Read(powHash[:]); e != nil {
+		return nil, statusNone, nil, 0, e
+	}
+	if buffer.Len() != 0 {
+		var seq [4]byte
+		if _, e = buffer.Read(seq[:]); e != nil {
+			return nil, statusNone, nil, 0, e
+		}
+		precious = int32(byteOrder.Uint32(seq[:]))
+	}
+	return header, blockStatus(statusByte), powHash, precious, nil
 }
 
 // dbFetchHeaderByHash uses an existing database transaction to retrieve the block header for the provided hash.
@@ -1173,11 +1275,12 @@ func dbFetchBlockByNode(dbTx database.Tx, node *BlockNode) (*block.Block, error)
 	return block, nil
 }
 
-// dbStoreBlockNode stores the block header and validation status to the block index bucket. This overwrites the current
-// entry if there exists one.
-func dbStoreBlockNode(dbTx database.Tx, node *BlockNode) (e error) {
+// dbStoreBlockNode stores the block header, validation status, proof of work hash and, for blocks made precious, the
+// PreciousBlock sequence number to the block index bucket. This overwrites the current entry if there exists one. The
+// block index lock must be held for nodes that are in the index, as the proof of work hash is kept on the node.
+func dbStoreBlockNode(dbTx database.Tx, node *BlockNode, forks *fork.Schedule) (e error) {
 	// Serialize block data to be stored.
-	w := bytes.NewBuffer(make([]byte, 0, blockHdrSize+1))
+	w := bytes.NewBuffer(make([]byte, 0, blockHdrSize+1+chainhash.HashSize+4))
 	header := node.Header()
 	e = header.Serialize(w)
 	if e != nil {
@@ -1187,6 +1290,18 @@ func dbStoreBlockNode(dbTx database.Tx, node *BlockNode) (e error) {
 	if e != nil {
 		return e
 	}
+	powHash := node.PowHash(forks)
+	_, e = w.Write(powHash[:])
+	if e != nil {
+		return e
+	}
+	if node.precious != 0 {
+		var seq [4]byte
+		byteOrder.PutUint32(seq[:], uint32(node.precious))
+		if _, e = w.Write(seq[:]); e != nil {
+			return e
+		}
+	}
 	value := w.Bytes()
 	// Write block header data to block index bucket.
 	blockIndexBucket := dbTx.Metadata().Bucket(blockIndexBucketName)
@@ -1207,6 +1322,33 @@ func dbStoreBlock(dbTx database.Tx, block *block.Block) (e error) {
 	return dbTx.StoreBlock(block)
 }
 
+// ForEachStoredBlock calls fn with the hash and height of every block whose data is stored in the database, in order of
+// height, as recorded in the block index. It works on the database directly without loading the chain, so it can be
+// used to copy the blocks of one database into another.
+func ForEachStoredBlock(dbTx database.Tx, fn func(hash *chainhash.Hash, height int32) error) (e error) {
+	blockIndexBucket := dbTx.Metadata().Bucket(blockIndexBucketName)
+	if blockIndexBucket == nil {
+		return nil
+	}
+	return blockIndexBucket.ForEach(
+		func(k, v []byte) (e error) {
+			if len(k) != chainhash.HashSize+4 {
+				return errDeserialize("unexpected length of block index key")
+			}
+			var status blockStatus
+			if _, status, _, _, e = deserializeBlockRow(v); E.Chk(e) {
+				return e
+			}
+			if !status.HaveData() || status.Pruned() {
+				return nil
+			}
+			var hash chainhash.Hash
+			copy(hash[:], k[4:])
+			return fn(&hash, int32(binary.BigEndian.Uint32(k[0:4])))
+		},
+	)
+}
+
 // blockIndexKey generates the binary key for an entry in the block index bucket. The key is composed of the block
 // height encoded as a big-endian 32 -bit unsigned int followed by the 32 byte block hash.
 func blockIndexKey(blockHash *chainhash.Hash, blockHeight uint32) []byte {
@@ -1224,6 +1366,10 @@ func (b *BlockChain) BlockByHeight(blockHeight int32) (*block.Block, error) {
 		str := fmt.Sprintf("no block at height %d exists", blockHeight)
 		return nil, errNotInMainChain(str)
 	}
+	if b.Index.NodeStatus(node).Pruned() {
+		str := fmt.Sprintf("block at height %d has been pruned", blockHeight)
+		return nil, errBlockPruned(str)
+	}
 	// Load the block from the database and return it.
 	var block *block.Block
 	e := b.db.View(
@@ -1245,6 +1391,10 @@ func (b *BlockChain) BlockByHash(hash *chainhash.Hash) (block *block.Block, e er
 		str := fmt.Sprintf("blockByHash: block %s is not in the main chain", hash)
 		return nil, errNotInMainChain(str)
 	}
+	if b.Index.NodeStatus(node).Pruned() {
+		str := fmt.Sprintf("blockByHash: block %s has been pruned", hash)
+		return nil, errBlockPruned(str)
+	}
 	// Load the block from the database and return it.
 	e = b.db.View(
 		func(dbTx database.Tx) (er error) {
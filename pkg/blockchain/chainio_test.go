@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"testing"
 	
+	"github.com/p9c/parallelcoin/pkg/chainhash"
 	"github.com/p9c/parallelcoin/pkg/wire"
 	database "github.com/p9c/parallelcoin/pkg/database"
 )
@@ -672,3 +673,36 @@ func TestBestChainStateDeserializeErrors(t *testing.T) {
 		}
 	}
 }
+
+// TestForEachStoredBlock ensures the stored blocks are listed from the block index in order of height.
+func TestForEachStoredBlock(t *testing.T) {
+	chain, teardown, e := chainSetup("foreachstoredblock", tstEasyParams(t))
+	if e != nil {
+		t.Fatalf("failed to setup chain instance: %v", e)
+	}
+	defer teardown()
+	want := []chainhash.Hash{*chain.params.GenesisHash}
+	for i := 0; i < 3; i++ {
+		want = append(want, *tstMineBlock(t, chain).Hash())
+	}
+	var got []chainhash.Hash
+	e = chain.db.View(
+		func(dbTx database.Tx) error {
+			return ForEachStoredBlock(
+				dbTx, func(hash *chainhash.Hash, height int32) error {
+					if int(height) != len(got) {
+						t.Errorf("ForEachStoredBlock: got height %d for block #%d", height, len(got))
+					}
+					got = append(got, *hash)
+					return nil
+				},
+			)
+		},
+	)
+	if e != nil {
+		t.Fatalf("ForEachStoredBlock: unexpected error: %v", e)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ForEachStoredBlock: got blocks %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,110 @@
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+)
+
+// ChainTipStatus describes the state of the branch that ends at a chain tip.
+type ChainTipStatus int
+
+const (
+	// ChainTipActive is the tip of the main chain.
+	ChainTipActive ChainTipStatus = iota
+	// ChainTipValidFork is the tip of a side chain that has been fully validated.
+	ChainTipValidFork
+	// ChainTipValidHeaders is the tip of a side chain for which all blocks are stored but which has not been fully
+	// validated.
+	ChainTipValidHeaders
+	// ChainTipHeadersOnly is the tip of a side chain for which the data of at least one block is not stored.
+	ChainTipHeadersOnly
+	// ChainTipInvalid is the tip of a side chain which contains a block that is known to be invalid.
+	ChainTipInvalid
+	// ChainTipReorgRefused is the tip of a side chain the main chain was not reorganized to because it would have
+	// detached more blocks than the maximum reorganization depth.
+	ChainTipReorgRefused
+)
+
+// chainTipStatusStrings is a map of chain tip statuses back to their constant names for pretty printing.
+var chainTipStatusStrings = map[ChainTipStatus]string{
+	ChainTipActive:       "active",
+	ChainTipValidFork:    "valid-fork",
+	ChainTipValidHeaders: "valid-headers",
+	ChainTipHeadersOnly:  "headers-only",
+	ChainTipInvalid:      "invalid",
+	ChainTipReorgRefused: "reorg-refused",
+}
+
+// String returns the ChainTipStatus in human-readable form.
+func (s ChainTipStatus) String() string {
+	if str, ok := chainTipStatusStrings[s]; ok {
+		return str
+	}
+	return fmt.Sprintf("Unknown Chain Tip Status (%d)", int(s))
+}
+
+// ChainTip describes a block that no other known block builds on, along with the branch it ends.
+type ChainTip struct {
+	// Hash is the hash of the tip block.
+	Hash chainhash.Hash
+	// Height is the height of the tip block.
+	Height int32
+	// BranchLen is the number of blocks from the point where the branch forks from the main chain to the tip. It is
+	// zero for the tip of the main chain.
+	BranchLen int32
+	// Status is the state of the branch.
+	Status ChainTipStatus
+}
+
+// ChainTips returns every tip known to the block index, the tip of the main chain first followed by the side chain tips
+// ordered by descending height.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ChainTips() []ChainTip {
+	b.ChainLock.RLock()
+	defer b.ChainLock.RUnlock()
+	bestTip := b.BestChain.Tip()
+	tips := []ChainTip{{Hash: bestTip.hash, Height: bestTip.height, Status: ChainTipActive}}
+	nodes := b.Index.Tips()
+	sort.Slice(
+		nodes, func(i, j int) bool {
+			return nodes[i].height > nodes[j].height
+		},
+	)
+	for _, node := range nodes {
+		if node == bestTip {
+			continue
+		}
+		fork := b.BestChain.FindFork(node)
+		tip := ChainTip{Hash: node.hash, Height: node.height, BranchLen: node.height}
+		if fork != nil {
+			tip.BranchLen = node.height - fork.height
+		}
+		tip.Status = b.branchStatus(node, fork)
+		tips = append(tips, tip)
+	}
+	return tips
+}
+
+// branchStatus returns the status of the side chain from the given tip back to, but not including, the fork point.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) branchStatus(tip, fork *BlockNode) ChainTipStatus {
+	status := ChainTipValidFork
+	for n := tip; n != nil && n != fork; n = n.parent {
+		nodeStatus := b.Index.NodeStatus(n)
+		switch {
+		case nodeStatus.KnownInvalid():
+			return ChainTipInvalid
+		case nodeStatus.ReorgRefused():
+			return ChainTipReorgRefused
+		case !nodeStatus.HaveData():
+			status = ChainTipHeadersOnly
+		case !nodeStatus.KnownValid() && status == ChainTipValidFork:
+			status = ChainTipValidHeaders
+		}
+	}
+	return status
+}
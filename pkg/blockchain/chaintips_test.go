@@ -0,0 +1,75 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
+)
+
+// TestChainTips ensures the chain tips are tracked as nodes are added to the block index and reported with the
+// expected branch length and status.
+func TestChainTips(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of the following structure.
+	//
+	// 	genesis -> 1 -> 2 -> 3 -> 4  -> 5
+	// 	                |    |    \-> 5a (invalid)
+	// 	                |    \-> 4b -> 5b (validated)
+	// 	                \-> 3c (header only)
+	tip := tstTip
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	branch0Nodes := chainedNodes(chain.BestChain.Genesis(), 5)
+	branchANodes := chainedNodes(branch0Nodes[3], 1)
+	branchBNodes := chainedNodes(branch0Nodes[2], 2)
+	branchCNodes := chainedNodes(branch0Nodes[1], 1)
+	for _, node := range branch0Nodes {
+		chain.Index.SetStatusFlags(node, statusDataStored|statusValid)
+		chain.Index.AddNode(node)
+	}
+	chain.Index.SetStatusFlags(branchANodes[0], statusDataStored|statusValidateFailed)
+	chain.Index.AddNode(branchANodes[0])
+	for _, node := range branchBNodes {
+		chain.Index.SetStatusFlags(node, statusDataStored|statusValid)
+		chain.Index.AddNode(node)
+	}
+	chain.Index.AddNode(branchCNodes[0])
+	chain.BestChain.SetTip(tip(branch0Nodes))
+	tips := chain.ChainTips()
+	if len(tips) != 4 {
+		t.Fatalf("ChainTips: got %d tips, want 4", len(tips))
+	}
+	want := map[ChainTipStatus]struct {
+		node      *BlockNode
+		branchLen int32
+	}{
+		ChainTipActive:      {branch0Nodes[4], 0},
+		ChainTipInvalid:     {branchANodes[0], 1},
+		ChainTipValidFork:   {branchBNodes[1], 2},
+		ChainTipHeadersOnly: {branchCNodes[0], 1},
+	}
+	if tips[0].Status != ChainTipActive {
+		t.Fatalf("ChainTips: first tip has status %v, want %v", tips[0].Status, ChainTipActive)
+	}
+	for _, got := range tips {
+		w, ok := want[got.Status]
+		if !ok {
+			t.Fatalf("ChainTips: unexpected status %v", got.Status)
+		}
+		if got.Hash != w.node.hash || got.Height != w.node.height || got.BranchLen != w.branchLen {
+			t.Fatalf(
+				"ChainTips: %v tip is %v height %d branch %d, want %v height %d branch %d",
+				got.Status, got.Hash, got.Height, got.BranchLen, w.node.hash, w.node.height, w.branchLen,
+			)
+		}
+	}
+	// Extending a side chain replaces its tip.
+	extended := chainedNodes(branchBNodes[1], 1)
+	chain.Index.AddNode(extended[0])
+	for _, got := range chain.ChainTips() {
+		if got.Hash == branchBNodes[1].hash {
+			t.Fatalf("ChainTips: extended tip %v is still reported", got.Hash)
+		}
+		if got.Hash == extended[0].hash && (got.Status != ChainTipHeadersOnly || got.BranchLen != 3) {
+			t.Fatalf("ChainTips: new tip has status %v branch %d", got.Status, got.BranchLen)
+		}
+	}
+}
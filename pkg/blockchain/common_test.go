@@ -9,20 +9,24 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"testing"
 	"time"
 	
+	"github.com/p9c/parallelcoin/pkg/bits"
 	"github.com/p9c/parallelcoin/pkg/chaincfg"
 	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/fork"
 	"github.com/p9c/parallelcoin/pkg/txscript"
+	"github.com/p9c/parallelcoin/pkg/util"
 	
 	"github.com/p9c/parallelcoin/pkg/database"
-	_ "github.com/p9c/parallelcoin/pkg/database/ffldb"
+	_ "github.com/p9c/parallelcoin/pkg/database/memdb"
 	"github.com/p9c/parallelcoin/pkg/wire"
 )
 
 const (
 	// testDbType is the database backend type to use for the tests.
-	testDbType = "ffldb"
+	testDbType = "memdb"
 	// testDbRoot is the root directory used to create all test databases.
 	testDbRoot = "testdbs"
 	// blockDataNet is the expected network in the test block data.
@@ -332,6 +336,8 @@ func newFakeChain(params *chaincfg.Params) *BlockChain {
 		blocksPerRetarget:   int32(targetTimespan / targetTimePerBlock),
 		Index:               index,
 		BestChain:           newChainView(node),
+		powHashes:           newPowHashCache(),
+		rejects:             newRejectLog(0),
 	}
 }
 
@@ -347,3 +353,86 @@ func newFakeNode(parent *BlockNode, blockVersion int32, bits uint32, timestamp t
 	}
 	return NewBlockNode(header, parent)
 }
+
+// tstEasyParams returns regression test parameters whose SHA256d blocks before the hard fork can be mined instantly.
+// The genesis hash is set to the hash of the genesis block, which the regression test parameters do not have, so that
+// a chain database created with them can be loaded again.
+func tstEasyParams(t *testing.T) *chaincfg.Params {
+	params := chaincfg.RegressionTestParams
+	genesisHash := params.GenesisBlock.BlockHash()
+	params.GenesisHash = &genesisHash
+	params.Forks = fork.MainNetSchedule()
+	sha := params.Forks.Forks[0].Algos[fork.SHA256d]
+	sha.MinBits = 0x207fffff
+	params.Forks.Forks[0].Algos[fork.SHA256d] = sha
+	if e := params.Forks.Init(); e != nil {
+		t.Fatal(e)
+	}
+	return &params
+}
+
+// tstMineBlock processes a SHA256d block on the tip of the main chain holding a coinbase paying to OP_TRUE followed by
+// the given transactions, and returns it.
+func tstMineBlock(t *testing.T, chain *BlockChain, txs ...*wire.MsgTx) *block.Block {
+	blk := tstMineBlockOn(t, chain, chain.BestChain.Tip(), 0, txs...)
+	if chain.BestChain.Tip().hash != *blk.Hash() {
+		t.Fatalf("block at height %d did not become the tip", blk.Height())
+	}
+	return blk
+}
+
+// tstMineBlockOn processes a SHA256d block on the given parent holding a coinbase paying to OP_TRUE followed by the
+// given transactions, and returns it. The tag is put in the coinbase, so blocks on the same parent differ.
+func tstMineBlockOn(t *testing.T, chain *BlockChain, tip *BlockNode, tag byte, txs ...*wire.MsgTx) *block.Block {
+	height := tip.height + 1
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(
+		&wire.TxIn{
+			PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex),
+			SignatureScript:  []byte{txscript.OP_DATA_4, byte(height), byte(height >> 8), byte(height >> 16), tag},
+			Sequence:         wire.MaxTxInSequenceNum,
+		},
+	)
+	coinbase.AddTxOut(wire.NewTxOut(CalcBlockSubsidy(height, chain.params, 2), []byte{txscript.OP_TRUE}))
+	msgBlock := &wire.Block{
+		Header: wire.BlockHeader{
+			Version:   2,
+			PrevBlock: tip.hash,
+			Timestamp: time.Unix(tip.timestamp+1, 0),
+		},
+		Transactions: append([]*wire.MsgTx{coinbase}, txs...),
+	}
+	var e error
+	if msgBlock.Header.Bits, e = chain.CalcNextRequiredDifficultyFromNode(tip, fork.SHA256d, true); e != nil {
+		t.Fatal(e)
+	}
+	utilTxs := make([]*util.Tx, len(msgBlock.Transactions))
+	for i, tx := range msgBlock.Transactions {
+		utilTxs[i] = util.NewTx(tx)
+	}
+	msgBlock.Header.MerkleRoot = *BuildMerkleTreeStore(utilTxs, false).GetRoot()
+	target := bits.CompactToBig(msgBlock.Header.Bits)
+	for ; ; msgBlock.Header.Nonce++ {
+		hash := msgBlock.Header.BlockHashWithAlgos(height, chain.params.Forks)
+		if checkPowHash(&hash, target, height) == nil {
+			break
+		}
+	}
+	blk := block.NewBlock(msgBlock)
+	if _, _, e = chain.ProcessBlock(0, blk, BFNone, height); e != nil {
+		t.Fatalf("ProcessBlock at height %d: %v", height, e)
+	}
+	blk.SetHeight(height)
+	return blk
+}
+
+// tstSpendTx returns a transaction spending the first output of the given coinbase to two OP_TRUE outputs.
+func tstSpendTx(coinbase *wire.MsgTx) *wire.MsgTx {
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, 0), nil, nil))
+	tx.TxIn[0].PreviousOutPoint.Hash = coinbase.TxHash()
+	value := coinbase.TxOut[0].Value / 2
+	tx.AddTxOut(wire.NewTxOut(value, []byte{txscript.OP_TRUE}))
+	tx.AddTxOut(wire.NewTxOut(value-1000, []byte{txscript.OP_TRUE}))
+	return tx
+}
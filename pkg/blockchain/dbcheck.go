@@ -0,0 +1,458 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/p9c/parallelcoin/pkg/block"
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// DbProblemKind is the part of the database of a chain that a problem found by CheckDatabase is in.
+type DbProblemKind int
+
+const (
+	// DbProblemMetadata is a bucket or entry of the chain metadata that is missing or malformed.
+	DbProblemMetadata DbProblemKind = iota
+	// DbProblemMainChain is a block of the main chain that is missing from the height, hash or block index, or that
+	// they disagree about.
+	DbProblemMainChain
+	// DbProblemBlockData is a block the block index says is stored whose data is missing or damaged.
+	DbProblemBlockData
+	// DbProblemSpendJournal is a block of the main chain whose spend journal entry is missing or damaged.
+	DbProblemSpendJournal
+)
+
+// dbProblemKindStrings is a map of database problem kinds back to their constant names for pretty printing.
+var dbProblemKindStrings = map[DbProblemKind]string{
+	DbProblemMetadata:     "metadata",
+	DbProblemMainChain:    "main chain",
+	DbProblemBlockData:    "block data",
+	DbProblemSpendJournal: "spend journal",
+}
+
+// String returns the DbProblemKind as a human-readable name.
+func (k DbProblemKind) String() string {
+	if s := dbProblemKindStrings[k]; s != "" {
+		return s
+	}
+	return fmt.Sprintf("Unknown DbProblemKind (%d)", int(k))
+}
+
+// DbProblem is a problem CheckDatabase found with the database of a chain.
+type DbProblem struct {
+	Kind DbProblemKind
+	// Hash and Height are the block the problem is with. Hash is nil for problems that are not with a block, and
+	// Height is -1 when it is not known.
+	Hash   *chainhash.Hash
+	Height int32
+	Err    error
+	// Repaired is whether the problem was repaired.
+	Repaired bool
+}
+
+// String returns a description of the problem.
+func (p *DbProblem) String() string {
+	s := p.Kind.String() + ": "
+	if p.Hash != nil {
+		s += fmt.Sprintf("block %v at height %d: ", p.Hash, p.Height)
+	}
+	s += p.Err.Error()
+	if p.Repaired {
+		s += " (repaired)"
+	}
+	return s
+}
+
+// CheckConfig is the configuration of CheckDatabase.
+type CheckConfig struct {
+	// Pruned is set when the chain is run with a prune target, which removes the spend journal entries of the blocks
+	// buried deeper than PruneDepth. It is implied when the database has blocks that were pruned.
+	Pruned bool
+	// Truncate repairs damaged block data by removing the damaged blocks from the database, when the database can check
+	// its own block storage, and marking them as pruned in the block index.
+	Truncate bool
+	// Rebuild repairs missing and damaged spend journal entries of the main chain by rebuilding them from the block
+	// data.
+	Rebuild bool
+	// Interrupt stops the check when it is closed.
+	Interrupt <-chan struct{}
+}
+
+// CheckDatabase checks the database of a chain without loading the chain and returns the problems found. It checks the
+// metadata buckets and entries of the chain exist, that the stored data of every block the block index says is stored
+// can be read back intact, that the height, hash and block indexes agree on every block of the main chain, and that
+// each block of the main chain has a spend journal entry that matches the block.
+//
+// Damaged block data and spend journal entries are repaired as set in the configuration. Other problems are only
+// reported.
+func CheckDatabase(db database.DB, cfg *CheckConfig) (problems []DbProblem, e error) {
+	// Let the database check its own block storage first, so the damaged blocks are known when the block index is
+	// walked.
+	damaged := make(map[chainhash.Hash]*database.BlockProblem)
+	checker, canCheck := db.(database.BlockChecker)
+	if canCheck {
+		I.Ln("checking the stored blocks")
+		var blockProblems []database.BlockProblem
+		if blockProblems, e = checker.CheckBlocks(cfg.Truncate, cfg.Interrupt); E.Chk(e) {
+			return nil, e
+		}
+		for i := range blockProblems {
+			damaged[blockProblems[i].Hash] = &blockProblems[i]
+		}
+	}
+	if interruptRequested(cfg.Interrupt) {
+		return nil, errInterruptRequested
+	}
+	c := &dbChecker{cfg: cfg, damaged: damaged, fetchBlocks: !canCheck}
+	if e = db.View(c.check); E.Chk(e) {
+		return nil, e
+	}
+	// Blocks the database found damaged that the block index does not know about are reported on their own.
+	for hash, p := range damaged {
+		if c.seen[hash] {
+			continue
+		}
+		hash := hash
+		c.problems = append(
+			c.problems, DbProblem{
+				Kind: DbProblemBlockData, Hash: &hash, Height: -1, Err: p.Err, Repaired: p.Repaired,
+			},
+		)
+	}
+	if cfg.Truncate && len(c.prune) > 0 {
+		if e = db.Update(c.markPruned); E.Chk(e) {
+			return c.problems, e
+		}
+	}
+	if cfg.Rebuild && len(c.rebuild) > 0 {
+		c.rebuildSpendJournals(db)
+	}
+	return c.problems, nil
+}
+
+// dbChecker holds the state of CheckDatabase.
+type dbChecker struct {
+	cfg     *CheckConfig
+	damaged map[chainhash.Hash]*database.BlockProblem
+	// fetchBlocks is set when the database can not check its own block storage, so each block is read back instead.
+	fetchBlocks bool
+	problems    []DbProblem
+	// seen holds the blocks in the block index that the database found damaged.
+	seen map[chainhash.Hash]bool
+	// prune holds the keys and rows of the block index entries of the blocks with damaged block data, and rebuild the
+	// problems of the spend journal entries to rebuild.
+	prune   []prunedRow
+	rebuild []int
+	pruned  bool
+}
+
+// prunedRow is a block index entry to mark as pruned along with the problem it repairs.
+type prunedRow struct {
+	key, row []byte
+	problem  int
+}
+
+// add records a problem and returns its index.
+func (c *dbChecker) add(kind DbProblemKind, hash *chainhash.Hash, height int32, e error) int {
+	c.problems = append(c.problems, DbProblem{Kind: kind, Hash: hash, Height: height, Err: e})
+	return len(c.problems) - 1
+}
+
+// check checks the metadata, the block index and the main chain.
+func (c *dbChecker) check(dbTx database.Tx) (e error) {
+	meta := dbTx.Metadata()
+	missing := false
+	for _, name := range [][]byte{
+		blockIndexBucketName, hashIndexBucketName, heightIndexBucketName, spendJournalBucketName, utxoSetBucketName,
+	} {
+		if meta.Bucket(name) == nil {
+			c.add(DbProblemMetadata, nil, -1, fmt.Errorf("bucket %s is missing", name))
+			missing = true
+		}
+	}
+	for _, name := range [][]byte{blockIndexVersionKeyName, spendJournalVersionKeyName, utxoSetVersionKeyName} {
+		if v := meta.Get(name); len(v) != 4 {
+			c.add(DbProblemMetadata, nil, -1, fmt.Errorf("entry %s is missing or malformed", name))
+		}
+	}
+	var state bestChainState
+	if serialized := meta.Get(chainStateKeyName); serialized == nil {
+		c.add(DbProblemMetadata, nil, -1, fmt.Errorf("entry %s is missing", chainStateKeyName))
+		missing = true
+	} else if state, e = deserializeBestChainState(serialized); e != nil {
+		c.add(DbProblemMetadata, nil, -1, fmt.Errorf("entry %s is malformed: %v", chainStateKeyName, e))
+		missing = true
+	}
+	if missing {
+		// Without the indexes and the tip of the chain there is nothing to walk.
+		return nil
+	}
+	if c.pruned, e = dbTx.BeenPruned(); E.Chk(e) {
+		return e
+	}
+	c.pruned = c.pruned || c.cfg.Pruned
+	if e = c.checkBlockIndex(dbTx); e != nil {
+		return e
+	}
+	return c.checkMainChain(dbTx, int32(state.height), &state.hash)
+}
+
+// checkBlockIndex checks every entry of the block index can be decoded and that the data of the blocks it says are
+// stored is there and intact.
+func (c *dbChecker) checkBlockIndex(dbTx database.Tx) (e error) {
+	c.seen = make(map[chainhash.Hash]bool)
+	n := 0
+	return dbTx.Metadata().Bucket(blockIndexBucketName).ForEach(
+		func(k, v []byte) (e error) {
+			if n++; n%10000 == 0 {
+				if interruptRequested(c.cfg.Interrupt) {
+					return errInterruptRequested
+				}
+				I.F("checked %d blocks in the block index", n)
+			}
+			if len(k) != chainhash.HashSize+4 {
+				c.add(DbProblemMetadata, nil, -1, fmt.Errorf("block index key %x is malformed", k))
+				return nil
+			}
+			var hash chainhash.Hash
+			copy(hash[:], k[4:])
+			height := int32(binary.BigEndian.Uint32(k[:4]))
+			var status blockStatus
+			if _, status, _, _, e = deserializeBlockRow(v); e != nil {
+				c.add(DbProblemMetadata, &hash, height, fmt.Errorf("block index entry is malformed: %v", e))
+				return nil
+			}
+			if status.Pruned() {
+				c.pruned = true
+			}
+			if !status.HaveData() || status.Pruned() {
+				return nil
+			}
+			var problem error
+			if p, ok := c.damaged[hash]; ok {
+				c.seen[hash] = true
+				problem = p.Err
+			} else if c.fetchBlocks {
+				_, problem = dbTx.FetchBlock(&hash)
+			} else {
+				var has bool
+				if has, e = dbTx.HasBlock(&hash); E.Chk(e) {
+					return e
+				}
+				if !has {
+					problem = fmt.Errorf("the block is not stored")
+				}
+			}
+			if problem != nil {
+				i := c.add(DbProblemBlockData, &hash, height, problem)
+				key := make([]byte, len(k))
+				copy(key, k)
+				row := make([]byte, len(v))
+				copy(row, v)
+				c.prune = append(c.prune, prunedRow{key: key, row: row, problem: i})
+			}
+			return nil
+		},
+	)
+}
+
+// checkMainChain checks the height, hash and block indexes agree on every block of the main chain up to the tip, and
+// that the blocks have spend journal entries that match them.
+func (c *dbChecker) checkMainChain(dbTx database.Tx, tipHeight int32, tipHash *chainhash.Hash) (e error) {
+	meta := dbTx.Metadata()
+	hashIndex := meta.Bucket(hashIndexBucketName)
+	blockIndex := meta.Bucket(blockIndexBucketName)
+	spendJournal := meta.Bucket(spendJournalBucketName)
+	for height := int32(0); height <= tipHeight; height++ {
+		if height%10000 == 0 {
+			if interruptRequested(c.cfg.Interrupt) {
+				return errInterruptRequested
+			}
+			if height > 0 {
+				I.F("checked the main chain up to height %d of %d", height, tipHeight)
+			}
+		}
+		var hash *chainhash.Hash
+		if hash, e = dbFetchHashByHeight(dbTx, height); e != nil {
+			c.add(DbProblemMainChain, nil, height, fmt.Errorf("height %d is missing from the height index", height))
+			continue
+		}
+		if serialized := hashIndex.Get(hash[:]); len(serialized) != 4 {
+			c.add(DbProblemMainChain, hash, height, fmt.Errorf("the block is missing from the hash index"))
+		} else if h := int32(byteOrder.Uint32(serialized)); h != height {
+			c.add(DbProblemMainChain, hash, height, fmt.Errorf("the hash index has the block at height %d", h))
+		}
+		row := blockIndex.Get(blockIndexKey(hash, uint32(height)))
+		if row == nil {
+			c.add(DbProblemMainChain, hash, height, fmt.Errorf("the block is missing from the block index"))
+			continue
+		}
+		if height == tipHeight && !hash.IsEqual(tipHash) {
+			c.add(DbProblemMainChain, hash, height, fmt.Errorf("the chain state has tip %v", tipHash))
+		}
+		// The genesis block is never connected so it has no spend journal entry, and a pruned chain only keeps the
+		// entries of the blocks that can still be disconnected.
+		if height == 0 || (c.pruned && height <= tipHeight-PruneDepth) {
+			continue
+		}
+		serialized := spendJournal.Get(hash[:])
+		if serialized == nil {
+			c.rebuild = append(
+				c.rebuild, c.add(DbProblemSpendJournal, hash, height, fmt.Errorf("the spend journal entry is missing")),
+			)
+			continue
+		}
+		// The entry can only be decoded with the transactions of the block.
+		var status blockStatus
+		if _, status, _, _, e = deserializeBlockRow(row); e != nil || !status.HaveData() || status.Pruned() {
+			continue
+		}
+		if _, ok := c.damaged[*hash]; ok {
+			continue
+		}
+		var blk *block.Block
+		if blk, e = dbFetchBlockByNode(dbTx, &BlockNode{hash: *hash, height: height}); e != nil {
+			continue
+		}
+		if _, e = deserializeSpendJournalEntry(serialized, blk.WireBlock().Transactions[1:]); e != nil {
+			c.rebuild = append(
+				c.rebuild, c.add(DbProblemSpendJournal, hash, height, fmt.Errorf("the spend journal entry is damaged: %v", e)),
+			)
+		}
+	}
+	return nil
+}
+
+// markPruned marks the blocks with damaged block data as pruned in the block index, the same as blocks removed by
+// pruning.
+func (c *dbChecker) markPruned(dbTx database.Tx) (e error) {
+	blockIndex := dbTx.Metadata().Bucket(blockIndexBucketName)
+	for _, p := range c.prune {
+		status := blockStatus(p.row[blockHdrSize])
+		p.row[blockHdrSize] = byte(status&^statusDataStored | statusDataPruned)
+		if e = blockIndex.Put(p.key, p.row); E.Chk(e) {
+			return e
+		}
+		c.problems[p.problem].Repaired = true
+	}
+	I.F("marked %d blocks with damaged block data as pruned", len(c.prune))
+	return nil
+}
+
+// rebuildSpendJournals rebuilds the spend journal entries of the main chain blocks that are missing or damaged from the
+// block data, finding the outputs each block spends by reading the main chain from the genesis block up to it. The
+// problems that could not be repaired are updated with the reason.
+func (c *dbChecker) rebuildSpendJournals(db database.DB) {
+	// Find the outputs spent by the blocks to rebuild the entries of, and up to which height they can have been created.
+	type rebuilt struct {
+		problem int
+		blk     *block.Block
+	}
+	var blocks []rebuilt
+	spent := make(map[wire.OutPoint]*SpentTxOut)
+	var maxHeight int32
+	failed := func(problem int, e error) {
+		p := &c.problems[problem]
+		p.Err = fmt.Errorf("%v, and it can not be rebuilt: %v", p.Err, e)
+	}
+	e := db.View(
+		func(dbTx database.Tx) (e error) {
+			for _, i := range c.rebuild {
+				p := &c.problems[i]
+				var blk *block.Block
+				if blk, e = dbFetchBlockByNode(dbTx, &BlockNode{hash: *p.Hash, height: p.Height}); e != nil {
+					failed(i, e)
+					continue
+				}
+				for _, tx := range blk.WireBlock().Transactions[1:] {
+					for _, txIn := range tx.TxIn {
+						spent[txIn.PreviousOutPoint] = nil
+					}
+				}
+				blocks = append(blocks, rebuilt{problem: i, blk: blk})
+				if p.Height > maxHeight {
+					maxHeight = p.Height
+				}
+			}
+			if len(blocks) == 0 {
+				return nil
+			}
+			I.F("reading the main chain up to height %d to rebuild %d spend journal entries", maxHeight, len(blocks))
+			for height := int32(0); height <= maxHeight; height++ {
+				if interruptRequested(c.cfg.Interrupt) {
+					return errInterruptRequested
+				}
+				var hash *chainhash.Hash
+				if hash, e = dbFetchHashByHeight(dbTx, height); e != nil {
+					return e
+				}
+				var blk *block.Block
+				if blk, e = dbFetchBlockByNode(dbTx, &BlockNode{hash: *hash, height: height}); e != nil {
+					return fmt.Errorf("block %v at height %d can not be read: %v", hash, height, e)
+				}
+				for txIdx, tx := range blk.Transactions() {
+					for outIdx, txOut := range tx.MsgTx().TxOut {
+						outPoint := wire.OutPoint{Hash: *tx.Hash(), Index: uint32(outIdx)}
+						if stxo, ok := spent[outPoint]; ok && stxo == nil {
+							spent[outPoint] = &SpentTxOut{
+								Amount:     txOut.Value,
+								PkScript:   txOut.PkScript,
+								Height:     height,
+								IsCoinBase: txIdx == 0,
+							}
+						}
+					}
+				}
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		for i := range blocks {
+			failed(blocks[i].problem, e)
+		}
+		return
+	}
+	e = db.Update(
+		func(dbTx database.Tx) (e error) {
+			for _, r := range blocks {
+				var stxos []SpentTxOut
+				complete := true
+				for _, tx := range r.blk.WireBlock().Transactions[1:] {
+					for _, txIn := range tx.TxIn {
+						stxo := spent[txIn.PreviousOutPoint]
+						if stxo == nil {
+							failed(r.problem, fmt.Errorf("the output %v it spends is not in the main chain", txIn.PreviousOutPoint))
+							complete = false
+							break
+						}
+						stxos = append(stxos, *stxo)
+					}
+					if !complete {
+						break
+					}
+				}
+				if !complete {
+					continue
+				}
+				if e = dbPutSpendJournalEntry(dbTx, r.blk.Hash(), stxos); E.Chk(e) {
+					return e
+				}
+				c.problems[r.problem].Repaired = true
+			}
+			return nil
+		},
+	)
+	if E.Chk(e) {
+		for i := range blocks {
+			if !c.problems[blocks[i].problem].Repaired {
+				continue
+			}
+			c.problems[blocks[i].problem].Repaired = false
+			failed(blocks[i].problem, e)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/p9c/parallelcoin/pkg/database"
+)
+
+// TestCheckDatabase ensures CheckDatabase passes a valid chain, reports missing and damaged spend journal entries and
+// index entries, and rebuilds the spend journal entries from the block data.
+func TestCheckDatabase(t *testing.T) {
+	chain, teardown, e := chainSetup("checkdatabase", tstEasyParams(t))
+	if e != nil {
+		t.Fatalf("failed to setup chain instance: %v", e)
+	}
+	defer teardown()
+	chain.TstSetCoinbaseMaturity(1)
+	first := tstMineBlock(t, chain)
+	second := tstMineBlock(t, chain)
+	spender := tstMineBlock(t, chain, tstSpendTx(first.WireBlock().Transactions[0]))
+	other := tstMineBlock(t, chain, tstSpendTx(second.WireBlock().Transactions[0]))
+	tstMineBlock(t, chain)
+	var problems []DbProblem
+	if problems, e = CheckDatabase(chain.db, &CheckConfig{}); e != nil || len(problems) != 0 {
+		t.Fatalf("CheckDatabase: got %v, %v on a valid chain, want no problems", problems, e)
+	}
+	interrupt := make(chan struct{})
+	close(interrupt)
+	if _, e = CheckDatabase(chain.db, &CheckConfig{Interrupt: interrupt}); e != errInterruptRequested {
+		t.Fatalf("CheckDatabase: got %v after an interrupt, want %v", e, errInterruptRequested)
+	}
+	// Remove the spend journal entry of one spending block and damage the other.
+	e = chain.db.Update(
+		func(dbTx database.Tx) (e error) {
+			spendJournal := dbTx.Metadata().Bucket(spendJournalBucketName)
+			if e = spendJournal.Delete(spender.Hash()[:]); e != nil {
+				return e
+			}
+			return spendJournal.Put(other.Hash()[:], []byte{0xff})
+		},
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if problems, e = CheckDatabase(chain.db, &CheckConfig{}); e != nil {
+		t.Fatalf("CheckDatabase: %v", e)
+	}
+	if len(problems) != 2 {
+		t.Fatalf("CheckDatabase: got %d problems %v, want 2", len(problems), problems)
+	}
+	for _, p := range problems {
+		if p.Kind != DbProblemSpendJournal || p.Repaired {
+			t.Fatalf("CheckDatabase: got problem %v, want an unrepaired spend journal problem", p.String())
+		}
+	}
+	if *problems[0].Hash != *spender.Hash() || *problems[1].Hash != *other.Hash() {
+		t.Fatalf("CheckDatabase: got problems with blocks %v and %v, want %v and %v", problems[0].Hash,
+			problems[1].Hash, spender.Hash(), other.Hash())
+	}
+	if problems, e = CheckDatabase(chain.db, &CheckConfig{Rebuild: true}); e != nil {
+		t.Fatalf("CheckDatabase: %v", e)
+	}
+	for _, p := range problems {
+		if !p.Repaired {
+			t.Fatalf("CheckDatabase: problem %v was not repaired", p.String())
+		}
+	}
+	if problems, e = CheckDatabase(chain.db, &CheckConfig{}); e != nil || len(problems) != 0 {
+		t.Fatalf("CheckDatabase: got %v, %v after rebuilding, want no problems", problems, e)
+	}
+	// The rebuilt entries must restore the spent outputs when the blocks are disconnected.
+	if e = chain.VerifyChain(VerifyReconnect, 0, nil); e != nil {
+		t.Fatalf("VerifyChain: %v after rebuilding the spend journal", e)
+	}
+	// Remove the second block from the hash index.
+	e = chain.db.Update(
+		func(dbTx database.Tx) error {
+			return dbTx.Metadata().Bucket(hashIndexBucketName).Delete(second.Hash()[:])
+		},
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if problems, e = CheckDatabase(chain.db, &CheckConfig{Rebuild: true}); e != nil {
+		t.Fatalf("CheckDatabase: %v", e)
+	}
+	if len(problems) != 1 || problems[0].Kind != DbProblemMainChain || *problems[0].Hash != *second.Hash() ||
+		problems[0].Height != 2 || problems[0].Repaired {
+		t.Fatalf("CheckDatabase: got %v with a missing hash index entry, want an unrepaired main chain problem", problems)
+	}
+}
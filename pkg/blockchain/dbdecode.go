@@ -0,0 +1,187 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/txscript"
+)
+
+// DecodeDbEntry returns readable forms of the key and value of an entry the chain writes to the metadata of the block
+// database, for tools that inspect a database. The bucket is the path of the bucket holding the entry from the top of
+// the metadata, which is empty for the top level entries.
+//
+// The decoded entries are those of the utxo set, the block index, the hash and height indexes, the spend journal, the
+// best chain state and the version of each of them. ok is false for any other entry, and an error is returned when the
+// entry is one the chain writes but does not decode, which means it is corrupt.
+func DecodeDbEntry(bucket [][]byte, key, value []byte) (k, v string, ok bool, e error) {
+	switch {
+	case len(bucket) == 0:
+		return decodeChainStateEntry(key, value)
+	case len(bucket) != 1:
+		return "", "", false, nil
+	case bytes.Equal(bucket[0], utxoSetBucketName):
+		return decodeUtxoEntry(key, value)
+	case bytes.Equal(bucket[0], blockIndexBucketName):
+		return decodeBlockIndexEntry(key, value)
+	case bytes.Equal(bucket[0], hashIndexBucketName):
+		if len(key) != chainhash.HashSize || len(value) != 4 {
+			return "", "", true, errDeserialize("unexpected length of hash index entry")
+		}
+		return hashString(key), fmt.Sprint(byteOrder.Uint32(value)), true, nil
+	case bytes.Equal(bucket[0], heightIndexBucketName):
+		if len(key) != 4 || len(value) != chainhash.HashSize {
+			return "", "", true, errDeserialize("unexpected length of height index entry")
+		}
+		return fmt.Sprint(byteOrder.Uint32(key)), hashString(value), true, nil
+	case bytes.Equal(bucket[0], spendJournalBucketName):
+		return decodeSpendJournalEntry(key, value)
+	}
+	return "", "", false, nil
+}
+
+// decodeChainStateEntry decodes the best chain state and the versions, which are kept at the top of the metadata.
+func decodeChainStateEntry(key, value []byte) (k, v string, ok bool, e error) {
+	switch {
+	case bytes.Equal(key, chainStateKeyName):
+		var state bestChainState
+		if state, e = deserializeBestChainState(value); E.Chk(e) {
+			return "", "", true, e
+		}
+		v = fmt.Sprintf(
+			"hash=%s height=%d txns=%d worksum=%s", state.hash, state.height, state.totalTxns, state.workSum,
+		)
+		if state.hasSupply {
+			v += fmt.Sprintf(" supply=%d", state.supply.utxo)
+		}
+		if state.hasIssuance {
+			v += fmt.Sprintf(
+				" mined=%d payees=%d devfund=%d burned=%d", state.supply.mined, state.supply.payees,
+				state.supply.devFund, state.supply.burned,
+			)
+		}
+		return string(key), v, true, nil
+	case bytes.Equal(key, blockIndexVersionKeyName),
+		bytes.Equal(key, spendJournalVersionKeyName),
+		bytes.Equal(key, utxoSetVersionKeyName):
+		if len(value) != 4 {
+			return "", "", true, errDeserialize("unexpected length of version")
+		}
+		return string(key), fmt.Sprint(byteOrder.Uint32(value)), true, nil
+	}
+	return "", "", false, nil
+}
+
+// decodeUtxoEntry decodes an entry of the utxo set, which is keyed by the outpoint of the output.
+func decodeUtxoEntry(key, value []byte) (k, v string, ok bool, e error) {
+	if len(key) <= chainhash.HashSize {
+		return "", "", true, errDeserialize("unexpected length of utxo key")
+	}
+	index, n := deserializeVLQ(key[chainhash.HashSize:])
+	if chainhash.HashSize+n != len(key) {
+		return "", "", true, errDeserialize("unexpected data after the index of utxo key")
+	}
+	k = fmt.Sprintf("%s:%d", hashString(key[:chainhash.HashSize]), index)
+	var entry *UtxoEntry
+	if entry, e = deserializeUtxoEntry(value); E.Chk(e) {
+		return "", "", true, e
+	}
+	v = fmt.Sprintf(
+		"amount=%d height=%d coinbase=%v script=%s", entry.Amount(), entry.BlockHeight(), entry.IsCoinBase(),
+		scriptString(entry.PkScript()),
+	)
+	return k, v, true, nil
+}
+
+// decodeBlockIndexEntry decodes an entry of the block index, which is keyed by the height and hash of the block.
+func decodeBlockIndexEntry(key, value []byte) (k, v string, ok bool, e error) {
+	if len(key) != chainhash.HashSize+4 {
+		return "", "", true, errDeserialize("unexpected length of block index key")
+	}
+	k = fmt.Sprintf("%d %s", binary.BigEndian.Uint32(key), hashString(key[4:]))
+	header, status, powHash, precious, e := deserializeBlockRow(value)
+	if E.Chk(e) {
+		return "", "", true, e
+	}
+	v = fmt.Sprintf(
+		"status=%s version=%d prev=%s merkle=%s time=%d bits=%08x nonce=%d",
+		statusString(status), header.Version, header.PrevBlock, header.MerkleRoot, header.Timestamp.Unix(),
+		header.Bits, header.Nonce,
+	)
+	if powHash != nil {
+		v += " pow=" + powHash.String()
+	}
+	if precious != 0 {
+		v += fmt.Sprintf(" precious=%d", precious)
+	}
+	return k, v, true, nil
+}
+
+// decodeSpendJournalEntry decodes an entry of the spend journal, which is keyed by the hash of the block. The outputs
+// spent by the block are listed in the order they are stored in, which is the reverse of the order they were spent in.
+func decodeSpendJournalEntry(key, value []byte) (k, v string, ok bool, e error) {
+	if len(key) != chainhash.HashSize {
+		return "", "", true, errDeserialize("unexpected length of spend journal key")
+	}
+	spent := make([]string, 0)
+	for offset := 0; offset < len(value); {
+		var stxo SpentTxOut
+		var n int
+		if n, e = decodeSpentTxOut(value[offset:], &stxo); E.Chk(e) {
+			return "", "", true, e
+		}
+		offset += n
+		spent = append(
+			spent, fmt.Sprintf(
+				"amount=%d height=%d coinbase=%v script=%s", stxo.Amount, stxo.Height, stxo.IsCoinBase,
+				scriptString(stxo.PkScript),
+			),
+		)
+	}
+	v = fmt.Sprintf("spent=%d [%s]", len(spent), strings.Join(spent, ", "))
+	return hashString(key), v, true, nil
+}
+
+// hashString returns a serialized hash in the byte order hashes are usually displayed in.
+func hashString(serialized []byte) string {
+	var hash chainhash.Hash
+	copy(hash[:], serialized)
+	return hash.String()
+}
+
+// scriptString returns the disassembly of a script, or its hex when it does not parse.
+func scriptString(script []byte) string {
+	disasm, e := txscript.DisasmString(script)
+	if e != nil {
+		return fmt.Sprintf("%x", script)
+	}
+	return "'" + disasm + "'"
+}
+
+// statusString returns the names of the flags of a block status separated by |, or none when there are none.
+func statusString(status blockStatus) string {
+	names := []struct {
+		flag blockStatus
+		name string
+	}{
+		{statusDataStored, "stored"},
+		{statusValid, "valid"},
+		{statusValidateFailed, "failed"},
+		{statusInvalidAncestor, "invalidancestor"},
+		{statusDataPruned, "pruned"},
+		{statusReorgRefused, "reorgrefused"},
+	}
+	var flags []string
+	for _, n := range names {
+		if status&n.flag != 0 {
+			flags = append(flags, n.name)
+		}
+	}
+	if len(flags) == 0 {
+		return "none"
+	}
+	return strings.Join(flags, "|")
+}
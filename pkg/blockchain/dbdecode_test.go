@@ -0,0 +1,107 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// TestDecodeDbEntry ensures the entries the chain writes are decoded and other entries are left alone.
+func TestDecodeDbEntry(t *testing.T) {
+	t.Parallel()
+	hash := chainhash.Hash{0x01}
+	utxoKey := *outpointKey(wire.OutPoint{Hash: hash, Index: 2})
+	utxoValue, e := serializeUtxoEntry(
+		&UtxoEntry{
+			amount:      5000,
+			pkScript:    []byte{0x51},
+			blockHeight: 12,
+			packedFlags: tfCoinBase,
+		},
+	)
+	if e != nil {
+		t.Fatalf("serializeUtxoEntry: %v", e)
+	}
+	var height [4]byte
+	byteOrder.PutUint32(height[:], 12)
+	tests := []struct {
+		name         string
+		bucket       [][]byte
+		key, value   []byte
+		wantK, wantV string
+		ok, err      bool
+	}{
+		{
+			name:   "utxo",
+			bucket: [][]byte{utxoSetBucketName},
+			key:    utxoKey,
+			value:  utxoValue,
+			wantK:  hash.String() + ":2",
+			wantV:  "amount=5000 height=12 coinbase=true script='1'",
+			ok:     true,
+		},
+		{
+			name:   "height index",
+			bucket: [][]byte{heightIndexBucketName},
+			key:    height[:],
+			value:  hash[:],
+			wantK:  "12",
+			wantV:  hash.String(),
+			ok:     true,
+		},
+		{
+			name: "chain state",
+			key:  chainStateKeyName,
+			value: serializeBestChainState(
+				bestChainState{
+					hash: hash, height: 12, totalTxns: 13, workSum: big.NewInt(14),
+					supply: supplyState{utxo: 15, mined: 16, payees: 17, devFund: 18, burned: 36},
+				},
+			),
+			wantK: "chainstate",
+			wantV: "hash=" + hash.String() +
+				" height=12 txns=13 worksum=14 supply=15 mined=16 payees=17 devfund=18 burned=36",
+			ok: true,
+		},
+		{
+			name:  "version",
+			key:   utxoSetVersionKeyName,
+			value: []byte{2, 0, 0, 0},
+			wantK: "utxosetversion",
+			wantV: "2",
+			ok:    true,
+		},
+		{
+			name:   "corrupt",
+			bucket: [][]byte{hashIndexBucketName},
+			key:    hash[:],
+			value:  []byte{1},
+			ok:     true,
+			err:    true,
+		},
+		{
+			name:   "other bucket",
+			bucket: [][]byte{[]byte("other")},
+			key:    []byte("key"),
+			value:  []byte("value"),
+		},
+		{
+			name:   "nested bucket",
+			bucket: [][]byte{utxoSetBucketName, []byte("nested")},
+			key:    utxoKey,
+			value:  utxoValue,
+		},
+	}
+	for _, test := range tests {
+		k, v, ok, e := DecodeDbEntry(test.bucket, test.key, test.value)
+		if ok != test.ok || (e != nil) != test.err {
+			t.Errorf("%s: got ok %v and error %v", test.name, ok, e)
+			continue
+		}
+		if k != test.wantK || v != test.wantV {
+			t.Errorf("%s: got %q %q, want %q %q", test.name, k, v, test.wantK, test.wantV)
+		}
+	}
+}
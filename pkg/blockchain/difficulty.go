@@ -3,7 +3,6 @@ package blockchain
 import (
 	"encoding/hex"
 	bits2 "github.com/p9c/parallelcoin/pkg/bits"
-	"github.com/p9c/parallelcoin/pkg/fork"
 	"math/big"
 	"strings"
 	"time"
@@ -36,7 +35,7 @@ func (b *BlockChain) CalcNextRequiredDifficulty(algo string) (difficulty uint32,
 			Tip(), algo, false,
 	)
 	// F.Ln("CalcNextRequiredDifficulty", difficulty)
-	b.ChainLock.Unlock()
+	b.unlockChain()
 	return
 }
 
@@ -73,8 +72,8 @@ func (b *BlockChain) CalcNextRequiredDifficultyFromNode(lastNode *BlockNode, alg
 	e error,
 ) {
 	nH := lastNode.height + 1
-	cF := fork.GetCurrent(nH)
-	newTargetBits = fork.GetMinBits(algoname, nH)
+	cF := b.params.Forks.GetCurrent(nH)
+	newTargetBits = b.params.Forks.GetMinBits(algoname, nH)
 	// Tracef("CalcNextRequiredDifficultyFromNode %08x", newTargetBits)
 	switch cF {
 	// Legacy difficulty adjustment
@@ -87,7 +86,7 @@ func (b *BlockChain) CalcNextRequiredDifficultyFromNode(lastNode *BlockNode, alg
 		if bits == nil || !ok {
 			lastNode.Diffs.Store(make(Diffs))
 		}
-		version := fork.GetAlgoVer(algoname, lastNode.height+1)
+		version := b.params.Forks.GetAlgoVer(algoname, lastNode.height+1)
 		if bits[version] == 0 {
 			bits, e = b.CalcNextRequiredDifficultyPlan9Controller(lastNode)
 			if e != nil  {
@@ -0,0 +1,351 @@
+package blockchain
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/p9c/parallelcoin/pkg/bits"
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
+	"github.com/p9c/parallelcoin/pkg/fork"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// DiffSimBlock is the outcome of running the difficulty adjustment for one block of a replayed or simulated chain.
+type DiffSimBlock struct {
+	// Height is the height of the block.
+	Height int32
+	// Algo is the name of the mining algorithm of the block.
+	Algo string
+	// Timestamp is the block time in seconds since the epoch.
+	Timestamp int64
+	// Interval is the number of seconds since the previous block.
+	Interval int64
+	// Bits is the target required for the block by the difficulty adjustment.
+	Bits uint32
+	// ChainBits is the target found in the block header. It is the same as Bits in a simulation and differs from it in
+	// a replay when the consensus rules that created the block differ from the current difficulty functions.
+	ChainBits uint32
+	// Adjustment is the ratio of Bits to the target of the previous block of the same algorithm. Values above 1 make
+	// blocks easier to find and values below 1 make them harder.
+	Adjustment float64
+}
+
+// DiffSimConfig is the configuration of a synthetic block arrival simulation.
+type DiffSimConfig struct {
+	// Fork is the number of the hard fork whose difficulty adjustment is simulated, 0 for Halcyon days and 1 for Plan 9
+	// from Crypto Space.
+	Fork int
+	// Blocks is the number of blocks to generate.
+	Blocks int32
+	// Hashrates is the hashes per second applied to each algorithm, keyed by algorithm name.
+	Hashrates map[string]float64
+	// Scale sets the hashrate of the algorithms that are not present in Hashrates as a multiple of the hashrate that finds
+	// blocks of the algorithm at its target spacing with the initial difficulty of the hard fork.
+	Scale float64
+	// Seed seeds the random source of block arrivals, so the same configuration produces the same chain.
+	Seed int64
+}
+
+// DiffSimTargetSpacing returns the number of seconds between blocks of the given algorithm that the difficulty
+// adjustment of the given hard fork of the schedule aims for.
+func DiffSimTargetSpacing(forks *fork.Schedule, forkNum int, algoName string) float64 {
+	hf := forks.Forks[forkNum]
+	if forkNum == 0 {
+		return float64(hf.TargetTimePerBlock) * float64(len(hf.Algos))
+	}
+	return float64(hf.Algos[algoName].VersionInterval)
+}
+
+// diffSimBaseHashrate returns the hashes per second with which blocks are found at the given target as often as the
+// difficulty adjustment of the given hard fork aims for with the given algorithm.
+func diffSimBaseHashrate(forks *fork.Schedule, forkNum int, algoName string, targetBits uint32) float64 {
+	return diffSimWork(targetBits) / DiffSimTargetSpacing(forks, forkNum, algoName)
+}
+
+// diffSimWork returns the expected number of hashes needed to find a block at the given target, which is infinite for a
+// target of zero or less as no hash can meet it.
+func diffSimWork(targetBits uint32) float64 {
+	if bits.CompactToBig(targetBits).Sign() <= 0 {
+		return math.Inf(1)
+	}
+	work, _ := new(big.Float).SetInt(CalcWork(targetBits, 0, 0)).Float64()
+	return work
+}
+
+// ReplayDifficulty runs the current difficulty adjustment over the blocks of the main chain from the start height to
+// the end height inclusive, passing the result for each block to fn. An end height of zero or less replays to the tip.
+//
+// The chain lock is held exclusively for the whole replay, as the difficulty adjustment updates the difficulty state
+// shared with block processing, so fn must not call methods of the chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ReplayDifficulty(start, end int32, fn func(blk DiffSimBlock) error) (e error) {
+	b.ChainLock.Lock()
+	defer b.unlockChain()
+	// The Plan 9 controller records the height it last calculated for, which must not be left pointing at a replayed
+	// block.
+	defer b.DifficultyHeight.Store(b.DifficultyHeight.Load())
+	tip := b.BestChain.Tip()
+	if end <= 0 || end > tip.height {
+		end = tip.height
+	}
+	if start < 1 {
+		start = 1
+	}
+	for height := start; height <= end; height++ {
+		node := b.BestChain.NodeByHeight(height)
+		algoName := b.params.Forks.GetAlgoName(node.version, node.height)
+		var diffs Diffs
+		if diffs, e = b.CalcNextRequiredDifficultyPlan9Controller(node.parent); E.Chk(e) {
+			return e
+		}
+		required := diffs[b.params.Forks.GetAlgoVer(algoName, node.height)]
+		if e = fn(b.diffSimBlock(node, algoName, required)); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// SimulateDifficulty generates a chain of blocks on top of the genesis block of the given network, or on top of a
+// block at the activation height of the hard fork, where each block is found by the algorithm that wins a race between
+// random block arrivals at the configured hashrates and the targets set by the difficulty adjustment. The result for
+// each block is passed to fn.
+func SimulateDifficulty(params *chaincfg.Params, cfg DiffSimConfig, fn func(blk DiffSimBlock) error) (e error) {
+	forks := params.Forks
+	if cfg.Fork < 0 || cfg.Fork >= len(forks.Forks) {
+		return fmt.Errorf("there is no hard fork number %d", cfg.Fork)
+	}
+	hf := forks.Forks[cfg.Fork]
+	for name := range cfg.Hashrates {
+		if _, ok := hf.Algos[name]; !ok {
+			return fmt.Errorf("algorithm %s does not exist in hard fork %s", name, hf.Name)
+		}
+	}
+	b := &BlockChain{
+		params:                params,
+		DifficultyAdjustments: make(map[string]float64),
+	}
+	b.DifficultyBits.Store(make(Diffs))
+	last := NewBlockNode(&params.GenesisBlock.Header, nil)
+	if cfg.Fork > 0 {
+		last.height = hf.ActivationHeight
+	}
+	if forks.GetCurrent(last.height+1) != cfg.Fork {
+		return fmt.Errorf("hard fork %s is not active on %s", hf.Name, params.Name)
+	}
+	var initial Diffs
+	if initial, e = b.CalcNextRequiredDifficultyPlan9Controller(last); E.Chk(e) {
+		return e
+	}
+	// The algorithms are raced in order of version so the outcome only depends on the seed.
+	algos := make(AlgoList, 0, len(hf.Algos))
+	hashrates := make(map[string]float64)
+	for name, p := range hf.Algos {
+		algos = append(algos, Algo{Name: name, Params: p})
+		if rate, ok := cfg.Hashrates[name]; ok {
+			hashrates[name] = rate
+		} else {
+			hashrates[name] = diffSimBaseHashrate(forks, cfg.Fork, name, initial[p.Version]) * cfg.Scale
+		}
+	}
+	sort.Sort(algos)
+	rnd := rand.New(rand.NewSource(cfg.Seed))
+	clock := float64(last.timestamp)
+	for i := int32(0); i < cfg.Blocks; i++ {
+		diffs := initial
+		if i > 0 {
+			if diffs, e = b.CalcNextRequiredDifficultyPlan9Controller(last); E.Chk(e) {
+				return e
+			}
+		}
+		// Block arrivals for each algorithm are a Poisson process, so the time until the next block of each is
+		// exponentially distributed with a mean of the expected hashes at the target divided by the hashrate.
+		winner, wait := -1, math.Inf(1)
+		for j := range algos {
+			rate := hashrates[algos[j].Name]
+			if rate <= 0 {
+				continue
+			}
+			if t := rnd.ExpFloat64() * diffSimWork(diffs[algos[j].Params.Version]) / rate; t < wait {
+				winner, wait = j, t
+			}
+		}
+		if winner < 0 {
+			return fmt.Errorf("no algorithm can find block %d", last.height+1)
+		}
+		clock += wait
+		header := wire.BlockHeader{
+			Version:   algos[winner].Params.Version,
+			PrevBlock: last.hash,
+			Timestamp: time.Unix(int64(clock), 0),
+			Bits:      diffs[algos[winner].Params.Version],
+			Nonce:     uint32(i),
+		}
+		node := NewBlockNode(&header, last)
+		if e = fn(b.diffSimBlock(node, algos[winner].Name, header.Bits)); e != nil {
+			return e
+		}
+		last = node
+	}
+	return nil
+}
+
+// diffSimBlock returns the replay or simulation result of the given node with the given required target.
+func (b *BlockChain) diffSimBlock(node *BlockNode, algoName string, required uint32) DiffSimBlock {
+	blk := DiffSimBlock{
+		Height:     node.height,
+		Algo:       algoName,
+		Timestamp:  node.timestamp,
+		Bits:       required,
+		ChainBits:  node.bits,
+		Adjustment: 1,
+	}
+	if node.parent == nil {
+		return blk
+	}
+	blk.Interval = node.timestamp - node.parent.timestamp
+	forks := b.params.Forks
+	prevBits := forks.GetMinBits(algoName, node.height)
+	if prev := node.parent.GetLastWithAlgo(forks.GetAlgoVer(algoName, node.height), forks); prev != nil {
+		prevBits = prev.bits
+	}
+	blk.Adjustment = targetRatio(required, prevBits)
+	return blk
+}
+
+// targetRatio returns the target of the first compact difficulty bits divided by the target of the second.
+func targetRatio(newBits, oldBits uint32) float64 {
+	oldTarget := new(big.Float).SetInt(bits.CompactToBig(oldBits))
+	if oldTarget.Sign() <= 0 {
+		return 1
+	}
+	ratio, _ := new(big.Float).Quo(new(big.Float).SetInt(bits.CompactToBig(newBits)), oldTarget).Float64()
+	return ratio
+}
+
+// DiffSimAlgoStats collects the statistics of the blocks of one algorithm in a replayed or simulated chain.
+type DiffSimAlgoStats struct {
+	// Blocks is the number of blocks found with the algorithm.
+	Blocks int
+	// TargetSpacing is the number of seconds between blocks of the algorithm that the difficulty adjustment aims for.
+	TargetSpacing float64
+	// Mismatches is the number of blocks whose header target differs from the target required by the difficulty
+	// adjustment.
+	Mismatches int
+	// Reversals is the number of times the difficulty adjustment changed direction between consecutive blocks of the
+	// algorithm.
+	Reversals     int
+	spacingSum    int64
+	spacings      int
+	lastTimestamp int64
+	lastDirection int
+	adjustments   int
+	logAdjs       int
+	logAdjSum     float64
+	logAdjSquares float64
+}
+
+// MeanSpacing returns the average number of seconds between consecutive blocks of the algorithm.
+func (a *DiffSimAlgoStats) MeanSpacing() float64 {
+	if a.spacings == 0 {
+		return 0
+	}
+	return float64(a.spacingSum) / float64(a.spacings)
+}
+
+// Oscillation returns the fraction of the difficulty adjustments of the algorithm that reversed the direction of the
+// previous one. A controller that converges smoothly stays close to zero while one that overshoots approaches one.
+func (a *DiffSimAlgoStats) Oscillation() float64 {
+	if a.adjustments < 2 {
+		return 0
+	}
+	return float64(a.Reversals) / float64(a.adjustments-1)
+}
+
+// AdjustmentDeviation returns the standard deviation of the base 2 logarithm of the adjustment factors of the
+// algorithm, so a value of 1 means the target typically moves by a factor of two between blocks. Adjustments to a zero
+// target are left out.
+func (a *DiffSimAlgoStats) AdjustmentDeviation() float64 {
+	if a.logAdjs == 0 {
+		return 0
+	}
+	n := float64(a.logAdjs)
+	mean := a.logAdjSum / n
+	return math.Sqrt(math.Max(a.logAdjSquares/n-mean*mean, 0))
+}
+
+// DiffSimStats collects the statistics of a replayed or simulated chain.
+type DiffSimStats struct {
+	// Fork is the number of the hard fork whose target spacings are used.
+	Fork int
+	// Forks is the hard fork schedule the hard fork is found in.
+	Forks *fork.Schedule
+	// Blocks is the number of blocks.
+	Blocks int
+	// First is the timestamp of the first block.
+	First int64
+	// Last is the timestamp of the last block.
+	Last int64
+	// Algos is the statistics of each algorithm, keyed by algorithm name.
+	Algos map[string]*DiffSimAlgoStats
+}
+
+// NewDiffSimStats returns an empty set of statistics for a chain under the given hard fork of the schedule.
+func NewDiffSimStats(forks *fork.Schedule, forkNum int) *DiffSimStats {
+	return &DiffSimStats{Fork: forkNum, Forks: forks, Algos: make(map[string]*DiffSimAlgoStats)}
+}
+
+// Add adds a block to the statistics.
+func (s *DiffSimStats) Add(blk DiffSimBlock) {
+	if s.Blocks == 0 {
+		s.First = blk.Timestamp
+	}
+	s.Blocks++
+	s.Last = blk.Timestamp
+	a, ok := s.Algos[blk.Algo]
+	if !ok {
+		a = &DiffSimAlgoStats{TargetSpacing: DiffSimTargetSpacing(s.Forks, s.Fork, blk.Algo)}
+		s.Algos[blk.Algo] = a
+	} else {
+		a.spacingSum += blk.Timestamp - a.lastTimestamp
+		a.spacings++
+	}
+	a.Blocks++
+	a.lastTimestamp = blk.Timestamp
+	if blk.Bits != blk.ChainBits {
+		a.Mismatches++
+	}
+	if blk.Adjustment > 0 {
+		logAdj := math.Log2(blk.Adjustment)
+		a.logAdjs++
+		a.logAdjSum += logAdj
+		a.logAdjSquares += logAdj * logAdj
+	}
+	direction := 0
+	switch {
+	case blk.Adjustment > 1:
+		direction = 1
+	case blk.Adjustment < 1:
+		direction = -1
+	}
+	if direction != 0 {
+		if a.lastDirection != 0 && direction != a.lastDirection {
+			a.Reversals++
+		}
+		a.lastDirection = direction
+		a.adjustments++
+	}
+}
+
+// MeanSpacing returns the average number of seconds between consecutive blocks of any algorithm.
+func (s *DiffSimStats) MeanSpacing() float64 {
+	if s.Blocks < 2 {
+		return 0
+	}
+	return float64(s.Last-s.First) / float64(s.Blocks-1)
+}
@@ -0,0 +1,96 @@
+package blockchain
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
+)
+
+// TestSimulateDifficulty ensures a simulated chain is reproducible from its seed, follows the difficulty adjustment and
+// that the statistics are collected from it.
+func TestSimulateDifficulty(t *testing.T) {
+	cfg := DiffSimConfig{Fork: 0, Blocks: 200, Scale: 4, Seed: 9}
+	run := func() (blocks []DiffSimBlock) {
+		if e := SimulateDifficulty(
+			&chaincfg.MainNetParams, cfg, func(blk DiffSimBlock) error {
+				blocks = append(blocks, blk)
+				return nil
+			},
+		); e != nil {
+			t.Fatalf("SimulateDifficulty: %v", e)
+		}
+		return blocks
+	}
+	blocks := run()
+	if len(blocks) != int(cfg.Blocks) {
+		t.Fatalf("SimulateDifficulty: got %d blocks, want %d", len(blocks), cfg.Blocks)
+	}
+	if !reflect.DeepEqual(blocks, run()) {
+		t.Fatal("SimulateDifficulty: the same seed produced a different chain")
+	}
+	stats := NewDiffSimStats(chaincfg.MainNetParams.Forks, cfg.Fork)
+	for i, blk := range blocks {
+		if blk.Height != int32(i+1) {
+			t.Fatalf("SimulateDifficulty: block %d has height %d", i, blk.Height)
+		}
+		if blk.Bits != blk.ChainBits {
+			t.Fatalf("SimulateDifficulty: block %d has bits %08x, want %08x", i, blk.ChainBits, blk.Bits)
+		}
+		stats.Add(blk)
+	}
+	var total int
+	for name, a := range stats.Algos {
+		total += a.Blocks
+		if a.TargetSpacing != 600 || a.Mismatches != 0 {
+			t.Fatalf("DiffSimStats: %s has target spacing %v and %d mismatches", name, a.TargetSpacing, a.Mismatches)
+		}
+	}
+	if total != stats.Blocks || stats.Blocks != len(blocks) {
+		t.Fatalf("DiffSimStats: algos add up to %d of %d blocks", total, stats.Blocks)
+	}
+	// Four times the hashrate that meets the target at the minimum difficulty has to raise the difficulty.
+	if last := blocks[len(blocks)-1]; targetRatio(last.Bits, 0x1e0fffff) >= 1 {
+		t.Fatalf("SimulateDifficulty: difficulty did not rise, last bits %08x", last.Bits)
+	}
+	// Replaying the simulated chain from a block index has to require the same targets.
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	node := chain.BestChain.Genesis()
+	for _, blk := range blocks {
+		node = newFakeNode(node, chaincfg.MainNetParams.Forks.GetAlgoVer(blk.Algo, blk.Height), blk.Bits, time.Unix(blk.Timestamp, 0))
+		chain.Index.AddNode(node)
+	}
+	chain.BestChain.SetTip(node)
+	var replayed []DiffSimBlock
+	if e := chain.ReplayDifficulty(
+		0, 0, func(blk DiffSimBlock) error {
+			replayed = append(replayed, blk)
+			return nil
+		},
+	); e != nil {
+		t.Fatalf("ReplayDifficulty: %v", e)
+	}
+	if !reflect.DeepEqual(blocks, replayed) {
+		t.Fatal("ReplayDifficulty: the replay differs from the simulation")
+	}
+	cfg.Hashrates = map[string]float64{"nonexistent": 1}
+	if e := SimulateDifficulty(&chaincfg.MainNetParams, cfg, func(DiffSimBlock) error { return nil }); e == nil {
+		t.Fatal("SimulateDifficulty: accepted an unknown algorithm")
+	}
+}
+
+// TestDiffSimOscillation ensures reversals of the direction of the difficulty adjustment are counted.
+func TestDiffSimOscillation(t *testing.T) {
+	stats := NewDiffSimStats(chaincfg.MainNetParams.Forks, 1)
+	for i, adj := range []float64{1, 2, 0.5, 2, 2, 2} {
+		stats.Add(DiffSimBlock{Height: int32(i), Algo: "Div18", Timestamp: int64(i * 20), Adjustment: adj})
+	}
+	a := stats.Algos["Div18"]
+	if a.Reversals != 2 || a.Oscillation() != 0.5 {
+		t.Fatalf("got %d reversals and oscillation %v, want 2 and 0.5", a.Reversals, a.Oscillation())
+	}
+	if a.MeanSpacing() != 20 || a.TargetSpacing != 18 {
+		t.Fatalf("got mean spacing %v and target %v, want 20 and 18", a.MeanSpacing(), a.TargetSpacing)
+	}
+}
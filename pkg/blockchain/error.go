@@ -184,6 +184,7 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrPreviousBlockUnknown:      "ErrPreviousBlockUnknown",
 	ErrInvalidAncestorBlock:      "ErrInvalidAncestorBlock",
 	ErrPrevBlockNotBest:          "ErrPrevBlockNotBest",
+	ErrBlacklisted:               "ErrBlacklisted",
 }
 
 // String returns the ErrorCode as a human-readable name.
@@ -198,8 +199,22 @@ func (e ErrorCode) String() string {
 // one of the many validation rules. The caller can use type assertions to determine if a failure was specifically due
 // to a rule violation and access the ErrorCode field to ascertain the specific reason for the rule violation.
 type RuleError struct {
-	ErrorCode   ErrorCode // Describes the kind of error
-	Description string    // Human readable description of the issue
+	ErrorCode   ErrorCode        // Describes the kind of error
+	Description string           // Human readable description of the issue
+	Detail      *RuleErrorDetail // Where in the block the violation was found, if known
+}
+
+// RuleErrorDetail locates a rule violation within a block. The indexes are -1 when the violation is not specific to a
+// transaction or input, and the expected bits are zero unless the violation is of the difficulty of the block.
+type RuleErrorDetail struct {
+	// TxIndex is the position in the block of the transaction that failed.
+	TxIndex int
+	// InputIndex is the input of that transaction that failed.
+	InputIndex int
+	// ScriptError is the error of the script engine when the input failed to parse or execute.
+	ScriptError error
+	// ExpectedBits is the difficulty the block was required to have, the difficulty it had being in its header.
+	ExpectedBits uint32
 }
 
 // Error satisfies the error interface and prints human-readable errors.
@@ -211,3 +226,14 @@ func (e RuleError) Error() string {
 func ruleError(c ErrorCode, desc string) RuleError {
 	return RuleError{ErrorCode: c, Description: desc}
 }
+
+// ruleErrorAt adds the position of the failing transaction in a block to a RuleError that does not already say where
+// it was found. Other errors are returned unchanged.
+func ruleErrorAt(e error, txIndex int) error {
+	re, ok := e.(RuleError)
+	if !ok || re.Detail != nil {
+		return e
+	}
+	re.Detail = &RuleErrorDetail{TxIndex: txIndex, InputIndex: -1}
+	return re
+}
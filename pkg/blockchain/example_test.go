@@ -6,33 +6,25 @@ import (
 	"github.com/p9c/parallelcoin/pkg/block"
 	"log"
 	"math/big"
-	"os"
-	"path/filepath"
 	
 	"github.com/p9c/parallelcoin/pkg/blockchain"
 	"github.com/p9c/parallelcoin/pkg/chaincfg"
 	"github.com/p9c/parallelcoin/pkg/database"
-	_ "github.com/p9c/parallelcoin/pkg/database/ffldb"
+	_ "github.com/p9c/parallelcoin/pkg/database/memdb"
 )
 
 // This example demonstrates how to create a new chain instance and use ProcessBlock to attempt to add a block to the
 // chain. As the package overview documentation describes, this includes all of the Bitcoin consensus rules. This
 // example intentionally attempts to insert a duplicate genesis block to illustrate how an invalid block is handled.
 func ExampleBlockChain_ProcessBlock() {
-	// Create a new database to store the accepted blocks into. Typically this would be opening an existing database and
-	// would not be deleting and creating a new database like this, but it is done here so this is a complete working
-	// example and does not leave temporary files laying around.
-	dbPath := filepath.Join(os.TempDir(), "exampleprocessblock")
-	_ = os.RemoveAll(dbPath)
-	db, e := database.Create("ffldb", dbPath, chaincfg.MainNetParams.Net)
+	// Create a new database to store the accepted blocks into. Typically this would be opening an existing ffldb
+	// database, but a memory database is used here so this is a complete working example and does not leave temporary
+	// files laying around.
+	db, e := database.Create("memdb")
 	if e != nil {
 		log.Printf("Failed to create database: %v\n", e)
 		return
 	}
-	defer func() {
-		if e = os.RemoveAll(dbPath); E.Chk(e) {
-		}
-	}()
 	defer func() {
 		if e = db.Close(); E.Chk(e) {
 		}
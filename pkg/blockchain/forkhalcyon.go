@@ -3,7 +3,6 @@ package blockchain
 import (
 	"fmt"
 	"github.com/p9c/parallelcoin/pkg/bits"
-	"github.com/p9c/parallelcoin/pkg/fork"
 	"math/big"
 )
 
@@ -24,10 +23,10 @@ func (b *BlockChain) CalcNextRequiredDifficultyHalcyon(
 		return newTargetBits, nil
 	}
 	// this sanitises invalid block versions according to legacy consensus quirks
-	algo := fork.GetAlgoVer(algoname, nH)
-	algoName := fork.GetAlgoName(algo, nH)
-	newTargetBits = fork.GetMinBits(algoName, nH)
-	prevNode := lastNode.GetLastWithAlgo(algo)
+	algo := b.params.Forks.GetAlgoVer(algoname, nH)
+	algoName := b.params.Forks.GetAlgoName(algo, nH)
+	newTargetBits = b.params.Forks.GetMinBits(algoName, nH)
+	prevNode := lastNode.GetLastWithAlgo(algo, b.params.Forks)
 	if prevNode == nil {
 		if l {
 			D.Ln("prevNode is nil")
@@ -36,9 +35,9 @@ func (b *BlockChain) CalcNextRequiredDifficultyHalcyon(
 	}
 	firstNode := prevNode
 	for i := int32(0); firstNode != nil &&
-		i < fork.GetAveragingInterval(nH)-1; i++ {
+		i < b.params.Forks.GetAveragingInterval(nH)-1; i++ {
 		firstNode = firstNode.RelativeAncestor(1)
-		firstNode = firstNode.GetLastWithAlgo(algo)
+		firstNode = firstNode.GetLastWithAlgo(algo, b.params.Forks)
 	}
 	if firstNode == nil {
 		return newTargetBits, nil
@@ -8,17 +8,15 @@ import (
 	"strings"
 	
 	"github.com/VividCortex/ewma"
-	
-	"github.com/p9c/parallelcoin/pkg/wire"
 )
 
 // GetAlgStamps ...
-func GetAlgStamps(algoName string, startHeight int32, lastNode *BlockNode) (last *BlockNode,
+func GetAlgStamps(algoName string, startHeight int32, lastNode *BlockNode, forks *fork.Schedule) (last *BlockNode,
 	found bool, algStamps []int64, version int32) {
 
-	version = fork.P9Algos[algoName].Version
+	version = forks.Forks[1].Algos[algoName].Version
 	for ln := lastNode; ln != nil && ln.height > startHeight &&
-		len(algStamps) <= int(fork.List[1].AveragingInterval); ln = ln.
+		len(algStamps) <= int(forks.Forks[1].AveragingInterval); ln = ln.
 		RelativeAncestor(1) {
 		if ln.version == version && ln.height > startHeight {
 			algStamps = append(algStamps, ln.timestamp)
@@ -38,10 +36,10 @@ func GetAlgStamps(algoName string, startHeight int32, lastNode *BlockNode) (last
 	return
 }
 
-func GetAllStamps(startHeight int32, lastNode *BlockNode) (allStamps []int64) {
+func GetAllStamps(startHeight int32, lastNode *BlockNode, forks *fork.Schedule) (allStamps []int64) {
 
 	for ln := lastNode; ln != nil && ln.height > startHeight &&
-		len(allStamps) <= int(fork.List[1].AveragingInterval); ln = ln.RelativeAncestor(1) {
+		len(allStamps) <= int(forks.Forks[1].AveragingInterval); ln = ln.RelativeAncestor(1) {
 		allStamps = append(allStamps, ln.timestamp)
 	}
 	// D.Ln(allStamps)
@@ -54,9 +52,9 @@ func GetAllStamps(startHeight int32, lastNode *BlockNode) (allStamps []int64) {
 	return
 }
 
-func GetAll(allStamps []int64) (allAv, allAdj float64) {
+func GetAll(allStamps []int64, forks *fork.Schedule) (allAv, allAdj float64) {
 	allAdj = 1
-	allAv = fork.P9Average
+	allAv = forks.Forks[1].Average
 	// calculate intervals
 	allIntervals := make([]float64, len(allStamps)-1)
 	for i := range allStamps {
@@ -74,7 +72,7 @@ func GetAll(allStamps []int64) (allAv, allAdj float64) {
 	allAv = aewma.Value()
 	// W.Ln(allAv)
 	if allAv != 0 {
-		allAdj = allAv / fork.P9Average
+		allAdj = allAv / forks.Forks[1].Average
 	}
 	return
 }
@@ -106,24 +104,22 @@ func (b *BlockChain) CalcNextRequiredDifficultyPlan9(lastNodeP *BlockNode, algoN
 	l bool) (newTargetBits uint32, adjustment float64, e error) {
 	lastNode := lastNodeP
 
-	algoVer := fork.GetAlgoVer(algoName, lastNode.height+1)
-	ttpb := float64(fork.List[1].Algos[algoName].VersionInterval)
+	forks := b.params.Forks
+	algoVer := forks.GetAlgoVer(algoName, lastNode.height+1)
+	ttpb := float64(forks.Forks[1].Algos[algoName].VersionInterval)
 	newTargetBits = fork.SecondPowLimitBits
 	const minAvSamples = 3
 	adjustment = 1
-	var algAdj, allAdj, algAv, allAv float64 = 1, 1, ttpb, fork.P9Average
+	var algAdj, allAdj, algAv, allAv float64 = 1, 1, ttpb, forks.Forks[1].Average
 	if lastNode == nil {
 		D.Ln("lastNode is nil")
 	}
 	// algoInterval := fork.P9Algos[algoname].VersionInterval
-	startHeight := fork.List[1].ActivationHeight
-	if b.params.Net == wire.TestNet3 {
-		startHeight = fork.List[1].TestnetStart
-	}
-	allStamps := GetAllStamps(startHeight, lastNode)
-	last, _, algStamps, algoVer := GetAlgStamps(algoName, startHeight, lastNode)
+	startHeight := forks.Forks[1].ActivationHeight
+	allStamps := GetAllStamps(startHeight, lastNode, forks)
+	last, _, algStamps, algoVer := GetAlgStamps(algoName, startHeight, lastNode, forks)
 	if len(allStamps) > minAvSamples {
-		allAv, allAdj = GetAll(allStamps)
+		allAv, allAdj = GetAll(allStamps, forks)
 	}
 	if len(algStamps) > minAvSamples {
 		algAv, algAdj = GetAlg(algStamps, ttpb)
@@ -166,7 +162,7 @@ func (b *BlockChain) CalcNextRequiredDifficultyPlan9(lastNodeP *BlockNode, algoN
 	// if l {
 		// if lastNode.version == algoVer {
 		I.Ln(func() string {
-			an := fork.List[1].AlgoVers[algoVer]
+			an := forks.Forks[1].AlgoVers[algoVer]
 			pad := 8 - len(an)
 			if pad > 0 {
 				an += strings.Repeat(" ", pad)
@@ -188,7 +184,7 @@ func (b *BlockChain) CalcNextRequiredDifficultyPlan9(lastNodeP *BlockNode, algoN
 				an,
 				RightJustify(fmt.Sprintf("%4.2f", algAv), 8),
 				RightJustify(fmt.Sprintf("%4.2f", allAv), 7),
-				fork.P9Average,
+				forks.Forks[1].Average,
 				RightJustify(fmt.Sprintf("%4.2f", factor), 7),
 				symbol,
 				bits,
@@ -216,7 +212,7 @@ func (b *BlockChain) CalcNextRequiredDifficultyPlan9old(lastNode *BlockNode, alg
 	}
 	allTimeAv, allTimeDiv, qhourDiv, hourDiv,
 	dayDiv := b.GetCommonP9Averages(lastNode, nH)
-	algoVer := fork.GetAlgoVer(algoName, nH)
+	algoVer := b.params.Forks.GetAlgoVer(algoName, nH)
 	since, ttpb, timeSinceAlgo, startHeight, last := b.GetP9Since(lastNode, algoVer)
 	if last == nil {
 		return
@@ -237,7 +233,7 @@ func (b *BlockChain) CalcNextRequiredDifficultyPlan9old(lastNode *BlockNode, alg
 		T.F("newTarget %064x %08x", newTarget, newTargetBits)
 	}
 	if l {
-		an := fork.List[1].AlgoVers[algoVer]
+		an := b.params.Forks.Forks[1].AlgoVers[algoVer]
 		pad := 9 - len(an)
 		if pad > 0 {
 			an += strings.Repeat(" ", pad)
@@ -255,7 +251,7 @@ func (b *BlockChain) CalcNextRequiredDifficultyPlan9old(lastNode *BlockNode, alg
 				RightJustify(fmt.Sprintf("%3.2fq", qhourDiv*ttpb), 7),
 				RightJustify(fmt.Sprintf("%3.2fA", algDiv*ttpb), 7),
 				RightJustify(fmt.Sprintf("%3.0f %3.3fD",
-					since-ttpb*float64(len(fork.List[1].Algos)), timeSinceAlgo*ttpb), 13),
+					since-ttpb*float64(len(b.params.Forks.Forks[1].Algos)), timeSinceAlgo*ttpb), 13),
 				RightJustify(fmt.Sprintf("%4.4fx", 1/adjustment), 11),
 				newTargetBits,
 			)
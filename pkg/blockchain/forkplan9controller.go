@@ -35,25 +35,25 @@ func (b *BlockChain) CalcNextRequiredDifficultyPlan9Controller(lastNode *BlockNo
 	diffs Diffs, e error,
 ) {
 	nH := lastNode.height + 1
-	currFork := fork.GetCurrent(nH)
+	currFork := b.params.Forks.GetCurrent(nH)
 	nTB := make(Diffs)
 	switch currFork {
 	case 0:
-		for i := range fork.List[0].Algos {
-			v := fork.List[currFork].Algos[i].Version
+		for i := range b.params.Forks.Forks[0].Algos {
+			v := b.params.Forks.Forks[currFork].Algos[i].Version
 			nTB[v], e = b.CalcNextRequiredDifficultyHalcyon(lastNode, i, true)
 		}
 		return nTB, nil
 	case 1:
 		if b.DifficultyHeight.Load() != nH {
 			b.DifficultyHeight.Store(nH)
-			currFork := fork.GetCurrent(nH)
-			algos := make(AlgoList, len(fork.List[currFork].Algos))
+			currFork := b.params.Forks.GetCurrent(nH)
+			algos := make(AlgoList, len(b.params.Forks.Forks[currFork].Algos))
 			var counter int
-			for i := range fork.List[1].Algos {
+			for i := range b.params.Forks.Forks[1].Algos {
 				algos[counter] = Algo{
 					Name:   i,
-					Params: fork.List[currFork].Algos[i],
+					Params: b.params.Forks.Forks[currFork].Algos[i],
 				}
 				counter++
 			}
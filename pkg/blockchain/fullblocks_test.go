@@ -4,13 +4,13 @@ import (
 	"os"
 	
 	"github.com/p9c/parallelcoin/pkg/database"
-	_ "github.com/p9c/parallelcoin/pkg/database/ffldb"
+	_ "github.com/p9c/parallelcoin/pkg/database/memdb"
 	"github.com/p9c/parallelcoin/pkg/wire"
 )
 
 const (
 	// testDbType is the database backend type to use for the tests.
-	testDbType = "ffldb"
+	testDbType = "memdb"
 	// testDbRoot is the root directory used to create all test databases.
 	testDbRoot = "testdbs"
 	// blockDataNet is the expected network in the test block data.
@@ -0,0 +1,305 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+)
+
+// InvalidateBlock marks the block with the given hash as having failed validation and all of its descendants as having
+// an invalid ancestor. When the block is part of the main chain, the chain is reorganized to the best remaining valid
+// tip. The updated block statuses are written to the block index in the database.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) InvalidateBlock(hash *chainhash.Hash) (e error) {
+	b.ChainLock.Lock()
+	defer b.unlockChain()
+	node := b.Index.LookupNode(hash)
+	if node == nil {
+		return fmt.Errorf("block %s is not known", hash)
+	}
+	if node.parent == nil {
+		return fmt.Errorf("the genesis block %s can not be invalidated", hash)
+	}
+	b.setValidateFailed(node, nil)
+	for _, n := range b.descendants(node) {
+		b.Index.SetStatusFlags(n, statusInvalidAncestor)
+	}
+	if !b.BestChain.Contains(node) {
+		return b.Index.flushToDB()
+	}
+	I.F("INVALIDATE: block %v (height %d) and its descendants are now invalid", node.hash, node.height)
+	return b.activateBestChain()
+}
+
+// ReconsiderBlock removes the invalid status from the block with the given hash, its ancestors and its descendants, as
+// set by InvalidateBlock or by a failed validation, and reorganizes the chain to the best valid tip. Blocks that really
+// are invalid will be found to be so again when they are connected. The refusal of a side chain for being deeper than
+// the maximum reorganization depth is removed the same way, and the reorganization is not limited by it. The updated
+// block statuses are written to the block index in the database.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ReconsiderBlock(hash *chainhash.Hash) (e error) {
+	b.ChainLock.Lock()
+	defer b.unlockChain()
+	node := b.Index.LookupNode(hash)
+	if node == nil {
+		return fmt.Errorf("block %s is not known", hash)
+	}
+	invalid := statusValidateFailed | statusInvalidAncestor | statusReorgRefused
+	for n := node; n != nil; n = n.parent {
+		if b.Index.NodeStatus(n)&invalid != 0 {
+			b.Index.UnsetStatusFlags(n, invalid)
+		}
+	}
+	for _, n := range b.descendants(node) {
+		if b.Index.NodeStatus(n)&invalid != 0 {
+			b.Index.UnsetStatusFlags(n, invalid)
+		}
+	}
+	I.F("RECONSIDER: block %v (height %d) and its descendants are no longer invalid", node.hash, node.height)
+	return b.activateBestChain()
+}
+
+// PreciousBlock makes the block with the given hash preferred over other tips with the same amount of work, as though
+// it had been received before them, and reorganizes the chain to it if needed. Blocks with less work than the current
+// tip are not affected. Later calls take precedence over earlier ones.
+//
+// The preference is stored with the block in the block index in the database, along with any block status changes
+// made by the reorganization, so it is kept across restarts.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) PreciousBlock(hash *chainhash.Hash) (e error) {
+	b.ChainLock.Lock()
+	defer b.unlockChain()
+	node := b.Index.LookupNode(hash)
+	if node == nil {
+		return fmt.Errorf("block %s is not known", hash)
+	}
+	tip := b.BestChain.Tip()
+	if node == tip || relativeWork(node, tip) < 0 {
+		return nil
+	}
+	b.preciousSeq++
+	b.Index.SetPrecious(node, b.preciousSeq)
+	return b.activateBestChain()
+}
+
+// activateBestChain reorganizes the chain to the best valid tip found by findBestTip, repeating the search when
+// connecting the chosen tip fails validation. The block index is written to the database afterwards.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) activateBestChain() (e error) {
+	for {
+		best := b.findBestTip()
+		if best == nil || best == b.BestChain.Tip() {
+			break
+		}
+		detachNodes, attachNodes := b.getReorganizeNodes(best)
+		e = b.reorganizeChain(detachNodes, attachNodes)
+		if writeErr := b.Index.flushToDB(); writeErr != nil {
+			T.Ln("error flushing block index changes to disk:", writeErr)
+		}
+		if e != nil {
+			// A block on the way to the chosen tip was found to be invalid and has been marked as such, so search
+			// again.
+			if _, ok := e.(RuleError); ok {
+				D.Ln("reorganize to", best.hash, "failed:", e)
+				continue
+			}
+			return e
+		}
+		if tip := b.BestChain.Tip(); tip != best && !b.Index.NodeStatus(best).KnownInvalid() {
+			return AssertError(
+				fmt.Sprintf(
+					"reorganize to %v (height %d) ended at %v (height %d)",
+					best.hash, best.height, tip.hash, tip.height,
+				),
+			)
+		}
+	}
+	return b.Index.flushToDB()
+}
+
+// findBestTip returns the block node with the most work that can become the tip of the main chain. The tip of the main
+// chain, or its closest ancestor that is not known to be invalid, is preferred when work is equal unless another
+// candidate has been made precious more recently.
+//
+// A node can only become the tip when it and all of its ancestors that are not part of the main chain have their data
+// stored, are not known to be invalid and were not refused for being too deep a reorganization.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) findBestTip() *BlockNode {
+	best := b.BestChain.Tip()
+	for best != nil && b.Index.NodeStatus(best).KnownInvalid() {
+		best = best.parent
+	}
+	if best == nil {
+		return nil
+	}
+	var candidates []*BlockNode
+	b.Index.RLock()
+	for _, n := range b.Index.index {
+		if n != best {
+			candidates = append(candidates, n)
+		}
+	}
+	b.Index.RUnlock()
+	// Every node is compared by the work of its chain, so a heavier branch is found wherever it forks from the main
+	// chain.
+	work := b.newChainWork()
+	bestWork, bestRank := work.of(best), b.preciousRank(best)
+	for _, n := range candidates {
+		cmp := work.of(n).Cmp(bestWork)
+		if cmp < 0 || !b.canBecomeTip(n) {
+			continue
+		}
+		rank := b.preciousRank(n)
+		if cmp > 0 || rank > bestRank {
+			best, bestWork, bestRank = n, work.of(n), rank
+		}
+	}
+	return best
+}
+
+// chainWork computes the total work of the chains ending at block nodes, sharing the work of the main chain and of the
+// side chain nodes already computed between nodes.
+type chainWork struct {
+	chain *chainView
+	main  []*big.Int
+	side  map[*BlockNode]*big.Int
+}
+
+// newChainWork returns a chainWork for the current main chain.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) newChainWork() *chainWork {
+	height := b.BestChain.Height()
+	c := &chainWork{
+		chain: b.BestChain,
+		main:  make([]*big.Int, height+1),
+		side:  make(map[*BlockNode]*big.Int),
+	}
+	sum := new(big.Int)
+	for h := int32(0); h <= height; h++ {
+		n := b.BestChain.NodeByHeight(h)
+		sum = new(big.Int).Add(sum, CalcWork(n.bits, n.height, n.version))
+		c.main[h] = sum
+	}
+	return c
+}
+
+// of returns the total work of the chain ending at the given node.
+func (c *chainWork) of(node *BlockNode) *big.Int {
+	// Walk back to the main chain or to a node whose work is known, then add up the work of the nodes walked over.
+	var branch []*BlockNode
+	sum := new(big.Int)
+	for n := node; n != nil; n = n.parent {
+		if c.chain.Contains(n) {
+			sum.Set(c.main[n.height])
+			break
+		}
+		if w, ok := c.side[n]; ok {
+			sum.Set(w)
+			break
+		}
+		branch = append(branch, n)
+	}
+	for i := len(branch) - 1; i >= 0; i-- {
+		n := branch[i]
+		sum = new(big.Int).Add(sum, CalcWork(n.bits, n.height, n.version))
+		c.side[n] = sum
+	}
+	return sum
+}
+
+// canBecomeTip returns whether the main chain could be reorganized to end at the given node, which requires the node
+// and its ancestors up to the main chain to have their data stored and none of them, including the fork point, to be
+// known to be invalid. Nodes refused for being too deep a reorganization can not become the tip either.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) canBecomeTip(node *BlockNode) bool {
+	for n := node; n != nil; n = n.parent {
+		status := b.Index.NodeStatus(n)
+		if status.KnownInvalid() || status.ReorgRefused() {
+			return false
+		}
+		if b.BestChain.Contains(n) {
+			return true
+		}
+		if !status.HaveData() {
+			return false
+		}
+	}
+	return false
+}
+
+// preciousRank returns the most recent PreciousBlock sequence number of the given node or any of its ancestors that
+// are not part of the main chain, or zero when none of them have been made precious.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) preciousRank(node *BlockNode) (rank int32) {
+	if b.preciousSeq == 0 {
+		return 0
+	}
+	for n := node; n != nil; n = n.parent {
+		if r := b.Index.NodePrecious(n); r > rank {
+			rank = r
+		}
+		if b.BestChain.Contains(n) {
+			break
+		}
+	}
+	return rank
+}
+
+// descendants returns all of the nodes in the block index that descend from the given node, in order of height.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) descendants(node *BlockNode) (found []*BlockNode) {
+	var above []*BlockNode
+	b.Index.RLock()
+	for _, n := range b.Index.index {
+		if n.height > node.height {
+			above = append(above, n)
+		}
+	}
+	b.Index.RUnlock()
+	sort.Slice(
+		above, func(i, j int) bool {
+			return above[i].height < above[j].height
+		},
+	)
+	// Processing in order of height means a parent is always seen before its children.
+	inBranch := map[*BlockNode]struct{}{node: {}}
+	for _, n := range above {
+		if _, ok := inBranch[n.parent]; ok {
+			inBranch[n] = struct{}{}
+			found = append(found, n)
+		}
+	}
+	return found
+}
+
+// relativeWork compares the work done on the branches leading to the two given nodes from their common ancestor. It
+// returns -1 when a has less work than b, 0 when they have the same work and +1 when a has more work.
+func relativeWork(a, b *BlockNode) int {
+	workA, workB := new(big.Int), new(big.Int)
+	for a != b && a != nil && b != nil {
+		switch {
+		case a.height > b.height:
+			workA.Add(workA, CalcWork(a.bits, a.height, a.version))
+			a = a.parent
+		case b.height > a.height:
+			workB.Add(workB, CalcWork(b.bits, b.height, b.version))
+			b = b.parent
+		default:
+			workA.Add(workA, CalcWork(a.bits, a.height, a.version))
+			workB.Add(workB, CalcWork(b.bits, b.height, b.version))
+			a, b = a.parent, b.parent
+		}
+	}
+	return workA.Cmp(workB)
+}
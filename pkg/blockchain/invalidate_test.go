@@ -0,0 +1,148 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+)
+
+// TestFindBestTip ensures the best tip selection used by InvalidateBlock, ReconsiderBlock and PreciousBlock prefers the
+// most work, keeps the current tip on equal work unless another tip is precious, and skips invalid branches.
+func TestFindBestTip(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of the following structure.
+	//
+	// 	genesis -> 1 -> 2 -> 3 -> 4  -> 5
+	// 	                      \-> 4a -> 5a
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	const bits = 0x207fffff
+	ts := time.Unix(chain.BestChain.Genesis().timestamp, 0)
+	var branch0Nodes, branch1Nodes []*BlockNode
+	parent := chain.BestChain.Genesis()
+	for i := 0; i < 5; i++ {
+		ts = ts.Add(time.Minute)
+		parent = newFakeNode(parent, 1, bits, ts)
+		branch0Nodes = append(branch0Nodes, parent)
+	}
+	parent = branch0Nodes[2]
+	for i := 0; i < 2; i++ {
+		ts = ts.Add(time.Second)
+		parent = newFakeNode(parent, 1, bits, ts)
+		branch1Nodes = append(branch1Nodes, parent)
+	}
+	for _, node := range append(branch0Nodes, branch1Nodes...) {
+		chain.Index.SetStatusFlags(node, statusDataStored|statusValid)
+		chain.Index.AddNode(node)
+	}
+	chain.BestChain.SetTip(branch0Nodes[4])
+	if got := relativeWork(branch0Nodes[4], branch1Nodes[1]); got != 0 {
+		t.Fatalf("relativeWork: got %d for branches of equal work, want 0", got)
+	}
+	if got := relativeWork(branch1Nodes[0], branch0Nodes[4]); got != -1 {
+		t.Fatalf("relativeWork: got %d for a shorter branch, want -1", got)
+	}
+	// The current tip is kept when another tip has the same work.
+	if best := chain.findBestTip(); best != branch0Nodes[4] {
+		t.Fatalf("findBestTip: got height %d, want the current tip", best.height)
+	}
+	// A precious tip with equal work is preferred.
+	chain.preciousSeq = 1
+	chain.Index.SetPrecious(branch1Nodes[1], 1)
+	if best := chain.findBestTip(); best != branch1Nodes[1] {
+		t.Fatalf("findBestTip: got height %d, want the precious tip", best.height)
+	}
+	chain.preciousSeq = 0
+	chain.Index.SetPrecious(branch1Nodes[1], 0)
+	// Invalidating a block on the main chain makes the side chain the best tip.
+	descendants := chain.descendants(branch0Nodes[3])
+	if len(descendants) != 1 || descendants[0] != branch0Nodes[4] {
+		t.Fatalf("descendants: got %d nodes, want only block 5", len(descendants))
+	}
+	chain.Index.SetStatusFlags(branch0Nodes[3], statusValidateFailed)
+	for _, node := range descendants {
+		chain.Index.SetStatusFlags(node, statusInvalidAncestor)
+	}
+	if best := chain.findBestTip(); best != branch1Nodes[1] {
+		t.Fatalf("findBestTip: got height %d, want the side chain tip", best.height)
+	}
+	// With the side chain invalid as well, the best tip is the fork point.
+	chain.Index.SetStatusFlags(branch1Nodes[0], statusValidateFailed)
+	chain.Index.SetStatusFlags(branch1Nodes[1], statusInvalidAncestor)
+	if best := chain.findBestTip(); best != branch0Nodes[2] {
+		t.Fatalf("findBestTip: got height %d, want the fork point", best.height)
+	}
+	// A side chain block without its data can not become the tip.
+	chain.Index.UnsetStatusFlags(branch1Nodes[0], statusValidateFailed|statusDataStored)
+	chain.Index.UnsetStatusFlags(branch1Nodes[1], statusInvalidAncestor)
+	if best := chain.findBestTip(); best != branch0Nodes[2] {
+		t.Fatalf("findBestTip: got height %d, want the fork point", best.height)
+	}
+}
+
+// TestInvalidateReconsiderPrecious ensures InvalidateBlock, ReconsiderBlock and PreciousBlock reorganize a chain with a
+// side chain of equal work, and that the preference of PreciousBlock is kept when the chain is loaded again.
+func TestInvalidateReconsiderPrecious(t *testing.T) {
+	chain, teardown, e := chainSetup("invalidate", tstEasyParams(t))
+	if e != nil {
+		t.Fatalf("failed to setup chain instance: %v", e)
+	}
+	defer teardown()
+	// Construct the following chain, with the side chain block processed after the main chain.
+	//
+	// 	genesis -> 1 -> 2 -> 3
+	// 	                  \-> 3a
+	tstMineBlock(t, chain)
+	second := tstMineBlock(t, chain)
+	third := tstMineBlock(t, chain)
+	sideThird := tstMineBlockOn(t, chain, chain.Index.LookupNode(second.Hash()), 1)
+	checkTip := func(chain *BlockChain, want *chainhash.Hash, when string) {
+		t.Helper()
+		if tip := chain.BestChain.Tip(); tip.hash != *want {
+			t.Fatalf("%s: got tip %v at height %d, want %v", when, tip.hash, tip.height, want)
+		}
+	}
+	checkTip(chain, third.Hash(), "side chain of equal work")
+	// Invalidating the tip moves the chain to the side chain.
+	if e = chain.InvalidateBlock(third.Hash()); e != nil {
+		t.Fatalf("InvalidateBlock: %v", e)
+	}
+	checkTip(chain, sideThird.Hash(), "InvalidateBlock")
+	if status := chain.Index.NodeStatus(chain.Index.LookupNode(third.Hash())); !status.KnownInvalid() {
+		t.Fatalf("InvalidateBlock: the invalidated block is not invalid")
+	}
+	// Once reconsidered, the block has the same work as the side chain, so the current tip is kept.
+	if e = chain.ReconsiderBlock(third.Hash()); e != nil {
+		t.Fatalf("ReconsiderBlock: %v", e)
+	}
+	checkTip(chain, sideThird.Hash(), "ReconsiderBlock")
+	if status := chain.Index.NodeStatus(chain.Index.LookupNode(third.Hash())); status.KnownInvalid() {
+		t.Fatalf("ReconsiderBlock: the reconsidered block is still invalid")
+	}
+	// Making the other tip precious moves the chain back to it.
+	if e = chain.PreciousBlock(third.Hash()); e != nil {
+		t.Fatalf("PreciousBlock: %v", e)
+	}
+	checkTip(chain, third.Hash(), "PreciousBlock")
+	// Load the chain again, move it away from the precious tip and back. The tips have equal work, so the chain only
+	// returns to the precious tip if the preference was stored.
+	reloaded, e := New(
+		&Config{
+			DB:          chain.db,
+			ChainParams: chain.params,
+			TimeSource:  NewMedianTime(),
+		},
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+	checkTip(reloaded, third.Hash(), "reload")
+	if e = reloaded.InvalidateBlock(third.Hash()); e != nil {
+		t.Fatalf("InvalidateBlock: %v", e)
+	}
+	checkTip(reloaded, sideThird.Hash(), "InvalidateBlock after reload")
+	if e = reloaded.ReconsiderBlock(third.Hash()); e != nil {
+		t.Fatalf("ReconsiderBlock: %v", e)
+	}
+	checkTip(reloaded, third.Hash(), "ReconsiderBlock of the precious tip after reload")
+}
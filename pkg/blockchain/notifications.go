@@ -2,6 +2,12 @@ package blockchain
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/p9c/parallelcoin/pkg/block"
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
+	"github.com/p9c/parallelcoin/pkg/chainhash"
 )
 
 // NotificationType represents the type of a notification message.
@@ -19,6 +25,21 @@ const (
 	NTBlockConnected
 	// NTBlockDisconnected indicates the associated block was disconnected from the main chain.
 	NTBlockDisconnected
+	// NTReorgRefused indicates the main chain was not reorganized to a side chain with more work because it would have
+	// detached more blocks than the maximum reorganization depth.
+	NTReorgRefused
+	// NTReorgStarted indicates the blocks of a reorganization were validated and the main chain is about to be
+	// reorganized.
+	NTReorgStarted
+	// NTReorgFinished indicates the main chain was reorganized.
+	NTReorgFinished
+	// NTTipChanged indicates the tip of the main chain changed, either because a block was connected or because one was
+	// disconnected.
+	NTTipChanged
+	// NTBlockInvalid indicates a block was found to be invalid, or was invalidated with InvalidateBlock.
+	NTBlockInvalid
+	// NTCheckpointReached indicates the block at the height of a checkpoint was connected to the main chain.
+	NTCheckpointReached
 )
 
 // notificationTypeStrings is a map of notification types back to their constant names for pretty printing.
@@ -26,6 +47,12 @@ var notificationTypeStrings = map[NotificationType]string{
 	NTBlockAccepted:     "NTBlockAccepted",
 	NTBlockConnected:    "NTBlockConnected",
 	NTBlockDisconnected: "NTBlockDisconnected",
+	NTReorgRefused:      "NTReorgRefused",
+	NTReorgStarted:      "NTReorgStarted",
+	NTReorgFinished:     "NTReorgFinished",
+	NTTipChanged:        "NTTipChanged",
+	NTBlockInvalid:      "NTBlockInvalid",
+	NTCheckpointReached: "NTCheckpointReached",
 }
 
 // String returns the NotificationType in human-readable form.
@@ -36,35 +63,259 @@ func (n NotificationType) String() string {
 	return fmt.Sprintf("Unknown Notification Type (%d)", int(n))
 }
 
-// Notification defines notification that is sent to the caller via the callback function provided during the call to
-// New and consists of a notification type as well as associated data that depends on the type as follows:
+// Notification defines notification that is sent to subscribers and consists of a notification type and the field
+// holding the data of that type, the others being nil, as follows:
+//
+// 	- NTBlockAccepted:     Block
+//
+// 	- NTBlockConnected:    Block
+//
+// 	- NTBlockDisconnected: Block
+//
+// 	- NTReorgRefused:      RefusedReorg
+//
+// 	- NTReorgStarted:      Reorganization
 //
-// 	- NTBlockAccepted:     *util.Block
+// 	- NTReorgFinished:     Reorganization
 //
-// 	- NTBlockConnected:    *util.Block
+// 	- NTTipChanged:        TipChange
 //
-// 	- NTBlockDisconnected: *util.Block
+// 	- NTBlockInvalid:      InvalidBlock
+//
+// 	- NTCheckpointReached: Checkpoint
 type Notification struct {
-	Type NotificationType
-	Data interface{}
+	Type           NotificationType
+	Block          *block.Block
+	RefusedReorg   *RefusedReorg
+	Reorganization *Reorganization
+	TipChange      *TipChange
+	InvalidBlock   *InvalidBlock
+	Checkpoint     *chaincfg.Checkpoint
+}
+
+// RefusedReorg is the data of a NTReorgRefused notification.
+type RefusedReorg struct {
+	// Block is the block that gave the side chain more work than the main chain.
+	Block *block.Block
+	// ForkHash and ForkHeight identify the block where the side chain forks from the main chain.
+	ForkHash   chainhash.Hash
+	ForkHeight int32
+	// Depth is the number of blocks that would have been detached from the main chain.
+	Depth int32
+}
+
+// Reorganization is the data of the NTReorgStarted and NTReorgFinished notifications.
+type Reorganization struct {
+	// ForkHash and ForkHeight identify the block the detached and attached blocks build on.
+	ForkHash   chainhash.Hash
+	ForkHeight int32
+	// Detached is the hashes of the blocks disconnected from the main chain, from the old tip down, and Attached those
+	// of the blocks connected to it, up to the new tip.
+	Detached []chainhash.Hash
+	Attached []chainhash.Hash
+}
+
+// TipChange is the data of a NTTipChanged notification.
+type TipChange struct {
+	Hash   chainhash.Hash
+	Height int32
+	// Connected is whether the tip changed because a block was connected rather than disconnected.
+	Connected bool
+}
+
+// InvalidBlock is the data of a NTBlockInvalid notification.
+type InvalidBlock struct {
+	Hash   chainhash.Hash
+	Height int32
+	// Err is the reason the block is invalid, which is nil when it was invalidated with InvalidateBlock.
+	Err error
+}
+
+// OverflowPolicy determines what happens to a notification for a subscriber whose queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest discards the oldest queued notification to make room for the new one.
+	OverflowDropOldest OverflowPolicy = iota
+	// OverflowDropNewest discards the new notification.
+	OverflowDropNewest
+	// OverflowBlock waits for room in the queue, which holds up the delivery of notifications to every subscriber until
+	// the subscriber catches up. Notifications are delivered after the chain lock is released, so this does not stall
+	// the chain, and the callback may call methods of the chain.
+	OverflowBlock
+)
+
+// DefaultNotificationQueueSize is the number of notifications queued for a subscriber when the options do not say.
+const DefaultNotificationQueueSize = 1000
+
+// SubscribeOptions are the options of a subscription.
+type SubscribeOptions struct {
+	// QueueSize is the number of notifications queued for delivery to the subscriber, DefaultNotificationQueueSize when
+	// zero.
+	QueueSize int
+	// Overflow is what happens to a notification when the queue is full.
+	Overflow OverflowPolicy
+	// Types is the types of notification delivered, all of them when it is empty.
+	Types []NotificationType
+}
+
+// Subscription is a subscriber to block chain notifications, which are queued and delivered to its callback in order
+// by a goroutine of its own so that a slow subscriber does not hold up the chain.
+type Subscription struct {
+	// dropped is accessed atomically and so is first to be 64-bit aligned on 32-bit platforms.
+	dropped  uint64
+	chain    *BlockChain
+	callback NotificationCallback
+	types    map[NotificationType]struct{}
+	overflow OverflowPolicy
+	queue    chan *Notification
+	quit     chan struct{}
+	once     sync.Once
 }
 
-// Subscribe to block chain notifications. Registers a callback to be executed when various events take place. See the
-// documentation on Notification and NotificationType for details on the types and contents of notifications.
-func (b *BlockChain) Subscribe(callback NotificationCallback) {
+// Subscribe to block chain notifications with the default options. Registers a callback to be executed when various
+// events take place. See the documentation on Notification and NotificationType for details on the types and contents
+// of notifications.
+func (b *BlockChain) Subscribe(callback NotificationCallback) *Subscription {
+	return b.SubscribeWithOptions(callback, SubscribeOptions{})
+}
+
+// SubscribeWithOptions subscribes to block chain notifications as Subscribe does, with the given queue size, overflow
+// policy and types of notification.
+func (b *BlockChain) SubscribeWithOptions(callback NotificationCallback, opts SubscribeOptions) *Subscription {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultNotificationQueueSize
+	}
+	s := &Subscription{
+		chain:    b,
+		callback: callback,
+		overflow: opts.Overflow,
+		queue:    make(chan *Notification, opts.QueueSize),
+		quit:     make(chan struct{}),
+	}
+	if len(opts.Types) > 0 {
+		s.types = make(map[NotificationType]struct{}, len(opts.Types))
+		for _, typ := range opts.Types {
+			s.types[typ] = struct{}{}
+		}
+	}
 	b.notificationsLock.Lock()
-	b.notifications = append(b.notifications, callback)
+	b.notifications = append(b.notifications, s)
 	b.notificationsLock.Unlock()
+	go s.deliver()
+	return s
+}
+
+// Cancel removes the subscription. Notifications that are still queued are not delivered. It is safe to call more than
+// once and from the callback of the subscription.
+func (s *Subscription) Cancel() {
+	s.once.Do(
+		func() {
+			b := s.chain
+			b.notificationsLock.Lock()
+			for i, sub := range b.notifications {
+				if sub == s {
+					b.notifications = append(b.notifications[:i:i], b.notifications[i+1:]...)
+					break
+				}
+			}
+			b.notificationsLock.Unlock()
+			close(s.quit)
+		},
+	)
+}
+
+// Dropped returns the number of notifications discarded because the queue of the subscription was full.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// deliver passes queued notifications to the callback until the subscription is cancelled.
+func (s *Subscription) deliver() {
+	for {
+		select {
+		case n := <-s.queue:
+			s.callback(n)
+		case <-s.quit:
+			return
+		}
+	}
 }
 
-// sendNotification sends a notification with the passed type and data if the caller requested notifications by
-// providing a callback function in the call to New.
-func (b *BlockChain) sendNotification(typ NotificationType, data interface{}) {
-	// Generate and send the notification.
-	n := Notification{Type: typ, Data: data}
-	b.notificationsLock.RLock()
-	for _, callback := range b.notifications {
-		callback(&n)
+// send queues a notification for delivery according to the overflow policy of the subscription.
+func (s *Subscription) send(n *Notification) {
+	if s.types != nil {
+		if _, ok := s.types[n.Type]; !ok {
+			return
+		}
+	}
+	switch s.overflow {
+	case OverflowBlock:
+		select {
+		case s.queue <- n:
+		case <-s.quit:
+		}
+	case OverflowDropNewest:
+		select {
+		case s.queue <- n:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	default:
+		for {
+			select {
+			case s.queue <- n:
+				return
+			default:
+			}
+			select {
+			case <-s.queue:
+				atomic.AddUint64(&s.dropped, 1)
+			default:
+			}
+		}
+	}
+}
+
+// sendNotification holds the notification to be delivered to the subscribers once the chain lock is released by
+// unlockChain, so that a subscriber that falls behind or calls methods of the chain does not hold up or deadlock the
+// chain.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) sendNotification(n *Notification) {
+	b.pendingNotifications = append(b.pendingNotifications, n)
+}
+
+// unlockChain releases the chain state lock and then delivers the notifications sent while it was held. The
+// notifications are queued in order before the lock is released and only one goroutine delivers them at a time, so
+// they reach the subscribers in the order they were sent. A call made while another goroutine is delivering, such as
+// from the callback of a subscriber, leaves its notifications to that goroutine and returns.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) unlockChain() {
+	pending := b.pendingNotifications
+	b.pendingNotifications = nil
+	b.notificationsLock.Lock()
+	b.undelivered = append(b.undelivered, pending...)
+	deliver := !b.delivering && len(b.undelivered) > 0
+	if deliver {
+		b.delivering = true
+	}
+	b.notificationsLock.Unlock()
+	b.ChainLock.Unlock()
+	for deliver {
+		b.notificationsLock.Lock()
+		notifications := b.undelivered
+		b.undelivered = nil
+		subscribers := append([]*Subscription(nil), b.notifications...)
+		if len(notifications) == 0 {
+			b.delivering, deliver = false, false
+		}
+		b.notificationsLock.Unlock()
+		for _, n := range notifications {
+			for _, s := range subscribers {
+				s.send(n)
+			}
+		}
 	}
-	b.notificationsLock.RUnlock()
 }
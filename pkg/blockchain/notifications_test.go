@@ -1,8 +1,10 @@
 package blockchain
 
 import (
+	"sync"
 	"testing"
-	
+	"time"
+
 	"github.com/p9c/parallelcoin/pkg/chaincfg"
 )
 
@@ -19,14 +21,15 @@ func TestNotifications(t *testing.T) {
 		t.Fatalf("Failed to setup chain instance: %v", e)
 	}
 	defer teardownFunc()
-	notificationCount := 0
+	var wg sync.WaitGroup
 	callback := func(notification *Notification) {
 		if notification.Type == NTBlockAccepted {
-			notificationCount++
+			wg.Done()
 		}
 	}
 	// Register callback multiple times then assert it is called that many times.
 	const numSubscribers = 3
+	wg.Add(numSubscribers)
 	for i := 0; i < numSubscribers; i++ {
 		chain.Subscribe(callback)
 	}
@@ -34,8 +37,169 @@ func TestNotifications(t *testing.T) {
 	if e != nil  {
 		t.Fatalf("ProcessBlock fail on block 1: %v\n", e)
 	}
-	if notificationCount != numSubscribers {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
 		t.Fatalf("Expected notification callback to be executed %d "+
-			"times, found %d", numSubscribers, notificationCount)
+			"times", numSubscribers)
+	}
+}
+
+// TestSubscription ensures notifications are delivered in order to the subscribers of their type, that the overflow
+// policies hold when a subscriber falls behind, and that a cancelled subscription is no longer sent notifications.
+func TestSubscription(t *testing.T) {
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	notify := func(height int32) {
+		chain.ChainLock.Lock()
+		chain.sendNotification(&Notification{Type: NTTipChanged, TipChange: &TipChange{Height: height}})
+		chain.unlockChain()
+	}
+	// A subscriber blocked in its callback lets the queue fill up. The queue of the subscriber with the blocking policy
+	// has room for one more so that only the last notification waits for it. It is subscribed last, as notifications
+	// reach the subscribers in the order they subscribed, so the others have the last notification queued before it
+	// waits.
+	release := make(chan struct{})
+	started := make(chan struct{}, 3)
+	received := make(map[OverflowPolicy]chan int32)
+	subs := make(map[OverflowPolicy]*Subscription)
+	queueSizes := map[OverflowPolicy]int{OverflowDropOldest: 2, OverflowDropNewest: 2, OverflowBlock: 3}
+	for _, policy := range []OverflowPolicy{OverflowDropOldest, OverflowDropNewest, OverflowBlock} {
+		size := queueSizes[policy]
+		ch := make(chan int32, 10)
+		received[policy] = ch
+		subs[policy] = chain.SubscribeWithOptions(
+			func(n *Notification) {
+				if n.TipChange.Height == 1 {
+					started <- struct{}{}
+				}
+				<-release
+				ch <- n.TipChange.Height
+			}, SubscribeOptions{QueueSize: size, Overflow: policy, Types: []NotificationType{NTTipChanged}},
+		)
+	}
+	other := make(chan NotificationType, 10)
+	otherSub := chain.SubscribeWithOptions(
+		func(n *Notification) {
+			other <- n.Type
+		}, SubscribeOptions{Types: []NotificationType{NTBlockInvalid}},
+	)
+	// The first notification is taken by the blocked callbacks and the next ones fill the queues.
+	notify(1)
+	for range subs {
+		<-started
+	}
+	notify(2)
+	notify(3)
+	notify(4)
+	sent := make(chan struct{})
+	go func() {
+		// This blocks until the subscriber with the blocking policy makes room.
+		notify(5)
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		t.Fatal("sendNotification: did not wait for a subscriber with the blocking overflow policy")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-sent
+	want := map[OverflowPolicy][]int32{
+		OverflowDropOldest: {1, 4, 5},
+		OverflowDropNewest: {1, 2, 3},
+		OverflowBlock:      {1, 2, 3, 4, 5},
+	}
+	for policy, heights := range want {
+		for _, height := range heights {
+			select {
+			case got := <-received[policy]:
+				if got != height {
+					t.Fatalf("overflow policy %d: got height %d, want %d", policy, got, height)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("overflow policy %d: height %d was not delivered", policy, height)
+			}
+		}
+	}
+	if got := subs[OverflowDropOldest].Dropped(); got != 2 {
+		t.Errorf("OverflowDropOldest: %d notifications dropped, want 2", got)
+	}
+	if got := subs[OverflowDropNewest].Dropped(); got != 2 {
+		t.Errorf("OverflowDropNewest: %d notifications dropped, want 2", got)
+	}
+	select {
+	case typ := <-other:
+		t.Fatalf("notification of type %v was delivered to a subscriber of other types", typ)
+	default:
+	}
+	otherSub.Cancel()
+	otherSub.Cancel()
+	chain.ChainLock.Lock()
+	chain.sendNotification(&Notification{Type: NTBlockInvalid, InvalidBlock: &InvalidBlock{}})
+	chain.unlockChain()
+	select {
+	case typ := <-other:
+		t.Fatalf("notification of type %v was delivered after the subscription was cancelled", typ)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if len(chain.notifications) != 3 {
+		t.Fatalf("Cancel: %d subscriptions remain, want 3", len(chain.notifications))
+	}
+	for _, sub := range subs {
+		sub.Cancel()
+	}
+}
+
+// TestNotificationsAfterUnlock ensures notifications are delivered once the chain lock is released, so that the
+// callback of a subscriber with the blocking overflow policy can call methods of the chain, and that notifications sent
+// from a callback are delivered after the ones already queued.
+func TestNotificationsAfterUnlock(t *testing.T) {
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	received := make(chan *Notification, 10)
+	sub := chain.SubscribeWithOptions(
+		func(n *Notification) {
+			// Taking the chain lock would deadlock if the notification was delivered while it was held.
+			chain.ChainLock.Lock()
+			if n.Type == NTTipChanged && n.TipChange.Height == 1 {
+				chain.sendNotification(&Notification{Type: NTBlockInvalid, InvalidBlock: &InvalidBlock{}})
+			}
+			chain.unlockChain()
+			received <- n
+		}, SubscribeOptions{QueueSize: 1, Overflow: OverflowBlock},
+	)
+	defer sub.Cancel()
+	chain.ChainLock.Lock()
+	for height := int32(1); height <= 3; height++ {
+		chain.sendNotification(&Notification{Type: NTTipChanged, TipChange: &TipChange{Height: height}})
+	}
+	select {
+	case n := <-received:
+		t.Fatalf("notification %v was delivered while the chain lock was held", n.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+	done := make(chan struct{})
+	go func() {
+		chain.unlockChain()
+		close(done)
+	}()
+	for i, want := range []NotificationType{NTTipChanged, NTTipChanged, NTTipChanged, NTBlockInvalid} {
+		select {
+		case n := <-received:
+			if n.Type != want || (want == NTTipChanged && n.TipChange.Height != int32(i+1)) {
+				t.Fatalf("notification %d: got %v, want %v", i, n.Type, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("notification %d of type %v was not delivered", i, want)
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("unlockChain: did not return after delivering the notifications")
 	}
 }
@@ -0,0 +1,248 @@
+package blockchain
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/p9c/parallelcoin/pkg/bits"
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// maxPowHashCache is the number of verified proof of work hashes kept for blocks that have not yet been added to the
+// block index. It is a few batches of headers as they are requested during sync.
+const maxPowHashCache = 16384
+
+// verifiedPowHash is the proof of work hash of a block whose header has been verified, and the height it was computed
+// for, as the algorithm, and so the hash, of a block version depends on the hard fork in effect.
+type verifiedPowHash struct {
+	height int32
+	hash   chainhash.Hash
+}
+
+// powHashCache holds the proof of work hashes of headers verified by VerifyHeaders until their blocks are processed.
+type powHashCache struct {
+	sync.Mutex
+	hashes map[chainhash.Hash]verifiedPowHash
+}
+
+// newPowHashCache returns an empty proof of work hash cache.
+func newPowHashCache() *powHashCache {
+	return &powHashCache{hashes: make(map[chainhash.Hash]verifiedPowHash)}
+}
+
+// add stores the verified proof of work hash of a block, evicting an arbitrary entry when the cache is full.
+func (c *powHashCache) add(blockHash *chainhash.Hash, height int32, powHash *chainhash.Hash) {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.hashes[*blockHash]; !ok && len(c.hashes) >= maxPowHashCache {
+		for h := range c.hashes {
+			delete(c.hashes, h)
+			break
+		}
+	}
+	c.hashes[*blockHash] = verifiedPowHash{height: height, hash: *powHash}
+}
+
+// lookup returns the verified proof of work hash of a block at the given height, or nil if it has not been verified.
+func (c *powHashCache) lookup(blockHash *chainhash.Hash, height int32) *chainhash.Hash {
+	c.Lock()
+	defer c.Unlock()
+	v, ok := c.hashes[*blockHash]
+	if !ok || v.height != height {
+		return nil
+	}
+	return &v.hash
+}
+
+// take returns the verified proof of work hash of a block at the given height as lookup does, and removes the block
+// from the cache.
+func (c *powHashCache) take(blockHash *chainhash.Hash, height int32) *chainhash.Hash {
+	c.Lock()
+	defer c.Unlock()
+	v, ok := c.hashes[*blockHash]
+	if !ok {
+		return nil
+	}
+	delete(c.hashes, *blockHash)
+	if v.height != height {
+		return nil
+	}
+	return &v.hash
+}
+
+// VerifyHeaders verifies the proof of work of a batch of block headers in parallel, using the given number of workers
+// or one per CPU if it is not positive. The headers must each follow either a block in the block index or an earlier
+// header of the batch, as they do when they are received during sync.
+//
+// The returned slice holds the error for the header at the same position, nil for those that are valid. A header that
+// follows an invalid one is reported as having an invalid ancestor. The proof of work hashes of the valid headers are
+// kept so that when their blocks are processed ProcessBlock only compares the target, instead of computing the hash
+// under the chain lock, and the hash is stored on the block node.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) VerifyHeaders(headers []*wire.BlockHeader, workers int) []error {
+	errs := make([]error, len(headers))
+	heights := make([]int32, len(headers))
+	// parents holds the position in the batch of the header each one follows, or -1 for those following a block in
+	// the index.
+	parents := make([]int, len(headers))
+	batch := make(map[chainhash.Hash]int, len(headers))
+	for i, header := range headers {
+		parents[i] = -1
+		if j, ok := batch[header.PrevBlock]; ok {
+			parents[i] = j
+			heights[i] = heights[j] + 1
+		} else if node := b.Index.LookupNode(&header.PrevBlock); node != nil {
+			heights[i] = node.height + 1
+		} else {
+			errs[i] = ruleError(
+				ErrPreviousBlockUnknown,
+				fmt.Sprintf("previous block %v of header %d is unknown", header.PrevBlock, i),
+			)
+			continue
+		}
+		batch[header.BlockHash()] = i
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				errs[i] = b.verifyHeaderPow(headers[i], heights[i])
+			}
+		}()
+	}
+	for i := range headers {
+		if errs[i] == nil {
+			work <- i
+		}
+	}
+	close(work)
+	wg.Wait()
+	for i := range headers {
+		if errs[i] == nil && parents[i] >= 0 && errs[parents[i]] != nil {
+			errs[i] = ruleError(
+				ErrInvalidAncestorBlock,
+				fmt.Sprintf("header %d follows invalid header %d", i, parents[i]),
+			)
+		}
+	}
+	return errs
+}
+
+// verifyHeaderPow checks the target of a header is in range and that its proof of work hash meets it, and caches the
+// hash if it does.
+func (b *BlockChain) verifyHeaderPow(header *wire.BlockHeader, height int32) (e error) {
+	var powHash chainhash.Hash
+	if powHash, e = b.checkHeaderPow(header, height); e != nil {
+		return
+	}
+	blockHash := header.BlockHash()
+	b.powHashes.add(&blockHash, height, &powHash)
+	return
+}
+
+// checkHeaderPow checks the target of a header at the given height is in range and that its proof of work hash meets
+// it, and returns the hash.
+func (b *BlockChain) checkHeaderPow(header *wire.BlockHeader, height int32) (powHash chainhash.Hash, e error) {
+	forks := b.params.Forks
+	powLimit := forks.GetMinDiff(forks.GetAlgoName(header.Version, height), height)
+	if e = checkProofOfWork(header, powLimit, BFNoPoWCheck, height, forks); e != nil {
+		return
+	}
+	powHash = header.BlockHashWithAlgos(height, forks)
+	e = checkPowHash(&powHash, bits.CompactToBig(header.Bits), height)
+	return
+}
+
+// ReverifyPowHashes recomputes the proof of work hash of every block in the block index with the given number of
+// workers, or one per CPU if it is not positive, and checks each meets the target of its block. Stored hashes that
+// differ from the recomputed ones are replaced and written to the database. The error returned is for the first block
+// whose hash does not meet its target, if any.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ReverifyPowHashes(workers int, interrupt <-chan struct{}) (e error) {
+	b.ChainLock.Lock()
+	defer b.unlockChain()
+	return b.reverifyPowHashes(workers, interrupt)
+}
+
+// reverifyPowHashes recomputes and checks the proof of work hashes of the blocks in the block index as described by
+// ReverifyPowHashes.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) reverifyPowHashes(workers int, interrupt <-chan struct{}) (e error) {
+	b.Index.RLock()
+	nodes := make([]*BlockNode, 0, len(b.Index.index))
+	for _, node := range b.Index.index {
+		nodes = append(nodes, node)
+	}
+	b.Index.RUnlock()
+	sort.Slice(
+		nodes, func(i, j int) bool {
+			return nodes[i].height < nodes[j].height
+		},
+	)
+	I.F("re-verifying the proof of work hashes of %d blocks", len(nodes))
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	powHashes := make([]chainhash.Hash, len(nodes))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				header := nodes[i].Header()
+				powHashes[i] = header.BlockHashWithAlgos(nodes[i].height, b.params.Forks)
+			}
+		}()
+	}
+	for i := range nodes {
+		if i%1000 == 0 && interruptRequested(interrupt) {
+			break
+		}
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	if interruptRequested(interrupt) {
+		return errInterruptRequested
+	}
+	var replaced int
+	for i, node := range nodes {
+		if node.powHash == nil || *node.powHash != powHashes[i] {
+			if node.powHash != nil {
+				W.F("stored proof of work hash of block %v at height %d was wrong", node.hash, node.height)
+			}
+			b.Index.Lock()
+			node.powHash = &powHashes[i]
+			b.Index.dirty[node] = struct{}{}
+			b.Index.Unlock()
+			replaced++
+		}
+		if e == nil && node.height > 0 {
+			if pe := checkPowHash(&powHashes[i], bits.CompactToBig(node.bits), node.height); pe != nil {
+				e = ruleError(
+					ErrHighHash,
+					fmt.Sprintf("block %v: %v", node.hash, pe),
+				)
+			}
+		}
+	}
+	if fe := b.Index.flushToDB(); E.Chk(fe) {
+		return fe
+	}
+	I.F("re-verified %d proof of work hashes, %d were replaced", len(nodes), replaced)
+	return
+}
@@ -0,0 +1,102 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/p9c/parallelcoin/pkg/bits"
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/fork"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// TestVerifyHeaders ensures a batch of headers is verified in parallel, that headers following an invalid or unknown
+// one are reported, and that the proof of work hashes of the valid headers are kept for when their blocks are added.
+func TestVerifyHeaders(t *testing.T) {
+	params := chaincfg.RegressionTestParams
+	params.Forks = fork.MainNetSchedule()
+	sha := params.Forks.Forks[0].Algos[fork.SHA256d]
+	sha.MinBits = 0x207fffff
+	params.Forks.Forks[0].Algos[fork.SHA256d] = sha
+	if e := params.Forks.Init(); e != nil {
+		t.Fatal(e)
+	}
+	chain := newFakeChain(&params)
+	genesis := chain.BestChain.Genesis()
+	// mine returns a header following the given block whose hash meets the target, or does not if bad is set.
+	mine := func(prev *wire.BlockHeader, prevHash chainhash.Hash, height int32, bad bool) *wire.BlockHeader {
+		header := &wire.BlockHeader{
+			Version:   2,
+			PrevBlock: prevHash,
+			Timestamp: time.Unix(prev.Timestamp.Unix()+300, 0),
+			Bits:      0x207fffff,
+		}
+		for ; ; header.Nonce++ {
+			hash := header.BlockHashWithAlgos(height, params.Forks)
+			if (checkPowHash(&hash, bits.CompactToBig(header.Bits), height) != nil) == bad {
+				return header
+			}
+		}
+	}
+	genesisHeader := genesis.Header()
+	headers := make([]*wire.BlockHeader, 0, 8)
+	prev, prevHash := &genesisHeader, genesis.hash
+	for i := int32(1); i <= 5; i++ {
+		header := mine(prev, prevHash, i, i == 3)
+		headers = append(headers, header)
+		prev, prevHash = header, header.BlockHash()
+	}
+	unknown := mine(&genesisHeader, chainhash.Hash{1}, 1, false)
+	headers = append(headers, unknown)
+	errs := chain.VerifyHeaders(headers, 3)
+	want := []ErrorCode{-1, -1, ErrHighHash, ErrInvalidAncestorBlock, ErrInvalidAncestorBlock, ErrPreviousBlockUnknown}
+	for i, code := range want {
+		if code < 0 {
+			if errs[i] != nil {
+				t.Errorf("VerifyHeaders: header %d: unexpected error %v", i, errs[i])
+			}
+			continue
+		}
+		if re, ok := errs[i].(RuleError); !ok || re.ErrorCode != code {
+			t.Errorf("VerifyHeaders: header %d: got error %v, want %v", i, errs[i], code)
+		}
+	}
+	// The hash is only kept for the height it was computed at, and is taken when the block node is created.
+	blockHash := headers[1].BlockHash()
+	if chain.powHashes.lookup(&blockHash, 3) != nil {
+		t.Error("powHashCache: found hash at the wrong height")
+	}
+	powHash := chain.powHashes.take(&blockHash, 2)
+	if powHash == nil || *powHash != headers[1].BlockHashWithAlgos(2, params.Forks) {
+		t.Fatalf("powHashCache: got %v for a verified header", powHash)
+	}
+	if chain.powHashes.lookup(&blockHash, 2) != nil {
+		t.Error("powHashCache: hash is still cached after it was taken")
+	}
+	node := NewBlockNode(headers[0], genesis)
+	node.powHash = chain.powHashes.take(&node.hash, node.height)
+	if node.powHash == nil || node.PowHash(params.Forks) != headers[0].BlockHashWithAlgos(1, params.Forks) {
+		t.Error("PowHash: verified hash was not stored on the node")
+	}
+}
+
+// TestPowHashKept ensures the proof of work hash of a node created without one is computed once and kept on the node.
+func TestPowHashKept(t *testing.T) {
+	forks := fork.MainNetSchedule()
+	header := chaincfg.RegressionTestParams.GenesisBlock.Header
+	node := NewBlockNode(&header, nil)
+	want := header.BlockHashWithAlgos(0, forks)
+	if got := node.PowHash(forks); got != want {
+		t.Fatalf("PowHash: got %v, want %v", got, want)
+	}
+	if node.powHash == nil || *node.powHash != want {
+		t.Fatal("PowHash: the computed hash was not kept on the node")
+	}
+	// A kept hash is returned without computing it again.
+	kept := chainhash.Hash{1}
+	node.powHash = &kept
+	if got := node.PowHash(forks); got != kept {
+		t.Fatalf("PowHash: got %v, want the kept %v", got, kept)
+	}
+}
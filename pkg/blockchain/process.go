@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"github.com/p9c/parallelcoin/pkg/bits"
 	"github.com/p9c/parallelcoin/pkg/block"
-	"github.com/p9c/parallelcoin/pkg/fork"
 	"time"
 	
 	"github.com/p9c/parallelcoin/pkg/chainhash"
@@ -38,10 +37,23 @@ const (
 // whether or not the block is on the main chain and the second indicates
 // whether or not the block is an orphan.
 //
+// A block that is rejected for breaking a consensus rule is reported by RejectedBlocks.
+//
 // This function is safe for concurrent access.
 func (b *BlockChain) ProcessBlock(
 	workerNumber uint32, candidateBlock *block.Block,
 	flags BehaviorFlags, height int32,
+) (isMainChain, isOrphan bool, e error) {
+	if isMainChain, isOrphan, e = b.processBlock(workerNumber, candidateBlock, flags, height); e != nil {
+		b.recordRejection(candidateBlock, height, e)
+	}
+	return
+}
+
+// processBlock does the work of ProcessBlock.
+func (b *BlockChain) processBlock(
+	workerNumber uint32, candidateBlock *block.Block,
+	flags BehaviorFlags, height int32,
 ) (bool, bool, error,) {
 	T.Ln("blockchain.ProcessBlock", height)
 	blockHeight := height
@@ -55,11 +67,10 @@ func (b *BlockChain) ProcessBlock(
 	}
 	// trc.S(prevBlock)
 	b.ChainLock.Lock()
-	defer b.ChainLock.Unlock()
+	defer b.unlockChain()
 	fastAdd := flags&BFFastAdd == BFFastAdd
 	blockHash := candidateBlock.Hash()
-	hf := fork.GetCurrent(blockHeight)
-	bhwa := candidateBlock.WireBlock().BlockHashWithAlgos
+	hf := b.params.Forks.GetCurrent(blockHeight)
 	var algo int32
 	switch hf {
 	case 0:
@@ -77,7 +88,7 @@ func (b *BlockChain) ProcessBlock(
 		return false, false, e
 	}
 	if exists {
-		str := ruleError(ErrDuplicateBlock, fmt.Sprintf("already have candidateBlock %v", bhwa(blockHeight).String()))
+		str := ruleError(ErrDuplicateBlock, fmt.Sprintf("already have candidateBlock %v", blockHash))
 		E.Ln(str)
 		return false, false, str
 	}
@@ -89,27 +100,37 @@ func (b *BlockChain) ProcessBlock(
 	}
 	// Perform preliminary sanity checks on the candidateBlock and its transactions.
 	var DoNotCheckPow bool
-	pl := fork.GetMinDiff(fork.GetAlgoName(algo, blockHeight), blockHeight)
-	T.F("powLimit %d %s %d %064x", algo, fork.GetAlgoName(algo, blockHeight), blockHeight, pl)
+	pl := b.params.Forks.GetMinDiff(b.params.Forks.GetAlgoName(algo, blockHeight), blockHeight)
+	T.F("powLimit %d %s %d %064x", algo, b.params.Forks.GetAlgoName(algo, blockHeight), blockHeight, pl)
 	ph := &candidateBlock.WireBlock().Header.PrevBlock
 	pn := b.Index.LookupNode(ph)
 	if pn == nil {
 		return false, false, errors.New("could not find parent block of candidate block")
 	}
 	var pb *BlockNode
-	pb = pn.GetLastWithAlgo(algo)
+	pb = pn.GetLastWithAlgo(algo, b.params.Forks)
 	if pb == nil {
 		DoNotCheckPow = true
 	}
-	D.Ln("checkBlockSanity powLimit %d %s %d %064x ts %v", algo, fork.GetAlgoName(algo, blockHeight), blockHeight, pl,pn.Header().Timestamp)
+	// When the header was verified by VerifyHeaders its proof of work hash is already known to meet the target, so only
+	// the target itself is checked by the sanity checks. Otherwise the hash is verified here, which keeps it to be
+	// stored in the block index.
+	if flags&BFNoPoWCheck == 0 && b.powHashes.lookup(blockHash, blockHeight) == nil {
+		if e = b.verifyHeaderPow(&candidateBlock.WireBlock().Header, blockHeight); E.Chk(e) {
+			return false, false, e
+		}
+	}
+	sanityFlags := flags | BFNoPoWCheck
+	D.Ln("checkBlockSanity powLimit %d %s %d %064x ts %v", algo, b.params.Forks.GetAlgoName(algo, blockHeight), blockHeight, pl,pn.Header().Timestamp)
 	if e = checkBlockSanity(
 		candidateBlock,
 		pl,
 		b.timeSource,
-		flags,
+		sanityFlags,
 		DoNotCheckPow,
 		blockHeight,
 		pn.Header().Timestamp,
+		b.params.Forks,
 	); E.Chk(e) {
 		return false, false, e
 	}
@@ -131,7 +152,7 @@ func (b *BlockChain) ProcessBlock(
 		if blockHeader.Timestamp.Before(checkpointTime) {
 			str := fmt.Sprintf(
 				"candidateBlock %v has timestamp %v before last checkpoint timestamp %v",
-				bhwa(blockHeight).String(), blockHeader.Timestamp, checkpointTime,
+				blockHash, blockHeader.Timestamp, checkpointTime,
 			)
 			T.Ln(str)
 			return false, false, ruleError(ErrCheckpointTimeTooOld, str)
@@ -171,7 +192,7 @@ func (b *BlockChain) ProcessBlock(
 			func() string {
 				return fmt.Sprintf(
 					"adding orphan candidateBlock %v with parent %v",
-					bhwa(blockHeight).String(),
+					blockHash,
 					prevHash,
 				)
 			},
@@ -197,7 +218,7 @@ func (b *BlockChain) ProcessBlock(
 	}
 	T.F(
 		"accepted candidateBlock %d %v %s",
-		blockHeight, bhwa(blockHeight).String(), fork.GetAlgoName(
+		blockHeight, blockHash, b.params.Forks.GetAlgoName(
 			candidateBlock.WireBlock().
 				Header.Version, blockHeight,
 		),
@@ -0,0 +1,103 @@
+package blockchain
+
+import (
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+const (
+	// MinPruneTarget is the smallest prune target in megabytes that is accepted. Block files are 512MiB each and the
+	// file currently being written to is never removed, so a smaller target could never actually be reached.
+	MinPruneTarget uint64 = 1024
+	// PruneDepth is the number of blocks below the tip of the chain for which the block data and spend journal are
+	// always kept when pruning, so that reorganizations up to this depth remain possible. At the Plan 9 target of 36
+	// seconds per block this is about a day of blocks.
+	PruneDepth int32 = 2400
+)
+
+// pruneBlocks removes the spend journal entry of the block on the chain ending at tip that has just become buried
+// deeper than PruneDepth and removes the oldest block files while the stored block data is over the prune target.
+// The nodes of the removed blocks are marked as pruned in the block index.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) pruneBlocks(dbTx database.Tx, tip *BlockNode) (e error) {
+	cutoff := tip.height - PruneDepth
+	if cutoff <= 0 {
+		return nil
+	}
+	// The spend journal is only needed to disconnect blocks, which can not happen below the cutoff any more.
+	if buried := tip.Ancestor(cutoff); buried != nil {
+		if e = dbRemoveSpendJournalEntry(dbTx, &buried.hash); E.Chk(e) {
+			return e
+		}
+	}
+	// Looking for block data to remove means going through the whole block index, so it waits until the oldest block
+	// data that was held back can go.
+	if cutoff < b.pruneHeight {
+		return nil
+	}
+	var pruned []chainhash.Hash
+	var newest int32
+	if pruned, e = dbTx.PruneBlocks(
+		b.pruneTarget, func(hash *chainhash.Hash) bool {
+			node := b.Index.LookupNode(hash)
+			if node == nil || node.height <= cutoff {
+				return true
+			}
+			if node.height > newest {
+				newest = node.height
+			}
+			return false
+		},
+	); E.Chk(e) {
+		return e
+	}
+	// The blocks of the data that was not removed are all passed to the callback, so the newest of those refused is
+	// the newest block stored with them.
+	b.pruneHeight = newest
+	if len(pruned) == 0 {
+		return nil
+	}
+	for i := range pruned {
+		// Blocks that were stored before pruning was enabled still have their spend journal entries.
+		if e = dbRemoveSpendJournalEntry(dbTx, &pruned[i]); E.Chk(e) {
+			return e
+		}
+		node := b.Index.LookupNode(&pruned[i])
+		if node == nil {
+			continue
+		}
+		b.Index.UnsetStatusFlags(node, statusDataStored)
+		b.Index.SetStatusFlags(node, statusDataPruned)
+		// The node is written in this transaction so the block index never claims to have data that is gone.
+		b.Index.Lock()
+		e = dbStoreBlockNode(dbTx, node, b.params.Forks)
+		b.Index.Unlock()
+		if E.Chk(e) {
+			return e
+		}
+	}
+	b.pruned.Store(true)
+	D.F("pruned %d blocks at or below height %d", len(pruned), cutoff)
+	return nil
+}
+
+// IsPruned returns whether the chain is running in prune mode or block data has been removed from the database by
+// pruning in the past, meaning the full block chain is no longer available to serve to peers.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) IsPruned() bool {
+	return b.pruneTarget != 0 || b.pruned.Load()
+}
+
+// AdvertisedServices returns the provided service flags adjusted for the state of the chain. A pruned node does not
+// have the full block chain, so SFNodeNetwork is removed.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) AdvertisedServices(services wire.ServiceFlag) wire.ServiceFlag {
+	if b.IsPruned() {
+		services &^= wire.SFNodeNetwork
+	}
+	return services
+}
@@ -0,0 +1,66 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/p9c/parallelcoin/pkg/database"
+)
+
+// TestPruneHeight ensures pruning stops at the oldest block that is not buried deep enough, remembers it and leaves the
+// block data alone until the cutoff has passed it.
+func TestPruneHeight(t *testing.T) {
+	chain, teardown, e := chainSetup("pruneheight", tstEasyParams(t))
+	if e != nil {
+		t.Fatalf("failed to setup chain instance: %v", e)
+	}
+	defer teardown()
+	var mined []*BlockNode
+	for i := 0; i < 3; i++ {
+		blk := tstMineBlock(t, chain)
+		mined = append(mined, chain.Index.LookupNode(blk.Hash()))
+	}
+	// Prune against tips that bury the mined blocks up to the cutoff, keeping the stored blocks over the target.
+	chain.pruneTarget = 1
+	prune := func(cutoff int32) {
+		tip := tstTip(chainedNodes(mined[len(mined)-1], int(cutoff+PruneDepth-mined[len(mined)-1].height)))
+		chain.ChainLock.Lock()
+		defer chain.ChainLock.Unlock()
+		if e := chain.db.Update(
+			func(dbTx database.Tx) (e error) {
+				return chain.pruneBlocks(dbTx, tip)
+			},
+		); e != nil {
+			t.Fatal(e)
+		}
+	}
+	stored := func(node *BlockNode) (has bool) {
+		if e := chain.db.View(
+			func(dbTx database.Tx) (e error) {
+				has, e = dbTx.HasBlock(&node.hash)
+				return e
+			},
+		); e != nil {
+			t.Fatal(e)
+		}
+		return has
+	}
+	prune(1)
+	if stored(mined[0]) || !stored(mined[1]) {
+		t.Fatal("pruneBlocks: did not prune exactly the blocks up to the cutoff")
+	}
+	if chain.pruneHeight != mined[1].height {
+		t.Fatalf("pruneBlocks: got prune height %d, want %d", chain.pruneHeight, mined[1].height)
+	}
+	// Below the prune height the block data is not looked at, even when a block has become prunable, here by being
+	// removed from the block index.
+	delete(chain.Index.index, mined[1].hash)
+	prune(1)
+	if !stored(mined[1]) {
+		t.Fatal("pruneBlocks: pruned block data below the prune height")
+	}
+	chain.Index.addNode(mined[1])
+	prune(2)
+	if stored(mined[1]) || !stored(mined[2]) || chain.pruneHeight != mined[2].height {
+		t.Fatalf("pruneBlocks: got prune height %d after passing it, want %d", chain.pruneHeight, mined[2].height)
+	}
+}
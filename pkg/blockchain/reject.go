@@ -0,0 +1,123 @@
+package blockchain
+
+import (
+	"sync"
+	"time"
+
+	"github.com/p9c/parallelcoin/pkg/block"
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+)
+
+// DefaultMaxRejectReports is the number of rejected blocks remembered when the configuration does not say.
+const DefaultMaxRejectReports = 100
+
+// RejectReport describes a block that ProcessBlock rejected for breaking a consensus rule, so that miners can find out
+// what was wrong with the block templates of their algorithm.
+type RejectReport struct {
+	// Hash and Height identify the block, the height being where it would have been connected.
+	Hash   chainhash.Hash
+	Height int32
+	// Algo is the name of the mining algorithm of the block version at that height.
+	Algo string
+	// Time is when the block was rejected.
+	Time time.Time
+	// Code and Reason are the ErrorCode and description of the RuleError the block was rejected with.
+	Code   ErrorCode
+	Reason string
+	// ExpectedBits is the difficulty the block was required to have, which is only known when the difficulty was
+	// wrong and is zero otherwise, and ActualBits the difficulty in its header.
+	ExpectedBits uint32
+	ActualBits   uint32
+	// TxIndex and InputIndex are the transaction and input that failed, -1 when the rule is not about a transaction or
+	// input, and ScriptError is the error of the script engine if the input failed to parse or execute.
+	TxIndex     int
+	InputIndex  int
+	ScriptError error
+}
+
+// rejectLog is a ring buffer of the most recent reports of rejected blocks.
+type rejectLog struct {
+	sync.Mutex
+	reports []RejectReport
+	// next is the position the next report is written to, and full is whether the buffer has wrapped around.
+	next int
+	full bool
+}
+
+// newRejectLog returns an empty rejection log holding up to the given number of reports, or DefaultMaxRejectReports
+// if it is not positive.
+func newRejectLog(size int) *rejectLog {
+	if size <= 0 {
+		size = DefaultMaxRejectReports
+	}
+	return &rejectLog{reports: make([]RejectReport, size)}
+}
+
+// add stores a report, replacing the oldest one when the log is full.
+func (l *rejectLog) add(r RejectReport) {
+	l.Lock()
+	defer l.Unlock()
+	l.reports[l.next] = r
+	l.next++
+	if l.next == len(l.reports) {
+		l.next = 0
+		l.full = true
+	}
+}
+
+// recent returns the stored reports, newest first.
+func (l *rejectLog) recent() []RejectReport {
+	l.Lock()
+	defer l.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.reports)
+	}
+	out := make([]RejectReport, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, l.reports[(l.next-i+len(l.reports))%len(l.reports)])
+	}
+	return out
+}
+
+// recordRejection adds a report to the rejection log for a block that failed processing with the given error. Only
+// rule violations are recorded, apart from the block being a duplicate, as the other errors are not about the block.
+// Blocks of a side chain refused for reorganizing too deep are not rejected, as they are kept in the block index.
+// The height is used when the parent of the block is not in the block index.
+func (b *BlockChain) recordRejection(candidateBlock *block.Block, height int32, e error) {
+	re, ok := e.(RuleError)
+	if !ok || re.ErrorCode == ErrDuplicateBlock {
+		return
+	}
+	header := &candidateBlock.WireBlock().Header
+	if prevNode := b.Index.LookupNode(&header.PrevBlock); prevNode != nil {
+		height = prevNode.height + 1
+	}
+	r := RejectReport{
+		Hash:       *candidateBlock.Hash(),
+		Height:     height,
+		Algo:       b.params.Forks.GetAlgoName(header.Version, height),
+		Time:       time.Now(),
+		Code:       re.ErrorCode,
+		Reason:     re.Description,
+		ActualBits: header.Bits,
+		TxIndex:    -1,
+		InputIndex: -1,
+	}
+	if d := re.Detail; d != nil {
+		r.ExpectedBits = d.ExpectedBits
+		r.TxIndex = d.TxIndex
+		r.InputIndex = d.InputIndex
+		r.ScriptError = d.ScriptError
+	}
+	W.F("rejected %s block %v at height %d: %s", r.Algo, r.Hash, r.Height, r.Reason)
+	b.rejects.add(r)
+}
+
+// RejectedBlocks returns the reports of the most recently rejected blocks, newest first. The number kept is set by the
+// MaxRejectReports configuration.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) RejectedBlocks() []RejectReport {
+	return b.rejects.recent()
+}
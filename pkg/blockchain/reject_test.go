@@ -0,0 +1,112 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/p9c/parallelcoin/pkg/block"
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/txscript"
+	"github.com/p9c/parallelcoin/pkg/util"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// TestRejectLog ensures the rejection log keeps the most recent reports and returns them newest first.
+func TestRejectLog(t *testing.T) {
+	l := newRejectLog(3)
+	if got := l.recent(); len(got) != 0 {
+		t.Fatalf("recent: got %d reports from an empty log", len(got))
+	}
+	for i := int32(1); i <= 5; i++ {
+		l.add(RejectReport{Height: i})
+		want := i
+		if want > 3 {
+			want = 3
+		}
+		got := l.recent()
+		if int32(len(got)) != want {
+			t.Fatalf("recent: got %d reports after adding %d, want %d", len(got), i, want)
+		}
+		for j, r := range got {
+			if r.Height != i-int32(j) {
+				t.Fatalf("recent: report %d after adding %d has height %d, want %d", j, i, r.Height, i-int32(j))
+			}
+		}
+	}
+}
+
+// TestRecordRejection ensures rule violations are reported with where they were found in the block, and that other
+// errors and duplicate blocks are not reported.
+func TestRecordRejection(t *testing.T) {
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	nodes := chainedNodes(chain.BestChain.Genesis(), 3)
+	for _, node := range nodes {
+		chain.Index.AddNode(node)
+	}
+	tip := tstTip(nodes)
+	blk := block.NewBlock(
+		&wire.Block{
+			Header: wire.BlockHeader{Version: 2, PrevBlock: tip.hash, Bits: 0x1d00ffff},
+		},
+	)
+	chain.recordRejection(blk, 0, errors.New("not a rule violation"))
+	chain.recordRejection(blk, 0, ruleError(ErrDuplicateBlock, "duplicate"))
+	if got := chain.RejectedBlocks(); len(got) != 0 {
+		t.Fatalf("RejectedBlocks: got %d reports, want none", len(got))
+	}
+	scriptErr := errors.New("script failed")
+	re := ruleError(ErrScriptValidation, "failed to validate input")
+	re.Detail = &RuleErrorDetail{TxIndex: 2, InputIndex: 1, ScriptError: scriptErr}
+	chain.recordRejection(blk, 0, re)
+	re = ruleError(ErrUnexpectedDifficulty, "wrong difficulty")
+	re.Detail = &RuleErrorDetail{TxIndex: -1, InputIndex: -1, ExpectedBits: 0x1c00ffff}
+	chain.recordRejection(blk, 0, re)
+	chain.recordRejection(blk, 0, ruleErrorAt(ruleError(ErrUnfinalizedTx, "unfinalized"), 4))
+	got := chain.RejectedBlocks()
+	if len(got) != 3 {
+		t.Fatalf("RejectedBlocks: got %d reports, want 3", len(got))
+	}
+	for i, r := range got {
+		if r.Hash != *blk.Hash() || r.Height != tip.height+1 || r.ActualBits != 0x1d00ffff {
+			t.Errorf("report %d: got block %v at height %d with bits %08x, want %v at %d with %08x", i, r.Hash,
+				r.Height, r.ActualBits, blk.Hash(), tip.height+1, 0x1d00ffff)
+		}
+		if want := chain.params.Forks.GetAlgoName(2, tip.height+1); r.Algo != want {
+			t.Errorf("report %d: got algo %q, want %q", i, r.Algo, want)
+		}
+	}
+	if r := got[0]; r.Code != ErrUnfinalizedTx || r.TxIndex != 4 || r.InputIndex != -1 {
+		t.Errorf("report 0: got %v at tx %d input %d, want %v at tx 4 input -1", r.Code, r.TxIndex, r.InputIndex,
+			ErrUnfinalizedTx)
+	}
+	if r := got[1]; r.Code != ErrUnexpectedDifficulty || r.ExpectedBits != 0x1c00ffff || r.TxIndex != -1 {
+		t.Errorf("report 1: got %v expecting bits %08x at tx %d, want %v expecting %08x at tx -1", r.Code,
+			r.ExpectedBits, r.TxIndex, ErrUnexpectedDifficulty, 0x1c00ffff)
+	}
+	if r := got[2]; r.Code != ErrScriptValidation || r.TxIndex != 2 || r.InputIndex != 1 || r.ScriptError != scriptErr {
+		t.Errorf("report 2: got %v at tx %d input %d with script error %v, want %v at tx 2 input 1 with %v", r.Code,
+			r.TxIndex, r.InputIndex, r.ScriptError, ErrScriptValidation, scriptErr)
+	}
+}
+
+// TestTxValidatorDetail ensures the script validator reports the transaction and input that failed.
+func TestTxValidatorDetail(t *testing.T) {
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{2}, 0), nil, nil))
+	utilTx := util.NewTx(tx)
+	validator := newTxValidator(NewUtxoViewpoint(), txscript.ScriptBip16, nil, nil)
+	e := validator.Validate(
+		[]*txValidateItem{
+			{txIndex: 3, txInIndex: 1, txIn: tx.TxIn[1], tx: utilTx},
+		},
+	)
+	re, ok := e.(RuleError)
+	if !ok || re.ErrorCode != ErrMissingTxOut {
+		t.Fatalf("Validate: got %v, want %v", e, ErrMissingTxOut)
+	}
+	if re.Detail == nil || re.Detail.TxIndex != 3 || re.Detail.InputIndex != 1 {
+		t.Fatalf("Validate: got detail %+v, want tx 3 input 1", re.Detail)
+	}
+}
@@ -8,7 +8,6 @@ import (
 	
 	"github.com/p9c/qu"
 	
-	"github.com/p9c/parallelcoin/pkg/hardfork"
 	"github.com/p9c/parallelcoin/pkg/txscript"
 	"github.com/p9c/parallelcoin/pkg/util"
 	"github.com/p9c/parallelcoin/pkg/wire"
@@ -16,12 +15,18 @@ import (
 
 // txValidateItem holds a transaction along with which input to validate.
 type txValidateItem struct {
+	txIndex   int
 	txInIndex int
 	txIn      *wire.TxIn
 	tx        *util.Tx
 	sigHashes *txscript.TxSigHashes
 }
 
+// detail returns the location of the input for a RuleError, with the error of the script engine if there was one.
+func (txVI *txValidateItem) detail(scriptErr error) *RuleErrorDetail {
+	return &RuleErrorDetail{TxIndex: txVI.txIndex, InputIndex: txVI.txInIndex, ScriptError: scriptErr}
+}
+
 // txValidator provides a type which asynchronously validates transaction inputs. It provides several channels for
 // communication and a processing function that is intended to be in run multiple goroutines.
 type txValidator struct {
@@ -64,8 +69,8 @@ out:
 					txIn.PreviousOutPoint, txVI.tx.Hash(),
 					txVI.txInIndex,
 				)
-				var e RuleError
-				e = ruleError(ErrMissingTxOut, str)
+				e := ruleError(ErrMissingTxOut, str)
+				e.Detail = txVI.detail(nil)
 				v.sendResult(e)
 				break out
 			}
@@ -89,8 +94,9 @@ out:
 					txIn.PreviousOutPoint, e, // witness,
 					sigScript, pkScript,
 				)
-				e = ruleError(ErrScriptMalformed, str)
-				v.sendResult(e)
+				re := ruleError(ErrScriptMalformed, str)
+				re.Detail = txVI.detail(e)
+				v.sendResult(re)
 				break out
 			}
 			// Execute the script pair.
@@ -104,8 +110,9 @@ out:
 					txIn.PreviousOutPoint, e, // witness,
 					sigScript, pkScript,
 				)
-				e = ruleError(ErrScriptValidation, str)
-				v.sendResult(e)
+				re := ruleError(ErrScriptValidation, str)
+				re.Detail = txVI.detail(e)
+				v.sendResult(re)
 				break out
 			}
 			// Validation succeeded.
@@ -206,9 +213,6 @@ func ValidateTransactionScripts(
 	// 	// pre-computing the sighash here instead of during validation, we ensure the sighashes are only computed once.
 	// 	cachedHashes, _ = hashCache.GetSigHashes(tx.Hash())
 	// }
-	if ContainsBlacklisted(b, tx, hardfork.Blacklist) {
-		return ruleError(ErrBlacklisted, "transaction contains blacklisted address ")
-	}
 	// Collect all of the transaction inputs and required information for
 	// validation.
 	txIns := tx.MsgTx().TxIn
@@ -219,6 +223,7 @@ func ValidateTransactionScripts(
 			continue
 		}
 		txVI := &txValidateItem{
+			txIndex:   -1,
 			txInIndex: txInIdx,
 			txIn:      txIn,
 			tx:        tx,
@@ -248,7 +253,7 @@ func checkBlockScripts(
 		numInputs += len(tx.MsgTx().TxIn)
 	}
 	txValItems := make([]*txValidateItem, 0, numInputs)
-	for _, tx := range block.Transactions() {
+	for txIdx, tx := range block.Transactions() {
 		// hash := tx.Hash()
 		// If the HashCache is present, and it doesn't yet contain the partial sighashes for this transaction, then we
 		// add the sighashes for the transaction. This allows us to take advantage of the potential speed savings due to
@@ -271,6 +276,7 @@ func checkBlockScripts(
 				continue
 			}
 			txVI := &txValidateItem{
+				txIndex:   txIdx,
 				txInIndex: txInIdx,
 				txIn:      txIn,
 				tx:        tx,
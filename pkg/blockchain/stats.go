@@ -0,0 +1,66 @@
+package blockchain
+
+import (
+	"github.com/p9c/parallelcoin/pkg/database"
+)
+
+// utxoStats holds the statistics of the reads and writes of the utxo set. They are kept for the whole process, as the
+// utxo views that do the reads are not tied to a chain.
+var utxoStats = struct {
+	// viewHits counts the outputs that were needed and were found in the view, or among the earlier transactions of a
+	// block, without going to the database.
+	viewHits database.Counter
+	// lookups counts the outputs looked up in the database, of which found were in the utxo set and missing were not.
+	lookups database.Counter
+	found   database.Counter
+	missing database.Counter
+	// stored and removed count the entries written to and removed from the utxo set in the database.
+	stored  database.Counter
+	removed database.Counter
+	// fetchTime is the distribution of how long each batch of lookups took, and storeTime of how long writing a view
+	// took.
+	fetchTime *database.Histogram
+	storeTime *database.Histogram
+}{
+	fetchTime: database.NewHistogram(database.DurationBounds),
+	storeTime: database.NewHistogram(database.DurationBounds),
+}
+
+// countUtxoLookup counts a lookup of an output in the database.
+func countUtxoLookup(entry *UtxoEntry) {
+	utxoStats.lookups.Inc()
+	if entry == nil {
+		utxoStats.missing.Inc()
+	} else {
+		utxoStats.found.Inc()
+	}
+}
+
+// Stats returns the statistics of the utxo set, merged with those of the database when it keeps any:
+//
+//   - utxo.view.hits counts the outputs that were needed and were already in the view
+//
+//   - utxo.fetch.lookups counts the outputs looked up in the database, of which utxo.fetch.found were in the utxo set and
+//     utxo.fetch.missing were not, and utxo.fetch.seconds is how long each batch of lookups took
+//
+//   - utxo.store.stored and utxo.store.removed count the entries written to and removed from the utxo set, and
+//     utxo.store.seconds is how long writing each view took
+//
+// The statistics of the utxo set are kept for all the chains in the process.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) Stats() database.Stats {
+	stats := database.NewStats()
+	if reporter, ok := b.db.(database.StatsReporter); ok {
+		stats.Merge(reporter.Stats())
+	}
+	stats.Counters["utxo.view.hits"] = utxoStats.viewHits.Value()
+	stats.Counters["utxo.fetch.lookups"] = utxoStats.lookups.Value()
+	stats.Counters["utxo.fetch.found"] = utxoStats.found.Value()
+	stats.Counters["utxo.fetch.missing"] = utxoStats.missing.Value()
+	stats.Counters["utxo.store.stored"] = utxoStats.stored.Value()
+	stats.Counters["utxo.store.removed"] = utxoStats.removed.Value()
+	stats.Histograms["utxo.fetch.seconds"] = utxoStats.fetchTime.Stats()
+	stats.Histograms["utxo.store.seconds"] = utxoStats.storeTime.Stats()
+	return stats
+}
@@ -0,0 +1,33 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// TestStats ensures lookups in the utxo set are counted in the statistics of the chain.
+func TestStats(t *testing.T) {
+	chain, teardown, e := chainSetup("stats", &chaincfg.RegressionTestParams)
+	if e != nil {
+		t.Fatalf("failed to setup chain instance: %v", e)
+	}
+	defer teardown()
+	before := chain.Stats()
+	// The outputs of the genesis block are never added to the utxo set.
+	coinbase := chain.params.GenesisBlock.Transactions[0].TxHash()
+	entry, e := chain.FetchUtxoEntry(wire.OutPoint{Hash: coinbase})
+	if e != nil || entry != nil {
+		t.Fatalf("FetchUtxoEntry: got entry %v and error %v, want neither", entry, e)
+	}
+	after := chain.Stats()
+	for _, name := range []string{"utxo.fetch.lookups", "utxo.fetch.missing"} {
+		if after.Counters[name] <= before.Counters[name] {
+			t.Errorf("Stats: %s did not grow from %d", name, before.Counters[name])
+		}
+	}
+	if _, ok := after.Histograms["utxo.fetch.seconds"]; !ok {
+		t.Errorf("Stats: no utxo.fetch.seconds histogram")
+	}
+}
@@ -0,0 +1,240 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/p9c/parallelcoin/pkg/amt"
+	"github.com/p9c/parallelcoin/pkg/block"
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/hardfork"
+	"github.com/p9c/parallelcoin/pkg/txscript"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// CoinSupply is the supply of coins at the tip of the main chain. The total always equals the mined coins plus the
+// hard fork disbursement less the burned coins.
+type CoinSupply struct {
+	Hash   chainhash.Hash
+	Height int32
+	// Total is the value of the unspent outputs of the chain.
+	Total amt.Amount
+	// Mined is the value of the block subsidies the coinbases of the chain have claimed, which does not count the
+	// transaction fees they collected or the hard fork disbursement.
+	Mined amt.Amount
+	// HardForkPayees and DevFund are the amounts paid to the hard fork payees and to the developer multisig by the
+	// activation block of the Plan 9 hard fork. Only the main and test networks make these payments, so they are zero
+	// on other networks, including those loaded from a network file, and below the activation height.
+	HardForkPayees amt.Amount
+	DevFund        amt.Amount
+	// Burned is the value of the coins that have been destroyed, being those sent to provably unspendable outputs and
+	// the transaction fees the coinbases did not claim.
+	Burned amt.Amount
+}
+
+// CoinSupply returns the supply of coins at the tip of the main chain, which is kept in the chain state as blocks are
+// connected and disconnected.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CoinSupply() CoinSupply {
+	snapshot := b.BestSnapshot()
+	return CoinSupply{
+		Hash:           snapshot.Hash,
+		Height:         snapshot.Height,
+		Total:          amt.Amount(snapshot.Supply),
+		Mined:          amt.Amount(snapshot.Mined),
+		HardForkPayees: amt.Amount(snapshot.HardForkPayees),
+		DevFund:        amt.Amount(snapshot.DevFund),
+		Burned:         amt.Amount(snapshot.Burned),
+	}
+}
+
+// supplyState is the supply of coins kept in the best chain state, in satoshi, or the change a block makes to it.
+type supplyState struct {
+	utxo    int64
+	mined   int64
+	payees  int64
+	devFund int64
+	burned  int64
+}
+
+// add returns the supply after connecting a block that makes the passed change.
+func (s supplyState) add(change supplyState) supplyState {
+	return supplyState{
+		utxo:    s.utxo + change.utxo,
+		mined:   s.mined + change.mined,
+		payees:  s.payees + change.payees,
+		devFund: s.devFund + change.devFund,
+		burned:  s.burned + change.burned,
+	}
+}
+
+// sub returns the supply after disconnecting a block that made the passed change.
+func (s supplyState) sub(change supplyState) supplyState {
+	return s.add(
+		supplyState{
+			utxo:    -change.utxo,
+			mined:   -change.mined,
+			payees:  -change.payees,
+			devFund: -change.devFund,
+			burned:  -change.burned,
+		},
+	)
+}
+
+// supplyChange returns the change in the supply when the block at the passed height is connected, given the outputs it
+// spends as listed in its spend journal entry.
+//
+// Besides the hard fork disbursement of the activation block, the coinbase may claim the subsidy and the fees of the
+// block. The subsidy it claims is mined and the fees it leaves unclaimed are burned, along with the outputs that can
+// never be spent.
+func supplyChange(
+	block *block.Block, height int32, stxos []SpentTxOut, params *chaincfg.Params,
+) (change supplyState) {
+	var coinbase, fees int64
+	for i, tx := range block.WireBlock().Transactions {
+		for _, txOut := range tx.TxOut {
+			if txscript.IsUnspendable(txOut.PkScript) {
+				change.burned += txOut.Value
+			} else {
+				change.utxo += txOut.Value
+			}
+			if i == 0 {
+				coinbase += txOut.Value
+			} else {
+				fees -= txOut.Value
+			}
+		}
+	}
+	for i := range stxos {
+		change.utxo -= stxos[i].Amount
+		fees += stxos[i].Amount
+	}
+	// The activation block pays the miner the subsidy of the block after it, plus the disbursement.
+	subsidyHeight := height
+	forks := params.Forks.Forks
+	if payees, devFund, ok := hardForkDisbursement(params); ok && len(forks) > 1 &&
+		height == forks[1].ActivationHeight {
+		change.payees, change.devFund = int64(payees), int64(devFund)
+		subsidyHeight++
+	}
+	claimed := coinbase - change.payees - change.devFund
+	subsidy := CalcBlockSubsidy(subsidyHeight, params, block.WireBlock().Header.Version)
+	switch {
+	case claimed > subsidy:
+		change.mined = subsidy
+	case claimed > 0:
+		change.mined = claimed
+	}
+	change.burned += fees - (claimed - change.mined)
+	return
+}
+
+// dbSumIssuance uses an existing database transaction to add up the supply of coins from the blocks of the main chain
+// ending at tip and their spend journal entries. Pruning removes these, so it fails for a pruned chain.
+func (b *BlockChain) dbSumIssuance(dbTx database.Tx, tip *BlockNode, interrupt <-chan struct{}) (
+	supply supplyState, e error,
+) {
+	if b.IsPruned() {
+		return supply, errors.New(
+			"the coin supply can not be added up for a pruned chain, the block chain must be downloaded again",
+		)
+	}
+	// The coinbase of the genesis block can not be spent, so it is not part of the supply.
+	for height := int32(1); height <= tip.height; height++ {
+		if height%10000 == 0 {
+			if interruptRequested(interrupt) {
+				return supply, errInterruptRequested
+			}
+			I.F("added up the coins issued by %d of %d blocks", height, tip.height)
+		}
+		var blk *block.Block
+		if blk, e = dbFetchBlockByNode(dbTx, tip.Ancestor(height)); E.Chk(e) {
+			return
+		}
+		var stxos []SpentTxOut
+		if stxos, e = dbFetchSpendJournalEntry(dbTx, blk); E.Chk(e) {
+			return
+		}
+		supply = supply.add(supplyChange(blk, height, stxos, b.params))
+	}
+	return
+}
+
+// hardForkDisbursement returns the total paid to the hard fork payees and the amount paid to the developer multisig by
+// the activation block of the Plan 9 hard fork of a network, as CreateHardForkSubsidyTx pays them, and whether the
+// network makes these payments.
+func hardForkDisbursement(params *chaincfg.Params) (payees, devFund amt.Amount, ok bool) {
+	switch params.Net {
+	case wire.MainNet:
+		for i := range hardfork.Payees {
+			payees += hardfork.Payees[i].Amount
+		}
+		return payees, hardfork.CoreAmount, true
+	case wire.TestNet3:
+		for i := range hardfork.TestnetPayees {
+			payees += hardfork.TestnetPayees[i].Amount
+		}
+		return payees, hardfork.TestnetCoreAmount, true
+	}
+	return 0, 0, false
+}
+
+// AlgoSubsidy is the block subsidy of a mining algorithm.
+type AlgoSubsidy struct {
+	Algo    string
+	Version int32
+	Subsidy amt.Amount
+}
+
+// SubsidyStep is the block subsidy of each mining algorithm at a height.
+type SubsidyStep struct {
+	Height int32
+	// HardFork is the number of the hard fork in effect at the height.
+	HardFork int
+	// Subsidies is the subsidy paid to the miner of a block of each algorithm of the hard fork, ordered by version.
+	Subsidies []AlgoSubsidy
+	// HardForkPayees and DevFund are paid in addition to the subsidy by the activation block of the Plan 9 hard fork,
+	// and are zero at other heights.
+	HardForkPayees amt.Amount
+	DevFund        amt.Amount
+}
+
+// SubsidySchedule returns the theoretical block subsidies of a network from the start to the end height, inclusive, at
+// every interval blocks. The subsidy depends only on the height before the Plan 9 hard fork, and on the height and the
+// target time of the algorithm after it.
+func SubsidySchedule(params *chaincfg.Params, start, end, interval int32) (steps []SubsidyStep, e error) {
+	if start < 0 || end < start || interval < 1 {
+		return nil, fmt.Errorf("invalid schedule of heights %d to %d every %d blocks", start, end, interval)
+	}
+	forks := params.Forks
+	payees, devFund, disburses := hardForkDisbursement(params)
+	steps = make([]SubsidyStep, 0, (end-start)/interval+1)
+	for height := start; height >= start && height <= end; height += interval {
+		hf := forks.GetCurrent(height)
+		step := SubsidyStep{
+			Height:    height,
+			HardFork:  hf,
+			Subsidies: make([]AlgoSubsidy, 0, len(forks.Forks[hf].AlgoSlice)),
+		}
+		// The activation block pays the miner the subsidy of the block after it, plus the disbursement.
+		subsidyHeight := height
+		if hf == 1 && height == forks.Forks[1].ActivationHeight && disburses {
+			step.HardForkPayees, step.DevFund = payees, devFund
+			subsidyHeight++
+		}
+		for _, algo := range forks.Forks[hf].AlgoSlice {
+			step.Subsidies = append(
+				step.Subsidies, AlgoSubsidy{
+					Algo:    algo.Name,
+					Version: algo.Version,
+					Subsidy: amt.Amount(CalcBlockSubsidy(subsidyHeight, params, algo.Version)),
+				},
+			)
+		}
+		steps = append(steps, step)
+	}
+	return
+}
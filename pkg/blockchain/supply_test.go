@@ -0,0 +1,122 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/p9c/parallelcoin/pkg/amt"
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/hardfork"
+	"github.com/p9c/parallelcoin/pkg/txscript"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// TestSubsidySchedule ensures the subsidy schedule halves before the hard fork and breaks out the disbursement of the
+// hard fork activation block.
+func TestSubsidySchedule(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	interval := params.SubsidyReductionInterval
+	steps, e := SubsidySchedule(params, 0, 2*interval, interval)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(steps) != 3 {
+		t.Fatalf("SubsidySchedule: got %d steps, want 3", len(steps))
+	}
+	for i, step := range steps {
+		want := amt.Amount(baseSubsidy >> uint(i))
+		if step.HardFork != 0 || len(step.Subsidies) != len(params.Forks.Forks[0].Algos) {
+			t.Fatalf("step %d: got hard fork %d with %d algorithms", i, step.HardFork, len(step.Subsidies))
+		}
+		for _, s := range step.Subsidies {
+			if s.Subsidy != want {
+				t.Errorf("step %d: got subsidy %v for %s, want %v", i, s.Subsidy, s.Algo, want)
+			}
+		}
+	}
+	activation := params.Forks.Forks[1].ActivationHeight
+	if steps, e = SubsidySchedule(params, activation, activation+1, 1); e != nil {
+		t.Fatal(e)
+	}
+	if steps[0].HardFork != 1 || steps[0].DevFund != hardfork.CoreAmount || steps[0].HardForkPayees == 0 {
+		t.Errorf("activation step: got hard fork %d paying %v to payees and %v to the developers", steps[0].HardFork,
+			steps[0].HardForkPayees, steps[0].DevFund)
+	}
+	if steps[1].HardForkPayees != 0 || steps[1].DevFund != 0 {
+		t.Error("step after activation: disbursement is not zero")
+	}
+	for i, s := range steps[0].Subsidies {
+		if s != steps[1].Subsidies[i] {
+			t.Errorf("activation step: got miner subsidy %v for %s, want %v", s.Subsidy, s.Algo,
+				steps[1].Subsidies[i].Subsidy)
+		}
+	}
+	if _, e = SubsidySchedule(params, 10, 5, 1); e == nil {
+		t.Error("SubsidySchedule: no error for an end before the start")
+	}
+}
+
+// TestCoinSupply ensures the supply follows blocks being connected and disconnected, and is added up from the blocks
+// of the chain for a chain state stored without it.
+func TestCoinSupply(t *testing.T) {
+	chain, teardown, e := chainSetup("coinsupply", tstEasyParams(t))
+	if e != nil {
+		t.Fatalf("failed to setup chain instance: %v", e)
+	}
+	defer teardown()
+	chain.TstSetCoinbaseMaturity(1)
+	first := tstMineBlock(t, chain)
+	firstMined := amt.Amount(first.WireBlock().Transactions[0].TxOut[0].Value)
+	// Send part of the spent coinbase to an unspendable output. The fee of the transaction is not claimed by the
+	// coinbase, so it is burned as well.
+	spend := tstSpendTx(first.WireBlock().Transactions[0])
+	spend.TxOut[1].Value -= 500
+	spend.AddTxOut(wire.NewTxOut(500, []byte{txscript.OP_RETURN}))
+	second := tstMineBlock(t, chain, spend)
+	want := CoinSupply{
+		Hash:   *second.Hash(),
+		Height: 2,
+		Mined:  firstMined + amt.Amount(second.WireBlock().Transactions[0].TxOut[0].Value),
+		Burned: 1500,
+	}
+	want.Total = want.Mined - want.Burned
+	if got := chain.CoinSupply(); got != want {
+		t.Fatalf("CoinSupply: got %+v, want %+v", got, want)
+	}
+	if e = chain.InvalidateBlock(second.Hash()); e != nil {
+		t.Fatal(e)
+	}
+	wantFirst := CoinSupply{Hash: *first.Hash(), Height: 1, Total: firstMined, Mined: firstMined}
+	if got := chain.CoinSupply(); got != wantFirst {
+		t.Fatalf("CoinSupply: got %+v after disconnecting a block, want %+v", got, wantFirst)
+	}
+	if e = chain.ReconsiderBlock(second.Hash()); e != nil {
+		t.Fatal(e)
+	}
+	// Store the chain state as it was before the mined, disbursed and burned coins were kept, and before the supply
+	// was kept.
+	for _, cut := range []int{32, 40} {
+		e = chain.db.Update(
+			func(dbTx database.Tx) (e error) {
+				serialized := dbTx.Metadata().Get(chainStateKeyName)
+				return dbTx.Metadata().Put(chainStateKeyName, append([]byte(nil), serialized[:len(serialized)-cut]...))
+			},
+		)
+		if e != nil {
+			t.Fatal(e)
+		}
+		reloaded, e := New(
+			&Config{
+				DB:          chain.db,
+				ChainParams: chain.params,
+				TimeSource:  NewMedianTime(),
+			},
+		)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if got := reloaded.CoinSupply(); got != want {
+			t.Fatalf("CoinSupply: got %+v added up from the blocks, want %+v", got, want)
+		}
+	}
+}
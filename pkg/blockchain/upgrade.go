@@ -3,13 +3,18 @@ package blockchain
 import (
 	"bytes"
 	"container/list"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"runtime"
+	"sync"
 	"time"
 	
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
 	chainhash "github.com/p9c/parallelcoin/pkg/chainhash"
 	"github.com/p9c/parallelcoin/pkg/wire"
 	database "github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/migration"
 )
 
 // blockHdrOffset defines the offsets into a v1 block index row for the block header.
@@ -564,30 +569,239 @@ func upgradeUtxoSetToV2(db database.DB, interrupt <-chan struct{}) (e error) {
 	return nil
 }
 
-// maybeUpgradeDbBuckets checks the database version of the buckets used by this package and performs any needed
-// upgrades to bring them to the latest version. All buckets used by this package are guaranteed to be the latest
-// version if this function returns without error.
-func (b *BlockChain) maybeUpgradeDbBuckets(interrupt <-chan struct{}) (e error) {
-	// Load or create bucket versions as needed.
-	var utxoSetVersion uint32
-	e = b.db.Update(
-		func(dbTx database.Tx) (e error) {
-			// Load the utxo set version from the database or create it and initialize it to version 1 if it doesn't exist.
-			utxoSetVersion, e = dbFetchOrCreateVersion(
-				dbTx,
-				utxoSetVersionKeyName, 1,
-			)
+// upgradeBlockIndexToV2 adds the proof of work hash of each block, computed with the algorithm of its version, to the
+// rows of the block index, in batches so that it can be interrupted and resumed. The hashes are also set on the nodes of
+// the passed block index already loaded into memory, when it is not nil. It is guaranteed to be updated if this returns
+// without failure.
+func upgradeBlockIndexToV2(
+	db database.DB, params *chaincfg.Params, index *blockIndex, interrupt <-chan struct{},
+) (e error) {
+	I.Ln("Upgrading block index to v2 to store the proof of work hash of each block. This will take a while")
+	start := time.Now()
+	const maxRows = 10000
+	type indexRow struct {
+		key, value []byte
+		powHash    chainhash.Hash
+	}
+	var seek []byte
+	var total int
+	for {
+		// Gather the next batch of rows that do not yet have their hash, resuming after the last key of the previous
+		// batch.
+		rows := make([]indexRow, 0, maxRows)
+		e = db.View(
+			func(dbTx database.Tx) (e error) {
+				cursor := dbTx.Metadata().Bucket(blockIndexBucketName).Cursor()
+				ok := cursor.First()
+				if seek != nil {
+					if ok = cursor.Seek(seek); ok && bytes.Equal(cursor.Key(), seek) {
+						ok = cursor.Next()
+					}
+				}
+				for ; ok && len(rows) < maxRows; ok = cursor.Next() {
+					if len(cursor.Value()) != blockHdrSize+1 {
+						continue
+					}
+					rows = append(
+						rows, indexRow{
+							key:   append([]byte(nil), cursor.Key()...),
+							value: append([]byte(nil), cursor.Value()...),
+						},
+					)
+				}
+				return nil
+			},
+		)
+		if e != nil {
+			return e
+		}
+		if len(rows) == 0 {
+			break
+		}
+		// Compute the hashes in parallel as for some algorithms they are expensive.
+		work := make(chan int)
+		errs := make([]error, len(rows))
+		var wg sync.WaitGroup
+		for w := 0; w < runtime.NumCPU(); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range work {
+					var header wire.BlockHeader
+					if errs[i] = header.Deserialize(bytes.NewReader(rows[i].value[:blockHdrSize])); errs[i] != nil {
+						continue
+					}
+					height := int32(binary.BigEndian.Uint32(rows[i].key[0:4]))
+					rows[i].powHash = header.BlockHashWithAlgos(height, params.Forks)
+				}
+			}()
+		}
+		for i := range rows {
+			work <- i
+		}
+		close(work)
+		wg.Wait()
+		e = db.Update(
+			func(dbTx database.Tx) (e error) {
+				bucket := dbTx.Metadata().Bucket(blockIndexBucketName)
+				for i := range rows {
+					if errs[i] != nil {
+						return errs[i]
+					}
+					value := make([]byte, blockHdrSize+1+chainhash.HashSize)
+					copy(value, rows[i].value)
+					copy(value[blockHdrSize+1:], rows[i].powHash[:])
+					if e = bucket.Put(rows[i].key, value); e != nil {
+						return e
+					}
+				}
+				return nil
+			},
+		)
+		if e != nil {
 			return e
+		}
+		if index != nil {
+			index.Lock()
+			for i := range rows {
+				var hash chainhash.Hash
+				copy(hash[:], rows[i].key[4:])
+				if node := index.index[hash]; node != nil {
+					powHash := rows[i].powHash
+					node.powHash = &powHash
+				}
+			}
+			index.Unlock()
+		}
+		seek = rows[len(rows)-1].key
+		total += len(rows)
+		I.F("added the proof of work hash of %d blocks (%d total)", len(rows), total)
+		if interruptRequested(interrupt) {
+			return errInterruptRequested
+		}
+	}
+	e = db.Update(
+		func(dbTx database.Tx) (e error) {
+			return dbPutVersion(dbTx, blockIndexVersionKeyName, 2)
 		},
 	)
 	if e != nil {
 		return e
 	}
-	// Update the utxo set to v2 if needed.
-	if utxoSetVersion < 2 {
-		if e := upgradeUtxoSetToV2(b.db, interrupt); E.Chk(e) {
-			return e
-		}
-	}
+	I.F(
+		"Done upgrading block index. Total blocks: %d in %d seconds",
+		total, int64(time.Since(start)/time.Second),
+	)
 	return nil
 }
+
+// blockIndexVersion is the VersionStore of the block index. The block index is at version 0 while the database still
+// has the block index keyed by hash alone, and at version 1 when it is keyed by height and hash but its version was not
+// stored yet.
+type blockIndexVersion struct {
+	db database.DB
+}
+
+// Version returns the version of the block index.
+//
+// This function is part of the migration.VersionStore interface implementation.
+func (v blockIndexVersion) Version() (version uint32, e error) {
+	e = v.db.View(
+		func(dbTx database.Tx) (e error) {
+			if dbTx.Metadata().Bucket(blockIndexBucketName) == nil {
+				return nil
+			}
+			if version = dbFetchVersion(dbTx, blockIndexVersionKeyName); version == 0 {
+				version = 1
+			}
+			return nil
+		},
+	)
+	return version, e
+}
+
+// PutVersion stores the version of the block index.
+//
+// This function is part of the migration.VersionStore interface implementation.
+func (v blockIndexVersion) PutVersion(version uint32) (e error) {
+	return v.db.Update(
+		func(dbTx database.Tx) (e error) {
+			return dbPutVersion(dbTx, blockIndexVersionKeyName, version)
+		},
+	)
+}
+
+// chainMigrations returns the subsystems of the chain database with the migrations that bring each of them to the
+// latest version. index is the block index loaded into memory, which is updated along with the database, and may be
+// nil.
+//
+// The latest version of each subsystem must match the version createChainState stores for it.
+func chainMigrations(db database.DB, params *chaincfg.Params, index *blockIndex) []*migration.Subsystem {
+	blockIndex := migration.NewSubsystem("block index", blockIndexVersion{db: db}, 0).Register(
+		migration.Migration{
+			Version:     1,
+			Description: "key the block index by height and hash",
+			Migrate: func(<-chan struct{}) error {
+				return migrateBlockIndex(db)
+			},
+		},
+		migration.Migration{
+			Version:     2,
+			Description: "store the proof of work hash of each block",
+			Migrate: func(interrupt <-chan struct{}) error {
+				return upgradeBlockIndexToV2(db, params, index, interrupt)
+			},
+		},
+	)
+	utxoSet := migration.NewSubsystem(
+		"utxo set", migration.DatabaseVersion(db, utxoSetVersionKeyName, 1), 1,
+	).Register(
+		migration.Migration{
+			Version:     2,
+			Description: "store each output under its own key",
+			Migrate: func(interrupt <-chan struct{}) error {
+				return upgradeUtxoSetToV2(db, interrupt)
+			},
+		},
+	)
+	spendJournal := migration.NewSubsystem(
+		"spend journal", migration.DatabaseVersion(db, spendJournalVersionKeyName, 1), 1,
+	)
+	return []*migration.Subsystem{blockIndex, utxoSet, spendJournal}
+}
+
+// MigrateDatabase brings the buckets of the chain in the passed database to the versions used by this package and
+// returns the migrations that were run, or that would be run in a dry run. A database that holds no chain yet is left
+// alone. It returns a *migration.VersionError without changing anything when the database was written by a newer
+// version of this package.
+func MigrateDatabase(db database.DB, params *chaincfg.Params, cfg *migration.Config) ([]migration.Step, error) {
+	return migrateDatabase(db, params, nil, cfg)
+}
+
+// migrateDatabase is MigrateDatabase, also updating the passed block index that is loaded into memory when it is not
+// nil.
+func migrateDatabase(
+	db database.DB, params *chaincfg.Params, index *blockIndex, cfg *migration.Config,
+) (steps []migration.Step, e error) {
+	var initialized bool
+	if e = db.View(
+		func(dbTx database.Tx) (e error) {
+			initialized = dbTx.Metadata().Get(chainStateKeyName) != nil
+			return nil
+		},
+	); E.Chk(e) {
+		return nil, e
+	}
+	if !initialized {
+		return nil, nil
+	}
+	return migration.Run(cfg, chainMigrations(db, params, index)...)
+}
+
+// maybeUpgradeDbBuckets checks the database version of the buckets used by this package and performs any needed
+// upgrades to bring them to the latest version. All buckets used by this package are guaranteed to be the latest
+// version if this function returns without error.
+func (b *BlockChain) maybeUpgradeDbBuckets(interrupt <-chan struct{}) (e error) {
+	_, e = migrateDatabase(b.db, b.params, b.Index, &migration.Config{Interrupt: interrupt})
+	return e
+}
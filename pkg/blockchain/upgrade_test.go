@@ -1,8 +1,14 @@
 package blockchain
 
 import (
+	"errors"
 	"reflect"
 	"testing"
+
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/migration"
 )
 
 // TestDeserializeUtxoEntryV0 ensures deserializing unspent trasaction output
@@ -108,3 +114,136 @@ func TestDeserializeUtxoEntryV0(t *testing.T) {
 		}
 	}
 }
+
+// TestUpgradeBlockIndexToV2 ensures block index rows without a proof of work hash are given theirs by the upgrade, and
+// that ReverifyPowHashes replaces a stored hash that is wrong.
+func TestUpgradeBlockIndexToV2(t *testing.T) {
+	chain, teardown, e := chainSetup("upgradeblockindex", &chaincfg.RegressionTestParams)
+	if e != nil {
+		t.Fatalf("failed to setup chain instance: %v", e)
+	}
+	defer teardown()
+	genesis := chain.BestChain.Genesis()
+	want := genesis.Header()
+	wantHash := want.BlockHashWithAlgos(0, chain.params.Forks)
+	key := blockIndexKey(&genesis.hash, 0)
+	// readRow returns the proof of work hash stored in the genesis block index row.
+	readRow := func() *chainhash.Hash {
+		var powHash *chainhash.Hash
+		e = chain.db.View(
+			func(dbTx database.Tx) (e error) {
+				_, _, powHash, _, e = deserializeBlockRow(dbTx.Metadata().Bucket(blockIndexBucketName).Get(key))
+				return e
+			},
+		)
+		if e != nil {
+			t.Fatalf("deserializeBlockRow: %v", e)
+		}
+		return powHash
+	}
+	if got := readRow(); got == nil || *got != wantHash {
+		t.Fatalf("new block index: got proof of work hash %v, want %v", got, wantHash)
+	}
+	// Rewrite the row in the version 1 format.
+	e = chain.db.Update(
+		func(dbTx database.Tx) (e error) {
+			bucket := dbTx.Metadata().Bucket(blockIndexBucketName)
+			row := bucket.Get(key)
+			if e = bucket.Put(key, append([]byte(nil), row[:blockHdrSize+1]...)); e != nil {
+				return e
+			}
+			return dbPutVersion(dbTx, blockIndexVersionKeyName, 1)
+		},
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got := readRow(); got != nil {
+		t.Fatalf("version 1 row: got proof of work hash %v", got)
+	}
+	genesis.powHash = nil
+	if e = chain.maybeUpgradeDbBuckets(nil); e != nil {
+		t.Fatalf("maybeUpgradeDbBuckets: %v", e)
+	}
+	if got := readRow(); got == nil || *got != wantHash {
+		t.Fatalf("upgraded block index: got proof of work hash %v, want %v", got, wantHash)
+	}
+	if genesis.powHash == nil || *genesis.powHash != wantHash {
+		t.Fatalf("upgraded block index: genesis node has proof of work hash %v", genesis.powHash)
+	}
+	var version uint32
+	_ = chain.db.View(
+		func(dbTx database.Tx) (e error) {
+			version = dbFetchVersion(dbTx, blockIndexVersionKeyName)
+			return nil
+		},
+	)
+	if version != latestBlockIndexBucketVersion {
+		t.Fatalf("upgraded block index: version %d, want %d", version, latestBlockIndexBucketVersion)
+	}
+	// A wrong stored hash is replaced when the hashes are re-verified.
+	genesis.powHash = &chainhash.Hash{1}
+	chain.Index.dirty[genesis] = struct{}{}
+	if e = chain.Index.flushToDB(); e != nil {
+		t.Fatal(e)
+	}
+	if e = chain.ReverifyPowHashes(2, nil); e != nil {
+		t.Fatalf("ReverifyPowHashes: %v", e)
+	}
+	if got := readRow(); got == nil || *got != wantHash {
+		t.Fatalf("re-verified block index: got proof of work hash %v, want %v", got, wantHash)
+	}
+}
+
+// TestMigrateDatabase ensures a new chain needs no migrations, that a dry run reports the pending ones without running
+// them and that a database with a bucket newer than this package knows of is refused without changing anything.
+func TestMigrateDatabase(t *testing.T) {
+	chain, teardown, e := chainSetup("migratedatabase", &chaincfg.RegressionTestParams)
+	if e != nil {
+		t.Fatalf("failed to setup chain instance: %v", e)
+	}
+	defer teardown()
+	steps, e := MigrateDatabase(chain.db, chain.params, &migration.Config{DryRun: true})
+	if e != nil || len(steps) != 0 {
+		t.Fatalf("new chain: got steps %v and error %v, want none", steps, e)
+	}
+	putVersion := func(key []byte, version uint32) {
+		e := chain.db.Update(
+			func(dbTx database.Tx) (e error) {
+				return dbPutVersion(dbTx, key, version)
+			},
+		)
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	fetchVersion := func(key []byte) (version uint32) {
+		_ = chain.db.View(
+			func(dbTx database.Tx) (e error) {
+				version = dbFetchVersion(dbTx, key)
+				return nil
+			},
+		)
+		return version
+	}
+	putVersion(blockIndexVersionKeyName, 1)
+	steps, e = MigrateDatabase(chain.db, chain.params, &migration.Config{DryRun: true})
+	if e != nil {
+		t.Fatalf("dry run: %v", e)
+	}
+	if len(steps) != 1 || steps[0].Subsystem != "block index" || steps[0].Version != 2 {
+		t.Fatalf("dry run: got steps %v, want the block index migration to version 2", steps)
+	}
+	if version := fetchVersion(blockIndexVersionKeyName); version != 1 {
+		t.Fatalf("dry run: block index version %d, want 1", version)
+	}
+	putVersion(utxoSetVersionKeyName, latestUtxoSetBucketVersion+1)
+	_, e = MigrateDatabase(chain.db, chain.params, &migration.Config{})
+	var versionErr *migration.VersionError
+	if !errors.As(e, &versionErr) || versionErr.Subsystem != "utxo set" {
+		t.Fatalf("newer utxo set: got error %v, want a version error", e)
+	}
+	if version := fetchVersion(blockIndexVersionKeyName); version != 1 {
+		t.Fatalf("newer utxo set: block index version %d, want 1", version)
+	}
+}
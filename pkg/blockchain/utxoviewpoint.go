@@ -3,6 +3,7 @@ package blockchain
 import (
 	"fmt"
 	"github.com/p9c/parallelcoin/pkg/block"
+	"time"
 	
 	"github.com/p9c/parallelcoin/pkg/chainhash"
 	"github.com/p9c/parallelcoin/pkg/database"
@@ -408,6 +409,7 @@ func (view *UtxoViewpoint) fetchUtxosMain(db database.DB, outpoints map[wire.Out
 	// NOTE: Missing entries are not considered an error here and instead will result in nil entries in the view. This
 	// is intentionally done so other code can use the presence of an entry in the store as a way to unnecessarily avoid
 	// attempting to reload it from the database.
+	defer utxoStats.fetchTime.ObserveSince(time.Now())
 	return db.View(
 		func(dbTx database.Tx) (e error) {
 			for outpoint := range outpoints {
@@ -415,6 +417,7 @@ func (view *UtxoViewpoint) fetchUtxosMain(db database.DB, outpoints map[wire.Out
 				if e != nil {
 					return e
 				}
+				countUtxoLookup(entry)
 				view.entries[outpoint] = entry
 			}
 			return nil
@@ -434,6 +437,7 @@ func (view *UtxoViewpoint) fetchUtxos(db database.DB, outpoints map[wire.OutPoin
 	for outpoint := range outpoints {
 		// Already loaded into the current view.
 		if _, ok := view.entries[outpoint]; ok {
+			utxoStats.viewHits.Inc()
 			continue
 		}
 		neededSet[outpoint] = struct{}{}
@@ -470,10 +474,12 @@ func (view *UtxoViewpoint) fetchInputUtxos(db database.DB, block *block.Block) (
 				i >= inFlightIndex {
 				originTx := transactions[inFlightIndex]
 				view.AddTxOuts(originTx, block.Height())
+				utxoStats.viewHits.Inc()
 				continue
 			}
 			// Don't request entries that are already in the view from the database.
 			if _, ok := view.entries[txIn.PreviousOutPoint]; ok {
+				utxoStats.viewHits.Inc()
 				continue
 			}
 			neededSet[txIn.PreviousOutPoint] = struct{}{}
@@ -542,5 +548,6 @@ func (b *BlockChain) FetchUtxoEntry(outpoint wire.OutPoint) (*UtxoEntry, error)
 	if e != nil {
 		return nil, e
 	}
+	countUtxoLookup(entry)
 	return entry, nil
 }
@@ -169,13 +169,18 @@ func (b *BlockChain) checkConnectBlock(
 	// by separating it we can avoid running the more expensive (though still relatively cheap as compared to running
 	// the scripts) checks against all the inputs when the signature operations are out of bounds.
 	var totalFees int64
-	for _, tx := range transactions {
+	for i, tx := range transactions {
+		// The spent outputs are only in the view until the transaction is connected, so the addresses they pay to are
+		// checked against the blacklist first.
+		if e = CheckTransactionBlacklist(tx, node.height, view, b.params); e != nil {
+			return ruleErrorAt(e, i)
+		}
 		txFee, e := CheckTransactionInputs(
 			tx, node.height, view,
 			b.params,
 		)
 		if e != nil {
-			return e
+			return ruleErrorAt(e, i)
 		}
 		// Sum the total fees and ensure we don't overflow the accumulator.
 		lastTotalFees := totalFees
@@ -213,10 +218,8 @@ func (b *BlockChain) checkConnectBlock(
 	}
 	// if this is the hard fork activation height special disbursement coinbase must match the specifications in
 	// pkg/chain/hardfork/subsidy.go
-	if node.height == fork.List[1].ActivationHeight &&
-		b.params.Net == wire.MainNet ||
-		node.height == fork.List[1].TestnetStart &&
-			b.params.Net == wire.TestNet3 {
+	if len(b.params.Forks.Forks) > 1 && node.height == b.params.Forks.Forks[1].ActivationHeight &&
+		(b.params.Net == wire.MainNet || b.params.Net == wire.TestNet3) {
 		F.Ln("checking contents of hardfork coinbase tx")
 		btx, e := block.Tx(0)
 		if e != nil {
@@ -375,13 +378,13 @@ func (b *BlockChain) checkConnectBlock(
 func (b *BlockChain) CheckConnectBlockTemplate(block *block.Block) (e error) {
 	algo := block.WireBlock().Header.Version
 	height := block.Height()
-	algoname := fork.GetAlgoName(algo, height)
-	powLimit := fork.GetMinDiff(algoname, height)
+	algoname := b.params.Forks.GetAlgoName(algo, height)
+	powLimit := b.params.Forks.GetMinDiff(algoname, height)
 	// Skip the proof of work check as this is just a block template.
 	flags := BFNoPoWCheck
 	// This only checks whether the block can be connected to the tip of the current chain.
 	b.ChainLock.Lock() // previously this was done before the above, it might be jumping the gun on a new block
-	defer b.ChainLock.Unlock()
+	defer b.unlockChain()
 	tip := b.BestChain.Tip()
 	// tip := b.BestChain.NodeByHeight(height)
 	header := block.WireBlock().Header
@@ -402,6 +405,7 @@ func (b *BlockChain) CheckConnectBlockTemplate(block *block.Block) (e error) {
 		false,
 		block.Height(),
 		tip.Header().Timestamp,
+		b.params.Forks,
 	); E.Chk(e) {
 		return e
 	}
@@ -497,7 +501,7 @@ func (b *BlockChain) checkBlockContext(
 		// The height of this block is one more than the referenced previous block.
 		blockHeight := prevNode.height + 1
 		// Ensure all transactions in the block are finalized.
-		for _, tx := range block.Transactions() {
+		for i, tx := range block.Transactions() {
 			if !IsFinalizedTransaction(
 				tx, blockHeight,
 				blockTime,
@@ -507,7 +511,7 @@ func (b *BlockChain) checkBlockContext(
 						"transaction %v", tx.Hash(),
 				)
 				E.Ln(str)
-				return ruleError(ErrUnfinalizedTx, str)
+				return ruleErrorAt(ruleError(ErrUnfinalizedTx, str), i)
 			}
 		}
 		// // Ensure coinbase starts with serialized block heights for blocks whose version is the serializedHeightVersion
@@ -584,7 +588,7 @@ func (b *BlockChain) checkBlockHeaderContext(
 		var expectedDifficulty uint32
 		expectedDifficulty, e = b.CalcNextRequiredDifficultyFromNode(
 			prevNode,
-			fork.GetAlgoName(header.Version, prevNode.height+1),
+			b.params.Forks.GetAlgoName(header.Version, prevNode.height+1),
 			true,
 		)
 		if e != nil {
@@ -602,9 +606,15 @@ func (b *BlockChain) checkBlockHeaderContext(
 				bits.CompactToBig(expectedDifficulty),
 			)
 			E.Ln(str)
-			return ruleError(ErrUnexpectedDifficulty, str)
+			re := ruleError(ErrUnexpectedDifficulty, str)
+			re.Detail = &RuleErrorDetail{
+				TxIndex:      -1,
+				InputIndex:   -1,
+				ExpectedBits: expectedDifficulty,
+			}
+			return re
 		}
-		if fork.GetCurrent(prevNode.height+1) > 0 {
+		if b.params.Forks.GetCurrent(prevNode.height+1) > 0 {
 			ct := header.Timestamp.Truncate(time.Second)
 			pt := prevNode.Header().Timestamp.Truncate(time.Second)
 			if ct.Sub(pt) < time.Second {
@@ -677,7 +687,7 @@ func CalcBlockSubsidy(height int32, chainParams *chaincfg.Params, version int32)
 		return int64(baseSubsidy)
 	}
 	// Equivalent to: baseSubsidy / 2^(height/subsidyHalvingInterval)
-	switch fork.GetCurrent(height) {
+	switch chainParams.Forks.GetCurrent(height) {
 	case 0:
 		return int64(baseSubsidy) >> uint64(
 			height/chainParams.
@@ -685,10 +695,8 @@ func CalcBlockSubsidy(height int32, chainParams *chaincfg.Params, version int32)
 		)
 	case 1:
 		var total amt.Amount
-		if (chainParams.Net == wire.MainNet &&
-			height == fork.List[1].ActivationHeight) ||
-			(chainParams.Net == wire.TestNet3 &&
-				height == fork.List[1].TestnetStart) {
+		if height == chainParams.Forks.Forks[1].ActivationHeight &&
+			(chainParams.Net == wire.MainNet || chainParams.Net == wire.TestNet3) {
 			payees := hardfork.Payees
 			if chainParams.Net == wire.TestNet3 {
 				payees = hardfork.TestnetPayees
@@ -702,7 +710,7 @@ func CalcBlockSubsidy(height int32, chainParams *chaincfg.Params, version int32)
 		}
 		// Plan 9 hard fork prescribes a smooth supply curve made using an exponential decay formula adjusted to fit the
 		// previous halving cycle and accounting for the block time difference
-		ttpb := float64(fork.List[1].Algos[fork.GetAlgoName(version, height)].VersionInterval)
+		ttpb := float64(chainParams.Forks.Forks[1].Algos[chainParams.Forks.GetAlgoName(version, height)].VersionInterval)
 		r = int64(2.7 * ttpb / 300 * (math.Pow(2.7, -float64(height)*300*9/ttpb/375000.0)) * 100000000 / 9)
 	}
 	return
@@ -711,7 +719,7 @@ func CalcBlockSubsidy(height int32, chainParams *chaincfg.Params, version int32)
 // CheckBlockSanity performs some preliminary checks on a block to ensure it is sane before continuing with block
 // processing.
 //
-// These checks are context free.
+// These checks are context free, apart from the hard fork schedule of the network.
 func CheckBlockSanity(
 	block *block.Block,
 	powLimit *big.Int,
@@ -719,15 +727,16 @@ func CheckBlockSanity(
 	DoNotCheckPow bool,
 	height int32,
 	prevBlockTimestamp time.Time,
+	forks *fork.Schedule,
 ) (e error) {
 	F.Ln("CheckBlockSanity powlimit %64x", powLimit)
-	return checkBlockSanity(block, powLimit, timeSource, BFNone, DoNotCheckPow, height, prevBlockTimestamp)
+	return checkBlockSanity(block, powLimit, timeSource, BFNone, DoNotCheckPow, height, prevBlockTimestamp, forks)
 }
 
 // CheckProofOfWork ensures the block header bits which indicate the target difficulty is in min/max range and that the
 // block hash is less than the target difficulty as claimed.
-func CheckProofOfWork(block *block.Block, powLimit *big.Int, height int32) (e error) {
-	return checkProofOfWork(&block.WireBlock().Header, powLimit, BFNone, height)
+func CheckProofOfWork(block *block.Block, powLimit *big.Int, height int32, forks *fork.Schedule) (e error) {
+	return checkProofOfWork(&block.WireBlock().Header, powLimit, BFNone, height, forks)
 }
 
 // CheckTransactionInputs performs a series of checks on the inputs to a transaction to ensure they are valid.
@@ -1153,10 +1162,11 @@ func checkBlockHeaderSanity(
 	flags BehaviorFlags,
 	height int32,
 	prevBlockTimestamp time.Time,
+	forks *fork.Schedule,
 ) (e error) {
 	// Ensure the proof of work bits in the block header is in min/max range and the
 	// block hash is less than the target value described by the bits.
-	e = checkProofOfWork(header, powLimit, flags, height)
+	e = checkProofOfWork(header, powLimit, flags, height, forks)
 	if e != nil {
 		E.F("%+v %v", header, e)
 		return e
@@ -1180,7 +1190,7 @@ func checkBlockHeaderSanity(
 		)
 		return ruleError(ErrTimeTooNew, str)
 	}
-	if fork.GetCurrent(height) > 0 {
+	if forks.GetCurrent(height) > 0 {
 		cbts := header.Timestamp.Truncate(time.Second)
 		pbts := prevBlockTimestamp.Truncate(time.Second)
 		D.Ln("TIMESTAMP PREV", pbts, "CANDIDATE", cbts)
@@ -1212,11 +1222,12 @@ func checkBlockSanity(
 	DoNotCheckPow bool,
 	height int32,
 	prevBlockTimestamp time.Time,
+	forks *fork.Schedule,
 ) (e error) {
 	T.F("checkBlockSanity %08x %064x", block.WireBlock().Header.Bits, powLimit)
 	msgBlock := block.WireBlock()
 	header := &msgBlock.Header
-	e = checkBlockHeaderSanity(header, powLimit, timeSource, flags, height, prevBlockTimestamp)
+	e = checkBlockHeaderSanity(header, powLimit, timeSource, flags, height, prevBlockTimestamp, forks)
 	if e != nil {
 		D.Ln("block processing error:", block.WireBlock().Header.Version, e)
 		return e
@@ -1263,10 +1274,10 @@ func checkBlockSanity(
 		}
 	}
 	// Do some preliminary checks on each transaction to ensure they are sane before continuing.
-	for _, tx := range transactions {
+	for i, tx := range transactions {
 		e := CheckTransactionSanity(tx)
 		if e != nil {
-			return e
+			return ruleErrorAt(e, i)
 		}
 	}
 	// Build merkle tree and ensure the calculated merkle root matches the entry in
@@ -1327,7 +1338,7 @@ func checkBlockSanity(
 //  difficulty is not performed.
 func checkProofOfWork(
 	header *wire.BlockHeader, powLimit *big.Int, flags BehaviorFlags,
-	height int32,
+	height int32, forks *fork.Schedule,
 ) (e error) {
 	// The target difficulty must be larger than zero.
 	if powLimit == nil {
@@ -1359,16 +1370,23 @@ func checkProofOfWork(
 	if flags&BFNoPoWCheck == 0 {
 		// The block hash must be less than the claimed target. Unless there is less
 		// than 10 previous with the same version (algo)...
-		hash := header.BlockHashWithAlgos(height)
-		bigHash := HashToBig(&hash)
-		if bigHash.Cmp(target) > 0 {
-			str := fmt.Sprintf(
-				"block hash of %d %064x is higher than expected max of %064x",
-				height, bigHash, target,
-			)
-			W.Ln(str)
-			return ruleError(ErrHighHash, str)
-		}
+		hash := header.BlockHashWithAlgos(height, forks)
+		return checkPowHash(&hash, target, height)
+	}
+	return nil
+}
+
+// checkPowHash ensures the proof of work hash of a block, computed with the algorithm of its version, is not higher
+// than its target.
+func checkPowHash(hash *chainhash.Hash, target *big.Int, height int32) (e error) {
+	bigHash := HashToBig(hash)
+	if bigHash.Cmp(target) > 0 {
+		str := fmt.Sprintf(
+			"block hash of %d %064x is higher than expected max of %064x",
+			height, bigHash, target,
+		)
+		W.Ln(str)
+		return ruleError(ErrHighHash, str)
 	}
 	return nil
 }
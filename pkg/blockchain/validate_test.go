@@ -145,6 +145,7 @@ func TestCheckBlockSanity(t *testing.T) {
 		false,
 		1,
 		block.WireBlock().Header.Timestamp.Truncate(time.Second).Add(-time.Second),
+		chaincfg.MainNetParams.Forks,
 	)
 	if e != nil  {
 		t.Errorf("CheckBlockSanity: %v", e)
@@ -159,6 +160,7 @@ func TestCheckBlockSanity(t *testing.T) {
 		false,
 		1,
 		block.WireBlock().Header.Timestamp.Truncate(time.Second).Add(-time.Second),
+		chaincfg.MainNetParams.Forks,
 	)
 	if e ==  nil {
 		t.Errorf("CheckBlockSanity: error is nil when it shouldn't be")
@@ -0,0 +1,299 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/p9c/parallelcoin/pkg/block"
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/txscript"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// VerifyLevel is how thoroughly VerifyChain checks each block, each level including the checks of the levels below it.
+type VerifyLevel int32
+
+const (
+	// VerifyHeaders checks the stored block matches its block index entry and that its proof of work hash, computed
+	// with the algorithm of its version at its height, meets its target and matches the hash in the block index.
+	VerifyHeaders VerifyLevel = iota
+	// VerifyBlocks also performs the context free sanity checks on the block and its transactions.
+	VerifyBlocks
+	// VerifySpendJournal also checks the spend journal of the block against the utxo set, by disconnecting the blocks
+	// from a scratch view of the utxo set in turn, starting at the tip.
+	VerifySpendJournal
+	// VerifyReconnect also reconnects the disconnected blocks to the scratch view with full validation, including the
+	// scripts, and checks the outputs they spend match their spend journals and the resulting view matches the utxo set.
+	VerifyReconnect
+)
+
+// VerifyChainError is the first problem VerifyChain found with a block of the main chain.
+type VerifyChainError struct {
+	Hash   chainhash.Hash
+	Height int32
+	// Level is the verification level of the check that failed.
+	Level VerifyLevel
+	Err   error
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e *VerifyChainError) Error() string {
+	return fmt.Sprintf("block %v at height %d failed level %d verification: %v", e.Hash, e.Height, e.Level, e.Err)
+}
+
+// Unwrap returns the error of the check that failed.
+func (e *VerifyChainError) Unwrap() error {
+	return e.Err
+}
+
+// verifyFailed returns a VerifyChainError for a block.
+func verifyFailed(node *BlockNode, level VerifyLevel, e error) error {
+	return &VerifyChainError{Hash: node.hash, Height: node.height, Level: level, Err: e}
+}
+
+// VerifyChain checks the stored data of the given number of blocks at the end of the main chain, walking back from the
+// tip, to the given level. A depth of zero or less, or more than the height of the tip, means every block after the
+// genesis block. Verification stops early at a block whose data has been pruned.
+//
+// The error returned for a block that fails a check is a *VerifyChainError. Verification can be cancelled by closing
+// the interrupt channel.
+//
+// The reconnect level keeps the utxos spent and created by all of the verified blocks in memory, so it is best limited
+// to a depth of recent blocks.
+//
+// This function is safe for concurrent access. Blocks are not processed while it runs.
+func (b *BlockChain) VerifyChain(level VerifyLevel, depth int32, interrupt <-chan struct{}) (e error) {
+	b.ChainLock.Lock()
+	defer b.unlockChain()
+	tip := b.BestChain.Tip()
+	if depth <= 0 || depth > tip.height {
+		depth = tip.height
+	}
+	I.F("verifying the last %d blocks of the chain at level %d", depth, level)
+	view := NewUtxoViewpoint()
+	view.SetBestHash(&tip.hash)
+	nodes := make([]*BlockNode, 0, depth)
+	for node := tip; len(nodes) < int(depth); node = node.parent {
+		if interruptRequested(interrupt) {
+			return errInterruptRequested
+		}
+		if !b.Index.NodeStatus(node).HaveData() {
+			I.F("stopping verification at block %v at height %d as its data was pruned", node.hash, node.height)
+			break
+		}
+		var blk *block.Block
+		if e = b.db.View(
+			func(dbTx database.Tx) (e error) {
+				blk, e = dbFetchBlockByNode(dbTx, node)
+				return e
+			},
+		); E.Chk(e) {
+			return verifyFailed(node, VerifyHeaders, e)
+		}
+		if e = b.verifyBlockHeader(node, blk); e != nil {
+			return verifyFailed(node, VerifyHeaders, e)
+		}
+		if level >= VerifyBlocks {
+			if e = b.verifyBlockSanity(node, blk); e != nil {
+				return verifyFailed(node, VerifyBlocks, e)
+			}
+		}
+		if level >= VerifySpendJournal {
+			if e = b.verifySpendJournal(blk, view); e != nil {
+				return verifyFailed(node, VerifySpendJournal, e)
+			}
+		}
+		nodes = append(nodes, node)
+		if len(nodes)%10000 == 0 {
+			I.F("verified %d blocks, down to height %d", len(nodes), node.height)
+		}
+	}
+	if level >= VerifyReconnect {
+		for i := len(nodes) - 1; i >= 0; i-- {
+			if interruptRequested(interrupt) {
+				return errInterruptRequested
+			}
+			if e = b.verifyReconnect(nodes[i], view); e != nil {
+				return verifyFailed(nodes[i], VerifyReconnect, e)
+			}
+		}
+		if e = b.verifyUtxoView(view); e != nil {
+			return verifyFailed(tip, VerifyReconnect, e)
+		}
+	}
+	I.F("verified %d blocks at level %d", len(nodes), level)
+	return nil
+}
+
+// verifyBlockHeader checks a stored block matches its block index entry and its proof of work.
+func (b *BlockChain) verifyBlockHeader(node *BlockNode, blk *block.Block) (e error) {
+	header := &blk.WireBlock().Header
+	if !blk.Hash().IsEqual(&node.hash) {
+		return fmt.Errorf("stored block has hash %v", blk.Hash())
+	}
+	if node.parent != nil && !header.PrevBlock.IsEqual(&node.parent.hash) {
+		return fmt.Errorf("previous block is %v instead of %v", header.PrevBlock, node.parent.hash)
+	}
+	if node.height == 0 {
+		return nil
+	}
+	var powHash chainhash.Hash
+	if powHash, e = b.checkHeaderPow(header, node.height); e != nil {
+		return e
+	}
+	if node.powHash != nil && *node.powHash != powHash {
+		return fmt.Errorf("proof of work hash is %v but the block index has %v", powHash, node.powHash)
+	}
+	return nil
+}
+
+// verifyBlockSanity performs the context free checks of a block other than its proof of work, which is checked by
+// verifyBlockHeader.
+func (b *BlockChain) verifyBlockSanity(node *BlockNode, blk *block.Block) (e error) {
+	forks := b.params.Forks
+	powLimit := forks.GetMinDiff(forks.GetAlgoName(node.version, node.height), node.height)
+	prevTimestamp := node.Header().Timestamp
+	if node.parent != nil {
+		prevTimestamp = node.parent.Header().Timestamp
+	}
+	return checkBlockSanity(blk, powLimit, b.timeSource, BFNoPoWCheck, false, node.height, prevTimestamp, forks)
+}
+
+// verifySpendJournal checks the spend journal of a block against a view holding the utxo set as it was after the block
+// was connected, and then disconnects the block from the view with the spend journal.
+//
+// The outputs the block spends must be spent in the view and its outputs that are not spent by itself must be unspent,
+// with the amounts and scripts of the block.
+func (b *BlockChain) verifySpendJournal(blk *block.Block, view *UtxoViewpoint) (e error) {
+	var stxos []SpentTxOut
+	if e = b.db.View(
+		func(dbTx database.Tx) (e error) {
+			stxos, e = dbFetchSpendJournalEntry(dbTx, blk)
+			return e
+		},
+	); e != nil {
+		return e
+	}
+	if len(stxos) != countSpentOutputs(blk) {
+		return fmt.Errorf("spend journal has %d entries for %d spent outputs", len(stxos), countSpentOutputs(blk))
+	}
+	transactions := blk.Transactions()
+	spent := make(map[wire.OutPoint]struct{})
+	for _, tx := range transactions[1:] {
+		for _, txIn := range tx.MsgTx().TxIn {
+			spent[txIn.PreviousOutPoint] = struct{}{}
+		}
+	}
+	needed := make(map[wire.OutPoint]struct{}, len(spent))
+	for outpoint := range spent {
+		needed[outpoint] = struct{}{}
+	}
+	for _, tx := range transactions {
+		for txOutIdx, txOut := range tx.MsgTx().TxOut {
+			if !txscript.IsUnspendable(txOut.PkScript) {
+				needed[wire.OutPoint{Hash: *tx.Hash(), Index: uint32(txOutIdx)}] = struct{}{}
+			}
+		}
+	}
+	if e = view.fetchUtxos(b.db, needed); e != nil {
+		return e
+	}
+	for outpoint := range spent {
+		if entry := view.LookupEntry(outpoint); entry != nil && !entry.IsSpent() {
+			return fmt.Errorf("spent output %v is in the utxo set", outpoint)
+		}
+	}
+	for _, tx := range transactions {
+		for txOutIdx, txOut := range tx.MsgTx().TxOut {
+			outpoint := wire.OutPoint{Hash: *tx.Hash(), Index: uint32(txOutIdx)}
+			if _, ok := spent[outpoint]; ok || txscript.IsUnspendable(txOut.PkScript) {
+				continue
+			}
+			entry := view.LookupEntry(outpoint)
+			switch {
+			case entry == nil || entry.IsSpent():
+				return fmt.Errorf("output %v is missing from the utxo set", outpoint)
+			case entry.Amount() != txOut.Value || !bytes.Equal(entry.PkScript(), txOut.PkScript):
+				return fmt.Errorf(
+					"output %v of %v to %x is %v to %x in the utxo set", outpoint, txOut.Value, txOut.PkScript,
+					entry.Amount(), entry.PkScript(),
+				)
+			case entry.BlockHeight() != blk.Height():
+				return fmt.Errorf("output %v is at height %d in the utxo set", outpoint, entry.BlockHeight())
+			}
+		}
+	}
+	return view.disconnectTransactions(b.db, blk, stxos)
+}
+
+// verifyReconnect connects a block disconnected by verifySpendJournal back to the view with full validation, and checks
+// the outputs it spends match its spend journal.
+func (b *BlockChain) verifyReconnect(node *BlockNode, view *UtxoViewpoint) (e error) {
+	var blk *block.Block
+	var journal []SpentTxOut
+	if e = b.db.View(
+		func(dbTx database.Tx) (e error) {
+			if blk, e = dbFetchBlockByNode(dbTx, node); e != nil {
+				return e
+			}
+			journal, e = dbFetchSpendJournalEntry(dbTx, blk)
+			return e
+		},
+	); e != nil {
+		return e
+	}
+	stxos := make([]SpentTxOut, 0, len(journal))
+	if e = b.checkConnectBlock(node, blk, view, &stxos); e != nil {
+		return e
+	}
+	if len(stxos) != len(journal) {
+		return fmt.Errorf("block spends %d outputs but the spend journal has %d", len(stxos), len(journal))
+	}
+	for i := range stxos {
+		got, want := &stxos[i], &journal[i]
+		// Legacy spend journal entries only have the height and coinbase flag of the last output spent of a
+		// transaction.
+		legacy := want.Height == 0
+		if got.Amount != want.Amount || !bytes.Equal(got.PkScript, want.PkScript) ||
+			(!legacy && (got.Height != want.Height || got.IsCoinBase != want.IsCoinBase)) {
+			return fmt.Errorf(
+				"spent output %d of %v to %x at height %d does not match the spend journal entry of %v to %x at "+
+					"height %d", i, got.Amount, got.PkScript, got.Height, want.Amount, want.PkScript, want.Height,
+			)
+		}
+	}
+	return nil
+}
+
+// verifyUtxoView checks the entries of a view that has been disconnected and reconnected up to the tip of the main
+// chain match the utxo set.
+func (b *BlockChain) verifyUtxoView(view *UtxoViewpoint) (e error) {
+	if !view.BestHash().IsEqual(&b.BestChain.Tip().hash) {
+		return fmt.Errorf("reconnected blocks end at %v instead of the tip", view.BestHash())
+	}
+	return b.db.View(
+		func(dbTx database.Tx) (e error) {
+			for outpoint, entry := range view.entries {
+				var stored *UtxoEntry
+				if stored, e = dbFetchUtxoEntry(dbTx, outpoint); e != nil {
+					return e
+				}
+				if entry == nil || entry.IsSpent() {
+					if stored != nil && !stored.IsSpent() {
+						return fmt.Errorf("spent output %v is in the utxo set", outpoint)
+					}
+					continue
+				}
+				switch {
+				case stored == nil || stored.IsSpent():
+					return fmt.Errorf("output %v is missing from the utxo set", outpoint)
+				case stored.Amount() != entry.Amount() || !bytes.Equal(stored.PkScript(), entry.PkScript()) ||
+					stored.BlockHeight() != entry.BlockHeight() || stored.IsCoinBase() != entry.IsCoinBase():
+					return fmt.Errorf("output %v differs from the utxo set", outpoint)
+				}
+			}
+			return nil
+		},
+	)
+}
@@ -0,0 +1,92 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/p9c/parallelcoin/pkg/block"
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// TestVerifyChain ensures VerifyChain passes a valid chain at every level, and reports a corrupt spend journal and
+// utxo set at the levels that check them.
+func TestVerifyChain(t *testing.T) {
+	chain, teardown, e := chainSetup("verifychain", tstEasyParams(t))
+	if e != nil {
+		t.Fatalf("failed to setup chain instance: %v", e)
+	}
+	defer teardown()
+	chain.TstSetCoinbaseMaturity(1)
+	first := tstMineBlock(t, chain)
+	second := tstMineBlock(t, chain)
+	spend := tstSpendTx(first.WireBlock().Transactions[0])
+	spender := tstMineBlock(t, chain, spend)
+	tstMineBlock(t, chain, tstSpendTx(second.WireBlock().Transactions[0]))
+	for level := VerifyHeaders; level <= VerifyReconnect; level++ {
+		if e = chain.VerifyChain(level, 0, nil); e != nil {
+			t.Fatalf("VerifyChain level %d: %v", level, e)
+		}
+	}
+	interrupt := make(chan struct{})
+	close(interrupt)
+	if e = chain.VerifyChain(VerifyReconnect, 0, interrupt); e != errInterruptRequested {
+		t.Fatalf("VerifyChain: got %v after an interrupt, want %v", e, errInterruptRequested)
+	}
+	// Change the amount of the output spent by the spending block in its spend journal. The output is restored with the
+	// wrong amount when the block is disconnected, which is found when the block that created it is checked.
+	tstEditSpendJournal(t, chain, spender, func(stxo *SpentTxOut) { stxo.Amount-- })
+	e = chain.VerifyChain(VerifySpendJournal, 0, nil)
+	var ve *VerifyChainError
+	if !errors.As(e, &ve) || ve.Level != VerifySpendJournal || ve.Hash != *first.Hash() {
+		t.Fatalf("VerifyChain: got %v with a wrong spend journal amount, want a level %d failure of block %v", e,
+			VerifySpendJournal, first.Hash())
+	}
+	tstEditSpendJournal(t, chain, spender, func(stxo *SpentTxOut) { stxo.Amount++ })
+	// Clear the coinbase flag of the output, which only reconnecting the block shows.
+	tstEditSpendJournal(t, chain, spender, func(stxo *SpentTxOut) { stxo.IsCoinBase = false })
+	if e = chain.VerifyChain(VerifySpendJournal, 0, nil); e != nil {
+		t.Fatalf("VerifyChain: got %v at level %d with a wrong spend journal flag", e, VerifySpendJournal)
+	}
+	e = chain.VerifyChain(VerifyReconnect, 0, nil)
+	if !errors.As(e, &ve) || ve.Level != VerifyReconnect || ve.Hash != *spender.Hash() {
+		t.Fatalf("VerifyChain: got %v with a wrong spend journal flag, want a level %d failure of block %v", e,
+			VerifyReconnect, spender.Hash())
+	}
+	// Remove an unspent output of the spending transaction from the utxo set.
+	e = chain.db.Update(
+		func(dbTx database.Tx) (e error) {
+			key := outpointKey(wire.OutPoint{Hash: spend.TxHash(), Index: 1})
+			defer recycleOutpointKey(key)
+			return dbTx.Metadata().Bucket(utxoSetBucketName).Delete(*key)
+		},
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e = chain.VerifyChain(VerifyBlocks, 0, nil); e != nil {
+		t.Fatalf("VerifyChain: got %v at level %d with a missing utxo", e, VerifyBlocks)
+	}
+	e = chain.VerifyChain(VerifySpendJournal, 0, nil)
+	if !errors.As(e, &ve) || ve.Level != VerifySpendJournal || ve.Hash != *spender.Hash() {
+		t.Fatalf("VerifyChain: got %v with a missing utxo, want a level %d failure of block %v", e,
+			VerifySpendJournal, spender.Hash())
+	}
+}
+
+// tstEditSpendJournal changes the first entry of the spend journal of a block.
+func tstEditSpendJournal(t *testing.T, chain *BlockChain, blk *block.Block, edit func(stxo *SpentTxOut)) {
+	e := chain.db.Update(
+		func(dbTx database.Tx) (e error) {
+			var stxos []SpentTxOut
+			if stxos, e = dbFetchSpendJournalEntry(dbTx, blk); e != nil {
+				return e
+			}
+			edit(&stxos[0])
+			return dbPutSpendJournalEntry(dbTx, blk.Hash(), stxos)
+		},
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+}
@@ -29,6 +29,31 @@ func NewNodeCmd(subCmd NodeSubCmd, target string, connectSubCmd *string) *NodeCm
 	}
 }
 
+// BackupDBCmd defines the backupdb JSON-RPC command, which writes a consistent copy of the block database to a new
+// directory while the node keeps running. Progress is reported in the log of the node. This command is not a standard
+// Bitcoin command. It is an extension for pod.
+type BackupDBCmd struct {
+	Dest string
+}
+
+// NewBackupDBCmd returns a new BackupDBCmd which can be used to issue a backupdb JSON-RPC command. This command is not
+// a standard Bitcoin command. It is an extension for pod.
+func NewBackupDBCmd(dest string) *BackupDBCmd {
+	return &BackupDBCmd{
+		Dest: dest,
+	}
+}
+
+// GetDBStatsCmd defines the getdbstats JSON-RPC command, which returns the statistics the block database and the utxo
+// set keep of their operation. This command is not a standard Bitcoin command. It is an extension for pod.
+type GetDBStatsCmd struct{}
+
+// NewGetDBStatsCmd returns a new GetDBStatsCmd which can be used to issue a getdbstats JSON-RPC command. This command
+// is not a standard Bitcoin command. It is an extension for pod.
+func NewGetDBStatsCmd() *GetDBStatsCmd {
+	return &GetDBStatsCmd{}
+}
+
 // DebugLevelCmd defines the debuglevel JSON-RPC command. This command is not a standard Bitcoin command. It is an
 // extension for pod.
 type DebugLevelCmd struct {
@@ -55,6 +80,22 @@ func NewGenerateCmd(numBlocks uint32) *GenerateCmd {
 	}
 }
 
+// GetAlgoStatsCmd defines the getalgostats JSON-RPC command. This command is not a standard Bitcoin command. It is an
+// extension for pod.
+type GetAlgoStatsCmd struct {
+	Blocks *int `jsonrpcdefault:"120"`
+	Height *int `jsonrpcdefault:"-1"`
+}
+
+// NewGetAlgoStatsCmd returns a new instance which can be used to issue a getalgostats JSON-RPC command. The parameters
+// which are pointers indicate they are optional. Passing nil for optional parameters will use the default value.
+func NewGetAlgoStatsCmd(numBlocks, height *int) *GetAlgoStatsCmd {
+	return &GetAlgoStatsCmd{
+		Blocks: numBlocks,
+		Height: height,
+	}
+}
+
 // GetBestBlockCmd defines the getbestblock JSON-RPC command.
 type GetBestBlockCmd struct{}
 
@@ -86,6 +127,21 @@ func NewGetHeadersCmd(blockLocators []string, hashStop string) *GetHeadersCmd {
 	}
 }
 
+// GetRejectedBlocksCmd defines the getrejectedblocks JSON-RPC command. This command is not a standard Bitcoin command.
+// It is an extension for pod.
+type GetRejectedBlocksCmd struct {
+	Count *int `jsonrpcdefault:"10"`
+}
+
+// NewGetRejectedBlocksCmd returns a new instance which can be used to issue a getrejectedblocks JSON-RPC command. The
+// parameters which are pointers indicate they are optional. Passing nil for optional parameters will use the default
+// value.
+func NewGetRejectedBlocksCmd(count *int) *GetRejectedBlocksCmd {
+	return &GetRejectedBlocksCmd{
+		Count: count,
+	}
+}
+
 // VersionCmd defines the version JSON-RPC command. NOTE: This is a btcsuite extension ported from github.com/decred/dcrd/dcrjson.
 type VersionCmd struct{}
 
@@ -98,11 +154,15 @@ func init() {
 
 	// No special flags for commands in this file.
 	flags := UsageFlag(0)
+	MustRegisterCmd("backupdb", (*BackupDBCmd)(nil), flags)
 	MustRegisterCmd("debuglevel", (*DebugLevelCmd)(nil), flags)
 	MustRegisterCmd("node", (*NodeCmd)(nil), flags)
 	MustRegisterCmd("generate", (*GenerateCmd)(nil), flags)
+	MustRegisterCmd("getalgostats", (*GetAlgoStatsCmd)(nil), flags)
 	MustRegisterCmd("getbestblock", (*GetBestBlockCmd)(nil), flags)
 	MustRegisterCmd("getcurrentnet", (*GetCurrentNetCmd)(nil), flags)
+	MustRegisterCmd("getdbstats", (*GetDBStatsCmd)(nil), flags)
 	MustRegisterCmd("getheaders", (*GetHeadersCmd)(nil), flags)
+	MustRegisterCmd("getrejectedblocks", (*GetRejectedBlocksCmd)(nil), flags)
 	MustRegisterCmd("version", (*VersionCmd)(nil), flags)
 }
@@ -23,6 +23,30 @@ func TestPodExtCmds(t *testing.T) {
 		marshalled   string
 		unmarshalled interface{}
 	}{
+		{
+			name: "backupdb",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("backupdb", "/backups/blocks")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewBackupDBCmd("/backups/blocks")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"backupdb","netparams":["/backups/blocks"],"id":1}`,
+			unmarshalled: &btcjson.BackupDBCmd{
+				Dest: "/backups/blocks",
+			},
+		},
+		{
+			name: "getdbstats",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getdbstats")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetDBStatsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getdbstats","netparams":[],"id":1}`,
+			unmarshalled: &btcjson.GetDBStatsCmd{},
+		},
 		{
 			name: "debuglevel",
 			newCmd: func() (interface{}, error) {
@@ -107,6 +131,34 @@ func TestPodExtCmds(t *testing.T) {
 				NumBlocks: 1,
 			},
 		},
+		{
+			name: "getalgostats",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getalgostats")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAlgoStatsCmd(nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getalgostats","netparams":[],"id":1}`,
+			unmarshalled: &btcjson.GetAlgoStatsCmd{
+				Blocks: btcjson.Int(120),
+				Height: btcjson.Int(-1),
+			},
+		},
+		{
+			name: "getalgostats optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getalgostats", 3600, 2500100)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAlgoStatsCmd(btcjson.Int(3600), btcjson.Int(2500100))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getalgostats","netparams":[3600,2500100],"id":1}`,
+			unmarshalled: &btcjson.GetAlgoStatsCmd{
+				Blocks: btcjson.Int(3600),
+				Height: btcjson.Int(2500100),
+			},
+		},
 		{
 			name: "getbestblock",
 			newCmd: func() (interface{}, error) {
@@ -173,6 +225,32 @@ func TestPodExtCmds(t *testing.T) {
 				HashStop: "000000000000000000ba33b33e1fad70b69e234fc24414dd47113bff38f523f7",
 			},
 		},
+		{
+			name: "getrejectedblocks",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getrejectedblocks")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetRejectedBlocksCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getrejectedblocks","netparams":[],"id":1}`,
+			unmarshalled: &btcjson.GetRejectedBlocksCmd{
+				Count: btcjson.Int(10),
+			},
+		},
+		{
+			name: "getrejectedblocks optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getrejectedblocks", 50)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetRejectedBlocksCmd(btcjson.Int(50))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getrejectedblocks","netparams":[50],"id":1}`,
+			unmarshalled: &btcjson.GetRejectedBlocksCmd{
+				Count: btcjson.Int(50),
+			},
+		},
 		{
 			name: "version",
 			newCmd: func() (interface{}, error) {
@@ -9,3 +9,63 @@ type VersionResult struct {
 	Prerelease    string `json:"prerelease"`
 	BuildMetadata string `json:"buildmetadata"`
 }
+
+// AlgoStatsResult models the statistics of one mining algorithm in the getalgostats response. This is an extension for
+// pod.
+type AlgoStatsResult struct {
+	Algo         string  `json:"algo"`
+	Version      int32   `json:"version"`
+	Blocks       int32   `json:"blocks"`
+	AvgSpacing   float64 `json:"avgspacing"`
+	Bits         string  `json:"bits"`
+	Difficulty   float64 `json:"difficulty"`
+	HashesPerSec float64 `json:"hashespersec"`
+}
+
+// GetAlgoStatsResult models the data returned from the getalgostats command. This is an extension for pod.
+type GetAlgoStatsResult struct {
+	Height int32             `json:"height"`
+	Blocks int32             `json:"blocks"`
+	Algos  []AlgoStatsResult `json:"algos"`
+}
+
+// RejectedBlockResult models a block rejected for breaking a consensus rule in the getrejectedblocks response. The
+// transaction and input indexes are -1 when the rule is not about a transaction or input, and the expected bits are
+// only set when the difficulty of the block was wrong. This is an extension for pod.
+type RejectedBlockResult struct {
+	Hash         string `json:"hash"`
+	Height       int32  `json:"height"`
+	Algo         string `json:"algo"`
+	Time         int64  `json:"time"`
+	Code         string `json:"code"`
+	Reason       string `json:"reason"`
+	ExpectedBits string `json:"expectedbits,omitempty"`
+	ActualBits   string `json:"actualbits"`
+	TxIndex      int    `json:"txindex"`
+	InputIndex   int    `json:"inputindex"`
+	ScriptError  string `json:"scripterror,omitempty"`
+}
+
+// DBHistogramBucketResult models the number of values up to and including an upper bound in a histogram of the
+// getdbstats response. This is an extension for pod.
+type DBHistogramBucketResult struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+// DBHistogramResult models a histogram in the getdbstats response. The buckets are cumulative, and the values greater
+// than the last bound are only counted in the count. This is an extension for pod.
+type DBHistogramResult struct {
+	Count   uint64                    `json:"count"`
+	Sum     float64                   `json:"sum"`
+	Min     float64                   `json:"min"`
+	Max     float64                   `json:"max"`
+	Buckets []DBHistogramBucketResult `json:"buckets"`
+}
+
+// GetDBStatsResult models the data returned from the getdbstats command. This is an extension for pod.
+type GetDBStatsResult struct {
+	Counters   map[string]uint64            `json:"counters,omitempty"`
+	Gauges     map[string]int64             `json:"gauges,omitempty"`
+	Histograms map[string]DBHistogramResult `json:"histograms,omitempty"`
+}
@@ -28,6 +28,63 @@ func TestPodExtCustomResults(t *testing.T) {
 			},
 			expected: `{"versionstring":"1.0.0","major":1,"minor":0,"patch":0,"prerelease":"pr","buildmetadata":"bm"}`,
 		},
+		{
+			name: "getalgostatsresult",
+			result: &btcjson.GetAlgoStatsResult{
+				Height: 2500100,
+				Blocks: 100,
+				Algos: []btcjson.AlgoStatsResult{
+					{
+						Algo:         "Div18",
+						Version:      5,
+						Blocks:       50,
+						AvgSpacing:   17.5,
+						Bits:         "1d00ffff",
+						Difficulty:   2,
+						HashesPerSec: 1000,
+					},
+				},
+			},
+			expected: `{"height":2500100,"blocks":100,"algos":[{"algo":"Div18","version":5,"blocks":50,"avgspacing":17.5,` +
+				`"bits":"1d00ffff","difficulty":2,"hashespersec":1000}]}`,
+		},
+		{
+			name: "rejectedblockresult",
+			result: &btcjson.RejectedBlockResult{
+				Hash:        "000000000000000000000000000000000000000000000000000000000000002a",
+				Height:      2500100,
+				Algo:        "Div18",
+				Time:        1600000000,
+				Code:        "ErrScriptValidation",
+				Reason:      "failed to validate input",
+				ActualBits:  "1d00ffff",
+				TxIndex:     2,
+				InputIndex:  1,
+				ScriptError: "false stack entry at end of script execution",
+			},
+			expected: `{"hash":"000000000000000000000000000000000000000000000000000000000000002a","height":2500100,` +
+				`"algo":"Div18","time":1600000000,"code":"ErrScriptValidation","reason":"failed to validate input",` +
+				`"actualbits":"1d00ffff","txindex":2,"inputindex":1,` +
+				`"scripterror":"false stack entry at end of script execution"}`,
+		},
+		{
+			name: "getdbstatsresult",
+			result: &btcjson.GetDBStatsResult{
+				Counters: map[string]uint64{"cache.hits": 10},
+				Gauges:   map[string]int64{"blockfiles.open": 2},
+				Histograms: map[string]btcjson.DBHistogramResult{
+					"flush.seconds": {
+						Count:   1,
+						Sum:     0.5,
+						Min:     0.5,
+						Max:     0.5,
+						Buckets: []btcjson.DBHistogramBucketResult{{UpperBound: 1, Count: 1}},
+					},
+				},
+			},
+			expected: `{"counters":{"cache.hits":10},"gauges":{"blockfiles.open":2},"histograms":{"flush.seconds":` +
+				`{"count":1,"sum":0.5,"min":0.5,"max":0.5,"buckets":[{"le":1,"count":1}]}}}`,
+		},
 	}
 	t.Logf("Running %d tests", len(tests))
 	for i, test := range tests {
@@ -57,6 +57,14 @@ type GetBlockChainInfoResult struct {
 	// Bip9SoftForks        map[string]*Bip9SoftForkDescription `json:"bip9_softforks"`
 }
 
+// GetChainTipsResult models the data returned from the getchaintips command.
+type GetChainTipsResult struct {
+	Height    int32  `json:"height"`
+	Hash      string `json:"hash"`
+	BranchLen int32  `json:"branchlen"`
+	Status    string `json:"status"`
+}
+
 // GetBlockHeaderVerboseResult models the data from the getblockheader command when the verbose flag is set. When the
 // verbose flag is not set, getblockheader returns a hex-encoded string.
 type GetBlockHeaderVerboseResult struct {
@@ -6,7 +6,7 @@ import (
 )
 
 
-var subsystem string = log.AddLoggerSubsystem()
+var subsystem string = log.AddLoggerSubsystem("test")
 var F, E, W, I, D, T log.LevelPrinter = log.GetLogPrinterSet(subsystem)
 
 func init() {
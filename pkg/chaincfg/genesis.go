@@ -1,6 +1,7 @@
 package chaincfg
 
 import (
+	"fmt"
 	"github.com/p9c/parallelcoin/pkg/fork"
 	"time"
 	
@@ -175,3 +176,42 @@ var simNetGenesisBlock = wire.Block{
 	},
 	Transactions: []*wire.MsgTx{&genesisCoinbaseTx},
 }
+
+// maxGenesisMessage is the longest message that fits in the signature script of a genesis coinbase, which is limited to
+// 100 bytes, after the bits and extra nonce pushes and the push of the message itself.
+const maxGenesisMessage = 100 - 8 - 2
+
+// NewGenesisBlock returns a genesis block for a new network whose coinbase carries the message in its signature
+// script in the same way as the genesis blocks of the standard networks, and pays to the same output. The nonce is left
+// at zero for the block to be mined.
+func NewGenesisBlock(message string, timestamp time.Time, version int32, bits uint32) (*wire.Block, error) {
+	if len(message) > maxGenesisMessage {
+		return nil, fmt.Errorf("genesis message is %d bytes, more than the maximum of %d", len(message), maxGenesisMessage)
+	}
+	sigScript := []byte{0x04, 0xff, 0xff, 0x00, 0x1d, 0x01, 0x04}
+	if len(message) > 75 {
+		// OP_PUSHDATA1
+		sigScript = append(sigScript, 0x4c)
+	}
+	sigScript = append(sigScript, byte(len(message)))
+	sigScript = append(sigScript, message...)
+	coinbase := wire.NewMsgTx(genesisCoinbaseTx.Version)
+	coinbase.AddTxIn(
+		&wire.TxIn{
+			PreviousOutPoint: genesisCoinbaseTx.TxIn[0].PreviousOutPoint,
+			SignatureScript:  sigScript,
+			Sequence:         0xffffffff,
+		},
+	)
+	out := genesisCoinbaseTx.TxOut[0]
+	coinbase.AddTxOut(wire.NewTxOut(out.Value, append([]byte{}, out.PkScript...)))
+	return &wire.Block{
+		Header: wire.BlockHeader{
+			Version:    version,
+			MerkleRoot: coinbase.TxHash(),
+			Timestamp:  time.Unix(timestamp.Unix(), 0),
+			Bits:       bits,
+		},
+		Transactions: []*wire.MsgTx{coinbase},
+	}, nil
+}
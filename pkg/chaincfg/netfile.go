@@ -0,0 +1,195 @@
+package chaincfg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/p9c/parallelcoin/pkg/fork"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// standardNets is the parameters of the networks built into this package, by name, which custom networks base the
+// parameters they do not set on.
+var standardNets = map[string]*Params{
+	MainNetParams.Name:        &MainNetParams,
+	TestNet3Params.Name:       &TestNet3Params,
+	RegressionTestParams.Name: &RegressionTestParams,
+	SimNetParams.Name:         &SimNetParams,
+}
+
+// NetFile is the form in which the parameters of a custom network are written to and read from a JSON or TOML file, so
+// that the network can be registered at runtime. The parameters it does not hold are those of the standard network
+// named by Base.
+type NetFile struct {
+	Name                string   `json:"name" toml:"name"`
+	Base                string   `json:"base" toml:"base"`
+	Net                 uint32   `json:"net" toml:"net"`
+	DefaultPort         string   `json:"defaultport" toml:"defaultport"`
+	RPCClientPort       string   `json:"rpcclientport" toml:"rpcclientport"`
+	WalletRPCServerPort string   `json:"walletrpcserverport" toml:"walletrpcserverport"`
+	DNSSeeds            []string `json:"dnsseeds" toml:"dnsseeds"`
+	PubKeyHashAddrID    byte     `json:"pubkeyhashaddrid" toml:"pubkeyhashaddrid"`
+	ScriptHashAddrID    byte     `json:"scripthashaddrid" toml:"scripthashaddrid"`
+	PrivateKeyID        byte     `json:"privatekeyid" toml:"privatekeyid"`
+	HDPrivateKeyID      string   `json:"hdprivatekeyid" toml:"hdprivatekeyid"`
+	HDPublicKeyID       string   `json:"hdpublickeyid" toml:"hdpublickeyid"`
+	HDCoinType          uint32   `json:"hdcointype" toml:"hdcointype"`
+	// GenesisBlock is the serialized genesis block in hex, and GenesisHash its hash, which is checked when the file is
+	// read.
+	GenesisBlock string         `json:"genesisblock" toml:"genesisblock"`
+	GenesisHash  string         `json:"genesishash" toml:"genesishash"`
+	Forks        *fork.Schedule `json:"forks" toml:"forks"`
+}
+
+// NewNetFile returns the file form of the parameters of a custom network based on the named standard network.
+func NewNetFile(params *Params, base string) (f *NetFile, e error) {
+	if _, ok := standardNets[base]; !ok {
+		return nil, fmt.Errorf("there is no standard network named %s", base)
+	}
+	var genesis bytes.Buffer
+	if e = params.GenesisBlock.Serialize(&genesis); E.Chk(e) {
+		return
+	}
+	f = &NetFile{
+		Name:                params.Name,
+		Base:                base,
+		Net:                 uint32(params.Net),
+		DefaultPort:         params.DefaultPort,
+		RPCClientPort:       params.RPCClientPort,
+		WalletRPCServerPort: params.WalletRPCServerPort,
+		PubKeyHashAddrID:    params.PubKeyHashAddrID,
+		ScriptHashAddrID:    params.ScriptHashAddrID,
+		PrivateKeyID:        params.PrivateKeyID,
+		HDPrivateKeyID:      hex.EncodeToString(params.HDPrivateKeyID[:]),
+		HDPublicKeyID:       hex.EncodeToString(params.HDPublicKeyID[:]),
+		HDCoinType:          params.HDCoinType,
+		GenesisBlock:        hex.EncodeToString(genesis.Bytes()),
+		GenesisHash:         params.GenesisHash.String(),
+		Forks:               params.Forks,
+	}
+	for _, seed := range params.DNSSeeds {
+		f.DNSSeeds = append(f.DNSSeeds, seed.Host)
+	}
+	return
+}
+
+// Params returns the parameters of the network in the file.
+func (f *NetFile) Params() (params *Params, e error) {
+	base, ok := standardNets[f.Base]
+	if !ok {
+		return nil, fmt.Errorf("there is no standard network named %s", f.Base)
+	}
+	if f.Name == "" {
+		return nil, fmt.Errorf("the network has no name")
+	}
+	p := *base
+	p.Name = f.Name
+	p.Net = wire.BitcoinNet(f.Net)
+	p.DefaultPort = f.DefaultPort
+	p.RPCClientPort = f.RPCClientPort
+	p.WalletRPCServerPort = f.WalletRPCServerPort
+	p.DNSSeeds = nil
+	for _, host := range f.DNSSeeds {
+		p.DNSSeeds = append(p.DNSSeeds, DNSSeed{Host: host, HasFiltering: true})
+	}
+	p.PubKeyHashAddrID = f.PubKeyHashAddrID
+	p.ScriptHashAddrID = f.ScriptHashAddrID
+	p.PrivateKeyID = f.PrivateKeyID
+	if e = decodeKeyID(f.HDPrivateKeyID, &p.HDPrivateKeyID); e != nil {
+		return nil, fmt.Errorf("hd private key id: %v", e)
+	}
+	if e = decodeKeyID(f.HDPublicKeyID, &p.HDPublicKeyID); e != nil {
+		return nil, fmt.Errorf("hd public key id: %v", e)
+	}
+	p.HDCoinType = f.HDCoinType
+	var b []byte
+	if b, e = hex.DecodeString(f.GenesisBlock); e != nil {
+		return nil, fmt.Errorf("genesis block: %v", e)
+	}
+	p.GenesisBlock = &wire.Block{}
+	if e = p.GenesisBlock.Deserialize(bytes.NewReader(b)); e != nil {
+		return nil, fmt.Errorf("genesis block: %v", e)
+	}
+	hash := p.GenesisBlock.Header.BlockHash()
+	if hash.String() != f.GenesisHash {
+		return nil, fmt.Errorf("genesis block hash is %v, not %s", hash, f.GenesisHash)
+	}
+	p.GenesisHash = &hash
+	if f.Forks == nil {
+		return nil, fmt.Errorf("the network has no hard fork schedule")
+	}
+	if e = f.Forks.Init(); e != nil {
+		return nil, fmt.Errorf("hard fork schedule: %v", e)
+	}
+	p.Forks = f.Forks
+	// Checkpoints and the blacklist of the base network do not apply to a new chain.
+	p.Checkpoints = nil
+	p.Blacklist = nil
+	return &p, nil
+}
+
+// decodeKeyID decodes the four byte hex form of an extended key id.
+func decodeKeyID(s string, id *[4]byte) (e error) {
+	var b []byte
+	if b, e = hex.DecodeString(s); e != nil {
+		return
+	}
+	if len(b) != len(id) {
+		return fmt.Errorf("%s is %d bytes, not %d", s, len(b), len(id))
+	}
+	copy(id[:], b)
+	return
+}
+
+// ReadNetFile reads the parameters of a custom network from a JSON or TOML file, chosen by the extension of the file
+// name. The network still has to be registered with Register before addresses of it can be decoded.
+func ReadNetFile(path string) (params *Params, e error) {
+	var b []byte
+	if b, e = ioutil.ReadFile(path); E.Chk(e) {
+		return
+	}
+	f := &NetFile{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		e = json.Unmarshal(b, f)
+	case ".toml":
+		e = toml.Unmarshal(b, f)
+	default:
+		return nil, fmt.Errorf("unknown network file type '%s' of %s", ext, path)
+	}
+	if e != nil {
+		return nil, fmt.Errorf("unable to decode network file %s: %v", path, e)
+	}
+	if params, e = f.Params(); e != nil {
+		return nil, fmt.Errorf("invalid network file %s: %v", path, e)
+	}
+	return
+}
+
+// Write writes the file as JSON or TOML, chosen by the extension of the file name.
+func (f *NetFile) Write(path string) (e error) {
+	var b []byte
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		if b, e = json.MarshalIndent(f, "", "\t"); E.Chk(e) {
+			return
+		}
+		b = append(b, '\n')
+	case ".toml":
+		var buf bytes.Buffer
+		if e = toml.NewEncoder(&buf).Encode(f); E.Chk(e) {
+			return
+		}
+		b = buf.Bytes()
+	default:
+		return fmt.Errorf("unknown network file type '%s' of %s", ext, path)
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
@@ -0,0 +1,96 @@
+package chaincfg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/p9c/parallelcoin/pkg/fork"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// TestNewGenesisBlock ensures the genesis message is pushed onto the coinbase signature script and that messages too
+// long for it are refused.
+func TestNewGenesisBlock(t *testing.T) {
+	for _, size := range []int{0, 50, 76, maxGenesisMessage} {
+		message := strings.Repeat("m", size)
+		block, e := NewGenesisBlock(message, time.Unix(1600000000, 0), 2, MainPowLimitBits)
+		if e != nil {
+			t.Fatalf("NewGenesisBlock with a %d byte message: %v", size, e)
+		}
+		sigScript := block.Transactions[0].TxIn[0].SignatureScript
+		if !strings.HasSuffix(string(sigScript), message) || len(sigScript) > 100 {
+			t.Errorf("NewGenesisBlock: signature script %x does not end with the %d byte message", sigScript, size)
+		}
+		if block.Header.MerkleRoot != block.Transactions[0].TxHash() {
+			t.Errorf("NewGenesisBlock: merkle root is not the hash of the coinbase")
+		}
+	}
+	if _, e := NewGenesisBlock(strings.Repeat("m", maxGenesisMessage+1), time.Now(), 2, MainPowLimitBits); e == nil {
+		t.Error("NewGenesisBlock: no error for a message that is too long")
+	}
+}
+
+// TestNetFile ensures the parameters of a custom network survive being written to and read from JSON and TOML files,
+// and that a file whose genesis block does not match its hash is rejected.
+func TestNetFile(t *testing.T) {
+	dir, e := ioutil.TempDir("", "netfile")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	params := TestNet3Params
+	params.Name = "devnet"
+	params.Net = wire.BitcoinNet(0xd3adb33f)
+	params.DefaultPort = "51047"
+	params.DNSSeeds = []DNSSeed{{Host: "seed.example.com", HasFiltering: true}}
+	params.PubKeyHashAddrID = 30
+	params.HDPrivateKeyID = [4]byte{1, 2, 3, 4}
+	params.Forks = fork.MainNetSchedule()
+	params.Forks.Forks[1].ActivationHeight = 1000
+	if params.GenesisBlock, e = NewGenesisBlock("devnet", time.Unix(1600000000, 0), 2, MainPowLimitBits); e != nil {
+		t.Fatal(e)
+	}
+	hash := params.GenesisBlock.Header.BlockHash()
+	params.GenesisHash = &hash
+	f, e := NewNetFile(&params, TestNet3Params.Name)
+	if e != nil {
+		t.Fatalf("NewNetFile: %v", e)
+	}
+	for _, name := range []string{"devnet.json", "devnet.toml"} {
+		path := filepath.Join(dir, name)
+		if e = f.Write(path); e != nil {
+			t.Fatalf("Write %s: %v", name, e)
+		}
+		got, e := ReadNetFile(path)
+		if e != nil {
+			t.Fatalf("ReadNetFile %s: %v", name, e)
+		}
+		if got.Name != params.Name || got.Net != params.Net || got.DefaultPort != params.DefaultPort ||
+			!reflect.DeepEqual(got.DNSSeeds, params.DNSSeeds) || got.PubKeyHashAddrID != params.PubKeyHashAddrID ||
+			got.HDPrivateKeyID != params.HDPrivateKeyID || *got.GenesisHash != hash ||
+			got.CoinbaseMaturity != TestNet3Params.CoinbaseMaturity {
+			t.Errorf("ReadNetFile %s: got %+v, want %+v", name, got, params)
+		}
+		if !reflect.DeepEqual(got.Forks, params.Forks) {
+			t.Errorf("ReadNetFile %s: got schedule %+v, want %+v", name, got.Forks, params.Forks)
+		}
+	}
+	f.GenesisHash = TestNet3Params.GenesisHash.String()
+	path := filepath.Join(dir, "bad.json")
+	if e = f.Write(path); e != nil {
+		t.Fatal(e)
+	}
+	if _, e = ReadNetFile(path); e == nil {
+		t.Error("ReadNetFile: no error for a genesis block that does not match its hash")
+	}
+	if _, e = NewNetFile(&params, "nonet"); e == nil {
+		t.Error("NewNetFile: no error for an unknown base network")
+	}
+}
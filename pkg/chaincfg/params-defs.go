@@ -7,6 +7,7 @@ import (
 	"time"
 	
 	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/fork"
 	"github.com/p9c/parallelcoin/pkg/wire"
 )
 
@@ -221,4 +222,10 @@ type Params struct {
 	// PowLimit defines the highest allowed proof of work value for a scrypt block as a uint256.
 	ScryptPowLimit      *big.Int
 	ScryptPowLimitBits  uint32
+	// Forks is the hard fork schedule of the network, which for a custom network may be read from a file with
+	// fork.ReadSchedule.
+	Forks *fork.Schedule
+	// Blacklist is the list of encoded addresses that transactions may neither spend from nor pay to once the Plan 9
+	// hard fork is active.
+	Blacklist []string
 }
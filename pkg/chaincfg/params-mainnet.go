@@ -1,6 +1,7 @@
 package chaincfg
 
 import (
+	"github.com/p9c/parallelcoin/pkg/fork"
 	"github.com/p9c/parallelcoin/pkg/wire"
 )
 
@@ -102,6 +103,11 @@ var MainNetParams = Params{
 	MaxActualTimespan:  3300,
 	ScryptPowLimit:     &scryptPowLimit,
 	ScryptPowLimitBits: ScryptPowLimitBits,
+	Forks:              fork.MainNetSchedule(),
+	Blacklist: []string{
+		// Cryptopia liquidation wallet
+		// "8JEEhaMxJf4dZh5rvVCVSA7JKeYBvy8fir",
+	},
 		RPCClientPort:       "11048",
 	WalletRPCServerPort: "11046",
 
@@ -1,6 +1,7 @@
 package chaincfg
 
 import (
+	"github.com/p9c/parallelcoin/pkg/fork"
 	"github.com/p9c/parallelcoin/pkg/wire"
 )
 
@@ -77,6 +78,7 @@ var RegressionTestParams = Params{
 	MaxActualTimespan:       AveragingTargetTimespan * (Interval + MaxAdjustDown) / Interval,
 	ScryptPowLimit:          &scryptPowLimit,
 	ScryptPowLimitBits:      ScryptPowLimitBits,
+	Forks:                   fork.RegressionTestSchedule(),
 	RPCClientPort:       "31048",
 	WalletRPCServerPort: "31046",
 }
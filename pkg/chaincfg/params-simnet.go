@@ -3,6 +3,7 @@ package chaincfg
 import (
 	"time"
 	
+	"github.com/p9c/parallelcoin/pkg/fork"
 	"github.com/p9c/parallelcoin/pkg/wire"
 )
 
@@ -84,6 +85,7 @@ var SimNetParams = Params{
 	MaxActualTimespan:       10 * 300 * (100 + 10) / 100,
 	ScryptPowLimit:          &scryptPowLimit,
 	ScryptPowLimitBits:      ScryptPowLimitBits,
+	Forks:                   fork.SimNetSchedule(),
 	RPCClientPort:       "41048",
 	WalletRPCServerPort: "41046",
 }
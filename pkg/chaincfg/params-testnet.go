@@ -83,6 +83,7 @@ var TestNet3Params = Params{
 	MaxActualTimespan:       TestnetAveragingTargetTimespan * (TestnetInterval + TestnetMaxAdjustDown) / TestnetInterval,
 	ScryptPowLimit:          &scryptPowLimit,
 	ScryptPowLimitBits:      ScryptPowLimitBits,
+	Forks:                   fork.TestNetSchedule(),
 	RPCClientPort:       "21048",
 	WalletRPCServerPort: "21046",
 }
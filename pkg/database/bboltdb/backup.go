@@ -0,0 +1,82 @@
+package bboltdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/database/internal/flatfile"
+)
+
+// Backup writes a consistent copy of the database to the directory at dest, which must not exist yet, while the
+// database remains open for reading and writing.
+//
+// Write transactions are only held off while a read transaction on the metadata is started and the block files up to
+// the write cursor are hard linked into a staging directory, which keeps them from being removed by pruning. The
+// metadata is then copied from the read transaction and the staged block files are moved or copied into the backup, up
+// to the write cursor for the current write file. Closing the database stops a backup in progress.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Backup(dest string) (e error) {
+	start := time.Now()
+	if _, e = os.Stat(dest); e == nil {
+		str := fmt.Sprintf("backup destination %q already exists", dest)
+		return makeDbErr(database.ErrDbExists, str, nil)
+	}
+	// The locks are taken in the same order as a write transaction takes them, and the read lock on closeLock is held
+	// for the whole backup so the database is not closed under it.
+	db.writeLock.Lock()
+	db.closeLock.RLock()
+	defer db.closeLock.RUnlock()
+	if db.closed {
+		db.writeLock.Unlock()
+		return makeDbErr(database.ErrDbNotOpen, errDbNotOpenStr, nil)
+	}
+	boltTx, staged, e := db.stageBackup()
+	db.writeLock.Unlock()
+	if e != nil {
+		return e
+	}
+	defer func() {
+		if e := boltTx.Rollback(); E.Chk(e) {
+		}
+		staged.Remove()
+	}()
+	if e = os.MkdirAll(dest, 0700); E.Chk(e) {
+		return makeDbErr(database.ErrDriverSpecific, e.Error(), e)
+	}
+	if e = boltTx.CopyFile(filepath.Join(dest, metadataDbName), 0600); E.Chk(e) {
+		e = convertErr("failed to write metadata backup", e)
+	} else {
+		I.F("backed up %d bytes of metadata", boltTx.Size())
+		e = staged.CopyTo(dest, db.quit)
+	}
+	if e != nil {
+		if e := os.RemoveAll(dest); E.Chk(e) {
+		}
+		return e
+	}
+	I.F("backed up %d block files to %s in %v", staged.Len(), dest, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// stageBackup starts a read transaction on the metadata and links the block files up to the write cursor into a new
+// staging directory, returning the transaction and the staged files.
+//
+// This function MUST be called with the database write lock held.
+func (db *db) stageBackup() (boltTx *bolt.Tx, staged *flatfile.Staged, e error) {
+	// Every transaction syncs its blocks before its metadata is committed, so the metadata seen by the read transaction
+	// matches the block files up to the write cursor.
+	if boltTx, e = db.bdb.Begin(false); E.Chk(e) {
+		return nil, nil, convertErr("failed to begin metadata transaction", e)
+	}
+	if staged, e = db.store.Stage(); e != nil {
+		_ = boltTx.Rollback()
+		return nil, nil, e
+	}
+	return boltTx, staged, nil
+}
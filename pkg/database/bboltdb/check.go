@@ -0,0 +1,45 @@
+package bboltdb
+
+import (
+	"github.com/p9c/parallelcoin/pkg/database"
+)
+
+// Enforce db implements the database.BlockChecker interface.
+var _ database.BlockChecker = (*db)(nil)
+
+// CheckBlocks reads back every block in the block index, checking it lies within its block file and that the length,
+// network and checksum of its record match, and returns the blocks that are damaged. When repair is set the damaged
+// blocks are removed from the block index, and when the last blocks in the block files are damaged the block files are
+// truncated to the start of the first of them.
+//
+// This function is part of the database.BlockChecker interface implementation.
+func (db *db) CheckBlocks(repair bool, interrupt <-chan struct{}) (problems []database.BlockProblem, e error) {
+	var dbTx database.Tx
+	if dbTx, e = db.Begin(repair); E.Chk(e) {
+		return nil, e
+	}
+	tx := dbTx.(*transaction)
+	problems, end, interrupted, e := db.store.CheckBlocks(tx.blockIdxBucket.ForEach, interrupt)
+	if e != nil || interrupted || !repair || len(problems) == 0 {
+		_ = tx.Rollback()
+		if e != nil {
+			e = convertErr("failed to read block index", e)
+		}
+		return problems, e
+	}
+	for i := range problems {
+		if e = tx.blockIdxBucket.Delete(problems[i].Hash[:]); E.Chk(e) {
+			_ = tx.Rollback()
+			return problems, convertErr("failed to remove damaged block from the block index", e)
+		}
+	}
+	tx.pendingTruncate = &end
+	if e = tx.Commit(); E.Chk(e) {
+		return problems, e
+	}
+	for i := range problems {
+		problems[i].Repaired = true
+	}
+	I.F("removed %d damaged blocks, block files end at file %d, offset %d", len(problems), end.FileNum, end.Offset)
+	return problems, nil
+}
@@ -0,0 +1,1539 @@
+package bboltdb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+
+	"github.com/p9c/parallelcoin/pkg/block"
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/database/internal/flatfile"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+const (
+	// metadataDbName is the name used for the bbolt file that holds the metadata and the block index.
+	metadataDbName = "metadata.db"
+	// blockHdrSize is the size of a block header.
+	//
+	// This is simply the constant from wire and is only provided here for convenience since wire.MaxBlockHeaderPayload
+	// is quite long.
+	blockHdrSize = wire.MaxBlockHeaderPayload
+	// initialMmapSize is the size the metadata file is initially memory mapped with. bbolt has to wait for every open
+	// read transaction to finish before it can grow the mapping while committing, so starting with a large mapping,
+	// which only reserves address space, avoids stalling commits behind long running readers while the chain is synced.
+	initialMmapSize = 1 << 30 // 1 GiB
+	// openTimeout is how long to wait for the lock on the metadata file, which is held by any other process that has
+	// the database open, before giving up.
+	openTimeout = time.Second
+)
+
+var (
+	// metadataBucketName is the name of the top-level bbolt bucket that is the root metadata bucket of transactions.
+	metadataBucketName = []byte("metadata")
+	// internalBucketName is the name of the top-level bbolt bucket that houses the state used internally by the
+	// driver. It is kept beside the metadata bucket rather than in it so it is never visible to callers.
+	internalBucketName = []byte("bboltdb")
+	// blockIdxBucketName is the bucket in the internal bucket used to track block metadata.
+	blockIdxBucketName = []byte("blockidx")
+	// writeLocKeyName is the key in the internal bucket used to store the current write file location.
+	writeLocKeyName = []byte("writeloc")
+)
+
+// Common error strings.
+const (
+	// errDbNotOpenStr is the text to use for the database.ErrDbNotOpen error code.
+	errDbNotOpenStr = "database is not open"
+	// errTxClosedStr is the text to use for the database.ErrTxClosed error code.
+	errTxClosedStr = "database tx is closed"
+)
+
+// makeDbErr creates a database.DBError given a set of arguments.
+func makeDbErr(c database.ErrorCode, desc string, e error) database.DBError {
+	return database.DBError{ErrorCode: c, Description: desc, Err: e}
+}
+
+// convertErr converts the passed bbolt error into a database error with an equivalent error code and the passed
+// description.
+//
+// It also sets the passed error as the underlying error.
+func convertErr(desc string, boltErr error) database.DBError {
+	// Use the driver-specific error code by default.
+	//
+	// The code below will update this with the converted error if it's recognized.
+	var code = database.ErrDriverSpecific
+	switch boltErr {
+	// Database corruption errors.
+	case bolt.ErrInvalid, bolt.ErrVersionMismatch, bolt.ErrChecksum:
+		code = database.ErrCorruption
+	// Database open/create errors.
+	case bolt.ErrDatabaseNotOpen:
+		code = database.ErrDbNotOpen
+	case bolt.ErrTimeout:
+		code = database.ErrDbAlreadyOpen
+	// Transaction errors.
+	case bolt.ErrTxClosed:
+		code = database.ErrTxClosed
+	case bolt.ErrTxNotWritable, bolt.ErrDatabaseReadOnly:
+		code = database.ErrTxNotWritable
+	// Value/bucket errors.
+	case bolt.ErrBucketNotFound:
+		code = database.ErrBucketNotFound
+	case bolt.ErrBucketExists:
+		code = database.ErrBucketExists
+	case bolt.ErrBucketNameRequired:
+		code = database.ErrBucketNameRequired
+	case bolt.ErrKeyRequired:
+		code = database.ErrKeyRequired
+	case bolt.ErrKeyTooLarge:
+		code = database.ErrKeyTooLarge
+	case bolt.ErrValueTooLarge:
+		code = database.ErrValueTooLarge
+	case bolt.ErrIncompatibleValue:
+		code = database.ErrIncompatibleValue
+	}
+	return database.DBError{ErrorCode: code, Description: desc, Err: boltErr}
+}
+
+// copySlice returns a copy of the passed slice.
+//
+// This is used to copy keys and values out of bbolt, since they point into its memory map which is only valid during
+// the transaction, and to copy values put into it, since bbolt keeps a reference to them until the transaction commits.
+// The copy of a nil slice is an empty slice, which keeps values with no data apart from nested buckets, whose value is
+// nil in bbolt.
+func copySlice(slice []byte) []byte {
+	ret := make([]byte, len(slice))
+	copy(ret, slice)
+	return ret
+}
+
+// cursor is an internal type used to represent a cursor over key/value pairs and nested buckets of a bucket and
+// implements the database.Cursor interface.
+type cursor struct {
+	bucket     *bucket
+	boltCursor *bolt.Cursor
+	// key and value are the entry the cursor is positioned at. The key is nil when the cursor is exhausted and the
+	// value is nil when the entry is a nested bucket.
+	key   []byte
+	value []byte
+	// modCount is the modification count of the transaction when the cursor was positioned. bbolt cursors are not
+	// safe to move after the bucket they iterate has been modified, so the cursor seeks back to its key first when it
+	// no longer matches.
+	modCount uint64
+}
+
+// Enforce cursor implements the database.Cursor interface.
+var _ database.Cursor = (*cursor)(nil)
+
+// Bucket returns the bucket the cursor was created for.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Bucket() database.Bucket {
+	// Ensure transaction state is valid.
+	if e := c.bucket.tx.checkClosed(); E.Chk(e) {
+		return nil
+	}
+	return c.bucket
+}
+
+// Delete removes the current key/value pair the cursor is at without invalidating the cursor.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrIncompatibleValue if attempted when the cursor points to a nested bucket
+//
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Delete() (e error) {
+	// Ensure transaction state is valid.
+	if e = c.bucket.tx.checkClosed(); E.Chk(e) {
+		return e
+	}
+	// DBError if the cursor is exhausted.
+	if c.key == nil {
+		str := "cursor is exhausted"
+		return makeDbErr(database.ErrIncompatibleValue, str, nil)
+	}
+	// Do not allow buckets to be deleted via the cursor.
+	if c.value == nil {
+		str := "buckets may not be deleted from a cursor"
+		return makeDbErr(database.ErrIncompatibleValue, str, nil)
+	}
+	// Ensure the transaction is writable.
+	if !c.bucket.tx.writable {
+		str := "deleting a value requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	// The key is kept so the cursor can find its way to the neighbouring entries on the next move.
+	key := copySlice(c.key)
+	if e = c.bucket.boltBucket.Delete(key); E.Chk(e) {
+		return convertErr("failed to delete key", e)
+	}
+	c.key = key
+	c.bucket.tx.modCount++
+	return nil
+}
+
+// setPosition records the entry the bbolt cursor has moved to and returns whether or not there is one.
+func (c *cursor) setPosition(key, value []byte) bool {
+	c.key, c.value = key, value
+	c.modCount = c.bucket.tx.modCount
+	return key != nil
+}
+
+// First positions the cursor at the first key/value pair and returns whether or not the pair exists.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) First() bool {
+	// Ensure transaction state is valid.
+	if e := c.bucket.tx.checkClosed(); E.Chk(e) {
+		return false
+	}
+	return c.setPosition(c.boltCursor.First())
+}
+
+// Last positions the cursor at the last key/value pair and returns whether or not the pair exists.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Last() bool {
+	// Ensure transaction state is valid.
+	if e := c.bucket.tx.checkClosed(); E.Chk(e) {
+		return false
+	}
+	return c.setPosition(c.boltCursor.Last())
+}
+
+// Next moves the cursor one key/value pair forward and returns whether or not the pair exists.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Next() bool {
+	// Ensure transaction state is valid.
+	if e := c.bucket.tx.checkClosed(); E.Chk(e) {
+		return false
+	}
+	// Nothing to return if cursor is exhausted.
+	if c.key == nil {
+		return false
+	}
+	// When the bucket has been modified since the cursor was positioned, seek back to the current key. It is the next
+	// entry already when the current key has been deleted.
+	if c.modCount != c.bucket.tx.modCount {
+		key, value := c.boltCursor.Seek(c.key)
+		if !bytes.Equal(key, c.key) {
+			return c.setPosition(key, value)
+		}
+	}
+	return c.setPosition(c.boltCursor.Next())
+}
+
+// Prev moves the cursor one key/value pair backward and returns whether or not the pair exists.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Prev() bool {
+	// Ensure transaction state is valid.
+	if e := c.bucket.tx.checkClosed(); E.Chk(e) {
+		return false
+	}
+	// Nothing to return if cursor is exhausted.
+	if c.key == nil {
+		return false
+	}
+	// When the bucket has been modified since the cursor was positioned, seek back to the current key, or the entry
+	// after it when it has been deleted, so the entry before it can be found.
+	if c.modCount != c.bucket.tx.modCount {
+		if key, _ := c.boltCursor.Seek(c.key); key == nil {
+			return c.setPosition(c.boltCursor.Last())
+		}
+	}
+	return c.setPosition(c.boltCursor.Prev())
+}
+
+// Seek positions the cursor at the first key/value pair that is greater than or equal to the passed seek key.
+//
+// Returns false if no suitable key was found.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Seek(seek []byte) bool {
+	// Ensure transaction state is valid.
+	if e := c.bucket.tx.checkClosed(); E.Chk(e) {
+		return false
+	}
+	return c.setPosition(c.boltCursor.Seek(seek))
+}
+
+// Key returns the current key the cursor is pointing to.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Key() []byte {
+	// Ensure transaction state is valid.
+	if e := c.bucket.tx.checkClosed(); E.Chk(e) {
+		return nil
+	}
+	// Nothing to return if cursor is exhausted.
+	if c.key == nil {
+		return nil
+	}
+	return copySlice(c.key)
+}
+
+// Value returns the current value the cursor is pointing to.
+//
+// This will be nil for nested buckets.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Value() []byte {
+	// Ensure transaction state is valid.
+	if e := c.bucket.tx.checkClosed(); E.Chk(e) {
+		return nil
+	}
+	// Nothing to return if cursor is exhausted or pointing to a nested bucket.
+	if c.key == nil || c.value == nil {
+		return nil
+	}
+	return copySlice(c.value)
+}
+
+// bucket is an internal type used to represent a collection of key/value pairs and implements the database.Bucket
+// interface.
+type bucket struct {
+	tx         *transaction
+	boltBucket *bolt.Bucket
+}
+
+// Enforce bucket implements the database.Bucket interface.
+var _ database.Bucket = (*bucket)(nil)
+
+// Bucket retrieves a nested bucket with the given key.
+//
+// Returns nil if the bucket does not exist.
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Bucket(key []byte) database.Bucket {
+	// Ensure transaction state is valid.
+	if e := b.tx.checkClosed(); E.Chk(e) {
+		return nil
+	}
+	childBucket := b.boltBucket.Bucket(key)
+	if childBucket == nil {
+		return nil
+	}
+	return &bucket{tx: b.tx, boltBucket: childBucket}
+}
+
+// CreateBucket creates and returns a new nested bucket with the given key.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBucketExists if the bucket already exists
+//
+//   - ErrBucketNameRequired if the key is empty
+//
+//   - ErrIncompatibleValue if the key is otherwise invalid for the particular implementation
+//
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) CreateBucket(key []byte) (database.Bucket, error) {
+	// Ensure transaction state is valid.
+	if e := b.tx.checkClosed(); E.Chk(e) {
+		return nil, e
+	}
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "create bucket requires a writable database transaction"
+		return nil, makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	// Ensure a key was provided.
+	if len(key) == 0 {
+		str := "create bucket requires a key"
+		return nil, makeDbErr(database.ErrBucketNameRequired, str, nil)
+	}
+	childBucket, e := b.boltBucket.CreateBucket(key)
+	if e != nil {
+		str := fmt.Sprintf("failed to create bucket with key %q", key)
+		return nil, convertErr(str, e)
+	}
+	b.tx.modCount++
+	return &bucket{tx: b.tx, boltBucket: childBucket}, nil
+}
+
+// CreateBucketIfNotExists creates and returns a new nested bucket with the given key if it does not already exist.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBucketNameRequired if the key is empty
+//
+//   - ErrIncompatibleValue if the key is otherwise invalid for the particular implementation
+//
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) CreateBucketIfNotExists(key []byte) (database.Bucket, error) {
+	// Ensure transaction state is valid.
+	if e := b.tx.checkClosed(); E.Chk(e) {
+		return nil, e
+	}
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "create bucket requires a writable database transaction"
+		return nil, makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	// Return existing bucket if it already exists, otherwise create it.
+	if bucket := b.Bucket(key); bucket != nil {
+		return bucket, nil
+	}
+	return b.CreateBucket(key)
+}
+
+// DeleteBucket removes a nested bucket with the given key.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBucketNotFound if the specified bucket does not exist
+//
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) DeleteBucket(key []byte) (e error) {
+	// Ensure transaction state is valid.
+	if e = b.tx.checkClosed(); E.Chk(e) {
+		return e
+	}
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "delete bucket requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	// bbolt reports a key that holds a value rather than a bucket as an incompatible value, but as far as the caller is
+	// concerned there is no such bucket.
+	if b.boltBucket.Bucket(key) == nil {
+		str := fmt.Sprintf("bucket %q does not exist", key)
+		return makeDbErr(database.ErrBucketNotFound, str, nil)
+	}
+	// Remove the bucket along with all of its keys and nested buckets.
+	if e = b.boltBucket.DeleteBucket(key); E.Chk(e) {
+		str := fmt.Sprintf("failed to delete bucket %q", key)
+		return convertErr(str, e)
+	}
+	b.tx.modCount++
+	return nil
+}
+
+// Cursor returns a new cursor, allowing for iteration over the bucket's key/value pairs and nested buckets in forward
+// or backward order.
+//
+// You must seek to a position using the First, Last, or Seek functions before calling the Next, Prev, Key, or value
+// functions. Failure to do so will result in the same return values as an exhausted cursor, which is false for the Prev
+// and Next functions and nil for Key and value functions.
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Cursor() database.Cursor {
+	// Ensure transaction state is valid.
+	if e := b.tx.checkClosed(); E.Chk(e) {
+		return &cursor{bucket: b}
+	}
+	return &cursor{bucket: b, boltCursor: b.boltBucket.Cursor()}
+}
+
+// ForEach invokes the passed function with every key/value pair in the bucket. This does not include nested buckets or
+// the key/value pairs within those nested buckets.
+//
+// WARNING: It is not safe to mutate data while iterating with this method.
+//
+// Doing so may cause the underlying cursor to be invalidated and return unexpected keys and/or values.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// NOTE: The values returned by this function are only valid during a transaction. Attempting to access them after a
+// transaction has ended will likely result in an access violation.
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) ForEach(fn func(k, v []byte) error) (e error) {
+	// Ensure transaction state is valid.
+	if e = b.tx.checkClosed(); E.Chk(e) {
+		return e
+	}
+	// Invoke the callback for each key/value pair, skipping the nested buckets, which are the entries without a value.
+	// Return the error returned from the callback when it is non-nil.
+	return b.boltBucket.ForEach(
+		func(k, v []byte) (e error) {
+			if v == nil {
+				return nil
+			}
+			return fn(k, v)
+		},
+	)
+}
+
+// ForEachBucket invokes the passed function with the key of every nested bucket in the current bucket.
+//
+// This does not include any nested buckets within those nested buckets.
+//
+// WARNING: It is not safe to mutate data while iterating with this method.
+//
+// Doing so may cause the underlying cursor to be invalidated and return unexpected keys.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// NOTE: The values returned by this function are only valid during a transaction. Attempting to access them after a
+// transaction has ended will likely result in an access violation.
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) ForEachBucket(fn func(k []byte) error) (e error) {
+	// Ensure transaction state is valid.
+	if e = b.tx.checkClosed(); E.Chk(e) {
+		return e
+	}
+	// Invoke the callback for each nested bucket. Return the error returned from the callback when it is non-nil.
+	return b.boltBucket.ForEach(
+		func(k, v []byte) (e error) {
+			if v != nil {
+				return nil
+			}
+			return fn(k)
+		},
+	)
+}
+
+// Writable returns whether or not the bucket is writable.
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Writable() bool {
+	return b.tx.writable
+}
+
+// Put saves the specified key/value pair to the bucket.
+//
+// Keys that do not already exist are added and keys that already exist are overwritten.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrKeyRequired if the key is empty
+//   - ErrIncompatibleValue if the key is the same as an existing bucket
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Put(key, value []byte) (e error) {
+	// Ensure transaction state is valid.
+	if e = b.tx.checkClosed(); E.Chk(e) {
+		return e
+	}
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "setting a key requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	// Ensure a key was provided.
+	if len(key) == 0 {
+		str := "put requires a key"
+		return makeDbErr(database.ErrKeyRequired, str, nil)
+	}
+	// bbolt copies the key but keeps a reference to the value until the transaction is committed, so the value is
+	// copied to allow the caller to reuse it.
+	if e = b.boltBucket.Put(key, copySlice(value)); E.Chk(e) {
+		str := fmt.Sprintf("failed to put key %q", key)
+		return convertErr(str, e)
+	}
+	b.tx.modCount++
+	return nil
+}
+
+// Get returns the value for the given key.
+//
+// Returns nil if the key does not exist in this bucket.
+//
+// An empty slice is returned for keys that exist but have no value assigned.
+//
+// NOTE: The value returned by this function is only valid during a transaction. Attempting to access it after a
+// transaction has ended results in undefined behavior. Additionally, the value must NOT be modified by the caller.
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Get(key []byte) []byte {
+	// Ensure transaction state is valid.
+	if e := b.tx.checkClosed(); E.Chk(e) {
+		return nil
+	}
+	// Nothing to return if there is no key.
+	if len(key) == 0 {
+		return nil
+	}
+	value := b.boltBucket.Get(key)
+	if value == nil {
+		return nil
+	}
+	return copySlice(value)
+}
+
+// Delete removes the specified key from the bucket.
+//
+// Deleting a key that does not exist does not return an error.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrKeyRequired if the key is empty
+//   - ErrIncompatibleValue if the key is the same as an existing bucket
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Delete(key []byte) (e error) {
+	// Ensure transaction state is valid.
+	if e = b.tx.checkClosed(); E.Chk(e) {
+		return e
+	}
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "deleting a value requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	// Nothing to do if there is no key.
+	if len(key) == 0 {
+		return nil
+	}
+	if e = b.boltBucket.Delete(key); E.Chk(e) {
+		str := fmt.Sprintf("failed to delete key %q", key)
+		return convertErr(str, e)
+	}
+	b.tx.modCount++
+	return nil
+}
+
+// pendingBlock houses a block that will be written to disk when the database transaction is committed.
+type pendingBlock struct {
+	hash  *chainhash.Hash
+	bytes []byte
+}
+
+// transaction represents a database transaction.
+//
+// It can either be read-only or read-write and implements the database.Tx interface. The transaction provides a root
+// bucket against which all read and writes occur.
+type transaction struct {
+	managed        bool         // Is the transaction managed?
+	closed         bool         // Is the transaction closed?
+	writable       bool         // Is the transaction writable?
+	db             *db          // DB instance the tx was created from.
+	boltTx         *bolt.Tx     // Underlying bbolt transaction.
+	metaBucket     *bucket      // The root metadata bucket.
+	internalBucket *bolt.Bucket // The bucket holding the driver's own state.
+	blockIdxBucket *bolt.Bucket // The block index bucket.
+	storeGen       uint64       // Generation of the block files the tx began in.
+	// modCount is incremented on every change to the metadata so cursors can tell when they have to seek back to their
+	// position before moving.
+	modCount uint64
+	// Blocks that need to be stored on commit.
+	//
+	// The pendingBlocks map is kept to allow quick lookups of pending data by block hash.
+	pendingBlocks    map[chainhash.Hash]int
+	pendingBlockData []pendingBlock
+	// Block files that have been pruned and need to be removed from disk once the transaction has been committed.
+	pendingPrune []uint32
+	// Block files whose blocks have all been moved elsewhere by recompression and need to be emptied once the
+	// transaction has been committed.
+	pendingEmpty []uint32
+	// Position the block files are truncated to once the transaction has been committed, after the damaged blocks at
+	// the end of them have been removed.
+	pendingTruncate *flatfile.Location
+}
+
+// Enforce transaction implements the database.Tx interface.
+var _ database.Tx = (*transaction)(nil)
+
+// checkClosed returns an error if the the database or transaction is closed.
+func (tx *transaction) checkClosed() (e error) {
+	// The transaction is no longer valid if it has been closed.
+	if tx.closed {
+		return makeDbErr(database.ErrTxClosed, errTxClosedStr, nil)
+	}
+	return nil
+}
+
+// Metadata returns the top-most bucket for all metadata storage.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) Metadata() database.Bucket {
+	return tx.metaBucket
+}
+
+// hasBlock returns whether or not a block with the given hash exists.
+func (tx *transaction) hasBlock(hash *chainhash.Hash) bool {
+	// Return true if the block is pending to be written on commit since it exists from the viewpoint of this
+	// transaction.
+	if _, exists := tx.pendingBlocks[*hash]; exists {
+		return true
+	}
+	return tx.blockIdxBucket.Get(hash[:]) != nil
+}
+
+// StoreBlock stores the provided block into the database.
+//
+// There are no checks to ensure the block connects to a previous block, contains double spends, or any additional
+// functionality such as transaction indexing.
+//
+// It simply stores the block in the database.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBlockExists when the block hash already exists
+//
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) StoreBlock(block *block.Block) (e error) {
+	// Ensure transaction state is valid.
+	if e = tx.checkClosed(); E.Chk(e) {
+		return e
+	}
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "store block requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	// Reject the block if it already exists.
+	blockHash := block.Hash()
+	if tx.hasBlock(blockHash) {
+		str := fmt.Sprintf("block %s already exists", blockHash)
+		return makeDbErr(database.ErrBlockExists, str, nil)
+	}
+	blockBytes, e := block.Bytes()
+	if e != nil {
+		str := fmt.Sprintf(
+			"failed to get serialized bytes for block %s",
+			blockHash,
+		)
+		return makeDbErr(database.ErrDriverSpecific, str, e)
+	}
+	// Add the block to be stored to the list of pending blocks to store when the transaction is committed.
+	//
+	// Also add it to pending blocks map so it is easy to determine the block is pending based on the block hash.
+	if tx.pendingBlocks == nil {
+		tx.pendingBlocks = make(map[chainhash.Hash]int)
+	}
+	tx.pendingBlocks[*blockHash] = len(tx.pendingBlockData)
+	tx.pendingBlockData = append(
+		tx.pendingBlockData, pendingBlock{
+			hash:  blockHash,
+			bytes: blockBytes,
+		},
+	)
+	return nil
+}
+
+// HasBlock returns whether or not a block with the given hash exists in the database.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) HasBlock(hash *chainhash.Hash) (bool, error) {
+	// Ensure transaction state is valid.
+	if e := tx.checkClosed(); E.Chk(e) {
+		return false, e
+	}
+	return tx.hasBlock(hash), nil
+}
+
+// HasBlocks returns whether or not the blocks with the provided hashes exist in the database.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) HasBlocks(hashes []chainhash.Hash) ([]bool, error) {
+	// Ensure transaction state is valid.
+	if e := tx.checkClosed(); E.Chk(e) {
+		return nil, e
+	}
+	results := make([]bool, len(hashes))
+	for i := range hashes {
+		results[i] = tx.hasBlock(&hashes[i])
+	}
+	return results, nil
+}
+
+// fetchBlockLoc fetches the location of the block with the provided hash from the block index. It will return
+// ErrBlockNotFound if there is no entry.
+func (tx *transaction) fetchBlockLoc(hash *chainhash.Hash) (flatfile.Location, error) {
+	blockRow := tx.blockIdxBucket.Get(hash[:])
+	if blockRow == nil {
+		str := fmt.Sprintf("block %s does not exist", hash)
+		return flatfile.Location{}, makeDbErr(database.ErrBlockNotFound, str, nil)
+	}
+	if len(blockRow) < flatfile.LocationSize {
+		str := fmt.Sprintf("block index entry for block %s is truncated", hash)
+		return flatfile.Location{}, makeDbErr(database.ErrCorruption, str, nil)
+	}
+	return flatfile.DeserializeLocation(blockRow), nil
+}
+
+// FetchBlockHeader returns the raw serialized bytes for the block header identified by the given hash.
+//
+// The raw bytes are in the format returned by Serialize on a wire.BlockHeader.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBlockNotFound if the requested block hash does not exist
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+//   - ErrCorruption if the database has somehow become corrupted
+//
+// NOTE: The data returned by this function is only valid during a database transaction. Attempting to access it after a
+// transaction has ended results in undefined behavior.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlockHeader(hash *chainhash.Hash) ([]byte, error) {
+	return tx.FetchBlockRegion(
+		&database.BlockRegion{
+			Hash:   hash,
+			Offset: 0,
+			Len:    blockHdrSize,
+		},
+	)
+}
+
+// FetchBlockHeaders returns the raw serialized bytes for the block headers identified by the given hashes.
+//
+// The raw bytes are in the format returned by Serialize on a wire.BlockHeader.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBlockNotFound if the any of the requested block hashes do not exist
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+//   - ErrCorruption if the database has somehow become corrupted
+//
+// NOTE: The data returned by this function is only valid during a database transaction. Attempting to access it after a
+// transaction has ended results in undefined behavior.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlockHeaders(hashes []chainhash.Hash) ([][]byte, error) {
+	regions := make([]database.BlockRegion, len(hashes))
+	for i := range hashes {
+		regions[i].Hash = &hashes[i]
+		regions[i].Offset = 0
+		regions[i].Len = blockHdrSize
+	}
+	return tx.FetchBlockRegions(regions)
+}
+
+// FetchBlock returns the raw serialized bytes for the block identified by the given hash. The raw bytes are in the
+// format returned by Serialize on a wire.Block.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBlockNotFound if the requested block hash does not exist
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+//   - ErrCorruption if the database has somehow become corrupted
+//
+// In addition, returns ErrDriverSpecific if any failures occur when reading the block files.
+//
+// NOTE: The data returned by this function is only valid during a database transaction. Attempting to access it after a
+// transaction has ended results in undefined behavior.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlock(hash *chainhash.Hash) ([]byte, error) {
+	// Ensure transaction state is valid.
+	if e := tx.checkClosed(); E.Chk(e) {
+		return nil, e
+	}
+	// When the block is pending to be written on commit return the bytes from there.
+	if idx, exists := tx.pendingBlocks[*hash]; exists {
+		return tx.pendingBlockData[idx].bytes, nil
+	}
+	// Lookup the location of the block in the files from the block index.
+	location, e := tx.fetchBlockLoc(hash)
+	if e != nil {
+		return nil, e
+	}
+	// Read the block from the appropriate location. The function also performs a checksum over the data to detect data
+	// corruption.
+	return tx.db.store.ReadBlock(hash, location)
+}
+
+// FetchBlocks returns the raw serialized bytes for the blocks identified by the given hashes.
+//
+// The raw bytes are in the format returned by Serialize on a wire.Block.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBlockNotFound if any of the requested block hashed do not exist
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+//   - ErrCorruption if the database has somehow become corrupted
+//
+// In addition, returns ErrDriverSpecific if any failures occur when reading the block files.
+//
+// NOTE: The data returned by this function is only valid during a database transaction. Attempting to access it after a
+// transaction has ended results in undefined behavior.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlocks(hashes []chainhash.Hash) ([][]byte, error) {
+	// Ensure transaction state is valid.
+	if e := tx.checkClosed(); E.Chk(e) {
+		return nil, e
+	}
+	blocks := make([][]byte, len(hashes))
+	for i := range hashes {
+		var e error
+		blocks[i], e = tx.FetchBlock(&hashes[i])
+		if e != nil {
+			return nil, e
+		}
+	}
+	return blocks, nil
+}
+
+// fetchPendingRegion attempts to fetch the provided region from any block which are pending to be written on commit.
+//
+// It will return nil for the byte slice when the region references a block which is not pending. When the region does
+// reference a pending block, it is bounds checked and returns ErrBlockRegionInvalid if invalid.
+func (tx *transaction) fetchPendingRegion(region *database.BlockRegion) ([]byte, error) {
+	// Nothing to do if the block is not pending to be written on commit.
+	idx, exists := tx.pendingBlocks[*region.Hash]
+	if !exists {
+		return nil, nil
+	}
+	// Return the bytes from the pending block.
+	return flatfile.BlockRegion(region, tx.pendingBlockData[idx].bytes)
+}
+
+// FetchBlockRegion returns the raw serialized bytes for the given block region.
+//
+// The raw bytes are in the format returned by Serialize on a wire.Block and the Offset field in the provided
+// BlockRegion is zero-based and relative to the start of the block (byte 0).
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBlockNotFound if the requested block hash does not exist
+//
+//   - ErrBlockRegionInvalid if the region exceeds the bounds of the associated block
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+//   - ErrCorruption if the database has somehow become corrupted
+//
+// In addition, returns ErrDriverSpecific if any failures occur when reading the block files.
+//
+// NOTE: The data returned by this function is only valid during a database transaction. Attempting to access it after a
+// transaction has ended results in undefined behavior.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlockRegion(region *database.BlockRegion) ([]byte, error) {
+	// Ensure transaction state is valid.
+	if e := tx.checkClosed(); E.Chk(e) {
+		return nil, e
+	}
+	// When the block is pending to be written on commit return the bytes from there.
+	if tx.pendingBlocks != nil {
+		regionBytes, e := tx.fetchPendingRegion(region)
+		if e != nil {
+			return nil, e
+		}
+		if regionBytes != nil {
+			return regionBytes, nil
+		}
+	}
+	// Lookup the location of the block in the files from the block index.
+	location, e := tx.fetchBlockLoc(region.Hash)
+	if e != nil {
+		return nil, e
+	}
+	// Read the region from the appropriate disk block file.
+	return tx.db.store.ReadBlockRegion(region, location)
+}
+
+// FetchBlockRegions returns the raw serialized bytes for the given block regions.
+//
+// The raw bytes are in the format returned by Serialize on a wire.Block and the Offset fields in the provided
+// BlockRegions are zero-based and relative to the start of the block (byte 0).
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBlockNotFound if any of the request block hashes do not exist
+//
+//   - ErrBlockRegionInvalid if one or more region exceed the bounds of the associated block
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+//   - ErrCorruption if the database has somehow become corrupted
+//
+// In addition, returns ErrDriverSpecific if any failures occur when reading the block files.
+//
+// NOTE: The data returned by this function is only valid during a database transaction. Attempting to access it after a
+// transaction has ended results in undefined behavior.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlockRegions(regions []database.BlockRegion) ([][]byte, error) {
+	// Ensure transaction state is valid.
+	if e := tx.checkClosed(); E.Chk(e) {
+		return nil, e
+	}
+	// In order to improve efficiency of loading the bulk data, first grab the block location for all of the requested
+	// block hashes and sort the reads by filenum:offset so that all reads are grouped by file and linear within each
+	// file.
+	//
+	// The fetchList is intentionally allocated with a cap because some of the regions might be fetched from the pending
+	// blocks and hence there is no need to fetch those from disk.
+	blockRegions := make([][]byte, len(regions))
+	fetchList := make([]flatfile.RegionFetch, 0, len(regions))
+	for i := range regions {
+		region := &regions[i]
+		// When the block is pending to be written on commit grab the bytes from there.
+		if tx.pendingBlocks != nil {
+			regionBytes, e := tx.fetchPendingRegion(region)
+			if e != nil {
+				return nil, e
+			}
+			if regionBytes != nil {
+				blockRegions[i] = regionBytes
+				continue
+			}
+		}
+		// Lookup the location of the block in the files from the block index.
+		location, e := tx.fetchBlockLoc(region.Hash)
+		if e != nil {
+			return nil, e
+		}
+		// Ensure the region is within the bounds of the block.
+		if e = flatfile.CheckRegion(region, location); e != nil {
+			return nil, e
+		}
+		fetchList = append(fetchList, flatfile.RegionFetch{Loc: location, Reply: i})
+	}
+	// Read all of the regions in the fetch list and set the results.
+	if e := tx.db.store.ReadBlockRegions(regions, fetchList, blockRegions); e != nil {
+		return nil, e
+	}
+	return blockRegions, nil
+}
+
+// PruneBlocks removes the oldest block files until the total size of the flat block files is no more than the target
+// size, stopping at the first file holding a block that canPrune refuses, and returns the hashes of the removed blocks.
+//
+// The block index entries are deleted as part of the transaction and the files themselves are deleted after it has
+// been committed. The current write file is never removed.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) PruneBlocks(targetSize uint64, canPrune func(hash *chainhash.Hash) bool) (
+	pruned []chainhash.Hash,
+	e error,
+) {
+	// Ensure transaction state is valid.
+	if e = tx.checkClosed(); E.Chk(e) {
+		return nil, e
+	}
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "prune blocks requires a writable database transaction"
+		return nil, makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	files, pruned, e := tx.db.store.Prune(tx.blockIdxBucket.ForEach, tx.pendingPrune, targetSize, canPrune)
+	if e != nil {
+		return nil, convertErr("failed to read block index", e)
+	}
+	for i := range pruned {
+		if e = tx.blockIdxBucket.Delete(pruned[i][:]); E.Chk(e) {
+			return nil, convertErr("failed to remove pruned block from the block index", e)
+		}
+	}
+	tx.pendingPrune = append(tx.pendingPrune, files...)
+	return pruned, nil
+}
+
+// BeenPruned returns whether or not any block files have been removed from the database by PruneBlocks.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) BeenPruned() (bool, error) {
+	// Ensure transaction state is valid.
+	if e := tx.checkClosed(); E.Chk(e) {
+		return false, e
+	}
+	return tx.db.store.FirstFile() > 0 || len(tx.pendingPrune) > 0, nil
+}
+
+// close marks the transaction closed then releases any pending data, the underlying bbolt transaction, the transaction
+// read lock, and the write lock when the transaction is writable.
+func (tx *transaction) close() {
+	tx.closed = true
+	// Clear pending blocks that would have been written on commit.
+	tx.pendingBlocks = nil
+	tx.pendingBlockData = nil
+	tx.pendingPrune = nil
+	tx.pendingEmpty = nil
+	tx.pendingTruncate = nil
+	// Release the bbolt transaction. It has already been closed when it was committed, in which case there is nothing
+	// left to do.
+	if tx.boltTx != nil {
+		if e := tx.boltTx.Rollback(); e != nil && e != bolt.ErrTxClosed {
+			W.Ln("failed to release metadata transaction:", e)
+		}
+		tx.boltTx = nil
+	}
+	tx.db.store.EndTx(tx.storeGen)
+	tx.db.closeLock.RUnlock()
+	// Release the writer lock for writable transactions to unblock any other write transaction which are possibly
+	// waiting.
+	if tx.writable {
+		tx.db.writeLock.Unlock()
+	}
+}
+
+// writePendingAndCommit writes pending block data to the flat block files, updates the block index with their
+// locations as well as the new current write location, syncs the block files and then commits the metadata.
+//
+// Since the metadata is only committed once the block data is safely on disk, the block files can always be rolled back
+// to match the metadata after a failure. It also properly handles rollback in the case of failures.
+func (tx *transaction) writePendingAndCommit() (e error) {
+	// Save the current block store write position for potential rollback.
+	//
+	// These variables are only updated here in this function and there can only be one write transaction active at a
+	// time, so it's safe to store them for potential rollback.
+	store := tx.db.store
+	oldBlkFileNum, oldBlkOffset := store.WriteCursor()
+	// rollback is a closure that is used to rollback all writes to the block files.
+	rollback := func() {
+		// Rollback any modifications made to the block files if needed.
+		store.Rollback(oldBlkFileNum, oldBlkOffset)
+	}
+	if len(tx.pendingBlockData) > 0 || tx.pendingTruncate != nil {
+		// Loop through all of the pending blocks to store and write them.
+		for _, blockData := range tx.pendingBlockData {
+			location, e := store.WriteBlock(blockData.bytes)
+			if e != nil {
+				rollback()
+				return e
+			}
+			// Add a record in the block index for the block with the location information needed to find the block on
+			// the filesystem.
+			if e = tx.blockIdxBucket.Put(blockData.hash[:], flatfile.SerializeLocation(location)); E.Chk(e) {
+				rollback()
+				return convertErr("failed to store block location", e)
+			}
+		}
+		// Update the metadata for the current write file and offset, which is where the block files are to be truncated
+		// to when they will be.
+		writeRow := flatfile.SerializeWriteRow(store.WriteCursor())
+		if tx.pendingTruncate != nil {
+			writeRow = flatfile.SerializeWriteRow(tx.pendingTruncate.FileNum, tx.pendingTruncate.Offset)
+		}
+		if e = tx.internalBucket.Put(writeLocKeyName, writeRow); E.Chk(e) {
+			rollback()
+			return convertErr("failed to store write cursor", e)
+		}
+		// The block data must be on disk before the metadata that refers to it is committed.
+		if e = store.Sync(); E.Chk(e) {
+			rollback()
+			return e
+		}
+	}
+	// Commit the metadata, which bbolt syncs to disk before returning.
+	start := time.Now()
+	if e = tx.boltTx.Commit(); E.Chk(e) {
+		rollback()
+		return convertErr("failed to commit metadata", e)
+	}
+	tx.db.stats.commitTime.ObserveSince(start)
+	// Now that the block index no longer refers to them, remove any block files that were pruned once the transactions
+	// still reading them have finished. A failure here only leaves unreferenced data on disk, so it is not treated as a
+	// failure of the commit.
+	for _, fileNum := range tx.pendingPrune {
+		if e := store.RemoveFile(fileNum); E.Chk(e) {
+			W.F("failed to remove pruned block file %d: %v", fileNum, e)
+		}
+	}
+	// Block files whose blocks were moved are only emptied, and block files are only truncated, once the metadata is on
+	// disk, so an unexpected shutdown can not leave the block index pointing at data that is gone. Emptying also waits
+	// for the transactions that can still read the moved blocks from their old place to finish.
+	for _, fileNum := range tx.pendingEmpty {
+		if e := store.EmptyFile(fileNum); E.Chk(e) {
+			W.F("failed to empty recompressed block file %d: %v", fileNum, e)
+		}
+	}
+	if tx.pendingTruncate != nil {
+		store.Truncate(tx.pendingTruncate.FileNum, tx.pendingTruncate.Offset)
+	}
+	return nil
+}
+
+// Commit commits all changes that have been made to the root metadata bucket and all of its sub-buckets, along with any
+// new blocks, to persistent storage.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) Commit() (e error) {
+	// Prevent commits on managed transactions.
+	if tx.managed {
+		tx.close()
+		panic("managed transaction commit not allowed")
+	}
+	// Ensure transaction state is valid.
+	if e = tx.checkClosed(); E.Chk(e) {
+		return e
+	}
+	// Regardless of whether the commit succeeds, the transaction is closed on return.
+	defer tx.close()
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "Commit requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	// Write pending data.  The function will rollback if any errors occur.
+	return tx.writePendingAndCommit()
+}
+
+// Rollback undoes all changes that have been made to the root bucket and all of its sub-buckets.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) Rollback() (e error) {
+	// Prevent rollbacks on managed transactions.
+	if tx.managed {
+		tx.close()
+		panic("managed transaction rollback not allowed")
+	}
+	// Ensure transaction state is valid.
+	if e = tx.checkClosed(); E.Chk(e) {
+		return e
+	}
+	tx.close()
+	return nil
+}
+
+// db represents a collection of namespaces which are persisted and implements the database.DB interface. All database
+// access is performed through transactions which are obtained through the specific Namespace.
+type db struct {
+	writeLock sync.Mutex   // Limit to one write transaction at a time.
+	closeLock sync.RWMutex // Make database close block while txns active.
+	closed    bool         // Is the database closed?
+	store     *flatfile.Store // Handles read/writing blocks to flat files.
+	bdb       *bolt.DB        // Underlying bbolt database holding the metadata.
+	stats     *dbStats        // Statistics of the commits of the metadata.
+	// quit stops the background recompression of the block files and a backup in progress, and wg waits for the
+	// recompression to finish.
+	quit     chan struct{}
+	quitOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// Enforce db implements the database.DB interface.
+var _ database.DB = (*db)(nil)
+
+// Type returns the database driver type the current database instance was created with.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Type() string {
+	return dbType
+}
+
+// begin is the implementation function for the Begin database method.
+//
+// See its documentation for more details.
+//
+// This function is only separate because it returns the internal transaction which is used by the managed transaction
+// code while the database method returns the interface.
+func (db *db) begin(writable bool) (*transaction, error) {
+	// Whenever a new writable transaction is started, grab the write lock to ensure only a single write transaction can
+	// be active at the same time.
+	//
+	// This lock will not be released until the transaction is closed (via Rollback or Commit).
+	if writable {
+		db.writeLock.Lock()
+	}
+	// Whenever a new transaction is started, grab a read lock against the database to ensure Close will wait for the
+	// transaction to finish.
+	//
+	// This lock will not be released until the transaction is closed (via Rollback or Commit).
+	db.closeLock.RLock()
+	release := func() {
+		db.closeLock.RUnlock()
+		if writable {
+			db.writeLock.Unlock()
+		}
+	}
+	if db.closed {
+		release()
+		return nil, makeDbErr(database.ErrDbNotOpen, errDbNotOpenStr, nil)
+	}
+	// Register the transaction with the block files before beginning the metadata transaction, so the block files its
+	// view of the block index refers to are kept until it has finished.
+	storeGen := db.store.BeginTx()
+	boltTx, e := db.bdb.Begin(writable)
+	if e != nil {
+		db.store.EndTx(storeGen)
+		release()
+		return nil, convertErr("failed to begin metadata transaction", e)
+	}
+	// The metadata and internal buckets are created with the database, so they are only missing if it is corrupt.
+	metaBucket := boltTx.Bucket(metadataBucketName)
+	internalBucket := boltTx.Bucket(internalBucketName)
+	var blockIdxBucket *bolt.Bucket
+	if internalBucket != nil {
+		blockIdxBucket = internalBucket.Bucket(blockIdxBucketName)
+	}
+	if metaBucket == nil || blockIdxBucket == nil {
+		_ = boltTx.Rollback()
+		db.store.EndTx(storeGen)
+		release()
+		str := "metadata database is missing its root buckets"
+		return nil, makeDbErr(database.ErrCorruption, str, nil)
+	}
+	tx := &transaction{
+		writable:       writable,
+		db:             db,
+		boltTx:         boltTx,
+		internalBucket: internalBucket,
+		blockIdxBucket: blockIdxBucket,
+		storeGen:       storeGen,
+	}
+	tx.metaBucket = &bucket{tx: tx, boltBucket: metaBucket}
+	return tx, nil
+}
+
+// Begin starts a transaction which is either read-only or read-write depending on the specified flag.
+//
+// Multiple read-only transactions can be started simultaneously while only a single read-write transaction can be
+// started at a time.
+//
+// The call will block when starting a read-write transaction when one is already open.
+//
+// NOTE: The transaction must be closed by calling Rollback or Commit on it when it is no longer needed. Failure to do so
+// will prevent the database from growing and closing.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Begin(writable bool) (database.Tx, error) {
+	return db.begin(writable)
+}
+
+// rollbackOnPanic rolls the passed transaction back if the code in the calling function panics. This is needed since
+// the mutex on a transaction must be released and a panic in called code would prevent that from happening.
+//
+// NOTE: This can only be handled manually for managed transactions since they control the life-cycle of the
+// transaction.
+//
+// As the documentation on Begin calls out, callers opting to use manual transactions will have to ensure the
+// transaction is rolled back on panic if it desires that functionality as well or the database will fail to close
+// since the read-lock will never be released.
+func rollbackOnPanic(tx *transaction) {
+	if err := recover(); err != nil {
+		tx.managed = false
+		_ = tx.Rollback()
+		panic(err)
+	}
+}
+
+// View invokes the passed function in the context of a managed read-only transaction with the root bucket for the
+// namespace.
+//
+// Any errors returned from the user-supplied function are returned from this function.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) View(fn func(database.Tx) error) (e error) {
+	// Start a read-only transaction.
+	tx, e := db.begin(false)
+	if e != nil {
+		return e
+	}
+	// Since the user-provided function might panic, ensure the transaction releases all mutexes and resources.
+	//
+	// There is no guarantee the caller won't use recover and keep going.
+	//
+	// Thus, the database must still be in a usable state on panics due to caller issues.
+	defer rollbackOnPanic(tx)
+	tx.managed = true
+	e = fn(tx)
+	tx.managed = false
+	if e != nil {
+		// The error is ignored here because nothing was written yet and regardless of a rollback failure, the tx is
+		// closed now anyways.
+		_ = tx.Rollback()
+		return e
+	}
+	return tx.Rollback()
+}
+
+// Update invokes the passed function in the context of a managed read-write transaction with the root bucket for the
+// namespace.
+//
+// Any errors returned from the user-supplied function will cause the transaction to be rolled back and are returned
+// from this function.
+//
+// Otherwise, the transaction is committed when the user-supplied function returns a nil error.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Update(fn func(database.Tx) error) (e error) {
+	// Start a read-write transaction.
+	tx, e := db.begin(true)
+	if e != nil {
+		return e
+	}
+	// Since the user-provided function might panic, ensure the transaction releases all mutexes and resources.
+	//
+	// There is no guarantee the caller won't use recover and keep going.
+	//
+	// Thus, the database must still be in a usable state on panics due to caller issues.
+	defer rollbackOnPanic(tx)
+	tx.managed = true
+	e = fn(tx)
+	tx.managed = false
+	if e != nil {
+		// The error is ignored here because nothing was written yet and regardless of a rollback failure, the tx is
+		// closed now anyways.
+		_ = tx.Rollback()
+		return e
+	}
+	return tx.Commit()
+}
+
+// Close cleanly shuts down the database and syncs all data.
+//
+// It will block until all database transactions have been finalized (rolled back or committed).
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Close() (e error) {
+	// The background recompression starts transactions of its own, so it is stopped before waiting for transactions
+	// to finish.
+	db.quitOnce.Do(func() { close(db.quit) })
+	db.wg.Wait()
+	// Since all transactions have a read lock on this mutex, this will cause Close to wait for all readers to complete.
+	db.closeLock.Lock()
+	defer db.closeLock.Unlock()
+	if db.closed {
+		return makeDbErr(database.ErrDbNotOpen, errDbNotOpenStr, nil)
+	}
+	db.closed = true
+	// NOTE: Since the above lock waits for all transactions to finish and prevents any new ones from being started, it
+	// is safe to clear all state without the individual locks.
+	//
+	// Every transaction is synced to disk as it is committed, so closing the metadata database only releases it. Any
+	// error is saved and returned at the end after the remaining cleanup since the database will be marked closed even
+	// if this fails given there is no good way for the caller to recover from a failure here anyways.
+	var closeErr error
+	if e = db.bdb.Close(); E.Chk(e) {
+		closeErr = convertErr("failed to close metadata database", e)
+	}
+	// Close any open flat files that house the blocks.
+	db.store.Close()
+	return closeErr
+}
+
+// fileExists reports whether the named file or directory exists.
+func fileExists(name string) bool {
+	if _, e := os.Stat(name); os.IsNotExist(e) {
+		return false
+	}
+	return true
+}
+
+// initDB creates the initial buckets and values used by the package.
+//
+// This is mainly in a separate function for testing purposes.
+func initDB(bdb *bolt.DB) (e error) {
+	e = bdb.Update(
+		func(boltTx *bolt.Tx) (e error) {
+			if _, e = boltTx.CreateBucket(metadataBucketName); E.Chk(e) {
+				return e
+			}
+			var internalBucket *bolt.Bucket
+			if internalBucket, e = boltTx.CreateBucket(internalBucketName); E.Chk(e) {
+				return e
+			}
+			if _, e = internalBucket.CreateBucket(blockIdxBucketName); E.Chk(e) {
+				return e
+			}
+			// The starting block file write cursor location is file num 0, offset 0.
+			return internalBucket.Put(writeLocKeyName, flatfile.SerializeWriteRow(0, 0))
+		},
+	)
+	if e != nil {
+		str := fmt.Sprintf("failed to initialize metadata database: %v", e)
+		return convertErr(str, e)
+	}
+	return nil
+}
+
+// openDB opens the database at the provided path.
+//
+// ErrDbDoesNotExist is returned if the database doesn't exist and the create flag is not set, and ErrDbExists if it
+// does and the create flag is set.
+func openDB(dbPath string, network wire.BitcoinNet, create bool, opts flatfile.Options) (database.DB, error) {
+	metadataDbPath := filepath.Join(dbPath, metadataDbName)
+	dbExists := fileExists(metadataDbPath)
+	if !create && !dbExists {
+		str := fmt.Sprintf("database %q does not exist", metadataDbPath)
+		return nil, makeDbErr(database.ErrDbDoesNotExist, str, nil)
+	}
+	if create && dbExists {
+		str := fmt.Sprintf("database %q already exists", metadataDbPath)
+		return nil, makeDbErr(database.ErrDbExists, str, nil)
+	}
+	// Ensure the full path to the database exists.
+	if !dbExists {
+		// The error can be ignored here since the call to bolt.Open will fail if the directory couldn't be created.
+		_ = os.MkdirAll(dbPath, 0700)
+	}
+	// Open the metadata database (will create it if needed).
+	bdb, e := bolt.Open(
+		metadataDbPath, 0600, &bolt.Options{
+			Timeout:         openTimeout,
+			InitialMmapSize: initialMmapSize,
+		},
+	)
+	if e != nil {
+		return nil, convertErr(e.Error(), e)
+	}
+	// Create the block store which includes scanning the existing flat block files to find what the current write
+	// cursor position is according to the data that is actually on disk.
+	flatfile.RemoveStaging(dbPath)
+	store := flatfile.NewStore(dbPath, network, opts.Compression)
+	pdb := &db{store: store, bdb: bdb, stats: newDbStats(), quit: make(chan struct{})}
+	// Perform any reconciliation needed between the block and metadata as well as database initialization, if needed.
+	// The metadata database is closed again on failure so its file lock is released.
+	var idb database.DB
+	if idb, e = reconcileDB(pdb, create, opts.AllowTruncated); E.Chk(e) {
+		_ = bdb.Close()
+		return nil, e
+	}
+	// Blocks written before compression was enabled are compressed in the background.
+	if opts.Compression != NoCompression {
+		pdb.wg.Add(1)
+		go pdb.recompress()
+	}
+	return idb, nil
+}
@@ -0,0 +1,34 @@
+/*Package bboltdb implements a driver for the database package that uses bbolt for the backing metadata and flat files
+for block storage.
+
+The block files are written by the same code as ffldb's and are the same on disk, but the metadata and block index are
+kept in a single bbolt file, which is a copy-on-write B+tree that only ever replaces its root page once a transaction
+has been fully written and synced. An unclean shutdown therefore leaves the metadata at the last committed transaction,
+and the block files are then rolled back to the write position it records, in the same way as ffldb.
+
+Usage
+
+This package is a driver to the database package and provides the database type of "bboltdb". The parameters the Open
+and Create functions take are the database path as a string and the block network:
+
+	db, e := database.Open("bboltdb", "path/to/database", wire.MainNet)
+	if e != nil  {
+		// Handle error
+	}
+	db, e := database.Create("bboltdb", "path/to/database", wire.MainNet)
+	if e != nil  {
+		// Handle error
+	}
+
+Compression and checking
+
+The block files can be compressed with snappy and checked for damaged blocks in the same way as with ffldb, by passing
+SnappyCompression or AllowTruncated after the block network and using the database.BlockChecker the database
+implements:
+
+	db, e := database.Open("bboltdb", "path/to/database", wire.MainNet, bboltdb.SnappyCompression)
+	if e != nil  {
+		// Handle error
+	}
+*/
+package bboltdb
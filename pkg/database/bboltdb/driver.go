@@ -0,0 +1,67 @@
+package bboltdb
+
+import (
+	"fmt"
+
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/database/internal/flatfile"
+)
+
+const (
+	dbType = "bboltdb"
+)
+
+// Compression is the compression applied to the blocks written to the flat block files. It can be passed to the Open
+// and Create functions after the block network.
+type Compression = flatfile.Compression
+
+const (
+	// NoCompression writes the blocks as they are serialized, which is the default.
+	NoCompression = flatfile.NoCompression
+	// SnappyCompression writes the blocks compressed with snappy. Opening a database with it also starts recompressing
+	// the blocks that were written without compression in the background.
+	SnappyCompression = flatfile.SnappyCompression
+)
+
+// OpenFlag changes how a database is opened. Flags can be passed to Open after the block network.
+type OpenFlag = flatfile.OpenFlag
+
+// AllowTruncated opens a database whose block files end before the end of the block data recorded in the metadata,
+// such as after block files were lost or cut short, which is otherwise refused as corruption. It is meant for finding
+// and removing the damaged blocks with CheckBlocks. New blocks are written after the block data that is left.
+const AllowTruncated = flatfile.AllowTruncated
+
+// openDBDriver is the callback provided during driver registration that opens an existing database for use.
+func openDBDriver(args ...interface{}) (database.DB, error) {
+	dbPath, network, opts, e := flatfile.ParseArgs(dbType, "Open", args...)
+	if e != nil {
+		return nil, e
+	}
+	return openDB(dbPath, network, false, opts)
+}
+
+// createDBDriver is the callback provided during driver registration that creates, initializes, and opens a database
+// for use.
+func createDBDriver(args ...interface{}) (database.DB, error) {
+	dbPath, network, opts, e := flatfile.ParseArgs(dbType, "Create", args...)
+	if e != nil {
+		return nil, e
+	}
+	return openDB(dbPath, network, true, opts)
+}
+func init() {
+	// Register the driver.
+	driver := database.Driver{
+		DbType: dbType,
+		Create: createDBDriver,
+		Open:   openDBDriver,
+	}
+	if e := database.RegisterDriver(driver); E.Chk(e) {
+		panic(
+			fmt.Sprintf(
+				"Failed to regiser database driver '%s': %v",
+				dbType, e,
+			),
+		)
+	}
+}
@@ -0,0 +1,520 @@
+package bboltdb_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/p9c/parallelcoin/pkg/block"
+	"github.com/p9c/parallelcoin/pkg/chaincfg"
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/database"
+	databasetest "github.com/p9c/parallelcoin/pkg/database/ci"
+	"github.com/p9c/parallelcoin/pkg/database/bboltdb"
+)
+
+// dbType is the database type name for this driver.
+const dbType = "bboltdb"
+
+// blockFilesDriver hooks this driver into the shared tests of the flat block files.
+var blockFilesDriver = databasetest.BlockFilesDriver{
+	DbType:                  dbType,
+	Network:                 blockDataNet,
+	RunWithMaxBlockFileSize: bboltdb.TstRunWithMaxBlockFileSize,
+	WaitRecompress:          bboltdb.TstWaitRecompress,
+	Recompress:              bboltdb.TstRecompress,
+}
+
+// TestCreateOpenFail ensures that errors related to creating and opening a database are handled properly.
+func TestCreateOpenFail(t *testing.T) {
+	t.Parallel()
+	// Ensure that attempting to open a database that doesn't exist returns the expected error.
+	_, e := database.Open(dbType, "noexist", blockDataNet)
+	if !databasetest.CheckDbError(t, "Open", e, database.ErrDbDoesNotExist) {
+		return
+	}
+	// Ensure that attempting to open or create a database with the wrong parameters returns the expected errors.
+	for _, fn := range []string{"Open", "Create"} {
+		open := database.Open
+		if fn == "Create" {
+			open = database.Create
+		}
+		wantErr := fmt.Errorf(
+			"invalid arguments to %s.%s -- expected "+
+				"database path, block network and optional block compression and open flags", dbType, fn,
+		)
+		if _, e = open(dbType, 1); e == nil || e.Error() != wantErr.Error() {
+			t.Errorf("%s: did not receive expected error - got %v, want %v", fn, e, wantErr)
+			return
+		}
+		wantErr = fmt.Errorf(
+			"first argument to %s.%s is invalid -- "+
+				"expected database path string", dbType, fn,
+		)
+		if _, e = open(dbType, 1, blockDataNet); e == nil || e.Error() != wantErr.Error() {
+			t.Errorf("%s: did not receive expected error - got %v, want %v", fn, e, wantErr)
+			return
+		}
+		wantErr = fmt.Errorf(
+			"second argument to %s.%s is invalid -- "+
+				"expected block network", dbType, fn,
+		)
+		if _, e = open(dbType, "noexist", "invalid"); e == nil || e.Error() != wantErr.Error() {
+			t.Errorf("%s: did not receive expected error - got %v, want %v", fn, e, wantErr)
+			return
+		}
+		wantErr = fmt.Errorf(
+			"argument snappy to %s.%s is invalid -- "+
+				"expected block compression or open flags", dbType, fn,
+		)
+		if _, e = open(dbType, "noexist", blockDataNet, "snappy"); e == nil || e.Error() != wantErr.Error() {
+			t.Errorf("%s: did not receive expected error - got %v, want %v", fn, e, wantErr)
+			return
+		}
+	}
+	dbPath := filepath.Join(os.TempDir(), "bboltdb-createfail")
+	_ = os.RemoveAll(dbPath)
+	db, e := database.Create(dbType, dbPath, blockDataNet)
+	if e != nil {
+		t.Errorf("Create: unexpected error: %v", e)
+		return
+	}
+	defer func() {
+		if e = os.RemoveAll(dbPath); bboltdb.E.Chk(e) {
+		}
+	}()
+	// Ensure that attempting to create a database that already exists returns the expected error.
+	_, e = database.Create(dbType, dbPath, blockDataNet)
+	if !databasetest.CheckDbError(t, "Create", e, database.ErrDbExists) {
+		return
+	}
+	// Ensure operations against a closed database return the expected error.
+	if e = db.Close(); bboltdb.E.Chk(e) {
+	}
+	e = db.View(
+		func(tx database.Tx) (e error) {
+			return nil
+		},
+	)
+	if !databasetest.CheckDbError(t, "View", e, database.ErrDbNotOpen) {
+		return
+	}
+	e = db.Update(
+		func(tx database.Tx) (e error) {
+			return nil
+		},
+	)
+	if !databasetest.CheckDbError(t, "Update", e, database.ErrDbNotOpen) {
+		return
+	}
+	_, e = db.Begin(false)
+	if !databasetest.CheckDbError(t, "Begin(false)", e, database.ErrDbNotOpen) {
+		return
+	}
+	_, e = db.Begin(true)
+	if !databasetest.CheckDbError(t, "Begin(true)", e, database.ErrDbNotOpen) {
+		return
+	}
+	e = db.Close()
+	databasetest.CheckDbError(t, "Close", e, database.ErrDbNotOpen)
+}
+
+// TestPersistence ensures that values stored are still valid after closing and reopening the database.
+func TestPersistence(t *testing.T) {
+	t.Parallel()
+	// Create a new database to run tests against.
+	dbPath := filepath.Join(os.TempDir(), "bboltdb-persistencetest")
+	_ = os.RemoveAll(dbPath)
+	db, e := database.Create(dbType, dbPath, blockDataNet)
+	if e != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, e)
+		return
+	}
+	defer func() {
+		if e = os.RemoveAll(dbPath); bboltdb.E.Chk(e) {
+		}
+	}()
+	// Create a bucket, put some values into it, and store a block so they can be tested for existence on re-open.
+	bucket1Key := []byte("bucket1")
+	storeValues := map[string]string{
+		"b1key1": "foo1",
+		"b1key2": "foo2",
+		"b1key3": "foo3",
+	}
+	genesisBlock := block.NewBlock(chaincfg.MainNetParams.GenesisBlock)
+	genesisHash := chaincfg.MainNetParams.GenesisHash
+	e = db.Update(
+		func(tx database.Tx) (e error) {
+			bucket1, e := tx.Metadata().CreateBucket(bucket1Key)
+			if e != nil {
+				return fmt.Errorf("createBucket: unexpected error: %v", e)
+			}
+			for k, v := range storeValues {
+				if e = bucket1.Put([]byte(k), []byte(v)); E.Chk(e) {
+					return fmt.Errorf("put: unexpected error: %v", e)
+				}
+			}
+			if e = tx.StoreBlock(genesisBlock); E.Chk(e) {
+				return fmt.Errorf("StoreBlock: unexpected error: %v", e)
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Errorf("Update: unexpected error: %v", e)
+		return
+	}
+	// Close and reopen the database to ensure the values persist.
+	if e = db.Close(); bboltdb.E.Chk(e) {
+	}
+	db, e = database.Open(dbType, dbPath, blockDataNet)
+	if e != nil {
+		t.Errorf("Failed to open test database (%s) %v", dbType, e)
+		return
+	}
+	defer func() {
+		if e = db.Close(); bboltdb.E.Chk(e) {
+		}
+	}()
+	e = db.View(
+		func(tx database.Tx) (e error) {
+			bucket1 := tx.Metadata().Bucket(bucket1Key)
+			if bucket1 == nil {
+				return fmt.Errorf("bucket1: unexpected nil bucket")
+			}
+			for k, v := range storeValues {
+				gotVal := bucket1.Get([]byte(k))
+				if !reflect.DeepEqual(gotVal, []byte(v)) {
+					return fmt.Errorf(
+						"get: key '%s' does not match expected value - got %s, want %s",
+						k, gotVal, v,
+					)
+				}
+			}
+			genesisBlockBytes, _ := genesisBlock.Bytes()
+			gotBytes, e := tx.FetchBlock(genesisHash)
+			if e != nil {
+				return fmt.Errorf("fetchBlock: unexpected error: %v", e)
+			}
+			if !reflect.DeepEqual(gotBytes, genesisBlockBytes) {
+				return fmt.Errorf("fetchBlock: stored block mismatch")
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Errorf("view: unexpected error: %v", e)
+	}
+}
+
+// TestReconcile ensures that block data written after the last committed transaction, as is left behind by an unclean
+// shutdown, is removed when the database is opened again.
+func TestReconcile(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(os.TempDir(), "bboltdb-reconciletest")
+	_ = os.RemoveAll(dbPath)
+	db, e := database.Create(dbType, dbPath, blockDataNet)
+	if e != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, e)
+		return
+	}
+	defer func() {
+		if e = os.RemoveAll(dbPath); bboltdb.E.Chk(e) {
+		}
+	}()
+	genesisBlock := block.NewBlock(chaincfg.MainNetParams.GenesisBlock)
+	e = db.Update(
+		func(tx database.Tx) (e error) {
+			return tx.StoreBlock(genesisBlock)
+		},
+	)
+	if e != nil {
+		t.Errorf("StoreBlock: unexpected error: %v", e)
+		return
+	}
+	if e = db.Close(); bboltdb.E.Chk(e) {
+	}
+	// Append data to the block file that the metadata does not know about.
+	blockFile := filepath.Join(dbPath, "000000000.fdb")
+	st, e := os.Stat(blockFile)
+	if e != nil {
+		t.Errorf("Stat: unexpected error: %v", e)
+		return
+	}
+	f, e := os.OpenFile(blockFile, os.O_WRONLY|os.O_APPEND, 0)
+	if e != nil {
+		t.Errorf("OpenFile: unexpected error: %v", e)
+		return
+	}
+	if _, e = f.Write([]byte("partially written block")); E.Chk(e) {
+		t.Errorf("Write: unexpected error: %v", e)
+	}
+	if e = f.Close(); E.Chk(e) {
+	}
+	db, e = database.Open(dbType, dbPath, blockDataNet)
+	if e != nil {
+		t.Errorf("Failed to open test database (%s) %v", dbType, e)
+		return
+	}
+	defer func() {
+		if e = db.Close(); bboltdb.E.Chk(e) {
+		}
+	}()
+	st2, e := os.Stat(blockFile)
+	if e != nil {
+		t.Errorf("Stat: unexpected error: %v", e)
+		return
+	}
+	if st2.Size() != st.Size() {
+		t.Errorf("block file was not rolled back - got size %d, want %d", st2.Size(), st.Size())
+		return
+	}
+	e = db.View(
+		func(tx database.Tx) (e error) {
+			_, e = tx.FetchBlock(genesisBlock.Hash())
+			return e
+		},
+	)
+	if e != nil {
+		t.Errorf("FetchBlock: unexpected error: %v", e)
+	}
+}
+
+// TestPruneBlocks ensures that pruning removes the oldest block files down to the target size, leaves blocks that may
+// not be pruned in place, and that the database can be reopened afterwards.
+func TestPruneBlocks(t *testing.T) {
+	t.Parallel()
+	blocks, e := databasetest.LoadBlocks(t, databasetest.BlockDataFile, databasetest.BlockDataNet)
+	if e != nil {
+		t.Errorf("LoadBlocks: unexpected error: %v", e)
+		return
+	}
+	dbPath := filepath.Join(os.TempDir(), "bboltdb-prunetest")
+	_ = os.RemoveAll(dbPath)
+	db, e := database.Create(dbType, dbPath, blockDataNet)
+	if e != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, e)
+		return
+	}
+	defer func() {
+		if e = os.RemoveAll(dbPath); bboltdb.E.Chk(e) {
+		}
+	}()
+	// Change the maximum file size to a small value to force multiple flat files with the test data set.
+	bboltdb.TstRunWithMaxBlockFileSize(
+		db, 2048, func() {
+			e = db.Update(
+				func(tx database.Tx) (e error) {
+					for i := range blocks {
+						if e = tx.StoreBlock(blocks[i]); E.Chk(e) {
+							return e
+						}
+					}
+					return nil
+				},
+			)
+		},
+	)
+	if e != nil {
+		t.Errorf("StoreBlock: unexpected error: %v", e)
+		return
+	}
+	// Refuse to prune the block at index 100 so pruning has to stop at the file that holds it.
+	keep := blocks[100].Hash()
+	var pruned []chainhash.Hash
+	e = db.Update(
+		func(tx database.Tx) (e error) {
+			pruned, e = tx.PruneBlocks(
+				0, func(hash *chainhash.Hash) bool {
+					return !hash.IsEqual(keep)
+				},
+			)
+			return e
+		},
+	)
+	if e != nil {
+		t.Errorf("PruneBlocks: unexpected error: %v", e)
+		return
+	}
+	if len(pruned) == 0 || len(pruned) >= 100 {
+		t.Errorf("PruneBlocks: unexpected number of pruned blocks %d", len(pruned))
+		return
+	}
+	if _, e = os.Stat(filepath.Join(dbPath, "000000000.fdb")); !os.IsNotExist(e) {
+		t.Errorf("PruneBlocks: first block file was not removed")
+		return
+	}
+	// Close and reopen the database to ensure the pruned state is consistent with the files on disk.
+	if e = db.Close(); bboltdb.E.Chk(e) {
+	}
+	db, e = database.Open(dbType, dbPath, blockDataNet)
+	if e != nil {
+		t.Errorf("Failed to open pruned test database (%s) %v", dbType, e)
+		return
+	}
+	defer func() {
+		if e = db.Close(); bboltdb.E.Chk(e) {
+		}
+	}()
+	e = db.View(
+		func(tx database.Tx) (e error) {
+			if _, e = tx.FetchBlock(blocks[0].Hash()); !databasetest.CheckDbError(
+				t, "FetchBlock", e, database.ErrBlockNotFound,
+			) {
+				return fmt.Errorf("FetchBlock: unexpected result for pruned block")
+			}
+			if _, e = tx.FetchBlock(keep); E.Chk(e) {
+				return fmt.Errorf("FetchBlock: unexpected error for kept block: %v", e)
+			}
+			var beenPruned bool
+			if beenPruned, e = tx.BeenPruned(); E.Chk(e) {
+				return e
+			}
+			if !beenPruned {
+				return fmt.Errorf("BeenPruned: expected true after reopening")
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Errorf("View: unexpected error: %v", e)
+	}
+}
+
+// TestBackup ensures a backup taken while blocks are being stored opens as a database holding the blocks stored before
+// it was taken and none of the later ones.
+func TestBackup(t *testing.T) {
+	t.Parallel()
+	blocks, e := databasetest.LoadBlocks(t, databasetest.BlockDataFile, databasetest.BlockDataNet)
+	if e != nil {
+		t.Errorf("LoadBlocks: unexpected error: %v", e)
+		return
+	}
+	dbPath := filepath.Join(os.TempDir(), "bboltdb-backuptest")
+	backupPath := filepath.Join(os.TempDir(), "bboltdb-backuptest-backup")
+	_ = os.RemoveAll(dbPath)
+	_ = os.RemoveAll(backupPath)
+	db, e := database.Create(dbType, dbPath, blockDataNet)
+	if e != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, e)
+		return
+	}
+	defer func() {
+		if e = os.RemoveAll(dbPath); bboltdb.E.Chk(e) {
+		}
+		if e = os.RemoveAll(backupPath); bboltdb.E.Chk(e) {
+		}
+	}()
+	storeBlocks := func(blocks []*block.Block) (e error) {
+		for i := range blocks {
+			if e = db.Update(
+				func(tx database.Tx) (e error) {
+					return tx.StoreBlock(blocks[i])
+				},
+			); E.Chk(e) {
+				return e
+			}
+		}
+		return nil
+	}
+	half := len(blocks) / 2
+	bboltdb.TstRunWithMaxBlockFileSize(
+		db, 2048, func() {
+			if e = storeBlocks(blocks[:half]); e != nil {
+				t.Errorf("StoreBlock: unexpected error: %v", e)
+				return
+			}
+			// Back the database up while the rest of the blocks are stored.
+			done := make(chan error)
+			go func() {
+				done <- storeBlocks(blocks[half:])
+			}()
+			if e = db.Backup(backupPath); e != nil {
+				t.Errorf("Backup: unexpected error: %v", e)
+			}
+			if e = <-done; e != nil {
+				t.Errorf("StoreBlock: unexpected error: %v", e)
+			}
+		},
+	)
+	if e = db.Close(); bboltdb.E.Chk(e) {
+	}
+	if t.Failed() {
+		return
+	}
+	if e = db.Backup(backupPath + "-closed"); !databasetest.CheckDbError(t, "Backup", e, database.ErrDbNotOpen) {
+		return
+	}
+	backup, e := database.Open(dbType, backupPath, blockDataNet)
+	if e != nil {
+		t.Errorf("Failed to open backup (%s) %v", dbType, e)
+		return
+	}
+	defer func() {
+		if e = backup.Close(); bboltdb.E.Chk(e) {
+		}
+	}()
+	e = backup.View(
+		func(tx database.Tx) (e error) {
+			var stored int
+			for i := range blocks {
+				var has bool
+				if has, e = tx.HasBlock(blocks[i].Hash()); E.Chk(e) {
+					return e
+				}
+				if !has {
+					if i < half {
+						return fmt.Errorf("HasBlock #%d: block stored before the backup is missing", i)
+					}
+					continue
+				}
+				if stored != i {
+					return fmt.Errorf("HasBlock #%d: block is in the backup while block #%d is not", i, stored)
+				}
+				stored++
+				var gotBytes, wantBytes []byte
+				if gotBytes, e = tx.FetchBlock(blocks[i].Hash()); E.Chk(e) {
+					return fmt.Errorf("FetchBlock #%d: %v", i, e)
+				}
+				if wantBytes, e = blocks[i].Bytes(); E.Chk(e) {
+					return e
+				}
+				if !reflect.DeepEqual(gotBytes, wantBytes) {
+					return fmt.Errorf("FetchBlock #%d: bytes do not match the stored block", i)
+				}
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Errorf("%v", e)
+	}
+}
+
+// TestCompression ensures that blocks written without compression are recompressed in the background once the database
+// is opened with compression, and that blocks read back the same whichever way they are stored.
+func TestCompression(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(os.TempDir(), "bboltdb-compresstest")
+	_ = os.RemoveAll(dbPath)
+	databasetest.TestCompression(t, blockFilesDriver, dbPath)
+}
+
+// TestRecompressReader ensures a transaction that began before the block files were recompressed can still read the
+// blocks from where they were before, and that the old block files are emptied once it has finished.
+func TestRecompressReader(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(os.TempDir(), "bboltdb-recompressreadertest")
+	_ = os.RemoveAll(dbPath)
+	databasetest.TestRecompressReader(t, blockFilesDriver, dbPath)
+}
+
+// TestCheckBlocks ensures that CheckBlocks finds and repairs damaged and truncated blocks.
+func TestCheckBlocks(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(os.TempDir(), "bboltdb-checktest")
+	_ = os.RemoveAll(dbPath)
+	databasetest.TestCheckBlocks(t, blockFilesDriver, dbPath)
+}
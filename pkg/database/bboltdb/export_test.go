@@ -0,0 +1,31 @@
+/*This test file is part of the bboltdb package rather than than the bboltdb_test package so it can bridge access to the internals to properly test cases which are either not possible or can't reliably be tested via the public interface. The functions are only exported while the tests are being run.
+ */
+
+package bboltdb
+
+import (
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/database/internal/flatfile"
+)
+
+// TstRunWithMaxBlockFileSize runs the passed function with the maximum allowed file size for the database set to the
+// provided value. The value will be set back to the original value upon completion.
+func TstRunWithMaxBlockFileSize(idb database.DB, size uint32, fn func()) {
+	store := idb.(*db).store
+	origSize := store.SetMaxFileSize(size)
+	fn()
+	store.SetMaxFileSize(origSize)
+}
+
+// TstWaitRecompress waits for the background recompression of the block files of the database to finish.
+func TstWaitRecompress(idb database.DB) {
+	idb.(*db).wg.Wait()
+}
+
+// TstRecompress turns on compression for the blocks written to the database and recompresses its block files, returning
+// once that is done.
+func TstRecompress(idb database.DB) {
+	pdb := idb.(*db)
+	pdb.store.SetCompression(flatfile.SnappyCompression)
+	pdb.store.Recompress(pdb, pdb.quit)
+}
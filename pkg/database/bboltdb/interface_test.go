@@ -0,0 +1,49 @@
+package bboltdb_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/database/bboltdb"
+	databasetest "github.com/p9c/parallelcoin/pkg/database/ci"
+)
+
+// blockDataNet is the network the test databases are created for.
+var blockDataNet = databasetest.BlockDataNet
+
+// TestInterface performs all interfaces tests for this database driver.
+func TestInterface(t *testing.T) {
+	t.Parallel()
+	// Create a new database to run tests against.
+	dbPath := filepath.Join(os.TempDir(), "bboltdb-interfacetest")
+	_ = os.RemoveAll(dbPath)
+	db, e := database.Create(dbType, dbPath, blockDataNet)
+	if e != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, e)
+		return
+	}
+	defer func() {
+		if e = os.RemoveAll(dbPath); bboltdb.E.Chk(e) {
+		}
+	}()
+	defer func() {
+		if e = db.Close(); bboltdb.E.Chk(e) {
+		}
+	}()
+	// Ensure the driver type is the expected value.
+	if gotDbType := db.Type(); gotDbType != dbType {
+		t.Errorf("Type: unexpected driver type - got %v, want %v", gotDbType, dbType)
+		return
+	}
+	// Run all of the interface tests against the database.
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	// Change the maximum file size to a small value to force multiple flat files with the test data set.
+	bboltdb.TstRunWithMaxBlockFileSize(
+		db, 2048, func() {
+			databasetest.TestInterface(t, db)
+		},
+	)
+}
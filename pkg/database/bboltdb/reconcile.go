@@ -0,0 +1,34 @@
+package bboltdb
+
+import (
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/database/internal/flatfile"
+)
+
+// reconcileDB reconciles the metadata with the flat block files on disk. It will also initialize the underlying
+// database if the create flag is set. Block files that end before the metadata says they do are only accepted when
+// allowTruncated is set.
+func reconcileDB(pdb *db, create, allowTruncated bool) (database.DB, error) {
+	// Perform initial internal bucket and value creation during database creation.
+	if create {
+		if e := initDB(pdb.bdb); E.Chk(e) {
+			return nil, e
+		}
+	}
+	// Load the current write cursor position from the metadata.
+	var curFileNum, curOffset uint32
+	e := pdb.View(
+		func(tx database.Tx) (e error) {
+			writeRow := tx.(*transaction).internalBucket.Get(writeLocKeyName)
+			curFileNum, curOffset, e = flatfile.DeserializeWriteRow(writeRow)
+			return e
+		},
+	)
+	if e != nil {
+		return nil, e
+	}
+	if e = pdb.store.Reconcile(curFileNum, curOffset, allowTruncated); e != nil {
+		return nil, e
+	}
+	return pdb, nil
+}
@@ -0,0 +1,47 @@
+package bboltdb
+
+import (
+	"github.com/p9c/parallelcoin/pkg/database"
+)
+
+// Enforce db implements the database.StatsReporter interface.
+var _ database.StatsReporter = (*db)(nil)
+
+// dbStats holds the statistics the database keeps of its metadata from the time it is opened.
+type dbStats struct {
+	// commitTime is the distribution of how long the commits of the metadata of write transactions took.
+	commitTime *database.Histogram
+}
+
+// newDbStats returns statistics with nothing counted yet.
+func newDbStats() *dbStats {
+	return &dbStats{commitTime: database.NewHistogram(database.DurationBounds)}
+}
+
+// Stats returns a snapshot of the statistics of the database:
+//
+//   - bolt.read_txs, bolt.open_read_txs and bolt.free_pages are the read transactions started and still open and the
+//     free pages of the metadata file, as reported by bbolt
+//
+//   - bolt.page_writes and bolt.write_microseconds are the pages written by the commits of the metadata and the time
+//     spent writing them, and commit.seconds is how long each commit took
+//
+//   - blockfiles.open is the number of block files with an open handle, blockfiles.written_bytes and
+//     blockfiles.read_bytes the bytes written to and read from them, and blockfile.<number>.written_bytes the bytes
+//     written to each file that was written to
+//
+//   - blocks.written and blocks.read count the blocks stored and the blocks and block regions read
+//
+// This function is part of the database.StatsReporter interface implementation.
+func (db *db) Stats() database.Stats {
+	stats := database.NewStats()
+	boltStats := db.bdb.Stats()
+	stats.Counters["bolt.read_txs"] = uint64(boltStats.TxN)
+	stats.Counters["bolt.page_writes"] = uint64(boltStats.TxStats.Write)
+	stats.Counters["bolt.write_microseconds"] = uint64(boltStats.TxStats.WriteTime.Microseconds())
+	stats.Gauges["bolt.open_read_txs"] = int64(boltStats.OpenTxN)
+	stats.Gauges["bolt.free_pages"] = int64(boltStats.FreePageN)
+	stats.Histograms["commit.seconds"] = db.stats.commitTime.Stats()
+	db.store.AddStats(stats)
+	return stats
+}
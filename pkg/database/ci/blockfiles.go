@@ -0,0 +1,380 @@
+package databasetest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/database/internal/flatfile"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// BlockFilesDriver describes a database driver that stores its blocks in flat block files, along with the hooks its
+// tests export to reach into an open database.
+type BlockFilesDriver struct {
+	// DbType is the database type name the driver is registered with.
+	DbType string
+	// Network is the block network the test databases are created for.
+	Network wire.BitcoinNet
+	// RunWithMaxBlockFileSize runs the passed function with the maximum size of the block files of the database set to
+	// the passed size.
+	RunWithMaxBlockFileSize func(db database.DB, size uint32, fn func())
+	// WaitRecompress waits for the background recompression of the block files of the database to finish.
+	WaitRecompress func(db database.DB)
+	// Recompress turns on compression for the blocks written to the database and recompresses its block files,
+	// returning once that is done.
+	Recompress func(db database.DB)
+}
+
+// blockFilesSize returns the total size of the flat block files of the database at the passed path.
+func blockFilesSize(t Tester, dbPath string) (size int64) {
+	matches, _ := filepath.Glob(filepath.Join(dbPath, "*.fdb"))
+	for i := range matches {
+		fi, e := os.Stat(matches[i])
+		if e != nil {
+			t.Errorf("Stat: unexpected error: %v", e)
+			continue
+		}
+		size += fi.Size()
+	}
+	return size
+}
+
+// TestCompression ensures that blocks written without compression are recompressed in the background once the database
+// is opened with compression, that the old block files are emptied, and that blocks and block regions read back the
+// same whichever way they are stored.
+func TestCompression(t Tester, d BlockFilesDriver, dbPath string) {
+	// The test block data carries the bitcoin main network magic.
+	blocks, e := LoadBlocks(t, BlockDataFile, BlockDataNet)
+	if e != nil {
+		t.Errorf("LoadBlocks: unexpected error: %v", e)
+		return
+	}
+	// Create a new database without compression and store the blocks in several flat files.
+	_ = os.RemoveAll(dbPath)
+	db, e := database.Create(d.DbType, dbPath, d.Network)
+	if e != nil {
+		t.Errorf("Failed to create test database (%s) %v", d.DbType, e)
+		return
+	}
+	defer func() {
+		if e = os.RemoveAll(dbPath); E.Chk(e) {
+		}
+	}()
+	d.RunWithMaxBlockFileSize(
+		db, 2048, func() {
+			for i := range blocks {
+				e = db.Update(
+					func(tx database.Tx) (e error) {
+						return tx.StoreBlock(blocks[i])
+					},
+				)
+				if e != nil {
+					t.Errorf("StoreBlock #%d: unexpected error: %v", i, e)
+					return
+				}
+			}
+		},
+	)
+	if e = db.Close(); E.Chk(e) {
+	}
+	rawSize := blockFilesSize(t, dbPath)
+	// Reopen the database with compression and wait for the existing blocks to be recompressed.
+	db, e = database.Open(d.DbType, dbPath, d.Network, flatfile.SnappyCompression)
+	if e != nil {
+		t.Errorf("Failed to open test database with compression (%s) %v", d.DbType, e)
+		return
+	}
+	d.WaitRecompress(db)
+	if fi, e := os.Stat(flatfile.FilePath(dbPath, 0)); e != nil || fi.Size() != 0 {
+		t.Errorf("recompress: first block file was not emptied")
+	}
+	if compressedSize := blockFilesSize(t, dbPath); compressedSize >= rawSize {
+		t.Errorf("recompress: block files use %d bytes, no less than %d before", compressedSize, rawSize)
+	}
+	// checkBlocks ensures all of the blocks and some regions of them read back as they were stored.
+	checkBlocks := func(db database.DB) error {
+		return db.View(
+			func(tx database.Tx) (e error) {
+				for i := range blocks {
+					var gotBytes, wantBytes []byte
+					if gotBytes, e = tx.FetchBlock(blocks[i].Hash()); E.Chk(e) {
+						return fmt.Errorf("FetchBlock #%d: %v", i, e)
+					}
+					if wantBytes, e = blocks[i].Bytes(); E.Chk(e) {
+						return e
+					}
+					if !reflect.DeepEqual(gotBytes, wantBytes) {
+						return fmt.Errorf("FetchBlock #%d: bytes do not match the stored block", i)
+					}
+					regions := []database.BlockRegion{
+						{Hash: blocks[i].Hash(), Offset: 0, Len: 80},
+						{Hash: blocks[i].Hash(), Offset: 1, Len: uint32(len(wantBytes)) - 1},
+						{Hash: blocks[0].Hash(), Offset: 4, Len: 32},
+					}
+					var gotRegions [][]byte
+					if gotRegions, e = tx.FetchBlockRegions(regions); E.Chk(e) {
+						return fmt.Errorf("FetchBlockRegions #%d: %v", i, e)
+					}
+					genesisBytes, _ := blocks[0].Bytes()
+					if !reflect.DeepEqual(gotRegions[0], wantBytes[:80]) ||
+						!reflect.DeepEqual(gotRegions[1], wantBytes[1:]) ||
+						!reflect.DeepEqual(gotRegions[2], genesisBytes[4:36]) {
+						return fmt.Errorf("FetchBlockRegions #%d: regions do not match the stored block", i)
+					}
+					var gotRegion []byte
+					if gotRegion, e = tx.FetchBlockRegion(&regions[1]); E.Chk(e) {
+						return fmt.Errorf("FetchBlockRegion #%d: %v", i, e)
+					}
+					if !reflect.DeepEqual(gotRegion, wantBytes[1:]) {
+						return fmt.Errorf("FetchBlockRegion #%d: region does not match the stored block", i)
+					}
+					invalid := database.BlockRegion{Hash: blocks[i].Hash(), Offset: 1, Len: uint32(len(wantBytes))}
+					if _, e = tx.FetchBlockRegion(&invalid); !CheckDbError(
+						t, "FetchBlockRegion", e, database.ErrBlockRegionInvalid,
+					) {
+						return fmt.Errorf("FetchBlockRegion #%d: unexpected result for region out of bounds", i)
+					}
+				}
+				return nil
+			},
+		)
+	}
+	if e = checkBlocks(db); E.Chk(e) {
+		t.Errorf("compressed: %v", e)
+	}
+	// The compressed blocks must still be readable after reopening the database without compression.
+	if e = db.Close(); E.Chk(e) {
+	}
+	db, e = database.Open(d.DbType, dbPath, d.Network)
+	if e != nil {
+		t.Errorf("Failed to reopen test database (%s) %v", d.DbType, e)
+		return
+	}
+	defer func() {
+		if e = db.Close(); E.Chk(e) {
+		}
+	}()
+	if e = checkBlocks(db); E.Chk(e) {
+		t.Errorf("reopened: %v", e)
+	}
+}
+
+// TestRecompressReader ensures that a transaction that began before the block files were recompressed still reads the
+// blocks from the old block files, and that those are only emptied once it has finished.
+func TestRecompressReader(t Tester, d BlockFilesDriver, dbPath string) {
+	// The test block data carries the bitcoin main network magic.
+	blocks, e := LoadBlocks(t, BlockDataFile, BlockDataNet)
+	if e != nil {
+		t.Errorf("LoadBlocks: unexpected error: %v", e)
+		return
+	}
+	db, e := database.Create(d.DbType, dbPath, d.Network)
+	if e != nil {
+		t.Errorf("Failed to create test database (%s) %v", d.DbType, e)
+		return
+	}
+	defer func() {
+		if e = os.RemoveAll(dbPath); E.Chk(e) {
+		}
+	}()
+	defer func() {
+		if e = db.Close(); E.Chk(e) {
+		}
+	}()
+	d.RunWithMaxBlockFileSize(
+		db, 2048, func() {
+			for i := range blocks {
+				e = db.Update(
+					func(tx database.Tx) (e error) {
+						return tx.StoreBlock(blocks[i])
+					},
+				)
+				if e != nil {
+					t.Errorf("StoreBlock #%d: unexpected error: %v", i, e)
+					return
+				}
+			}
+		},
+	)
+	// fetchBlocks ensures all of the blocks and a region of each read back through the passed transaction as they were
+	// stored.
+	fetchBlocks := func(tx database.Tx) (e error) {
+		for i := range blocks {
+			var gotBytes, wantBytes []byte
+			if gotBytes, e = tx.FetchBlock(blocks[i].Hash()); E.Chk(e) {
+				return fmt.Errorf("FetchBlock #%d: %v", i, e)
+			}
+			if wantBytes, e = blocks[i].Bytes(); E.Chk(e) {
+				return e
+			}
+			if !reflect.DeepEqual(gotBytes, wantBytes) {
+				return fmt.Errorf("FetchBlock #%d: bytes do not match the stored block", i)
+			}
+			var gotRegion []byte
+			region := database.BlockRegion{Hash: blocks[i].Hash(), Offset: 1, Len: uint32(len(wantBytes)) - 1}
+			if gotRegion, e = tx.FetchBlockRegion(&region); E.Chk(e) {
+				return fmt.Errorf("FetchBlockRegion #%d: %v", i, e)
+			}
+			if !reflect.DeepEqual(gotRegion, wantBytes[1:]) {
+				return fmt.Errorf("FetchBlockRegion #%d: region does not match the stored block", i)
+			}
+		}
+		return nil
+	}
+	tx, e := db.Begin(false)
+	if e != nil {
+		t.Errorf("Begin: unexpected error: %v", e)
+		return
+	}
+	d.Recompress(db)
+	if fi, e := os.Stat(flatfile.FilePath(dbPath, 0)); e != nil || fi.Size() == 0 {
+		t.Errorf("recompress: first block file was emptied while a transaction could still read it")
+	}
+	if e = fetchBlocks(tx); E.Chk(e) {
+		t.Errorf("reader open during recompression: %v", e)
+	}
+	if e = tx.Rollback(); E.Chk(e) {
+		t.Errorf("Rollback: unexpected error: %v", e)
+		return
+	}
+	// The old block files are emptied as soon as the last transaction that could read them has finished.
+	if fi, e := os.Stat(flatfile.FilePath(dbPath, 0)); e != nil || fi.Size() != 0 {
+		t.Errorf("recompress: first block file was not emptied once the reader finished")
+	}
+	if e = db.View(fetchBlocks); E.Chk(e) {
+		t.Errorf("reader after recompression: %v", e)
+	}
+}
+
+// TestCheckBlocks ensures that damaged blocks are found by CheckBlocks, that a database with truncated block files can
+// only be opened with AllowTruncated, and that repairing removes the damaged blocks and truncates the block files so the
+// database opens normally again.
+func TestCheckBlocks(t Tester, d BlockFilesDriver, dbPath string) {
+	// The test block data carries the bitcoin main network magic.
+	blocks, e := LoadBlocks(t, BlockDataFile, BlockDataNet)
+	if e != nil {
+		t.Errorf("LoadBlocks: unexpected error: %v", e)
+		return
+	}
+	_ = os.RemoveAll(dbPath)
+	db, e := database.Create(d.DbType, dbPath, d.Network)
+	if e != nil {
+		t.Errorf("Failed to create test database (%s) %v", d.DbType, e)
+		return
+	}
+	defer func() {
+		if e = os.RemoveAll(dbPath); E.Chk(e) {
+		}
+	}()
+	d.RunWithMaxBlockFileSize(
+		db, 2048, func() {
+			for i := range blocks {
+				e = db.Update(
+					func(tx database.Tx) (e error) {
+						return tx.StoreBlock(blocks[i])
+					},
+				)
+				if e != nil {
+					t.Errorf("StoreBlock #%d: unexpected error: %v", i, e)
+					return
+				}
+			}
+		},
+	)
+	problems, e := db.(database.BlockChecker).CheckBlocks(false, nil)
+	if e != nil || len(problems) != 0 {
+		t.Errorf("CheckBlocks: unexpected problems %v, error %v", problems, e)
+		return
+	}
+	if e = db.Close(); E.Chk(e) {
+	}
+	// Damage a byte inside the first block of the second block file and cut the end off the last block file.
+	f, e := os.OpenFile(flatfile.FilePath(dbPath, 1), os.O_RDWR, 0)
+	if e != nil {
+		t.Errorf("OpenFile: unexpected error: %v", e)
+		return
+	}
+	if _, e = f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, 20); E.Chk(e) {
+		t.Errorf("WriteAt: unexpected error: %v", e)
+	}
+	_ = f.Close()
+	matches, _ := filepath.Glob(filepath.Join(dbPath, "*.fdb"))
+	last := matches[len(matches)-1]
+	fi, e := os.Stat(last)
+	if e != nil {
+		t.Errorf("Stat: unexpected error: %v", e)
+		return
+	}
+	if e = os.Truncate(last, fi.Size()-10); E.Chk(e) {
+		t.Errorf("Truncate: unexpected error: %v", e)
+		return
+	}
+	if _, e = database.Open(d.DbType, dbPath, d.Network); !CheckDbError(t, "Open", e, database.ErrCorruption) {
+		return
+	}
+	if db, e = database.Open(d.DbType, dbPath, d.Network, flatfile.AllowTruncated); e != nil {
+		t.Errorf("Open with AllowTruncated: unexpected error: %v", e)
+		return
+	}
+	checker := db.(database.BlockChecker)
+	if problems, e = checker.CheckBlocks(false, nil); e != nil {
+		t.Errorf("CheckBlocks: unexpected error: %v", e)
+		return
+	}
+	lastHash := blocks[len(blocks)-1].Hash()
+	if len(problems) != 2 || !problems[1].Hash.IsEqual(lastHash) || problems[0].Repaired {
+		t.Errorf("CheckBlocks: unexpected problems %v", problems)
+		return
+	}
+	damaged := problems[0].Hash
+	if problems, e = checker.CheckBlocks(true, nil); e != nil || len(problems) != 2 || !problems[0].Repaired {
+		t.Errorf("CheckBlocks repair: unexpected problems %v, error %v", problems, e)
+		return
+	}
+	if problems, e = checker.CheckBlocks(false, nil); e != nil || len(problems) != 0 {
+		t.Errorf("CheckBlocks after repair: unexpected problems %v, error %v", problems, e)
+		return
+	}
+	if e = db.Close(); E.Chk(e) {
+	}
+	// The repaired database opens normally, no longer has the damaged blocks and takes the last block again.
+	if db, e = database.Open(d.DbType, dbPath, d.Network); e != nil {
+		t.Errorf("Open after repair: unexpected error: %v", e)
+		return
+	}
+	defer func() {
+		if e = db.Close(); E.Chk(e) {
+		}
+	}()
+	e = db.Update(
+		func(tx database.Tx) (e error) {
+			for _, hash := range []*chainhash.Hash{&damaged, lastHash} {
+				var has bool
+				if has, e = tx.HasBlock(hash); E.Chk(e) {
+					return e
+				}
+				if has {
+					return fmt.Errorf("HasBlock: damaged block %v still exists", hash)
+				}
+			}
+			return tx.StoreBlock(blocks[len(blocks)-1])
+		},
+	)
+	if e != nil {
+		t.Errorf("Update after repair: unexpected error: %v", e)
+		return
+	}
+	e = db.View(
+		func(tx database.Tx) (e error) {
+			_, e = tx.FetchBlock(lastHash)
+			return e
+		},
+	)
+	if e != nil {
+		t.Errorf("FetchBlock after repair: unexpected error: %v", e)
+	}
+}
@@ -0,0 +1,5 @@
+// Copyright (c) 2015-2016 The btcsuite developers
+
+// Package databasetest provides exported tests that can be imported and consumed by database driver tests to help
+// ensure that drivers conform to the database driver interface correctly.
+package databasetest
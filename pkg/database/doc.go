@@ -7,8 +7,10 @@ turns out to be over 60GB of data). This package provides a database layer to st
 and efficient manner.
 
 The default backend, ffldb, has a strong focus on speed, efficiency, and robustness. It makes use leveldb for the
-metadata, flat files for block storage, and strict checksums in key areas to ensure data integrity. A quick overview of
-the features database provides are as follows:
+metadata, flat files for block storage, and strict checksums in key areas to ensure data integrity. The bboltdb backend
+uses the same block files but keeps the metadata in bbolt, and an ffldb database can be moved to it with pod db convert,
+and pod db check checks and repairs a database. The memdb backend keeps everything in memory, for tests and nodes that
+do not need to keep their chain. A quick overview of the features database provides are as follows:
 
  - Key/value metadata store
 
@@ -20,6 +22,10 @@ the features database provides are as follows:
 
  - Nested buckets
 
+ - Consistent backups of a database in use
+
+ - Statistics of the operation of a database, such as cache hit rates and block file I/O
+
  - Supports registration of backend databases
 
  - Comprehensive test coverage
@@ -32,7 +38,14 @@ identifies the specific database driver (backend) to use as well as arguments sp
 interface provides facilities for obtaining transactions (the Tx interface) that are the basis of all database reads and
 writes. Unlike some database interfaces that support reading and writing without transactions, this interface requires
 transactions even when only reading or writing a single key. The Begin function provides an unmanaged transaction while
-the View and Update functions provide a managed transaction. These are described in more detail below.
+the View and Update functions provide a managed transaction. These are described in more detail below. The Backup
+function writes a copy of the database that can be opened with the same driver, holding off writes only while it
+captures the state of the database, so a running node can be backed up with the backupdb RPC command.
+
+Drivers that keep statistics of their own operation, such as the hit rate of their cache, how long flushing it takes and
+the bytes written to each block file, implement the StatsReporter interface. The Counter and Histogram types they are
+kept in can be used by users of a database for their own statistics, which the getdbstats RPC command reports along with
+those of the database.
 
 Transactions
 
@@ -0,0 +1,142 @@
+package ffldb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/btcsuite/goleveldb/leveldb"
+	"github.com/btcsuite/goleveldb/leveldb/filter"
+	"github.com/btcsuite/goleveldb/leveldb/opt"
+
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/database/internal/flatfile"
+)
+
+// backupBatchSize is the number of metadata entries written to the backup in each leveldb batch.
+const backupBatchSize = 10000
+
+// Backup writes a consistent copy of the database to the directory at dest, which must not exist yet, while the
+// database remains open for reading and writing.
+//
+// Write transactions are only held off while the database cache is flushed, a snapshot of the metadata is taken and the
+// block files up to the write cursor are hard linked into a staging directory, which keeps them from changing or being
+// removed by pruning. The metadata is then copied from the snapshot and the staged block files are moved or copied into
+// the backup, up to the write cursor for the current write file. Closing the database stops a backup in progress.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Backup(dest string) (e error) {
+	start := time.Now()
+	if _, e = os.Stat(dest); e == nil {
+		str := fmt.Sprintf("backup destination %q already exists", dest)
+		return makeDbErr(database.ErrDbExists, str, nil)
+	}
+	// The locks are taken in the same order as a write transaction takes them, and the read lock on closeLock is held
+	// for the whole backup so the database is not closed under it.
+	db.writeLock.Lock()
+	db.closeLock.RLock()
+	defer db.closeLock.RUnlock()
+	if db.closed {
+		db.writeLock.Unlock()
+		return makeDbErr(database.ErrDbNotOpen, errDbNotOpenStr, nil)
+	}
+	snapshot, staged, e := db.stageBackup()
+	db.writeLock.Unlock()
+	if e != nil {
+		return e
+	}
+	defer snapshot.Release()
+	defer staged.Remove()
+	if e = os.MkdirAll(dest, 0700); E.Chk(e) {
+		return makeDbErr(database.ErrDriverSpecific, e.Error(), e)
+	}
+	var entries int
+	if entries, e = db.backupMetadata(snapshot, filepath.Join(dest, metadataDbName)); e == nil {
+		e = staged.CopyTo(dest, db.quit)
+	}
+	if e != nil {
+		if e := os.RemoveAll(dest); E.Chk(e) {
+		}
+		return e
+	}
+	I.F(
+		"backed up %d metadata entries and %d block files to %s in %v", entries, staged.Len(), dest,
+		time.Since(start).Round(time.Millisecond),
+	)
+	return nil
+}
+
+// stageBackup flushes the database cache, takes a snapshot of the metadata and links the block files up to the write
+// cursor into a new staging directory, returning the snapshot and the staged files.
+//
+// This function MUST be called with the database write lock held.
+func (db *db) stageBackup() (snapshot *leveldb.Snapshot, staged *flatfile.Staged, e error) {
+	// Flushing syncs the block files and moves all committed metadata out of the cache into leveldb, so the snapshot
+	// holds everything up to the write cursor.
+	if e = db.cache.flush(); E.Chk(e) {
+		return nil, nil, e
+	}
+	if snapshot, e = db.cache.ldb.GetSnapshot(); E.Chk(e) {
+		return nil, nil, convertErr("failed to take metadata snapshot", e)
+	}
+	if staged, e = db.store.Stage(); e != nil {
+		snapshot.Release()
+		return nil, nil, e
+	}
+	return snapshot, staged, nil
+}
+
+// backupMetadata copies the metadata in the passed snapshot into a new leveldb database at the passed path and returns
+// the number of entries copied.
+func (db *db) backupMetadata(snapshot *leveldb.Snapshot, path string) (n int, e error) {
+	ldb, e := leveldb.OpenFile(
+		path, &opt.Options{
+			ErrorIfExist: true,
+			Strict:       opt.DefaultStrict,
+			Compression:  opt.NoCompression,
+			Filter:       filter.NewBloomFilter(10),
+		},
+	)
+	if e != nil {
+		return 0, convertErr(e.Error(), e)
+	}
+	defer func() {
+		if e := ldb.Close(); E.Chk(e) {
+		}
+	}()
+	iter := snapshot.NewIterator(nil, nil)
+	defer iter.Release()
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		batch.Put(iter.Key(), iter.Value())
+		if n++; batch.Len() < backupBatchSize {
+			continue
+		}
+		if db.quitting() {
+			return n, makeDbErr(database.ErrDbNotOpen, "database closed during backup", nil)
+		}
+		if e = ldb.Write(batch, nil); E.Chk(e) {
+			return n, convertErr("failed to write metadata backup", e)
+		}
+		batch.Reset()
+		D.F("backed up %d metadata entries", n)
+	}
+	if e = iter.Error(); E.Chk(e) {
+		return n, convertErr("failed to read metadata snapshot", e)
+	}
+	if e = ldb.Write(batch, &opt.WriteOptions{Sync: true}); E.Chk(e) {
+		return n, convertErr("failed to write metadata backup", e)
+	}
+	return n, nil
+}
+
+// quitting returns whether the database is being closed.
+func (db *db) quitting() bool {
+	select {
+	case <-db.quit:
+		return true
+	default:
+	}
+	return false
+}
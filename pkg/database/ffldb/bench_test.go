@@ -8,6 +8,8 @@ import (
 	
 	"github.com/p9c/parallelcoin/pkg/chaincfg"
 	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/database/internal/flatfile"
+	"github.com/p9c/parallelcoin/pkg/wire"
 )
 
 // BenchmarkBlockHeader benchmarks how long it takes to load the mainnet genesis block header.
@@ -95,3 +97,78 @@ func BenchmarkBlock(b *testing.B) {
 	// Don't benchmark teardown.
 	b.StopTimer()
 }
+
+// BenchmarkCompression benchmarks how long it takes to load the test blocks and their headers when the block files are
+// written without compression and with snappy, and reports the bytes the block files take on disk for each.
+func BenchmarkCompression(b *testing.B) {
+	// The test block data carries the bitcoin main network magic.
+	blocks, e := loadBlocks(b, blockDataFile, wire.BitcoinNet(0xd9b4bef9))
+	if e != nil {
+		b.Fatal(e)
+	}
+	for _, c := range []struct {
+		name        string
+		compression Compression
+	}{
+		{"none", NoCompression},
+		{"snappy", SnappyCompression},
+	} {
+		dbPath := filepath.Join(os.TempDir(), "ffldb-benchcompress-"+c.name)
+		_ = os.RemoveAll(dbPath)
+		idb, e := openDB(dbPath, blockDataNet, true, flatfile.Options{Compression: c.compression})
+		if e != nil {
+			b.Fatal(e)
+		}
+		e = idb.Update(func(tx database.Tx) (e error) {
+			for i := range blocks {
+				if e = tx.StoreBlock(blocks[i]); E.Chk(e) {
+					return e
+				}
+			}
+			return nil
+		})
+		if e != nil {
+			b.Fatal(e)
+		}
+		store := idb.(*db).store
+		var diskBytes uint64
+		curFileNum, _ := store.WriteCursor()
+		for fileNum := store.FirstFile(); fileNum <= curFileNum; fileNum++ {
+			diskBytes += store.FileSize(fileNum)
+		}
+		b.Run(c.name+"/FetchBlock", func(b *testing.B) {
+			b.ReportMetric(float64(diskBytes), "disk-bytes")
+			b.ReportAllocs()
+			e := idb.View(func(tx database.Tx) (e error) {
+				for i := 0; i < b.N; i++ {
+					if _, e = tx.FetchBlock(blocks[i%len(blocks)].Hash()); E.Chk(e) {
+						return e
+					}
+				}
+				return nil
+			})
+			if e != nil {
+				b.Fatal(e)
+			}
+		})
+		b.Run(c.name+"/FetchBlockHeader", func(b *testing.B) {
+			b.ReportMetric(float64(diskBytes), "disk-bytes")
+			b.ReportAllocs()
+			e := idb.View(func(tx database.Tx) (e error) {
+				for i := 0; i < b.N; i++ {
+					if _, e = tx.FetchBlockHeader(blocks[i%len(blocks)].Hash()); E.Chk(e) {
+						return e
+					}
+				}
+				return nil
+			})
+			if e != nil {
+				b.Fatal(e)
+			}
+		})
+		if e = idb.Close(); E.Chk(e) {
+		}
+		if e = os.RemoveAll(dbPath); E.Chk(e) {
+		}
+	}
+}
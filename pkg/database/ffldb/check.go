@@ -0,0 +1,40 @@
+package ffldb
+
+import (
+	"github.com/p9c/parallelcoin/pkg/database"
+)
+
+// Enforce db implements the database.BlockChecker interface.
+var _ database.BlockChecker = (*db)(nil)
+
+// CheckBlocks reads back every block in the block index, checking it lies within its block file and that the length,
+// network and checksum of its record match, and returns the blocks that are damaged. When repair is set the damaged
+// blocks are removed from the block index, and when the last blocks in the block files are damaged the block files are
+// truncated to the start of the first of them.
+//
+// This function is part of the database.BlockChecker interface implementation.
+func (db *db) CheckBlocks(repair bool, interrupt <-chan struct{}) (problems []database.BlockProblem, e error) {
+	var dbTx database.Tx
+	if dbTx, e = db.Begin(repair); E.Chk(e) {
+		return nil, e
+	}
+	tx := dbTx.(*transaction)
+	problems, end, interrupted, e := db.store.CheckBlocks(tx.blockIdxBucket.ForEach, interrupt)
+	if e != nil || interrupted || !repair || len(problems) == 0 {
+		_ = tx.Rollback()
+		return problems, e
+	}
+	for i := range problems {
+		tx.deleteKey(bucketizedKey(blockIdxBucketID, problems[i].Hash[:]), false)
+	}
+	tx.notifyActiveIters()
+	tx.pendingTruncate = &end
+	if e = tx.Commit(); E.Chk(e) {
+		return problems, e
+	}
+	for i := range problems {
+		problems[i].Repaired = true
+	}
+	I.F("removed %d damaged blocks, block files end at file %d, offset %d", len(problems), end.FileNum, end.Offset)
+	return problems, nil
+}
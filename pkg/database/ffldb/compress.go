@@ -0,0 +1,65 @@
+package ffldb
+
+import (
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/database/internal/flatfile"
+)
+
+// Enforce db implements the flatfile.Recompressor interface.
+var _ flatfile.Recompressor = (*db)(nil)
+
+// recompress recompresses the blocks stored without compression in the block files older than the current write file
+// until that is done or the database is closed.
+func (db *db) recompress() {
+	defer db.wg.Done()
+	db.store.Recompress(db, db.quit)
+}
+
+// ViewBlockIndex calls fn with the block index of a read-only transaction.
+//
+// This function is part of the flatfile.Recompressor interface implementation.
+func (db *db) ViewBlockIndex(fn func(forEach flatfile.ForEachFunc) error) error {
+	return db.View(
+		func(tx database.Tx) error {
+			return fn(tx.(*transaction).blockIdxBucket.ForEach)
+		},
+	)
+}
+
+// MoveBlocks writes the passed blocks of a block file that is being recompressed to the end of the block files in a
+// write transaction, which also points their block index entries at the new location. When last is set the block file
+// is emptied after the commit.
+//
+// This function is part of the flatfile.Recompressor interface implementation.
+func (db *db) MoveBlocks(fileNum uint32, blocks []flatfile.IndexedBlock, last bool) error {
+	return db.Update(
+		func(dbTx database.Tx) (e error) {
+			// The file may have been removed by pruning in the meantime, along with its blocks.
+			if fileNum < db.store.FirstFile() {
+				return nil
+			}
+			tx := dbTx.(*transaction)
+			moved, blockBytes, e := db.store.ReadMoved(blocks, tx.blockIdxBucket.Get)
+			if e != nil {
+				return e
+			}
+			for i := range moved {
+				if tx.pendingBlocks == nil {
+					tx.pendingBlocks = make(map[chainhash.Hash]int)
+				}
+				tx.pendingBlocks[moved[i].Hash] = len(tx.pendingBlockData)
+				tx.pendingBlockData = append(
+					tx.pendingBlockData, pendingBlock{
+						hash:  &moved[i].Hash,
+						bytes: blockBytes[i],
+					},
+				)
+			}
+			if last {
+				tx.pendingEmpty = append(tx.pendingEmpty, fileNum)
+			}
+			return nil
+		},
+	)
+}
@@ -8,7 +8,6 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
-	"sort"
 	"sync"
 	
 	"github.com/btcsuite/goleveldb/leveldb"
@@ -21,6 +20,7 @@ import (
 	
 	"github.com/p9c/parallelcoin/pkg/chainhash"
 	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/database/internal/flatfile"
 	"github.com/p9c/parallelcoin/pkg/util/treap"
 	"github.com/p9c/parallelcoin/pkg/wire"
 )
@@ -38,13 +38,10 @@ const (
 	// The serialized block index row format is:
 	//
 	//   <blocklocation><blockheader>
-	blockHdrOffset = blockLocSize
+	blockHdrOffset = flatfile.LocationSize
 )
 
 var (
-	// byteOrder is the preferred byte order used through the database and block files. Sometimes big endian will be
-	// used to allow ordered byte sortable integer values.
-	byteOrder = binary.LittleEndian
 	// bucketIndexPrefix is the prefix used for all entries in the bucket index.
 	bucketIndexPrefix = []byte("bidx")
 	// curBucketIDKeyName is the name of the key used to keep track of the current bucket ID counter.
@@ -69,48 +66,6 @@ const (
 	errTxClosedStr = "database tx is closed"
 )
 
-// bulkFetchData is allows a block location to be specified along with the index it was requested from.
-//
-// This in turn allows the bulk data loading functions to txsort the data accesses based on the location to improve
-// performance while keeping track of which result the data is for.
-type bulkFetchData struct {
-	*blockLocation
-	replyIndex int
-}
-
-// bulkFetchDataSorter implements txsort.
-//
-// Interface to allow a slice of bulkFetchData to be sorted. In particular it sorts by file and then offset so that
-// reads from files are grouped and linear.
-type bulkFetchDataSorter []bulkFetchData
-
-// Len returns the number of items in the slice.
-//
-// It is part of the sort.Interface implementation.
-func (s bulkFetchDataSorter) Len() int {
-	return len(s)
-}
-
-// Swap swaps the items at the passed indices.
-//
-// It is part of the sort.Interface implementation.
-func (s bulkFetchDataSorter) Swap(i, j int) {
-	s[i], s[j] = s[j], s[i]
-}
-
-// Less returns whether the item with index i should txsort before the item with index j.
-//
-// It is part of the sort.Interface implementation.
-func (s bulkFetchDataSorter) Less(i, j int) bool {
-	if s[i].blockFileNum < s[j].blockFileNum {
-		return true
-	}
-	if s[i].blockFileNum > s[j].blockFileNum {
-		return false
-	}
-	return s[i].fileOffset < s[j].fileOffset
-}
-
 // makeDbErr creates a database.DBError given a set of arguments.
 func makeDbErr(c database.ErrorCode, desc string, e error) database.DBError {
 	return database.DBError{ErrorCode: c, Description: desc, Err: e}
@@ -892,11 +847,20 @@ type transaction struct {
 	snapshot       *dbCacheSnapshot // Underlying snapshot for txns.
 	metaBucket     *bucket          // The root metadata bucket.
 	blockIdxBucket *bucket          // The block index bucket.
+	storeGen       uint64           // Generation of the block files the tx began in.
 	// Blocks that need to be stored on commit.
 	//
 	// The pendingBlocks map is kept to allow quick lookups of pending data by block hash.
 	pendingBlocks    map[chainhash.Hash]int
 	pendingBlockData []pendingBlock
+	// Block files that have been pruned and need to be removed from disk once the transaction has been committed.
+	pendingPrune []uint32
+	// Block files whose blocks have all been moved elsewhere by recompression and need to be emptied once the
+	// transaction has been committed and flushed to disk.
+	pendingEmpty []uint32
+	// Position the block files are truncated to once the transaction has been committed and flushed to disk, after the
+	// damaged blocks at the end of them have been removed.
+	pendingTruncate *flatfile.Location
 	// Keys that need to be stored or deleted on commit.
 	pendingKeys   *treap.Mutable
 	pendingRemove *treap.Mutable
@@ -1241,10 +1205,10 @@ func (tx *transaction) FetchBlock(hash *chainhash.Hash) ([]byte, error) {
 	if e != nil {
 		return nil, e
 	}
-	location := deserializeBlockLoc(blockRow)
+	location := flatfile.DeserializeLocation(blockRow)
 	// Read the block from the appropriate location. The function also performs a checksum over the data to detect data
 	// corruption.
-	blockBytes, e := tx.db.store.readBlock(hash, location)
+	blockBytes, e := tx.db.store.ReadBlock(hash, location)
 	if e != nil {
 		return nil, e
 	}
@@ -1300,20 +1264,8 @@ func (tx *transaction) fetchPendingRegion(region *database.BlockRegion) ([]byte,
 	if !exists {
 		return nil, nil
 	}
-	// Ensure the region is within the bounds of the block.
-	blockBytes := tx.pendingBlockData[idx].bytes
-	blockLen := uint32(len(blockBytes))
-	endOffset := region.Offset + region.Len
-	if endOffset < region.Offset || endOffset > blockLen {
-		str := fmt.Sprintf(
-			"block %s region offset %d, length %d "+
-				"exceeds block length of %d", region.Hash,
-			region.Offset, region.Len, blockLen,
-		)
-		return nil, makeDbErr(database.ErrBlockRegionInvalid, str, nil)
-	}
 	// Return the bytes from the pending block.
-	return blockBytes[region.Offset:endOffset:endOffset], nil
+	return flatfile.BlockRegion(region, tx.pendingBlockData[idx].bytes)
 }
 
 // FetchBlockRegion returns the raw serialized bytes for the given block region.
@@ -1361,22 +1313,8 @@ func (tx *transaction) FetchBlockRegion(region *database.BlockRegion) ([]byte, e
 	if e != nil {
 		return nil, e
 	}
-	location := deserializeBlockLoc(blockRow)
-	// Ensure the region is within the bounds of the block.
-	endOffset := region.Offset + region.Len
-	if endOffset < region.Offset || endOffset > location.blockLen {
-		str := fmt.Sprintf(
-			"block %s region offset %d, length %d "+
-				"exceeds block length of %d", region.Hash,
-			region.Offset, region.Len, location.blockLen,
-		)
-		return nil, makeDbErr(database.ErrBlockRegionInvalid, str, nil)
-	}
 	// Read the region from the appropriate disk block file.
-	regionBytes, e := tx.db.store.readBlockRegion(
-		location, region.Offset,
-		region.Len,
-	)
+	regionBytes, e := tx.db.store.ReadBlockRegion(region, flatfile.DeserializeLocation(blockRow))
 	if e != nil {
 		return nil, e
 	}
@@ -1429,7 +1367,7 @@ func (tx *transaction) FetchBlockRegions(regions []database.BlockRegion) ([][]by
 	// The fetchList is intentionally allocated with a cap because some of the regions might be fetched from the pending
 	// blocks and hence there is no need to fetch those from disk.
 	blockRegions := make([][]byte, len(regions))
-	fetchList := make([]bulkFetchData, 0, len(regions))
+	fetchList := make([]flatfile.RegionFetch, 0, len(regions))
 	for i := range regions {
 		region := &regions[i]
 		// When the block is pending to be written on commit grab the bytes from there.
@@ -1448,38 +1386,73 @@ func (tx *transaction) FetchBlockRegions(regions []database.BlockRegion) ([][]by
 		if e != nil {
 			return nil, e
 		}
-		location := deserializeBlockLoc(blockRow)
+		location := flatfile.DeserializeLocation(blockRow)
 		// Ensure the region is within the bounds of the block.
-		endOffset := region.Offset + region.Len
-		if endOffset < region.Offset || endOffset > location.blockLen {
-			str := fmt.Sprintf(
-				"block %s region offset %d, length "+
-					"%d exceeds block length of %d", region.Hash,
-				region.Offset, region.Len, location.blockLen,
-			)
-			return nil, makeDbErr(database.ErrBlockRegionInvalid, str, nil)
+		if e = flatfile.CheckRegion(region, location); e != nil {
+			return nil, e
 		}
-		fetchList = append(fetchList, bulkFetchData{&location, i})
+		fetchList = append(fetchList, flatfile.RegionFetch{Loc: location, Reply: i})
 	}
-	sort.Sort(bulkFetchDataSorter(fetchList))
 	// Read all of the regions in the fetch list and set the results.
-	for i := range fetchList {
-		fetchData := &fetchList[i]
-		ri := fetchData.replyIndex
-		region := &regions[ri]
-		location := fetchData.blockLocation
-		regionBytes, e := tx.db.store.readBlockRegion(
-			*location,
-			region.Offset, region.Len,
-		)
-		if e != nil {
-			return nil, e
-		}
-		blockRegions[ri] = regionBytes
+	if e := tx.db.store.ReadBlockRegions(regions, fetchList, blockRegions); e != nil {
+		return nil, e
 	}
 	return blockRegions, nil
 }
 
+// PruneBlocks removes the oldest block files until the total size of the flat block files is no more than the target
+// size, stopping at the first file holding a block that canPrune refuses, and returns the hashes of the removed blocks.
+//
+// The block index entries are deleted as part of the transaction and the files themselves are deleted after it has
+// been committed. The current write file is never removed.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) PruneBlocks(targetSize uint64, canPrune func(hash *chainhash.Hash) bool) (
+	pruned []chainhash.Hash,
+	e error,
+) {
+	// Ensure transaction state is valid.
+	if e = tx.checkClosed(); E.Chk(e) {
+		return nil, e
+	}
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "prune blocks requires a writable database transaction"
+		return nil, makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	files, pruned, e := tx.db.store.Prune(tx.blockIdxBucket.ForEach, tx.pendingPrune, targetSize, canPrune)
+	if e != nil {
+		return nil, e
+	}
+	for i := range pruned {
+		tx.deleteKey(bucketizedKey(blockIdxBucketID, pruned[i][:]), false)
+	}
+	tx.pendingPrune = append(tx.pendingPrune, files...)
+	tx.notifyActiveIters()
+	return pruned, nil
+}
+
+// BeenPruned returns whether or not any block files have been removed from the database by PruneBlocks.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) BeenPruned() (bool, error) {
+	// Ensure transaction state is valid.
+	if e := tx.checkClosed(); E.Chk(e) {
+		return false, e
+	}
+	return tx.db.store.FirstFile() > 0 || len(tx.pendingPrune) > 0, nil
+}
+
 // close marks the transaction closed then releases any pending data, the underlying snapshot, the transaction read
 // lock, and the write lock when the transaction is writable.
 func (tx *transaction) close() {
@@ -1487,6 +1460,9 @@ func (tx *transaction) close() {
 	// Clear pending blocks that would have been written on commit.
 	tx.pendingBlocks = nil
 	tx.pendingBlockData = nil
+	tx.pendingPrune = nil
+	tx.pendingEmpty = nil
+	tx.pendingTruncate = nil
 	// Clear pending keys that would have been written or deleted on commit.
 	tx.pendingKeys = nil
 	tx.pendingRemove = nil
@@ -1495,6 +1471,7 @@ func (tx *transaction) close() {
 		tx.snapshot.Release()
 		tx.snapshot = nil
 	}
+	tx.db.store.EndTx(tx.storeGen)
 	tx.db.closeLock.RUnlock()
 	// Release the writer lock for writable transactions to unblock any other write transaction which are possibly
 	// waiting.
@@ -1514,35 +1491,35 @@ func (tx *transaction) writePendingAndCommit() (e error) {
 	//
 	// These variables are only updated here in this function and there can only be one write transaction active at a
 	// time, so it's safe to store them for potential rollback.
-	wc := tx.db.store.writeCursor
-	wc.RLock()
-	oldBlkFileNum := wc.curFileNum
-	oldBlkOffset := wc.curOffset
-	wc.RUnlock()
+	oldBlkFileNum, oldBlkOffset := tx.db.store.WriteCursor()
 	// rollback is a closure that is used to rollback all writes to the block files.
 	rollback := func() {
 		// Rollback any modifications made to the block files if needed.
-		tx.db.store.handleRollback(oldBlkFileNum, oldBlkOffset)
+		tx.db.store.Rollback(oldBlkFileNum, oldBlkOffset)
 	}
 	// Loop through all of the pending blocks to store and write them.
 	for _, blockData := range tx.pendingBlockData {
 		// Tracef("storing block %s", blockData.hash)
-		location, e := tx.db.store.writeBlock(blockData.bytes)
+		location, e := tx.db.store.WriteBlock(blockData.bytes)
 		if e != nil {
 			rollback()
 			return e
 		}
 		// Add a record in the block index for the block. The record includes the location information needed to locate
 		// the block on the filesystem as well as the block header since they are so commonly needed.
-		blockRow := serializeBlockLoc(location)
+		blockRow := flatfile.SerializeLocation(location)
 		e = tx.blockIdxBucket.Put(blockData.hash[:], blockRow)
 		if e != nil {
 			rollback()
 			return e
 		}
 	}
-	// Update the metadata for the current write file and offset.
-	writeRow := serializeWriteRow(wc.curFileNum, wc.curOffset)
+	// Update the metadata for the current write file and offset, which is where the block files are to be truncated to
+	// when they will be.
+	writeRow := flatfile.SerializeWriteRow(tx.db.store.WriteCursor())
+	if tx.pendingTruncate != nil {
+		writeRow = flatfile.SerializeWriteRow(tx.pendingTruncate.FileNum, tx.pendingTruncate.Offset)
+	}
 	if e := tx.metaBucket.Put(writeLocKeyName, writeRow); E.Chk(e) {
 		rollback()
 		return convertErr("failed to store write cursor", e)
@@ -1550,7 +1527,34 @@ func (tx *transaction) writePendingAndCommit() (e error) {
 	// Atomically update the database cache.
 	//
 	// The cache automatically handles flushing to the underlying persistent storage database.
-	return tx.db.cache.commitTx(tx)
+	if e = tx.db.cache.commitTx(tx); E.Chk(e) {
+		return e
+	}
+	// Now that the block index no longer refers to them, remove any block files that were pruned once the transactions
+	// still reading them have finished. A failure here only leaves unreferenced data on disk, so it is not treated as a
+	// failure of the commit.
+	for _, fileNum := range tx.pendingPrune {
+		if e := tx.db.store.RemoveFile(fileNum); E.Chk(e) {
+			W.F("failed to remove pruned block file %d: %v", fileNum, e)
+		}
+	}
+	// Block files whose blocks were moved are only emptied, and block files are only truncated, once the metadata is on
+	// disk, so an unexpected shutdown can not leave the block index pointing at data that is gone. Emptying also waits
+	// for the transactions that can still read the moved blocks from their old place to finish.
+	if len(tx.pendingEmpty) > 0 || tx.pendingTruncate != nil {
+		if e = tx.db.cache.flush(); E.Chk(e) {
+			return e
+		}
+	}
+	for _, fileNum := range tx.pendingEmpty {
+		if e := tx.db.store.EmptyFile(fileNum); E.Chk(e) {
+			W.F("failed to empty recompressed block file %d: %v", fileNum, e)
+		}
+	}
+	if tx.pendingTruncate != nil {
+		tx.db.store.Truncate(tx.pendingTruncate.FileNum, tx.pendingTruncate.Offset)
+	}
+	return nil
 }
 
 // Commit commits all changes that have been made to the root metadata bucket and all of its sub-buckets to the database
@@ -1605,8 +1609,12 @@ type db struct {
 	writeLock sync.Mutex   // Limit to one write transaction at a time.
 	closeLock sync.RWMutex // Make database close block while txns active.
 	closed    bool         // Is the database closed?
-	store     *blockStore  // Handles read/writing blocks to flat files.
+	store     *flatfile.Store // Handles read/writing blocks to flat files.
 	cache     *dbCache     // Cache layer which wraps underlying leveldb DB.
+	// quit stops the background recompression of the block files, and wg waits for it to finish.
+	quit     chan struct{}
+	quitOnce sync.Once
+	wg       sync.WaitGroup
 }
 
 // Enforce db implements the database.DB interface.
@@ -1648,8 +1656,12 @@ func (db *db) begin(writable bool) (*transaction, error) {
 		)
 	}
 	// Grab a snapshot of the database cache (which in turn also handles the underlying database).
+	// Register the transaction with the block files before taking the snapshot, so the block files the snapshot refers
+	// to are kept until it is released.
+	storeGen := db.store.BeginTx()
 	snapshot, e := db.cache.Snapshot()
 	if e != nil {
+		db.store.EndTx(storeGen)
 		db.closeLock.RUnlock()
 		if writable {
 			db.writeLock.Unlock()
@@ -1661,6 +1673,7 @@ func (db *db) begin(writable bool) (*transaction, error) {
 		writable:      writable,
 		db:            db,
 		snapshot:      snapshot,
+		storeGen:      storeGen,
 		pendingKeys:   treap.NewMutable(),
 		pendingRemove: treap.NewMutable(),
 	}
@@ -1777,6 +1790,10 @@ func (db *db) Update(fn func(database.Tx) error) (e error) {
 //
 // DB interface implementation.
 func (db *db) Close() (e error) {
+	// The background recompression starts transactions of its own, so it is stopped before waiting for transactions
+	// to finish.
+	db.quitOnce.Do(func() { close(db.quit) })
+	db.wg.Wait()
 	// Since all transactions have a read lock on this mutex, this will cause Close to wait for all readers to complete.
 	db.closeLock.Lock()
 	defer db.closeLock.Unlock()
@@ -1792,17 +1809,7 @@ func (db *db) Close() (e error) {
 	// even if this fails given there is no good way for the caller to recover from a failure here anyways.
 	closeErr := db.cache.Close()
 	// Close any open flat files that house the blocks.
-	wc := db.store.writeCursor
-	if wc.curFile.file != nil {
-		_ = wc.curFile.file.Close()
-		wc.curFile.file = nil
-	}
-	for _, blockFile := range db.store.openBlockFiles {
-		_ = blockFile.file.Close()
-	}
-	db.store.openBlockFiles = nil
-	db.store.openBlocksLRU.Init()
-	db.store.fileNumToLRUElem = nil
+	db.store.Close()
 	return closeErr
 }
 
@@ -1825,7 +1832,7 @@ func initDB(ldb *leveldb.DB) (e error) {
 	batch := new(leveldb.Batch)
 	batch.Put(
 		bucketizedKey(metadataBucketID, writeLocKeyName),
-		serializeWriteRow(0, 0),
+		flatfile.SerializeWriteRow(0, 0),
 	)
 	// Create block index bucket and set the current bucket id.
 	//
@@ -1851,7 +1858,7 @@ func initDB(ldb *leveldb.DB) (e error) {
 // openDB opens the database at the provided path
 //
 // ErrDbDoesNotExist is returned if the database doesn't exist and the create flag is not set.
-func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, error) {
+func openDB(dbPath string, network wire.BitcoinNet, create bool, opts flatfile.Options) (database.DB, error) {
 	// DBError if the database doesn't exist and the create flag is not set.
 	metadataDbPath := filepath.Join(dbPath, metadataDbName)
 	dbExists := fileExists(metadataDbPath)
@@ -1866,13 +1873,13 @@ func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, e
 		_ = os.MkdirAll(dbPath, 0700)
 	}
 	// Open the metadata database (will create it if needed).
-	opts := opt.Options{
+	ldbOpts := opt.Options{
 		ErrorIfExist: create,
 		Strict:       opt.DefaultStrict,
 		Compression:  opt.NoCompression,
 		Filter:       filter.NewBloomFilter(10),
 	}
-	ldb, e := leveldb.OpenFile(metadataDbPath, &opts)
+	ldb, e := leveldb.OpenFile(metadataDbPath, &ldbOpts)
 	if e != nil {
 		return nil, convertErr(e.Error(), e)
 	}
@@ -1880,9 +1887,21 @@ func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, e
 	// cursor position is according to the data that is actually on disk.
 	//
 	// Also create the database cache which wraps the underlying leveldb database to provide write caching.
-	store := newBlockStore(dbPath, network)
+	flatfile.RemoveStaging(dbPath)
+	store := flatfile.NewStore(dbPath, network, opts.Compression)
 	cache := newDbCache(ldb, store, defaultCacheSize, defaultFlushSecs)
-	pdb := &db{store: store, cache: cache}
+	pdb := &db{store: store, cache: cache, quit: make(chan struct{})}
 	// Perform any reconciliation needed between the block and metadata as well as database initialization, if needed.
-	return reconcileDB(pdb, create)
+	idb, e := reconcileDB(pdb, create, opts.AllowTruncated)
+	if e != nil {
+		// Release the metadata database so the database can be opened again, such as to repair it.
+		_ = ldb.Close()
+		return nil, e
+	}
+	// Blocks written before compression was enabled are compressed in the background.
+	if opts.Compression != NoCompression {
+		pdb.wg.Add(1)
+		go pdb.recompress()
+	}
+	return idb, nil
 }
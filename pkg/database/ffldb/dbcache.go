@@ -10,6 +10,7 @@ import (
 	"github.com/btcsuite/goleveldb/leveldb/iterator"
 	"github.com/btcsuite/goleveldb/leveldb/util"
 	
+	"github.com/p9c/parallelcoin/pkg/database/internal/flatfile"
 	"github.com/p9c/parallelcoin/pkg/util/treap"
 )
 
@@ -259,18 +260,22 @@ type dbCacheSnapshot struct {
 	dbSnapshot    *leveldb.Snapshot
 	pendingKeys   *treap.Immutable
 	pendingRemove *treap.Immutable
+	stats         *dbStats
 }
 
 // Has returns whether or not the passed key exists.
 func (snap *dbCacheSnapshot) Has(key []byte) bool {
 	// Chk the cached entries first.
 	if snap.pendingRemove.Has(key) {
+		snap.stats.cacheHits.Inc()
 		return false
 	}
 	if snap.pendingKeys.Has(key) {
+		snap.stats.cacheHits.Inc()
 		return true
 	}
 	// Consult the database.
+	snap.stats.cacheMisses.Inc()
 	hasKey, _ := snap.dbSnapshot.Has(key, nil)
 	return hasKey
 }
@@ -279,12 +284,15 @@ func (snap *dbCacheSnapshot) Has(key []byte) bool {
 func (snap *dbCacheSnapshot) Get(key []byte) []byte {
 	// Chk the cached entries first.
 	if snap.pendingRemove.Has(key) {
+		snap.stats.cacheHits.Inc()
 		return nil
 	}
 	if value := snap.pendingKeys.Get(key); value != nil {
+		snap.stats.cacheHits.Inc()
 		return value
 	}
 	// Consult the database.
+	snap.stats.cacheMisses.Inc()
 	value, e := snap.dbSnapshot.Get(key, nil)
 	if e != nil {
 		// F.Ln(err)
@@ -327,7 +335,9 @@ type dbCache struct {
 	// ldb is the underlying leveldb DB for metadata.
 	ldb *leveldb.DB
 	// store is used to sync blocks to flat files.
-	store *blockStore
+	store *flatfile.Store
+	// stats holds the statistics of the cache, which are handed on to its snapshots.
+	stats *dbStats
 	// The following fields are related to flushing the cache to persistent storage.
 	//
 	// Note that all flushing is performed in an opportunistic fashion.
@@ -372,6 +382,7 @@ func (c *dbCache) Snapshot() (*dbCacheSnapshot, error) {
 		dbSnapshot:    dbSnapshot,
 		pendingKeys:   c.cachedKeys,
 		pendingRemove: c.cachedRemove,
+		stats:         c.stats,
 	}
 	c.cacheLock.RUnlock()
 	return cacheSnapshot, nil
@@ -454,12 +465,13 @@ func (c *dbCache) commitTreaps(pendingKeys, pendingRemove TreapForEacher) (e err
 //
 // This function MUST be called with the database write lock held.
 func (c *dbCache) flush() (e error) {
-	c.lastFlush = time.Now()
+	start := time.Now()
+	c.lastFlush = start
 	// Sync the current write file associated with the block store.
 	//
 	// This is necessary before writing the metadata to prevent the case where the metadata contains information about a
 	// block which actually hasn't been written yet in unexpected shutdown scenarios.
-	if e := c.store.syncBlocks(); E.Chk(e) {
+	if e := c.store.Sync(); E.Chk(e) {
 		return e
 	}
 	// Since the cached keys to be added and removed use an immutable treap, a snapshot is simply obtaining the root of
@@ -481,6 +493,10 @@ func (c *dbCache) flush() (e error) {
 	c.cachedKeys = treap.NewImmutable()
 	c.cachedRemove = treap.NewImmutable()
 	c.cacheLock.Unlock()
+	stats := c.stats
+	stats.flushes.Inc()
+	stats.flushedEntries.Add(uint64(cachedKeys.Len() + cachedRemove.Len()))
+	stats.flushTime.ObserveSince(start)
 	D.Ln("synced database to disk")
 	return nil
 }
@@ -495,6 +511,11 @@ func (c *dbCache) needsFlush(tx *transaction) bool {
 	if time.Since(c.lastFlush) > c.flushInterval {
 		return true
 	}
+	// A flush is needed when block files are about to be pruned so the persistent block index never refers to a block
+	// file that has been removed from disk.
+	if len(tx.pendingPrune) > 0 {
+		return true
+	}
 	// A flush is needed when the size of the database cache exceeds the specified max cache size.
 	//
 	// The total calculated size is multiplied by 1.
@@ -530,6 +551,7 @@ func (c *dbCache) commitTx(tx *transaction) (e error) {
 		if e != nil {
 			return e
 		}
+		c.stats.flushedEntries.Add(uint64(tx.pendingKeys.Len() + tx.pendingRemove.Len()))
 		// Clear the transaction entries since they have been committed.
 		tx.pendingKeys = nil
 		tx.pendingRemove = nil
@@ -592,10 +614,11 @@ func (c *dbCache) Close() (e error) {
 //
 // The cache will be flushed to leveldb when the max size exceeds the provided value or it has been longer than the
 // provided interval since the last flush.
-func newDbCache(ldb *leveldb.DB, store *blockStore, maxSize uint64, flushIntervalSecs uint32) *dbCache {
+func newDbCache(ldb *leveldb.DB, store *flatfile.Store, maxSize uint64, flushIntervalSecs uint32) *dbCache {
 	return &dbCache{
 		ldb:           ldb,
 		store:         store,
+		stats:         newDbStats(),
 		maxSize:       maxSize,
 		flushInterval: time.Second * time.Duration(flushIntervalSecs),
 		lastFlush:     time.Now(),
@@ -16,5 +16,30 @@ Create functions take are the database path as a string and the block network:
 	if e != nil  {
 		// Handle error
 	}
+
+Compression
+
+The blocks can be compressed with snappy by passing SnappyCompression after the block network. Each block record is
+marked as compressed or not, so a database can be opened with or without compression at any time. When it is opened
+with compression, the blocks in older block files that were written without it are moved to the end of the block files
+in the background, and the old files are emptied once their blocks are on disk elsewhere and the transactions that
+could still read them from the old files have finished:
+
+	db, e := database.Open("ffldb", "path/to/database", wire.MainNet, ffldb.SnappyCompression)
+	if e != nil  {
+		// Handle error
+	}
+
+Checking
+
+The database implements database.BlockChecker, which reads back every block to find the ones that are damaged and can
+remove them, truncating the block files when the damaged blocks are at their end. A database whose block files are
+shorter than the metadata expects can not be opened, unless AllowTruncated is passed after the block network so that it
+can be checked and repaired:
+
+	db, e := database.Open("ffldb", "path/to/database", wire.MainNet, ffldb.AllowTruncated)
+	if e != nil  {
+		// Handle error
+	}
 */
 package ffldb
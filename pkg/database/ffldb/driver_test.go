@@ -9,28 +9,39 @@ import (
 	"testing"
 	
 	"github.com/p9c/parallelcoin/pkg/chaincfg"
+	"github.com/p9c/parallelcoin/pkg/chainhash"
 	"github.com/p9c/parallelcoin/pkg/database"
+	databasetest "github.com/p9c/parallelcoin/pkg/database/ci"
 	"github.com/p9c/parallelcoin/pkg/database/ffldb"
 )
 
 // dbType is the database type name for this driver.
 const dbType = "ffldb"
 
+// blockFilesDriver hooks this driver into the shared tests of the flat block files.
+var blockFilesDriver = databasetest.BlockFilesDriver{
+	DbType:                  dbType,
+	Network:                 blockDataNet,
+	RunWithMaxBlockFileSize: ffldb.TstRunWithMaxBlockFileSize,
+	WaitRecompress:          ffldb.TstWaitRecompress,
+	Recompress:              ffldb.TstRecompress,
+}
+
 // TestCreateOpenFail ensures that errors related to creating and opening a database are handled properly.
 func TestCreateOpenFail(t *testing.T) {
 	t.Parallel()
 	// Ensure that attempting to open a database that doesn't exist returns the expected error.
 	wantErrCode := database.ErrDbDoesNotExist
 	_, e := database.Open(dbType, "noexist", blockDataNet)
-	if !checkDbError(t, "Open", e, wantErrCode) {
+	if !databasetest.CheckDbError(t, "Open", e, wantErrCode) {
 		return
 	}
 	// Ensure that attempting to open a database with the wrong number of parameters returns the expected error.
 	wantErr := fmt.Errorf(
 		"invalid arguments to %s.Open -- expected "+
-			"database path and block network", dbType,
+			"database path, block network and optional block compression and open flags", dbType,
 	)
-	_, e = database.Open(dbType, 1, 2, 3)
+	_, e = database.Open(dbType, 1)
 	if e != nil && e.Error() != wantErr.Error() {
 		t.Errorf(
 			"Open: did not receive expected error - got %v, "+
@@ -66,12 +77,26 @@ func TestCreateOpenFail(t *testing.T) {
 		)
 		return
 	}
+	// Ensure that attempting to open a database with an invalid type for an optional parameter returns the expected
+	// error.
+	wantErr = fmt.Errorf(
+		"argument snappy to %s.Open is invalid -- "+
+			"expected block compression or open flags", dbType,
+	)
+	_, e = database.Open(dbType, "noexist", blockDataNet, "snappy")
+	if e == nil || e.Error() != wantErr.Error() {
+		t.Errorf(
+			"Open: did not receive expected error - got %v, "+
+				"want %v", e, wantErr,
+		)
+		return
+	}
 	// Ensure that attempting to create a database with the wrong number of parameters returns the expected error.
 	wantErr = fmt.Errorf(
 		"invalid arguments to %s.Create -- expected "+
-			"database path and block network", dbType,
+			"database path, block network and optional block compression and open flags", dbType,
 	)
-	_, e = database.Create(dbType, 1, 2, 3)
+	_, e = database.Create(dbType, 1)
 	if e != nil && e.Error() != wantErr.Error() {
 		t.Errorf(
 			"Create: did not receive expected error - got %v, "+
@@ -129,7 +154,7 @@ func TestCreateOpenFail(t *testing.T) {
 			return nil
 		},
 	)
-	if !checkDbError(t, "View", e, wantErrCode) {
+	if !databasetest.CheckDbError(t, "View", e, wantErrCode) {
 		return
 	}
 	wantErrCode = database.ErrDbNotOpen
@@ -138,22 +163,22 @@ func TestCreateOpenFail(t *testing.T) {
 			return nil
 		},
 	)
-	if !checkDbError(t, "Update", e, wantErrCode) {
+	if !databasetest.CheckDbError(t, "Update", e, wantErrCode) {
 		return
 	}
 	wantErrCode = database.ErrDbNotOpen
 	_, e = db.Begin(false)
-	if !checkDbError(t, "Begin(false)", e, wantErrCode) {
+	if !databasetest.CheckDbError(t, "Begin(false)", e, wantErrCode) {
 		return
 	}
 	wantErrCode = database.ErrDbNotOpen
 	_, e = db.Begin(true)
-	if !checkDbError(t, "Begin(true)", e, wantErrCode) {
+	if !databasetest.CheckDbError(t, "Begin(true)", e, wantErrCode) {
 		return
 	}
 	wantErrCode = database.ErrDbNotOpen
 	e = db.Close()
-	if !checkDbError(t, "Close", e, wantErrCode) {
+	if !databasetest.CheckDbError(t, "Close", e, wantErrCode) {
 		return
 	}
 }
@@ -273,30 +298,382 @@ func TestPersistence(t *testing.T) {
 	}
 }
 
-// // TestInterface performs all interfaces tests for this database driver.
-// func TestInterface(// 	t *testing.T) {
-// 	t.Parallel()
-// 	// Create a new database to run tests against.
-// 	dbPath := filepath.Join(os.TempDir(), "ffldb-interfacetest")
-// 	_ = os.RemoveAll(dbPath)
-// 	db, e := database.Create(dbType, dbPath, blockDataNet)
-// 	if e != nil  {
-// 		t.Errorf("Failed to create test database (%s) %v", dbType, err)
-// 		return
-// 	}
-// 	defer os.RemoveAll(dbPath)
-// 	defer db.Close()
-// 	// Ensure the driver type is the expected value.
-// 	gotDbType := db.Type()
-// 	if gotDbType != dbType {
-// 		t.Errorf("Type: unepxected driver type - got %v, want %v",
-// 			gotDbType, dbType)
-// 		return
-// 	}
-// 	// Run all of the interface tests against the database.
-// 	runtime.GOMAXPROCS(runtime.NumCPU())
-// 	// Change the maximum file size to a small value to force multiple flat files with the test data set.
-// 	ffldb.TstRunWithMaxBlockFileSize(db, 2048, func() {
-// 		testInterface(t, db)
-// 	})
-// }
+// TestPruneBlocks ensures that pruning removes the oldest block files down to the target size, leaves blocks that may
+// not be pruned in place, and that the database can be reopened afterwards.
+func TestPruneBlocks(t *testing.T) {
+	t.Parallel()
+	// The test block data carries the bitcoin main network magic.
+	blocks, e := databasetest.LoadBlocks(t, databasetest.BlockDataFile, databasetest.BlockDataNet)
+	if e != nil {
+		t.Errorf("LoadBlocks: unexpected error: %v", e)
+		return
+	}
+	// Create a new database to run tests against.
+	dbPath := filepath.Join(os.TempDir(), "ffldb-prunetest")
+	_ = os.RemoveAll(dbPath)
+	db, e := database.Create(dbType, dbPath, blockDataNet)
+	if e != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, e)
+		return
+	}
+	defer func() {
+		if e = os.RemoveAll(dbPath); ffldb.E.Chk(e) {
+		}
+	}()
+	// Change the maximum file size to a small value to force multiple flat files with the test data set.
+	var numFiles int
+	ffldb.TstRunWithMaxBlockFileSize(
+		db, 2048, func() {
+			for i := range blocks {
+				e = db.Update(
+					func(tx database.Tx) (e error) {
+						return tx.StoreBlock(blocks[i])
+					},
+				)
+				if e != nil {
+					t.Errorf("StoreBlock #%d: unexpected error: %v", i, e)
+					return
+				}
+			}
+		},
+	)
+	matches, _ := filepath.Glob(filepath.Join(dbPath, "*.fdb"))
+	numFiles = len(matches)
+	if numFiles < 4 {
+		t.Errorf("expected at least 4 block files, got %d", numFiles)
+		return
+	}
+	// Refuse to prune the block at index 100 so pruning has to stop at the file that holds it.
+	keep := blocks[100].Hash()
+	var pruned []chainhash.Hash
+	e = db.Update(
+		func(tx database.Tx) (e error) {
+			if pruned, e = tx.PruneBlocks(
+				0, func(hash *chainhash.Hash) bool {
+					return !hash.IsEqual(keep)
+				},
+			); E.Chk(e) {
+				return e
+			}
+			var beenPruned bool
+			if beenPruned, e = tx.BeenPruned(); E.Chk(e) {
+				return e
+			}
+			if !beenPruned {
+				return fmt.Errorf("BeenPruned: expected true after pruning")
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Errorf("PruneBlocks: unexpected error: %v", e)
+		return
+	}
+	if len(pruned) == 0 || len(pruned) >= 100 {
+		t.Errorf("PruneBlocks: unexpected number of pruned blocks %d", len(pruned))
+		return
+	}
+	// The oldest blocks are removed first, so the pruned blocks must be exactly the first blocks that were stored.
+	prunedSet := make(map[chainhash.Hash]struct{}, len(pruned))
+	for i := range pruned {
+		prunedSet[pruned[i]] = struct{}{}
+	}
+	for i := range pruned {
+		if _, ok := prunedSet[*blocks[i].Hash()]; !ok {
+			t.Errorf("PruneBlocks: block #%d %v was not pruned", i, blocks[i].Hash())
+			return
+		}
+	}
+	if _, e = os.Stat(filepath.Join(dbPath, "000000000.fdb")); !os.IsNotExist(e) {
+		t.Errorf("PruneBlocks: first block file was not removed")
+		return
+	}
+	// Close and reopen the database to ensure the pruned state is consistent with the files on disk.
+	if e = db.Close(); ffldb.E.Chk(e) {
+	}
+	db, e = database.Open(dbType, dbPath, blockDataNet)
+	if e != nil {
+		t.Errorf("Failed to open pruned test database (%s) %v", dbType, e)
+		return
+	}
+	defer func() {
+		if e = db.Close(); ffldb.E.Chk(e) {
+		}
+	}()
+	e = db.View(
+		func(tx database.Tx) (e error) {
+			var has bool
+			if has, e = tx.HasBlock(blocks[0].Hash()); E.Chk(e) {
+				return e
+			}
+			if has {
+				return fmt.Errorf("HasBlock: pruned block still exists")
+			}
+			if _, e = tx.FetchBlock(blocks[0].Hash()); !databasetest.CheckDbError(
+				t, "FetchBlock", e, database.ErrBlockNotFound,
+			) {
+				return fmt.Errorf("FetchBlock: unexpected result for pruned block")
+			}
+			if _, e = tx.FetchBlock(keep); E.Chk(e) {
+				return fmt.Errorf("FetchBlock: unexpected error for kept block: %v", e)
+			}
+			var beenPruned bool
+			if beenPruned, e = tx.BeenPruned(); E.Chk(e) {
+				return e
+			}
+			if !beenPruned {
+				return fmt.Errorf("BeenPruned: expected true after reopening")
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Errorf("View: unexpected error: %v", e)
+	}
+}
+
+// TestCompression ensures that blocks written without compression are recompressed in the background once the database
+// is opened with compression, and that blocks read back the same whichever way they are stored.
+func TestCompression(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(os.TempDir(), "ffldb-compresstest")
+	_ = os.RemoveAll(dbPath)
+	databasetest.TestCompression(t, blockFilesDriver, dbPath)
+}
+
+// TestRecompressReader ensures a transaction that began before the block files were recompressed can still read the
+// blocks from where they were before, and that the old block files are emptied once it has finished.
+func TestRecompressReader(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(os.TempDir(), "ffldb-recompressreadertest")
+	_ = os.RemoveAll(dbPath)
+	databasetest.TestRecompressReader(t, blockFilesDriver, dbPath)
+}
+
+// TestCheckBlocks ensures that CheckBlocks finds and repairs damaged and truncated blocks.
+func TestCheckBlocks(t *testing.T) {
+	t.Parallel()
+	dbPath := filepath.Join(os.TempDir(), "ffldb-checktest")
+	_ = os.RemoveAll(dbPath)
+	databasetest.TestCheckBlocks(t, blockFilesDriver, dbPath)
+}
+
+// TestBackup ensures a backup taken while blocks are being stored opens as a database holding the blocks stored before
+// it was taken and none of the later ones, and that it leaves nothing behind in the database directory.
+func TestBackup(t *testing.T) {
+	t.Parallel()
+	// The test block data carries the bitcoin main network magic.
+	blocks, e := databasetest.LoadBlocks(t, databasetest.BlockDataFile, databasetest.BlockDataNet)
+	if e != nil {
+		t.Errorf("LoadBlocks: unexpected error: %v", e)
+		return
+	}
+	dbPath := filepath.Join(os.TempDir(), "ffldb-backuptest")
+	backupPath := filepath.Join(os.TempDir(), "ffldb-backuptest-backup")
+	_ = os.RemoveAll(dbPath)
+	_ = os.RemoveAll(backupPath)
+	db, e := database.Create(dbType, dbPath, blockDataNet)
+	if e != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, e)
+		return
+	}
+	defer func() {
+		if e = os.RemoveAll(dbPath); ffldb.E.Chk(e) {
+		}
+		if e = os.RemoveAll(backupPath); ffldb.E.Chk(e) {
+		}
+	}()
+	storeBlocks := func(blocks []*block.Block) (e error) {
+		for i := range blocks {
+			if e = db.Update(
+				func(tx database.Tx) (e error) {
+					return tx.StoreBlock(blocks[i])
+				},
+			); E.Chk(e) {
+				return e
+			}
+		}
+		return nil
+	}
+	half := len(blocks) / 2
+	ffldb.TstRunWithMaxBlockFileSize(
+		db, 2048, func() {
+			if e = storeBlocks(blocks[:half]); e != nil {
+				t.Errorf("StoreBlock: unexpected error: %v", e)
+				return
+			}
+			// Back the database up while the rest of the blocks are stored.
+			done := make(chan error)
+			go func() {
+				done <- storeBlocks(blocks[half:])
+			}()
+			if e = db.Backup(backupPath); e != nil {
+				t.Errorf("Backup: unexpected error: %v", e)
+			}
+			if e = <-done; e != nil {
+				t.Errorf("StoreBlock: unexpected error: %v", e)
+			}
+		},
+	)
+	if t.Failed() {
+		_ = db.Close()
+		return
+	}
+	if e = db.Backup(backupPath); !databasetest.CheckDbError(t, "Backup", e, database.ErrDbExists) {
+		_ = db.Close()
+		return
+	}
+	if e = db.Close(); ffldb.E.Chk(e) {
+	}
+	if e = db.Backup(backupPath + "-closed"); !databasetest.CheckDbError(t, "Backup", e, database.ErrDbNotOpen) {
+		return
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dbPath, "backup-*")); len(matches) != 0 {
+		t.Errorf("Backup: staging directories %v left behind", matches)
+		return
+	}
+	// The backup holds the blocks stored before it was taken and none stored after the first one it is missing.
+	backup, e := database.Open(dbType, backupPath, blockDataNet)
+	if e != nil {
+		t.Errorf("Failed to open backup (%s) %v", dbType, e)
+		return
+	}
+	defer func() {
+		if e = backup.Close(); ffldb.E.Chk(e) {
+		}
+	}()
+	e = backup.View(
+		func(tx database.Tx) (e error) {
+			var stored int
+			for i := range blocks {
+				var has bool
+				if has, e = tx.HasBlock(blocks[i].Hash()); E.Chk(e) {
+					return e
+				}
+				if !has {
+					if i < half {
+						return fmt.Errorf("HasBlock #%d: block stored before the backup is missing", i)
+					}
+					continue
+				}
+				if stored != i {
+					return fmt.Errorf("HasBlock #%d: block is in the backup while block #%d is not", i, stored)
+				}
+				stored++
+				var gotBytes, wantBytes []byte
+				if gotBytes, e = tx.FetchBlock(blocks[i].Hash()); E.Chk(e) {
+					return fmt.Errorf("FetchBlock #%d: %v", i, e)
+				}
+				if wantBytes, e = blocks[i].Bytes(); E.Chk(e) {
+					return e
+				}
+				if !reflect.DeepEqual(gotBytes, wantBytes) {
+					return fmt.Errorf("FetchBlock #%d: bytes do not match the stored block", i)
+				}
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Errorf("%v", e)
+		return
+	}
+	// The backup can be written to.
+	e = backup.Update(
+		func(tx database.Tx) (e error) {
+			if has, _ := tx.HasBlock(blocks[len(blocks)-1].Hash()); has {
+				return nil
+			}
+			return tx.StoreBlock(blocks[len(blocks)-1])
+		},
+	)
+	if e != nil {
+		t.Errorf("StoreBlock in backup: unexpected error: %v", e)
+	}
+}
+
+// TestStats ensures the database counts the blocks and bytes written to and read from its block files, the lookups in
+// its cache and its flushes.
+func TestStats(t *testing.T) {
+	t.Parallel()
+	// The test block data carries the bitcoin main network magic.
+	blocks, e := databasetest.LoadBlocks(t, databasetest.BlockDataFile, databasetest.BlockDataNet)
+	if e != nil {
+		t.Errorf("LoadBlocks: unexpected error: %v", e)
+		return
+	}
+	blocks = blocks[:10]
+	dbPath := filepath.Join(os.TempDir(), "ffldb-statstest")
+	_ = os.RemoveAll(dbPath)
+	db, e := database.Create(dbType, dbPath, blockDataNet)
+	if e != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, e)
+		return
+	}
+	defer func() {
+		if e = os.RemoveAll(dbPath); ffldb.E.Chk(e) {
+		}
+	}()
+	defer func() {
+		if e = db.Close(); ffldb.E.Chk(e) {
+		}
+	}()
+	var size uint64
+	for i := range blocks {
+		var raw []byte
+		if raw, e = blocks[i].Bytes(); e != nil {
+			t.Errorf("Bytes: unexpected error: %v", e)
+			return
+		}
+		// Each record holds the network, the length and a checksum along with the block.
+		size += uint64(len(raw)) + 12
+		if e = db.Update(
+			func(tx database.Tx) error {
+				return tx.StoreBlock(blocks[i])
+			},
+		); e != nil {
+			t.Errorf("StoreBlock: unexpected error: %v", e)
+			return
+		}
+	}
+	if e = db.View(
+		func(tx database.Tx) (e error) {
+			if _, e = tx.FetchBlock(blocks[0].Hash()); e != nil {
+				return e
+			}
+			tx.Metadata().Get([]byte("missing"))
+			return nil
+		},
+	); e != nil {
+		t.Errorf("FetchBlock: unexpected error: %v", e)
+		return
+	}
+	stats := db.(database.StatsReporter).Stats()
+	counters := map[string]uint64{
+		"blocks.written":            uint64(len(blocks)),
+		"blocks.read":               1,
+		"blockfiles.written_bytes":  size,
+		"blockfile.0.written_bytes": size,
+	}
+	for name, want := range counters {
+		if got := stats.Counters[name]; got != want {
+			t.Errorf("Stats: %s is %d, want %d", name, got, want)
+		}
+	}
+	if stats.Counters["cache.misses"] == 0 || stats.Gauges["blockfiles.open"] == 0 {
+		t.Errorf("Stats: no cache misses or open block files counted: %v", stats)
+	}
+	if stats.Gauges["cache.pending_entries"] == 0 {
+		t.Errorf("Stats: no entries pending in the cache: %v", stats)
+	}
+	// Flushing the cache leaves nothing pending and is timed.
+	if e = ffldb.TstFlush(db); e != nil {
+		t.Errorf("flush: unexpected error: %v", e)
+		return
+	}
+	stats = db.(database.StatsReporter).Stats()
+	if stats.Gauges["cache.pending_entries"] != 0 || stats.Counters["flush.count"] != 1 ||
+		stats.Histograms["flush.seconds"].Count != 1 {
+		t.Errorf("Stats: unexpected statistics after a flush: %v", stats)
+	}
+}
@@ -5,14 +5,35 @@ package ffldb
 
 import (
 	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/database/internal/flatfile"
 )
 
 // TstRunWithMaxBlockFileSize runs the passed function with the maximum allowed file size for the database set to the
 // provided value. The value will be set back to the original value upon completion.
 func TstRunWithMaxBlockFileSize(idb database.DB, size uint32, fn func()) {
-	ffldb := idb.(*db)
-	origSize := ffldb.store.maxBlockFileSize
-	ffldb.store.maxBlockFileSize = size
+	store := idb.(*db).store
+	origSize := store.SetMaxFileSize(size)
 	fn()
-	ffldb.store.maxBlockFileSize = origSize
+	store.SetMaxFileSize(origSize)
+}
+
+// TstWaitRecompress waits for the background recompression of the block files of the database to finish.
+func TstWaitRecompress(idb database.DB) {
+	idb.(*db).wg.Wait()
+}
+
+// TstRecompress turns on compression for the blocks written to the database and recompresses its block files, returning
+// once that is done.
+func TstRecompress(idb database.DB) {
+	pdb := idb.(*db)
+	pdb.store.SetCompression(flatfile.SnappyCompression)
+	pdb.store.Recompress(pdb, pdb.quit)
+}
+
+// TstFlush flushes the cache of the database to leveldb.
+func TstFlush(idb database.DB) error {
+	pdb := idb.(*db)
+	pdb.writeLock.Lock()
+	defer pdb.writeLock.Unlock()
+	return pdb.cache.flush()
 }
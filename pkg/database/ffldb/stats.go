@@ -0,0 +1,64 @@
+package ffldb
+
+import (
+	"github.com/p9c/parallelcoin/pkg/database"
+)
+
+// Enforce db implements the database.StatsReporter interface.
+var _ database.StatsReporter = (*db)(nil)
+
+// dbStats holds the statistics the database keeps of its metadata cache from the time it is opened.
+type dbStats struct {
+	// The counters come first so they are 64-bit aligned.
+	//
+	// cacheHits and cacheMisses count the metadata lookups that were answered from the database cache and those that had
+	// to go to leveldb.
+	cacheHits   database.Counter
+	cacheMisses database.Counter
+	// flushes counts the flushes of the database cache that wrote metadata to leveldb, and flushedEntries the keys
+	// they wrote and removed.
+	flushes        database.Counter
+	flushedEntries database.Counter
+	// flushTime is the distribution of how long the flushes took.
+	flushTime *database.Histogram
+}
+
+// newDbStats returns statistics with nothing counted yet.
+func newDbStats() *dbStats {
+	return &dbStats{flushTime: database.NewHistogram(database.DurationBounds)}
+}
+
+// Stats returns a snapshot of the statistics of the database:
+//
+//   - cache.hits and cache.misses count the metadata lookups answered from the database cache and those that went to
+//     leveldb
+//
+//   - cache.pending_bytes and cache.pending_entries are the size and number of the changes waiting in the cache to be
+//     flushed to leveldb
+//
+//   - flush.count, flush.entries and flush.seconds are the number of cache flushes, the keys they wrote and removed and
+//     how long they took
+//
+//   - blockfiles.open is the number of block files with an open handle, blockfiles.written_bytes and
+//     blockfiles.read_bytes the bytes written to and read from them, and blockfile.<number>.written_bytes the bytes
+//     written to each file that was written to
+//
+//   - blocks.written and blocks.read count the blocks stored and the blocks and block regions read
+//
+// This function is part of the database.StatsReporter interface implementation.
+func (db *db) Stats() database.Stats {
+	c := db.cache
+	s := c.stats
+	stats := database.NewStats()
+	stats.Counters["cache.hits"] = s.cacheHits.Value()
+	stats.Counters["cache.misses"] = s.cacheMisses.Value()
+	stats.Counters["flush.count"] = s.flushes.Value()
+	stats.Counters["flush.entries"] = s.flushedEntries.Value()
+	stats.Histograms["flush.seconds"] = s.flushTime.Stats()
+	c.cacheLock.RLock()
+	stats.Gauges["cache.pending_bytes"] = int64(c.cachedKeys.Size() + c.cachedRemove.Size())
+	stats.Gauges["cache.pending_entries"] = int64(c.cachedKeys.Len() + c.cachedRemove.Len())
+	c.cacheLock.RUnlock()
+	db.store.AddStats(stats)
+	return stats
+}
@@ -336,6 +336,31 @@ type Tx interface {
 	// after a transaction has ended results in undefined behavior. This constraint prevents additional data copies and
 	// allows support for memory-mapped database implementations.
 	FetchBlockRegions(regions []BlockRegion) ([][]byte, error)
+	// PruneBlocks removes the oldest stored blocks until the total size of the block storage is no more than the
+	// provided target size in bytes, and returns the hashes of all of the blocks that were removed.
+	//
+	// Blocks are removed in whole units of the backend storage (for example, a flat file), oldest first. The canPrune
+	// function is called for every block in a unit before it is removed and pruning stops at the first unit containing
+	// a block for which it returns false, after calling it for the rest of the blocks of that unit. The unit currently
+	// being written to is never removed. A nil canPrune allows every block to be removed.
+	//
+	// Removed blocks are no longer reported by HasBlock and fetching them returns ErrBlockNotFound from the viewpoint of
+	// this transaction. The backing storage is only released once the transaction has been committed.
+	//
+	// The interface contract guarantees at least the following errors will be returned (other implementation-specific
+	// errors are possible):
+	//
+	//   - ErrTxNotWritable if attempted against a read-only transaction
+	//
+	//   - ErrTxClosed if the transaction has already been closed
+	PruneBlocks(targetSize uint64, canPrune func(hash *chainhash.Hash) bool) ([]chainhash.Hash, error)
+	// BeenPruned returns whether or not blocks have ever been removed from the database by PruneBlocks.
+	//
+	// The interface contract guarantees at least the following errors will be returned (other implementation-specific
+	// errors are possible):
+	//
+	//   - ErrTxClosed if the transaction has already been closed
+	BeenPruned() (bool, error)
 	// Commit commits all changes that have been made to the metadata or block storage. Depending on the backend
 	// implementation this could be to a cache that is periodically synced to persistent storage or directly to
 	// persistent storage.
@@ -383,7 +408,32 @@ type DB interface {
 	//
 	// Calling Rollback or Commit on the transaction passed to the user-supplied function will result in a panic.
 	Update(fn func(tx Tx) error) error
+	// Backup writes a consistent copy of the database to the directory at dest, which must not exist yet, that can be
+	// opened with the same driver. It can be called while the database is in use, and write transactions are only held
+	// off for as long as it takes to capture the state of the database. Progress is reported in the log.
+	Backup(dest string) error
 	// Close cleanly shuts down the database and syncs all data. It will block until all database transactions have been
 	// finalized (rolled back or committed).
 	Close() error
 }
+
+// BlockProblem is a block whose stored data BlockChecker found to be damaged.
+type BlockProblem struct {
+	Hash chainhash.Hash
+	// Err describes what is wrong with the stored block.
+	Err error
+	// Repaired is whether the block was removed from the database to repair it.
+	Repaired bool
+}
+
+// BlockChecker is implemented by databases that can check the block data they store against their own record of where
+// each block is stored, such as the flat block files of ffldb against its block index.
+type BlockChecker interface {
+	// CheckBlocks reads back every stored block, checking where it is stored, its length and its checksum, and returns
+	// the blocks that are damaged. When repair is set the damaged blocks are removed from the database, so they are no
+	// longer found by HasBlock and FetchBlock, and stored data that only damaged blocks follow may be truncated.
+	//
+	// Closing the interrupt channel stops the check, and the problems found until then are returned without being
+	// repaired.
+	CheckBlocks(repair bool, interrupt <-chan struct{}) ([]BlockProblem, error)
+}
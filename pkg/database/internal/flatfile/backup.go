@@ -0,0 +1,157 @@
+package flatfile
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/p9c/parallelcoin/pkg/database"
+)
+
+const (
+	// backupStagingPrefix is the prefix of the directories in the database directory that the block files are linked
+	// into while a backup is taken. Any that are left over from a backup that was cut short are removed when the
+	// database is opened.
+	backupStagingPrefix = "backup-"
+	// backupProgressFiles is the number of block files between the progress reports of a backup.
+	backupProgressFiles = 10
+)
+
+// backupFile is a block file staged for a backup.
+type backupFile struct {
+	fileNum uint32
+	// path is where the file is staged, which is empty when the current write file has not been created yet.
+	path string
+	// size is the number of bytes of the file that belong in the backup, and whole is whether that is all of it. Only
+	// the current write file is not whole, since blocks are still being written to it.
+	size  int64
+	whole bool
+}
+
+// Staged holds the block files up to the write cursor, hard linked into a staging directory for a backup, which keeps
+// them from changing or being removed by pruning while the backup is taken.
+type Staged struct {
+	dir   string
+	files []backupFile
+}
+
+// Stage links the block files up to the write cursor into a new staging directory in the database directory. Block
+// files that can not be linked are copied instead.
+//
+// This function MUST be called with the database write lock held, and the block files synced up to the write cursor.
+func (s *Store) Stage() (staged *Staged, e error) {
+	curFileNum, curOffset := s.WriteCursor()
+	staged = &Staged{}
+	if staged.dir, e = os.MkdirTemp(s.basePath, backupStagingPrefix); E.Chk(e) {
+		return nil, makeDbErr(database.ErrDriverSpecific, e.Error(), e)
+	}
+	for fileNum := s.FirstFile(); fileNum <= curFileNum; fileNum++ {
+		file := backupFile{fileNum: fileNum, whole: fileNum < curFileNum}
+		src := FilePath(s.basePath, fileNum)
+		file.path = FilePath(staged.dir, fileNum)
+		if file.whole {
+			var st os.FileInfo
+			if st, e = os.Stat(src); E.Chk(e) {
+				break
+			}
+			file.size = st.Size()
+		} else {
+			file.size = int64(curOffset)
+		}
+		if e = os.Link(src, file.path); e != nil {
+			switch {
+			case os.IsNotExist(e) && !file.whole:
+				// The write file is created with the first block written to it.
+				file.path, e = "", nil
+			case os.IsNotExist(e):
+			default:
+				// The file system can not link files, so the file is copied while writes are still held off instead.
+				D.Ln("copying block file", fileNum, "as it can not be linked:", e)
+				e = copyFileData(src, file.path, file.size)
+			}
+			if E.Chk(e) {
+				break
+			}
+		}
+		staged.files = append(staged.files, file)
+	}
+	if e != nil {
+		staged.Remove()
+		return nil, makeDbErr(database.ErrDriverSpecific, e.Error(), e)
+	}
+	return staged, nil
+}
+
+// Len returns the number of staged block files.
+func (st *Staged) Len() int {
+	return len(st.files)
+}
+
+// Remove removes the staging directory along with whatever is left in it.
+func (st *Staged) Remove() {
+	if e := os.RemoveAll(st.dir); E.Chk(e) {
+	}
+}
+
+// CopyTo moves the staged block files into the backup directory, copying them when they can not be moved, and copies
+// the part of the current write file up to the write cursor. Closing quit stops the copy.
+func (st *Staged) CopyTo(dest string, quit <-chan struct{}) (e error) {
+	for i, file := range st.files {
+		select {
+		case <-quit:
+			return makeDbErr(database.ErrDbNotOpen, "database closed during backup", nil)
+		default:
+		}
+		dst := FilePath(dest, file.fileNum)
+		switch {
+		case file.path == "":
+			e = os.WriteFile(dst, nil, 0600)
+		case file.whole && os.Rename(file.path, dst) == nil:
+		default:
+			e = copyFileData(file.path, dst, file.size)
+		}
+		if E.Chk(e) {
+			return makeDbErr(database.ErrDriverSpecific, e.Error(), e)
+		}
+		if n := i + 1; n%backupProgressFiles == 0 || n == len(st.files) {
+			I.F("backed up %d of %d block files", n, len(st.files))
+		}
+	}
+	return nil
+}
+
+// copyFileData creates the file at dst holding the first size bytes of the file at src and syncs it to disk.
+func copyFileData(src, dst string, size int64) (e error) {
+	var in, out *os.File
+	if in, e = os.Open(src); E.Chk(e) {
+		return e
+	}
+	defer func() {
+		if e := in.Close(); E.Chk(e) {
+		}
+	}()
+	if out, e = os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600); E.Chk(e) {
+		return e
+	}
+	if _, e = io.CopyN(out, in, size); E.Chk(e) {
+		_ = out.Close()
+		return e
+	}
+	if e = out.Sync(); E.Chk(e) {
+		_ = out.Close()
+		return e
+	}
+	return out.Close()
+}
+
+// RemoveStaging removes the staging directories of backups that were cut short from the database directory.
+func RemoveStaging(dbPath string) {
+	matches, e := filepath.Glob(filepath.Join(dbPath, backupStagingPrefix+"*"))
+	if E.Chk(e) {
+		return
+	}
+	for _, match := range matches {
+		if e = os.RemoveAll(match); E.Chk(e) {
+		}
+	}
+}
@@ -1,4 +1,4 @@
-package ffldb
+package flatfile
 
 import (
 	"container/list"
@@ -8,8 +8,12 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
-	
+
+	"github.com/btcsuite/snappy-go"
+
 	"github.com/p9c/parallelcoin/pkg/chainhash"
 	"github.com/p9c/parallelcoin/pkg/database"
 	"github.com/p9c/parallelcoin/pkg/wire"
@@ -33,7 +37,7 @@ const (
 	// NOTE: The current code uses uint32 for all offsets, so this value must be less than 2^32 (4 GiB). This is also
 	// why it's a typed constant.
 	maxBlockFileSize uint32 = 512 * 1024 * 1024 // 512 MiB
-	// blockLocSize is the number of bytes the serialized block location data that is stored in the block index.
+	// LocationSize is the number of bytes the serialized block location data that is stored in the block index.
 	//
 	// The serialized block location format is:
 	//
@@ -42,14 +46,26 @@ const (
 	//  [4:8]  File offset (4 bytes)
 	//
 	//  [8:12] Block length (4 bytes)
-	blockLocSize = 12
+	//
+	// The block length has compressedFlag set when the block record is compressed.
+	LocationSize = 12
+	// compressedFlag is set in the block length of a block record, and of its location in the block index, when the
+	// block is stored compressed with snappy. Blocks are far smaller than 2 GiB so the top bit is otherwise unused.
+	compressedFlag uint32 = 1 << 31
 )
 
 var (
+	// byteOrder is the preferred byte order used through the block files and the locations stored in the block index.
+	byteOrder = binary.LittleEndian
 	// castagnoli houses the Catagnoli polynomial used for CRC-32 checksums.
 	castagnoli = crc32.MakeTable(crc32.Castagnoli)
 )
 
+// makeDbErr creates a database.DBError given a set of arguments.
+func makeDbErr(c database.ErrorCode, desc string, e error) database.DBError {
+	return database.DBError{ErrorCode: c, Description: desc, Err: e}
+}
+
 type (
 	// filer is an interface which acts very similar to a *os.File and is typically implemented by it. It exists so the
 	// test code can provide mock files for properly testing corruption and file system issues.
@@ -77,9 +93,9 @@ type (
 		// curOffset is the offset in the current write block file where the next new block will be written.
 		curOffset uint32
 	}
-	// blockStore houses information used to handle reading and writing blocks (and part of blocks) into flat files with
+	// Store houses information used to handle reading and writing blocks (and part of blocks) into flat files with
 	// support for multiple concurrent readers.
-	blockStore struct {
+	Store struct {
 		// network is the specific network to use in the flat files for each block.
 		network wire.BitcoinNet
 		// basePath is the base path used for the flat block files and metadata.
@@ -87,6 +103,8 @@ type (
 		// maxBlockFileSize is the maximum size for each file used to store blocks. It is defined on the store so the
 		// whitebox tests can override the value.
 		maxBlockFileSize uint32
+		// compression is the compression applied to the blocks that are written.
+		compression Compression
 		// The following fields are related to the flat files which hold the actual blocks.
 		//
 		// The number of open files is limited by maxOpenFiles.
@@ -138,20 +156,45 @@ type (
 		openFileFunc      func(fileNum uint32) (*lockableFile, error)
 		openWriteFileFunc func(fileNum uint32) (filer, error)
 		deleteFileFunc    func(fileNum uint32) error
-	}
-	// blockLocation identifies a particular block file and location.
-	blockLocation struct {
-		blockFileNum uint32
-		fileOffset   uint32
-		blockLen     uint32
+		// firstFileNum is the number of the oldest block file the block index can refer to. It is only greater than
+		// zero when the oldest files have been removed by pruning, and the removed files can still be on disk until the
+		// transactions that could read them have finished.
+		firstFileMtx sync.Mutex
+		firstFileNum uint32
+		// txMtx protects the fields that follow, which hold back the removing and emptying of block files until the
+		// transactions that began before they were asked for have finished, as those can still read the blocks in
+		// them.
+		//
+		// txGen is the generation of the block files, which is advanced each time a change to them is deferred.
+		//
+		// openTxs holds the number of open transactions by the generation they began in.
+		//
+		// deferred holds the changes to the block files that are waiting for the transactions to finish.
+		txMtx    sync.Mutex
+		txGen    uint64
+		openTxs  map[uint64]int
+		deferred []deferredChange
+		// stats holds the statistics of the block files.
+		stats *Stats
+	}
+	// Location identifies a particular block file and location.
+	Location struct {
+		FileNum uint32
+		Offset  uint32
+		// Len is the length of the whole block record, including the network, block length and checksum around the
+		// block.
+		Len uint32
+		// Compressed is whether the block record holds the block compressed, in which case it has to be read and
+		// decoded in full to get at any part of it.
+		Compressed bool
 	}
 )
 
-// deserializeBlockLoc deserializes the passed serialized block location information. This is data stored into the block
-// index metadata for each block. The serialized data passed to this function MUST be at least blockLocSize bytes or it
+// DeserializeLocation deserializes the passed serialized block location information. This is data stored into the block
+// index metadata for each block. The serialized data passed to this function MUST be at least LocationSize bytes or it
 // will panic. The error check is avoided here because this information will always be coming from the block index which
 // includes a checksum to detect corruption. Thus it is safe to use this unchecked here.
-func deserializeBlockLoc(serializedLoc []byte) blockLocation {
+func DeserializeLocation(serializedLoc []byte) Location {
 	// The serialized block location format is:
 	//
 	//  [0:4]  Block file (4 bytes)
@@ -159,16 +202,24 @@ func deserializeBlockLoc(serializedLoc []byte) blockLocation {
 	//  [4:8]  File offset (4 bytes)
 	//
 	//  [8:12] Block length (4 bytes)
-	return blockLocation{
-		blockFileNum: byteOrder.Uint32(serializedLoc[0:4]),
-		fileOffset:   byteOrder.Uint32(serializedLoc[4:8]),
-		blockLen:     byteOrder.Uint32(serializedLoc[8:12]),
+	blockLen := byteOrder.Uint32(serializedLoc[8:12])
+	return Location{
+		FileNum:    byteOrder.Uint32(serializedLoc[0:4]),
+		Offset:     byteOrder.Uint32(serializedLoc[4:8]),
+		Len:        blockLen &^ compressedFlag,
+		Compressed: blockLen&compressedFlag != 0,
 	}
 }
 
-// serializeBlockLoc returns the serialization of the passed block location. This is data to be stored into the block
+// DataLen returns the length of the block held in the block record at the location, which leaves out the network, block
+// length and checksum around it. For a compressed block it is the length of the compressed data.
+func (loc Location) DataLen() uint32 {
+	return loc.Len - 12
+}
+
+// SerializeLocation returns the serialization of the passed block location. This is data to be stored into the block
 // index metadata for each block.
-func serializeBlockLoc(loc blockLocation) []byte {
+func SerializeLocation(loc Location) []byte {
 	// The serialized block location format is:
 	//
 	//  [0:4]  Block file (4 bytes)
@@ -177,14 +228,18 @@ func serializeBlockLoc(loc blockLocation) []byte {
 	//
 	//  [8:12] Block length (4 bytes)
 	var serializedData [12]byte
-	byteOrder.PutUint32(serializedData[0:4], loc.blockFileNum)
-	byteOrder.PutUint32(serializedData[4:8], loc.fileOffset)
-	byteOrder.PutUint32(serializedData[8:12], loc.blockLen)
+	blockLen := loc.Len
+	if loc.Compressed {
+		blockLen |= compressedFlag
+	}
+	byteOrder.PutUint32(serializedData[0:4], loc.FileNum)
+	byteOrder.PutUint32(serializedData[4:8], loc.Offset)
+	byteOrder.PutUint32(serializedData[8:12], blockLen)
 	return serializedData[:]
 }
 
-// blockFilePath return the file path for the provided block file number.
-func blockFilePath(dbPath string, fileNum uint32) string {
+// FilePath return the file path for the provided block file number.
+func FilePath(dbPath string, fileNum uint32) string {
 	fileName := fmt.Sprintf(blockFilenameTemplate, fileNum)
 	return filepath.Join(dbPath, fileName)
 }
@@ -192,10 +247,10 @@ func blockFilePath(dbPath string, fileNum uint32) string {
 // openWriteFile returns a file handle for the passed flat file number in read/write mode. The file will be created if
 // needed. It is typically used for the current file that will have all new data appended. Unlike openFile, this
 // function does not keep track of the open file and it is not subject to the maxOpenFiles limit.
-func (s *blockStore) openWriteFile(fileNum uint32) (filer, error) {
+func (s *Store) openWriteFile(fileNum uint32) (filer, error) {
 	// The current block file needs to be read-write so it is possible to append to it. Also, it shouldn't be part of
 	// the least recently used file.
-	filePath := blockFilePath(s.basePath, fileNum)
+	filePath := FilePath(s.basePath, fileNum)
 	file, e := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0666)
 	if e != nil {
 		str := fmt.Sprintf("failed to open file %q: %v", filePath, e)
@@ -209,9 +264,9 @@ func (s *blockStore) openWriteFile(fileNum uint32) (filer, error) {
 // least recently used file as needed.
 //
 // This function MUST be called with the overall files mutex (s.obfMutex) locked for WRITES.
-func (s *blockStore) openFile(fileNum uint32) (*lockableFile, error) {
+func (s *Store) openFile(fileNum uint32) (*lockableFile, error) {
 	// Open the appropriate file as read-only.
-	filePath := blockFilePath(s.basePath, fileNum)
+	filePath := FilePath(s.basePath, fileNum)
 	file, e := os.Open(filePath)
 	if e != nil {
 		return nil, makeDbErr(
@@ -251,8 +306,8 @@ func (s *blockStore) openFile(fileNum uint32) (*lockableFile, error) {
 // deleteFile removes the block file for the passed flat file number. The file
 // must already be closed and it is the responsibility of the caller to do any
 // other state cleanup necessary.
-func (s *blockStore) deleteFile(fileNum uint32) (e error) {
-	filePath := blockFilePath(s.basePath, fileNum)
+func (s *Store) deleteFile(fileNum uint32) (e error) {
+	filePath := FilePath(s.basePath, fileNum)
 	if e := os.Remove(filePath); E.Chk(e) {
 		return makeDbErr(database.ErrDriverSpecific, e.Error(), e)
 	}
@@ -269,7 +324,7 @@ func (s *blockStore) deleteFile(fileNum uint32) (e error) {
 // operations. This is necessary because otherwise it would be possible for a
 // separate goroutine to close the file after it is returned from here, but
 // before the caller has acquired a read lock.
-func (s *blockStore) blockFile(fileNum uint32) (*lockableFile, error) {
+func (s *Store) blockFile(fileNum uint32) (*lockableFile, error) {
 	// When the requested block file is open for writes, return it.
 	wc := s.writeCursor
 	wc.RLock()
@@ -310,7 +365,7 @@ func (s *blockStore) blockFile(fileNum uint32) (*lockableFile, error) {
 	return obf, nil
 }
 
-// writeData is a helper function for writeBlock which writes the provided data at the current write offset and updates
+// writeData is a helper function for WriteBlock which writes the provided data at the current write offset and updates
 // the write cursor accordingly. The field name parameter is only used when there is an error to provide a nicer error
 // message.
 //
@@ -318,10 +373,11 @@ func (s *blockStore) blockFile(fileNum uint32) (*lockableFile, error) {
 //
 // NOTE: This function MUST be called with the write cursor current file lock held and must only be called during a
 // write transaction so it is effectively locked for writes. Also, the write cursor current file must NOT be nilog.
-func (s *blockStore) writeData(data []byte, fieldName string) (e error) {
+func (s *Store) writeData(data []byte, fieldName string) (e error) {
 	wc := s.writeCursor
 	n, e := wc.curFile.file.WriteAt(data, int64(wc.curOffset))
 	wc.curOffset += uint32(n)
+	s.stats.wrote(wc.curFileNum, n)
 	if e != nil {
 		str := fmt.Sprintf(
 			"failed to write %s to file %d at "+
@@ -333,13 +389,20 @@ func (s *blockStore) writeData(data []byte, fieldName string) (e error) {
 	return nil
 }
 
-// writeBlock appends the specified raw block bytes to the store's write cursor location and increments it accordingly.
+// WriteBlock appends the specified raw block bytes to the store's write cursor location and increments it accordingly.
 // When the block would exceed the max file size for the current flat file, this function will close the current file,
 // create the next file, update the write cursor, and write the block to the new file.
 //
+// When the store compresses blocks, the block is written compressed with snappy and compressedFlag is set in the block
+// length.
+//
 // The write cursor will also be advanced the number of bytes actually written in the event of failure. Format:
 // <network><block length><serialized block><checksum>
-func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
+func (s *Store) WriteBlock(rawBlock []byte) (Location, error) {
+	compressed := s.compression == SnappyCompression
+	if compressed {
+		rawBlock = snappy.Encode(nil, rawBlock)
+	}
 	// Compute how many bytes will be written.
 	//
 	// 4 bytes each for block network + 4 bytes for block length + length of raw block + 4 bytes for checksum.
@@ -381,7 +444,7 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 	if wc.curFile.file == nil {
 		file, e := s.openWriteFileFunc(wc.curFileNum)
 		if e != nil {
-			return blockLocation{}, e
+			return Location{}, e
 		}
 		wc.curFile.file = file
 	}
@@ -391,59 +454,67 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 	var scratch [4]byte
 	byteOrder.PutUint32(scratch[:], uint32(s.network))
 	if e := s.writeData(scratch[:], "network"); E.Chk(e) {
-		return blockLocation{}, e
+		return Location{}, e
 	}
 	_, _ = hasher.Write(scratch[:])
 	// Block length.
-	byteOrder.PutUint32(scratch[:], blockLen)
+	if compressed {
+		byteOrder.PutUint32(scratch[:], blockLen|compressedFlag)
+	} else {
+		byteOrder.PutUint32(scratch[:], blockLen)
+	}
 	if e := s.writeData(scratch[:], "block length"); E.Chk(e) {
-		return blockLocation{}, e
+		return Location{}, e
 	}
 	_, _ = hasher.Write(scratch[:])
 	// Serialized block.
 	if e := s.writeData(rawBlock[:], "block"); E.Chk(e) {
-		return blockLocation{}, e
+		return Location{}, e
 	}
 	_, _ = hasher.Write(rawBlock)
 	// Castagnoli CRC-32 as a checksum of all the previous.
 	if e := s.writeData(hasher.Sum(nil), "checksum"); E.Chk(e) {
-		return blockLocation{}, e
+		return Location{}, e
 	}
-	loc := blockLocation{
-		blockFileNum: wc.curFileNum,
-		fileOffset:   origOffset,
-		blockLen:     fullLen,
+	loc := Location{
+		FileNum:    wc.curFileNum,
+		Offset:     origOffset,
+		Len:        fullLen,
+		Compressed: compressed,
 	}
+	s.stats.blocksWritten.Inc()
 	return loc, nil
 }
 
-// readBlock reads the specified block record and returns the serialized block. It ensures the integrity of the block
+// ReadBlock reads the specified block record and returns the serialized block. It ensures the integrity of the block
 // data by checking that the serialized network matches the current network associated with the block store and
-// comparing the calculated checksum against the one stored in the flat file.
+// comparing the calculated checksum against the one stored in the flat file. Compressed blocks are decoded after the
+// checksum has been verified.
 //
 // This function also automatically handles all file management such as opening and closing files as necessary to stay
 // within the maximum allowed open files limit.
 //
 // Returns ErrDriverSpecific if the data fails to read for any reason and ErrCorruption if the checksum of the read data
 // doesn't match the checksum read from the file. Format: <network><block length><serialized block><checksum>
-func (s *blockStore) readBlock(hash *chainhash.Hash, loc blockLocation) ([]byte, error) {
+func (s *Store) ReadBlock(hash *chainhash.Hash, loc Location) ([]byte, error) {
 	// Get the referenced block file handle opening the file as needed. The function also handles closing files as
 	// needed to avoid going over the max allowed open files.
-	blockFile, e := s.blockFile(loc.blockFileNum)
+	blockFile, e := s.blockFile(loc.FileNum)
 	if e != nil {
 		return nil, e
 	}
-	serializedData := make([]byte, loc.blockLen)
-	n, e := blockFile.file.ReadAt(serializedData, int64(loc.fileOffset))
+	serializedData := make([]byte, loc.Len)
+	n, e := blockFile.file.ReadAt(serializedData, int64(loc.Offset))
 	blockFile.RUnlock()
 	if e != nil {
 		str := fmt.Sprintf(
 			"failed to read block %s from file %d, "+
-				"offset %d: %v", hash, loc.blockFileNum, loc.fileOffset,
+				"offset %d: %v", hash, loc.FileNum, loc.Offset,
 			e,
 		)
 		return nil, makeDbErr(database.ErrDriverSpecific, str, e)
 	}
+	s.stats.read(n)
 	// Calculate the checksum of the read data and ensure it matches the serialized checksum. This will detect any data
 	// corruption in the flat file without having to do much more expensive merkle root calculations on the loaded
 	// block.
@@ -468,47 +539,67 @@ func (s *blockStore) readBlock(hash *chainhash.Hash, loc blockLocation) ([]byte,
 		)
 		return nil, makeDbErr(database.ErrDriverSpecific, str, nil)
 	}
+	// The length of the block and whether it is compressed must match its location in the block index, otherwise the
+	// block index does not point at the start of the block record.
+	serializedLen := byteOrder.Uint32(serializedData[4:8])
+	if serializedLen&^compressedFlag != loc.DataLen() || (serializedLen&compressedFlag != 0) != loc.Compressed {
+		str := fmt.Sprintf(
+			"block data for block %s has length %d, but the block index has %d",
+			hash, serializedLen&^compressedFlag, loc.DataLen(),
+		)
+		return nil, makeDbErr(database.ErrCorruption, str, nil)
+	}
 	// The raw block excludes the network, length of the block, and checksum.
-	return serializedData[8 : n-4], nil
+	rawBlock := serializedData[8 : n-4]
+	if loc.Compressed {
+		if rawBlock, e = snappy.Decode(nil, rawBlock); E.Chk(e) {
+			str := fmt.Sprintf("failed to decompress block %s: %v", hash, e)
+			return nil, makeDbErr(database.ErrCorruption, str, e)
+		}
+	}
+	return rawBlock, nil
 }
 
 // readBlockRegion reads the specified amount of data at the provided offset for a given block location. The offset is
 // relative to the start of the serialized block (as opposed to the beginning of the block record).
 //
+// The block must not be compressed, as a region of a compressed block can only be had by reading the whole block.
+//
 // This function automatically handles all file management such as opening and closing files as necessary to stay within
 // the maximum allowed open files limit.
 //
 // Returns ErrDriverSpecific if the data fails to read for any reason.
-func (s *blockStore) readBlockRegion(loc blockLocation, offset, numBytes uint32) ([]byte, error) {
+func (s *Store) readBlockRegion(loc Location, offset, numBytes uint32) ([]byte, error) {
 	// Get the referenced block file handle opening the file as needed. The function also handles closing files as
 	// needed to avoid going over the max allowed open files.
-	blockFile, e := s.blockFile(loc.blockFileNum)
+	blockFile, e := s.blockFile(loc.FileNum)
 	if e != nil {
 		return nil, e
 	}
 	// Regions are offsets into the actual block, however the serialized data for a block includes an initial 4 bytes
 	// for network + 4 bytes for block length. Thus, add 8 bytes to adjust.
-	readOffset := loc.fileOffset + 8 + offset
+	readOffset := loc.Offset + 8 + offset
 	serializedData := make([]byte, numBytes)
 	_, e = blockFile.file.ReadAt(serializedData, int64(readOffset))
 	blockFile.RUnlock()
 	if e != nil {
 		str := fmt.Sprintf(
 			"failed to read region from block file %d, "+
-				"offset %d, len %d: %v", loc.blockFileNum, readOffset,
+				"offset %d, len %d: %v", loc.FileNum, readOffset,
 			numBytes, e,
 		)
 		return nil, makeDbErr(database.ErrDriverSpecific, str, e)
 	}
+	s.stats.read(len(serializedData))
 	return serializedData, nil
 }
 
-// syncBlocks performs a file system sync on the flat file associated with the store's current write cursor. It is safe
+// Sync performs a file system sync on the flat file associated with the store's current write cursor. It is safe
 // to call even when there is not a current write file in which case it will have no effect.
 //
 // This is used when flushing cached metadata updates to disk to ensure all the block data is fully written before
 // updating the metadata. This ensures the metadata and block data can be properly reconciled in failure scenarios.
-func (s *blockStore) syncBlocks() (e error) {
+func (s *Store) Sync() (e error) {
 	wc := s.writeCursor
 	wc.RLock()
 	defer wc.RUnlock()
@@ -529,14 +620,14 @@ func (s *blockStore) syncBlocks() (e error) {
 	return nil
 }
 
-// handleRollback rolls the block files on disk back to the provided file number and offset. This involves potentially
+// Rollback rolls the block files on disk back to the provided file number and offset. This involves potentially
 // deleting and truncating the files that were partially written.
 //
 // There are effectively two scenarios to consider here:
 //
-//   1) Transient write failures from which recovery is possible
+//  1. Transient write failures from which recovery is possible
 //
-//   2) More permanent failures such as hard disk death and/or removal
+//  2. More permanent failures such as hard disk death and/or removal
 //
 // In either case, the write cursor will be repositioned to the old block file offset regardless of any other errors
 // that occur while attempting to undo writes.
@@ -549,7 +640,7 @@ func (s *blockStore) syncBlocks() (e error) {
 //
 // Therefore, any errors are simply logged at a warning level rather than being returned since there is nothing more
 // that could be done about it anyways.
-func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
+func (s *Store) Rollback(oldBlockFileNum, oldBlockOffset uint32) {
 	// Grab the write cursor mutex since it is modified throughout this function.
 	wc := s.writeCursor
 	wc.Lock()
@@ -621,16 +712,38 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 	}
 }
 
-// scanBlockFiles searches the database directory for all flat block files to find the end of the most recent file.
+// scanBlockFiles searches the database directory for all flat block files to find the first file and the end of the
+// most recent file.
 //
-// This position is considered the current write cursor which is also stored in the metadata.
+// The first file is not necessarily file 0 as the oldest files are removed when blocks are pruned.
+//
+// The end position is considered the current write cursor which is also stored in the metadata.
 //
 // Thus, it is used to detect unexpected shutdowns in the middle of writes so the block files can be reconciled.
-func scanBlockFiles(dbPath string) (int, uint32) {
+func scanBlockFiles(dbPath string) (int, int, uint32) {
+	firstFile := -1
 	lastFile := -1
 	fileLen := uint32(0)
-	for i := 0; ; i++ {
-		filePath := blockFilePath(dbPath, uint32(i))
+	matches, e := filepath.Glob(filepath.Join(dbPath, "*.fdb"))
+	if e != nil {
+		T.Ln(e)
+		return firstFile, lastFile, fileLen
+	}
+	for i := range matches {
+		var fileNum uint64
+		if fileNum, e = strconv.ParseUint(strings.TrimSuffix(filepath.Base(matches[i]), ".fdb"), 10, 32); E.Chk(e) {
+			continue
+		}
+		if firstFile == -1 || int(fileNum) < firstFile {
+			firstFile = int(fileNum)
+		}
+	}
+	if firstFile == -1 {
+		T.Ln("no block files found in", dbPath)
+		return firstFile, lastFile, fileLen
+	}
+	for i := firstFile; ; i++ {
+		filePath := FilePath(dbPath, uint32(i))
 		st, e := os.Stat(filePath)
 		if e != nil {
 			T.Ln(e)
@@ -639,26 +752,215 @@ func scanBlockFiles(dbPath string) (int, uint32) {
 		lastFile = i
 		fileLen = uint32(st.Size())
 	}
-	T.F("Scan found latest block file #%d with length %d", lastFile, fileLen)
-	return lastFile, fileLen
+	T.F("Scan found block files #%d to #%d with latest length %d", firstFile, lastFile, fileLen)
+	return firstFile, lastFile, fileLen
+}
+
+// RemoveFile closes the block file for the passed flat file number if it is open and then deletes it. It is used to
+// release the space taken by block files that have been pruned. The file is only deleted once the transactions that
+// began before this call have finished, but it is no longer counted among the block files right away.
+//
+// The current write file can not be removed.
+func (s *Store) RemoveFile(fileNum uint32) (e error) {
+	wc := s.writeCursor
+	wc.RLock()
+	curFileNum := wc.curFileNum
+	wc.RUnlock()
+	if fileNum >= curFileNum {
+		str := fmt.Sprintf("block file %d is not older than the current write file %d", fileNum, curFileNum)
+		return makeDbErr(database.ErrDriverSpecific, str, nil)
+	}
+	s.firstFileMtx.Lock()
+	if fileNum >= s.firstFileNum {
+		s.firstFileNum = fileNum + 1
+	}
+	s.firstFileMtx.Unlock()
+	s.deferChange(deferredChange{fileNum: fileNum, remove: true})
+	return nil
+}
+
+// removeFile closes the block file for the passed flat file number if it is open and then deletes it.
+func (s *Store) removeFile(fileNum uint32) (e error) {
+	s.closeFile(fileNum)
+	return s.deleteFileFunc(fileNum)
+}
+
+// checkBlock checks the block record at the passed location lies within its block file and reads it back, which checks
+// its length, network and checksum, returning an error describing the first problem found.
+func (s *Store) checkBlock(hash *chainhash.Hash, loc Location) (e error) {
+	if loc.FileNum < s.FirstFile() {
+		str := fmt.Sprintf("block file %d holding block %s has been removed by pruning", loc.FileNum, hash)
+		return makeDbErr(database.ErrCorruption, str, nil)
+	}
+	st, e := os.Stat(FilePath(s.basePath, loc.FileNum))
+	if e != nil {
+		str := fmt.Sprintf("block file %d holding block %s is missing: %v", loc.FileNum, hash, e)
+		return makeDbErr(database.ErrCorruption, str, e)
+	}
+	if loc.Len < 12 || int64(loc.Offset)+int64(loc.Len) > st.Size() {
+		str := fmt.Sprintf(
+			"block %s of %d bytes at offset %d is past the end of block file %d of %d bytes",
+			hash, loc.Len, loc.Offset, loc.FileNum, st.Size(),
+		)
+		return makeDbErr(database.ErrCorruption, str, nil)
+	}
+	_, e = s.ReadBlock(hash, loc)
+	return e
+}
+
+// Truncate rolls the block files on disk back to the provided file number and offset, in the same way as
+// Rollback, after closing the read-only handles of the block files that are truncated or deleted. Deferred changes to
+// those files are dropped, so they can not touch the blocks written to them afterwards.
+func (s *Store) Truncate(fileNum, offset uint32) {
+	s.dropDeferred(fileNum)
+	wc := s.writeCursor
+	wc.RLock()
+	curFileNum := wc.curFileNum
+	wc.RUnlock()
+	for n := fileNum; n < curFileNum; n++ {
+		s.closeFile(n)
+	}
+	s.Rollback(fileNum, offset)
+}
+
+// EmptyFile closes the block file for the passed flat file number if it is open and then replaces it with an empty file.
+// It is used to release the space taken by block files whose blocks have all been moved elsewhere, while keeping the
+// numbering of the block files contiguous. The file is replaced rather than truncated so the links to it that a backup
+// in progress has staged keep their contents. The file is only replaced once the transactions that began before this
+// call have finished, as they can still read the blocks that were moved out of it.
+//
+// The current write file can not be emptied.
+func (s *Store) EmptyFile(fileNum uint32) (e error) {
+	wc := s.writeCursor
+	wc.RLock()
+	curFileNum := wc.curFileNum
+	wc.RUnlock()
+	if fileNum >= curFileNum {
+		str := fmt.Sprintf("block file %d is not older than the current write file %d", fileNum, curFileNum)
+		return makeDbErr(database.ErrDriverSpecific, str, nil)
+	}
+	s.deferChange(deferredChange{fileNum: fileNum})
+	return nil
+}
+
+// emptyFile closes the block file for the passed flat file number if it is open and then replaces it with an empty file.
+func (s *Store) emptyFile(fileNum uint32) (e error) {
+	s.closeFile(fileNum)
+	filePath := FilePath(s.basePath, fileNum)
+	tmpPath := filePath + ".tmp"
+	if e = os.WriteFile(tmpPath, nil, 0600); E.Chk(e) {
+		return makeDbErr(database.ErrDriverSpecific, e.Error(), e)
+	}
+	if e = os.Rename(tmpPath, filePath); E.Chk(e) {
+		_ = os.Remove(tmpPath)
+		return makeDbErr(database.ErrDriverSpecific, e.Error(), e)
+	}
+	return nil
+}
+
+// closeFile closes the block file for the passed flat file number if it is open, so it is reopened the next time it
+// is read from.
+func (s *Store) closeFile(fileNum uint32) {
+	s.obfMutex.Lock()
+	defer s.obfMutex.Unlock()
+	if blockFile, ok := s.openBlockFiles[fileNum]; ok {
+		s.lruMutex.Lock()
+		s.openBlocksLRU.Remove(s.fileNumToLRUElem[fileNum])
+		delete(s.fileNumToLRUElem, fileNum)
+		s.lruMutex.Unlock()
+		// Close the file under the write lock for the file in case any readers are currently reading from it.
+		blockFile.Lock()
+		_ = blockFile.file.Close()
+		blockFile.Unlock()
+		delete(s.openBlockFiles, fileNum)
+	}
+}
+
+// FirstFile returns the number of the oldest block file that has not been removed by pruning.
+func (s *Store) FirstFile() uint32 {
+	s.firstFileMtx.Lock()
+	defer s.firstFileMtx.Unlock()
+	return s.firstFileNum
+}
+
+// FileSize returns the size of the block file for the passed flat file number. Missing files have a size of zero.
+func (s *Store) FileSize(fileNum uint32) uint64 {
+	st, e := os.Stat(FilePath(s.basePath, fileNum))
+	if e != nil {
+		return 0
+	}
+	return uint64(st.Size())
+}
+
+// WriteCursor returns the block file number and offset where the next block will be written.
+func (s *Store) WriteCursor() (fileNum, offset uint32) {
+	wc := s.writeCursor
+	wc.RLock()
+	defer wc.RUnlock()
+	return wc.curFileNum, wc.curOffset
+}
+
+// BasePath returns the directory holding the block files.
+func (s *Store) BasePath() string {
+	return s.basePath
+}
+
+// SetMaxFileSize sets the maximum size of the block files and returns the previous one. It lets the tests of the
+// drivers spread a few blocks over many block files.
+func (s *Store) SetMaxFileSize(size uint32) uint32 {
+	old := s.maxBlockFileSize
+	s.maxBlockFileSize = size
+	return old
+}
+
+// SetCompression sets the compression applied to the blocks that are written and returns the previous one. It lets the
+// tests of the drivers recompress the block files of a database that was opened without compression.
+func (s *Store) SetCompression(compression Compression) Compression {
+	old := s.compression
+	s.compression = compression
+	return old
+}
+
+// Close makes the changes to the block files that are still deferred and closes all of the open block files.
+//
+// NOTE: This function MUST only be called once all transactions of the database have finished, as it clears the state
+// without the individual locks.
+func (s *Store) Close() {
+	s.applyDeferred(s.takeDeferred(true))
+	wc := s.writeCursor
+	if wc.curFile.file != nil {
+		_ = wc.curFile.file.Close()
+		wc.curFile.file = nil
+	}
+	for _, blockFile := range s.openBlockFiles {
+		_ = blockFile.file.Close()
+	}
+	s.openBlockFiles = nil
+	s.openBlocksLRU.Init()
+	s.fileNumToLRUElem = nil
 }
 
-// newBlockStore returns a new block store with the current block file number and offset set and all fields initialized.
-func newBlockStore(basePath string, network wire.BitcoinNet) *blockStore {
+// NewStore returns a new block store with the current block file number and offset set and all fields initialized.
+func NewStore(basePath string, network wire.BitcoinNet, compression Compression) *Store {
 	// Look for the end of the latest block to file to determine what the write cursor position is from the viewpoint of
 	// the block files on disk.
-	fileNum, fileOff := scanBlockFiles(basePath)
+	firstNum, fileNum, fileOff := scanBlockFiles(basePath)
 	if fileNum == -1 {
+		firstNum = 0
 		fileNum = 0
 		fileOff = 0
 	}
-	store := &blockStore{
+	store := &Store{
 		network:          network,
 		basePath:         basePath,
 		maxBlockFileSize: maxBlockFileSize,
+		compression:      compression,
+		firstFileNum:     uint32(firstNum),
 		openBlockFiles:   make(map[uint32]*lockableFile),
+		stats:            newStats(),
 		openBlocksLRU:    list.New(),
 		fileNumToLRUElem: make(map[uint32]*list.Element),
+		openTxs:          make(map[uint64]int),
 		writeCursor: &writeCursor{
 			curFile:    &lockableFile{},
 			curFileNum: uint32(fileNum),
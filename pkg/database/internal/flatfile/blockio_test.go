@@ -0,0 +1,383 @@
+// This file is part of the flatfile package rather than the flatfile_test package as it provides whitebox testing.
+package flatfile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"testing"
+
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// testNet is the network the test block records are written for.
+const testNet = wire.BitcoinNet(0xd9b4bef9)
+
+// testContext is a block store whose block files are mock files held in memory, which allows injecting file-related
+// errors.
+type testContext struct {
+	t            *testing.T
+	store        *Store
+	files        map[uint32]*lockableFile
+	maxFileSizes map[uint32]int64
+	blocks       [][]byte
+}
+
+// newTestContext returns a test context with a block store in an empty directory that writes its block files to mock
+// files, limited to the sizes in maxFileSizes, with a maximum block file size that spreads the test blocks over several
+// files.
+func newTestContext(t *testing.T) *testContext {
+	tc := &testContext{
+		t:            t,
+		files:        make(map[uint32]*lockableFile),
+		maxFileSizes: make(map[uint32]int64),
+	}
+	dir, e := os.MkdirTemp("", "flatfile-")
+	if e != nil {
+		t.Fatalf("MkdirTemp: unexpected error: %v", e)
+	}
+	t.Cleanup(
+		func() {
+			if e := os.RemoveAll(dir); E.Chk(e) {
+			}
+		},
+	)
+	store := NewStore(dir, testNet, NoCompression)
+	store.maxBlockFileSize = 1024
+	store.openWriteFileFunc = func(fileNum uint32) (filer, error) {
+		if file, ok := tc.files[fileNum]; ok {
+			// "Reopen" the file.
+			mock := file.file.(*mockFile)
+			mock.Lock()
+			mock.closed = false
+			mock.Unlock()
+			return mock, nil
+		}
+		// Limit the max size of the mock file as specified in the test context.
+		maxSize := int64(-1)
+		if maxFileSize, ok := tc.maxFileSizes[fileNum]; ok {
+			maxSize = maxFileSize
+		}
+		file := &mockFile{maxSize: maxSize}
+		tc.files[fileNum] = &lockableFile{file: file}
+		return file, nil
+	}
+	store.openFileFunc = func(fileNum uint32) (*lockableFile, error) {
+		// Force error when trying to open max file num.
+		if fileNum == ^uint32(0) {
+			return nil, makeDbErr(database.ErrDriverSpecific, "test", nil)
+		}
+		if file, ok := tc.files[fileNum]; ok {
+			// "Reopen" the file.
+			mock := file.file.(*mockFile)
+			mock.Lock()
+			mock.closed = false
+			mock.Unlock()
+			return file, nil
+		}
+		file := &lockableFile{file: &mockFile{}}
+		tc.files[fileNum] = file
+		return file, nil
+	}
+	store.deleteFileFunc = func(fileNum uint32) (e error) {
+		if file, ok := tc.files[fileNum]; ok {
+			_ = file.file.Close()
+			delete(tc.files, fileNum)
+			return nil
+		}
+		str := fmt.Sprintf("file %d does not exist", fileNum)
+		return makeDbErr(database.ErrDriverSpecific, str, nil)
+	}
+	tc.store = store
+	// The store does not look inside the blocks, so any bytes will do.
+	for i := 0; i < 16; i++ {
+		b := make([]byte, 200)
+		for j := range b {
+			b[j] = byte(i + j)
+		}
+		tc.blocks = append(tc.blocks, b)
+	}
+	return tc
+}
+
+// checkDbError ensures the passed error is a database.DBError with an error code that matches the passed error code.
+func checkDbError(t *testing.T, testName string, gotErr error, wantErrCode database.ErrorCode) bool {
+	dbErr, ok := gotErr.(database.DBError)
+	if !ok {
+		t.Errorf("%s: unexpected error type - got %T, want %T", testName, gotErr, database.DBError{})
+		return false
+	}
+	if dbErr.ErrorCode != wantErrCode {
+		t.Errorf(
+			"%s: unexpected error code - got %s (%s), want %s", testName, dbErr.ErrorCode, dbErr.Description,
+			wantErrCode,
+		)
+		return false
+	}
+	return true
+}
+
+// TestWriteFailures tests various failures paths when writing to the block files.
+func TestWriteFailures(t *testing.T) {
+	t.Parallel()
+	// Ensure file sync errors return the expected error.
+	tc := newTestContext(t)
+	tc.store.writeCursor.curFile = &lockableFile{file: &mockFile{forceSyncErr: true, maxSize: -1}}
+	if !checkDbError(t, "Sync: file sync failure", tc.store.Sync(), database.ErrDriverSpecific) {
+		return
+	}
+	// Force errors in the various error paths when writing data by using mock files with a limited max size.
+	tests := []struct {
+		fileNum uint32
+		maxSize int64
+	}{
+		// Force an error when writing the network bytes.
+		{fileNum: 0, maxSize: 2},
+		// Force an error when writing the block size.
+		{fileNum: 0, maxSize: 6},
+		// Force an error when writing the block.
+		{fileNum: 0, maxSize: 17},
+		// Force an error when writing the checksum.
+		{fileNum: 0, maxSize: int64(len(tc.blocks[0])) + 10},
+		// Force an error after writing enough blocks for force multiple files.
+		{fileNum: 3, maxSize: 1},
+	}
+	for i, test := range tests {
+		tc := newTestContext(t)
+		tc.maxFileSizes = map[uint32]int64{test.fileNum: test.maxSize}
+		var e error
+		for _, b := range tc.blocks {
+			if _, e = tc.store.WriteBlock(b); e != nil {
+				break
+			}
+		}
+		testName := fmt.Sprintf("WriteBlock failure - test %d, fileNum %d, maxsize %d", i, test.fileNum, test.maxSize)
+		if !checkDbError(t, testName, e, database.ErrDriverSpecific) {
+			return
+		}
+		// Ensure the rollback removed all extra files and data.
+		tc.store.Rollback(0, 0)
+		if len(tc.files) != 1 {
+			t.Errorf("%s: new files not removed - want 1 file, got %d", testName, len(tc.files))
+			return
+		}
+		if _, ok := tc.files[0]; !ok {
+			t.Errorf("%s: file 0 does not exist", testName)
+			return
+		}
+		if file := tc.files[0].file.(*mockFile); len(file.data) != 0 {
+			t.Errorf("%s: file did not truncate - want len 0, got len %d", testName, len(file.data))
+			return
+		}
+		if fileNum, offset := tc.store.WriteCursor(); fileNum != 0 || offset != 0 {
+			t.Errorf("%s: write cursor at file %d, offset %d, want 0, 0", testName, fileNum, offset)
+			return
+		}
+	}
+}
+
+// TestBlockFileErrors ensures the store returns expected errors with various file-related issues such as closed and
+// missing files.
+func TestBlockFileErrors(t *testing.T) {
+	t.Parallel()
+	tc := newTestContext(t)
+	store := tc.store
+	// Ensure errors in blockFile and openFile when requesting invalid file numbers.
+	_, e := store.blockFile(^uint32(0))
+	if !checkDbError(t, "blockFile invalid file open", e, database.ErrDriverSpecific) {
+		return
+	}
+	_, e = store.openFile(^uint32(0))
+	if !checkDbError(t, "openFile invalid file open", e, database.ErrDriverSpecific) {
+		return
+	}
+	loc, e := store.WriteBlock(tc.blocks[0])
+	if e != nil {
+		t.Fatalf("WriteBlock: unexpected error: %v", e)
+	}
+	// Ensure errors in ReadBlock and readBlockRegion when requesting a file number that doesn't exist.
+	hash := chainhash.DoubleHashH(tc.blocks[0])
+	invalidLoc := Location{FileNum: ^uint32(0), Len: 80}
+	_, e = store.ReadBlock(&hash, invalidLoc)
+	if !checkDbError(t, "ReadBlock invalid file number", e, database.ErrDriverSpecific) {
+		return
+	}
+	_, e = store.readBlockRegion(invalidLoc, 0, 80)
+	if !checkDbError(t, "readBlockRegion invalid file number", e, database.ErrDriverSpecific) {
+		return
+	}
+	// Ensure reads fail once the block file has been closed out from under the store.
+	store.writeCursor.curFile.Lock()
+	if e = store.writeCursor.curFile.file.Close(); E.Chk(e) {
+	}
+	store.writeCursor.curFile.Unlock()
+	_, e = store.ReadBlock(&hash, loc)
+	if !checkDbError(t, "ReadBlock closed file", e, database.ErrDriverSpecific) {
+		return
+	}
+	region := database.BlockRegion{Hash: &hash, Offset: 0, Len: 80}
+	_, e = store.ReadBlockRegion(&region, loc)
+	if !checkDbError(t, "ReadBlockRegion closed file", e, database.ErrDriverSpecific) {
+		return
+	}
+	e = store.ReadBlockRegions([]database.BlockRegion{region}, []RegionFetch{{Loc: loc}}, make([][]byte, 1))
+	if !checkDbError(t, "ReadBlockRegions closed file", e, database.ErrDriverSpecific) {
+		return
+	}
+}
+
+// TestCorruption ensures the store returns expected errors under various corruption scenarios.
+func TestCorruption(t *testing.T) {
+	t.Parallel()
+	tc := newTestContext(t)
+	loc, e := tc.store.WriteBlock(tc.blocks[0])
+	if e != nil {
+		t.Fatalf("WriteBlock: unexpected error: %v", e)
+	}
+	hash := chainhash.DoubleHashH(tc.blocks[0])
+	// Ensure corruption is detected by intentionally modifying the bytes stored to the mock file and reading the block.
+	tests := []struct {
+		offset      uint32
+		fixChecksum bool
+		wantErrCode database.ErrorCode
+	}{
+		// One of the network bytes. The checksum needs to be fixed so the invalid network is detected.
+		{2, true, database.ErrDriverSpecific},
+		// The same network byte, but this time don't fix the checksum to ensure the corruption is detected.
+		{2, false, database.ErrCorruption},
+		// One of the block length bytes.
+		{6, false, database.ErrCorruption},
+		// One of the block length bytes, with the checksum fixed so the length is checked against the location.
+		{6, true, database.ErrCorruption},
+		// Random block bytes.
+		{17, false, database.ErrCorruption},
+		{90, false, database.ErrCorruption},
+		// Random checksum byte.
+		{uint32(len(tc.blocks[0])) + 10, false, database.ErrCorruption},
+	}
+	data := tc.files[0].file.(*mockFile).data
+	for i, test := range tests {
+		// Corrupt the byte at the offset by a single bit.
+		data[test.offset] ^= 0x10
+		// Fix the checksum if requested to force other errors.
+		fileLen := len(data)
+		var oldChecksumBytes [4]byte
+		copy(oldChecksumBytes[:], data[fileLen-4:])
+		if test.fixChecksum {
+			binary.BigEndian.PutUint32(data[fileLen-4:], crc32.Checksum(data[:fileLen-4], castagnoli))
+		}
+		_, e = tc.store.ReadBlock(&hash, loc)
+		if !checkDbError(t, fmt.Sprintf("ReadBlock (test #%d): corruption", i), e, test.wantErrCode) {
+			return
+		}
+		// Reset the corrupted data back to the original.
+		data[test.offset] ^= 0x10
+		if test.fixChecksum {
+			copy(data[fileLen-4:], oldChecksumBytes[:])
+		}
+	}
+	if _, e = tc.store.ReadBlock(&hash, loc); e != nil {
+		t.Errorf("ReadBlock: unexpected error after restoring the data: %v", e)
+	}
+}
+
+// TestReconcile ensures block files that run past the write cursor in the metadata are rolled back and block files that
+// end before it are refused unless truncated block files are allowed.
+func TestReconcile(t *testing.T) {
+	t.Parallel()
+	dir, e := os.MkdirTemp("", "flatfile-reconcile-")
+	if e != nil {
+		t.Fatalf("MkdirTemp: unexpected error: %v", e)
+	}
+	defer func() {
+		if e := os.RemoveAll(dir); E.Chk(e) {
+		}
+	}()
+	store := NewStore(dir, testNet, NoCompression)
+	var locs []Location
+	for i := 0; i < 2; i++ {
+		loc, e := store.WriteBlock(make([]byte, 100+i))
+		if e != nil {
+			t.Fatalf("WriteBlock: unexpected error: %v", e)
+		}
+		locs = append(locs, loc)
+	}
+	if e = store.Sync(); E.Chk(e) {
+		t.Fatalf("Sync: unexpected error: %v", e)
+	}
+	store.Close()
+	// The metadata only knows about the first block, so the second one is rolled back.
+	store = NewStore(dir, testNet, NoCompression)
+	if e = store.Reconcile(0, locs[0].Len, false); e != nil {
+		t.Fatalf("Reconcile: unexpected error: %v", e)
+	}
+	if fileNum, offset := store.WriteCursor(); fileNum != 0 || offset != locs[0].Len {
+		t.Fatalf("Reconcile: write cursor at file %d, offset %d, want 0, %d", fileNum, offset, locs[0].Len)
+	}
+	if size := store.FileSize(0); size != uint64(locs[0].Len) {
+		t.Fatalf("Reconcile: block file has %d bytes, want %d", size, locs[0].Len)
+	}
+	store.Close()
+	// The metadata claims a block past the end of the block files.
+	store = NewStore(dir, testNet, NoCompression)
+	defer store.Close()
+	e = store.Reconcile(0, locs[0].Len+locs[1].Len, false)
+	if !checkDbError(t, "Reconcile truncated", e, database.ErrCorruption) {
+		return
+	}
+	if e = store.Reconcile(0, locs[0].Len+locs[1].Len, true); e != nil {
+		t.Fatalf("Reconcile: unexpected error with truncated block files allowed: %v", e)
+	}
+	if _, e = os.Stat(FilePath(dir, 0)); e != nil {
+		t.Fatalf("Stat: unexpected error: %v", e)
+	}
+}
+
+// TestDeferredRemove ensures that block files are only removed once the transactions that began before the removal was
+// asked for have finished, and that the blocks in them can be read until then.
+func TestDeferredRemove(t *testing.T) {
+	tc := newTestContext(t)
+	var locs []Location
+	for i := range tc.blocks {
+		loc, e := tc.store.WriteBlock(tc.blocks[i])
+		if e != nil {
+			t.Fatalf("WriteBlock #%d: unexpected error: %v", i, e)
+		}
+		locs = append(locs, loc)
+	}
+	if locs[len(locs)-1].FileNum < 2 {
+		t.Fatalf("blocks were written to %d block files, not at least 3", locs[len(locs)-1].FileNum+1)
+	}
+	var hash chainhash.Hash
+	first := tc.store.BeginTx()
+	if e := tc.store.RemoveFile(0); e != nil {
+		t.Fatalf("RemoveFile: unexpected error: %v", e)
+	}
+	second := tc.store.BeginTx()
+	if e := tc.store.RemoveFile(1); e != nil {
+		t.Fatalf("RemoveFile: unexpected error: %v", e)
+	}
+	if tc.store.FirstFile() != 2 {
+		t.Errorf("FirstFile: got %d, want 2", tc.store.FirstFile())
+	}
+	if _, ok := tc.files[0]; !ok {
+		t.Errorf("RemoveFile: block file 0 was removed while a transaction could still read it")
+	}
+	if _, e := tc.store.ReadBlock(&hash, locs[0]); e != nil {
+		t.Errorf("ReadBlock: unexpected error reading a block of a file waiting to be removed: %v", e)
+	}
+	tc.store.EndTx(first)
+	if _, ok := tc.files[0]; ok {
+		t.Errorf("EndTx: block file 0 was not removed once the transactions before it finished")
+	}
+	if _, ok := tc.files[1]; !ok {
+		t.Errorf("EndTx: block file 1 was removed while a transaction could still read it")
+	}
+	tc.store.EndTx(second)
+	if _, ok := tc.files[1]; ok {
+		t.Errorf("EndTx: block file 1 was not removed once the transactions before it finished")
+	}
+}
@@ -0,0 +1,88 @@
+package flatfile
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/database"
+)
+
+// CheckBlocks reads back every block in the block index iterated by forEach, checking it lies within its block file and
+// that the length, network and checksum of its record match, and returns the blocks that are damaged. It also returns
+// where the block files end once they are repaired, which is the start of the first of the damaged blocks at the end of
+// the block files if the last block is damaged, and the write cursor otherwise.
+//
+// Closing the interrupt channel stops the check, in which case interrupted is set and the problems found until then
+// are returned.
+func (s *Store) CheckBlocks(forEach ForEachFunc, interrupt <-chan struct{}) (
+	problems []database.BlockProblem,
+	end Location,
+	interrupted bool,
+	e error,
+) {
+	// Read the blocks in the order they are stored in so the block files are read from start to end.
+	var blocks []IndexedBlock
+	if e = forEach(
+		func(k, v []byte) (e error) {
+			var hash chainhash.Hash
+			copy(hash[:], k)
+			if len(v) != LocationSize {
+				problems = append(
+					problems, database.BlockProblem{
+						Hash: hash,
+						Err: makeDbErr(
+							database.ErrCorruption,
+							fmt.Sprintf("block index entry of block %s has %d bytes", hash, len(v)), nil,
+						),
+					},
+				)
+				return nil
+			}
+			blocks = append(blocks, IndexedBlock{Hash: hash, Loc: DeserializeLocation(v)})
+			return nil
+		},
+	); E.Chk(e) {
+		return nil, end, false, e
+	}
+	sort.Slice(
+		blocks, func(i, j int) bool {
+			if blocks[i].Loc.FileNum != blocks[j].Loc.FileNum {
+				return blocks[i].Loc.FileNum < blocks[j].Loc.FileNum
+			}
+			return blocks[i].Loc.Offset < blocks[j].Loc.Offset
+		},
+	)
+	// tail is the index of the first of the damaged blocks at the end of the block files, if the last block is damaged.
+	tail := -1
+	for i := range blocks {
+		if i%10000 == 0 {
+			select {
+			case <-interrupt:
+				return problems, end, true, nil
+			default:
+			}
+			if i > 0 {
+				I.F("checked %d of %d blocks", i, len(blocks))
+			}
+		}
+		if e := s.checkBlock(&blocks[i].Hash, blocks[i].Loc); e != nil {
+			problems = append(problems, database.BlockProblem{Hash: blocks[i].Hash, Err: e})
+			if tail == -1 {
+				tail = i
+			}
+			continue
+		}
+		tail = -1
+	}
+	// The block files are truncated to the start of the damaged blocks at their end, unless the block files already end
+	// before that.
+	end.FileNum, end.Offset = s.WriteCursor()
+	if tail != -1 {
+		start := blocks[tail].Loc
+		if start.FileNum < end.FileNum || (start.FileNum == end.FileNum && start.Offset < end.Offset) {
+			end = Location{FileNum: start.FileNum, Offset: start.Offset}
+		}
+	}
+	return problems, end, false, nil
+}
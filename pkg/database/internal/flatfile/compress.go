@@ -0,0 +1,126 @@
+package flatfile
+
+import (
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+)
+
+// recompressBatchSize is the number of bytes of block records that are moved in each transaction while recompressing a
+// block file, which bounds how long the database write lock is held at a time.
+const recompressBatchSize = 16 * 1024 * 1024
+
+// IndexedBlock is a block in the block index along with its location in the block files at the time it was looked up.
+type IndexedBlock struct {
+	Hash chainhash.Hash
+	Loc  Location
+}
+
+// ForEachFunc calls fn with the key and value of each entry of a block index, which are the hash of a block and its
+// serialized location, such as the ForEach method of the block index bucket of a transaction does.
+type ForEachFunc func(fn func(k, v []byte) error) error
+
+// Recompressor is implemented by the databases that keep their blocks in a Store, so the store can move the blocks of
+// the block files it recompresses.
+type Recompressor interface {
+	// ViewBlockIndex calls fn with the block index of a read-only transaction.
+	ViewBlockIndex(fn func(forEach ForEachFunc) error) error
+	// MoveBlocks writes the passed blocks of a block file that is being recompressed to the end of the block files in
+	// a write transaction, pointing their block index entries at the new location. Blocks that have been pruned or
+	// moved since the block file was scanned are skipped. When last is set the block file is emptied once the
+	// transaction has been committed.
+	MoveBlocks(fileNum uint32, blocks []IndexedBlock, last bool) error
+}
+
+// Recompress moves the blocks stored without compression in the block files older than the current write file to the
+// end of the block files, where they are written compressed, oldest file first, and empties each file once its blocks
+// have been moved. It runs until all of those files have been done or quit is closed.
+func (s *Store) Recompress(r Recompressor, quit <-chan struct{}) {
+	endFileNum, _ := s.WriteCursor()
+	for fileNum := s.FirstFile(); fileNum < endFileNum; fileNum++ {
+		select {
+		case <-quit:
+			return
+		default:
+		}
+		if e := s.recompressFile(r, quit, fileNum); E.Chk(e) {
+			W.F("stopped recompressing block files at file %d: %v", fileNum, e)
+			return
+		}
+	}
+	T.F("block files before file %d are compressed", endFileNum)
+}
+
+// recompressFile moves the blocks in the passed block file to the end of the block files and empties it. Files that only
+// hold compressed blocks are left alone.
+func (s *Store) recompressFile(r Recompressor, quit <-chan struct{}, fileNum uint32) (e error) {
+	var blocks []IndexedBlock
+	var raw bool
+	if e = r.ViewBlockIndex(
+		func(forEach ForEachFunc) (e error) {
+			return forEach(
+				func(k, v []byte) (e error) {
+					loc := DeserializeLocation(v)
+					if loc.FileNum == fileNum {
+						var hash chainhash.Hash
+						copy(hash[:], k)
+						blocks = append(blocks, IndexedBlock{Hash: hash, Loc: loc})
+						raw = raw || !loc.Compressed
+					}
+					return nil
+				},
+			)
+		},
+	); E.Chk(e) {
+		return e
+	}
+	// A file holding no blocks at all only has data that is no longer referenced, which is left over when the file
+	// could not be emptied before.
+	if !raw && (len(blocks) > 0 || s.FileSize(fileNum) == 0) {
+		return nil
+	}
+	// The file is emptied along with the last batch, which is an empty one when the file holds no blocks.
+	for {
+		select {
+		case <-quit:
+			return nil
+		default:
+		}
+		var size uint32
+		n := 0
+		for ; n < len(blocks) && size < recompressBatchSize; n++ {
+			size += blocks[n].Loc.Len
+		}
+		batch := blocks[:n]
+		blocks = blocks[n:]
+		if e = r.MoveBlocks(fileNum, batch, len(blocks) == 0); E.Chk(e) {
+			return e
+		}
+		if len(blocks) == 0 {
+			break
+		}
+	}
+	D.F("recompressed block file %d", fileNum)
+	return nil
+}
+
+// ReadMoved reads the passed blocks of a block file that is being recompressed, for a write transaction to write them
+// again, skipping the blocks whose block index entry, as returned by get, no longer points at the location they were
+// found at.
+func (s *Store) ReadMoved(blocks []IndexedBlock, get func(key []byte) []byte) (
+	moved []*IndexedBlock,
+	blockBytes [][]byte,
+	e error,
+) {
+	for i := range blocks {
+		blockRow := get(blocks[i].Hash[:])
+		if len(blockRow) < LocationSize || DeserializeLocation(blockRow) != blocks[i].Loc {
+			continue
+		}
+		var b []byte
+		if b, e = s.ReadBlock(&blocks[i].Hash, blocks[i].Loc); E.Chk(e) {
+			return nil, nil, e
+		}
+		moved = append(moved, &blocks[i])
+		blockBytes = append(blockBytes, b)
+	}
+	return moved, blockBytes, nil
+}
@@ -0,0 +1,19 @@
+/*Package flatfile implements the flat block files the ffldb and bboltdb drivers store the blocks in, next to the database
+that holds their metadata and block index.
+
+Each block is appended to the current block file as a record of the block network, the block length, the block and a
+checksum, and the location of the record is kept in the block index of the database, which the store does not know
+about. The drivers write the pending blocks of a transaction when it is committed, store their locations along with the
+write cursor, and roll the block files back to the previous write cursor when the commit fails. When the database is
+opened the block files are reconciled with the write cursor in the metadata.
+
+The blocks can be compressed with snappy, in which case the records are marked as compressed, and the blocks in older
+block files that were written without compression can be moved to the end of the block files so the old files can be
+emptied. The store also prunes the oldest block files, checks the block records against the block index, and stages the
+block files for a backup.
+
+Removing and emptying block files is held back until every transaction that began before it was asked for has
+finished, as those can still read the blocks in the files through their older view of the block index. The drivers
+register each transaction with BeginTx before it takes its view and release it with EndTx once it is closed.
+*/
+package flatfile
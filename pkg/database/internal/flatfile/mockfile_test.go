@@ -1,5 +1,5 @@
-// This file is part of the ffldb package rather than the ffldb_test package as it is part of the whitebox testing.
-package ffldb
+// This file is part of the flatfile package rather than the flatfile_test package as it is part of the whitebox testing.
+package flatfile
 
 import (
 	"errors"
@@ -0,0 +1,81 @@
+package flatfile
+
+import (
+	"fmt"
+
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// Compression is the compression applied to the blocks written to the flat block files. It can be passed to the Open
+// and Create functions of the drivers after the block network.
+type Compression uint8
+
+const (
+	// NoCompression writes the blocks as they are serialized, which is the default.
+	NoCompression Compression = iota
+	// SnappyCompression writes the blocks compressed with snappy. Opening a database with it also starts recompressing
+	// the blocks that were written without compression in the background.
+	SnappyCompression
+)
+
+// OpenFlag changes how a database is opened. Flags can be passed to the Open functions of the drivers after the block
+// network.
+type OpenFlag uint8
+
+const (
+	// AllowTruncated opens a database whose block files end before the end of the block data recorded in the
+	// metadata, such as after block files were lost or cut short, which is otherwise refused as corruption. It is meant
+	// for finding and removing the damaged blocks with CheckBlocks. New blocks are written after the block data that is
+	// left.
+	AllowTruncated OpenFlag = 1 << iota
+)
+
+// Options are the optional arguments of the Open and Create functions of the drivers.
+type Options struct {
+	Compression    Compression
+	AllowTruncated bool
+}
+
+// ParseArgs parses the arguments of the Open and Create functions of the driver of the passed type. The database path
+// and block network can be followed by a block compression and open flags, in any order.
+func ParseArgs(dbType, funcName string, args ...interface{}) (string, wire.BitcoinNet, Options, error) {
+	var opts Options
+	if len(args) < 2 {
+		return "", 0, opts, fmt.Errorf(
+			"invalid arguments to %s.%s -- "+
+				"expected database path, block network and optional block compression and open flags", dbType,
+			funcName,
+		)
+	}
+	dbPath, ok := args[0].(string)
+	if !ok {
+		return "", 0, opts, fmt.Errorf(
+			"first argument to %s.%s is invalid -- "+
+				"expected database path string", dbType, funcName,
+		)
+	}
+	network, ok := args[1].(wire.BitcoinNet)
+	if !ok {
+		return "", 0, opts, fmt.Errorf(
+			"second argument to %s.%s is invalid -- "+
+				"expected block network", dbType, funcName,
+		)
+	}
+	for _, arg := range args[2:] {
+		switch arg := arg.(type) {
+		case Compression:
+			if arg > SnappyCompression {
+				return "", 0, opts, fmt.Errorf("unknown block compression %d for %s.%s", arg, dbType, funcName)
+			}
+			opts.Compression = arg
+		case OpenFlag:
+			opts.AllowTruncated = opts.AllowTruncated || arg&AllowTruncated != 0
+		default:
+			return "", 0, opts, fmt.Errorf(
+				"argument %v to %s.%s is invalid -- "+
+					"expected block compression or open flags", arg, dbType, funcName,
+			)
+		}
+	}
+	return dbPath, network, opts, nil
+}
@@ -0,0 +1,69 @@
+package flatfile
+
+import (
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+)
+
+// Prune picks the oldest block files to remove until the total size of the flat block files is no more than the target
+// size, stopping at the first file holding a block that canPrune refuses, and returns them along with the hashes of the
+// blocks they hold, which are to be deleted from the block index iterated by forEach. The current write file is never
+// picked. Every block of the file it stops at is passed to canPrune as well, so the caller learns about all of the
+// blocks that hold pruning back.
+//
+// Files already picked earlier in the same transaction, which are still on disk until it is committed, are passed in
+// pending and skipped.
+func (s *Store) Prune(
+	forEach ForEachFunc, pending []uint32, targetSize uint64,
+	canPrune func(hash *chainhash.Hash) bool,
+) (files []uint32, pruned []chainhash.Hash, e error) {
+	curFileNum, _ := s.WriteCursor()
+	firstFileNum := s.FirstFile()
+	for _, fileNum := range pending {
+		if fileNum >= firstFileNum {
+			firstFileNum = fileNum + 1
+		}
+	}
+	var totalSize uint64
+	for fileNum := firstFileNum; fileNum <= curFileNum; fileNum++ {
+		totalSize += s.FileSize(fileNum)
+	}
+	if totalSize <= targetSize || firstFileNum >= curFileNum {
+		return nil, nil, nil
+	}
+	// Group the blocks in the files that are candidates for removal by the file they are stored in.
+	fileBlocks := make(map[uint32][]chainhash.Hash)
+	e = forEach(
+		func(k, v []byte) (e error) {
+			loc := DeserializeLocation(v)
+			if loc.FileNum >= firstFileNum && loc.FileNum < curFileNum {
+				var hash chainhash.Hash
+				copy(hash[:], k)
+				fileBlocks[loc.FileNum] = append(fileBlocks[loc.FileNum], hash)
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		return nil, nil, e
+	}
+	for fileNum := firstFileNum; fileNum < curFileNum && totalSize > targetSize; fileNum++ {
+		hashes := fileBlocks[fileNum]
+		if canPrune != nil {
+			prunable := true
+			for i := range hashes {
+				if !canPrune(&hashes[i]) {
+					prunable = false
+				}
+			}
+			if !prunable {
+				T.F("block file %d holds blocks that can not be pruned yet", fileNum)
+				break
+			}
+		}
+		pruned = append(pruned, hashes...)
+		files = append(files, fileNum)
+		totalSize -= s.FileSize(fileNum)
+	}
+	T.F("pruned %d blocks, block files now use %d bytes", len(pruned), totalSize)
+	return files, pruned, nil
+}
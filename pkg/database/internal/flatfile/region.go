@@ -0,0 +1,131 @@
+package flatfile
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/p9c/parallelcoin/pkg/database"
+)
+
+// RegionFetch is a block region to be read from the block files, along with the location of its block and the index
+// of the result it is read into.
+type RegionFetch struct {
+	Loc   Location
+	Reply int
+}
+
+// regionFetchSorter sorts a fetch list by file and then offset so that reads from files are grouped and linear.
+type regionFetchSorter []RegionFetch
+
+// Len returns the number of items in the slice.
+//
+// It is part of the sort.Interface implementation.
+func (s regionFetchSorter) Len() int {
+	return len(s)
+}
+
+// Swap swaps the items at the passed indices.
+//
+// It is part of the sort.Interface implementation.
+func (s regionFetchSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Less returns whether the item with index i should sort before the item with index j.
+//
+// It is part of the sort.Interface implementation.
+func (s regionFetchSorter) Less(i, j int) bool {
+	if s[i].Loc.FileNum < s[j].Loc.FileNum {
+		return true
+	}
+	if s[i].Loc.FileNum > s[j].Loc.FileNum {
+		return false
+	}
+	return s[i].Loc.Offset < s[j].Loc.Offset
+}
+
+// CheckRegion returns ErrBlockRegionInvalid if the region exceeds the bounds of the block at the passed location. The
+// bounds of a compressed block are only known once it has been decoded, so its regions are checked when they are read.
+func CheckRegion(region *database.BlockRegion, loc Location) error {
+	if loc.Compressed {
+		return nil
+	}
+	endOffset := region.Offset + region.Len
+	if endOffset < region.Offset || endOffset > loc.DataLen() {
+		str := fmt.Sprintf(
+			"block %s region offset %d, length %d "+
+				"exceeds block length of %d", region.Hash,
+			region.Offset, region.Len, loc.DataLen(),
+		)
+		return makeDbErr(database.ErrBlockRegionInvalid, str, nil)
+	}
+	return nil
+}
+
+// BlockRegion returns the region of the passed serialized block. It returns ErrBlockRegionInvalid if the region exceeds
+// the bounds of the block.
+func BlockRegion(region *database.BlockRegion, blockBytes []byte) ([]byte, error) {
+	// Ensure the region is within the bounds of the block.
+	blockLen := uint32(len(blockBytes))
+	endOffset := region.Offset + region.Len
+	if endOffset < region.Offset || endOffset > blockLen {
+		str := fmt.Sprintf(
+			"block %s region offset %d, length %d "+
+				"exceeds block length of %d", region.Hash,
+			region.Offset, region.Len, blockLen,
+		)
+		return nil, makeDbErr(database.ErrBlockRegionInvalid, str, nil)
+	}
+	return blockBytes[region.Offset:endOffset:endOffset], nil
+}
+
+// ReadBlockRegion reads the region of the block at the passed location. A compressed block has to be read and decoded
+// in full to get at the region.
+//
+// Returns ErrBlockRegionInvalid if the region exceeds the bounds of the block, ErrCorruption if the block data does not
+// match its checksum and ErrDriverSpecific if the data fails to read for any reason.
+func (s *Store) ReadBlockRegion(region *database.BlockRegion, loc Location) ([]byte, error) {
+	if loc.Compressed {
+		blockBytes, e := s.ReadBlock(region.Hash, loc)
+		if e != nil {
+			return nil, e
+		}
+		return BlockRegion(region, blockBytes)
+	}
+	if e := CheckRegion(region, loc); e != nil {
+		return nil, e
+	}
+	return s.readBlockRegion(loc, region.Offset, region.Len)
+}
+
+// ReadBlockRegions reads the regions in the fetch list into the results at their reply index. The regions must have
+// been checked with CheckRegion.
+//
+// The reads are sorted by file and offset first, so that they are grouped by file and linear within each file. The
+// regions of a compressed block are next to each other once sorted, so the last compressed block that was decoded is
+// kept to serve all of them.
+func (s *Store) ReadBlockRegions(regions []database.BlockRegion, fetchList []RegionFetch, results [][]byte) (e error) {
+	sort.Sort(regionFetchSorter(fetchList))
+	var lastLoc *Location
+	var lastBlock []byte
+	for i := range fetchList {
+		fetch := &fetchList[i]
+		region := &regions[fetch.Reply]
+		if fetch.Loc.Compressed {
+			if lastLoc == nil || *lastLoc != fetch.Loc {
+				if lastBlock, e = s.ReadBlock(region.Hash, fetch.Loc); E.Chk(e) {
+					return e
+				}
+				lastLoc = &fetch.Loc
+			}
+			if results[fetch.Reply], e = BlockRegion(region, lastBlock); e != nil {
+				return e
+			}
+			continue
+		}
+		if results[fetch.Reply], e = s.readBlockRegion(fetch.Loc, region.Offset, region.Len); E.Chk(e) {
+			return e
+		}
+	}
+	return nil
+}
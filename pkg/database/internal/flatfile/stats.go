@@ -0,0 +1,79 @@
+package flatfile
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/p9c/parallelcoin/pkg/database"
+)
+
+// Stats holds the statistics the block store keeps of the block files from the time it is opened.
+type Stats struct {
+	// The counters come first so they are 64-bit aligned.
+	//
+	// blocksWritten and bytesWritten count the blocks appended to the block files and the bytes written for them, and
+	// blocksRead and bytesRead the blocks and block regions read back and their bytes.
+	blocksWritten database.Counter
+	bytesWritten  database.Counter
+	blocksRead    database.Counter
+	bytesRead     database.Counter
+	// fileBytesWritten holds the bytes written to each block file that was written to.
+	fileMtx          sync.Mutex
+	fileBytesWritten map[uint32]uint64
+}
+
+// newStats returns statistics with nothing counted yet.
+func newStats() *Stats {
+	return &Stats{fileBytesWritten: make(map[uint32]uint64)}
+}
+
+// wrote counts n bytes written to a block file.
+func (s *Stats) wrote(fileNum uint32, n int) {
+	s.bytesWritten.Add(uint64(n))
+	s.fileMtx.Lock()
+	s.fileBytesWritten[fileNum] += uint64(n)
+	s.fileMtx.Unlock()
+}
+
+// read counts a block or block region of n bytes read from a block file.
+func (s *Stats) read(n int) {
+	s.blocksRead.Inc()
+	s.bytesRead.Add(uint64(n))
+}
+
+// AddStats adds the statistics of the block files to the passed statistics of a database:
+//
+//   - blockfiles.open is the number of block files with an open handle, blockfiles.written_bytes and
+//     blockfiles.read_bytes the bytes written to and read from them, and blockfile.<number>.written_bytes the bytes
+//     written to each file that was written to
+//
+//   - blocks.written and blocks.read count the blocks stored and the blocks and block regions read
+func (s *Store) AddStats(stats database.Stats) {
+	st := s.stats
+	stats.Counters["blocks.written"] = st.blocksWritten.Value()
+	stats.Counters["blocks.read"] = st.blocksRead.Value()
+	stats.Counters["blockfiles.written_bytes"] = st.bytesWritten.Value()
+	stats.Counters["blockfiles.read_bytes"] = st.bytesRead.Value()
+	st.fileMtx.Lock()
+	for fileNum, n := range st.fileBytesWritten {
+		stats.Counters[fmt.Sprintf("blockfile.%d.written_bytes", fileNum)] = n
+	}
+	st.fileMtx.Unlock()
+	stats.Gauges["blockfiles.open"] = int64(s.openFiles())
+}
+
+// openFiles returns the number of block files with an open handle, including the current write file.
+func (s *Store) openFiles() (n int) {
+	s.obfMutex.RLock()
+	n = len(s.openBlockFiles)
+	s.obfMutex.RUnlock()
+	wc := s.writeCursor
+	wc.RLock()
+	wc.curFile.RLock()
+	if wc.curFile.file != nil {
+		n++
+	}
+	wc.curFile.RUnlock()
+	wc.RUnlock()
+	return n
+}
@@ -0,0 +1,99 @@
+package flatfile
+
+// deferredChange is a change to a block file that waits for the transactions that began before it was asked for to
+// finish.
+type deferredChange struct {
+	// gen is the generation of the block files the change was asked for in.
+	gen     uint64
+	fileNum uint32
+	// remove is whether the file is deleted, rather than replaced with an empty file.
+	remove bool
+}
+
+// BeginTx records that a transaction of the database is beginning and returns the generation of the block files it
+// sees, which MUST be passed to EndTx once the transaction has finished. Removing and emptying block files is held back
+// until every transaction that began before it was asked for has finished, so a transaction that is still reading an
+// older view of the block index can read the blocks it refers to.
+//
+// This function MUST be called before the transaction takes its view of the block index.
+func (s *Store) BeginTx() (gen uint64) {
+	s.txMtx.Lock()
+	gen = s.txGen
+	s.openTxs[gen]++
+	s.txMtx.Unlock()
+	return gen
+}
+
+// EndTx records that the transaction that began in the passed generation has finished and makes the changes to the
+// block files that no longer have to wait for it.
+func (s *Store) EndTx(gen uint64) {
+	s.txMtx.Lock()
+	if s.openTxs[gen]--; s.openTxs[gen] <= 0 {
+		delete(s.openTxs, gen)
+	}
+	s.txMtx.Unlock()
+	s.applyDeferred(s.takeDeferred(false))
+}
+
+// deferChange holds back the passed change until the transactions open now have finished, and makes it right away when
+// there are none.
+func (s *Store) deferChange(change deferredChange) {
+	s.txMtx.Lock()
+	change.gen = s.txGen
+	s.txGen++
+	s.deferred = append(s.deferred, change)
+	s.txMtx.Unlock()
+	s.applyDeferred(s.takeDeferred(false))
+}
+
+// takeDeferred removes the deferred changes that no open transaction began before from the queue and returns them, or
+// all of them when all is set.
+func (s *Store) takeDeferred(all bool) (ready []deferredChange) {
+	s.txMtx.Lock()
+	defer s.txMtx.Unlock()
+	oldest := s.txGen
+	for gen := range s.openTxs {
+		if gen < oldest {
+			oldest = gen
+		}
+	}
+	var waiting []deferredChange
+	for _, change := range s.deferred {
+		if all || change.gen < oldest {
+			ready = append(ready, change)
+		} else {
+			waiting = append(waiting, change)
+		}
+	}
+	s.deferred = waiting
+	return ready
+}
+
+// dropDeferred removes the deferred changes to the block files from the passed flat file number on from the queue.
+func (s *Store) dropDeferred(fileNum uint32) {
+	s.txMtx.Lock()
+	defer s.txMtx.Unlock()
+	var waiting []deferredChange
+	for _, change := range s.deferred {
+		if change.fileNum < fileNum {
+			waiting = append(waiting, change)
+		}
+	}
+	s.deferred = waiting
+}
+
+// applyDeferred removes or empties the block files of the passed changes. A failure only leaves data that is no longer
+// referenced on disk, so it is logged and otherwise ignored.
+func (s *Store) applyDeferred(changes []deferredChange) {
+	for _, change := range changes {
+		if change.remove {
+			if e := s.removeFile(change.fileNum); E.Chk(e) {
+				W.F("failed to remove pruned block file %d: %v", change.fileNum, e)
+			}
+			continue
+		}
+		if e := s.emptyFile(change.fileNum); E.Chk(e) {
+			W.F("failed to empty recompressed block file %d: %v", change.fileNum, e)
+		}
+	}
+}
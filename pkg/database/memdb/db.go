@@ -0,0 +1,1193 @@
+package memdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/p9c/parallelcoin/pkg/block"
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/util/treap"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+const (
+	// blockHdrSize is the size of a block header.
+	//
+	// This is simply the constant from wire and is only provided here for convenience since wire.MaxBlockHeaderPayload
+	// is quite long.
+	blockHdrSize = wire.MaxBlockHeaderPayload
+	// blockSeqSize is the size of the sequence number stored in front of each block, which records the order the blocks
+	// were stored in so the oldest can be pruned first.
+	blockSeqSize = 8
+	// valueTag and bucketTag follow the bucket ID in the keys of the metadata treap to tell the key/value pairs of a
+	// bucket from the index entries of its nested buckets.
+	//
+	// The serialized key format is:
+	//
+	//   <bucketid><tag><key>
+	//
+	// The value of a bucket index entry is the ID of the nested bucket. Values sort before buckets, as they do in ffldb.
+	valueTag  = 0x00
+	bucketTag = 0x01
+)
+
+var (
+	// metadataBucketID is the ID of the top-level metadata bucket. It is the value 0 encoded as an unsigned big-endian
+	// uint32.
+	metadataBucketID = [4]byte{}
+)
+
+// Common error strings.
+const (
+	// errDbNotOpenStr is the text to use for the database.ErrDbNotOpen error code.
+	errDbNotOpenStr = "database is not open"
+	// errTxClosedStr is the text to use for the database.ErrTxClosed error code.
+	errTxClosedStr = "database tx is closed"
+)
+
+// makeDbErr creates a database.DBError given a set of arguments.
+func makeDbErr(c database.ErrorCode, desc string, e error) database.DBError {
+	return database.DBError{ErrorCode: c, Description: desc, Err: e}
+}
+
+// copySlice returns a copy of the passed slice.
+//
+// This is used to copy the values passed to Put, as the database keeps them for longer than the transaction, and the
+// keys and values returned by cursors.
+func copySlice(slice []byte) []byte {
+	ret := make([]byte, len(slice))
+	copy(ret, slice)
+	return ret
+}
+
+// metadataKey returns the key used in the metadata treap for a key of the provided bucket ID and tag.
+func metadataKey(bucketID [4]byte, tag byte, key []byte) []byte {
+	mKey := make([]byte, 5+len(key))
+	copy(mKey, bucketID[:])
+	mKey[4] = tag
+	copy(mKey[5:], key)
+	return mKey
+}
+
+// prefixLimit returns the smallest key greater than every key with the passed prefix, for use as the exclusive limit of
+// a treap iterator. It returns nil when there is no such key.
+func prefixLimit(prefix []byte) []byte {
+	limit := copySlice(prefix)
+	for i := len(limit) - 1; i >= 0; i-- {
+		limit[i]++
+		if limit[i] != 0 {
+			return limit[:i+1]
+		}
+	}
+	return nil
+}
+
+// state is the contents of a database at a point in time.
+//
+// The treaps are immutable, so a transaction works on its own copy of the state without affecting any other, and a
+// writable transaction is committed by replacing the state of the database with its copy.
+type state struct {
+	// keys holds the key/value pairs and bucket index entries of all of the metadata buckets.
+	keys *treap.Immutable
+	// blocks maps block hashes to the serialized blocks, each preceded by its big-endian sequence number.
+	blocks *treap.Immutable
+	// lastBucketID is the highest bucket ID in use.
+	lastBucketID uint32
+	// nextBlockSeq is the sequence number of the next block to be stored.
+	nextBlockSeq uint64
+	// blocksSize is the total size of the serialized blocks.
+	blocksSize uint64
+	// pruned is whether any blocks have been removed by PruneBlocks.
+	pruned bool
+}
+
+// cursor is an internal type used to represent a cursor over key/value pairs and nested buckets of a bucket and
+// implements the database.Cursor interface.
+//
+// The cursor iterates the state of the transaction as it was when the cursor was last positioned with First, Last or
+// Seek, so changes made by the transaction are visible once the cursor is positioned again.
+type cursor struct {
+	bucket *bucket
+	prefix []byte
+	iter   *treap.Iterator
+}
+
+// Enforce cursor implements the database.Cursor interface.
+var _ database.Cursor = (*cursor)(nil)
+
+// Bucket returns the bucket the cursor was created for.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Bucket() database.Bucket {
+	// Ensure transaction state is valid.
+	if e := c.bucket.tx.checkClosed(); E.Chk(e) {
+		return nil
+	}
+	return c.bucket
+}
+
+// Delete removes the current key/value pair the cursor is at without invalidating the cursor.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrIncompatibleValue if attempted when the cursor points to a nested bucket
+//
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Delete() (e error) {
+	// Ensure transaction state is valid.
+	if e = c.bucket.tx.checkClosed(); E.Chk(e) {
+		return e
+	}
+	// Ensure the transaction is writable.
+	if !c.bucket.tx.writable {
+		str := "deleting a value requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	// DBError if the cursor is exhausted.
+	if c.iter == nil || !c.iter.Valid() {
+		str := "cursor is exhausted"
+		return makeDbErr(database.ErrIncompatibleValue, str, nil)
+	}
+	// Do not allow buckets to be deleted via the cursor.
+	key := c.iter.Key()
+	if key[4] == bucketTag {
+		str := "buckets may not be deleted from a cursor"
+		return makeDbErr(database.ErrIncompatibleValue, str, nil)
+	}
+	c.bucket.tx.deleteKey(key)
+	return nil
+}
+
+// reset replaces the iterator of the cursor with one over the current state of the transaction.
+func (c *cursor) reset() {
+	c.iter = c.bucket.tx.state.keys.Iterator(c.prefix, prefixLimit(c.prefix))
+}
+
+// First positions the cursor at the first key/value pair and returns whether or not the pair exists.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) First() bool {
+	// Ensure transaction state is valid.
+	if e := c.bucket.tx.checkClosed(); E.Chk(e) {
+		return false
+	}
+	c.reset()
+	return c.iter.First()
+}
+
+// Last positions the cursor at the last key/value pair and returns whether or not the pair exists.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Last() bool {
+	// Ensure transaction state is valid.
+	if e := c.bucket.tx.checkClosed(); E.Chk(e) {
+		return false
+	}
+	c.reset()
+	return c.iter.Last()
+}
+
+// Next moves the cursor one key/value pair forward and returns whether or not the pair exists.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Next() bool {
+	// Ensure transaction state is valid.
+	if e := c.bucket.tx.checkClosed(); E.Chk(e) {
+		return false
+	}
+	// Nothing to return if cursor is exhausted.
+	if c.iter == nil || !c.iter.Valid() {
+		return false
+	}
+	return c.iter.Next()
+}
+
+// Prev moves the cursor one key/value pair backward and returns whether or not the pair exists.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Prev() bool {
+	// Ensure transaction state is valid.
+	if e := c.bucket.tx.checkClosed(); E.Chk(e) {
+		return false
+	}
+	// Nothing to return if cursor is exhausted.
+	if c.iter == nil || !c.iter.Valid() {
+		return false
+	}
+	return c.iter.Prev()
+}
+
+// Seek positions the cursor at the first key/value pair that is greater than or equal to the passed seek key.
+//
+// Returns false if no suitable key was found.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Seek(seek []byte) bool {
+	// Ensure transaction state is valid.
+	if e := c.bucket.tx.checkClosed(); E.Chk(e) {
+		return false
+	}
+	c.reset()
+	// Nested buckets sort after all of the values, so seeking within the values also finds the buckets after them.
+	return c.iter.Seek(metadataKey(c.bucket.id, valueTag, seek))
+}
+
+// Key returns the current key the cursor is pointing to.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Key() []byte {
+	// Ensure transaction state is valid.
+	if e := c.bucket.tx.checkClosed(); E.Chk(e) {
+		return nil
+	}
+	// Nothing to return if cursor is exhausted.
+	if c.iter == nil || !c.iter.Valid() {
+		return nil
+	}
+	// The key is after the bucket ID and tag for both values and nested buckets.
+	return copySlice(c.iter.Key()[5:])
+}
+
+// Value returns the current value the cursor is pointing to.
+//
+// This will be nil for nested buckets.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Value() []byte {
+	// Ensure transaction state is valid.
+	if e := c.bucket.tx.checkClosed(); E.Chk(e) {
+		return nil
+	}
+	// Nothing to return if cursor is exhausted.
+	if c.iter == nil || !c.iter.Valid() {
+		return nil
+	}
+	// Return nil for the value when the cursor is pointing to a nested bucket.
+	if c.iter.Key()[4] == bucketTag {
+		return nil
+	}
+	return copySlice(c.iter.Value())
+}
+
+// bucket is an internal type used to represent a collection of key/value pairs and implements the database.Bucket
+// interface.
+type bucket struct {
+	tx *transaction
+	id [4]byte
+}
+
+// Enforce bucket implements the database.Bucket interface.
+var _ database.Bucket = (*bucket)(nil)
+
+// Bucket retrieves a nested bucket with the given key.
+//
+// Returns nil if the bucket does not exist.
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Bucket(key []byte) database.Bucket {
+	// Ensure transaction state is valid.
+	if e := b.tx.checkClosed(); E.Chk(e) {
+		return nil
+	}
+	// Attempt to fetch the ID for the child bucket. The bucket does not exist if the bucket index entry does not exist.
+	childID := b.tx.state.keys.Get(metadataKey(b.id, bucketTag, key))
+	if childID == nil {
+		return nil
+	}
+	childBucket := &bucket{tx: b.tx}
+	copy(childBucket.id[:], childID)
+	return childBucket
+}
+
+// CreateBucket creates and returns a new nested bucket with the given key.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBucketExists if the bucket already exists
+//
+//   - ErrBucketNameRequired if the key is empty
+//
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) CreateBucket(key []byte) (database.Bucket, error) {
+	// Ensure transaction state is valid.
+	if e := b.tx.checkClosed(); E.Chk(e) {
+		return nil, e
+	}
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "create bucket requires a writable database transaction"
+		return nil, makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	// Ensure a key was provided.
+	if len(key) == 0 {
+		str := "create bucket requires a key"
+		return nil, makeDbErr(database.ErrBucketNameRequired, str, nil)
+	}
+	// Ensure bucket does not already exist.
+	bidxKey := metadataKey(b.id, bucketTag, key)
+	if b.tx.state.keys.Has(bidxKey) {
+		str := "bucket already exists"
+		return nil, makeDbErr(database.ErrBucketExists, str, nil)
+	}
+	// Add the new bucket to the bucket index with the next bucket ID.
+	b.tx.state.lastBucketID++
+	var childID [4]byte
+	binary.BigEndian.PutUint32(childID[:], b.tx.state.lastBucketID)
+	b.tx.state.keys = b.tx.state.keys.Put(bidxKey, childID[:])
+	return &bucket{tx: b.tx, id: childID}, nil
+}
+
+// CreateBucketIfNotExists creates and returns a new nested bucket with the given key if it does not already exist.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBucketNameRequired if the key is empty
+//
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) CreateBucketIfNotExists(key []byte) (database.Bucket, error) {
+	// Ensure transaction state is valid.
+	if e := b.tx.checkClosed(); E.Chk(e) {
+		return nil, e
+	}
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "create bucket requires a writable database transaction"
+		return nil, makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	// Return existing bucket if it already exists, otherwise create it.
+	if bucket := b.Bucket(key); bucket != nil {
+		return bucket, nil
+	}
+	return b.CreateBucket(key)
+}
+
+// DeleteBucket removes a nested bucket with the given key.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBucketNotFound if the specified bucket does not exist
+//
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) DeleteBucket(key []byte) (e error) {
+	// Ensure transaction state is valid.
+	if e = b.tx.checkClosed(); E.Chk(e) {
+		return e
+	}
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "delete bucket requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	// Attempt to fetch the ID for the child bucket. The bucket does not exist if the bucket index entry does not exist.
+	bidxKey := metadataKey(b.id, bucketTag, key)
+	childID := b.tx.state.keys.Get(bidxKey)
+	if childID == nil {
+		str := fmt.Sprintf("bucket %q does not exist", key)
+		return makeDbErr(database.ErrBucketNotFound, str, nil)
+	}
+	// Remove all nested buckets and their keys. The iterators are over the state before the deletions, which is not
+	// changed by them.
+	childIDs := [][]byte{childID}
+	for len(childIDs) > 0 {
+		childID = childIDs[len(childIDs)-1]
+		childIDs = childIDs[:len(childIDs)-1]
+		iter := b.tx.state.keys.Iterator(childID, prefixLimit(childID))
+		for ok := iter.First(); ok; ok = iter.Next() {
+			// Push the id of any nested bucket onto the stack for the next iteration.
+			if iter.Key()[4] == bucketTag {
+				childIDs = append(childIDs, iter.Value())
+			}
+			b.tx.deleteKey(iter.Key())
+		}
+	}
+	// Remove the nested bucket from the bucket index. Any buckets nested under it were already removed above.
+	b.tx.deleteKey(bidxKey)
+	return nil
+}
+
+// Cursor returns a new cursor, allowing for iteration over the bucket's key/value pairs and nested buckets in forward
+// or backward order.
+//
+// You must seek to a position using the First, Last, or Seek functions before calling the Next, Prev, Key, or Value
+// functions. Failure to do so will result in the same return values as an exhausted cursor, which is false for the Prev
+// and Next functions and nil for Key and Value functions.
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Cursor() database.Cursor {
+	return &cursor{bucket: b, prefix: b.id[:]}
+}
+
+// ForEach invokes the passed function with every key/value pair in the bucket. This does not include nested buckets or
+// the key/value pairs within those nested buckets.
+//
+// Changes made to the bucket by the passed function are not seen by the iteration.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) ForEach(fn func(k, v []byte) error) (e error) {
+	// Ensure transaction state is valid.
+	if e = b.tx.checkClosed(); E.Chk(e) {
+		return e
+	}
+	// Invoke the callback for each value. Return the error returned from the callback when it is non-nil.
+	prefix := metadataKey(b.id, valueTag, nil)
+	iter := b.tx.state.keys.Iterator(prefix, prefixLimit(prefix))
+	for ok := iter.First(); ok; ok = iter.Next() {
+		if e = fn(iter.Key()[5:], iter.Value()); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// ForEachBucket invokes the passed function with the key of every nested bucket in the current bucket.
+//
+// This does not include any nested buckets within those nested buckets.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) ForEachBucket(fn func(k []byte) error) (e error) {
+	// Ensure transaction state is valid.
+	if e = b.tx.checkClosed(); E.Chk(e) {
+		return e
+	}
+	// Invoke the callback for each nested bucket. Return the error returned from the callback when it is non-nil.
+	prefix := metadataKey(b.id, bucketTag, nil)
+	iter := b.tx.state.keys.Iterator(prefix, prefixLimit(prefix))
+	for ok := iter.First(); ok; ok = iter.Next() {
+		if e = fn(iter.Key()[5:]); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// Writable returns whether or not the bucket is writable.
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Writable() bool {
+	return b.tx.writable
+}
+
+// Put saves the specified key/value pair to the bucket.
+//
+// Keys that do not already exist are added and keys that already exist are overwritten.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrKeyRequired if the key is empty
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Put(key, value []byte) (e error) {
+	// Ensure transaction state is valid.
+	if e = b.tx.checkClosed(); E.Chk(e) {
+		return e
+	}
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "setting a key requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	// Ensure a key was provided.
+	if len(key) == 0 {
+		str := "put requires a key"
+		return makeDbErr(database.ErrKeyRequired, str, nil)
+	}
+	b.tx.state.keys = b.tx.state.keys.Put(metadataKey(b.id, valueTag, key), copySlice(value))
+	return nil
+}
+
+// Get returns the value for the given key.
+//
+// Returns nil if the key does not exist in this bucket.
+//
+// An empty slice is returned for keys that exist but have no value assigned.
+//
+// NOTE: The value returned by this function must NOT be modified by the caller.
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Get(key []byte) []byte {
+	// Ensure transaction state is valid.
+	if e := b.tx.checkClosed(); E.Chk(e) {
+		return nil
+	}
+	// Nothing to return if there is no key.
+	if len(key) == 0 {
+		return nil
+	}
+	return b.tx.state.keys.Get(metadataKey(b.id, valueTag, key))
+}
+
+// Delete removes the specified key from the bucket.
+//
+// Deleting a key that does not exist does not return an error.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Delete(key []byte) (e error) {
+	// Ensure transaction state is valid.
+	if e = b.tx.checkClosed(); E.Chk(e) {
+		return e
+	}
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "deleting a value requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	// Nothing to do if there is no key.
+	if len(key) == 0 {
+		return nil
+	}
+	b.tx.deleteKey(metadataKey(b.id, valueTag, key))
+	return nil
+}
+
+// transaction represents a database transaction.
+//
+// It can either be read-only or read-write and implements the database.Tx interface. A read-write transaction makes
+// its changes to its own copy of the state of the database, which replaces the state of the database on commit and is
+// discarded on rollback.
+type transaction struct {
+	managed    bool    // Is the transaction managed?
+	closed     bool    // Is the transaction closed?
+	writable   bool    // Is the transaction writable?
+	db         *db     // DB instance the tx was created from.
+	state      state   // The state of the database as seen by the transaction.
+	metaBucket *bucket // The root metadata bucket.
+}
+
+// Enforce transaction implements the database.Tx interface.
+var _ database.Tx = (*transaction)(nil)
+
+// checkClosed returns an error if the the database or transaction is closed.
+func (tx *transaction) checkClosed() (e error) {
+	// The transaction is no longer valid if it has been closed.
+	if tx.closed {
+		return makeDbErr(database.ErrTxClosed, errTxClosedStr, nil)
+	}
+	return nil
+}
+
+// deleteKey removes the provided key from the metadata of the transaction.
+//
+// NOTE: This function must only be called on a writable transaction.
+//
+// Since it is an internal helper function, it does not check.
+func (tx *transaction) deleteKey(key []byte) {
+	tx.state.keys = tx.state.keys.Delete(key)
+}
+
+// Metadata returns the top-most bucket for all metadata storage.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) Metadata() database.Bucket {
+	return tx.metaBucket
+}
+
+// StoreBlock stores the provided block into the database.
+//
+// There are no checks to ensure the block connects to a previous block, contains double spends, or any additional
+// functionality such as transaction indexing.
+//
+// It simply stores the block in the database.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBlockExists when the block hash already exists
+//
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) StoreBlock(block *block.Block) (e error) {
+	// Ensure transaction state is valid.
+	if e = tx.checkClosed(); E.Chk(e) {
+		return e
+	}
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "store block requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	// Reject the block if it already exists.
+	blockHash := block.Hash()
+	if tx.state.blocks.Has(blockHash[:]) {
+		str := fmt.Sprintf("block %s already exists", blockHash)
+		return makeDbErr(database.ErrBlockExists, str, nil)
+	}
+	blockBytes, e := block.Bytes()
+	if e != nil {
+		str := fmt.Sprintf(
+			"failed to get serialized bytes for block %s",
+			blockHash,
+		)
+		return makeDbErr(database.ErrDriverSpecific, str, e)
+	}
+	// Store the block after its sequence number.
+	row := make([]byte, blockSeqSize+len(blockBytes))
+	binary.BigEndian.PutUint64(row, tx.state.nextBlockSeq)
+	copy(row[blockSeqSize:], blockBytes)
+	tx.state.blocks = tx.state.blocks.Put(blockHash[:], row)
+	tx.state.nextBlockSeq++
+	tx.state.blocksSize += uint64(len(blockBytes))
+	return nil
+}
+
+// HasBlock returns whether or not a block with the given hash exists in the database.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) HasBlock(hash *chainhash.Hash) (bool, error) {
+	// Ensure transaction state is valid.
+	if e := tx.checkClosed(); E.Chk(e) {
+		return false, e
+	}
+	return tx.state.blocks.Has(hash[:]), nil
+}
+
+// HasBlocks returns whether or not the blocks with the provided hashes exist in the database.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) HasBlocks(hashes []chainhash.Hash) ([]bool, error) {
+	// Ensure transaction state is valid.
+	if e := tx.checkClosed(); E.Chk(e) {
+		return nil, e
+	}
+	results := make([]bool, len(hashes))
+	for i := range hashes {
+		results[i] = tx.state.blocks.Has(hashes[i][:])
+	}
+	return results, nil
+}
+
+// fetchBlock returns the serialized block for the provided hash. It will return ErrBlockNotFound if there is no such
+// block.
+func (tx *transaction) fetchBlock(hash *chainhash.Hash) ([]byte, error) {
+	row := tx.state.blocks.Get(hash[:])
+	if row == nil {
+		str := fmt.Sprintf("block %s does not exist", hash)
+		return nil, makeDbErr(database.ErrBlockNotFound, str, nil)
+	}
+	return row[blockSeqSize:], nil
+}
+
+// FetchBlockHeader returns the raw serialized bytes for the block header identified by the given hash.
+//
+// The raw bytes are in the format returned by Serialize on a wire.BlockHeader.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBlockNotFound if the requested block hash does not exist
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// NOTE: The data returned by this function must NOT be modified by the caller.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlockHeader(hash *chainhash.Hash) ([]byte, error) {
+	return tx.FetchBlockRegion(
+		&database.BlockRegion{
+			Hash:   hash,
+			Offset: 0,
+			Len:    blockHdrSize,
+		},
+	)
+}
+
+// FetchBlockHeaders returns the raw serialized bytes for the block headers identified by the given hashes.
+//
+// The raw bytes are in the format returned by Serialize on a wire.BlockHeader.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBlockNotFound if the any of the requested block hashes do not exist
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// NOTE: The data returned by this function must NOT be modified by the caller.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlockHeaders(hashes []chainhash.Hash) ([][]byte, error) {
+	regions := make([]database.BlockRegion, len(hashes))
+	for i := range hashes {
+		regions[i].Hash = &hashes[i]
+		regions[i].Offset = 0
+		regions[i].Len = blockHdrSize
+	}
+	return tx.FetchBlockRegions(regions)
+}
+
+// FetchBlock returns the raw serialized bytes for the block identified by the given hash. The raw bytes are in the
+// format returned by Serialize on a wire.Block.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBlockNotFound if the requested block hash does not exist
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// NOTE: The data returned by this function must NOT be modified by the caller.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlock(hash *chainhash.Hash) ([]byte, error) {
+	// Ensure transaction state is valid.
+	if e := tx.checkClosed(); E.Chk(e) {
+		return nil, e
+	}
+	return tx.fetchBlock(hash)
+}
+
+// FetchBlocks returns the raw serialized bytes for the blocks identified by the given hashes.
+//
+// The raw bytes are in the format returned by Serialize on a wire.Block.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBlockNotFound if any of the requested block hashed do not exist
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// NOTE: The data returned by this function must NOT be modified by the caller.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlocks(hashes []chainhash.Hash) ([][]byte, error) {
+	// Ensure transaction state is valid.
+	if e := tx.checkClosed(); E.Chk(e) {
+		return nil, e
+	}
+	blocks := make([][]byte, len(hashes))
+	for i := range hashes {
+		var e error
+		if blocks[i], e = tx.fetchBlock(&hashes[i]); e != nil {
+			return nil, e
+		}
+	}
+	return blocks, nil
+}
+
+// fetchRegion returns the provided region of a block, after checking it is within the bounds of the block.
+func (tx *transaction) fetchRegion(region *database.BlockRegion) ([]byte, error) {
+	blockBytes, e := tx.fetchBlock(region.Hash)
+	if e != nil {
+		return nil, e
+	}
+	// Ensure the region is within the bounds of the block.
+	blockLen := uint32(len(blockBytes))
+	endOffset := region.Offset + region.Len
+	if endOffset < region.Offset || endOffset > blockLen {
+		str := fmt.Sprintf(
+			"block %s region offset %d, length %d "+
+				"exceeds block length of %d", region.Hash,
+			region.Offset, region.Len, blockLen,
+		)
+		return nil, makeDbErr(database.ErrBlockRegionInvalid, str, nil)
+	}
+	return blockBytes[region.Offset:endOffset:endOffset], nil
+}
+
+// FetchBlockRegion returns the raw serialized bytes for the given block region.
+//
+// The raw bytes are in the format returned by Serialize on a wire.Block and the Offset field in the provided
+// BlockRegion is zero-based and relative to the start of the block (byte 0).
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBlockNotFound if the requested block hash does not exist
+//
+//   - ErrBlockRegionInvalid if the region exceeds the bounds of the associated block
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// NOTE: The data returned by this function must NOT be modified by the caller.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlockRegion(region *database.BlockRegion) ([]byte, error) {
+	// Ensure transaction state is valid.
+	if e := tx.checkClosed(); E.Chk(e) {
+		return nil, e
+	}
+	return tx.fetchRegion(region)
+}
+
+// FetchBlockRegions returns the raw serialized bytes for the given block regions.
+//
+// The raw bytes are in the format returned by Serialize on a wire.Block and the Offset fields in the provided
+// BlockRegions are zero-based and relative to the start of the block (byte 0).
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrBlockNotFound if any of the request block hashes do not exist
+//
+//   - ErrBlockRegionInvalid if one or more region exceed the bounds of the associated block
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// NOTE: The data returned by this function must NOT be modified by the caller.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlockRegions(regions []database.BlockRegion) ([][]byte, error) {
+	// Ensure transaction state is valid.
+	if e := tx.checkClosed(); E.Chk(e) {
+		return nil, e
+	}
+	blockRegions := make([][]byte, len(regions))
+	for i := range regions {
+		var e error
+		if blockRegions[i], e = tx.fetchRegion(&regions[i]); e != nil {
+			return nil, e
+		}
+	}
+	return blockRegions, nil
+}
+
+// PruneBlocks removes the oldest blocks until the total size of the stored blocks is no more than the target size,
+// stopping at the first block that canPrune refuses, and returns the hashes of the removed blocks.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) PruneBlocks(targetSize uint64, canPrune func(hash *chainhash.Hash) bool) (
+	pruned []chainhash.Hash,
+	e error,
+) {
+	// Ensure transaction state is valid.
+	if e = tx.checkClosed(); E.Chk(e) {
+		return nil, e
+	}
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "prune blocks requires a writable database transaction"
+		return nil, makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	if tx.state.blocksSize <= targetSize {
+		return nil, nil
+	}
+	// Order the blocks by the sequence they were stored in.
+	type storedBlock struct {
+		seq  uint64
+		hash chainhash.Hash
+		size uint64
+	}
+	stored := make([]storedBlock, 0, tx.state.blocks.Len())
+	tx.state.blocks.ForEach(
+		func(k, v []byte) bool {
+			sb := storedBlock{seq: binary.BigEndian.Uint64(v), size: uint64(len(v) - blockSeqSize)}
+			copy(sb.hash[:], k)
+			stored = append(stored, sb)
+			return true
+		},
+	)
+	sort.Slice(stored, func(i, j int) bool { return stored[i].seq < stored[j].seq })
+	for i := 0; i < len(stored) && tx.state.blocksSize > targetSize; i++ {
+		hash := &stored[i].hash
+		if canPrune != nil && !canPrune(hash) {
+			T.F("block %v can not be pruned yet", hash)
+			break
+		}
+		tx.state.blocks = tx.state.blocks.Delete(hash[:])
+		tx.state.blocksSize -= stored[i].size
+		tx.state.pruned = true
+		pruned = append(pruned, *hash)
+	}
+	T.F("pruned %d blocks, blocks now use %d bytes", len(pruned), tx.state.blocksSize)
+	return pruned, nil
+}
+
+// BeenPruned returns whether or not any blocks have been removed from the database by PruneBlocks.
+//
+// Returns the following errors as required by the interface contract:
+//
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) BeenPruned() (bool, error) {
+	// Ensure transaction state is valid.
+	if e := tx.checkClosed(); E.Chk(e) {
+		return false, e
+	}
+	return tx.state.pruned, nil
+}
+
+// close marks the transaction closed then releases its state, the transaction read lock, and the write lock when the
+// transaction is writable.
+func (tx *transaction) close() {
+	tx.closed = true
+	tx.state = state{}
+	tx.db.closeLock.RUnlock()
+	// Release the writer lock for writable transactions to unblock any other write transaction which are possibly
+	// waiting.
+	if tx.writable {
+		tx.db.writeLock.Unlock()
+	}
+}
+
+// Commit replaces the state of the database with the state of the transaction, making all of the changes made by the
+// transaction visible to transactions started after it.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) Commit() (e error) {
+	// Prevent commits on managed transactions.
+	if tx.managed {
+		tx.close()
+		panic("managed transaction commit not allowed")
+	}
+	// Ensure transaction state is valid.
+	if e = tx.checkClosed(); E.Chk(e) {
+		return e
+	}
+	// Regardless of whether the commit succeeds, the transaction is closed on return.
+	defer tx.close()
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "Commit requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+	tx.db.stateLock.Lock()
+	tx.db.state = tx.state
+	tx.db.stateLock.Unlock()
+	return nil
+}
+
+// Rollback undoes all changes that have been made to the root bucket and all of its sub-buckets.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) Rollback() (e error) {
+	// Prevent rollbacks on managed transactions.
+	if tx.managed {
+		tx.close()
+		panic("managed transaction rollback not allowed")
+	}
+	// Ensure transaction state is valid.
+	if e = tx.checkClosed(); E.Chk(e) {
+		return e
+	}
+	tx.close()
+	return nil
+}
+
+// db represents a collection of namespaces which are kept in memory and implements the database.DB interface. All
+// database access is performed through transactions which are obtained through the specific Namespace.
+type db struct {
+	writeLock sync.Mutex   // Limit to one write transaction at a time.
+	closeLock sync.RWMutex // Make database close block while txns active.
+	closed    bool         // Is the database closed?
+	stateLock sync.RWMutex // Protects the state from commits while transactions begin.
+	state     state        // The committed contents of the database.
+}
+
+// Enforce db implements the database.DB interface.
+var _ database.DB = (*db)(nil)
+
+// Type returns the database driver type the current database instance was created with.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Type() string {
+	return dbType
+}
+
+// begin is the implementation function for the Begin database method.
+//
+// See its documentation for more details.
+//
+// This function is only separate because it returns the internal transaction which is used by the managed transaction
+// code while the database method returns the interface.
+func (db *db) begin(writable bool) (*transaction, error) {
+	// Whenever a new writable transaction is started, grab the write lock to ensure only a single write transaction can
+	// be active at the same time.
+	//
+	// This lock will not be released until the transaction is closed (via Rollback or Commit).
+	if writable {
+		db.writeLock.Lock()
+	}
+	// Whenever a new transaction is started, grab a read lock against the database to ensure Close will wait for the
+	// transaction to finish.
+	//
+	// This lock will not be released until the transaction is closed (via Rollback or Commit).
+	db.closeLock.RLock()
+	if db.closed {
+		db.closeLock.RUnlock()
+		if writable {
+			db.writeLock.Unlock()
+		}
+		return nil, makeDbErr(
+			database.ErrDbNotOpen, errDbNotOpenStr,
+			nil,
+		)
+	}
+	// The state is immutable, so a copy of it is a snapshot of the database.
+	db.stateLock.RLock()
+	tx := &transaction{
+		writable: writable,
+		db:       db,
+		state:    db.state,
+	}
+	db.stateLock.RUnlock()
+	tx.metaBucket = &bucket{tx: tx, id: metadataBucketID}
+	return tx, nil
+}
+
+// Begin starts a transaction which is either read-only or read-write depending on the specified flag.
+//
+// Multiple read-only transactions can be started simultaneously while only a single read-write transaction can be
+// started at a time.
+//
+// The call will block when starting a read-write transaction when one is already open.
+//
+// NOTE: The transaction must be closed by calling Rollback or Commit on it when it is no longer needed.
+//
+// Failure to do so will result in unclaimed memory.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Begin(writable bool) (database.Tx, error) {
+	return db.begin(writable)
+}
+
+// rollbackOnPanic rolls the passed transaction back if the code in the calling function panics. This is needed since
+// the mutex on a transaction must be released and a panic in called code would prevent that from happening.
+func rollbackOnPanic(tx *transaction) {
+	if err := recover(); err != nil {
+		tx.managed = false
+		_ = tx.Rollback()
+		panic(err)
+	}
+}
+
+// View invokes the passed function in the context of a managed read-only transaction with the root bucket for the
+// namespace.
+//
+// Any errors returned from the user-supplied function are returned from this function.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) View(fn func(database.Tx) error) (e error) {
+	// Start a read-only transaction.
+	tx, e := db.begin(false)
+	if e != nil {
+		return e
+	}
+	// Since the user-provided function might panic, ensure the transaction releases all mutexes and resources.
+	defer rollbackOnPanic(tx)
+	tx.managed = true
+	e = fn(tx)
+	tx.managed = false
+	if e != nil {
+		// The error is ignored here because nothing was written yet and regardless of a rollback failure, the tx is
+		// closed now anyways.
+		_ = tx.Rollback()
+		return e
+	}
+	return tx.Rollback()
+}
+
+// Update invokes the passed function in the context of a managed read-write transaction with the root bucket for the
+// namespace.
+//
+// Any errors returned from the user-supplied function will cause the transaction to be rolled back and are returned
+// from this function.
+//
+// Otherwise, the transaction is committed when the user-supplied function returns a nil error.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Update(fn func(database.Tx) error) (e error) {
+	// Start a read-write transaction.
+	tx, e := db.begin(true)
+	if e != nil {
+		return e
+	}
+	// Since the user-provided function might panic, ensure the transaction releases all mutexes and resources.
+	defer rollbackOnPanic(tx)
+	tx.managed = true
+	e = fn(tx)
+	tx.managed = false
+	if e != nil {
+		// The error is ignored here because nothing was written yet and regardless of a rollback failure, the tx is
+		// closed now anyways.
+		_ = tx.Rollback()
+		return e
+	}
+	return tx.Commit()
+}
+
+// Backup returns an error since the database only lives in memory, so there is nothing a backup could be opened from.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Backup(dest string) (e error) {
+	db.closeLock.RLock()
+	defer db.closeLock.RUnlock()
+	if db.closed {
+		return makeDbErr(database.ErrDbNotOpen, errDbNotOpenStr, nil)
+	}
+	str := fmt.Sprintf("%s databases are kept in memory and can not be backed up to %q", dbType, dest)
+	return makeDbErr(database.ErrDriverSpecific, str, nil)
+}
+
+// Close shuts down the database and releases its contents.
+//
+// It will block until all database transactions have been finalized (rolled back or committed).
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Close() (e error) {
+	// Since all transactions have a read lock on this mutex, this will cause Close to wait for all readers to complete.
+	db.closeLock.Lock()
+	defer db.closeLock.Unlock()
+	if db.closed {
+		return makeDbErr(database.ErrDbNotOpen, errDbNotOpenStr, nil)
+	}
+	db.closed = true
+	db.stateLock.Lock()
+	db.state = state{}
+	db.stateLock.Unlock()
+	return nil
+}
+
+// newDB returns a new empty database.
+func newDB() *db {
+	return &db{
+		state: state{
+			keys:   treap.NewImmutable(),
+			blocks: treap.NewImmutable(),
+		},
+	}
+}
@@ -0,0 +1,20 @@
+/*Package memdb implements a driver for the database package that keeps the metadata and blocks in memory.
+
+Nothing is written to disk, so the contents of a database are lost when it is closed. This makes it suited to tests and
+to throwaway nodes, such as a regression test node, that do not need to keep their chain between runs.
+
+Usage
+
+This package is a driver to the database package and provides the database type of "memdb". The Create function takes
+either no parameters, or the database path and block network that ffldb takes, which are ignored so memdb can be
+selected in place of ffldb without changing the caller:
+
+	db, e := database.Create("memdb")
+	if e != nil  {
+		// Handle error
+	}
+
+As there is nothing to open, Open always returns an error with the ErrDbDoesNotExist code, so callers that fall back to
+Create when a database does not exist get a new empty database.
+*/
+package memdb
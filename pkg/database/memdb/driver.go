@@ -0,0 +1,76 @@
+package memdb
+
+import (
+	"fmt"
+
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+const (
+	dbType = "memdb"
+)
+
+// parseArgs checks the arguments from the database Create method, which are either none or the database path and block
+// network that ffldb takes.
+func parseArgs(funcName string, args ...interface{}) (e error) {
+	switch len(args) {
+	case 0:
+		return nil
+	case 2:
+	default:
+		return fmt.Errorf(
+			"invalid arguments to %s.%s -- "+
+				"expected no arguments or database path and block network", dbType,
+			funcName,
+		)
+	}
+	if _, ok := args[0].(string); !ok {
+		return fmt.Errorf(
+			"first argument to %s.%s is invalid -- "+
+				"expected database path string", dbType, funcName,
+		)
+	}
+	if _, ok := args[1].(wire.BitcoinNet); !ok {
+		return fmt.Errorf(
+			"second argument to %s.%s is invalid -- "+
+				"expected block network", dbType, funcName,
+		)
+	}
+	return nil
+}
+
+// openDBDriver is the callback provided during driver registration that opens an existing database for use. A memory
+// database does not outlive the instance that created it, so there is never one to open.
+func openDBDriver(args ...interface{}) (database.DB, error) {
+	if e := parseArgs("Open", args...); E.Chk(e) {
+		return nil, e
+	}
+	str := "memory databases only exist while they are open, create one instead"
+	return nil, makeDbErr(database.ErrDbDoesNotExist, str, nil)
+}
+
+// createDBDriver is the callback provided during driver registration that creates, initializes, and opens a database
+// for use.
+func createDBDriver(args ...interface{}) (database.DB, error) {
+	if e := parseArgs("Create", args...); E.Chk(e) {
+		return nil, e
+	}
+	return newDB(), nil
+}
+func init() {
+	// Register the driver.
+	driver := database.Driver{
+		DbType: dbType,
+		Create: createDBDriver,
+		Open:   openDBDriver,
+	}
+	if e := database.RegisterDriver(driver); E.Chk(e) {
+		panic(
+			fmt.Sprintf(
+				"Failed to regiser database driver '%s': %v",
+				dbType, e,
+			),
+		)
+	}
+}
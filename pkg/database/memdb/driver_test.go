@@ -0,0 +1,169 @@
+package memdb_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/database"
+	databasetest "github.com/p9c/parallelcoin/pkg/database/ci"
+	_ "github.com/p9c/parallelcoin/pkg/database/memdb"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// dbType is the database type name for this driver.
+const dbType = "memdb"
+
+// TestCreateOpenFail ensures that errors related to creating and opening a database are handled properly.
+func TestCreateOpenFail(t *testing.T) {
+	t.Parallel()
+	// Ensure that attempting to open a database returns the expected error, as there is never one to open.
+	_, e := database.Open(dbType)
+	if !databasetest.CheckDbError(t, "Open", e, database.ErrDbDoesNotExist) {
+		return
+	}
+	// Ensure that attempting to create a database with the wrong parameters returns the expected errors.
+	wantErr := fmt.Errorf(
+		"invalid arguments to %s.Create -- expected "+
+			"no arguments or database path and block network", dbType,
+	)
+	if _, e = database.Create(dbType, 1); e == nil || e.Error() != wantErr.Error() {
+		t.Errorf("Create: did not receive expected error - got %v, want %v", e, wantErr)
+		return
+	}
+	wantErr = fmt.Errorf(
+		"second argument to %s.Create is invalid -- "+
+			"expected block network", dbType,
+	)
+	if _, e = database.Create(dbType, "path", "invalid"); e == nil || e.Error() != wantErr.Error() {
+		t.Errorf("Create: did not receive expected error - got %v, want %v", e, wantErr)
+		return
+	}
+	// Ensure the path and network that ffldb takes are accepted.
+	db, e := database.Create(dbType, "path", wire.MainNet)
+	if e != nil {
+		t.Errorf("Create: unexpected error: %v", e)
+		return
+	}
+	// Ensure there is nothing to back up.
+	if e = db.Backup("path"); !databasetest.CheckDbError(t, "Backup", e, database.ErrDriverSpecific) {
+		return
+	}
+	// Ensure operations against a closed database return the expected error.
+	if e = db.Close(); e != nil {
+		t.Errorf("Close: unexpected error: %v", e)
+		return
+	}
+	e = db.View(
+		func(tx database.Tx) (e error) {
+			return nil
+		},
+	)
+	if !databasetest.CheckDbError(t, "View", e, database.ErrDbNotOpen) {
+		return
+	}
+	e = db.Update(
+		func(tx database.Tx) (e error) {
+			return nil
+		},
+	)
+	if !databasetest.CheckDbError(t, "Update", e, database.ErrDbNotOpen) {
+		return
+	}
+	_, e = db.Begin(true)
+	if !databasetest.CheckDbError(t, "Begin(true)", e, database.ErrDbNotOpen) {
+		return
+	}
+	if e = db.Backup("path"); !databasetest.CheckDbError(t, "Backup", e, database.ErrDbNotOpen) {
+		return
+	}
+	e = db.Close()
+	databasetest.CheckDbError(t, "Close", e, database.ErrDbNotOpen)
+}
+
+// TestPruneBlocks ensures that pruning removes the oldest blocks down to the target size and leaves blocks that may not
+// be pruned in place.
+func TestPruneBlocks(t *testing.T) {
+	t.Parallel()
+	blocks, e := databasetest.LoadBlocks(t, databasetest.BlockDataFile, databasetest.BlockDataNet)
+	if e != nil {
+		t.Errorf("LoadBlocks: unexpected error: %v", e)
+		return
+	}
+	db, e := database.Create(dbType)
+	if e != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, e)
+		return
+	}
+	defer func() {
+		if e = db.Close(); E.Chk(e) {
+		}
+	}()
+	e = db.Update(
+		func(tx database.Tx) (e error) {
+			for i := range blocks {
+				if e = tx.StoreBlock(blocks[i]); E.Chk(e) {
+					return e
+				}
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Errorf("StoreBlock: unexpected error: %v", e)
+		return
+	}
+	// Refuse to prune the block at index 100 so pruning has to stop there.
+	keep := blocks[100].Hash()
+	var pruned []chainhash.Hash
+	e = db.Update(
+		func(tx database.Tx) (e error) {
+			if pruned, e = tx.PruneBlocks(
+				0, func(hash *chainhash.Hash) bool {
+					return !hash.IsEqual(keep)
+				},
+			); E.Chk(e) {
+				return e
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Errorf("PruneBlocks: unexpected error: %v", e)
+		return
+	}
+	// The oldest blocks are removed first, so the pruned blocks must be exactly the blocks stored before the kept one.
+	if len(pruned) != 100 {
+		t.Errorf("PruneBlocks: pruned %d blocks, want 100", len(pruned))
+		return
+	}
+	for i := range pruned {
+		if !pruned[i].IsEqual(blocks[i].Hash()) {
+			t.Errorf("PruneBlocks: pruned block #%d is %v, want %v", i, pruned[i], blocks[i].Hash())
+			return
+		}
+	}
+	e = db.View(
+		func(tx database.Tx) (e error) {
+			if _, e = tx.FetchBlock(blocks[0].Hash()); !databasetest.CheckDbError(
+				t, "FetchBlock", e, database.ErrBlockNotFound,
+			) {
+				return fmt.Errorf("FetchBlock: unexpected result for pruned block")
+			}
+			if _, e = tx.FetchBlock(keep); E.Chk(e) {
+				return fmt.Errorf("FetchBlock: unexpected error for kept block: %v", e)
+			}
+			var beenPruned bool
+			if beenPruned, e = tx.BeenPruned(); E.Chk(e) {
+				return e
+			}
+			if !beenPruned {
+				return fmt.Errorf("BeenPruned: expected true after pruning")
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Errorf("View: unexpected error: %v", e)
+	}
+}
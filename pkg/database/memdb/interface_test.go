@@ -0,0 +1,32 @@
+package memdb_test
+
+import (
+	"runtime"
+	"testing"
+	
+	"github.com/p9c/parallelcoin/pkg/database"
+	databasetest "github.com/p9c/parallelcoin/pkg/database/ci"
+)
+
+// TestInterface performs all interfaces tests for this database driver.
+func TestInterface(t *testing.T) {
+	t.Parallel()
+	// Create a new database to run tests against.
+	db, e := database.Create(dbType)
+	if e != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, e)
+		return
+	}
+	defer func() {
+		if e = db.Close(); E.Chk(e) {
+		}
+	}()
+	// Ensure the driver type is the expected value.
+	if gotDbType := db.Type(); gotDbType != dbType {
+		t.Errorf("Type: unexpected driver type - got %v, want %v", gotDbType, dbType)
+		return
+	}
+	// Run all of the interface tests against the database.
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	databasetest.TestInterface(t, db)
+}
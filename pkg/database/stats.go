@@ -0,0 +1,183 @@
+package database
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the statistics a database, or a user of one, keeps of its own operation. The names of the
+// statistics are dotted paths such as "cache.hits", ending in the unit of the value where it has one.
+type Stats struct {
+	// Counters hold counts that only grow while the database is open, such as the number of cache hits.
+	Counters map[string]uint64 `json:"counters,omitempty"`
+	// Gauges hold values that go up and down, such as the number of open files.
+	Gauges map[string]int64 `json:"gauges,omitempty"`
+	// Histograms hold the distributions of observed values, such as how long each cache flush took.
+	Histograms map[string]HistogramStats `json:"histograms,omitempty"`
+}
+
+// NewStats returns a Stats ready to be filled in.
+func NewStats() Stats {
+	return Stats{
+		Counters:   make(map[string]uint64),
+		Gauges:     make(map[string]int64),
+		Histograms: make(map[string]HistogramStats),
+	}
+}
+
+// Merge adds the statistics in other to s, replacing any of the same name.
+func (s Stats) Merge(other Stats) {
+	for name, v := range other.Counters {
+		s.Counters[name] = v
+	}
+	for name, v := range other.Gauges {
+		s.Gauges[name] = v
+	}
+	for name, v := range other.Histograms {
+		s.Histograms[name] = v
+	}
+}
+
+// Names returns the names of all the statistics in s in order.
+func (s Stats) Names() []string {
+	names := make([]string, 0, len(s.Counters)+len(s.Gauges)+len(s.Histograms))
+	for name := range s.Counters {
+		names = append(names, name)
+	}
+	for name := range s.Gauges {
+		names = append(names, name)
+	}
+	for name := range s.Histograms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StatsReporter is implemented by databases that keep statistics of their own operation, such as the hit rate of their
+// cache and the amount of data written to their files. Drivers keep the statistics from the time the database is
+// opened.
+type StatsReporter interface {
+	// Stats returns a snapshot of the statistics of the database. It is safe for concurrent access.
+	Stats() Stats
+}
+
+// Counter is a count that only grows, which is safe for concurrent access.
+//
+// NOTE: A Counter must be 64-bit aligned, which is the case when it is the first field of a struct or follows other
+// 64-bit fields.
+type Counter struct {
+	n uint64
+}
+
+// Add adds n to the count.
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.n, n)
+}
+
+// Inc adds one to the count.
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.n, 1)
+}
+
+// Value returns the count.
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.n)
+}
+
+// HistogramStats is a snapshot of a Histogram.
+type HistogramStats struct {
+	Count uint64  `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	// Buckets hold the number of values observed up to each of the bounds of the histogram, so each includes the ones
+	// before it. The values greater than the last bound are only counted in Count.
+	Buckets []HistogramBucket `json:"buckets"`
+}
+
+// HistogramBucket is the number of values a histogram observed up to and including its upper bound.
+type HistogramBucket struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+// Mean returns the mean of the observed values, which is zero when none were observed.
+func (h HistogramStats) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / float64(h.Count)
+}
+
+// Histogram counts observed values in buckets with fixed upper bounds, which is safe for concurrent access.
+type Histogram struct {
+	mtx      sync.Mutex
+	bounds   []float64
+	counts   []uint64
+	count    uint64
+	sum      float64
+	min, max float64
+}
+
+// DurationBounds are the bucket bounds for histograms of durations in seconds, from 100µs to about 13 seconds.
+var DurationBounds = ExponentialBounds(0.0001, 2, 18)
+
+// ExponentialBounds returns n bucket bounds starting at start, each factor times the one before it.
+func ExponentialBounds(start, factor float64, n int) []float64 {
+	bounds := make([]float64, n)
+	for i := range bounds {
+		bounds[i] = start
+		start *= factor
+	}
+	return bounds
+}
+
+// NewHistogram returns a histogram with buckets up to the passed bounds, which must be in increasing order.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+// Observe adds a value to the histogram.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mtx.Lock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if h.count == 0 || v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.sum += v
+	h.mtx.Unlock()
+}
+
+// ObserveSince adds the time since start to the histogram in seconds.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Stats returns a snapshot of the histogram.
+func (h *Histogram) Stats() HistogramStats {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	stats := HistogramStats{
+		Count:   h.count,
+		Sum:     h.sum,
+		Min:     h.min,
+		Max:     h.max,
+		Buckets: make([]HistogramBucket, len(h.bounds)),
+	}
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		stats.Buckets[i] = HistogramBucket{UpperBound: bound, Count: cumulative}
+	}
+	return stats
+}
@@ -0,0 +1,63 @@
+package database_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/p9c/parallelcoin/pkg/database"
+)
+
+// TestHistogram ensures values are counted in the buckets of their bounds along with the values past the last bound.
+func TestHistogram(t *testing.T) {
+	t.Parallel()
+	bounds := database.ExponentialBounds(1, 10, 3)
+	if !reflect.DeepEqual(bounds, []float64{1, 10, 100}) {
+		t.Fatalf("ExponentialBounds: got %v, want [1 10 100]", bounds)
+	}
+	h := database.NewHistogram(bounds)
+	if stats := h.Stats(); stats.Count != 0 || stats.Mean() != 0 {
+		t.Fatalf("empty histogram: got %+v", stats)
+	}
+	for _, v := range []float64{0.5, 1, 5, 50, 500} {
+		h.Observe(v)
+	}
+	want := database.HistogramStats{
+		Count: 5,
+		Sum:   556.5,
+		Min:   0.5,
+		Max:   500,
+		Buckets: []database.HistogramBucket{
+			{UpperBound: 1, Count: 2},
+			{UpperBound: 10, Count: 3},
+			{UpperBound: 100, Count: 4},
+		},
+	}
+	stats := h.Stats()
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("Stats: got %+v, want %+v", stats, want)
+	}
+	if mean := stats.Mean(); mean != 111.3 {
+		t.Fatalf("Mean: got %v, want 111.3", mean)
+	}
+}
+
+// TestStatsMerge ensures merged statistics replace those of the same name and are listed in order.
+func TestStatsMerge(t *testing.T) {
+	t.Parallel()
+	var c database.Counter
+	c.Inc()
+	c.Add(2)
+	stats := database.NewStats()
+	stats.Counters["b.count"] = 1
+	stats.Gauges["c.open"] = 1
+	other := database.NewStats()
+	other.Counters["b.count"] = c.Value()
+	other.Histograms["a.seconds"] = database.NewHistogram(database.DurationBounds).Stats()
+	stats.Merge(other)
+	if stats.Counters["b.count"] != 3 {
+		t.Fatalf("Merge: b.count is %d, want 3", stats.Counters["b.count"])
+	}
+	if names := stats.Names(); !reflect.DeepEqual(names, []string{"a.seconds", "b.count", "c.open"}) {
+		t.Fatalf("Names: got %v", names)
+	}
+}
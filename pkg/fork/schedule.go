@@ -0,0 +1,198 @@
+package fork
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Implemented is the number of hard forks whose consensus rules are implemented. The rules of a hard fork are selected
+// by its number, so a schedule may move the activation heights, algorithms, target times and averaging intervals of
+// these but cannot add further hard forks.
+const Implemented = 2
+
+const (
+	// RegressionTestActivationHeight is the height the Plan 9 hard fork activates at on the regression test network.
+	RegressionTestActivationHeight = 200
+	// SimNetActivationHeight is the height the Plan 9 hard fork activates at on the simulation test network.
+	SimNetActivationHeight = 200
+)
+
+// Schedule is the hard fork schedule of a network, being the hard forks in order of activation.
+type Schedule struct {
+	Forks []HardForks `json:"forks" toml:"fork"`
+	// FirstBlockNoReps is whether the block at height 1 is hashed without repeating the division hash, which was done
+	// to bootstrap the test network.
+	FirstBlockNoReps bool `json:"firstblocknoreps" toml:"firstblocknoreps"`
+}
+
+// MainNetSchedule returns the hard fork schedule of the main network.
+func MainNetSchedule() *Schedule {
+	s := &Schedule{
+		Forks: []HardForks{
+			{
+				Number:             0,
+				Name:               "Halcyon days",
+				ActivationHeight:   0,
+				Algos:              halcyonAlgos(),
+				TargetTimePerBlock: 300,
+				AveragingInterval:  10, // 50 minutes
+			},
+			{
+				Number:             1,
+				Name:               "Plan 9 from Crypto Space",
+				ActivationHeight:   2500000,
+				Algos:              p9Algos(),
+				TargetTimePerBlock: 36,
+				AveragingInterval:  3600,
+			},
+		},
+	}
+	if e := s.Init(); E.Chk(e) {
+		panic(e)
+	}
+	return s
+}
+
+// TestNetSchedule returns the hard fork schedule of the test network, which runs the latest hard fork from genesis.
+func TestNetSchedule() *Schedule {
+	s := MainNetSchedule()
+	for i := range s.Forks {
+		s.Forks[i].ActivationHeight = 0
+	}
+	s.FirstBlockNoReps = true
+	return s
+}
+
+// RegressionTestSchedule returns the hard fork schedule of the regression test network, which activates the Plan 9 hard
+// fork early so tests can exercise both sets of consensus rules without mining millions of blocks.
+func RegressionTestSchedule() *Schedule {
+	return earlySchedule(RegressionTestActivationHeight)
+}
+
+// SimNetSchedule returns the hard fork schedule of the simulation test network, which activates the Plan 9 hard fork
+// early for the same reason as the regression test network.
+func SimNetSchedule() *Schedule {
+	return earlySchedule(SimNetActivationHeight)
+}
+
+// earlySchedule returns the main network schedule with the Plan 9 hard fork activating at the given height.
+func earlySchedule(height int32) *Schedule {
+	s := MainNetSchedule()
+	s.Forks[1].ActivationHeight = height
+	if e := s.Init(); E.Chk(e) {
+		panic(e)
+	}
+	return s
+}
+
+// halcyonAlgos returns the algorithm specifications before the hard fork
+func halcyonAlgos() map[string]AlgoParams {
+	return map[string]AlgoParams{
+		SHA256d: {
+			Version: 2,
+			MinBits: MainPowLimitBits,
+		},
+		Scrypt: {
+			Version: 514,
+			MinBits: MainPowLimitBits,
+			AlgoID:  1,
+		},
+	}
+}
+
+// p9Algos returns the algorithm specifications after the hard fork, named after their version intervals
+func p9Algos() map[string]AlgoParams {
+	algos := make(map[string]AlgoParams, len(P9AlgosNumeric))
+	for _, p := range P9AlgosNumeric {
+		algos[fmt.Sprintf("Div%d", p.VersionInterval)] = p
+	}
+	return algos
+}
+
+// ReadSchedule reads a hard fork schedule from a JSON or TOML file, chosen by the extension of the file name, and
+// initialises it.
+func ReadSchedule(path string) (s *Schedule, e error) {
+	var b []byte
+	if b, e = ioutil.ReadFile(path); E.Chk(e) {
+		return
+	}
+	s = &Schedule{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		e = json.Unmarshal(b, s)
+	case ".toml":
+		e = toml.Unmarshal(b, s)
+	default:
+		return nil, fmt.Errorf("unknown hard fork schedule file type '%s' of %s", ext, path)
+	}
+	if e != nil {
+		return nil, fmt.Errorf("unable to decode hard fork schedule %s: %v", path, e)
+	}
+	if e = s.Init(); e != nil {
+		return nil, fmt.Errorf("invalid hard fork schedule %s: %v", path, e)
+	}
+	return
+}
+
+// Init checks the schedule and computes the parts of its hard forks that are derived from their algorithms.
+func (s *Schedule) Init() (e error) {
+	if len(s.Forks) == 0 {
+		return fmt.Errorf("there are no hard forks")
+	}
+	if len(s.Forks) > Implemented {
+		return fmt.Errorf("only %d hard forks are implemented but %d are scheduled", Implemented, len(s.Forks))
+	}
+	for i := range s.Forks {
+		hf := &s.Forks[i]
+		switch {
+		case hf.Number != i:
+			return fmt.Errorf("hard fork %s is number %d but is scheduled as number %d", hf.Name, hf.Number, i)
+		case i == 0 && hf.ActivationHeight != 0:
+			return fmt.Errorf("the first hard fork must activate at height 0, not %d", hf.ActivationHeight)
+		case i > 0 && hf.ActivationHeight < s.Forks[i-1].ActivationHeight:
+			return fmt.Errorf("hard fork %s activates before the hard fork it follows", hf.Name)
+		case len(hf.Algos) == 0:
+			return fmt.Errorf("hard fork %s has no algorithms", hf.Name)
+		case hf.TargetTimePerBlock <= 0 || hf.AveragingInterval <= 0:
+			return fmt.Errorf("hard fork %s must have a positive target time per block and averaging interval", hf.Name)
+		}
+		hf.AlgoVers = make(map[int32]string, len(hf.Algos))
+		hf.AlgoSlice = make(AlgoSpecs, 0, len(hf.Algos))
+		for name, p := range hf.Algos {
+			if other, ok := hf.AlgoVers[p.Version]; ok {
+				return fmt.Errorf("algorithms %s and %s of hard fork %s have the same version %d", name, other,
+					hf.Name, p.Version)
+			}
+			if p.MinBits == 0 {
+				return fmt.Errorf("algorithm %s of hard fork %s has no minimum target", name, hf.Name)
+			}
+			if i > 0 && p.VersionInterval <= 0 {
+				return fmt.Errorf("algorithm %s of hard fork %s must have a positive version interval", name, hf.Name)
+			}
+			hf.AlgoVers[p.Version] = name
+			hf.AlgoSlice = append(hf.AlgoSlice, AlgoSpec{p.Version, name})
+		}
+		sort.Sort(hf.AlgoSlice)
+		hf.Average = 0
+		base := float64(hf.Algos[hf.AlgoSlice[len(hf.AlgoSlice)-1].Name].VersionInterval)
+		if base > 0 {
+			hf.Average = 1
+			for _, a := range hf.AlgoSlice {
+				hf.Average += float64(hf.Algos[a.Name].VersionInterval) / base
+			}
+			hf.Average = base / hf.Average
+		}
+	}
+	return
+}
+
+// Activation returns the activation height of the hard fork in effect at a given height.
+func (s *Schedule) Activation(height int32) int32 {
+	return s.Forks[s.GetCurrent(height)].ActivationHeight
+}
@@ -0,0 +1,152 @@
+package fork
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestMainNetSchedule ensures the derived parts of the default schedules are computed and the hard fork in effect is
+// found from the activation heights.
+func TestMainNetSchedule(t *testing.T) {
+	s := MainNetSchedule()
+	if got := s.Forks[1].Average; got != 18.0/512 {
+		t.Errorf("Plan 9 average: got %v, want %v", got, 18.0/512)
+	}
+	if got := s.Forks[1].AlgoSlice[0].Name; got != "Div4608" {
+		t.Errorf("highest version algorithm: got %s, want Div4608", got)
+	}
+	if got := s.GetAlgoName(514, 100); got != Scrypt {
+		t.Errorf("GetAlgoName: got %s, want %s", got, Scrypt)
+	}
+	if got := s.GetAlgoName(7, 100); got != SHA256d {
+		t.Errorf("GetAlgoName of an irregular version: got %s, want %s", got, SHA256d)
+	}
+	tests := []struct {
+		height  int32
+		mainnet int
+		testnet int
+		regtest int
+	}{
+		{0, 0, 1, 0},
+		{RegressionTestActivationHeight - 1, 0, 1, 0},
+		{RegressionTestActivationHeight, 0, 1, 1},
+		{2499999, 0, 1, 1},
+		{2500000, 1, 1, 1},
+	}
+	testnet := TestNetSchedule()
+	regtest := RegressionTestSchedule()
+	simnet := SimNetSchedule()
+	for _, test := range tests {
+		if got := regtest.GetCurrent(test.height); got != test.regtest {
+			t.Errorf("regtest GetCurrent(%d): got %d, want %d", test.height, got, test.regtest)
+		}
+		if got := s.GetCurrent(test.height); got != test.mainnet {
+			t.Errorf("mainnet GetCurrent(%d): got %d, want %d", test.height, got, test.mainnet)
+		}
+		if got := testnet.GetCurrent(test.height); got != test.testnet {
+			t.Errorf("testnet GetCurrent(%d): got %d, want %d", test.height, got, test.testnet)
+		}
+	}
+	if got := simnet.Activation(SimNetActivationHeight); got != SimNetActivationHeight {
+		t.Errorf("simnet Activation: got %d, want %d", got, SimNetActivationHeight)
+	}
+	if !testnet.FirstBlockNoReps || s.FirstBlockNoReps {
+		t.Error("only the test network hashes its first block without repetitions")
+	}
+}
+
+// TestReadSchedule ensures schedules are read from JSON and TOML files and that invalid ones are rejected.
+func TestReadSchedule(t *testing.T) {
+	dir, e := ioutil.TempDir("", "forkschedule")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if e := ioutil.WriteFile(path, []byte(content), 0600); e != nil {
+			t.Fatal(e)
+		}
+		return path
+	}
+	want := MainNetSchedule()
+	want.Forks[1].ActivationHeight = 100
+	b, e := json.Marshal(want)
+	if e != nil {
+		t.Fatal(e)
+	}
+	got, e := ReadSchedule(write("forks.json", string(b)))
+	if e != nil {
+		t.Fatalf("ReadSchedule json: %v", e)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadSchedule json: got %+v, want %+v", got, want)
+	}
+	got, e = ReadSchedule(
+		write(
+			"forks.toml", `
+[[fork]]
+number = 0
+name = "Halcyon days"
+activationheight = 0
+targettimeperblock = 300
+averaginginterval = 10
+  [fork.algos.sha256d]
+  version = 2
+  minbits = 0x1e0fffff
+
+[[fork]]
+number = 1
+name = "Plan 9 from Crypto Space"
+activationheight = 50
+targettimeperblock = 36
+averaginginterval = 3600
+  [fork.algos.Div18]
+  version = 5
+  minbits = 0x1f0fffff
+  versioninterval = 18
+  [fork.algos.Div36]
+  version = 6
+  minbits = 0x1f0fffff
+  algoid = 1
+  versioninterval = 36
+`,
+		),
+	)
+	if e != nil {
+		t.Fatalf("ReadSchedule toml: %v", e)
+	}
+	if got.GetCurrent(49) != 0 || got.GetCurrent(50) != 1 {
+		t.Errorf("ReadSchedule toml: hard fork 1 does not activate at height 50")
+	}
+	if v := got.GetAlgoVer("Div36", 50); v != 6 {
+		t.Errorf("ReadSchedule toml: version of Div36 is %d, want 6", v)
+	}
+	if got.Forks[1].Average != 18.0/4 {
+		t.Errorf("ReadSchedule toml: average is %v, want %v", got.Forks[1].Average, 18.0/4)
+	}
+	invalid := []struct {
+		name    string
+		content string
+	}{
+		{"none.json", `{"forks": []}`},
+		{"late.json", `{"forks": [{"number": 0, "activationheight": 5}]}`},
+		{"noalgos.json", `{"forks": [{"number": 0, "targettimeperblock": 1, "averaginginterval": 1}]}`},
+		{
+			"sameversion.json", `{"forks": [{"number": 0, "targettimeperblock": 1, "averaginginterval": 1,
+				"algos": {"a": {"version": 2, "minbits": 1}, "b": {"version": 2, "minbits": 1}}}]}`,
+		},
+		{"forks.yaml", `forks: []`},
+	}
+	for _, test := range invalid {
+		if _, e := ReadSchedule(write(test.name, test.content)); e == nil {
+			t.Errorf("ReadSchedule %s: no error for an invalid schedule", test.name)
+		}
+	}
+}
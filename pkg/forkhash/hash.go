@@ -118,10 +118,10 @@ func DivHash(hf func([]byte) []byte, blockbytes []byte, howmany int) []byte {
 	return hf(ddd)
 }
 
-// Hash computes the hash of bytes using the named hash
-func Hash(bytes []byte, name string, height int32) (out chainhash.Hash) {
+// Hash computes the hash of bytes using the named hash at a height of a network with the given hard fork schedule
+func Hash(bytes []byte, name string, height int32, forks *fork.Schedule) (out chainhash.Hash) {
 	hR := HashReps
-	if fork.IsTestnet {
+	if forks.FirstBlockNoReps {
 		switch {
 		case height == 1:
 			hR = 0
@@ -131,13 +131,13 @@ func Hash(bytes []byte, name string, height int32) (out chainhash.Hash) {
 	}
 	switch name {
 	case fork.Scrypt:
-		if fork.GetCurrent(height) > 0 {
+		if forks.GetCurrent(height) > 0 {
 			_ = out.SetBytes(DivHash(ScryptHash, bytes, hR))
 		} else {
 			_ = out.SetBytes(ScryptHash(bytes))
 		}
 	case fork.SHA256d:
-		if fork.GetCurrent(height) > 0 {
+		if forks.GetCurrent(height) > 0 {
 			_ = out.SetBytes(DivHash(chainhash.DoubleHashB, bytes, hR))
 		} else {
 			_ = out.SetBytes(
@@ -0,0 +1,28 @@
+/*
+Package migration runs the numbered schema migrations of the subsystems that keep data in a database.
+
+Each subsystem, such as the utxo set of the chain or a namespace of a wallet, stores the version of its schema in the
+database. Migration n brings a subsystem from version n-1 to version n, and the migrations of a subsystem are
+registered in order with the version the subsystem had before the first of them:
+
+	utxoSet := migration.NewSubsystem("utxo set", migration.DatabaseVersion(db, []byte("utxosetversion"), 1), 1)
+	utxoSet.Register(
+		migration.Migration{
+			Version:     2,
+			Description: "store each output under its own key",
+			Migrate: func(interrupt <-chan struct{}) error {
+				return upgradeUtxoSetToV2(db, interrupt)
+			},
+		},
+	)
+
+Run brings each subsystem passed to it to its latest version, running the pending migrations in order and logging
+each one. It refuses to touch any of them when one is at a version newer than the latest it knows of, which is what a
+database written by newer software looks like, and in a dry run it only reports the migrations that would be run:
+
+	steps, e := migration.Run(&migration.Config{DryRun: true}, utxoSet)
+
+The version of a subsystem is read and written through a VersionStore. DatabaseVersion keeps it in the metadata of a
+block database and WalletDBVersion keeps it in a top level bucket of a wallet database.
+*/
+package migration
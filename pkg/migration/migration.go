@@ -0,0 +1,174 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInterrupted is returned by Run when it is interrupted between two migrations.
+var ErrInterrupted = errors.New("migration interrupted")
+
+// Migration brings the schema of a subsystem from the version before its Version to its Version.
+type Migration struct {
+	Version     uint32
+	Description string
+	// Migrate performs the migration. It should return an error when the interrupt channel is closed part way through
+	// a long migration, leaving the database in a state the migration can resume from when it is run again.
+	//
+	// Migrate may store the new version itself in the same transaction as its last changes, so that a migration that
+	// can not be run twice is never recorded as not having run. Otherwise Run stores it once Migrate returns.
+	Migrate func(interrupt <-chan struct{}) error
+}
+
+// VersionStore reads and writes the version of the schema of a subsystem.
+type VersionStore interface {
+	// Version returns the version the subsystem is at.
+	Version() (uint32, error)
+	// PutVersion stores the version the subsystem is at.
+	PutVersion(version uint32) error
+}
+
+// Subsystem is a part of a database with a schema version of its own, along with the migrations registered for it.
+type Subsystem struct {
+	Name       string
+	store      VersionStore
+	base       uint32
+	migrations []Migration
+}
+
+// NewSubsystem returns a subsystem whose version is kept in the passed store, and whose first migration brings it from
+// the base version.
+func NewSubsystem(name string, store VersionStore, base uint32) *Subsystem {
+	return &Subsystem{Name: name, store: store, base: base}
+}
+
+// Register adds migrations to the subsystem, which must be numbered one after the other following the latest one
+// already registered, and returns the subsystem.
+//
+// It panics when a migration is out of order or has no Migrate function, since that is a programming error.
+func (s *Subsystem) Register(migrations ...Migration) *Subsystem {
+	for _, m := range migrations {
+		if m.Version != s.Latest()+1 {
+			panic(fmt.Sprintf("migration to version %d of the %s registered after version %d", m.Version, s.Name, s.Latest()))
+		}
+		if m.Migrate == nil {
+			panic(fmt.Sprintf("migration to version %d of the %s has no Migrate function", m.Version, s.Name))
+		}
+		s.migrations = append(s.migrations, m)
+	}
+	return s
+}
+
+// Latest returns the version the registered migrations bring the subsystem to.
+func (s *Subsystem) Latest() uint32 {
+	return s.base + uint32(len(s.migrations))
+}
+
+// Pending returns the version the subsystem is at and the migrations that would bring it to the latest version. It
+// returns a *VersionError when the subsystem is at a version that can not be migrated.
+func (s *Subsystem) Pending() (version uint32, pending []Migration, e error) {
+	if version, e = s.store.Version(); E.Chk(e) {
+		return 0, nil, e
+	}
+	if version < s.base || version > s.Latest() {
+		return version, nil, &VersionError{Subsystem: s.Name, Version: version, Base: s.base, Latest: s.Latest()}
+	}
+	return version, s.migrations[version-s.base:], nil
+}
+
+// VersionError is returned when a subsystem is at a version that can not be migrated, either because it is older than
+// the oldest version it can be migrated from or because the database was written by newer software.
+type VersionError struct {
+	Subsystem             string
+	Version, Base, Latest uint32
+}
+
+// Error returns a description of the version problem.
+func (e *VersionError) Error() string {
+	if e.Version > e.Latest {
+		return fmt.Sprintf(
+			"the %s is at version %d, which is newer than version %d known to this software", e.Subsystem, e.Version,
+			e.Latest,
+		)
+	}
+	return fmt.Sprintf(
+		"the %s is at version %d, which is older than version %d that it can be migrated from", e.Subsystem,
+		e.Version, e.Base,
+	)
+}
+
+// Config is the configuration of Run.
+type Config struct {
+	// DryRun only reports the migrations that would be run without running them.
+	DryRun bool
+	// Interrupt stops the migrations when it is closed. It is checked between migrations and passed to each of them.
+	Interrupt <-chan struct{}
+}
+
+// Step is a migration of a subsystem that was run, or that would be run in a dry run.
+type Step struct {
+	Subsystem string
+	Migration
+}
+
+// String returns a description of the step.
+func (s Step) String() string {
+	return fmt.Sprintf("%s %d -> %d: %s", s.Subsystem, s.Version-1, s.Version, s.Description)
+}
+
+// Run brings the passed subsystems to their latest versions, one after the other, and returns the migrations that were
+// run. Nothing is run when any of the subsystems is at a version that can not be migrated. In a dry run the migrations
+// that would be run are returned instead.
+//
+// When a migration fails or the migrations are interrupted, the migrations run until then are returned along with the
+// error.
+func Run(cfg *Config, subsystems ...*Subsystem) (steps []Step, e error) {
+	// Check every subsystem first so none of them is migrated when the database can not be used anyway.
+	pending := make([][]Migration, len(subsystems))
+	for i, s := range subsystems {
+		if _, pending[i], e = s.Pending(); e != nil {
+			return nil, e
+		}
+	}
+	for i, s := range subsystems {
+		for _, m := range pending[i] {
+			step := Step{Subsystem: s.Name, Migration: m}
+			if cfg.DryRun {
+				I.Ln("would migrate the", step)
+				steps = append(steps, step)
+				continue
+			}
+			if interrupted(cfg.Interrupt) {
+				return steps, ErrInterrupted
+			}
+			I.Ln("migrating the", step)
+			start := time.Now()
+			if e = m.Migrate(cfg.Interrupt); E.Chk(e) {
+				return steps, fmt.Errorf("migrating the %s to version %d: %w", s.Name, m.Version, e)
+			}
+			var version uint32
+			if version, e = s.store.Version(); E.Chk(e) {
+				return steps, e
+			}
+			if version < m.Version {
+				if e = s.store.PutVersion(m.Version); E.Chk(e) {
+					return steps, e
+				}
+			}
+			steps = append(steps, step)
+			I.F("migrated the %s to version %d in %v", s.Name, m.Version, time.Since(start).Round(time.Millisecond))
+		}
+	}
+	return steps, nil
+}
+
+// interrupted returns whether the passed channel has been closed.
+func interrupted(interrupt <-chan struct{}) bool {
+	select {
+	case <-interrupt:
+		return true
+	default:
+	}
+	return false
+}
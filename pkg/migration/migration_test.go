@@ -0,0 +1,184 @@
+package migration_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/p9c/parallelcoin/pkg/database"
+	_ "github.com/p9c/parallelcoin/pkg/database/memdb"
+	"github.com/p9c/parallelcoin/pkg/migration"
+	"github.com/p9c/parallelcoin/pkg/walletdb"
+	_ "github.com/p9c/parallelcoin/pkg/walletdb/memdb"
+	"github.com/p9c/parallelcoin/pkg/wire"
+)
+
+// recorder returns a migration to the passed version that appends the version to ran when it is run.
+func recorder(version uint32, ran *[]uint32) migration.Migration {
+	return migration.Migration{
+		Version:     version,
+		Description: "test",
+		Migrate: func(<-chan struct{}) error {
+			*ran = append(*ran, version)
+			return nil
+		},
+	}
+}
+
+// testVersionStore runs the migrations of a subsystem kept in the passed store, checking that they run in order from
+// the version it is missing at, that a dry run changes nothing and that a newer version is refused.
+func testVersionStore(t *testing.T, store migration.VersionStore) {
+	var ran []uint32
+	newSubsystem := func() *migration.Subsystem {
+		return migration.NewSubsystem("test", store, 1).Register(recorder(2, &ran), recorder(3, &ran))
+	}
+	steps, e := migration.Run(&migration.Config{DryRun: true}, newSubsystem())
+	if e != nil || len(steps) != 2 || len(ran) != 0 {
+		t.Fatalf("dry run: got %d steps, ran %v and error %v", len(steps), ran, e)
+	}
+	if version, e := store.Version(); e != nil || version != 1 {
+		t.Fatalf("dry run: got version %d and error %v, want 1", version, e)
+	}
+	if _, e = migration.Run(&migration.Config{}, newSubsystem()); e != nil {
+		t.Fatalf("Run: %v", e)
+	}
+	if !reflect.DeepEqual(ran, []uint32{2, 3}) {
+		t.Fatalf("Run: ran %v, want [2 3]", ran)
+	}
+	if version, e := store.Version(); e != nil || version != 3 {
+		t.Fatalf("Run: got version %d and error %v, want 3", version, e)
+	}
+	// Running again does nothing as the subsystem is at the latest version.
+	if steps, e = migration.Run(&migration.Config{}, newSubsystem()); e != nil || len(steps) != 0 {
+		t.Fatalf("second Run: got steps %v and error %v", steps, e)
+	}
+	// Code that only knows of version 2 refuses the database.
+	_, e = migration.Run(&migration.Config{}, migration.NewSubsystem("test", store, 1).Register(recorder(2, &ran)))
+	var versionErr *migration.VersionError
+	if !errors.As(e, &versionErr) || versionErr.Version != 3 || versionErr.Latest != 2 {
+		t.Fatalf("newer version: got error %v, want a version error", e)
+	}
+}
+
+// TestDatabaseVersion ensures migrations run against versions kept in a block database.
+func TestDatabaseVersion(t *testing.T) {
+	db, e := database.Create("memdb", "path", wire.MainNet)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Error(e)
+		}
+	}()
+	testVersionStore(t, migration.DatabaseVersion(db, []byte("testversion"), 1))
+}
+
+// TestWalletDBVersion ensures migrations run against versions kept in a wallet database.
+func TestWalletDBVersion(t *testing.T) {
+	db, e := walletdb.Create("memdb")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Error(e)
+		}
+	}()
+	testVersionStore(t, migration.WalletDBVersion(db, []byte("test"), []byte("version"), 1))
+}
+
+// memoryVersion is a VersionStore kept in memory.
+type memoryVersion uint32
+
+func (v *memoryVersion) Version() (uint32, error) {
+	return uint32(*v), nil
+}
+
+func (v *memoryVersion) PutVersion(version uint32) error {
+	*v = memoryVersion(version)
+	return nil
+}
+
+// TestRun ensures the checks of every subsystem come before any migration, that a migration storing its own version is
+// not recorded again, that an interrupt stops the migrations between two of them and that a failed migration leaves the
+// version where it was.
+func TestRun(t *testing.T) {
+	var ran []uint32
+	first, second := memoryVersion(0), memoryVersion(5)
+	// The second subsystem is newer than the code, so the first one is not migrated.
+	_, e := migration.Run(
+		&migration.Config{},
+		migration.NewSubsystem("first", &first, 0).Register(recorder(1, &ran)),
+		migration.NewSubsystem("second", &second, 0).Register(recorder(1, &ran)),
+	)
+	var versionErr *migration.VersionError
+	if !errors.As(e, &versionErr) || versionErr.Subsystem != "second" || len(ran) != 0 || first != 0 {
+		t.Fatalf("newer subsystem: got error %v, ran %v and first version %d", e, ran, first)
+	}
+	// A version older than the base can not be migrated either.
+	_, e = migration.Run(&migration.Config{}, migration.NewSubsystem("first", &first, 1))
+	if !errors.As(e, &versionErr) || versionErr.Version != 0 || versionErr.Base != 1 {
+		t.Fatalf("older subsystem: got error %v, want a version error", e)
+	}
+	// A migration that stores its own version, here past its own, is not stored over.
+	steps, e := migration.Run(
+		&migration.Config{}, migration.NewSubsystem("first", &first, 0).Register(
+			migration.Migration{
+				Version: 1,
+				Migrate: func(<-chan struct{}) error {
+					first = 7
+					return nil
+				},
+			},
+		),
+	)
+	if e != nil || len(steps) != 1 || first != 7 {
+		t.Fatalf("own version: got steps %v, error %v and version %d", steps, e, first)
+	}
+	// The interrupt is closed by the first migration, so the second is not run.
+	ran, first = nil, 0
+	interrupt := make(chan struct{})
+	steps, e = migration.Run(
+		&migration.Config{Interrupt: interrupt}, migration.NewSubsystem("first", &first, 0).Register(
+			migration.Migration{
+				Version: 1,
+				Migrate: func(<-chan struct{}) error {
+					close(interrupt)
+					return nil
+				},
+			},
+			recorder(2, &ran),
+		),
+	)
+	if e != migration.ErrInterrupted || len(steps) != 1 || len(ran) != 0 || first != 1 {
+		t.Fatalf("interrupt: got steps %v, error %v, ran %v and version %d", steps, e, ran, first)
+	}
+	// A failed migration is not recorded.
+	failure := errors.New("failure")
+	_, e = migration.Run(
+		&migration.Config{}, migration.NewSubsystem("first", &first, 0).Register(
+			recorder(1, &ran),
+			migration.Migration{
+				Version: 2,
+				Migrate: func(<-chan struct{}) error {
+					return failure
+				},
+			},
+		),
+	)
+	if !errors.Is(e, failure) || first != 1 {
+		t.Fatalf("failure: got error %v and version %d", e, first)
+	}
+}
+
+// TestRegister ensures migrations registered out of order are refused.
+func TestRegister(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering version 3 after version 1 did not panic")
+		}
+	}()
+	var ran []uint32
+	migration.NewSubsystem("test", new(memoryVersion), 0).Register(recorder(1, &ran), recorder(3, &ran))
+}
@@ -0,0 +1,115 @@
+package migration
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/p9c/parallelcoin/pkg/database"
+	"github.com/p9c/parallelcoin/pkg/walletdb"
+)
+
+// byteOrder is the byte order versions are stored in, which is the one the chain has always stored its versions in.
+var byteOrder = binary.LittleEndian
+
+// decodeVersion returns the version stored in a value, or the passed version when no value is stored.
+func decodeVersion(serialized []byte, missing uint32) (uint32, error) {
+	if serialized == nil {
+		return missing, nil
+	}
+	if len(serialized) != 4 {
+		return 0, fmt.Errorf("stored version %x is malformed", serialized)
+	}
+	return byteOrder.Uint32(serialized), nil
+}
+
+// encodeVersion returns the stored form of a version.
+func encodeVersion(version uint32) []byte {
+	var serialized [4]byte
+	byteOrder.PutUint32(serialized[:], version)
+	return serialized[:]
+}
+
+// dbVersion is a VersionStore keeping a version in the metadata of a block database.
+type dbVersion struct {
+	db      database.DB
+	key     []byte
+	missing uint32
+}
+
+// DatabaseVersion returns a VersionStore that keeps a version under the passed key in the metadata bucket of a block
+// database. When no version is stored the subsystem is taken to be at the missing version.
+func DatabaseVersion(db database.DB, key []byte, missing uint32) VersionStore {
+	return &dbVersion{db: db, key: key, missing: missing}
+}
+
+// Version returns the stored version.
+//
+// This function is part of the VersionStore interface implementation.
+func (v *dbVersion) Version() (version uint32, e error) {
+	e = v.db.View(
+		func(tx database.Tx) (e error) {
+			version, e = decodeVersion(tx.Metadata().Get(v.key), v.missing)
+			return e
+		},
+	)
+	return version, e
+}
+
+// PutVersion stores the version.
+//
+// This function is part of the VersionStore interface implementation.
+func (v *dbVersion) PutVersion(version uint32) (e error) {
+	return v.db.Update(
+		func(tx database.Tx) error {
+			return tx.Metadata().Put(v.key, encodeVersion(version))
+		},
+	)
+}
+
+// walletVersion is a VersionStore keeping a version in a top level bucket of a wallet database.
+type walletVersion struct {
+	db          walletdb.DB
+	bucket, key []byte
+	missing     uint32
+}
+
+// WalletDBVersion returns a VersionStore that keeps a version under the passed key in a top level bucket of a wallet
+// database, which is created when the version is first stored. When no version is stored the subsystem is taken to be
+// at the missing version.
+func WalletDBVersion(db walletdb.DB, bucket, key []byte, missing uint32) VersionStore {
+	return &walletVersion{db: db, bucket: bucket, key: key, missing: missing}
+}
+
+// Version returns the stored version.
+//
+// This function is part of the VersionStore interface implementation.
+func (v *walletVersion) Version() (version uint32, e error) {
+	e = walletdb.View(
+		v.db, func(tx walletdb.ReadTx) (e error) {
+			var serialized []byte
+			if bucket := tx.ReadBucket(v.bucket); bucket != nil {
+				serialized = bucket.Get(v.key)
+			}
+			version, e = decodeVersion(serialized, v.missing)
+			return e
+		},
+	)
+	return version, e
+}
+
+// PutVersion stores the version.
+//
+// This function is part of the VersionStore interface implementation.
+func (v *walletVersion) PutVersion(version uint32) (e error) {
+	return walletdb.Update(
+		v.db, func(tx walletdb.ReadWriteTx) (e error) {
+			bucket := tx.ReadWriteBucket(v.bucket)
+			if bucket == nil {
+				if bucket, e = tx.CreateTopLevelBucket(v.bucket); E.Chk(e) {
+					return e
+				}
+			}
+			return bucket.Put(v.key, encodeVersion(version))
+		},
+	)
+}
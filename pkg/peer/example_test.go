@@ -13,7 +13,7 @@ import (
 	"github.com/p9c/parallelcoin/pkg/wire"
 )
 
-var subsystem = log.AddLoggerSubsystem()
+var subsystem = log.AddLoggerSubsystem("test")
 var F, E, W, I, D, T log.LevelPrinter = log.GetLogPrinterSet(subsystem)
 
 // mockRemotePeer creates a basic inbound peer listening on the simnet port for use with Example_peerConnection. It does
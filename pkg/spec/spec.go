@@ -299,7 +299,7 @@ func GetConfigs() (c opts.Configs) {
 			Group:   "debug",
 			Label:   "Database Type",
 			Description:
-			"type of database storage engine to use (only one right now, ffldb)",
+			"type of database storage engine to use, ffldb, bboltdb, or memdb to keep the chain in memory for a throwaway node",
 			Widget: "string",
 			// Hook:        "restart",
 			Documentation: "<placeholder for detailed documentation>",
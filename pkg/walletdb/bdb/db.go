@@ -61,8 +61,8 @@ func (tx *transaction) ReadWriteBucket(key []byte) walletdb.ReadWriteBucket {
 }
 func (tx *transaction) CreateTopLevelBucket(key []byte) (rwb walletdb.ReadWriteBucket, e error) {
 	var boltBucket *bolt.Bucket
-	if boltBucket, e = tx.boltTx.CreateBucket(key); D.Chk(convertErr(e)) {
-		return
+	if boltBucket, e = tx.boltTx.CreateBucketIfNotExists(key); e != nil {
+		return nil, convertErr(e)
 	}
 	return (*bucket)(boltBucket), nil
 }
@@ -118,8 +118,8 @@ func (b *bucket) NestedReadBucket(key []byte) walletdb.ReadBucket {
 // This function is part of the walletdb.Bucket interface implementation.
 func (b *bucket) CreateBucket(key []byte) (rwb walletdb.ReadWriteBucket, e error) {
 	var boltBucket *bolt.Bucket
-	if boltBucket, e = (*bolt.Bucket)(b).CreateBucket(key); D.Chk(convertErr(e)) {
-		return
+	if boltBucket, e = (*bolt.Bucket)(b).CreateBucket(key); e != nil {
+		return nil, convertErr(e)
 	}
 	return (*bucket)(boltBucket), e
 }
@@ -131,7 +131,8 @@ func (b *bucket) CreateBucket(key []byte) (rwb walletdb.ReadWriteBucket, e error
 // This function is part of the walletdb.Bucket interface implementation.
 func (b *bucket) CreateBucketIfNotExists(key []byte) (rwb walletdb.ReadWriteBucket, e error) {
 	var boltBucket *bolt.Bucket
-	if boltBucket, e = (*bolt.Bucket)(b).CreateBucketIfNotExists(key); D.Chk(convertErr(e)) {
+	if boltBucket, e = (*bolt.Bucket)(b).CreateBucketIfNotExists(key); e != nil {
+		e = convertErr(e)
 	} else {
 		rwb = (*bucket)(boltBucket)
 	}
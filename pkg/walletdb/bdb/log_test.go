@@ -4,7 +4,7 @@ import (
 	"github.com/p9c/log"
 )
 
-var subsystem = log.AddLoggerSubsystem()
+var subsystem = log.AddLoggerSubsystem("test")
 var F, E, W, I, D, T log.LevelPrinter = log.GetLogPrinterSet(subsystem)
 
 func init() {
@@ -1,4 +1,4 @@
-package ci
+package walletdbtest
 
 import (
 	"github.com/p9c/log"
@@ -0,0 +1,281 @@
+package cryptdb
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Errors returned by the driver in addition to those of the walletdb package.
+var (
+	// ErrLocked is returned when a read-write transaction is started on a database that has not been unlocked, or a read
+	// transaction on one that has no keys.
+	ErrLocked = errors.New("database is locked")
+	// ErrWrongPassphrase is returned when the passphrase does not decrypt the key of the database.
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	// ErrNotEncrypted is returned when a database opened with the driver was not created by it.
+	ErrNotEncrypted = errors.New("database is not encrypted")
+	// ErrCorrupt is returned when an entry of the database does not decrypt, which means it was damaged or changed by
+	// something that does not have the key.
+	ErrCorrupt = errors.New("encrypted entry does not decrypt")
+)
+
+var (
+	// headerBucketName is the name of the top level bucket of the wrapped database holding the header, which is the
+	// only entry that is not encrypted. It can not be mistaken for an encrypted bucket name, which is longer.
+	headerBucketName = []byte("cryptdb")
+	// headerKeyName is the key of the header in the header bucket.
+	headerKeyName = []byte("header")
+)
+
+const (
+	// headerVersion is the version of the serialized header.
+	headerVersion = 1
+	// keySize is the size of the data key and of the key derived from the passphrase.
+	keySize = chacha20poly1305.KeySize
+	// saltSize is the size of the salt of the key derivation.
+	saltSize = 32
+	// nonceSize is the size of the nonces, which are long enough to be chosen at random.
+	nonceSize = chacha20poly1305.NonceSizeX
+	// tagSize is the size of the authentication tag of a ciphertext.
+	tagSize = 16
+	// overhead is the number of bytes encryption adds to a key or value.
+	overhead = nonceSize + tagSize
+	// headerSize is the size of a serialized header.
+	headerSize = 1 + 12 + saltSize + overhead + keySize
+)
+
+// The scrypt parameters used for new passphrases, which are those used for the private passphrase of a wallet. The
+// parameters a passphrase was derived with are kept in the header, so they can be changed without breaking existing
+// databases.
+var (
+	scryptN = 1 << 18
+	scryptR = 8
+	scryptP = 1
+)
+
+// header holds the data key of a database encrypted with a key derived from the passphrase, along with what is needed
+// to derive that key again.
+type header struct {
+	n, r, p    uint32
+	salt       [saltSize]byte
+	wrappedKey []byte
+}
+
+// serialize returns the header in the form it is stored in.
+func (h *header) serialize() []byte {
+	b := make([]byte, headerSize)
+	b[0] = headerVersion
+	binary.LittleEndian.PutUint32(b[1:], h.n)
+	binary.LittleEndian.PutUint32(b[5:], h.r)
+	binary.LittleEndian.PutUint32(b[9:], h.p)
+	copy(b[13:], h.salt[:])
+	copy(b[13+saltSize:], h.wrappedKey)
+	return b
+}
+
+// deserializeHeader parses a stored header.
+func deserializeHeader(b []byte) (h *header, e error) {
+	if len(b) != headerSize || b[0] != headerVersion {
+		return nil, ErrNotEncrypted
+	}
+	h = &header{
+		n:          binary.LittleEndian.Uint32(b[1:]),
+		r:          binary.LittleEndian.Uint32(b[5:]),
+		p:          binary.LittleEndian.Uint32(b[9:]),
+		wrappedKey: append([]byte{}, b[13+saltSize:]...),
+	}
+	copy(h.salt[:], b[13:])
+	return h, nil
+}
+
+// newHeader returns a header holding the data key encrypted with a key derived from the passphrase with a new salt.
+func newHeader(passphrase, dataKey []byte) (h *header, e error) {
+	h = &header{n: uint32(scryptN), r: uint32(scryptR), p: uint32(scryptP)}
+	if _, e = io.ReadFull(rand.Reader, h.salt[:]); E.Chk(e) {
+		return nil, e
+	}
+	var aead cipher.AEAD
+	if aead, e = h.passphraseCipher(passphrase); E.Chk(e) {
+		return nil, e
+	}
+	if h.wrappedKey, e = seal(aead, dataKey, headerBucketName); E.Chk(e) {
+		return nil, e
+	}
+	return h, nil
+}
+
+// passphraseCipher returns the cipher keyed with the key derived from the passphrase.
+func (h *header) passphraseCipher(passphrase []byte) (aead cipher.AEAD, e error) {
+	var kek []byte
+	if kek, e = scrypt.Key(passphrase, h.salt[:], int(h.n), int(h.r), int(h.p), keySize); E.Chk(e) {
+		return nil, e
+	}
+	defer zero(kek)
+	return chacha20poly1305.NewX(kek)
+}
+
+// unwrap returns the data key, or ErrWrongPassphrase when the passphrase does not decrypt it.
+func (h *header) unwrap(passphrase []byte) (dataKey []byte, e error) {
+	var aead cipher.AEAD
+	if aead, e = h.passphraseCipher(passphrase); E.Chk(e) {
+		return nil, e
+	}
+	if dataKey, e = open(aead, h.wrappedKey, headerBucketName); e != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return dataKey, nil
+}
+
+// newDataKey returns a new random data key.
+func newDataKey() (dataKey []byte, e error) {
+	dataKey = make([]byte, keySize)
+	if _, e = io.ReadFull(rand.Reader, dataKey); E.Chk(e) {
+		return nil, e
+	}
+	return dataKey, nil
+}
+
+// keys holds the keys derived from the data key of a database, which encrypt its entries.
+type keys struct {
+	aead   cipher.AEAD
+	macKey []byte
+	// mtx protects users and dropped. The keys are wiped once the database has dropped them and the last of the
+	// transactions using them has ended.
+	mtx     sync.Mutex
+	users   int
+	dropped bool
+}
+
+// acquire records that a transaction uses the keys.
+func (k *keys) acquire() {
+	k.mtx.Lock()
+	k.users++
+	k.mtx.Unlock()
+}
+
+// release records that a transaction using the keys has ended, and wipes them if they were dropped.
+func (k *keys) release() {
+	k.mtx.Lock()
+	k.users--
+	k.wipeIfUnused()
+	k.mtx.Unlock()
+}
+
+// drop records that the database no longer holds the keys, and wipes them if no transaction uses them.
+func (k *keys) drop() {
+	k.mtx.Lock()
+	k.dropped = true
+	k.wipeIfUnused()
+	k.mtx.Unlock()
+}
+
+// wipeIfUnused zeroes the authentication key and forgets the cipher, which holds the encryption key, once the keys are
+// dropped and unused. It must be called with the mutex held.
+func (k *keys) wipeIfUnused() {
+	if !k.dropped || k.users > 0 || k.aead == nil {
+		return
+	}
+	zero(k.macKey)
+	k.aead = nil
+}
+
+// newKeys derives the encryption and authentication keys from a data key.
+func newKeys(dataKey []byte) (k *keys, e error) {
+	encKey := mac(dataKey, []byte("encrypt"))
+	defer zero(encKey)
+	k = &keys{macKey: mac(dataKey, []byte("authenticate"))}
+	if k.aead, e = chacha20poly1305.NewX(encKey); E.Chk(e) {
+		return nil, e
+	}
+	return k, nil
+}
+
+// bucketID returns the identifier of the bucket with the name nested in the bucket with the parent identifier, which is
+// nil for the top level. Entries are encrypted with the identifier of their bucket as associated data, so they can not
+// be moved to another bucket.
+func (k *keys) bucketID(parent, name []byte) []byte {
+	return mac(k.macKey, []byte{1, byte(len(parent))}, parent, name)
+}
+
+// sealKey encrypts a key or bucket name of the bucket with the identifier. The nonce is derived from the key, so a
+// key is always encrypted the same way and can be looked up by its encrypted form. Empty keys are left as they are, so
+// the wrapped database reports them as errors.
+func (k *keys) sealKey(id, key []byte) []byte {
+	if len(key) == 0 {
+		return key
+	}
+	nonce := mac(k.macKey, []byte{0, byte(len(id))}, id, key)[:nonceSize]
+	return k.aead.Seal(nonce, nonce, key, id)
+}
+
+// openKey decrypts a key or bucket name sealed by sealKey.
+func (k *keys) openKey(id, sealed []byte) ([]byte, error) {
+	return open(k.aead, sealed, id)
+}
+
+// sealValue encrypts the value of the entry with the sealed key in the bucket with the identifier, with a random nonce.
+func (k *keys) sealValue(id, sealedKey, value []byte) ([]byte, error) {
+	return seal(k.aead, value, valueData(id, sealedKey))
+}
+
+// openValue decrypts a value sealed by sealValue. An empty value is returned as an empty slice rather than nil, which
+// means there is no value.
+func (k *keys) openValue(id, sealedKey, sealed []byte) (value []byte, e error) {
+	if value, e = open(k.aead, sealed, valueData(id, sealedKey)); e != nil {
+		return nil, e
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	return value, nil
+}
+
+// valueData returns the associated data of a value, which ties it to its key and bucket.
+func valueData(id, sealedKey []byte) []byte {
+	return append(append(make([]byte, 0, len(id)+len(sealedKey)), id...), sealedKey...)
+}
+
+// seal encrypts plaintext with a random nonce, which is put in front of the ciphertext.
+func seal(aead cipher.AEAD, plaintext, data []byte) (sealed []byte, e error) {
+	nonce := make([]byte, nonceSize, nonceSize+len(plaintext)+tagSize)
+	if _, e = io.ReadFull(rand.Reader, nonce); E.Chk(e) {
+		return nil, e
+	}
+	return aead.Seal(nonce, nonce, plaintext, data), nil
+}
+
+// open decrypts the output of seal or sealKey.
+func open(aead cipher.AEAD, sealed, data []byte) (plaintext []byte, e error) {
+	if len(sealed) < overhead {
+		return nil, ErrCorrupt
+	}
+	if plaintext, e = aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], data); e != nil {
+		return nil, ErrCorrupt
+	}
+	return plaintext, nil
+}
+
+// mac returns the HMAC-SHA256 of the concatenated parts with the key.
+func mac(key []byte, parts ...[]byte) []byte {
+	h := hmac.New(sha256.New, key)
+	for _, part := range parts {
+		h.Write(part)
+	}
+	return h.Sum(nil)
+}
+
+// zero overwrites a key that is no longer needed.
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
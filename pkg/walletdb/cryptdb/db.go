@@ -0,0 +1,883 @@
+package cryptdb
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/p9c/parallelcoin/pkg/walletdb"
+)
+
+// registryBucketName is the name of the bucket in the header bucket that lists the encrypted names of the top level
+// buckets, which the walletdb interface has no other way to find.
+var registryBucketName = []byte("buckets")
+
+// DB is a walletdb database that encrypts the keys and values of another walletdb database, which it wraps. It
+// implements the walletdb.DB interface.
+//
+// A database opened with its passphrase is read-only: the keys of its entries are derived so read transactions work,
+// but read-write transactions are refused with ErrLocked until it is unlocked. A database opened without the passphrase
+// has no keys and refuses both until it is unlocked, which derives them. Locking it again drops the keys, which are
+// wiped once the transactions that are still using them end.
+type DB struct {
+	inner walletdb.DB
+	// rekeyMtx serializes the changes of the passphrase and the key.
+	rekeyMtx sync.Mutex
+	// mtx protects the fields below. Beginning a read transaction holds it until the keys are taken, and RotateKey holds
+	// it while it commits and replaces the keys, so a transaction never sees the entries of one key with another.
+	mtx    sync.RWMutex
+	header *header
+	// keys are the keys of the entries once they have been derived, and nil before that and after the database is
+	// locked.
+	keys *keys
+	// writable is whether read-write transactions are allowed, which is only the case once the database has been
+	// unlocked.
+	writable bool
+}
+
+// Enforce DB implements the walletdb.DB interface.
+var _ walletdb.DB = (*DB)(nil)
+
+// createDB creates a database in the wrapped database, which must be empty, encrypted with a new key under the
+// passphrase, and returns it unlocked.
+func createDB(inner walletdb.DB, passphrase []byte) (db *DB, e error) {
+	var dataKey []byte
+	if dataKey, e = newDataKey(); E.Chk(e) {
+		return nil, e
+	}
+	defer zero(dataKey)
+	db = &DB{inner: inner, writable: true}
+	if db.header, e = newHeader(passphrase, dataKey); E.Chk(e) {
+		return nil, e
+	}
+	if db.keys, e = newKeys(dataKey); E.Chk(e) {
+		return nil, e
+	}
+	e = walletdb.Update(
+		inner, func(tx walletdb.ReadWriteTx) (e error) {
+			var hb walletdb.ReadWriteBucket
+			if hb, e = tx.CreateTopLevelBucket(headerBucketName); E.Chk(e) {
+				return e
+			}
+			if _, e = hb.CreateBucketIfNotExists(registryBucketName); E.Chk(e) {
+				return e
+			}
+			return hb.Put(headerKeyName, db.header.serialize())
+		},
+	)
+	if e != nil {
+		return nil, e
+	}
+	return db, nil
+}
+
+// openDB opens the encrypted database in the wrapped database. It is returned locked without keys, as only the header
+// is read.
+func openDB(inner walletdb.DB) (db *DB, e error) {
+	db = &DB{inner: inner}
+	e = walletdb.View(
+		inner, func(tx walletdb.ReadTx) (e error) {
+			hb := tx.ReadBucket(headerBucketName)
+			if hb == nil {
+				return ErrNotEncrypted
+			}
+			db.header, e = deserializeHeader(hb.Get(headerKeyName))
+			return e
+		},
+	)
+	if e != nil {
+		return nil, e
+	}
+	return db, nil
+}
+
+// deriveKeys derives the keys of the entries from the passphrase, which allows read transactions on the database, and
+// when writable is set read-write transactions as well. It returns ErrWrongPassphrase if the passphrase does not
+// decrypt the key of the database.
+func (db *DB) deriveKeys(passphrase []byte, writable bool) (e error) {
+	var dataKey []byte
+	if dataKey, e = db.currentHeader().unwrap(passphrase); e != nil {
+		return e
+	}
+	defer zero(dataKey)
+	var k *keys
+	if k, e = newKeys(dataKey); E.Chk(e) {
+		return e
+	}
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	db.writable = db.writable || writable
+	if db.keys != nil {
+		// The keys were already derived.
+		k.drop()
+		return nil
+	}
+	db.keys = k
+	return nil
+}
+
+// Unlock checks the passphrase and allows read-write transactions on the database, deriving the keys of the entries if
+// it was opened without them. It returns ErrWrongPassphrase if the passphrase does not decrypt the key of the database.
+func (db *DB) Unlock(passphrase []byte) error {
+	return db.deriveKeys(passphrase, true)
+}
+
+// Lock drops the keys of the entries, so that new transactions return ErrLocked until the database is unlocked again.
+// Transactions that are already open keep working, and the keys are wiped when the last of them ends.
+func (db *DB) Lock() {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	db.writable = false
+	if db.keys != nil {
+		db.keys.drop()
+		db.keys = nil
+	}
+}
+
+// Locked returns whether the database is locked, in which case read-write transactions are refused. A locked database
+// still allows read transactions when it was opened with its passphrase.
+func (db *DB) Locked() bool {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	return !db.writable
+}
+
+// ChangePassphrase encrypts the key of the database with a new passphrase. The entries of the database are not
+// changed, so it only takes as long as deriving the keys of the passphrases.
+func (db *DB) ChangePassphrase(oldPassphrase, newPassphrase []byte) (e error) {
+	db.rekeyMtx.Lock()
+	defer db.rekeyMtx.Unlock()
+	var dataKey []byte
+	if dataKey, e = db.currentHeader().unwrap(oldPassphrase); e != nil {
+		return e
+	}
+	defer zero(dataKey)
+	var h *header
+	if h, e = newHeader(newPassphrase, dataKey); E.Chk(e) {
+		return e
+	}
+	if e = db.putHeader(h); E.Chk(e) {
+		return e
+	}
+	db.mtx.Lock()
+	db.header = h
+	db.mtx.Unlock()
+	return nil
+}
+
+// currentHeader returns the header of the database.
+func (db *DB) currentHeader() *header {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	return db.header
+}
+
+// putHeader replaces the stored header.
+func (db *DB) putHeader(h *header) (e error) {
+	return walletdb.Update(
+		db.inner, func(tx walletdb.ReadWriteTx) (e error) {
+			return tx.ReadWriteBucket(headerBucketName).Put(headerKeyName, h.serialize())
+		},
+	)
+}
+
+// RotateKey encrypts every entry of the database again with a new key, which is encrypted with the passphrase. It is
+// done in a single transaction of the wrapped database, so the database is left as it was if it fails.
+//
+// Transactions that are open when RotateKey commits keep using the old key, so it should be called when no other
+// transactions are open.
+func (db *DB) RotateKey(passphrase []byte) (e error) {
+	db.rekeyMtx.Lock()
+	defer db.rekeyMtx.Unlock()
+	var oldKey, newKey []byte
+	if oldKey, e = db.currentHeader().unwrap(passphrase); e != nil {
+		return e
+	}
+	defer zero(oldKey)
+	if newKey, e = newDataKey(); E.Chk(e) {
+		return e
+	}
+	defer zero(newKey)
+	var h *header
+	if h, e = newHeader(passphrase, newKey); E.Chk(e) {
+		return e
+	}
+	var prevKeys, nextKeys *keys
+	if prevKeys, e = newKeys(oldKey); E.Chk(e) {
+		return e
+	}
+	defer prevKeys.drop()
+	if nextKeys, e = newKeys(newKey); E.Chk(e) {
+		return e
+	}
+	var tx walletdb.ReadWriteTx
+	if tx, e = db.inner.BeginReadWriteTx(); E.Chk(e) {
+		return e
+	}
+	if e = reencrypt(tx, prevKeys, nextKeys, h); E.Chk(e) {
+		_ = tx.Rollback()
+		nextKeys.drop()
+		return e
+	}
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	if e = tx.Commit(); E.Chk(e) {
+		nextKeys.drop()
+		return e
+	}
+	db.header = h
+	// A locked database stays locked with the new key.
+	if db.keys == nil {
+		nextKeys.drop()
+		return nil
+	}
+	db.keys.drop()
+	db.keys = nextKeys
+	return nil
+}
+
+// reencrypt replaces each top level bucket encrypted with the keys in from with a copy encrypted with the keys in to,
+// and stores the new header.
+func reencrypt(tx walletdb.ReadWriteTx, from, to *keys, h *header) (e error) {
+	hb := tx.ReadWriteBucket(headerBucketName)
+	registry := hb.NestedReadWriteBucket(registryBucketName)
+	var sealedNames [][]byte
+	if e = registry.ForEach(
+		func(k, v []byte) error {
+			sealedNames = append(sealedNames, append([]byte{}, k...))
+			return nil
+		},
+	); E.Chk(e) {
+		return e
+	}
+	for _, sealed := range sealedNames {
+		var name []byte
+		if name, e = from.openKey(nil, sealed); E.Chk(e) {
+			return e
+		}
+		src := tx.ReadWriteBucket(sealed)
+		newSealed := to.sealKey(nil, name)
+		var dst walletdb.ReadWriteBucket
+		if dst, e = tx.CreateTopLevelBucket(newSealed); E.Chk(e) {
+			return e
+		}
+		if src != nil {
+			if e = reencryptBucket(
+				src, dst, from, to, from.bucketID(nil, name), to.bucketID(nil, name),
+			); E.Chk(e) {
+				return e
+			}
+			if e = tx.DeleteTopLevelBucket(sealed); E.Chk(e) {
+				return e
+			}
+		}
+		if e = registry.Delete(sealed); E.Chk(e) {
+			return e
+		}
+		if e = registry.Put(newSealed, []byte{}); E.Chk(e) {
+			return e
+		}
+	}
+	return hb.Put(headerKeyName, h.serialize())
+}
+
+// reencryptBucket copies the entries and nested buckets of src into dst, decrypting them with the keys in from and
+// encrypting them with the keys in to.
+func reencryptBucket(src, dst walletdb.ReadWriteBucket, from, to *keys, oldID, newID []byte) (e error) {
+	c := src.ReadCursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		var key []byte
+		if key, e = from.openKey(oldID, k); E.Chk(e) {
+			return e
+		}
+		sealedKey := to.sealKey(newID, key)
+		if v == nil {
+			var child walletdb.ReadWriteBucket
+			if child, e = dst.CreateBucket(sealedKey); E.Chk(e) {
+				return e
+			}
+			if e = reencryptBucket(
+				src.NestedReadWriteBucket(k), child, from, to, from.bucketID(oldID, key),
+				to.bucketID(newID, key),
+			); E.Chk(e) {
+				return e
+			}
+			continue
+		}
+		var value, sealedValue []byte
+		if value, e = from.openValue(oldID, k, v); E.Chk(e) {
+			return e
+		}
+		if sealedValue, e = to.sealValue(newID, sealedKey, value); E.Chk(e) {
+			return e
+		}
+		if e = dst.Put(sealedKey, sealedValue); E.Chk(e) {
+			return e
+		}
+	}
+	return nil
+}
+
+// BeginReadTx opens a database read transaction, which returns ErrLocked unless the keys of the database were derived
+// when it was opened or unlocked.
+//
+// This function is part of the walletdb.DB interface implementation.
+func (db *DB) BeginReadTx() (t walletdb.ReadTx, e error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	if db.keys == nil {
+		return nil, ErrLocked
+	}
+	var tx walletdb.ReadTx
+	if tx, e = db.inner.BeginReadTx(); E.Chk(e) {
+		return nil, e
+	}
+	return newTransaction(db.keys, tx, nil), nil
+}
+
+// BeginReadWriteTx opens a database read+write transaction, which returns ErrLocked unless the database was unlocked.
+//
+// This function is part of the walletdb.DB interface implementation.
+func (db *DB) BeginReadWriteTx() (t walletdb.ReadWriteTx, e error) {
+	if db.Locked() {
+		return nil, ErrLocked
+	}
+	var tx walletdb.ReadWriteTx
+	if tx, e = db.inner.BeginReadWriteTx(); E.Chk(e) {
+		return nil, e
+	}
+	// The keys are taken once the transaction is open, when RotateKey can no longer be replacing them.
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	if db.keys == nil || !db.writable {
+		// The database was locked while the transaction was being opened.
+		if e = tx.Rollback(); E.Chk(e) {
+		}
+		return nil, ErrLocked
+	}
+	return newTransaction(db.keys, tx, tx), nil
+}
+
+// Copy writes a copy of the wrapped database to the writer, which stays encrypted and can be opened with the same
+// passphrase. The database does not need to be unlocked.
+//
+// This function is part of the walletdb.DB interface implementation.
+func (db *DB) Copy(w io.Writer) error {
+	return db.inner.Copy(w)
+}
+
+// Close closes the wrapped database and drops the keys.
+//
+// This function is part of the walletdb.DB interface implementation.
+func (db *DB) Close() error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	if db.keys != nil {
+		db.keys.drop()
+		db.keys = nil
+	}
+	return db.inner.Close()
+}
+
+// transaction is a transaction of the wrapped database along with the keys the database had when it began. It
+// implements the walletdb transaction interfaces.
+type transaction struct {
+	keys *keys
+	r    walletdb.ReadTx
+	// w is the same transaction as r when it is a read-write transaction, and nil otherwise.
+	w walletdb.ReadWriteTx
+	// indexes are the decrypted keys of the buckets cursors were opened on in order, by bucket identifier, so that a
+	// bucket is decrypted once in a transaction rather than for every cursor.
+	indexes map[string][]indexEntry
+	// err is ErrCorrupt once an entry read in the transaction did not decrypt, which Commit and Rollback return.
+	err error
+	// ended is whether the transaction was committed or rolled back, after which it no longer uses the keys.
+	ended bool
+}
+
+// newTransaction returns a transaction of the wrapped database using the keys, which are not wiped until it ends.
+func newTransaction(k *keys, r walletdb.ReadTx, w walletdb.ReadWriteTx) *transaction {
+	k.acquire()
+	return &transaction{keys: k, r: r, w: w, indexes: make(map[string][]indexEntry)}
+}
+
+// end records that the transaction no longer uses the keys.
+func (tx *transaction) end() {
+	if !tx.ended {
+		tx.ended = true
+		tx.keys.release()
+	}
+}
+
+// fail records that an entry of the bucket with the identifier did not decrypt, so that the transaction fails.
+func (tx *transaction) fail(id []byte, e error) {
+	E.F("entry of encrypted bucket %x does not decrypt, the database is damaged: %v", id, e)
+	tx.err = ErrCorrupt
+}
+
+// ReadBucket opens the top level bucket with the key for read only access, or returns nil if it does not exist.
+//
+// This function is part of the walletdb.ReadTx interface implementation.
+func (tx *transaction) ReadBucket(key []byte) walletdb.ReadBucket {
+	if tx.ended {
+		return nil
+	}
+	rb := tx.r.ReadBucket(tx.keys.sealKey(nil, key))
+	if rb == nil {
+		return nil
+	}
+	return &bucket{tx: tx, id: tx.keys.bucketID(nil, key), r: rb}
+}
+
+// ReadWriteBucket opens the top level bucket with the key for read/write access, or returns nil if it does not exist.
+//
+// This function is part of the walletdb.ReadWriteTx interface implementation.
+func (tx *transaction) ReadWriteBucket(key []byte) walletdb.ReadWriteBucket {
+	if tx.w == nil || tx.ended {
+		return nil
+	}
+	rwb := tx.w.ReadWriteBucket(tx.keys.sealKey(nil, key))
+	if rwb == nil {
+		return nil
+	}
+	return newBucket(tx, tx.keys.bucketID(nil, key), rwb)
+}
+
+// CreateTopLevelBucket creates the top level bucket for a key if it does not exist and returns it.
+//
+// This function is part of the walletdb.ReadWriteTx interface implementation.
+func (tx *transaction) CreateTopLevelBucket(key []byte) (rwb walletdb.ReadWriteBucket, e error) {
+	if tx.w == nil {
+		return nil, walletdb.ErrTxNotWritable
+	}
+	if tx.ended {
+		return nil, walletdb.ErrTxClosed
+	}
+	sealed := tx.keys.sealKey(nil, key)
+	if rwb, e = tx.w.CreateTopLevelBucket(sealed); e != nil {
+		return nil, e
+	}
+	if e = tx.registry().Put(sealed, []byte{}); E.Chk(e) {
+		return nil, e
+	}
+	return newBucket(tx, tx.keys.bucketID(nil, key), rwb), nil
+}
+
+// DeleteTopLevelBucket deletes the top level bucket for a key.
+//
+// This function is part of the walletdb.ReadWriteTx interface implementation.
+func (tx *transaction) DeleteTopLevelBucket(key []byte) (e error) {
+	if tx.w == nil {
+		return walletdb.ErrTxNotWritable
+	}
+	if tx.ended {
+		return walletdb.ErrTxClosed
+	}
+	sealed := tx.keys.sealKey(nil, key)
+	if e = tx.w.DeleteTopLevelBucket(sealed); e != nil {
+		return e
+	}
+	tx.forgetIndexes()
+	return tx.registry().Delete(sealed)
+}
+
+// registry returns the bucket listing the encrypted names of the top level buckets.
+func (tx *transaction) registry() walletdb.ReadWriteBucket {
+	return tx.w.ReadWriteBucket(headerBucketName).NestedReadWriteBucket(registryBucketName)
+}
+
+// forgetIndexes drops the indexes of the transaction once a bucket is deleted, as they may include those of the
+// buckets nested in it, which would be stale if a bucket of the same name is created again.
+func (tx *transaction) forgetIndexes() {
+	tx.indexes = make(map[string][]indexEntry)
+}
+
+// Commit commits the transaction of the wrapped database. If an entry read in the transaction did not decrypt, the
+// transaction is rolled back instead and ErrCorrupt is returned, as what was written may depend on the missing entry.
+//
+// This function is part of the walletdb.ReadWriteTx interface implementation.
+func (tx *transaction) Commit() error {
+	if tx.w == nil {
+		return walletdb.ErrTxNotWritable
+	}
+	defer tx.end()
+	if tx.err != nil {
+		if e := tx.w.Rollback(); E.Chk(e) {
+		}
+		return tx.err
+	}
+	return tx.w.Commit()
+}
+
+// Rollback rolls back the transaction of the wrapped database. It returns ErrCorrupt if an entry read in the
+// transaction did not decrypt, so that the failure is not lost by callers that only look at the end of a transaction.
+//
+// This function is part of the walletdb.ReadTx interface implementation.
+func (tx *transaction) Rollback() (e error) {
+	defer tx.end()
+	if e = tx.r.Rollback(); e != nil {
+		return e
+	}
+	return tx.err
+}
+
+// bucket is a bucket of the wrapped database whose keys and values are encrypted with the identifier of the bucket. It
+// implements the walletdb bucket interfaces.
+type bucket struct {
+	tx *transaction
+	id []byte
+	r  walletdb.ReadBucket
+	// w is the same bucket as r in a read-write transaction, and nil otherwise.
+	w walletdb.ReadWriteBucket
+}
+
+// Enforce bucket implements the walletdb bucket interfaces.
+var _ walletdb.ReadWriteBucket = (*bucket)(nil)
+
+// newBucket returns a bucket of a read-write transaction.
+func newBucket(tx *transaction, id []byte, rwb walletdb.ReadWriteBucket) *bucket {
+	return &bucket{tx: tx, id: id, r: rwb, w: rwb}
+}
+
+// NestedReadBucket retrieves a nested bucket with the given key. Returns nil if the bucket does not exist.
+//
+// This function is part of the walletdb.ReadBucket interface implementation.
+func (b *bucket) NestedReadBucket(key []byte) walletdb.ReadBucket {
+	rb := b.r.NestedReadBucket(b.tx.keys.sealKey(b.id, key))
+	if rb == nil {
+		return nil
+	}
+	return &bucket{tx: b.tx, id: b.tx.keys.bucketID(b.id, key), r: rb}
+}
+
+// NestedReadWriteBucket retrieves a nested bucket with the given key. Returns nil if the bucket does not exist.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) NestedReadWriteBucket(key []byte) walletdb.ReadWriteBucket {
+	if b.w == nil {
+		return nil
+	}
+	rwb := b.w.NestedReadWriteBucket(b.tx.keys.sealKey(b.id, key))
+	if rwb == nil {
+		return nil
+	}
+	return newBucket(b.tx, b.tx.keys.bucketID(b.id, key), rwb)
+}
+
+// CreateBucket creates and returns a new nested bucket with the given key.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) CreateBucket(key []byte) (rwb walletdb.ReadWriteBucket, e error) {
+	if b.w == nil {
+		return nil, walletdb.ErrTxNotWritable
+	}
+	sealedKey := b.tx.keys.sealKey(b.id, key)
+	if rwb, e = b.w.CreateBucket(sealedKey); e != nil {
+		return nil, e
+	}
+	b.indexPut(key, sealedKey, true)
+	return newBucket(b.tx, b.tx.keys.bucketID(b.id, key), rwb), nil
+}
+
+// CreateBucketIfNotExists creates and returns a new nested bucket with the given key if it does not already exist.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) CreateBucketIfNotExists(key []byte) (rwb walletdb.ReadWriteBucket, e error) {
+	if b.w == nil {
+		return nil, walletdb.ErrTxNotWritable
+	}
+	sealedKey := b.tx.keys.sealKey(b.id, key)
+	if rwb, e = b.w.CreateBucketIfNotExists(sealedKey); e != nil {
+		return nil, e
+	}
+	b.indexPut(key, sealedKey, true)
+	return newBucket(b.tx, b.tx.keys.bucketID(b.id, key), rwb), nil
+}
+
+// DeleteNestedBucket removes a nested bucket with the given key.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) DeleteNestedBucket(key []byte) (e error) {
+	if b.w == nil {
+		return walletdb.ErrTxNotWritable
+	}
+	if e = b.w.DeleteNestedBucket(b.tx.keys.sealKey(b.id, key)); e != nil {
+		return e
+	}
+	b.tx.forgetIndexes()
+	return nil
+}
+
+// ForEach invokes the passed function with every key/value pair in the bucket in the order of the keys, with a nil
+// value for nested buckets. It returns ErrCorrupt if an entry of the bucket does not decrypt.
+//
+// This function is part of the walletdb.ReadBucket interface implementation.
+func (b *bucket) ForEach(fn func(k, v []byte) error) (e error) {
+	c := b.newCursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if e = fn(k, v); e != nil {
+			return e
+		}
+	}
+	return c.err
+}
+
+// Get returns the value for the given key, or nil if the key does not exist. A value that does not decrypt is also
+// returned as nil, and makes the transaction fail with ErrCorrupt.
+//
+// This function is part of the walletdb.ReadBucket interface implementation.
+func (b *bucket) Get(key []byte) []byte {
+	return b.get(b.tx.keys.sealKey(b.id, key))
+}
+
+// get returns the decrypted value of the entry with the encrypted key, or nil if there is none or it does not decrypt.
+func (b *bucket) get(sealedKey []byte) []byte {
+	sealed := b.r.Get(sealedKey)
+	if sealed == nil {
+		return nil
+	}
+	value, e := b.tx.keys.openValue(b.id, sealedKey, sealed)
+	if e != nil {
+		b.tx.fail(b.id, e)
+		return nil
+	}
+	return value
+}
+
+// Put saves the specified key/value pair to the bucket.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) Put(key, value []byte) (e error) {
+	if b.w == nil {
+		return walletdb.ErrTxNotWritable
+	}
+	if len(key) == 0 {
+		return walletdb.ErrKeyRequired
+	}
+	sealedKey := b.tx.keys.sealKey(b.id, key)
+	var sealed []byte
+	if sealed, e = b.tx.keys.sealValue(b.id, sealedKey, value); E.Chk(e) {
+		return e
+	}
+	if e = b.w.Put(sealedKey, sealed); e != nil {
+		return e
+	}
+	b.indexPut(key, sealedKey, false)
+	return nil
+}
+
+// Delete removes the specified key from the bucket.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) Delete(key []byte) (e error) {
+	if b.w == nil {
+		return walletdb.ErrTxNotWritable
+	}
+	if e = b.w.Delete(b.tx.keys.sealKey(b.id, key)); e != nil {
+		return e
+	}
+	b.indexDelete(key)
+	return nil
+}
+
+// ReadCursor returns a new cursor over the bucket.
+//
+// This function is part of the walletdb.ReadBucket interface implementation.
+func (b *bucket) ReadCursor() walletdb.ReadCursor {
+	return b.newCursor()
+}
+
+// ReadWriteCursor returns a new cursor over the bucket.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) ReadWriteCursor() walletdb.ReadWriteCursor {
+	return b.newCursor()
+}
+
+// indexEntry is a decrypted key of a bucket along with its encrypted form.
+type indexEntry struct {
+	key, sealedKey []byte
+	// bucket is whether the entry is a nested bucket.
+	bucket bool
+}
+
+// searchIndex returns the position of the first entry of the index whose key is not before the given key.
+func searchIndex(entries []indexEntry, key []byte) int {
+	return sort.Search(
+		len(entries), func(i int) bool {
+			return bytes.Compare(entries[i].key, key) >= 0
+		},
+	)
+}
+
+// index returns the decrypted keys of the bucket in order. As the encrypted keys are in another order, all the keys
+// of the bucket are decrypted the first time in a transaction, and the index is kept in the transaction and updated by
+// the writes to the bucket. An index is never changed once made, so cursors keep the one they were opened with.
+func (b *bucket) index() (entries []indexEntry, e error) {
+	var ok bool
+	if entries, ok = b.tx.indexes[string(b.id)]; ok {
+		return entries, nil
+	}
+	rc := b.r.ReadCursor()
+	for k, v := rc.First(); k != nil; k, v = rc.Next() {
+		var key []byte
+		if key, e = b.tx.keys.openKey(b.id, k); e != nil {
+			b.tx.fail(b.id, e)
+			return nil, ErrCorrupt
+		}
+		entries = append(entries, indexEntry{key: key, sealedKey: append([]byte{}, k...), bucket: v == nil})
+	}
+	sort.Slice(
+		entries, func(i, j int) bool {
+			return bytes.Compare(entries[i].key, entries[j].key) < 0
+		},
+	)
+	b.tx.indexes[string(b.id)] = entries
+	return entries, nil
+}
+
+// indexPut adds a key written to the bucket to its index, if the index was made in the transaction.
+func (b *bucket) indexPut(key, sealedKey []byte, isBucket bool) {
+	entries, ok := b.tx.indexes[string(b.id)]
+	if !ok {
+		return
+	}
+	i := searchIndex(entries, key)
+	if i < len(entries) && bytes.Equal(entries[i].key, key) {
+		return
+	}
+	next := make([]indexEntry, 0, len(entries)+1)
+	next = append(next, entries[:i]...)
+	next = append(next, indexEntry{key: append([]byte{}, key...), sealedKey: sealedKey, bucket: isBucket})
+	b.tx.indexes[string(b.id)] = append(next, entries[i:]...)
+}
+
+// indexDelete removes a key deleted from the bucket from its index, if the index was made in the transaction.
+func (b *bucket) indexDelete(key []byte) {
+	entries, ok := b.tx.indexes[string(b.id)]
+	if !ok {
+		return
+	}
+	i := searchIndex(entries, key)
+	if i == len(entries) || !bytes.Equal(entries[i].key, key) {
+		return
+	}
+	next := make([]indexEntry, 0, len(entries)-1)
+	next = append(next, entries[:i]...)
+	b.tx.indexes[string(b.id)] = append(next, entries[i+1:]...)
+}
+
+// cursor iterates over the entries of a bucket in the order of their decrypted keys, using the index of the bucket.
+// Values are decrypted as the cursor reaches them.
+//
+// As with the cursors of other drivers, keys added to or removed from the bucket other than through cursor.Delete are
+// not seen by a cursor that is already open, apart from removed entries being skipped.
+type cursor struct {
+	b       *bucket
+	entries []indexEntry
+	// deleted are the positions of the entries deleted through the cursor.
+	deleted map[int]struct{}
+	i       int
+	// err is ErrCorrupt when an entry of the bucket did not decrypt, after which the cursor returns no entries.
+	err error
+}
+
+// newCursor returns a cursor over the entries of the bucket. If a key does not decrypt the cursor is empty and the
+// transaction fails with ErrCorrupt.
+func (b *bucket) newCursor() *cursor {
+	entries, e := b.index()
+	return &cursor{b: b, entries: entries, deleted: make(map[int]struct{}), err: e}
+}
+
+// move positions the cursor at the first entry from i in the direction of step that is still in the bucket, and
+// returns it.
+func (c *cursor) move(i, step int) (key, value []byte) {
+	for ; c.err == nil && i >= 0 && i < len(c.entries); i += step {
+		if _, ok := c.deleted[i]; ok {
+			continue
+		}
+		entry := &c.entries[i]
+		if entry.bucket {
+			c.i = i
+			return entry.key, nil
+		}
+		if value = c.b.get(entry.sealedKey); value != nil {
+			c.i = i
+			return entry.key, value
+		}
+		if c.b.tx.err != nil {
+			c.err = c.b.tx.err
+		}
+	}
+	if c.err != nil {
+		i = len(c.entries)
+	}
+	c.i = i
+	return nil, nil
+}
+
+// First positions the cursor at the first key/value pair and returns the pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) First() (key, value []byte) {
+	return c.move(0, 1)
+}
+
+// Last positions the cursor at the last key/value pair and returns the pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) Last() (key, value []byte) {
+	return c.move(len(c.entries)-1, -1)
+}
+
+// Next moves the cursor one key/value pair forward and returns the new pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) Next() (key, value []byte) {
+	if c.i >= len(c.entries) {
+		return nil, nil
+	}
+	return c.move(c.i+1, 1)
+}
+
+// Prev moves the cursor one key/value pair backward and returns the new pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) Prev() (key, value []byte) {
+	if c.i < 0 {
+		return nil, nil
+	}
+	return c.move(c.i-1, -1)
+}
+
+// Seek positions the cursor at the passed seek key, or the next key after it if it does not exist, and returns the
+// pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) Seek(seek []byte) (key, value []byte) {
+	return c.move(searchIndex(c.entries, seek), 1)
+}
+
+// Delete removes the current key/value pair the cursor is at without invalidating the cursor. Returns
+// ErrIncompatibleValue if the cursor is at a nested bucket.
+//
+// This function is part of the walletdb.ReadWriteCursor interface implementation.
+func (c *cursor) Delete() (e error) {
+	if c.b.w == nil {
+		return walletdb.ErrTxNotWritable
+	}
+	if c.i < 0 || c.i >= len(c.entries) {
+		return nil
+	}
+	current := &c.entries[c.i]
+	if current.bucket {
+		return walletdb.ErrIncompatibleValue
+	}
+	if e = c.b.w.Delete(current.sealedKey); E.Chk(e) {
+		return e
+	}
+	c.deleted[c.i] = struct{}{}
+	c.b.indexDelete(current.key)
+	return nil
+}
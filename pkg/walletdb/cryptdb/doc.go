@@ -0,0 +1,48 @@
+/*Package cryptdb implements an instance of walletdb that encrypts the keys and values of another walletdb database,
+so that the transaction history and addresses of a wallet are not readable from its file without the passphrase.
+
+Usage
+
+This package is only a driver to the walletdb package and provides the database type of "cryptdb". The Open and Create
+functions take the type of the database to wrap, the passphrase as a []byte and then the arguments of the wrapped
+database:
+
+	db, e := walletdb.Create("cryptdb", "bdb", passphrase, "path/to/database.db")
+	if e != nil  {
+		// Handle error
+	}
+	db, e := walletdb.Open("cryptdb", "bdb", passphrase, "path/to/database.db")
+	if e != nil  {
+		// Handle error
+	}
+
+A created database is unlocked. An opened database is read-only: the keys are derived from the passphrase so read
+transactions work, but read-write transactions return ErrLocked until it is unlocked. With a nil passphrase the
+database is opened without deriving its keys, and read transactions return ErrLocked as well until it is unlocked:
+
+	if e := db.(*cryptdb.DB).Unlock(passphrase); e != nil {
+		// Handle error
+	}
+
+Lock drops the keys again, which are wiped once the transactions that are still open end, and refuses all
+transactions until the database is unlocked again.
+
+Encryption
+
+Each database has a random data key, which is stored encrypted with a key derived from the passphrase with scrypt. The
+passphrase can be changed with ChangePassphrase, which only encrypts the data key again, and RotateKey replaces the
+data key and encrypts every entry again with the new key.
+
+Keys and bucket names are encrypted with XChaCha20-Poly1305 using a nonce derived from the key, so that they are
+always encrypted the same way and can be looked up, and values with a random nonce. Each entry is authenticated along
+with the bucket it is in, so entries can not be moved around or changed without the key. As the order of the
+encrypted keys says nothing about the order of the keys, the keys of a bucket are decrypted and sorted the first time a
+cursor is opened on it in a transaction, and kept for the rest of the transaction so cursors can return them in order.
+
+An entry that does not decrypt was damaged or changed without the key. Reading it makes the transaction fail with
+ErrCorrupt, which ForEach returns at once and Commit and Rollback return at the end of the transaction.
+
+The names of the top level buckets, the number of entries in each bucket and the size of the keys and values are not
+hidden.
+*/
+package cryptdb
@@ -0,0 +1,104 @@
+package cryptdb
+
+import (
+	"fmt"
+
+	"github.com/p9c/parallelcoin/pkg/walletdb"
+)
+
+const (
+	dbType = "cryptdb"
+)
+
+// parseArgs parses the arguments from the walletdb Open/Create methods, which are the type of the wrapped database,
+// the passphrase and the arguments of the wrapped database. The passphrase may be nil.
+func parseArgs(funcName string, args ...interface{}) (innerType string, passphrase []byte, innerArgs []interface{}, e error) {
+	if len(args) < 2 {
+		return "", nil, nil, fmt.Errorf(
+			"invalid arguments to %s.%s -- "+
+				"expected database type, passphrase and database arguments", dbType, funcName,
+		)
+	}
+	var ok bool
+	if innerType, ok = args[0].(string); !ok {
+		return "", nil, nil, fmt.Errorf(
+			"first argument to %s.%s is invalid -- "+
+				"expected database type string", dbType, funcName,
+		)
+	}
+	if passphrase, ok = args[1].([]byte); !ok && args[1] != nil {
+		return "", nil, nil, fmt.Errorf(
+			"second argument to %s.%s is invalid -- "+
+				"expected passphrase []byte", dbType, funcName,
+		)
+	}
+	return innerType, passphrase, args[2:], nil
+}
+
+// openDBDriver is the callback provided during driver registration that opens an existing database for use. The
+// database is returned read-only with the keys derived from the passphrase, or locked without keys when the passphrase
+// is nil, and read-write transactions need it to be unlocked.
+func openDBDriver(args ...interface{}) (d walletdb.DB, e error) {
+	var innerType string
+	var passphrase []byte
+	var innerArgs []interface{}
+	if innerType, passphrase, innerArgs, e = parseArgs("Open", args...); E.Chk(e) {
+		return
+	}
+	var inner walletdb.DB
+	if inner, e = walletdb.Open(innerType, innerArgs...); e != nil {
+		return nil, e
+	}
+	var db *DB
+	if db, e = openDB(inner); e == nil && passphrase != nil {
+		e = db.deriveKeys(passphrase, false)
+	}
+	if e != nil {
+		if ce := inner.Close(); E.Chk(ce) {
+		}
+		return nil, e
+	}
+	return db, nil
+}
+
+// createDBDriver is the callback provided during driver registration that creates, initializes, and opens a database
+// for use. The database is returned unlocked.
+func createDBDriver(args ...interface{}) (d walletdb.DB, e error) {
+	var innerType string
+	var passphrase []byte
+	var innerArgs []interface{}
+	if innerType, passphrase, innerArgs, e = parseArgs("Create", args...); E.Chk(e) {
+		return
+	}
+	if passphrase == nil {
+		return nil, fmt.Errorf("a passphrase is required to create a %s database", dbType)
+	}
+	var inner walletdb.DB
+	if inner, e = walletdb.Create(innerType, innerArgs...); e != nil {
+		return nil, e
+	}
+	var db *DB
+	if db, e = createDB(inner, passphrase); e != nil {
+		if ce := inner.Close(); E.Chk(ce) {
+		}
+		return nil, e
+	}
+	return db, nil
+}
+func init() {
+	// Register the driver.
+	driver := walletdb.Driver{
+		DbType: dbType,
+		Create: createDBDriver,
+		Open:   openDBDriver,
+	}
+	var e error
+	if e = walletdb.RegisterDriver(driver); E.Chk(e) {
+		panic(
+			fmt.Sprintf(
+				"Failed to regiser database driver '%s': %v",
+				dbType, e,
+			),
+		)
+	}
+}
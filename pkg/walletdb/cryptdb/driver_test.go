@@ -0,0 +1,466 @@
+package cryptdb_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/p9c/parallelcoin/pkg/walletdb"
+	_ "github.com/p9c/parallelcoin/pkg/walletdb/bdb"
+	"github.com/p9c/parallelcoin/pkg/walletdb/cryptdb"
+)
+
+// dbType is the database type name for this driver.
+const dbType = "cryptdb"
+
+// passphrase is the passphrase of the test databases.
+var passphrase = []byte("passphrase")
+
+// bucketName and secret are a bucket and value that must not appear in the file of an encrypted database.
+var (
+	bucketName = []byte("secretbucket")
+	secret     = []byte("secretvalue")
+)
+
+// createTestDB creates an encrypted database in a temporary directory holding the secret, and returns it along with
+// its path.
+func createTestDB(t *testing.T) (db walletdb.DB, dbPath string) {
+	dbPath = filepath.Join(t.TempDir(), "crypt.db")
+	db, e := walletdb.Create(dbType, "bdb", passphrase, dbPath)
+	if e != nil {
+		t.Fatalf("Create: unexpected error: %v", e)
+	}
+	e = walletdb.Update(
+		db, func(tx walletdb.ReadWriteTx) (e error) {
+			var b walletdb.ReadWriteBucket
+			if b, e = tx.CreateTopLevelBucket(bucketName); e != nil {
+				return e
+			}
+			var nested walletdb.ReadWriteBucket
+			if nested, e = b.CreateBucket([]byte("nested")); e != nil {
+				return e
+			}
+			if e = nested.Put([]byte("key"), secret); e != nil {
+				return e
+			}
+			return b.Put([]byte("key"), secret)
+		},
+	)
+	if e != nil {
+		t.Fatalf("Update: unexpected error: %v", e)
+	}
+	return db, dbPath
+}
+
+// checkSecret ensures the secret can be read from the database, and that it can not be read from its file.
+func checkSecret(t *testing.T, db walletdb.DB, dbPath string) {
+	e := walletdb.View(
+		db, func(tx walletdb.ReadTx) error {
+			b := tx.ReadBucket(bucketName)
+			if b == nil {
+				t.Fatalf("ReadBucket: bucket is missing")
+			}
+			if v := b.Get([]byte("key")); !bytes.Equal(v, secret) {
+				t.Errorf("Get: got %q, want %q", v, secret)
+			}
+			if v := b.NestedReadBucket([]byte("nested")).Get([]byte("key")); !bytes.Equal(v, secret) {
+				t.Errorf("Get nested: got %q, want %q", v, secret)
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Fatalf("View: unexpected error: %v", e)
+	}
+	file, e := ioutil.ReadFile(dbPath)
+	if e != nil {
+		t.Fatalf("ReadFile: unexpected error: %v", e)
+	}
+	if bytes.Contains(file, secret) || bytes.Contains(file, bucketName) {
+		t.Errorf("the file of the database is not encrypted")
+	}
+}
+
+// TestCreateOpenFail ensures that errors related to creating and opening a database are handled properly.
+func TestCreateOpenFail(t *testing.T) {
+	if _, e := walletdb.Open(dbType, "bdb"); e == nil {
+		t.Errorf("Open: expected an error for missing arguments")
+	}
+	if _, e := walletdb.Create(dbType, "bdb", "passphrase", "path"); e == nil {
+		t.Errorf("Create: expected an error for a passphrase that is not []byte")
+	}
+	dir := t.TempDir()
+	wantErr := walletdb.ErrDbDoesNotExist
+	if _, e := walletdb.Open(dbType, "bdb", passphrase, filepath.Join(dir, "noexist.db")); e != wantErr {
+		t.Errorf("Open: got %v, want %v", e, wantErr)
+	}
+	// A database that was not created by the driver can not be opened with it.
+	plainPath := filepath.Join(dir, "plain.db")
+	plain, e := walletdb.Create("bdb", plainPath)
+	if e != nil {
+		t.Fatalf("Create: unexpected error: %v", e)
+	}
+	if e = plain.Close(); e != nil {
+		t.Fatalf("Close: unexpected error: %v", e)
+	}
+	if _, e = walletdb.Open(dbType, "bdb", passphrase, plainPath); e != cryptdb.ErrNotEncrypted {
+		t.Errorf("Open: got %v, want %v", e, cryptdb.ErrNotEncrypted)
+	}
+	db, dbPath := createTestDB(t)
+	if e = db.Close(); e != nil {
+		t.Fatalf("Close: unexpected error: %v", e)
+	}
+	if _, e = walletdb.Open(dbType, "bdb", []byte("wrong"), dbPath); e != cryptdb.ErrWrongPassphrase {
+		t.Errorf("Open: got %v, want %v", e, cryptdb.ErrWrongPassphrase)
+	}
+}
+
+// TestReadOnly ensures a database opened with the passphrase can be read but not written until it is unlocked, and that
+// locking it refuses reads as well.
+func TestReadOnly(t *testing.T) {
+	db, dbPath := createTestDB(t)
+	if e := db.Close(); e != nil {
+		t.Fatalf("Close: unexpected error: %v", e)
+	}
+	opened, e := walletdb.Open(dbType, "bdb", passphrase, dbPath)
+	if e != nil {
+		t.Fatalf("Open: unexpected error: %v", e)
+	}
+	defer func() {
+		if e := opened.Close(); e != nil {
+			t.Errorf("Close: unexpected error: %v", e)
+		}
+	}()
+	cdb := opened.(*cryptdb.DB)
+	if !cdb.Locked() {
+		t.Fatalf("Locked: an opened database should be locked until it is unlocked")
+	}
+	checkSecret(t, opened, dbPath)
+	e = walletdb.Update(
+		opened, func(tx walletdb.ReadWriteTx) error {
+			return tx.ReadWriteBucket(bucketName).Put([]byte("other"), secret)
+		},
+	)
+	if e != cryptdb.ErrLocked {
+		t.Fatalf("Update before Unlock: got %v, want %v", e, cryptdb.ErrLocked)
+	}
+	if e = cdb.Unlock([]byte("wrong")); e != cryptdb.ErrWrongPassphrase {
+		t.Fatalf("Unlock: got %v, want %v", e, cryptdb.ErrWrongPassphrase)
+	}
+	if _, e = opened.BeginReadWriteTx(); e != cryptdb.ErrLocked {
+		t.Fatalf("BeginReadWriteTx after a wrong passphrase: got %v, want %v", e, cryptdb.ErrLocked)
+	}
+	if e = cdb.Unlock(passphrase); e != nil {
+		t.Fatalf("Unlock: unexpected error: %v", e)
+	}
+	e = walletdb.Update(
+		opened, func(tx walletdb.ReadWriteTx) error {
+			return tx.ReadWriteBucket(bucketName).Put([]byte("other"), secret)
+		},
+	)
+	if e != nil {
+		t.Fatalf("Update after Unlock: unexpected error: %v", e)
+	}
+	cdb.Lock()
+	if _, e = opened.BeginReadTx(); e != cryptdb.ErrLocked {
+		t.Fatalf("BeginReadTx after Lock: got %v, want %v", e, cryptdb.ErrLocked)
+	}
+}
+
+// TestLock ensures a database opened without the passphrase refuses transactions until it is unlocked, and that locking
+// it again refuses new transactions while those already open keep working.
+func TestLock(t *testing.T) {
+	db, dbPath := createTestDB(t)
+	if e := db.Close(); e != nil {
+		t.Fatalf("Close: unexpected error: %v", e)
+	}
+	opened, e := walletdb.Open(dbType, "bdb", nil, dbPath)
+	if e != nil {
+		t.Fatalf("Open: unexpected error: %v", e)
+	}
+	defer func() {
+		if e := opened.Close(); e != nil {
+			t.Errorf("Close: unexpected error: %v", e)
+		}
+	}()
+	cdb := opened.(*cryptdb.DB)
+	if !cdb.Locked() {
+		t.Fatalf("Locked: a database opened without the passphrase should be locked")
+	}
+	if _, e = opened.BeginReadTx(); e != cryptdb.ErrLocked {
+		t.Fatalf("BeginReadTx: got %v, want %v", e, cryptdb.ErrLocked)
+	}
+	if _, e = opened.BeginReadWriteTx(); e != cryptdb.ErrLocked {
+		t.Fatalf("BeginReadWriteTx: got %v, want %v", e, cryptdb.ErrLocked)
+	}
+	if e = cdb.Unlock([]byte("wrong")); e != cryptdb.ErrWrongPassphrase {
+		t.Fatalf("Unlock: got %v, want %v", e, cryptdb.ErrWrongPassphrase)
+	}
+	if e = cdb.Unlock(passphrase); e != nil {
+		t.Fatalf("Unlock: unexpected error: %v", e)
+	}
+	checkSecret(t, opened, dbPath)
+	e = walletdb.Update(
+		opened, func(tx walletdb.ReadWriteTx) error {
+			return tx.ReadWriteBucket(bucketName).Put([]byte("other"), secret)
+		},
+	)
+	if e != nil {
+		t.Fatalf("Update: unexpected error: %v", e)
+	}
+	tx, e := opened.BeginReadTx()
+	if e != nil {
+		t.Fatalf("BeginReadTx: unexpected error: %v", e)
+	}
+	cdb.Lock()
+	if !cdb.Locked() {
+		t.Fatalf("Locked: a locked database is not locked")
+	}
+	if v := tx.ReadBucket(bucketName).Get([]byte("other")); !bytes.Equal(v, secret) {
+		t.Errorf("Get in a transaction open when the database was locked: got %q, want %q", v, secret)
+	}
+	if e = tx.Rollback(); e != nil {
+		t.Fatalf("Rollback: unexpected error: %v", e)
+	}
+	if _, e = opened.BeginReadTx(); e != cryptdb.ErrLocked {
+		t.Fatalf("BeginReadTx: got %v, want %v", e, cryptdb.ErrLocked)
+	}
+	if _, e = opened.BeginReadWriteTx(); e != cryptdb.ErrLocked {
+		t.Fatalf("BeginReadWriteTx: got %v, want %v", e, cryptdb.ErrLocked)
+	}
+}
+
+// TestRotation ensures the passphrase and the key of a database can be changed while its entries stay readable.
+func TestRotation(t *testing.T) {
+	db, dbPath := createTestDB(t)
+	cdb := db.(*cryptdb.DB)
+	newPassphrase := []byte("new passphrase")
+	if e := cdb.ChangePassphrase([]byte("wrong"), newPassphrase); e != cryptdb.ErrWrongPassphrase {
+		t.Fatalf("ChangePassphrase: got %v, want %v", e, cryptdb.ErrWrongPassphrase)
+	}
+	if e := cdb.ChangePassphrase(passphrase, newPassphrase); e != nil {
+		t.Fatalf("ChangePassphrase: unexpected error: %v", e)
+	}
+	checkSecret(t, db, dbPath)
+	if e := cdb.RotateKey(passphrase); e != cryptdb.ErrWrongPassphrase {
+		t.Fatalf("RotateKey: got %v, want %v", e, cryptdb.ErrWrongPassphrase)
+	}
+	if e := cdb.RotateKey(newPassphrase); e != nil {
+		t.Fatalf("RotateKey: unexpected error: %v", e)
+	}
+	checkSecret(t, db, dbPath)
+	if e := db.Close(); e != nil {
+		t.Fatalf("Close: unexpected error: %v", e)
+	}
+	var e error
+	if _, e = walletdb.Open(dbType, "bdb", passphrase, dbPath); e != cryptdb.ErrWrongPassphrase {
+		t.Fatalf("Open: got %v, want %v", e, cryptdb.ErrWrongPassphrase)
+	}
+	if db, e = walletdb.Open(dbType, "bdb", newPassphrase, dbPath); e != nil {
+		t.Fatalf("Open: unexpected error: %v", e)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("Close: unexpected error: %v", e)
+		}
+	}()
+	checkSecret(t, db, dbPath)
+}
+
+// TestCursor ensures cursors return the entries of a bucket in the order of their keys even though their encrypted
+// keys are in another order.
+func TestCursor(t *testing.T) {
+	db, _ := createTestDB(t)
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("Close: unexpected error: %v", e)
+		}
+	}()
+	keys := []string{"a", "b", "ba", "bb", "c", "d"}
+	e := walletdb.Update(
+		db, func(tx walletdb.ReadWriteTx) (e error) {
+			var b walletdb.ReadWriteBucket
+			if b, e = tx.CreateTopLevelBucket([]byte("cursor")); e != nil {
+				return e
+			}
+			for i := len(keys) - 1; i >= 0; i-- {
+				if keys[i] == "c" {
+					if _, e = b.CreateBucket([]byte(keys[i])); e != nil {
+						return e
+					}
+					continue
+				}
+				if e = b.Put([]byte(keys[i]), []byte(keys[i])); e != nil {
+					return e
+				}
+			}
+			c := b.ReadWriteCursor()
+			if k, _ := c.Seek([]byte("b")); string(k) != "b" {
+				t.Errorf("Seek: got %q, want b", k)
+			}
+			if e = c.Delete(); e != nil {
+				return e
+			}
+			if k, _ := c.Next(); string(k) != "ba" {
+				t.Errorf("Next: got %q, want ba", k)
+			}
+			if k, _ := c.Prev(); string(k) != "a" {
+				t.Errorf("Prev after Delete: got %q, want a", k)
+			}
+			if k, v := c.Seek([]byte("bc")); string(k) != "c" || v != nil {
+				t.Errorf("Seek: got %q %q, want the bucket c", k, v)
+			}
+			if e = c.Delete(); e != walletdb.ErrIncompatibleValue {
+				t.Errorf("Delete: got %v, want %v", e, walletdb.ErrIncompatibleValue)
+			}
+			// A cursor opened after writes in the same transaction sees them.
+			if e = b.Put([]byte("e"), []byte("e")); e != nil {
+				return e
+			}
+			if e = b.Delete([]byte("d")); e != nil {
+				return e
+			}
+			if k, v := b.ReadCursor().Last(); string(k) != "e" || string(v) != "e" {
+				t.Errorf("Last after Put: got %q %q, want e e", k, v)
+			}
+			if e = b.Put([]byte("d"), []byte("d")); e != nil {
+				return e
+			}
+			return b.Delete([]byte("e"))
+		},
+	)
+	if e != nil {
+		t.Fatalf("Update: unexpected error: %v", e)
+	}
+	e = walletdb.View(
+		db, func(tx walletdb.ReadTx) error {
+			var got []string
+			c := tx.ReadBucket([]byte("cursor")).ReadCursor()
+			for k, _ := c.First(); k != nil; k, _ = c.Next() {
+				got = append(got, string(k))
+			}
+			if want := []string{"a", "ba", "bb", "c", "d"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("cursor: got %v, want %v", got, want)
+			}
+			if k, _ := c.Last(); string(k) != "d" {
+				t.Errorf("Last: got %q, want d", k)
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Fatalf("View: unexpected error: %v", e)
+	}
+}
+
+// TestCorrupt ensures an entry that does not decrypt makes Get return nothing, ForEach and cursors fail with
+// ErrCorrupt, and the transaction that read it fail with ErrCorrupt.
+func TestCorrupt(t *testing.T) {
+	db, dbPath := createTestDB(t)
+	if e := db.Close(); e != nil {
+		t.Fatalf("Close: unexpected error: %v", e)
+	}
+	// Change a byte of every value of the encrypted top level buckets in the wrapped database.
+	plain, e := walletdb.Open("bdb", dbPath)
+	if e != nil {
+		t.Fatalf("Open: unexpected error: %v", e)
+	}
+	e = walletdb.Update(
+		plain, func(tx walletdb.ReadWriteTx) (e error) {
+			var names [][]byte
+			registry := tx.ReadWriteBucket([]byte("cryptdb")).NestedReadWriteBucket([]byte("buckets"))
+			if e = registry.ForEach(
+				func(k, v []byte) error {
+					names = append(names, append([]byte{}, k...))
+					return nil
+				},
+			); e != nil {
+				return e
+			}
+			for _, name := range names {
+				b := tx.ReadWriteBucket(name)
+				var keys, values [][]byte
+				c := b.ReadCursor()
+				for k, v := c.First(); k != nil; k, v = c.Next() {
+					if v != nil {
+						keys = append(keys, append([]byte{}, k...))
+						values = append(values, append([]byte{}, v...))
+					}
+				}
+				for i := range keys {
+					values[i][len(values[i])-1] ^= 1
+					if e = b.Put(keys[i], values[i]); e != nil {
+						return e
+					}
+				}
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Fatalf("Update: unexpected error: %v", e)
+	}
+	if e = plain.Close(); e != nil {
+		t.Fatalf("Close: unexpected error: %v", e)
+	}
+	if db, e = walletdb.Open(dbType, "bdb", passphrase, dbPath); e != nil {
+		t.Fatalf("Open: unexpected error: %v", e)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("Close: unexpected error: %v", e)
+		}
+	}()
+	e = walletdb.View(
+		db, func(tx walletdb.ReadTx) error {
+			if v := tx.ReadBucket(bucketName).Get([]byte("key")); v != nil {
+				t.Errorf("Get: got %q for a corrupt value, want nil", v)
+			}
+			return nil
+		},
+	)
+	if e != cryptdb.ErrCorrupt {
+		t.Errorf("View after Get: got %v, want %v", e, cryptdb.ErrCorrupt)
+	}
+	e = walletdb.View(
+		db, func(tx walletdb.ReadTx) error {
+			if k, v := tx.ReadBucket(bucketName).ReadCursor().First(); k != nil {
+				t.Errorf("First: got %q %q from a corrupt bucket, want nothing", k, v)
+			}
+			return tx.ReadBucket(bucketName).ForEach(
+				func(k, v []byte) error {
+					return nil
+				},
+			)
+		},
+	)
+	if e != cryptdb.ErrCorrupt {
+		t.Errorf("ForEach: got %v, want %v", e, cryptdb.ErrCorrupt)
+	}
+	if e = db.(*cryptdb.DB).Unlock(passphrase); e != nil {
+		t.Fatalf("Unlock: unexpected error: %v", e)
+	}
+	e = walletdb.Update(
+		db, func(tx walletdb.ReadWriteTx) error {
+			b := tx.ReadWriteBucket(bucketName)
+			_ = b.Get([]byte("key"))
+			return b.Put([]byte("other"), secret)
+		},
+	)
+	if e != cryptdb.ErrCorrupt {
+		t.Errorf("Update after Get: got %v, want %v", e, cryptdb.ErrCorrupt)
+	}
+	e = walletdb.View(
+		db, func(tx walletdb.ReadTx) error {
+			if v := tx.ReadBucket(bucketName).Get([]byte("other")); v != nil {
+				t.Error("Update: the failed transaction was committed")
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Errorf("View: unexpected error: %v", e)
+	}
+}
@@ -0,0 +1,11 @@
+/*This test file is part of the cryptdb package rather than than the cryptdb_test package so it can bridge access to
+the internals to properly test cases which are either not possible or can't reliably be tested via the public
+interface. The functions are only exported while the tests are being run.
+*/
+
+package cryptdb
+
+func init() {
+	// Deriving keys with the scrypt parameters of a wallet takes most of a second, which is too long for the tests.
+	scryptN = 1 << 10
+}
@@ -0,0 +1,36 @@
+package cryptdb_test
+
+// This file intended to be copied into each backend driver directory. Each driver should have their own driver_test.go
+// file which creates a database and invokes the testInterface function in this file to ensure the driver properly
+// implements the interface. See the bdb backend driver for a working example.
+//
+// NOTE: When copying this file into the backend driver folder, the package name will need to be changed accordingly.
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/p9c/parallelcoin/pkg/walletdb"
+	walletdbtest "github.com/p9c/parallelcoin/pkg/walletdb/ci"
+)
+
+// testDbType is a driver that creates and opens cryptdb databases wrapping bdb with the test passphrase, as the
+// interface tests only pass the path of the database.
+const testDbType = "cryptdb-bdb-test"
+
+func init() {
+	wrap := func(open func(string, ...interface{}) (walletdb.DB, error)) func(...interface{}) (walletdb.DB, error) {
+		return func(args ...interface{}) (walletdb.DB, error) {
+			return open(dbType, append([]interface{}{"bdb", passphrase}, args...)...)
+		}
+	}
+	if e := walletdb.RegisterDriver(
+		walletdb.Driver{DbType: testDbType, Create: wrap(walletdb.Create), Open: wrap(walletdb.Open)},
+	); e != nil {
+		panic(e)
+	}
+}
+
+// TestInterface performs all interfaces tests for this database driver.
+func TestInterface(t *testing.T) {
+	walletdbtest.TestInterface(t, testDbType, filepath.Join(t.TempDir(), "interfacetest.db"))
+}
@@ -6,7 +6,7 @@ import (
 	"testing"
 	
 	"github.com/p9c/parallelcoin/pkg/walletdb"
-	_ "github.com/p9c/parallelcoin/pkg/walletdb/bdb"
+	_ "github.com/p9c/parallelcoin/pkg/walletdb/memdb"
 )
 
 var (
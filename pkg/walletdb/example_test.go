@@ -8,6 +8,7 @@ import (
 	
 	"github.com/p9c/parallelcoin/pkg/walletdb"
 	_ "github.com/p9c/parallelcoin/pkg/walletdb/bdb"
+	_ "github.com/p9c/parallelcoin/pkg/walletdb/memdb"
 )
 
 // This example demonstrates creating a new database.
@@ -37,24 +38,17 @@ func ExampleCreate() {
 	// Output:
 }
 
-// exampleNum is used as a counter in the exampleLoadDB function to provided a unique database name for each example.
-var exampleNum = 0
-
-// exampleLoadDB is used in the examples to elide the setup code.
-func exampleLoadDB() (db walletdb.DB, teardownFunc func(),e error) {
-	dbName := fmt.Sprintf("exampleload%d.db", exampleNum)
-	dbPath := filepath.Join(os.TempDir(), dbName)
-	db, e = walletdb.Create("bdb", dbPath)
+// exampleLoadDB is used in the examples to elide the setup code. The database is kept in memory by the memdb driver, so
+// there is nothing to remove when it is torn down.
+func exampleLoadDB() (db walletdb.DB, teardownFunc func(), e error) {
+	db, e = walletdb.Create("memdb")
 	if e != nil {
 		return nil, nil, e
 	}
 	teardownFunc = func() {
 		if e = db.Close(); walletdb.E.Chk(e) {
 		}
-		if e = os.Remove(dbPath); walletdb.E.Chk(e) {
-		}
 	}
-	exampleNum++
 	return db, teardownFunc, e
 }
 
@@ -0,0 +1,723 @@
+package memdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sync"
+
+	"github.com/p9c/parallelcoin/pkg/util/treap"
+	"github.com/p9c/parallelcoin/pkg/walletdb"
+)
+
+const (
+	// valueTag and bucketTag are the first byte of the values in the treap, and tell the key/value pairs of a bucket
+	// from its nested buckets. The rest of the value is the value of the pair, or the ID of the nested bucket.
+	//
+	// The key of every entry is the ID of the bucket it is in followed by its key, so the key/value pairs and nested
+	// buckets of a bucket share one key space and are iterated in the order of their keys, as they are in bdb.
+	valueTag  = 0x00
+	bucketTag = 0x01
+	// maxKeySize and maxValueSize are the largest key and value that can be stored. They are the limits of bdb, so
+	// code tested against a memory database fails the same way it would on disk.
+	maxKeySize   = 32768
+	maxValueSize = (1 << 31) - 2
+	// copyVersion is the version of the format written by Copy.
+	copyVersion = 1
+)
+
+var (
+	// rootBucketID is the ID of the bucket holding the top level buckets.
+	rootBucketID = [4]byte{}
+	// copyMagic starts the output of Copy, so that Open can tell it from other data.
+	copyMagic = []byte("memwdb")
+)
+
+// bucketKey returns the key used in the treap for a key of the bucket with the provided ID. The key is copied, as the
+// database keeps it for longer than the transaction.
+func bucketKey(bucketID [4]byte, key []byte) []byte {
+	bKey := make([]byte, len(bucketID)+len(key))
+	copy(bKey, bucketID[:])
+	copy(bKey[len(bucketID):], key)
+	return bKey
+}
+
+// prefixLimit returns the smallest key greater than every key with the passed prefix, for use as the exclusive limit of
+// a treap iterator. It returns nil when there is no such key.
+func prefixLimit(prefix []byte) []byte {
+	limit := append([]byte{}, prefix...)
+	for i := len(limit) - 1; i >= 0; i-- {
+		limit[i]++
+		if limit[i] != 0 {
+			return limit[:i+1]
+		}
+	}
+	return nil
+}
+
+// state is the contents of a database at a point in time.
+//
+// The treap is immutable, so a transaction works on its own copy of the state without affecting any other, and a
+// read-write transaction is committed by replacing the state of the database with its copy.
+type state struct {
+	// keys holds the key/value pairs and nested buckets of all of the buckets.
+	keys *treap.Immutable
+	// lastBucketID is the highest bucket ID in use.
+	lastBucketID uint32
+}
+
+// transaction represents a database transaction. It can either be read-only or read-write and implements the walletdb
+// Tx interfaces. The transaction provides a root bucket against which all read and writes occur.
+type transaction struct {
+	closed   bool    // Is the transaction closed?
+	writable bool    // Is the transaction writable?
+	db       *db     // DB instance the tx was created from.
+	state    state   // The state of the database as seen by the transaction.
+	root     *bucket // The bucket holding the top level buckets.
+}
+
+// Enforce transaction implements the walletdb Tx interfaces.
+var _ walletdb.ReadWriteTx = (*transaction)(nil)
+
+// checkWritable returns an error if the transaction is closed or read-only.
+func (tx *transaction) checkWritable() (e error) {
+	if tx.closed {
+		return walletdb.ErrTxClosed
+	}
+	if !tx.writable {
+		return walletdb.ErrTxNotWritable
+	}
+	return nil
+}
+
+func (tx *transaction) ReadBucket(key []byte) walletdb.ReadBucket {
+	return tx.ReadWriteBucket(key)
+}
+func (tx *transaction) ReadWriteBucket(key []byte) walletdb.ReadWriteBucket {
+	return tx.root.NestedReadWriteBucket(key)
+}
+func (tx *transaction) CreateTopLevelBucket(key []byte) (walletdb.ReadWriteBucket, error) {
+	return tx.root.CreateBucketIfNotExists(key)
+}
+func (tx *transaction) DeleteTopLevelBucket(key []byte) (e error) {
+	return tx.root.DeleteNestedBucket(key)
+}
+
+// close marks the transaction closed then releases its state, the transaction read lock, and the write lock when the
+// transaction is writable.
+func (tx *transaction) close() {
+	tx.closed = true
+	tx.state = state{}
+	tx.db.closeLock.RUnlock()
+	// Release the writer lock for writable transactions to unblock any other write transaction which are possibly
+	// waiting.
+	if tx.writable {
+		tx.db.writeLock.Unlock()
+	}
+}
+
+// Commit replaces the state of the database with the state of the transaction, making all of the changes made by the
+// transaction visible to transactions started after it.
+//
+// As with bdb, a read-only transaction can not be committed and stays open until it is rolled back.
+//
+// This function is part of the walletdb.Tx interface implementation.
+func (tx *transaction) Commit() (e error) {
+	if e = tx.checkWritable(); e != nil {
+		return e
+	}
+	tx.db.stateLock.Lock()
+	tx.db.state = tx.state
+	tx.db.stateLock.Unlock()
+	tx.close()
+	return nil
+}
+
+// Rollback undoes all changes that have been made to the root bucket and all of its sub-buckets.
+//
+// This function is part of the walletdb.Tx interface implementation.
+func (tx *transaction) Rollback() (e error) {
+	if tx.closed {
+		return walletdb.ErrTxClosed
+	}
+	tx.close()
+	return nil
+}
+
+// bucket is an internal type used to represent a collection of key/value pairs and implements the walletdb Bucket
+// interfaces.
+type bucket struct {
+	tx *transaction
+	id [4]byte
+}
+
+// Enforce bucket implements the walletdb Bucket interfaces.
+var _ walletdb.ReadWriteBucket = (*bucket)(nil)
+
+// entry returns the value stored in the treap for the key of the bucket, which is nil when there is none.
+func (b *bucket) entry(key []byte) []byte {
+	if b.tx.closed || len(key) == 0 {
+		return nil
+	}
+	return b.tx.state.keys.Get(bucketKey(b.id, key))
+}
+
+// nested returns the nested bucket stored in the passed value, or nil if it is not a bucket.
+func (b *bucket) nested(value []byte) *bucket {
+	if len(value) == 0 || value[0] != bucketTag {
+		return nil
+	}
+	child := &bucket{tx: b.tx}
+	copy(child.id[:], value[1:])
+	return child
+}
+
+// NestedReadWriteBucket retrieves a nested bucket with the given key. Returns nil if the bucket does not exist.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) NestedReadWriteBucket(key []byte) walletdb.ReadWriteBucket {
+	child := b.nested(b.entry(key))
+	// Don't return a non-nil interface to a nil pointer.
+	if child == nil {
+		return nil
+	}
+	return child
+}
+func (b *bucket) NestedReadBucket(key []byte) walletdb.ReadBucket {
+	return b.NestedReadWriteBucket(key)
+}
+
+// createBucket adds a new nested bucket with the given key, which must not be in use, and returns it.
+func (b *bucket) createBucket(key []byte) *bucket {
+	tx := b.tx
+	tx.state.lastBucketID++
+	child := &bucket{tx: tx}
+	binary.BigEndian.PutUint32(child.id[:], tx.state.lastBucketID)
+	value := append([]byte{bucketTag}, child.id[:]...)
+	tx.state.keys = tx.state.keys.Put(bucketKey(b.id, key), value)
+	return child
+}
+
+// CreateBucket creates and returns a new nested bucket with the given key.
+//
+// Returns ErrBucketExists if the bucket already exists, ErrBucketNameRequired if the key is empty, or
+// ErrIncompatibleValue if the key is in use by a key/value pair.
+//
+// This function is part of the walletdb.Bucket interface implementation.
+func (b *bucket) CreateBucket(key []byte) (rwb walletdb.ReadWriteBucket, e error) {
+	if e = b.tx.checkWritable(); e != nil {
+		return nil, e
+	}
+	if len(key) == 0 {
+		return nil, walletdb.ErrBucketNameRequired
+	}
+	if value := b.entry(key); value != nil {
+		if b.nested(value) != nil {
+			return nil, walletdb.ErrBucketExists
+		}
+		return nil, walletdb.ErrIncompatibleValue
+	}
+	return b.createBucket(key), nil
+}
+
+// CreateBucketIfNotExists creates and returns a new nested bucket with the given key if it does not already exist.
+//
+// Returns ErrBucketNameRequired if the key is empty or ErrIncompatibleValue if the key is in use by a key/value pair.
+//
+// This function is part of the walletdb.Bucket interface implementation.
+func (b *bucket) CreateBucketIfNotExists(key []byte) (rwb walletdb.ReadWriteBucket, e error) {
+	if e = b.tx.checkWritable(); e != nil {
+		return nil, e
+	}
+	if len(key) == 0 {
+		return nil, walletdb.ErrBucketNameRequired
+	}
+	if value := b.entry(key); value != nil {
+		if child := b.nested(value); child != nil {
+			return child, nil
+		}
+		return nil, walletdb.ErrIncompatibleValue
+	}
+	return b.createBucket(key), nil
+}
+
+// deleteContents removes all of the key/value pairs and nested buckets of the bucket with the passed ID.
+func (tx *transaction) deleteContents(id [4]byte) {
+	prefix := id[:]
+	iter := tx.state.keys.Iterator(prefix, prefixLimit(prefix))
+	// The treap is immutable, so the iterator keeps working on the state from before the deletions.
+	for ok := iter.First(); ok; ok = iter.Next() {
+		if child := tx.root.nested(iter.Value()); child != nil {
+			tx.deleteContents(child.id)
+		}
+		tx.state.keys = tx.state.keys.Delete(iter.Key())
+	}
+}
+
+// DeleteNestedBucket removes a nested bucket with the given key, along with everything in it.
+//
+// Returns ErrTxNotWritable if attempted against a read-only transaction and ErrBucketNotFound if the specified bucket
+// does not exist. As with bdb, an empty key or the key of a key/value pair returns ErrIncompatibleValue.
+//
+// This function is part of the walletdb.Bucket interface implementation.
+func (b *bucket) DeleteNestedBucket(key []byte) (e error) {
+	if e = b.tx.checkWritable(); e != nil {
+		return e
+	}
+	if len(key) == 0 {
+		return walletdb.ErrIncompatibleValue
+	}
+	value := b.entry(key)
+	if value == nil {
+		return walletdb.ErrBucketNotFound
+	}
+	child := b.nested(value)
+	if child == nil {
+		return walletdb.ErrIncompatibleValue
+	}
+	b.tx.deleteContents(child.id)
+	b.tx.state.keys = b.tx.state.keys.Delete(bucketKey(b.id, key))
+	return nil
+}
+
+// ForEach invokes the passed function with every key/value pair in the bucket.
+//
+// This includes nested buckets, in which case the value is nil, but it does not include the key/value pairs within
+// those nested buckets.
+//
+// The pairs are those in the bucket when ForEach is called, so the passed function may change the bucket.
+//
+// This function is part of the walletdb.Bucket interface implementation.
+func (b *bucket) ForEach(fn func(k, v []byte) error) (e error) {
+	if b.tx.closed {
+		return walletdb.ErrTxClosed
+	}
+	c := b.cursor()
+	for k, v := c.First(); k != nil; k, v = c.iterNext() {
+		if e = fn(k, v); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// Put saves the specified key/value pair to the bucket.
+//
+// Keys that do not already exist are added and keys that already exist are overwritten.
+//
+// Returns ErrTxNotWritable if attempted against a read-only transaction, ErrKeyRequired if the key is empty,
+// ErrKeyTooLarge or ErrValueTooLarge if the key or value is larger than bdb allows, and ErrIncompatibleValue if the key
+// is in use by a nested bucket.
+//
+// This function is part of the walletdb.Bucket interface implementation.
+func (b *bucket) Put(key, value []byte) (e error) {
+	if e = b.tx.checkWritable(); e != nil {
+		return e
+	}
+	switch {
+	case len(key) == 0:
+		return walletdb.ErrKeyRequired
+	case len(key) > maxKeySize:
+		return walletdb.ErrKeyTooLarge
+	case int64(len(value)) > maxValueSize:
+		return walletdb.ErrValueTooLarge
+	}
+	if b.nested(b.entry(key)) != nil {
+		return walletdb.ErrIncompatibleValue
+	}
+	stored := make([]byte, 1+len(value))
+	stored[0] = valueTag
+	copy(stored[1:], value)
+	b.tx.state.keys = b.tx.state.keys.Put(bucketKey(b.id, key), stored)
+	return nil
+}
+
+// Get returns the value for the given key.
+//
+// Returns nil if the key does not exist in this bucket or is a nested bucket.
+//
+// NOTE: The value returned by this function must not be modified.
+//
+// This function is part of the walletdb.Bucket interface implementation.
+func (b *bucket) Get(key []byte) []byte {
+	value := b.entry(key)
+	if len(value) == 0 || value[0] != valueTag {
+		return nil
+	}
+	return value[1:]
+}
+
+// Delete removes the specified key from the bucket.
+//
+// Deleting a key that does not exist does not return an error.
+//
+// Returns ErrTxNotWritable if attempted against a read-only transaction, or ErrIncompatibleValue if the key is a nested
+// bucket.
+//
+// This function is part of the walletdb.Bucket interface implementation.
+func (b *bucket) Delete(key []byte) (e error) {
+	if e = b.tx.checkWritable(); e != nil {
+		return e
+	}
+	if b.nested(b.entry(key)) != nil {
+		return walletdb.ErrIncompatibleValue
+	}
+	if len(key) != 0 {
+		b.tx.state.keys = b.tx.state.keys.Delete(bucketKey(b.id, key))
+	}
+	return nil
+}
+func (b *bucket) ReadCursor() walletdb.ReadCursor {
+	return b.ReadWriteCursor()
+}
+
+// ReadWriteCursor returns a new cursor, allowing for iteration over the bucket's key/value pairs and nested buckets in
+// forward or backward order.
+//
+// This function is part of the walletdb.Bucket interface implementation.
+func (b *bucket) ReadWriteCursor() walletdb.ReadWriteCursor {
+	return b.cursor()
+}
+
+// cursor returns a new cursor over the bucket.
+func (b *bucket) cursor() *cursor {
+	prefix := b.id[:]
+	return &cursor{bucket: b, prefix: prefix, limit: prefixLimit(prefix)}
+}
+
+// cursor represents a cursor over key/value pairs and nested buckets of a bucket.
+//
+// The cursor iterates the state of the transaction as it was when the cursor was last moved. When the transaction has
+// changed since then, Next and Prev find their place again in the new state, so unlike with bdb the cursor stays valid
+// when the bucket is changed.
+type cursor struct {
+	bucket *bucket
+	prefix []byte
+	limit  []byte
+	keys   *treap.Immutable
+	iter   *treap.Iterator
+}
+
+// Enforce cursor implements the walletdb Cursor interfaces.
+var _ walletdb.ReadWriteCursor = (*cursor)(nil)
+
+// reset replaces the iterator of the cursor with one over the current state of the transaction.
+func (c *cursor) reset() {
+	c.keys = c.bucket.tx.state.keys
+	c.iter = c.keys.Iterator(c.prefix, c.limit)
+}
+
+// valid returns whether the cursor is at a key/value pair of an open transaction.
+func (c *cursor) valid() bool {
+	return !c.bucket.tx.closed && c.iter != nil && c.iter.Valid()
+}
+
+// current returns the key/value pair the cursor is at, with a nil value for a nested bucket.
+func (c *cursor) current() (key, value []byte) {
+	if !c.valid() {
+		return nil, nil
+	}
+	key, value = c.iter.Key()[len(c.prefix):], c.iter.Value()
+	if value[0] == bucketTag {
+		return key, nil
+	}
+	return key, value[1:]
+}
+
+// iterNext moves the cursor forward in the state it was positioned in, ignoring changes made since, as ForEach does.
+func (c *cursor) iterNext() (key, value []byte) {
+	if !c.valid() {
+		return nil, nil
+	}
+	c.iter.Next()
+	return c.current()
+}
+
+// Delete removes the current key/value pair the cursor is at without invalidating the cursor.
+//
+// Returns ErrTxNotWritable if attempted on a read-only transaction, or ErrIncompatibleValue if attempted when the
+// cursor points to a nested bucket or is exhausted.
+//
+// This function is part of the walletdb.Cursor interface implementation.
+func (c *cursor) Delete() (e error) {
+	if e = c.bucket.tx.checkWritable(); e != nil {
+		return e
+	}
+	if !c.valid() || c.iter.Value()[0] == bucketTag {
+		return walletdb.ErrIncompatibleValue
+	}
+	tx := c.bucket.tx
+	tx.state.keys = tx.state.keys.Delete(c.iter.Key())
+	return nil
+}
+
+// First positions the cursor at the first key/value pair and returns the pair.
+//
+// This function is part of the walletdb.Cursor interface implementation.
+func (c *cursor) First() (key, value []byte) {
+	if c.bucket.tx.closed {
+		return nil, nil
+	}
+	c.reset()
+	c.iter.First()
+	return c.current()
+}
+
+// Last positions the cursor at the last key/value pair and returns the pair.
+//
+// This function is part of the walletdb.Cursor interface implementation.
+func (c *cursor) Last() (key, value []byte) {
+	if c.bucket.tx.closed {
+		return nil, nil
+	}
+	c.reset()
+	c.iter.Last()
+	return c.current()
+}
+
+// Next moves the cursor one key/value pair forward and returns the new pair.
+//
+// This function is part of the walletdb.Cursor interface implementation.
+func (c *cursor) Next() (key, value []byte) {
+	if !c.valid() {
+		return nil, nil
+	}
+	if c.keys == c.bucket.tx.state.keys {
+		c.iter.Next()
+		return c.current()
+	}
+	// The transaction has changed, so find the first key after the current one in its new state.
+	current := c.iter.Key()
+	c.reset()
+	if c.iter.Seek(current) && bytes.Equal(c.iter.Key(), current) {
+		c.iter.Next()
+	}
+	return c.current()
+}
+
+// Prev moves the cursor one key/value pair backward and returns the new pair.
+//
+// This function is part of the walletdb.Cursor interface implementation.
+func (c *cursor) Prev() (key, value []byte) {
+	if !c.valid() {
+		return nil, nil
+	}
+	if c.keys == c.bucket.tx.state.keys {
+		c.iter.Prev()
+		return c.current()
+	}
+	// The transaction has changed, so find the last key before the current one in its new state.
+	current := c.iter.Key()
+	c.reset()
+	if c.iter.Seek(current) {
+		c.iter.Prev()
+	} else {
+		c.iter.Last()
+	}
+	return c.current()
+}
+
+// Seek positions the cursor at the passed seek key.
+//
+// If the key does not exist, the cursor is moved to the next key after seek.
+//
+// Returns the new pair.
+//
+// This function is part of the walletdb.Cursor interface implementation.
+func (c *cursor) Seek(seek []byte) (key, value []byte) {
+	if c.bucket.tx.closed {
+		return nil, nil
+	}
+	c.reset()
+	c.iter.Seek(bucketKey(c.bucket.id, seek))
+	return c.current()
+}
+
+// db represents a collection of namespaces which are kept in memory and implements the walletdb.DB interface.
+//
+// All database access is performed through transactions which are obtained through the specific Namespace.
+type db struct {
+	writeLock sync.Mutex   // Limit to one write transaction at a time.
+	closeLock sync.RWMutex // Make database close block while txns active.
+	closed    bool         // Is the database closed?
+	stateLock sync.RWMutex // Protects the state from commits while transactions begin.
+	state     state        // The committed contents of the database.
+}
+
+// Enforce db implements the walletdb.DB interface.
+var _ walletdb.DB = (*db)(nil)
+
+// beginTx starts a transaction on a snapshot of the committed state of the database.
+//
+// Multiple read-only transactions can be open at the same time as a single read-write transaction, which blocks the
+// start of any other read-write transaction until it is closed. Neither sees the changes made by the other.
+func (db *db) beginTx(writable bool) (tx *transaction, e error) {
+	// Whenever a new writable transaction is started, grab the write lock to ensure only a single write transaction can
+	// be active at the same time.
+	//
+	// This lock will not be released until the transaction is closed (via Rollback or Commit).
+	if writable {
+		db.writeLock.Lock()
+	}
+	// Whenever a new transaction is started, grab a read lock against the database to ensure Close will wait for the
+	// transaction to finish.
+	//
+	// This lock will not be released until the transaction is closed (via Rollback or Commit).
+	db.closeLock.RLock()
+	if db.closed {
+		db.closeLock.RUnlock()
+		if writable {
+			db.writeLock.Unlock()
+		}
+		return nil, walletdb.ErrDbNotOpen
+	}
+	// The state is immutable, so a copy of it is a snapshot of the database.
+	db.stateLock.RLock()
+	tx = &transaction{
+		writable: writable,
+		db:       db,
+		state:    db.state,
+	}
+	db.stateLock.RUnlock()
+	tx.root = &bucket{tx: tx, id: rootBucketID}
+	return tx, nil
+}
+func (db *db) BeginReadTx() (walletdb.ReadTx, error) {
+	return db.beginTx(false)
+}
+func (db *db) BeginReadWriteTx() (walletdb.ReadWriteTx, error) {
+	return db.beginTx(true)
+}
+
+// Copy writes a copy of the committed contents of the database to the provided writer, which can be loaded into a new
+// memory database by passing it to Open.
+//
+// The copy is a magic string followed by the version, the last bucket ID and the key and value of each entry of the
+// treap, each preceded by its length. The numbers are written as uvarints:
+//
+//	<magic><version><last bucket ID><key length><key><value length><value>...
+//
+// This function is part of the walletdb.Db interface implementation.
+func (db *db) Copy(w io.Writer) (e error) {
+	db.closeLock.RLock()
+	if db.closed {
+		db.closeLock.RUnlock()
+		return walletdb.ErrDbNotOpen
+	}
+	db.stateLock.RLock()
+	snapshot := db.state
+	db.stateLock.RUnlock()
+	db.closeLock.RUnlock()
+	bw := bufio.NewWriter(w)
+	var buf [binary.MaxVarintLen64]byte
+	writeUvarint := func(x uint64) {
+		if e == nil {
+			_, e = bw.Write(buf[:binary.PutUvarint(buf[:], x)])
+		}
+	}
+	writeBytes := func(b []byte) {
+		writeUvarint(uint64(len(b)))
+		if e == nil {
+			_, e = bw.Write(b)
+		}
+	}
+	if _, e = bw.Write(copyMagic); E.Chk(e) {
+		return e
+	}
+	writeUvarint(copyVersion)
+	writeUvarint(uint64(snapshot.lastBucketID))
+	snapshot.keys.ForEach(
+		func(k, v []byte) bool {
+			writeBytes(k)
+			writeBytes(v)
+			return e == nil
+		},
+	)
+	if E.Chk(e) {
+		return e
+	}
+	return bw.Flush()
+}
+
+// Close shuts down the database and releases its contents.
+//
+// It will block until all database transactions have been finalized (rolled back or committed). As with bdb, closing a
+// database that is already closed does nothing.
+//
+// This function is part of the walletdb.Db interface implementation.
+func (db *db) Close() (e error) {
+	// Since all transactions have a read lock on this mutex, this will cause Close to wait for all readers to complete.
+	db.closeLock.Lock()
+	defer db.closeLock.Unlock()
+	db.closed = true
+	db.stateLock.Lock()
+	db.state = state{}
+	db.stateLock.Unlock()
+	return nil
+}
+
+// newDB returns a new empty database.
+func newDB() *db {
+	return &db{state: state{keys: treap.NewImmutable()}}
+}
+
+// loadDB returns a new database holding the contents of a copy written by Copy.
+//
+// walletdb.ErrInvalid is returned when the data is not a copy of a memory database.
+func loadDB(r io.Reader) (d *db, e error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(copyMagic))
+	if _, e = io.ReadFull(br, magic); e != nil || !bytes.Equal(magic, copyMagic) {
+		return nil, walletdb.ErrInvalid
+	}
+	var version, lastBucketID uint64
+	if version, e = binary.ReadUvarint(br); e != nil || version != copyVersion {
+		return nil, walletdb.ErrInvalid
+	}
+	if lastBucketID, e = binary.ReadUvarint(br); e != nil || lastBucketID > 1<<32-1 {
+		return nil, walletdb.ErrInvalid
+	}
+	d = newDB()
+	d.state.lastBucketID = uint32(lastBucketID)
+	readBytes := func() ([]byte, error) {
+		length, e := binary.ReadUvarint(br)
+		if e != nil {
+			return nil, e
+		}
+		if length > maxKeySize+maxValueSize {
+			return nil, walletdb.ErrInvalid
+		}
+		b := make([]byte, length)
+		_, e = io.ReadFull(br, b)
+		return b, e
+	}
+	for {
+		var k, v []byte
+		if k, e = readBytes(); e == io.EOF {
+			return d, nil
+		}
+		if e == nil {
+			v, e = readBytes()
+		}
+		if e != nil || !validEntry(k, v, d.state.lastBucketID) {
+			return nil, walletdb.ErrInvalid
+		}
+		d.state.keys = d.state.keys.Put(k, v)
+	}
+}
+
+// validEntry returns whether the key and value can be an entry of a database with the last bucket ID.
+func validEntry(k, v []byte, lastBucketID uint32) bool {
+	if len(k) <= len(rootBucketID) || len(v) == 0 ||
+		binary.BigEndian.Uint32(k) > lastBucketID {
+		return false
+	}
+	switch v[0] {
+	case valueTag:
+		return true
+	case bucketTag:
+		return len(v) == 5 && binary.BigEndian.Uint32(v[1:]) <= lastBucketID
+	}
+	return false
+}
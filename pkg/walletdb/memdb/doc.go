@@ -0,0 +1,30 @@
+/*Package memdb implements an instance of walletdb that keeps the database in memory.
+
+The buckets are kept in an immutable treap, so each transaction works on a snapshot of the database. Read-only
+transactions do not see the changes of a read-write transaction until it is committed, and a read-write transaction
+replaces the contents of the database in one step when it is committed. Nothing is written to disk, which makes the
+driver suited to tests of the packages built on walletdb.
+
+Usage
+
+This package is only a driver to the walletdb package and provides the database type of "memdb". The Create function
+takes either no parameters, or the database path that bdb takes, which is ignored so memdb can be selected in place of
+bdb without changing the caller:
+
+	db, e := walletdb.Create("memdb")
+	if e != nil  {
+		// Handle error
+	}
+
+The contents of a database are lost when it is closed, unless they were saved with Copy. The Open function takes the
+io.Reader of such a copy and returns a new database holding its contents:
+
+	db, e := walletdb.Open("memdb", bytes.NewReader(saved))
+	if e != nil  {
+		// Handle error
+	}
+
+Passing Open a database path returns ErrDbDoesNotExist, so callers that fall back to Create when a database does not
+exist get a new empty database.
+*/
+package memdb
@@ -0,0 +1,73 @@
+package memdb
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/p9c/parallelcoin/pkg/walletdb"
+)
+
+const (
+	dbType = "memdb"
+)
+
+// openDBDriver is the callback provided during driver registration that opens an existing database for use. The only
+// databases there are to open are copies written by Copy, which are passed as an io.Reader. A database path, as bdb
+// takes, returns ErrDbDoesNotExist, as memory databases do not outlive the instance that created them.
+func openDBDriver(args ...interface{}) (d walletdb.DB, e error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf(
+			"invalid arguments to %s.Open -- "+
+				"expected database copy or path", dbType,
+		)
+	}
+	switch arg := args[0].(type) {
+	case io.Reader:
+		return loadDB(arg)
+	case string:
+		return nil, walletdb.ErrDbDoesNotExist
+	}
+	return nil, fmt.Errorf(
+		"first argument to %s.Open is invalid -- "+
+			"expected database copy io.Reader or path string", dbType,
+	)
+}
+
+// createDBDriver is the callback provided during driver registration that creates, initializes, and opens a database
+// for use. It takes either no arguments or the database path that bdb takes, which is ignored so memdb can be selected
+// in place of bdb without changing the caller.
+func createDBDriver(args ...interface{}) (d walletdb.DB, e error) {
+	switch len(args) {
+	case 0:
+	case 1:
+		if _, ok := args[0].(string); !ok {
+			return nil, fmt.Errorf(
+				"first argument to %s.Create is invalid -- "+
+					"expected database path string", dbType,
+			)
+		}
+	default:
+		return nil, fmt.Errorf(
+			"invalid arguments to %s.Create -- "+
+				"expected no arguments or database path", dbType,
+		)
+	}
+	return newDB(), nil
+}
+func init() {
+	// Register the driver.
+	driver := walletdb.Driver{
+		DbType: dbType,
+		Create: createDBDriver,
+		Open:   openDBDriver,
+	}
+	var e error
+	if e = walletdb.RegisterDriver(driver); E.Chk(e) {
+		panic(
+			fmt.Sprintf(
+				"Failed to regiser database driver '%s': %v",
+				dbType, e,
+			),
+		)
+	}
+}
@@ -0,0 +1,349 @@
+package memdb_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/p9c/parallelcoin/pkg/walletdb"
+	_ "github.com/p9c/parallelcoin/pkg/walletdb/memdb"
+)
+
+// dbType is the database type name for this driver.
+const dbType = "memdb"
+
+// createTestDB creates a database holding a bucket with a key/value pair and a nested bucket.
+func createTestDB(t *testing.T) walletdb.DB {
+	db, e := walletdb.Create(dbType)
+	if e != nil {
+		t.Fatalf("Create: unexpected error: %v", e)
+	}
+	e = walletdb.Update(
+		db, func(tx walletdb.ReadWriteTx) (e error) {
+			var b walletdb.ReadWriteBucket
+			if b, e = tx.CreateTopLevelBucket([]byte("ns")); e != nil {
+				return e
+			}
+			var nested walletdb.ReadWriteBucket
+			if nested, e = b.CreateBucket([]byte("nested")); e != nil {
+				return e
+			}
+			if e = nested.Put([]byte("key"), []byte("nested value")); e != nil {
+				return e
+			}
+			return b.Put([]byte("key"), []byte("value"))
+		},
+	)
+	if e != nil {
+		t.Fatalf("Update: unexpected error: %v", e)
+	}
+	return db
+}
+
+// get returns the value of the key in the bucket at the path in a read-only transaction, or nil if there is none.
+func get(tx walletdb.ReadTx, key string, path ...string) []byte {
+	b := tx.ReadBucket([]byte(path[0]))
+	for _, name := range path[1:] {
+		if b == nil {
+			break
+		}
+		b = b.NestedReadBucket([]byte(name))
+	}
+	if b == nil {
+		return nil
+	}
+	return b.Get([]byte(key))
+}
+
+// TestCreateOpenFail ensures that errors related to creating and opening a database are handled properly.
+func TestCreateOpenFail(t *testing.T) {
+	if _, e := walletdb.Create(dbType, 1); e == nil {
+		t.Errorf("Create: expected an error for a path that is not a string")
+	}
+	if _, e := walletdb.Create(dbType, "a", "b"); e == nil {
+		t.Errorf("Create: expected an error for too many arguments")
+	}
+	if _, e := walletdb.Open(dbType); e == nil {
+		t.Errorf("Open: expected an error for missing arguments")
+	}
+	if _, e := walletdb.Open(dbType, 1); e == nil {
+		t.Errorf("Open: expected an error for an argument that is not a copy or a path")
+	}
+	wantErr := walletdb.ErrDbDoesNotExist
+	if _, e := walletdb.Open(dbType, "noexist.db"); e != wantErr {
+		t.Errorf("Open: got %v, want %v", e, wantErr)
+	}
+	wantErr = walletdb.ErrInvalid
+	if _, e := walletdb.Open(dbType, bytes.NewReader([]byte("not a copy"))); e != wantErr {
+		t.Errorf("Open: got %v, want %v", e, wantErr)
+	}
+	// Ensure operations against a closed database return the expected error.
+	db := createTestDB(t)
+	if e := db.Close(); e != nil {
+		t.Fatalf("Close: unexpected error: %v", e)
+	}
+	wantErr = walletdb.ErrDbNotOpen
+	if _, e := db.BeginReadTx(); e != wantErr {
+		t.Errorf("BeginReadTx: got %v, want %v", e, wantErr)
+	}
+	if _, e := db.BeginReadWriteTx(); e != wantErr {
+		t.Errorf("BeginReadWriteTx: got %v, want %v", e, wantErr)
+	}
+	if e := db.Copy(&bytes.Buffer{}); e != wantErr {
+		t.Errorf("Copy: got %v, want %v", e, wantErr)
+	}
+}
+
+// TestIsolation ensures transactions only see the changes of read-write transactions that were committed before they
+// started, and that a rolled back transaction changes nothing.
+func TestIsolation(t *testing.T) {
+	db := createTestDB(t)
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("Close: unexpected error: %v", e)
+		}
+	}()
+	before, e := db.BeginReadTx()
+	if e != nil {
+		t.Fatalf("BeginReadTx: unexpected error: %v", e)
+	}
+	defer func() {
+		if e := before.Rollback(); e != nil {
+			t.Errorf("Rollback: unexpected error: %v", e)
+		}
+	}()
+	rw, e := db.BeginReadWriteTx()
+	if e != nil {
+		t.Fatalf("BeginReadWriteTx: unexpected error: %v", e)
+	}
+	if e = rw.ReadWriteBucket([]byte("ns")).Put([]byte("key"), []byte("changed")); e != nil {
+		t.Fatalf("Put: unexpected error: %v", e)
+	}
+	if e = rw.DeleteTopLevelBucket([]byte("ns")); e != nil {
+		t.Fatalf("DeleteTopLevelBucket: unexpected error: %v", e)
+	}
+	if _, e = rw.CreateTopLevelBucket([]byte("new")); e != nil {
+		t.Fatalf("CreateTopLevelBucket: unexpected error: %v", e)
+	}
+	// A read-only transaction started while the read-write transaction is open does not see its changes.
+	e = walletdb.View(
+		db, func(tx walletdb.ReadTx) error {
+			if v := get(tx, "key", "ns", "nested"); string(v) != "nested value" {
+				t.Errorf("Get: got %q during a read-write transaction, want nested value", v)
+			}
+			if tx.ReadBucket([]byte("new")) != nil {
+				t.Errorf("ReadBucket: a bucket that is not committed is visible")
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Fatalf("View: unexpected error: %v", e)
+	}
+	if e = rw.Commit(); e != nil {
+		t.Fatalf("Commit: unexpected error: %v", e)
+	}
+	// The transaction started before the commit still sees the database as it was.
+	if v := get(before, "key", "ns"); string(v) != "value" {
+		t.Errorf("Get: got %q after a later commit, want value", v)
+	}
+	e = walletdb.View(
+		db, func(tx walletdb.ReadTx) error {
+			if tx.ReadBucket([]byte("ns")) != nil || tx.ReadBucket([]byte("new")) == nil {
+				t.Errorf("ReadBucket: the committed changes are not visible")
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Fatalf("View: unexpected error: %v", e)
+	}
+	// Recreating a deleted bucket does not bring back its contents.
+	e = walletdb.Update(
+		db, func(tx walletdb.ReadWriteTx) (e error) {
+			var b walletdb.ReadWriteBucket
+			if b, e = tx.CreateTopLevelBucket([]byte("ns")); e != nil {
+				return e
+			}
+			if b.Get([]byte("key")) != nil || b.NestedReadBucket([]byte("nested")) != nil {
+				t.Errorf("CreateTopLevelBucket: a deleted bucket has kept its contents")
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Fatalf("Update: unexpected error: %v", e)
+	}
+	// A rolled back transaction changes nothing.
+	if rw, e = db.BeginReadWriteTx(); e != nil {
+		t.Fatalf("BeginReadWriteTx: unexpected error: %v", e)
+	}
+	if e = rw.DeleteTopLevelBucket([]byte("new")); e != nil {
+		t.Fatalf("DeleteTopLevelBucket: unexpected error: %v", e)
+	}
+	if e = rw.Rollback(); e != nil {
+		t.Fatalf("Rollback: unexpected error: %v", e)
+	}
+	e = walletdb.View(
+		db, func(tx walletdb.ReadTx) error {
+			if tx.ReadBucket([]byte("new")) == nil {
+				t.Errorf("ReadBucket: a rolled back deletion was kept")
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Fatalf("View: unexpected error: %v", e)
+	}
+}
+
+// TestCursor ensures cursors return the key/value pairs and nested buckets of a bucket in the order of their keys and
+// keep their place when the bucket is changed.
+func TestCursor(t *testing.T) {
+	db := createTestDB(t)
+	defer func() {
+		if e := db.Close(); e != nil {
+			t.Errorf("Close: unexpected error: %v", e)
+		}
+	}()
+	e := walletdb.Update(
+		db, func(tx walletdb.ReadWriteTx) (e error) {
+			var b walletdb.ReadWriteBucket
+			if b, e = tx.CreateTopLevelBucket([]byte("cursor")); e != nil {
+				return e
+			}
+			for _, key := range []string{"d", "bb", "ba", "a", "b"} {
+				if e = b.Put([]byte(key), []byte(key)); e != nil {
+					return e
+				}
+			}
+			if _, e = b.CreateBucket([]byte("c")); e != nil {
+				return e
+			}
+			c := b.ReadWriteCursor()
+			if k, _ := c.Seek([]byte("b")); string(k) != "b" {
+				t.Errorf("Seek: got %q, want b", k)
+			}
+			if e = c.Delete(); e != nil {
+				return e
+			}
+			if k, _ := c.Next(); string(k) != "ba" {
+				t.Errorf("Next after Delete: got %q, want ba", k)
+			}
+			if e = b.Put([]byte("b"), []byte("b")); e != nil {
+				return e
+			}
+			if k, _ := c.Prev(); string(k) != "b" {
+				t.Errorf("Prev after Put: got %q, want b", k)
+			}
+			if k, v := c.Seek([]byte("bc")); string(k) != "c" || v != nil {
+				t.Errorf("Seek: got %q %q, want the bucket c", k, v)
+			}
+			if e = c.Delete(); e != walletdb.ErrIncompatibleValue {
+				t.Errorf("Delete: got %v, want %v", e, walletdb.ErrIncompatibleValue)
+			}
+			if e = b.Delete([]byte("d")); e != nil {
+				return e
+			}
+			if k, _ := c.Next(); k != nil {
+				t.Errorf("Next: got %q after the last key was deleted, want nothing", k)
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Fatalf("Update: unexpected error: %v", e)
+	}
+	e = walletdb.View(
+		db, func(tx walletdb.ReadTx) error {
+			b := tx.ReadBucket([]byte("cursor"))
+			var got []string
+			c := b.ReadCursor()
+			for k, _ := c.First(); k != nil; k, _ = c.Next() {
+				got = append(got, string(k))
+			}
+			if want := []string{"a", "b", "ba", "bb", "c"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("cursor: got %v, want %v", got, want)
+			}
+			got = nil
+			for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+				got = append(got, string(k))
+			}
+			if want := []string{"c", "bb", "ba", "b", "a"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("reverse cursor: got %v, want %v", got, want)
+			}
+			if e := c.(walletdb.ReadWriteCursor).Delete(); e != walletdb.ErrTxNotWritable {
+				t.Errorf("Delete: got %v, want %v", e, walletdb.ErrTxNotWritable)
+			}
+			// The cursor of the nested bucket of the other bucket does not see the keys around it.
+			if k, _ := tx.ReadBucket([]byte("ns")).NestedReadBucket([]byte("nested")).ReadCursor().Last(); string(k) != "key" {
+				t.Errorf("Last: got %q in the nested bucket, want key", k)
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Fatalf("View: unexpected error: %v", e)
+	}
+}
+
+// TestCopy ensures a copy of a database can be opened and holds the same buckets and key/value pairs.
+func TestCopy(t *testing.T) {
+	db := createTestDB(t)
+	var saved bytes.Buffer
+	if e := db.Copy(&saved); e != nil {
+		t.Fatalf("Copy: unexpected error: %v", e)
+	}
+	if e := db.Close(); e != nil {
+		t.Fatalf("Close: unexpected error: %v", e)
+	}
+	// A copy that was cut short can not be opened.
+	if _, e := walletdb.Open(dbType, bytes.NewReader(saved.Bytes()[:saved.Len()-1])); e != walletdb.ErrInvalid {
+		t.Errorf("Open: got %v for a truncated copy, want %v", e, walletdb.ErrInvalid)
+	}
+	loaded, e := walletdb.Open(dbType, bytes.NewReader(saved.Bytes()))
+	if e != nil {
+		t.Fatalf("Open: unexpected error: %v", e)
+	}
+	defer func() {
+		if e := loaded.Close(); e != nil {
+			t.Errorf("Close: unexpected error: %v", e)
+		}
+	}()
+	// Buckets created after loading the copy do not share the contents of the buckets in it.
+	e = walletdb.Update(
+		loaded, func(tx walletdb.ReadWriteTx) (e error) {
+			var b walletdb.ReadWriteBucket
+			if b, e = tx.CreateTopLevelBucket([]byte("new")); e != nil {
+				return e
+			}
+			if b.Get([]byte("key")) != nil {
+				t.Errorf("Get: a new bucket has the contents of a loaded one")
+			}
+			return b.Put([]byte("key"), []byte("new value"))
+		},
+	)
+	if e != nil {
+		t.Fatalf("Update: unexpected error: %v", e)
+	}
+	e = walletdb.View(
+		loaded, func(tx walletdb.ReadTx) error {
+			for _, test := range []struct {
+				path []string
+				want string
+			}{
+				{[]string{"ns"}, "value"},
+				{[]string{"ns", "nested"}, "nested value"},
+				{[]string{"new"}, "new value"},
+			} {
+				if v := get(tx, "key", test.path...); string(v) != test.want {
+					t.Errorf("Get %v: got %q, want %q", test.path, v, test.want)
+				}
+			}
+			return nil
+		},
+	)
+	if e != nil {
+		t.Fatalf("View: unexpected error: %v", e)
+	}
+}
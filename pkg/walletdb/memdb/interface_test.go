@@ -0,0 +1,18 @@
+package memdb_test
+
+// This file intended to be copied into each backend driver directory. Each driver should have their own driver_test.go
+// file which creates a database and invokes the testInterface function in this file to ensure the driver properly
+// implements the interface. See the bdb backend driver for a working example.
+//
+// NOTE: When copying this file into the backend driver folder, the package name will need to be changed accordingly.
+import (
+	"testing"
+
+	walletdbtest "github.com/p9c/parallelcoin/pkg/walletdb/ci"
+)
+
+// TestInterface performs all interfaces tests for this database driver. The path is ignored by the driver, so nothing
+// is written to it.
+func TestInterface(t *testing.T) {
+	walletdbtest.TestInterface(t, dbType, "interfacetest.db")
+}
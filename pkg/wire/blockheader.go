@@ -47,8 +47,9 @@ func (h BlockHeader) BlockHash() (out chainhash.Hash) {
 
 // BlockHashWithAlgos computes the block identifier hash for the given block header. This function is additional because
 // the sync manager and the parallelcoin protocol only use SHA256D hashes for inventories and calculating the scrypt (or
-// other) hash for these blocks when requested via that route causes an 'unrequested block' error.
-func (h *BlockHeader) BlockHashWithAlgos(height int32) (out chainhash.Hash) {
+// other) hash for these blocks when requested via that route causes an 'unrequested block' error. The algorithm is that of
+// the block version at the height in the given hard fork schedule.
+func (h *BlockHeader) BlockHashWithAlgos(height int32, forks *fork.Schedule) (out chainhash.Hash) {
 	// Encode the header and double sha256 everything prior to the number of transactions. Ignore the error returns
 	// since there is no way the encode could fail except being out of memory which would cause a run-time panic.
 	buf := bytes.NewBuffer(make([]byte, 0, MaxBlockHeaderPayload))
@@ -56,8 +57,8 @@ func (h *BlockHeader) BlockHashWithAlgos(height int32) (out chainhash.Hash) {
 		E.Ln("error writing block header to buffer", e)
 	}
 	vers := h.Version
-	algo := fork.GetAlgoName(vers, height)
-	out = forkhash.Hash(buf.Bytes(), algo, height)
+	algo := forks.GetAlgoName(vers, height)
+	out = forkhash.Hash(buf.Bytes(), algo, height, forks)
 	// L.Prror("BlockHashWithAlgos %d %s %s %s\n", vers, algo, out)
 	return
 }
@@ -6,6 +6,7 @@ import (
 	"io"
 	
 	chainhash "github.com/p9c/parallelcoin/pkg/chainhash"
+	"github.com/p9c/parallelcoin/pkg/fork"
 )
 
 // defaultTransactionAlloc is the default size used for the backing array for transactions. The transaction array will
@@ -228,8 +229,8 @@ func (msg *Block) BlockHash() chainhash.Hash {
 }
 
 // BlockHashWithAlgos computes the block identifier hash for this block.
-func (msg *Block) BlockHashWithAlgos(h int32) chainhash.Hash {
-	return msg.Header.BlockHashWithAlgos(h)
+func (msg *Block) BlockHashWithAlgos(h int32, forks *fork.Schedule) chainhash.Hash {
+	return msg.Header.BlockHashWithAlgos(h, forks)
 }
 
 // TxHashes returns a slice of hashes of all of transactions in this block.